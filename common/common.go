@@ -1,9 +1,13 @@
 package common
 
 import (
+	"context"
 	"crypto/x509"
 	"errors"
 	"net"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/couchbase/cbauth/metakv"
 	"github.com/couchbase/cbauth/service"
@@ -21,6 +25,48 @@ const (
 	DcpFromPrior  = DcpStreamBoundary("from_prior")
 )
 
+// Possible actions for documents larger than max_doc_size_bytes
+const (
+	MaxDocSizeModeSkip         = "skip"
+	MaxDocSizeModeMetadataOnly = "metadata_only"
+)
+
+// Possible values for delivery_guarantee. With at least once, checkpoints advance
+// only after handler successfully executes for the mutation, or it's dead lettered,
+// so mutations in flight when eventing-consumer crashes or vb moves are replayed
+// instead of being lost
+const (
+	DeliveryBestEffort  = "best_effort"
+	DeliveryAtLeastOnce = "at_least_once"
+)
+
+// Kinds of handler failures retry_on can list. Timeouts are executions terminated
+// for exceeding execution_timeout, lcb errors are KVErrors thrown by bucket ops
+const (
+	RetryOnTimeout     = "timeout"
+	RetryOnLcbError    = "lcb_error"
+	RetryOnJsException = "js_exception"
+)
+
+var RetryOnKinds = []string{RetryOnTimeout, RetryOnLcbError, RetryOnJsException}
+
+// Possible values for timer_integrity_check. Timer store of a vb is verified as it's
+// taken over, corrupt records and dangling alarms found are either only reported or
+// are repaired
+const (
+	TimerIntegrityOff    = "off"
+	TimerIntegritySkip   = "skip"
+	TimerIntegrityRepair = "repair"
+)
+
+// Possible values for worker_ipc_type. Workers talk to eventing-consumer over unix
+// domain sockets where possible with auto, falling back to localhost tcp ports
+const (
+	WorkerIPCAuto = "auto"
+	WorkerIPCTCP  = "af_inet"
+	WorkerIPCUnix = "af_unix"
+)
+
 var MetakvMaxRetries int64 = 60
 
 type ChangeType string
@@ -75,14 +121,34 @@ const (
 	MetakvTempAppsPath    = MetakvEventingPath + "tempApps/"
 	MetakvCredentialsPath = MetakvEventingPath + "credentials/"
 	MetakvConfigPath      = MetakvEventingPath + "settings/config"
+	MetakvVbPlanPath      = MetakvEventingPath + "vbPlan/"    // Last vbucket to eventing node assignment of function
+	MetakvPausedVbsPath   = MetakvEventingPath + "pausedVbs/" // Vbuckets of function paused by admin
 )
 
 type DebuggerInstance struct {
-	Token           string   `json:"token"`             // An ID for a debugging session
-	Host            string   `json:"host"`              // The node where debugger has been spawned
-	Status          string   `json:"status"`            // Possible values are WaitingForMutation, MutationTrapped
-	URL             string   `json:"url"`               // Chrome-Devtools URL for debugging
-	NodesExternalIP []string `json:"nodes_external_ip"` // List of external IP address of the nodes in the cluster
+	Token           string          `json:"token"`             // An ID for a debugging session
+	Host            string          `json:"host"`              // The node where debugger has been spawned
+	Status          string          `json:"status"`            // Possible values are WaitingForMutation, MutationTrapped
+	URL             string          `json:"url"`               // Chrome-Devtools URL for debugging
+	NodesExternalIP []string        `json:"nodes_external_ip"` // List of external IP address of the nodes in the cluster
+	Replay          *DebuggerReplay `json:"replay,omitempty"`  // Set if session replays retained events instead of trapping a new one
+	StartedAt       time.Time       `json:"started_at"`
+	ExpiresAt       time.Time       `json:"expires_at"` // Session is stopped past this, zero implies it never expires
+}
+
+// DebuggerSession describes debug session of a function, leaving out its token
+type DebuggerSession struct {
+	AppName   string    `json:"function"`
+	Host      string    `json:"host,omitempty"`
+	Status    string    `json:"status"`
+	StartedAt time.Time `json:"started_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// DebuggerReplay asks debugger session to replay last few events dispatched for a vb
+type DebuggerReplay struct {
+	Vbucket uint16 `json:"vb"`
+	Count   int    `json:"count"` // 0 implies all events retained for the vb
 }
 
 type Application struct {
@@ -107,6 +173,10 @@ type DepCfg struct {
 	MetadataBucket     string     `json:"metadata_bucket"`
 	MetadataScope      string     `json:"metadata_scope"`
 	MetadataCollection string     `json:"metadata_collection"`
+	SourceCollections  []string   `json:"source_collections,omitempty"` // Of source scope, listened to along with source collection
+	KeyPrefixes        []string   `json:"key_prefixes,omitempty"`       // Events are sent to handler only if key has one of these prefixes
+	KeyPatterns        []string   `json:"key_patterns,omitempty"`       // or matches one of these regexes. All keys pass if neither is set
+	DependsOn          []string   `json:"depends_on,omitempty"`         // Functions deployed before and undeployed after this one
 }
 
 type Bucket struct {
@@ -115,6 +185,7 @@ type Bucket struct {
 	ScopeName      string `json:"scope_name"`
 	CollectionName string `json:"collection_name"`
 	Access         string `json:"access"`
+	Durability     string `json:"durability,omitempty"`
 }
 
 type Curl struct {
@@ -149,33 +220,82 @@ type SecuritySetting struct {
 
 var ErrRetryTimeout = errors.New("retry timeout")
 
+var ErrTimersNotInUse = errors.New("function doesn't use timers")
+
+var ErrDebuggerSessionEnded = errors.New("debugger session stopped or superseded")
+
+var ErrDebuggerTrapTimeout = errors.New("no mutation trapped by debugger within timeout")
+
+var ErrDebuggerTokenMismatch = errors.New("token doesn't match that of debugger session")
+
+var ErrWorkerProtocolMismatch = errors.New("no protocol version in common with worker")
+
+var ErrCompileTimeout = errors.New("no compile status from worker within timeout")
+
+var ErrConsumerStopped = errors.New("consumer stopped")
+
+var ErrHotSwapTimerUse = errors.New("hot swap can't change whether function uses timers")
+
+var ErrNoRunningConsumers = errors.New("no running consumers")
+
 // EventingProducer interface to export functions from eventing_producer
 type EventingProducer interface {
 	AddMetadataPrefix(key string) Key
 	Auth() string
 	AppendCurlLatencyStats(deltas StatsData)
 	AppendLatencyStats(deltas StatsData)
+	AppendN1qlLatencyStats(deltas StatsData)
 	BootstrapStatus() bool
+	CancelTimer(callback, reference string) error
+	VerifyTimerStore(vbs []uint16, policy string) ([]*TimerIntegrityReport, error)
 	CfgData() string
 	CheckpointBlobDump() map[string]interface{}
 	CleanupMetadataBucket(skipCheckpointBlobs bool) error
 	CleanupUDSs()
 	ClearEventStats()
+	Context() context.Context
 	DcpFeedBoundary() string
 	GetAppCode() string
 	GetAppLog(sz int64) []string
 	GetDcpEventsRemainingToProcess() uint64
-	GetDebuggerURL() (string, error)
+	GetDebuggerURL(token string) (string, error)
+	GetDebuggerSession() (*DebuggerSession, error)
 	GetEventingConsumerPids() map[string]int
 	GetEventProcessingStats() map[string]uint64
 	GetExecutionStats() map[string]interface{}
 	GetFailureStats() map[string]interface{}
+	GetFailureDomains() map[string]*DomainFailures
 	GetLatencyStats() StatsData
 	GetCurlLatencyStats() StatsData
 	GetInsight() *Insight
 	GetLcbExceptionsStats() map[string]uint64
+	GetDcpFeedEvents() []*DcpFeedEvent
 	GetMetaStoreStats() map[string]uint64
 	GetMetadataPrefix() string
+	GetSourceMap() *SourceMap
+	DeliverBusEvent(topic string, payload []byte) error
+	GetOwnershipMap() *OwnershipMap
+	GetFencingStatus() *FencingStatus
+	IsFenced() bool
+	GetRebalanceReports() (map[string][]*RebalanceReport, error)
+	GetMetadataCleanupStatus() *MetadataCleanupStatus
+	GetLastError() *FunctionError
+	PauseVbs(vbs []uint16) []uint16
+	ResumeVbs(vbs []uint16) []uint16
+	IsVbPaused(vb uint16) bool
+	GetPausedVbs() *PausedVbs
+	GetRebalanceProgress() *AppRebalanceProgress
+	AcquireVbTakeoverSlot(cancelCh <-chan struct{}) bool
+	ReleaseVbTakeoverSlot()
+	RecordMetadataWrite(err error)
+	RecordWorkerLimitBreach(limit string)
+	RecordRebalanceDuration(phase string, d time.Duration)
+	GetRebalanceHistograms() map[string]*Histogram
+	GetWorkerRestarts() []*WorkerRestartStats
+	ConsumerHeartbeat(heartbeat *ConsumerHeartbeat)
+	GetLiveness() []*ConsumerLiveness
+	ReserveDcpQuota() time.Duration
+	InjectMetadataLatency()
 	GetNsServerPort() string
 	GetVbOwner(vb uint16) (string, string, error)
 	GetSeqsProcessed() map[int]int64
@@ -185,7 +305,7 @@ type EventingProducer interface {
 	IsPlannerRunning() bool
 	IsTrapEvent() bool
 	KillAllConsumers()
-	KillAndRespawnEventingConsumer(consumer EventingConsumer)
+	KillAndRespawnEventingConsumer(consumer EventingConsumer, exit *WorkerExit)
 	KvHostPorts() []string
 	LenRunningConsumers() int
 	MetadataBucket() string
@@ -214,6 +334,7 @@ type EventingProducer interface {
 	SourceScope() string
 	SourceCollection() string
 	GetSourceCid() uint32
+	GetSourceCollectionIDs() map[uint32]string
 	GetMetadataCid() uint32
 	SrcMutation() bool
 	Stop(context string)
@@ -224,18 +345,26 @@ type EventingProducer interface {
 	TimerDebugStats() map[int]map[string]interface{}
 	UndeployHandler(skipMetaCleanup bool)
 	UpdateMemoryQuota(quota int64)
+	SetMemoryPressureLevel(level int)
 	UsingTimer() bool
 	VbDcpEventsRemainingToProcess() map[int]int64
 	VbDistributionStatsFromMetadata() map[string]map[string]string
+	VbEventingNodeAssignMapSnapshot() map[uint16]string
 	VbSeqnoStats() map[int][]map[string]interface{}
+	WorkerVbMapSnapshot() map[string][]uint16
 	WriteAppLog(log string)
+	AppLogPath() string
+	RotateAppLog()
 	WriteDebuggerURL(url string)
-	WriteDebuggerToken(token string, hostnames []string) error
+	WriteDebuggerToken(token string, hostnames []string, replay *DebuggerReplay, ttl time.Duration) error
+	WaitForDebuggerURL(token string, timeout time.Duration) (string, error)
 }
 
 // EventingConsumer interface to export functions from eventing_consumer
 type EventingConsumer interface {
 	BootstrapStatus() bool
+	CancelTimer(callback, reference string) error
+	VerifyTimerStore(vbs []uint16, policy string) []*TimerIntegrityReport
 	CheckIfQueuesAreDrained() error
 	ClearEventStats()
 	CloseAllRunningDcpFeeds()
@@ -246,8 +375,10 @@ type EventingConsumer interface {
 	GetEventProcessingStats() map[string]uint64
 	GetExecutionStats() map[string]interface{}
 	GetFailureStats() map[string]interface{}
+	GetFailureDomains() map[string]*DomainFailures
 	GetInsight() *Insight
 	GetLcbExceptionsStats() map[string]uint64
+	GetDcpFeedEvents() []*DcpFeedEvent
 	GetMetaStoreStats() map[string]uint64
 	HandleV8Worker() error
 	HostPortAddr() string
@@ -260,6 +391,7 @@ type EventingConsumer interface {
 	Pid() int
 	RebalanceStatus() bool
 	RebalanceTaskProgress() *RebalanceProgress
+	GetRebalanceProgress() *WorkerRebalanceProgress
 	RemoveSupervisorToken() error
 	ResetBootstrapDone()
 	Serve()
@@ -272,12 +404,16 @@ type EventingConsumer interface {
 	SignalConnected()
 	SignalFeedbackConnected()
 	SignalStopDebugger() error
+	HotSwapAppCode(appCode string) (*CompileStatus, error)
+	SendBusEvent(topic string, payload []byte) error
+	ReplayToDebugger(vb uint16, count int) bool
 	SpawnCompilationWorker(appCode, appContent, appName, eventingPort string, handlerHeaders, handlerFooters []string) (*CompileStatus, error)
 	Stop(context string)
 	String() string
 	TimerDebugStats() map[int]map[string]interface{}
 	NotifyPrepareTopologyChange(keepNodes, ejectNodes []string)
 	UpdateWorkerQueueMemCap(quota int64)
+	SetMemoryPressureLevel(level int)
 	VbDcpEventsRemainingToProcess() map[int]int64
 	VbEventingNodeAssignMapUpdate(map[uint16]string)
 	VbProcessingStats() map[uint16]map[string]interface{}
@@ -286,6 +422,10 @@ type EventingConsumer interface {
 
 	SendAssignedVbs()
 	PauseConsumer()
+	Fence()
+	Unfence()
+	PauseVbs(vbs []uint16)
+	ResumeVbs(vbs []uint16)
 	GetAssignedVbs(workerName string) ([]uint16, error)
 	NotifyWorker()
 }
@@ -293,6 +433,7 @@ type EventingConsumer interface {
 type EventingSuperSup interface {
 	PausingAppList() map[string]string
 	BootstrapAppList() map[string]string
+	BootstrapAttempts(appName string) []*BootstrapAttempt
 	BootstrapAppStatus(appName string) bool
 	BootstrapStatus() bool
 	CheckAndSwitchgocbBucket(bucketName, appName string, setting *SecuritySetting) error
@@ -306,21 +447,58 @@ type EventingSuperSup interface {
 	GetAppLog(appName string, sz int64) []string
 	GetAppState(appName string) int8
 	GetDcpEventsRemainingToProcess(appName string) uint64
-	GetDebuggerURL(appName string) (string, error)
+	GetDebuggerURL(appName, token string) (string, error)
+	GetDebuggerSession(appName string) (*DebuggerSession, error)
 	GetDeployedApps() map[string]string
+	NumVbuckets() int
 	GetEventingConsumerPids(appName string) map[string]int
 	GetExecutionStats(appName string) map[string]interface{}
 	GetFailureStats(appName string) map[string]interface{}
+	GetFailureDomains(appName string) map[string]*DomainFailures
+	GetWorkerIncidents(appName string) ([]*WorkerIncidentSummary, error)
+	GetWorkerIncident(appName, id string) (*WorkerIncident, error)
+	GetAppLogUsage() *AppLogRetentionStats
 	GetLatencyStats(appName string) StatsData
 	GetCurlLatencyStats(appName string) StatsData
 	GetInsight(appName string) *Insight
 	GetLcbExceptionsStats(appName string) map[string]uint64
+	GetDcpFeedEvents(appName string) []*DcpFeedEvent
+	GetWorkerRestarts(appName string) []*WorkerRestartStats
+	GetRebalanceHistograms(appName string) map[string]*Histogram
+	GetLiveness(appName string) []*ConsumerLiveness
+	GetSourceMap(appName string) *SourceMap
+	PublishBusEvent(appName, topic string, payload []byte)
+	SubscribeBusTopics(appName string, topics []string)
+	UnsubscribeBusTopics(appName string)
+	GetBusStats() *BusStats
+	GetOwnershipMap(appName string) *OwnershipMap
+	GetFencingStatus(appName string) *FencingStatus
+	GetRebalanceReports(appName string) (map[string][]*RebalanceReport, error)
+	GetMetadataCleanupStatus(appName string) *MetadataCleanupStatus
+	CancelTimer(appName, callback, reference string) error
+	VerifyTimerStore(appName string, vbs []uint16, policy string) ([]*TimerIntegrityReport, error)
+	PauseVbs(appName string, vbs []uint16) ([]uint16, error)
+	ResumeVbs(appName string, vbs []uint16) ([]uint16, error)
+	GetPausedVbs(appName string) *PausedVbs
+	GetRebalanceProgress(appName string) *AppRebalanceProgress
+	MemoryPressureLevel() int
+	LocalNodeHealth() *NodeHealth
+	GetAppSettings(appName string) (map[string]interface{}, uint64, error)
+	SubscribeAppSettings(appName string, callback AppSettingsCallback) uint64
+	UnsubscribeAppSettings(appName string, id uint64)
+	UpdatePeerHealth(health *NodeHealth)
+	GetPeerHealth() map[string]*NodeHealth
+	PeerLiveness(hostPortAddr, nodeUUID, appName string) PeerLiveness
+	AcquireVbTakeoverSlot(appName string, cancelCh <-chan struct{}) bool
+	ReleaseVbTakeoverSlot(appName string)
+	GetVbTakeoverSlotStats(appName string) map[string]uint64
 	GetLocallyDeployedApps() map[string]string
 	GetMetaStoreStats(appName string) map[string]uint64
 	GetBucket(bucketName, appName string) (*couchbase.Bucket, error)
 	GetMetadataHandle(bucketName, scopeName, collectionName, appName string) (*gocb.Collection, error)
 	GetCollectionID(bucketName, scopeName, collectionName string) (uint32, error)
 	GetCurrentManifestId(bucketName string) (string, error)
+	ObserveManifestUID(bucketName, uid string)
 	GetRegisteredPool() string
 	GetSeqsProcessed(appName string) map[int]int64
 	InternalVbDistributionStats(appName string) map[string]string
@@ -342,7 +520,8 @@ type EventingSuperSup interface {
 	VbDistributionStatsFromMetadata(appName string) map[string]map[string]string
 	VbSeqnoStats(appName string) (map[int][]map[string]interface{}, error)
 	WriteDebuggerURL(appName, url string)
-	WriteDebuggerToken(appName, token string, hostnames []string)
+	WriteDebuggerToken(appName, token string, hostnames []string, replay *DebuggerReplay, ttl time.Duration)
+	WaitForDebuggerURL(appName, token string, timeout time.Duration) (string, error)
 	IncWorkerRespawnedCount()
 	WorkerRespawnedCount() uint32
 	CheckLifeCycleOpsDuringRebalance() bool
@@ -356,6 +535,7 @@ type EventingServiceMgr interface {
 	CheckLifeCycleOpsDuringRebalance() bool
 	OptimiseLoadingCIC(bool) error
 	NotifySupervisorWaitCh()
+	RecordBootstrapFinished(appName string, started, finished time.Time)
 }
 
 type Config map[string]interface{}
@@ -372,6 +552,7 @@ type AppConfig struct {
 	FunctionInstanceID string
 	LastDeploy         string
 	Settings           map[string]interface{}
+	SourceMap          *SourceMap
 	UserPrefix         string
 }
 
@@ -383,12 +564,47 @@ type RebalanceProgress struct {
 	NodeLevelStats        interface{}
 }
 
+// WorkerRebalanceProgress captures progress of vbucket ownership transfer of an
+// eventing worker, as tracked by its vbsStateUpdate routine
+type WorkerRebalanceProgress struct {
+	Running              bool     `json:"running"`
+	StartTime            string   `json:"start_time,omitempty"`
+	LastProgressTime     string   `json:"last_progress_time,omitempty"`
+	Attempts             int      `json:"attempts"`
+	VbsToOwn             int      `json:"vbs_to_own"`
+	VbsToGiveUp          int      `json:"vbs_to_give_up"`
+	VbsRemainingToOwn    []uint16 `json:"vbs_remaining_to_own"`
+	VbsRemainingToGiveUp []uint16 `json:"vbs_remaining_to_give_up"`
+}
+
+// AppRebalanceProgress captures rebalance progress of an app on an eventing node.
+// Estimated completion is extrapolated from rate at which vbs have been moved since
+// rebalance started
+type AppRebalanceProgress struct {
+	RebalanceOngoing          bool                                `json:"rebalance_ongoing"`
+	StartTime                 string                              `json:"start_time,omitempty"`
+	LastProgressTime          string                              `json:"last_progress_time,omitempty"`
+	VbsToMove                 int                                 `json:"vbs_to_move"`
+	VbsRemainingToOwn         int                                 `json:"vbs_remaining_to_own"`
+	VbsRemainingToGiveUp      int                                 `json:"vbs_remaining_to_give_up"`
+	EstimatedSecondsRemaining int64                               `json:"estimated_seconds_remaining,omitempty"`
+	EstimatedCompletion       string                              `json:"estimated_completion,omitempty"`
+	Workers                   map[string]*WorkerRebalanceProgress `json:"workers,omitempty"`
+}
+
 type EventProcessingStats struct {
 	DcpEventsProcessedPSec   int    `json:"dcp_events_processed_psec"`
 	TimerEventsProcessedPSec int    `json:"timer_events_processed_psec"`
 	Timestamp                string `json:"timestamp"`
 }
 
+// BootstrapAttempt captures failure reason of a single attempt made to bootstrap a function
+type BootstrapAttempt struct {
+	Attempt   int    `json:"attempt"`
+	Reason    string `json:"reason"`
+	Timestamp string `json:"timestamp"`
+}
+
 type CompileStatus struct {
 	Area           string `json:"area"`
 	Column         int    `json:"column_number"`
@@ -399,20 +615,344 @@ type CompileStatus struct {
 	Line           int    `json:"line_number"`
 }
 
+// DcpFeedEvent captures a connection lifecycle event of DCP feed against a KV node
+type DcpFeedEvent struct {
+	Timestamp  time.Time `json:"timestamp"`
+	Worker     string    `json:"worker"`
+	KVNode     string    `json:"kv_node"`
+	Event      string    `json:"event"`
+	Reason     string    `json:"reason,omitempty"`
+	DurationMs int64     `json:"duration_ms,omitempty"`
+}
+
+// Domains failures of a function are attributed to, so that problems in handler code
+// can be told apart from those in KV or eventing infrastructure
+const (
+	FailureDomainHandler  = "handler"
+	FailureDomainKV       = "kv"
+	FailureDomainWorker   = "worker"
+	FailureDomainNetwork  = "network"
+	FailureDomainMetadata = "metadata"
+)
+
+// Limits on resource usage of cpp worker, breach of which gets it respawned
+const (
+	WorkerLimitRSS = "rss"
+	WorkerLimitCPU = "cpu"
+)
+
+// Rebalance phases whose durations are tracked as histograms
+const (
+	RebalanceVbTakeover    = "vb_takeover"
+	RebalanceTimerTransfer = "timer_transfer"
+	RebalanceStreamOpen    = "dcp_stream_open"
+)
+
+// Histogram captures distribution of durations, with counts cumulative per bucket
+// upper bound as expected by Prometheus
+type Histogram struct {
+	BoundsMs []int64  `json:"bounds_ms"`
+	Counts   []uint64 `json:"counts"` // Observations no longer than respective bound
+	Count    uint64   `json:"count"`
+	SumMs    uint64   `json:"sum_ms"`
+}
+
+// DomainFailures captures failures of a function attributed to a failure domain
+type DomainFailures struct {
+	Count        uint64            `json:"count"`
+	Counters     map[string]uint64 `json:"counters"`
+	RecentErrors []*FailureSample  `json:"recent_errors,omitempty"` // Oldest first
+}
+
+// FailureSample is a failure recently attributed to a failure domain
+type FailureSample struct {
+	Timestamp time.Time `json:"timestamp"`
+	Worker    string    `json:"worker"`
+	Source    string    `json:"source"` // Failure stat or operation which failed
+	Message   string    `json:"message"`
+}
+
 // PlannerNodeVbMapping captures the vbucket distribution across all
 // eventing nodes as per planner
 type PlannerNodeVbMapping struct {
 	Hostname string `json:"host_name"`
 	StartVb  int    `json:"start_vb"`
 	VbsCount int    `json:"vb_count"`
+	Vbs      string `json:"vbs,omitempty"`
+}
+
+// RebalanceReport captures cost of a topology change for an app on an eventing node
+type RebalanceReport struct {
+	NodeUUID            string `json:"node_uuid"`
+	ChangeType          string `json:"change_type"`
+	Status              string `json:"status"`
+	StartTs             string `json:"start_ts"`
+	EndTs               string `json:"end_ts"`
+	DurationMs          int64  `json:"duration_ms"`
+	VbsMoved            int    `json:"vbs_moved"`
+	VbsGained           int    `json:"vbs_gained"`
+	VbsRelinquished     int    `json:"vbs_relinquished"`
+	StreamRequests      uint64 `json:"dcp_stream_requests"`
+	StreamRequestErrors uint64 `json:"dcp_stream_request_errors"`
+	StreamCloseErrors   uint64 `json:"dcp_stream_close_errors"`
+}
+
+// MetadataCleanupStatus captures progress of clearing up artifacts of an undeployed
+// function from metadata keyspace, for vbuckets assigned to an eventing node
+type MetadataCleanupStatus struct {
+	State        string `json:"state"`
+	StartTs      string `json:"start_ts"`
+	EndTs        string `json:"end_ts,omitempty"`
+	Attempts     int    `json:"attempts"`
+	VbsToCleanup int    `json:"vbs_to_cleanup"`
+	VbsCleanedUp int    `json:"vbs_cleaned_up"`
+	DocsDeleted  uint64 `json:"docs_deleted"`
+	DeleteErrors uint64 `json:"delete_errors"`
+	LastError    string `json:"last_error,omitempty"`
+}
+
+// PausedVbs captures vbs of an app an admin has paused processing for on local eventing node
+type PausedVbs struct {
+	Vbs      []uint16          `json:"vbs"`
+	PausedAt map[uint16]string `json:"paused_at"`
+}
+
+// FencingStatus captures whether function has been fenced on an eventing node
+// owing to sustained metadata write failures
+type FencingStatus struct {
+	Fenced                bool   `json:"fenced"`
+	FencedSince           string `json:"fenced_since,omitempty"`
+	FenceCounter          uint64 `json:"fence_counter"`
+	MetadataWriteFailures uint64 `json:"metadata_write_failures"`
+}
+
+// BusStats captures traffic on the event bus of an eventing node
+type BusStats struct {
+	Unrouted uint64                    `json:"unrouted"` // Published to topics with no subscriber
+	Topics   map[string]*BusTopicStats `json:"topics"`
+}
+
+// BusTopicStats captures traffic of a subscribed topic on the event bus
+type BusTopicStats struct {
+	Published   uint64                         `json:"published"`
+	Subscribers map[string]*BusSubscriberStats `json:"subscribers"`
+}
+
+// BusSubscriberStats captures events of a topic routed to a subscribing function
+type BusSubscriberStats struct {
+	Delivered uint64 `json:"delivered"`
+	Dropped   uint64 `json:"dropped"` // Backlog was full when event got published
+	Backlog   int    `json:"backlog"`
+}
+
+// NodeHealth is exchanged between eventing nodes over admin port, to learn
+// about liveness and load of peers ahead of ns_server
+type NodeHealth struct {
+	NodeUUID     string            `json:"node_uuid"`
+	HostPortAddr string            `json:"host_port_addr,omitempty"`
+	Timestamp    string            `json:"timestamp"`
+	DeployedApps []string          `json:"deployed_apps"`
+	DcpBacklog   map[string]uint64 `json:"dcp_backlog"`
+	FencedApps   []string          `json:"fenced_apps,omitempty"`
+	LastHeardMs  int64             `json:"last_heard_ms,omitempty"`
+
+	BootstrappingApps []string                  `json:"bootstrapping_apps,omitempty"`
+	Executions        map[string]uint64         `json:"executions,omitempty"`
+	Failures          map[string]uint64         `json:"failures,omitempty"`
+	LastErrors        map[string]*FunctionError `json:"last_errors,omitempty"`
+}
+
+// AppSettingsCallback is invoked with parsed settings of a function and their revision,
+// each time settings change
+type AppSettingsCallback func(settings map[string]interface{}, revision uint64)
+
+// FunctionError captures most recent error encountered by a function on an eventing node
+type FunctionError struct {
+	Message   string `json:"message"`
+	Timestamp string `json:"timestamp"`
+}
+
+// Directory under eventingDir housing incident records of cpp worker restarts,
+// one sub directory per function
+const IncidentsDir = "incidents"
+
+// Consumers heartbeat to producer at this interval, from their control routine. Missing
+// ConsumerStaleAfter heartbeats in a row marks the consumer stale
+const (
+	ConsumerHeartbeatInterval = 5 * time.Second
+	ConsumerStaleAfter        = 3
+)
+
+// ConsumerHeartbeat carries progress of a consumer, as sent periodically to producer
+type ConsumerHeartbeat struct {
+	Worker             string    `json:"worker"`
+	Pid                int       `json:"pid"`
+	Timestamp          time.Time `json:"timestamp"`
+	OwnedVbs           int       `json:"owned_vbs"`
+	ProcessedPerSec    uint64    `json:"processed_seq_nos_per_sec"`
+	QueueDepth         int64     `json:"queue_depth"` // Events yet to be sent to cpp worker, along with ones queued within it
+	LastWorkerResponse time.Time `json:"last_worker_response"`
+}
+
+// ConsumerLiveness reports whether a consumer has kept up its heartbeats, along with
+// the last one received
+type ConsumerLiveness struct {
+	Worker           string             `json:"worker"`
+	Stale            bool               `json:"stale"`
+	MissedHeartbeats int                `json:"missed_heartbeats"`
+	LastHeartbeat    *ConsumerHeartbeat `json:"last_heartbeat,omitempty"`
+}
+
+// TimerIntegrityReport is outcome of verifying timer store of a vb. Alarms left dangling
+// by cancelled or overwritten timers are routine, those aren't counted as corruption
+type TimerIntegrityReport struct {
+	Vb              uint16 `json:"vb"`
+	Worker          string `json:"worker"`
+	Policy          string `json:"policy"`
+	SpanStart       int64  `json:"span_start"`
+	SpanStop        int64  `json:"span_stop"`
+	SpanCorrupt     bool   `json:"span_corrupt,omitempty"`
+	RowsScanned     int    `json:"rows_scanned"`
+	RowsBeforeSpan  int    `json:"rows_before_span,omitempty"`
+	Alarms          int    `json:"alarms"`
+	DanglingAlarms  int    `json:"dangling_alarms,omitempty"`
+	CorruptAlarms   int    `json:"corrupt_alarms,omitempty"`
+	CorruptContexts int    `json:"corrupt_contexts,omitempty"`
+	Repaired        int    `json:"repaired,omitempty"`
+	Truncated       bool   `json:"truncated,omitempty"`
+	Error           string `json:"error,omitempty"`
+}
+
+// Corruptions returns count of corrupt records found, treating a span not covering
+// all alarm rows as a single corruption
+func (r *TimerIntegrityReport) Corruptions() int {
+	corruptions := r.CorruptAlarms + r.CorruptContexts
+	if r.SpanCorrupt || r.RowsBeforeSpan > 0 {
+		corruptions++
+	}
+	return corruptions
+}
+
+// WorkerExit describes how a cpp worker went down, prior to it getting restarted
+type WorkerExit struct {
+	Worker     string    `json:"worker"`
+	Reason     string    `json:"reason"`
+	ExitStatus string    `json:"exit_status,omitempty"` // As reported by OS, absent if worker was killed for being unresponsive
+	ExitCode   int       `json:"exit_code"`             // -1 if worker didn't exit on its own or was terminated by a signal
+	Stderr     []string  `json:"stderr,omitempty"`      // Last lines written by worker, oldest first
+	Timestamp  time.Time `json:"timestamp"`
+}
+
+// WorkerRestartStats captures restarts of a cpp worker of a function, along with
+// backoff applied prior to the latest one
+type WorkerRestartStats struct {
+	Worker              string      `json:"worker"`
+	Restarts            uint64      `json:"restarts"`
+	ConsecutiveRestarts int         `json:"consecutive_restarts"`
+	BackoffMs           int64       `json:"backoff_ms"`
+	LastRestart         time.Time   `json:"last_restart"`
+	LastExit            *WorkerExit `json:"last_exit,omitempty"`
+}
+
+// WorkerIncident captures state of a cpp worker around its restart
+type WorkerIncident struct {
+	ID             string                            `json:"id"`
+	Function       string                            `json:"function"`
+	Worker         string                            `json:"worker"`
+	Pid            int                               `json:"pid"`
+	Reason         string                            `json:"reason"`
+	ExitStatus     string                            `json:"exit_status,omitempty"`
+	Timestamp      string                            `json:"timestamp"`
+	Stderr         []string                          `json:"stderr"`          // Last lines written by worker, oldest first
+	LastDispatched []*DispatchedEvent                `json:"last_dispatched"` // Oldest first
+	VbStats        map[uint16]map[string]interface{} `json:"vb_stats"`
+	QueueSizes     map[string]int64                  `json:"queue_sizes"`
+	Truncated      bool                              `json:"truncated,omitempty"`
+}
+
+// DispatchedEvent is a DCP event sent to cpp worker, without its value
+type DispatchedEvent struct {
+	Key       string `json:"key"`
+	Vbucket   uint16 `json:"vb"`
+	SeqNo     uint64 `json:"seq_no"`
+	Opcode    string `json:"opcode"`
+	Timestamp string `json:"timestamp"`
+}
+
+// WorkerIncidentSummary lists an incident record without its contents
+type WorkerIncidentSummary struct {
+	ID        string `json:"id"`
+	Worker    string `json:"worker"`
+	Size      int64  `json:"size"`
+	Timestamp string `json:"timestamp"`
+}
+
+// AppLogUsage captures disk usage of app logs of a function on this node, along with
+// actions taken on them to abide by app_log_max_total_size
+type AppLogUsage struct {
+	Bytes           int64  `json:"bytes"`
+	Files           int    `json:"files"`
+	EvictedFiles    uint64 `json:"evicted_files"`
+	ForcedRotations uint64 `json:"forced_rotations"`
+}
+
+// AppLogRetentionStats captures disk usage of app logs of all functions running on this node
+type AppLogRetentionStats struct {
+	CapBytes  int64                   `json:"cap_bytes"` // 0 implies no cap
+	UsedBytes int64                   `json:"used_bytes"`
+	Functions map[string]*AppLogUsage `json:"functions"`
+}
+
+// PeerLiveness of an eventing node as per health gossip
+type PeerLiveness int8
+
+const (
+	PeerLivenessUnknown PeerLiveness = iota
+	PeerAlive
+	PeerDown
+	PeerFenced
+)
+
+func (l PeerLiveness) String() string {
+	switch l {
+	case PeerAlive:
+		return "alive"
+	case PeerDown:
+		return "down"
+	case PeerFenced:
+		return "fenced"
+	default:
+		return "unknown"
+	}
+}
+
+// VbOwnership captures stream state of a vbucket as seen by the worker assigned to it
+type VbOwnership struct {
+	AssignedWorker string `json:"assigned_worker"`
+	CurrentOwner   string `json:"current_vb_owner"`
+	NodeUUID       string `json:"node_uuid"`
+	StreamStatus   string `json:"stream_status"`
+}
+
+// OwnershipMap captures vbucket ownership of an app on local eventing node
+type OwnershipMap struct {
+	VbEventingNodeAssignMap map[uint16]string       `json:"vb_eventing_node_assign_map"`
+	WorkerVbucketMap        map[string][]uint16     `json:"worker_vbucket_map"`
+	VbStreamStatus          map[uint16]*VbOwnership `json:"vb_stream_status"`
+	PausedVbs               []uint16                `json:"paused_vbs,omitempty"`
 }
 
 type HandlerConfig struct {
 	N1qlPrepareAll            bool
 	LanguageCompatibility     string
 	AllowTransactionMutations bool
+	IncludeXattrs             bool // Pass xattrs of mutations on to handler
+	SkipBinaryDocs            bool // Drop non-json mutations before they're sent to worker
+	WorkerFrameChecksums      bool // Checksum frames exchanged with worker
+	OriginTagging             bool // Drop mutations stamped by workers of this function while handling events
 	AggDCPFeedMemCap          int64
 	CheckpointInterval        int
+	CheckpointBatchInterval   int
 	IdleCheckpointInterval    int
 	CPPWorkerThrCount         int
 	ExecuteTimerRoutineCount  int
@@ -422,27 +962,62 @@ type HandlerConfig struct {
 	FeedbackReadBufferSize    int
 	HandlerHeaders            []string
 	HandlerFooters            []string
+	SubscribeTopics           []string // Event bus topics whose events are passed on to OnEvent of the handler
 	LcbInstCapacity           int
 	N1qlConsistency           string
+	N1qlTimeout               int // Seconds a query is waited on, 0 leaves it bounded by execution timeout
 	LogLevel                  string
 	SocketWriteBatchSize      int
 	SourceKeyspace            *Keyspace
+	SourceCollections         []string // Of source scope, listened to along with source collection
+	KeyPrefixes               []string
+	KeyPatterns               []string
 	StatsLogInterval          int
 	StreamBoundary            DcpStreamBoundary
 	TimerContextSize          int64
+	TimerIntegrityCheck       string
+	TimerLaneBatchSize        int
+	DcpLaneBatchSize          int
 	TimerQueueMemCap          uint64
 	TimerQueueSize            uint64
 	UndeployRoutineCount      int
+	WorkerIPCType             string
 	WorkerCount               int
 	WorkerQueueCap            int64
 	WorkerQueueMemCap         int64
+	WorkerQueueHighWatermark  int
+	WorkerQueueLowWatermark   int
 	WorkerResponseTimeout     int
+	WorkerRSSLimit            int64 // In bytes, 0 implies no limit
+	WorkerCPULimit            int   // In % of a core, 0 implies no limit
+	DcpThroughputQuota        int   // In events per sec per node, 0 implies no quota
+	CPPThreadQuota            int   // Across workers per node, 0 implies no quota
+	MetaLatencyInjectPercent  int   // Of metadata bucket ops, 0 implies no injection
+	MetaLatencyInjectMs       int
 	LcbRetryCount             int
 	LcbTimeout                int
 	BucketCacheSize           int64
 	BucketCacheAge            int64
 	NumTimerPartitions        int
 	CurlMaxAllowedRespSize    int
+	MaxDocSizeBytes           int
+	MaxDocSizeMode            string
+	MaxDocSizeLog             bool
+	DeliveryGuarantee         string
+	DeadLetterKeyspace        *Keyspace // nil unless dead letter bucket is configured
+	DeadLetterRetryCount      int
+	RetryCount                int
+	RetryBackoff              int // In ms
+	RetryOn                   []string
+	StrictOrderCheck          bool
+	BuilderPoolSize           int
+	BuilderInitialCapacity    int
+	UseBootstrapDcpFeeds      bool
+	BootstrapFeedThreshold    int
+	BootstrapFeedPriority     string
+	PrefetchKeyPatterns       []string
+	PrefetchKeySeparator      string
+	DebuggerReplayEvents      int
 }
 
 type ProcessConfig struct {
@@ -460,6 +1035,12 @@ type ProcessConfig struct {
 type RebalanceConfig struct {
 	VBOwnershipGiveUpRoutineCount   int
 	VBOwnershipTakeoverRoutineCount int
+	AutoTuneVBTakeoverRoutines      bool
+	VBTakeoverRoutineMinCount       int
+	VBTakeoverRoutineMaxCount       int
+	VBTakeoverDeadline              int // In seconds, 0 implies no deadline
+	ForceVBTakeover                 bool
+	VBHandoverLingerTimeout         int // In seconds, 0 implies stream is closed right away on giving up vb
 }
 
 type Key struct {
@@ -473,6 +1054,30 @@ func NewKey(userPrefix, clusterPrefix, key string) Key {
 	return Key{metadataPrefix, key, metadataPrefix + "::" + key}
 }
 
+// Separators following metadata prefix in keys written by eventing i.e. "::" by
+// NewKey and ":tm:" by timer store of workers. Trailing separator keeps prefix of
+// function id 12 from matching keys of function id 123
+var metadataKeySeparators = []string{"::", ":tm:"}
+
+// IsMetadataKey tells if key was written under given metadata prefix
+func IsMetadataKey(metadataPrefix, key string) bool {
+	for _, sep := range metadataKeySeparators {
+		if strings.HasPrefix(key, metadataPrefix+sep) {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckpointBlobKeyInfix separates app name and vbucket in checkpoint blob keys
+const CheckpointBlobKeyInfix = "::vb::"
+
+// CheckpointBlobKey returns key of checkpoint blob of a vbucket, it gets namespaced
+// within metadata keyspace by user prefix and function id
+func CheckpointBlobKey(appName string, vb uint16) string {
+	return appName + CheckpointBlobKeyInfix + strconv.Itoa(int(vb))
+}
+
 func (k Key) Raw() string {
 	return k.transformedKey
 }
@@ -537,6 +1142,10 @@ func GetDefaultHandlerHeaders() []string {
 	return []string{"'use strict';"}
 }
 
+func GetDefaultRetryOn() []string {
+	return []string{RetryOnTimeout, RetryOnLcbError}
+}
+
 func CheckAndReturnDefaultForScopeOrCollection(key string) string {
 	if key == "" {
 		return "_default"
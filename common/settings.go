@@ -0,0 +1,461 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// HandlerSettings is the typed form of function settings stored in metakv.
+// Fields are pointers so that settings missing from metakv can be told apart
+// from ones explicitly set to zero value, callers fall back to defaults for nil
+type HandlerSettings struct {
+	// N1QL related configuration
+	N1qlConsistency *string `json:"n1ql_consistency"`
+	LcbInstCapacity *int    `json:"lcb_inst_capacity"`
+	N1qlPrepareAll  *bool   `json:"n1ql_prepare_all"`
+	N1qlTimeout     *int    `json:"n1ql_timeout"`
+
+	// Handler related configuration
+	LanguageCompatibility     *string  `json:"language_compatibility"`
+	CheckpointInterval        *int     `json:"checkpoint_interval"`
+	CheckpointBatchInterval   *int     `json:"checkpoint_batch_interval"`
+	CPPWorkerThrCount         *int     `json:"cpp_worker_thread_count"`
+	StreamBoundary            *string  `json:"dcp_stream_boundary"`
+	ExecutionTimeout          *int     `json:"execution_timeout"`
+	FeedbackBatchSize         *int     `json:"feedback_batch_size"`
+	FeedbackReadBufferSize    *int     `json:"feedback_read_buffer_size"`
+	HandlerFooters            []string `json:"handler_footers"`
+	HandlerHeaders            []string `json:"handler_headers"`
+	IdleCheckpointInterval    *int     `json:"idle_checkpoint_interval"`
+	LogLevel                  *string  `json:"log_level"`
+	NumTimerPartitions        *int     `json:"num_timer_partitions"`
+	SocketWriteBatchSize      *int     `json:"sock_batch_size"`
+	StatsLogInterval          *int     `json:"tick_duration"`
+	UserPrefix                *string  `json:"user_prefix"`
+	WorkerCount               *int     `json:"worker_count"`
+	FeedbackQueueCap          *int64   `json:"worker_feedback_queue_cap"`
+	WorkerQueueCap            *int64   `json:"worker_queue_cap"`
+	WorkerQueueMemCap         *int64   `json:"worker_queue_mem_cap"`        // In MB
+	WorkerQueueHighWatermark  *int     `json:"worker_queue_high_watermark"` // In % of worker_queue_cap
+	WorkerQueueLowWatermark   *int     `json:"worker_queue_low_watermark"`  // In % of worker_queue_cap
+	WorkerResponseTimeout     *int     `json:"worker_response_timeout"`
+	WorkerRSSLimit            *int     `json:"worker_rss_limit"`     // In MB, 0 implies no limit
+	WorkerCPULimit            *int     `json:"worker_cpu_limit"`     // In % of a core, 0 implies no limit
+	DcpThroughputQuota        *int     `json:"dcp_throughput_quota"` // In events per sec per node, 0 implies no quota
+	CPPThreadQuota            *int     `json:"cpp_thread_quota"`     // Across workers per node, 0 implies no quota
+	LcbRetryCount             *int     `json:"lcb_retry_count"`
+	LcbTimeout                *int     `json:"lcb_timeout"`
+	BucketCacheSize           *int64   `json:"bucket_cache_size"`
+	BucketCacheAge            *int64   `json:"bucket_cache_age"`
+	CurlMaxAllowedRespSize    *int     `json:"curl_max_allowed_resp_size"`
+	MaxDocSizeBytes           *int     `json:"max_doc_size_bytes"`
+	MaxDocSizeMode            *string  `json:"max_doc_size_mode"`
+	MaxDocSizeLog             *bool    `json:"max_doc_size_log"`
+	DeliveryGuarantee         *string  `json:"delivery_guarantee"`
+	DeadLetterBucket          *string  `json:"dead_letter_bucket"`
+	DeadLetterScope           *string  `json:"dead_letter_scope"`
+	DeadLetterCollection      *string  `json:"dead_letter_collection"`
+	DeadLetterRetryCount      *int     `json:"dead_letter_retry_count"`
+	RetryCount                *int     `json:"retry_count"`
+	RetryBackoff              *int     `json:"retry_backoff"` // In ms
+	RetryOn                   []string `json:"retry_on"`
+	StrictOrderCheck          *bool    `json:"strict_order_check"`
+	BuilderPoolSize           *int     `json:"builder_pool_size"`
+	BuilderInitialCapacity    *int     `json:"builder_initial_capacity"`
+	UseBootstrapDcpFeeds      *bool    `json:"use_bootstrap_dcp_connections"`
+	BootstrapFeedThreshold    *int     `json:"bootstrap_dcp_backfill_threshold"`
+	BootstrapFeedPriority     *string  `json:"bootstrap_dcp_priority"`
+	PrefetchKeyPatterns       []string `json:"prefetch_key_patterns"`
+	PrefetchKeySeparator      *string  `json:"prefetch_key_separator"`
+	DebuggerReplayEvents      *int     `json:"debugger_replay_events"` // Per vb, 0 implies no events are retained
+	TimerContextSize          *int64   `json:"timer_context_size"`
+	TimerIntegrityCheck       *string  `json:"timer_integrity_check"`
+	TimerLaneBatchSize        *int     `json:"timer_lane_batch_size"`
+	DcpLaneBatchSize          *int     `json:"dcp_lane_batch_size"`
+	TimerQueueMemCap          *uint64  `json:"timer_queue_mem_cap"` // In MB
+	TimerQueueSize            *uint64  `json:"timer_queue_size"`
+	UndeployRoutineCount      *int     `json:"undeploy_routine_count"`
+	WorkerIPCType             *string  `json:"worker_ipc_type"`
+	AllowTransactionMutations *bool    `json:"allow_transaction_mutations"`
+	IncludeXattrs             *bool    `json:"include_xattrs"`
+	SkipBinaryDocs            *bool    `json:"skip_binary_docs"`
+	WorkerFrameChecksums      *bool    `json:"worker_frame_checksums"`
+	OriginTagging             *bool    `json:"origin_tagging"`
+	SubscribeTopics           []string `json:"subscribe_topics"`
+
+	// Rebalance related configuration
+	VBOwnershipGiveUpRoutineCount   *int  `json:"vb_ownership_giveup_routine_count"`
+	VBOwnershipTakeoverRoutineCount *int  `json:"vb_ownership_takeover_routine_count"`
+	AutoTuneVBTakeoverRoutines      *bool `json:"auto_tune_vb_takeover_routines"`
+	VBTakeoverRoutineMinCount       *int  `json:"vb_takeover_routine_min_count"`
+	VBTakeoverRoutineMaxCount       *int  `json:"vb_takeover_routine_max_count"`
+	VBTakeoverDeadline              *int  `json:"vb_takeover_deadline"` // In seconds
+	ForceVBTakeover                 *bool `json:"vb_force_takeover"`
+	VBHandoverLingerTimeout         *int  `json:"vb_handover_linger_timeout"` // In seconds
+
+	// Application logging related configuration
+	AppLogDir      *string `json:"app_log_dir"`
+	AppLogMaxSize  *int64  `json:"app_log_max_size"`
+	AppLogMaxFiles *int64  `json:"app_log_max_files"`
+	AppLogRotation *bool   `json:"enable_applog_rotation"`
+
+	// DCP connection related configuration
+	AggDCPFeedMemCap  *int64  `json:"agg_dcp_feed_mem_cap"` // In MB
+	DataChanSize      *int    `json:"data_chan_size"`
+	DcpWindowSize     *uint32 `json:"dcp_window_size"`
+	DcpGenChanSize    *int    `json:"dcp_gen_chan_size"`
+	DcpNumConnections *int    `json:"dcp_num_connections"`
+	DcpNoopInterval   *int    `json:"dcp_noop_interval"` // In seconds
+
+	// Resilience testing related configuration, delays metadata bucket ops
+	MetaLatencyInjectPercent *int `json:"metadata_latency_inject_percent"`
+	MetaLatencyInjectMs      *int `json:"metadata_latency_inject_ms"`
+}
+
+// SettingsError describes problem with a single setting
+type SettingsError struct {
+	Setting string `json:"setting"`
+	Reason  string `json:"reason"`
+}
+
+// SettingsErrors aggregates all problems found in function settings
+type SettingsErrors []SettingsError
+
+func (errs SettingsErrors) Error() string {
+	reasons := make([]string, 0, len(errs))
+	for _, err := range errs {
+		reasons = append(reasons, fmt.Sprintf("%s: %s", err.Setting, err.Reason))
+	}
+	return "invalid settings, " + strings.Join(reasons, "; ")
+}
+
+// ParseHandlerSettings decodes and validates function settings. Unlike decoding
+// straight into the struct, every setting is decoded independently so that all
+// type mismatches get reported together along with range violations
+func ParseHandlerSettings(data []byte) (*HandlerSettings, error) {
+	raw := make(map[string]json.RawMessage)
+	err := json.Unmarshal(data, &raw)
+	if err != nil {
+		return nil, err
+	}
+
+	settings := &HandlerSettings{}
+	errs := make(SettingsErrors, 0)
+
+	val := reflect.ValueOf(settings).Elem()
+	for i := 0; i < val.NumField(); i++ {
+		name := strings.Split(val.Type().Field(i).Tag.Get("json"), ",")[0]
+
+		data, ok := raw[name]
+		if !ok || string(data) == "null" {
+			continue
+		}
+
+		field := reflect.New(val.Field(i).Type())
+		err = json.Unmarshal(data, field.Interface())
+		if err != nil {
+			errs = append(errs, SettingsError{name, fmt.Sprintf("expected %v, got %s", typeName(val.Field(i).Type()), string(data))})
+			continue
+		}
+		val.Field(i).Set(field.Elem())
+	}
+
+	errs = append(errs, settings.Validate()...)
+	if len(errs) > 0 {
+		return settings, errs
+	}
+	return settings, nil
+}
+
+func typeName(t reflect.Type) string {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Int, reflect.Int64, reflect.Uint32, reflect.Uint64:
+		return "integer"
+	case reflect.Slice:
+		return "array of " + typeName(t.Elem())
+	default:
+		return t.Kind().String()
+	}
+}
+
+// Validate checks ranges and possible values of settings that are present
+func (s *HandlerSettings) Validate() SettingsErrors {
+	errs := make(SettingsErrors, 0)
+
+	positive := map[string]*int{
+		"checkpoint_interval":                 s.CheckpointInterval,
+		"cpp_worker_thread_count":             s.CPPWorkerThrCount,
+		"execution_timeout":                   s.ExecutionTimeout,
+		"feedback_batch_size":                 s.FeedbackBatchSize,
+		"feedback_read_buffer_size":           s.FeedbackReadBufferSize,
+		"idle_checkpoint_interval":            s.IdleCheckpointInterval,
+		"lcb_inst_capacity":                   s.LcbInstCapacity,
+		"lcb_timeout":                         s.LcbTimeout,
+		"num_timer_partitions":                s.NumTimerPartitions,
+		"sock_batch_size":                     s.SocketWriteBatchSize,
+		"timer_lane_batch_size":               s.TimerLaneBatchSize,
+		"dcp_lane_batch_size":                 s.DcpLaneBatchSize,
+		"tick_duration":                       s.StatsLogInterval,
+		"worker_count":                        s.WorkerCount,
+		"worker_response_timeout":             s.WorkerResponseTimeout,
+		"builder_pool_size":                   s.BuilderPoolSize,
+		"undeploy_routine_count":              s.UndeployRoutineCount,
+		"vb_ownership_giveup_routine_count":   s.VBOwnershipGiveUpRoutineCount,
+		"vb_ownership_takeover_routine_count": s.VBOwnershipTakeoverRoutineCount,
+		"vb_takeover_routine_min_count":       s.VBTakeoverRoutineMinCount,
+		"vb_takeover_routine_max_count":       s.VBTakeoverRoutineMaxCount,
+		"data_chan_size":                      s.DataChanSize,
+		"dcp_gen_chan_size":                   s.DcpGenChanSize,
+		"dcp_num_connections":                 s.DcpNumConnections,
+		"dcp_noop_interval":                   s.DcpNoopInterval,
+	}
+	for name, val := range positive {
+		if val != nil && *val <= 0 {
+			errs = append(errs, SettingsError{name, fmt.Sprintf("must be greater than 0, got %d", *val)})
+		}
+	}
+
+	positive64 := map[string]*int64{
+		"worker_feedback_queue_cap": s.FeedbackQueueCap,
+		"worker_queue_cap":          s.WorkerQueueCap,
+		"worker_queue_mem_cap":      s.WorkerQueueMemCap,
+		"timer_context_size":        s.TimerContextSize,
+		"app_log_max_size":          s.AppLogMaxSize,
+		"app_log_max_files":         s.AppLogMaxFiles,
+		"agg_dcp_feed_mem_cap":      s.AggDCPFeedMemCap,
+	}
+	for name, val := range positive64 {
+		if val != nil && *val <= 0 {
+			errs = append(errs, SettingsError{name, fmt.Sprintf("must be greater than 0, got %d", *val)})
+		}
+	}
+
+	nonNegative := map[string]*int{
+		"lcb_retry_count":                  s.LcbRetryCount,
+		"curl_max_allowed_resp_size":       s.CurlMaxAllowedRespSize,
+		"max_doc_size_bytes":               s.MaxDocSizeBytes,
+		"builder_initial_capacity":         s.BuilderInitialCapacity,
+		"bootstrap_dcp_backfill_threshold": s.BootstrapFeedThreshold,
+		"checkpoint_batch_interval":        s.CheckpointBatchInterval,
+		"dead_letter_retry_count":          s.DeadLetterRetryCount,
+		"retry_count":                      s.RetryCount,
+		"retry_backoff":                    s.RetryBackoff,
+		"vb_takeover_deadline":             s.VBTakeoverDeadline,
+		"vb_handover_linger_timeout":       s.VBHandoverLingerTimeout,
+		"debugger_replay_events":           s.DebuggerReplayEvents,
+		"worker_rss_limit":                 s.WorkerRSSLimit,
+		"worker_cpu_limit":                 s.WorkerCPULimit,
+		"dcp_throughput_quota":             s.DcpThroughputQuota,
+		"cpp_thread_quota":                 s.CPPThreadQuota,
+		"metadata_latency_inject_ms":       s.MetaLatencyInjectMs,
+		"n1ql_timeout":                     s.N1qlTimeout,
+	}
+	for name, val := range nonNegative {
+		if val != nil && *val < 0 {
+			errs = append(errs, SettingsError{name, fmt.Sprintf("must not be negative, got %d", *val)})
+		}
+	}
+
+	if s.TimerQueueMemCap != nil && *s.TimerQueueMemCap == 0 {
+		errs = append(errs, SettingsError{"timer_queue_mem_cap", "must be greater than 0"})
+	}
+
+	if s.TimerQueueSize != nil && *s.TimerQueueSize == 0 {
+		errs = append(errs, SettingsError{"timer_queue_size", "must be greater than 0"})
+	}
+
+	if s.DcpWindowSize != nil && *s.DcpWindowSize == 0 {
+		errs = append(errs, SettingsError{"dcp_window_size", "must be greater than 0"})
+	}
+
+	watermarks := map[string]*int{
+		"worker_queue_high_watermark": s.WorkerQueueHighWatermark,
+		"worker_queue_low_watermark":  s.WorkerQueueLowWatermark,
+	}
+	for name, val := range watermarks {
+		if val != nil && (*val <= 0 || *val > 100) {
+			errs = append(errs, SettingsError{name, fmt.Sprintf("must be a percentage between 1 and 100, got %d", *val)})
+		}
+	}
+
+	if s.MetaLatencyInjectPercent != nil && (*s.MetaLatencyInjectPercent < 0 || *s.MetaLatencyInjectPercent > 100) {
+		errs = append(errs, SettingsError{"metadata_latency_inject_percent",
+			fmt.Sprintf("must be a percentage between 0 and 100, got %d", *s.MetaLatencyInjectPercent)})
+	}
+
+	if s.WorkerQueueLowWatermark != nil && s.WorkerQueueHighWatermark != nil &&
+		*s.WorkerQueueLowWatermark >= *s.WorkerQueueHighWatermark {
+		errs = append(errs, SettingsError{"worker_queue_low_watermark",
+			fmt.Sprintf("must be less than worker_queue_high_watermark: %d", *s.WorkerQueueHighWatermark)})
+	}
+
+	if s.VBTakeoverRoutineMinCount != nil && s.VBTakeoverRoutineMaxCount != nil &&
+		*s.VBTakeoverRoutineMinCount > *s.VBTakeoverRoutineMaxCount {
+		errs = append(errs, SettingsError{"vb_takeover_routine_min_count",
+			fmt.Sprintf("must not exceed vb_takeover_routine_max_count: %d", *s.VBTakeoverRoutineMaxCount)})
+	}
+
+	possibleValues := []struct {
+		name   string
+		val    *string
+		values []string
+	}{
+		{"dcp_stream_boundary", s.StreamBoundary, []string{string(DcpEverything), string(DcpFromNow), string(DcpFromPrior)}},
+		{"log_level", s.LogLevel, []string{"INFO", "ERROR", "WARNING", "DEBUG", "TRACE"}},
+		{"max_doc_size_mode", s.MaxDocSizeMode, []string{MaxDocSizeModeSkip, MaxDocSizeModeMetadataOnly}},
+		{"bootstrap_dcp_priority", s.BootstrapFeedPriority, []string{"low", "medium", "high"}},
+		{"delivery_guarantee", s.DeliveryGuarantee, []string{DeliveryBestEffort, DeliveryAtLeastOnce}},
+		{"timer_integrity_check", s.TimerIntegrityCheck, []string{TimerIntegrityOff, TimerIntegritySkip, TimerIntegrityRepair}},
+		{"language_compatibility", s.LanguageCompatibility, LanguageCompatibility},
+		{"worker_ipc_type", s.WorkerIPCType, []string{WorkerIPCAuto, WorkerIPCTCP, WorkerIPCUnix}},
+	}
+	for _, pv := range possibleValues {
+		if pv.val == nil {
+			continue
+		}
+
+		found := false
+		for _, value := range pv.values {
+			if *pv.val == value {
+				found = true
+				break
+			}
+		}
+		if !found {
+			errs = append(errs, SettingsError{pv.name, fmt.Sprintf("must be one of %v, got %q", pv.values, *pv.val)})
+		}
+	}
+
+	for _, kind := range s.RetryOn {
+		found := false
+		for _, value := range RetryOnKinds {
+			if kind == value {
+				found = true
+				break
+			}
+		}
+		if !found {
+			errs = append(errs, SettingsError{"retry_on", fmt.Sprintf("elements must be one of %v, got %q", RetryOnKinds, kind)})
+		}
+	}
+
+	return errs
+}
+
+// Settings stored alongside handler settings that aren't consumed via HandlerSettings
+var nonHandlerSettings = []string{
+	"deployment_status",
+	"description",
+	"enable_recursive_mutation",
+	"hot_swap_revision",
+	"poll_bucket_interval",
+	"processing_status",
+	"skip_timer_threshold",
+	"timer_processing_tick_interval",
+	"timer_worker_pool_size",
+}
+
+// Settings of the timer implementation prior to timer store, still accepted but
+// ignored by eventing
+var DeprecatedSettings = []string{
+	"enable_recursive_mutation",
+	"skip_timer_threshold",
+	"timer_processing_tick_interval",
+	"timer_worker_pool_size",
+}
+
+// KnownSettings returns names of all function settings understood by eventing
+func KnownSettings() []string {
+	known := append([]string(nil), nonHandlerSettings...)
+
+	t := reflect.TypeOf(HandlerSettings{})
+	for i := 0; i < t.NumField(); i++ {
+		known = append(known, strings.Split(t.Field(i).Tag.Get("json"), ",")[0])
+	}
+
+	sort.Strings(known)
+	return known
+}
+
+// UnknownSettings reports settings not understood by eventing, suggesting the closest
+// known setting for ones that look like a typo
+func UnknownSettings(settings map[string]interface{}) SettingsErrors {
+	known := KnownSettings()
+
+	names := make([]string, 0)
+	for name := range settings {
+		idx := sort.SearchStrings(known, name)
+		if idx < len(known) && known[idx] == name {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	errs := make(SettingsErrors, 0, len(names))
+	for _, name := range names {
+		reason := "unknown setting"
+		if suggestion, ok := SuggestSetting(name, known); ok {
+			reason = fmt.Sprintf("unknown setting, did you mean %s", suggestion)
+		}
+		errs = append(errs, SettingsError{name, reason})
+	}
+	return errs
+}
+
+// SuggestSetting returns known setting closest to name by edit distance, provided
+// it's close enough to be a typo
+func SuggestSetting(name string, known []string) (string, bool) {
+	maxDistance := len(name) / 3
+	if maxDistance > 3 {
+		maxDistance = 3
+	}
+	if maxDistance < 1 {
+		maxDistance = 1
+	}
+
+	suggestion, minDistance := "", maxDistance+1
+	for _, candidate := range known {
+		distance := editDistance(strings.ToLower(name), candidate)
+		if distance < minDistance {
+			suggestion, minDistance = candidate, distance
+		}
+	}
+	return suggestion, suggestion != ""
+}
+
+// editDistance computes Levenshtein distance between a and b
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+
+			curr[j] = prev[j] + 1
+			if curr[j-1]+1 < curr[j] {
+				curr[j] = curr[j-1] + 1
+			}
+			if prev[j-1]+cost < curr[j] {
+				curr[j] = prev[j-1] + cost
+			}
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
@@ -0,0 +1,51 @@
+package common
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestParseHandlerSettings(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings string
+		expected []string // Settings reported as invalid
+	}{
+		{"empty", `{}`, nil},
+		{"valid", `{"worker_count": 3, "log_level": "DEBUG", "worker_queue_low_watermark": 20, "worker_queue_high_watermark": 80}`, nil},
+		{"null ignored", `{"worker_count": null}`, nil},
+		{"type mismatch", `{"worker_count": "3", "log_level": 1}`, []string{"log_level", "worker_count"}},
+		{"not positive", `{"worker_count": 0, "timer_context_size": -1}`, []string{"timer_context_size", "worker_count"}},
+		{"negative", `{"lcb_retry_count": -1, "retry_count": 0}`, []string{"lcb_retry_count"}},
+		{"zero unsigned", `{"timer_queue_size": 0, "dcp_window_size": 0}`, []string{"dcp_window_size", "timer_queue_size"}},
+		{"watermark out of range", `{"worker_queue_high_watermark": 101}`, []string{"worker_queue_high_watermark"}},
+		{"watermarks inverted", `{"worker_queue_low_watermark": 80, "worker_queue_high_watermark": 20}`, []string{"worker_queue_low_watermark"}},
+		{"takeover routines inverted", `{"vb_takeover_routine_min_count": 4, "vb_takeover_routine_max_count": 2}`, []string{"vb_takeover_routine_min_count"}},
+		{"latency percent out of range", `{"metadata_latency_inject_percent": 200}`, []string{"metadata_latency_inject_percent"}},
+		{"unknown value", `{"dcp_stream_boundary": "sometimes", "worker_ipc_type": "pipe"}`, []string{"dcp_stream_boundary", "worker_ipc_type"}},
+		{"unknown retry kind", `{"retry_on": ["timeout", "sometimes"]}`, []string{"retry_on"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := ParseHandlerSettings([]byte(test.settings))
+
+			var got []string
+			if err != nil {
+				errs, ok := err.(SettingsErrors)
+				if !ok {
+					t.Fatalf("got: %T expected: SettingsErrors", err)
+				}
+				for _, settingErr := range errs {
+					got = append(got, settingErr.Setting)
+				}
+				sort.Strings(got)
+			}
+
+			if !reflect.DeepEqual(got, test.expected) {
+				t.Errorf("got: %v expected: %v, err: %v", got, test.expected, err)
+			}
+		})
+	}
+}
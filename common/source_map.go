@@ -0,0 +1,78 @@
+package common
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const SourceMapVersion = 1
+
+// SourceMap maps line numbers of script loaded in V8 i.e. handler headers followed
+// by transpiled handler code and handler footers, back to the handler code supplied
+// by user. Transpilation of N1QL queries retains line count, so offsets suffice
+type SourceMap struct {
+	Version     int    `json:"version"`
+	Script      string `json:"script"`
+	HeaderLines int    `json:"header_lines"`
+	CodeLines   int    `json:"code_lines"`
+	FooterLines int    `json:"footer_lines"`
+
+	frameRegexp *regexp.Regexp
+}
+
+// NewSourceMap mirrors the way cpp worker assembles script from headers, code
+// and footers, each of them terminated by a newline
+func NewSourceMap(appName string, headers []string, code string, footers []string) *SourceMap {
+	m := &SourceMap{
+		Version:   SourceMapVersion,
+		Script:    appName + ".js",
+		CodeLines: strings.Count(code, "\n") + 1,
+	}
+
+	for _, header := range headers {
+		m.HeaderLines += strings.Count(header, "\n") + 1
+	}
+	for _, footer := range footers {
+		m.FooterLines += strings.Count(footer, "\n") + 1
+	}
+
+	m.frameRegexp = regexp.MustCompile(regexp.QuoteMeta(m.Script) + `:(\d+)`)
+	return m
+}
+
+// OriginalLine returns section of script and line number within it, for a line
+// number of script loaded in V8
+func (m *SourceMap) OriginalLine(line int) (string, int) {
+	switch {
+	case line <= m.HeaderLines:
+		return "handlerHeaders", line
+	case line <= m.HeaderLines+m.CodeLines:
+		return "handlerCode", line - m.HeaderLines
+	default:
+		return "handlerFooters", line - m.HeaderLines - m.CodeLines
+	}
+}
+
+// Symbolicate rewrites script locations in stack traces e.g. "app.js:12:5" to
+// locations in handler code supplied by user e.g. "app.js:10:5", while locations
+// in headers or footers are tagged with the section they belong to
+func (m *SourceMap) Symbolicate(trace string) string {
+	if m == nil || m.frameRegexp == nil || !strings.Contains(trace, m.Script) {
+		return trace
+	}
+
+	return m.frameRegexp.ReplaceAllStringFunc(trace, func(loc string) string {
+		line, err := strconv.Atoi(loc[len(m.Script)+1:])
+		if err != nil {
+			return loc
+		}
+
+		section, origLine := m.OriginalLine(line)
+		if section == "handlerCode" {
+			return fmt.Sprintf("%s:%d", m.Script, origLine)
+		}
+		return fmt.Sprintf("%s[%s]:%d", m.Script, section, origLine)
+	})
+}
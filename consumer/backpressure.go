@@ -0,0 +1,83 @@
+package consumer
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/couchbase/eventing/logging"
+)
+
+// applyBackpressure holds off reading from aggregated DCP feed while events sent to
+// cpp worker and yet to be processed are over worker_queue_cap or worker_queue_mem_cap,
+// letting DCP flow control hold back KV. Throttling kicks in once queue reaches high
+// watermark of worker_queue_cap and lets up only after it drains to low watermark.
+// Returns true if caller should skip reading from feed
+func (c *Consumer) applyBackpressure() bool {
+	logPrefix := "Consumer::applyBackpressure"
+
+	if c.cppQueueSizes == nil {
+		return false
+	}
+
+	queueSize := c.numSentEvents - c.cppQueueSizes.NumProcessedEvents
+	queueMemSize := c.sentEventsSize - c.cppQueueSizes.ProcessedEventsSize
+
+	if !c.backpressureActive {
+		if queueSize < c.workerQueueHighWatermark && queueMemSize <= c.workerQueueMemCap {
+			return false
+		}
+
+		c.backpressureActive = true
+		c.backpressureStartTs = time.Now()
+		atomic.AddUint64(&c.backpressureCounter, 1)
+
+		logging.Infof("%s [%s:%s:%d] Throttling DCP feed, cpp queue size: %d high watermark: %d memory size: %d memory cap: %d",
+			logPrefix, c.workerName, c.tcpPort, c.Pid(), queueSize, c.workerQueueHighWatermark, queueMemSize, c.workerQueueMemCap)
+	} else if queueSize <= c.workerQueueLowWatermark && queueMemSize <= c.workerQueueMemCap {
+		c.releaseBackpressure(queueSize)
+		return false
+	}
+
+	logging.AppDebugf(c.app.AppName, "%s [%s:%s:%d] Throttling, cpp queue sizes: %+v, num sent event: %d, events size: %d",
+		logPrefix, c.workerName, c.tcpPort, c.Pid(), c.cppQueueSizes, c.numSentEvents, c.sentEventsSize)
+
+	// avoid throttling when consumer is pausing or terminating
+	if !(c.isPausing || atomic.LoadUint32(&c.isTerminateRunning) == 1) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// If rebalance in ongoing, it's important to read dcp mutations as STREAMBEGIN/END messages could be behind them.
+	// And it is also important to not queue up mutations in consumer to contain rss growth when cpp queues are full.
+	// So skip reading only when there is no rebalance on going, or we are not pausing or we are not undeploying
+	return !(c.isRebalanceOngoing || c.isPausing || atomic.LoadUint32(&c.isTerminateRunning) == 1)
+}
+
+func (c *Consumer) releaseBackpressure(queueSize int64) {
+	logPrefix := "Consumer::releaseBackpressure"
+
+	duration := time.Since(c.backpressureStartTs)
+	atomic.AddUint64(&c.backpressureDurationMs, uint64(duration/time.Millisecond))
+	c.backpressureActive = false
+
+	logging.Infof("%s [%s:%s:%d] Releasing DCP feed throttle after %v, cpp queue size: %d low watermark: %d",
+		logPrefix, c.workerName, c.tcpPort, c.Pid(), duration, queueSize, c.workerQueueLowWatermark)
+}
+
+// applyDcpQuota holds off reading from aggregated DCP feed while the function is over
+// its dcp_throughput_quota, so that it doesn't starve other functions on the node.
+// Returns true if caller should skip reading from feed
+func (c *Consumer) applyDcpQuota() bool {
+	wait := c.producer.ReserveDcpQuota()
+	if wait == 0 {
+		return false
+	}
+
+	// STREAMBEGIN/END messages could be behind mutations during rebalance, and pausing
+	// or undeploy need the feed drained, so feed is kept flowing in those cases
+	if c.isRebalanceOngoing || c.isPausing || atomic.LoadUint32(&c.isTerminateRunning) == 1 {
+		return false
+	}
+
+	time.Sleep(wait)
+	return true
+}
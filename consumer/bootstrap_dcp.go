@@ -0,0 +1,149 @@
+package consumer
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	couchbase "github.com/couchbase/eventing/dcp"
+	"github.com/couchbase/eventing/logging"
+	"github.com/couchbase/eventing/util"
+)
+
+// Suffix added to names of dcp feeds used for backfilling vbuckets, keeps them
+// distinguishable from steady-state feeds in KV stats
+const bootstrapDcpFeedSuffix = "_bootstrap"
+
+// High seqnos fetched for backfill checks are reused for this long, so that a
+// takeover of many vbs doesn't fetch those once per vb
+const bootstrapSeqNosTTL = 5 * time.Second
+
+// getBackfillEndSeqNo checks whether vb stream starting at startSeqNo would have
+// to backfill. Returns KV high seqno for the vb if it's more than configured
+// threshold ahead of startSeqNo
+func (c *Consumer) getBackfillEndSeqNo(vb uint16, startSeqNo uint64) (uint64, bool) {
+	logPrefix := "Consumer::getBackfillEndSeqNo"
+
+	if !c.useBootstrapDcpConnections {
+		return 0, false
+	}
+
+	vbSeqNos, err := c.getBootstrapSeqNos()
+	if err != nil || int(vb) >= len(vbSeqNos) {
+		logging.Errorf("%s [%s:%s:%d] vb: %d Failed to fetch high seqno, using steady-state feed, err: %v",
+			logPrefix, c.workerName, c.tcpPort, c.Pid(), vb, err)
+		return 0, false
+	}
+
+	highSeqNo := vbSeqNos[vb]
+	if highSeqNo <= startSeqNo || highSeqNo-startSeqNo <= uint64(c.bootstrapDcpBackfillThreshold) {
+		return 0, false
+	}
+
+	return highSeqNo, true
+}
+
+// getBootstrapSeqNos returns KV high seqnos of source bucket, fetched afresh only
+// once cached ones are older than bootstrapSeqNosTTL
+func (c *Consumer) getBootstrapSeqNos() ([]uint64, error) {
+	c.bootstrapSeqNosMutex.Lock()
+	defer c.bootstrapSeqNosMutex.Unlock()
+
+	if c.bootstrapSeqNos != nil && time.Since(c.bootstrapSeqNosFetchedAt) < bootstrapSeqNosTTL {
+		return c.bootstrapSeqNos, nil
+	}
+
+	vbSeqNos, err := util.GetSeqnos(c.producer.NsServerHostPort(), "default", c.sourceKeyspace.BucketName, c.srcCid)
+	if err != nil {
+		return nil, err
+	}
+
+	c.bootstrapSeqNos, c.bootstrapSeqNosFetchedAt = vbSeqNos, time.Now()
+	return vbSeqNos, nil
+}
+
+// getBootstrapDcpFeed returns dedicated backfill feed for kvAddr, starting one if
+// needed. Feeds are started without holding hostDcpFeedRWMutex, so that retries
+// don't hold up steady-state streams. Starts are serialized, as feeds for a kvAddr
+// share their name and KV would drop the older connection
+func (c *Consumer) getBootstrapDcpFeed(kvAddr string) (*couchbase.DcpFeed, error) {
+	logPrefix := "Consumer::getBootstrapDcpFeed"
+
+	c.bootstrapDcpFeedMutex.Lock()
+	defer c.bootstrapDcpFeedMutex.Unlock()
+
+	c.hostDcpFeedRWMutex.RLock()
+	dcpFeed, ok := c.kvHostBootstrapDcpFeedMap[kvAddr]
+	c.hostDcpFeedRWMutex.RUnlock()
+	if ok {
+		return dcpFeed, nil
+	}
+
+	feedName := couchbase.NewDcpFeedName(c.workerName + "_" + kvAddr + "_" + c.HostPortAddr() + bootstrapDcpFeedSuffix)
+	err := util.Retry(util.NewFixedBackoff(bucketOpRetryInterval), c.retryCount, startBootstrapDCPFeedOpCallback, c, feedName, kvAddr, &dcpFeed)
+	if err != nil {
+		return nil, err
+	}
+
+	if dcpFeed == nil {
+		return nil, fmt.Errorf("bootstrap dcp feed for kvAddr: %s not found", kvAddr)
+	}
+
+	c.hostDcpFeedRWMutex.Lock()
+	if atomic.LoadUint32(&c.isTerminateRunning) == 1 {
+		c.hostDcpFeedRWMutex.Unlock()
+		dcpFeed.Close()
+		return nil, fmt.Errorf("consumer is terminating")
+	}
+	c.kvHostBootstrapDcpFeedMap[kvAddr] = dcpFeed
+	c.hostDcpFeedRWMutex.Unlock()
+
+	c.addToAggChan(dcpFeed)
+
+	logging.Infof("%s [%s:%s:%d] kvAddr: %rs Started up new bootstrap dcp feed with priority: %s. Spawned aggChan routine",
+		logPrefix, c.workerName, c.tcpPort, c.Pid(), kvAddr, c.bootstrapDcpPriority)
+
+	return dcpFeed, nil
+}
+
+func (c *Consumer) getBootstrapDcpConfig() map[string]interface{} {
+	config := make(map[string]interface{}, len(c.dcpConfig)+1)
+	for k, v := range c.dcpConfig {
+		config[k] = v
+	}
+	config["priority"] = c.bootstrapDcpPriority
+	return config
+}
+
+func (c *Consumer) addBootstrapStream(vb uint16, endSeqNo uint64) {
+	c.vbBootstrapStreamsRWMutex.Lock()
+	defer c.vbBootstrapStreamsRWMutex.Unlock()
+	c.vbBootstrapStreams[vb] = endSeqNo
+}
+
+// purgeBootstrapStream drops vb from set of vbs streaming over bootstrap feed,
+// returns true if vb was present
+func (c *Consumer) purgeBootstrapStream(vb uint16) bool {
+	c.vbBootstrapStreamsRWMutex.Lock()
+	defer c.vbBootstrapStreamsRWMutex.Unlock()
+
+	_, ok := c.vbBootstrapStreams[vb]
+	delete(c.vbBootstrapStreams, vb)
+	return ok
+}
+
+func (c *Consumer) getBootstrapStreamCount() int {
+	c.vbBootstrapStreamsRWMutex.RLock()
+	defer c.vbBootstrapStreamsRWMutex.RUnlock()
+	return len(c.vbBootstrapStreams)
+}
+
+// closeBootstrapDcpFeeds closes dedicated backfill feeds. Caller is expected
+// to hold lock on hostDcpFeedRWMutex
+func (c *Consumer) closeBootstrapDcpFeeds() {
+	for _, dcpFeed := range c.kvHostBootstrapDcpFeedMap {
+		if dcpFeed != nil {
+			dcpFeed.Close()
+		}
+	}
+}
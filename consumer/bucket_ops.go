@@ -1,6 +1,7 @@
 package consumer
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"runtime/debug"
@@ -17,13 +18,14 @@ import (
 	"github.com/couchbase/gocbcore/v9"
 )
 
-var vbTakeoverCallback = func(args ...interface{}) error {
+var vbTakeoverCallback = util.InstrumentOp("consumer.vb_takeover", func(args ...interface{}) error {
 	logPrefix := "Consumer::vbTakeoverCallback"
 
 	c := args[0].(*Consumer)
-	vb := args[1].(uint16)
+	ctx := args[1].(context.Context)
+	vb := args[2].(uint16)
 
-	err := c.doVbTakeover(vb)
+	err := c.doVbTakeover(ctx, vb)
 	if err == errVbOwnedByAnotherNode && !c.checkIfCurrentNodeShouldOwnVb(vb) {
 		c.purgeVbStreamRequested(logPrefix, vb)
 		return nil
@@ -34,6 +36,18 @@ var vbTakeoverCallback = func(args ...interface{}) error {
 		return err
 	}
 
+	if err == errStreamReqDeferred || err == errConsumerFenced {
+		// vbsStateUpdate retries vbs remaining to own, once backoff of the vb has elapsed
+		// or consumer is unfenced
+		return nil
+	}
+
+	if err == context.Canceled || err == context.DeadlineExceeded {
+		logging.Infof("%s [%s:%s:%d] vb: %d vbTakeover request, msg: %v. Bailing out from retry",
+			logPrefix, c.workerName, c.tcpPort, c.Pid(), vb, err)
+		return nil
+	}
+
 	if err == errDcpFeedsClosed {
 		logging.Infof("%s [%s:%s:%d] vb: %d vbTakeover request, msg: %v. Bailing out from retry",
 			logPrefix, c.workerName, c.tcpPort, c.Pid(), vb, err)
@@ -48,9 +62,9 @@ var vbTakeoverCallback = func(args ...interface{}) error {
 	}
 
 	return err
-}
+})
 
-var setOpCallback = func(args ...interface{}) error {
+var setOpCallback = util.InstrumentOp("consumer.set_op", func(args ...interface{}) error {
 	logPrefix := "Consumer::setOpCallback"
 
 	c := args[0].(*Consumer)
@@ -59,7 +73,8 @@ var setOpCallback = func(args ...interface{}) error {
 
 	c.gocbMetaHandleMutex.RLock()
 	defer c.gocbMetaHandleMutex.RUnlock()
-	_, err := c.gocbMetaHandle.Upsert(vbKey.Raw(), vbBlob, nil)
+	c.producer.InjectMetadataLatency()
+	_, err := c.gocbMetaHandle.Upsert(vbKey.Raw(), vbBlob, &gocb.UpsertOptions{Transcoder: c.metaTranscoder})
 	if err != nil {
 		logging.Errorf("%s [%s:%s:%d] Key: %s Bucket set failed, err: %v",
 			logPrefix, c.workerName, c.tcpPort, c.Pid(), vbKey.Raw(), err)
@@ -70,9 +85,9 @@ var setOpCallback = func(args ...interface{}) error {
 	}
 
 	return err
-}
+})
 
-var getOpCallback = func(args ...interface{}) error {
+var getOpCallback = util.InstrumentOp("consumer.get_op", func(args ...interface{}) error {
 	logPrefix := "Consumer::getOpCallback"
 
 	c := args[0].(*Consumer)
@@ -93,7 +108,7 @@ var getOpCallback = func(args ...interface{}) error {
 	}
 
 	if atomic.LoadUint32(&c.isTerminateRunning) == 1 {
-		logging.Tracef("%s [%s:%s:%d] Exiting as worker is terminating",
+		logging.AppTracef(c.app.AppName, "%s [%s:%s:%d] Exiting as worker is terminating",
 			logPrefix, c.workerName, c.tcpPort, c.Pid())
 		return nil
 	}
@@ -105,7 +120,8 @@ var getOpCallback = func(args ...interface{}) error {
 	}
 
 	var err error
-	result, err = c.gocbMetaHandle.Get(vbKey.Raw(), nil)
+	c.producer.InjectMetadataLatency()
+	result, err = c.gocbMetaHandle.Get(vbKey.Raw(), &gocb.GetOptions{Transcoder: c.metaTranscoder})
 	keyNotFound := errors.Is(err, gocb.ErrDocumentNotFound)
 
 	if !skipEnoEnt && keyNotFound && createIfMissing {
@@ -144,9 +160,90 @@ var getOpCallback = func(args ...interface{}) error {
 		*isNoEnt = false
 	}
 	return nil
-}
+})
 
-var recreateCheckpointBlobsFromVbStatsCallback = func(args ...interface{}) error {
+// getMultiOpCallback fetches checkpoint blobs of multiple vbuckets in a single bulk op.
+// Blobs fetched in earlier attempts are skipped on retry
+var getMultiOpCallback = util.InstrumentOp("consumer.get_multi_op", func(args ...interface{}) error {
+	logPrefix := "Consumer::getMultiOpCallback"
+
+	c := args[0].(*Consumer)
+	vbKeys := args[1].(map[uint16]common.Key)
+	vbBlobs := args[2].(map[uint16]*vbucketKVBlob)
+	vbsNoEnt := args[3].(map[uint16]bool)
+	vbsCas := args[4].(map[uint16]gocb.Cas)
+
+	if atomic.LoadUint32(&c.isTerminateRunning) == 1 {
+		logging.AppTracef(c.app.AppName, "%s [%s:%s:%d] Exiting as worker is terminating",
+			logPrefix, c.workerName, c.tcpPort, c.Pid())
+		return nil
+	}
+
+	c.gocbMetaHandleMutex.RLock()
+	defer c.gocbMetaHandleMutex.RUnlock()
+	if c.gocbMetaHandle == nil {
+		return nil
+	}
+
+	vbs := make([]uint16, 0, len(vbKeys))
+	ops := make([]gocb.BulkOp, 0, len(vbKeys))
+	for vb, vbKey := range vbKeys {
+		if _, ok := vbBlobs[vb]; ok || vbsNoEnt[vb] {
+			continue
+		}
+		vbs = append(vbs, vb)
+		ops = append(ops, &gocb.GetOp{ID: vbKey.Raw()})
+	}
+
+	if len(ops) == 0 {
+		return nil
+	}
+
+	c.producer.InjectMetadataLatency()
+	err := c.gocbMetaHandle.Do(ops, &gocb.BulkOpOptions{Transcoder: c.metaTranscoder})
+	if errors.Is(err, gocbcore.ErrShutdown) || errors.Is(err, gocbcore.ErrCollectionsUnsupported) {
+		return nil
+	}
+	if err != nil {
+		logging.Errorf("%s [%s:%s:%d] Bulk fetch of %d keys failed, err: %v",
+			logPrefix, c.workerName, c.tcpPort, c.Pid(), len(ops), err)
+		return err
+	}
+
+	var failed int
+	for i, op := range ops {
+		getOp := op.(*gocb.GetOp)
+		vb := vbs[i]
+
+		if errors.Is(getOp.Err, gocb.ErrDocumentNotFound) {
+			vbsNoEnt[vb] = true
+			continue
+		}
+
+		if getOp.Err != nil {
+			failed++
+			err = getOp.Err
+			continue
+		}
+
+		var vbBlob vbucketKVBlob
+		if cErr := getOp.Result.Content(&vbBlob); cErr != nil {
+			failed++
+			err = cErr
+			continue
+		}
+		vbBlobs[vb] = &vbBlob
+		vbsCas[vb] = getOp.Result.Cas()
+	}
+
+	if err != nil {
+		logging.Errorf("%s [%s:%s:%d] Failed to fetch %d of %d keys, last err: %v",
+			logPrefix, c.workerName, c.tcpPort, c.Pid(), failed, len(ops), err)
+	}
+	return err
+})
+
+var recreateCheckpointBlobsFromVbStatsCallback = util.InstrumentOp("consumer.recreate_checkpoint_blobs_from_vb_stats", func(args ...interface{}) error {
 	logPrefix := "Consumer::recreateCheckpointBlobsFromVbStatsCallback"
 
 	c := args[0].(*Consumer)
@@ -185,10 +282,7 @@ var recreateCheckpointBlobsFromVbStatsCallback = func(args ...interface{}) error
 	vbBlob.LastProcessedDocIDTimerEvent = time.Now().UTC().Format(time.RFC3339)
 	vbBlob.NextDocIDTimerToProcess = time.Now().UTC().Add(time.Second).Format(time.RFC3339)
 
-	vbBlobVer := vbucketKVBlobVer{
-		*vbBlob,
-		util.EventingVer(),
-	}
+	vbBlobVer := newVbucketKVBlobVer(*vbBlob)
 
 	logging.Infof("%s [%s:%s:%d] vb: %d Recreating missing checkpoint blob", logPrefix, c.workerName, c.tcpPort, c.Pid(), vb)
 
@@ -201,9 +295,9 @@ var recreateCheckpointBlobsFromVbStatsCallback = func(args ...interface{}) error
 	logging.Infof("%s [%s:%s:%d] vb: %d Recreated missing checkpoint blob", logPrefix, c.workerName, c.tcpPort, c.Pid(), vb)
 
 	return nil
-}
+})
 
-var recreateCheckpointBlobCallback = func(args ...interface{}) error {
+var recreateCheckpointBlobCallback = util.InstrumentOp("consumer.recreate_checkpoint_blob", func(args ...interface{}) error {
 	logPrefix := "Consumer::recreateCheckpointBlobCallback"
 
 	c := args[0].(*Consumer)
@@ -254,10 +348,7 @@ var recreateCheckpointBlobCallback = func(args ...interface{}) error {
 		vbBlob.LastProcessedDocIDTimerEvent = time.Now().UTC().Format(time.RFC3339)
 		vbBlob.NextDocIDTimerToProcess = time.Now().UTC().Add(time.Second).Format(time.RFC3339)
 
-		vbBlobVer := vbucketKVBlobVer{
-			*vbBlob,
-			util.EventingVer(),
-		}
+		vbBlobVer := newVbucketKVBlobVer(*vbBlob)
 		err = util.Retry(util.NewFixedBackoff(bucketOpRetryInterval), c.retryCount, setOpCallback, c, vbKey, &vbBlobVer)
 		if err == common.ErrRetryTimeout {
 			logging.Errorf("%s [%s:%s:%d] Exiting due to timeout", logPrefix, c.workerName, c.tcpPort, c.Pid())
@@ -268,17 +359,43 @@ var recreateCheckpointBlobCallback = func(args ...interface{}) error {
 	logging.Infof("%s [%s:%s:%d] vb: %d Recreated missing checkpoint blob", logPrefix, c.workerName, c.tcpPort, c.Pid(), vb)
 	return nil
 
-}
+})
 
-var periodicCheckpointCallback = func(args ...interface{}) error {
+var periodicCheckpointCallback = util.InstrumentOp("consumer.periodic_checkpoint", func(args ...interface{}) error {
 	logPrefix := "Consumer::periodicCheckpointCallback"
 
 	c := args[0].(*Consumer)
 	vbKey := args[1].(common.Key)
 	vbBlob := args[2].(*vbucketKVBlob)
 
+	mutateIn, rebalance := c.periodicCheckpointSpecs(vbBlob)
+
+	c.gocbMetaHandleMutex.RLock()
+	defer c.gocbMetaHandleMutex.RUnlock()
+	_, err := c.metaMutateIn(vbKey.Raw(), mutateIn, nil)
+
+	if rebalance != nil {
+		_, err = c.metaMutateIn(vbKey.Raw(), rebalance, nil)
+	}
+	if errors.Is(err, gocbcore.ErrShutdown) || errors.Is(err, gocb.ErrDocumentNotFound) || errors.Is(err, gocbcore.ErrCollectionsUnsupported) {
+		return nil
+	}
+
+	c.producer.RecordMetadataWrite(err)
+	if err != nil {
+		c.failureDomains.record(common.FailureDomainMetadata, "checkpoint_update", err)
+		logging.Errorf("%s [%s:%s:%d] Key: %ru, subdoc operation failed while performing periodic checkpoint update, err: %v",
+			logPrefix, c.workerName, c.tcpPort, c.Pid(), vbKey.Raw(), err)
+	}
+
+	return err
+})
+
+// periodicCheckpointSpecs returns subdoc specs writing checkpoint of a vbucket, along
+// with specs claiming its ownership if checkpoint blob doesn't name an owner yet
+func (c *Consumer) periodicCheckpointSpecs(vbBlob *vbucketKVBlob) (mutateIn, rebalance []gocb.MutateInSpec) {
 	upsertOptions := &gocb.UpsertSpecOptions{CreatePath: true}
-	mutateIn := make([]gocb.MutateInSpec, 0)
+	mutateIn = make([]gocb.MutateInSpec, 0)
 
 	mutateIn = append(mutateIn, gocb.UpsertSpec("currently_processed_doc_id_timer", vbBlob.CurrentProcessedDocIDTimer, upsertOptions))
 	mutateIn = append(mutateIn, gocb.UpsertSpec("currently_processed_cron_timer", vbBlob.CurrentProcessedCronTimer, upsertOptions))
@@ -292,10 +409,6 @@ var periodicCheckpointCallback = func(args ...interface{}) error {
 	mutateIn = append(mutateIn, gocb.UpsertSpec("manifest_id", vbBlob.ManifestUID, upsertOptions))
 	mutateIn = append(mutateIn, gocb.UpsertSpec("vb_uuid", vbBlob.VBuuid, upsertOptions))
 
-	c.gocbMetaHandleMutex.RLock()
-	defer c.gocbMetaHandleMutex.RUnlock()
-	_, err := c.gocbMetaHandle.MutateIn(vbKey.Raw(), mutateIn, nil)
-
 	if !c.isRebalanceOngoing && !c.vbsStateUpdateRunning && (vbBlob.NodeUUID == "" || vbBlob.CurrentVBOwner == "") {
 		entry := OwnershipEntry{
 			AssignedWorker: c.ConsumerName(),
@@ -304,7 +417,7 @@ var periodicCheckpointCallback = func(args ...interface{}) error {
 			Timestamp:      time.Now().String(),
 		}
 
-		rebalance := make([]gocb.MutateInSpec, 0)
+		rebalance = make([]gocb.MutateInSpec, 0)
 
 		rebalance = append(rebalance, gocb.ArrayAppendSpec("ownership_history", entry, &gocb.ArrayAppendSpecOptions{CreatePath: true}))
 		rebalance = append(rebalance, gocb.UpsertSpec("assigned_worker", c.ConsumerName(), upsertOptions))
@@ -314,22 +427,94 @@ var periodicCheckpointCallback = func(args ...interface{}) error {
 		rebalance = append(rebalance, gocb.UpsertSpec("last_checkpoint_time", time.Now().String(), upsertOptions))
 		rebalance = append(rebalance, gocb.UpsertSpec("node_uuid", c.NodeUUID(), upsertOptions))
 		rebalance = append(rebalance, gocb.UpsertSpec("vb_uuid", vbBlob.VBuuid, upsertOptions))
-		_, err = c.gocbMetaHandle.MutateIn(vbKey.Raw(), rebalance, nil)
+	}
+	return
+}
 
+// bulkCheckpointCallback writes batched checkpoints in a single bulk op. Each write
+// carries CAS of the blob from the bulk get, so a blob changed since, say by a new
+// owner, isn't overwritten. Checkpoints written or dropped are taken out of batch,
+// retries only go for the ones that failed otherwise
+var bulkCheckpointCallback = util.InstrumentOp("consumer.bulk_checkpoint", func(args ...interface{}) error {
+	logPrefix := "Consumer::bulkCheckpointCallback"
+
+	c := args[0].(*Consumer)
+	batch := args[1].(map[uint16]*pendingCheckpoint)
+	written := args[2].(*uint64)
+	casMismatches := args[3].(*uint64)
+
+	c.gocbMetaHandleMutex.RLock()
+	defer c.gocbMetaHandleMutex.RUnlock()
+	if c.gocbMetaHandle == nil {
+		return nil
 	}
-	if errors.Is(err, gocbcore.ErrShutdown) || errors.Is(err, gocb.ErrDocumentNotFound) || errors.Is(err, gocbcore.ErrCollectionsUnsupported) {
+
+	vbs := make([]uint16, 0, len(batch))
+	ops := make([]gocb.BulkOp, 0, len(batch))
+	for vb, checkpoint := range batch {
+		mutateIn, rebalance := c.periodicCheckpointSpecs(checkpoint.vbBlob)
+		vbs = append(vbs, vb)
+		ops = append(ops, &gocb.MutateInOp{
+			ID:  checkpoint.vbKey.Raw(),
+			Cas: checkpoint.cas,
+			Ops: append(mutateIn, rebalance...),
+		})
+	}
+
+	if len(ops) == 0 {
 		return nil
 	}
 
+	atomic.AddUint64(&c.networkStats.metadataSubdocs, uint64(len(ops)))
+	c.producer.InjectMetadataLatency()
+	err := c.gocbMetaHandle.Do(ops, &gocb.BulkOpOptions{Transcoder: c.metaTranscoder})
+	if errors.Is(err, gocbcore.ErrShutdown) || errors.Is(err, gocbcore.ErrCollectionsUnsupported) {
+		return nil
+	}
 	if err != nil {
-		logging.Errorf("%s [%s:%s:%d] Key: %ru, subdoc operation failed while performing periodic checkpoint update, err: %v",
-			logPrefix, c.workerName, c.tcpPort, c.Pid(), vbKey.Raw(), err)
+		logging.Errorf("%s [%s:%s:%d] Bulk checkpoint of %d vbs failed, err: %v",
+			logPrefix, c.workerName, c.tcpPort, c.Pid(), len(ops), err)
+		return err
+	}
+
+	var failed int
+	err = nil
+	for i, op := range ops {
+		mutateInOp := op.(*gocb.MutateInOp)
+		vb := vbs[i]
+
+		switch {
+		case mutateInOp.Err == nil:
+			*written++
+			delete(batch, vb)
+
+		case errors.Is(mutateInOp.Err, gocb.ErrCasMismatch):
+			logging.Infof("%s [%s:%s:%d] vb: %d Dropping checkpoint as blob changed since it was read",
+				logPrefix, c.workerName, c.tcpPort, c.Pid(), vb)
+			*casMismatches++
+			delete(batch, vb)
+			continue
+
+		case errors.Is(mutateInOp.Err, gocb.ErrDocumentNotFound), errors.Is(mutateInOp.Err, gocbcore.ErrShutdown):
+			delete(batch, vb)
+			continue
+
+		default:
+			failed++
+			err = mutateInOp.Err
+		}
+		c.producer.RecordMetadataWrite(mutateInOp.Err)
 	}
 
+	if err != nil {
+		c.failureDomains.record(common.FailureDomainMetadata, "checkpoint_update", err)
+		logging.Errorf("%s [%s:%s:%d] Failed to checkpoint %d of %d vbs, last err: %v",
+			logPrefix, c.workerName, c.tcpPort, c.Pid(), failed, len(ops), err)
+	}
 	return err
-}
+})
 
-var updateCheckpointCallback = func(args ...interface{}) error {
+var updateCheckpointCallback = util.InstrumentOp("consumer.update_checkpoint", func(args ...interface{}) error {
 	logPrefix := "Consumer::updateCheckpointCallback"
 
 	c := args[0].(*Consumer)
@@ -358,7 +543,7 @@ retryUpdateCheckpoint:
 	mutateIn = append(mutateIn, gocb.UpsertSpec("manifest_id", vbBlob.ManifestUID, upsertOptions))
 	c.gocbMetaHandleMutex.RLock()
 	defer c.gocbMetaHandleMutex.RUnlock()
-	_, err := c.gocbMetaHandle.MutateIn(vbKey.Raw(), mutateIn, nil)
+	_, err := c.metaMutateIn(vbKey.Raw(), mutateIn, nil)
 
 	if errors.Is(err, gocb.ErrDocumentNotFound) {
 		var vbBlob vbucketKVBlob
@@ -376,15 +561,17 @@ retryUpdateCheckpoint:
 		return nil
 	}
 
+	c.producer.RecordMetadataWrite(err)
 	if err != nil {
+		c.failureDomains.record(common.FailureDomainMetadata, "checkpoint_update", err)
 		logging.Errorf("%s [%s:%s:%d] Key: %rm, subdoc operation failed while performing checkpoint update post dcp stop stream, err: %v",
 			logPrefix, c.workerName, c.tcpPort, c.Pid(), vbKey.Raw(), err)
 	}
 
 	return err
-}
+})
 
-var metadataCorrectionCallback = func(args ...interface{}) error {
+var metadataCorrectionCallback = util.InstrumentOp("consumer.metadata_correction", func(args ...interface{}) error {
 	logPrefix := "Consumer::metadataCorrectionCallback"
 
 	c := args[0].(*Consumer)
@@ -404,7 +591,7 @@ retryMetadataCorrection:
 	mutateIn = append(mutateIn, gocb.UpsertSpec("node_uuid", c.NodeUUID(), upsertOptions))
 	c.gocbMetaHandleMutex.RLock()
 	defer c.gocbMetaHandleMutex.RUnlock()
-	_, err := c.gocbMetaHandle.MutateIn(vbKey.Raw(), mutateIn, nil)
+	_, err := c.metaMutateIn(vbKey.Raw(), mutateIn, nil)
 
 	if errors.Is(err, gocbcore.ErrShutdown) || errors.Is(err, gocbcore.ErrCollectionsUnsupported) {
 		return nil
@@ -428,9 +615,9 @@ retryMetadataCorrection:
 	}
 
 	return err
-}
+})
 
-var undoMetadataCorrectionCallback = func(args ...interface{}) error {
+var undoMetadataCorrectionCallback = util.InstrumentOp("consumer.undo_metadata_correction", func(args ...interface{}) error {
 	logPrefix := "Consumer::undoMetadataCorrectionCallback"
 
 	c := args[0].(*Consumer)
@@ -450,7 +637,7 @@ retryUndoMetadataCorrection:
 	mutateIn = append(mutateIn, gocb.UpsertSpec("node_uuid", "", upsertOptions))
 	c.gocbMetaHandleMutex.RLock()
 	defer c.gocbMetaHandleMutex.RUnlock()
-	_, err := c.gocbMetaHandle.MutateIn(vbKey.Raw(), mutateIn, nil)
+	_, err := c.metaMutateIn(vbKey.Raw(), mutateIn, nil)
 
 	if errors.Is(err, gocbcore.ErrShutdown) || errors.Is(err, gocbcore.ErrCollectionsUnsupported) {
 		return nil
@@ -474,10 +661,10 @@ retryUndoMetadataCorrection:
 	}
 
 	return err
-}
+})
 
 // Called when STREAMREQ is sent from DCP Client to Producer
-var addOwnershipHistorySRRCallback = func(args ...interface{}) error {
+var addOwnershipHistorySRRCallback = util.InstrumentOp("consumer.add_ownership_history_srr", func(args ...interface{}) error {
 	logPrefix := "Consumer::addOwnershipHistorySRRCallback"
 
 	c := args[0].(*Consumer)
@@ -500,7 +687,7 @@ retrySRRUpdate:
 	mutateIn = append(mutateIn, gocb.UpsertSpec("worker_requested_vb_stream", c.ConsumerName(), upsertOptions))
 	c.gocbMetaHandleMutex.RLock()
 	defer c.gocbMetaHandleMutex.RUnlock()
-	_, err := c.gocbMetaHandle.MutateIn(vbKey.Raw(), mutateIn, nil)
+	_, err := c.metaMutateIn(vbKey.Raw(), mutateIn, nil)
 
 	if errors.Is(err, gocbcore.ErrShutdown) || errors.Is(err, gocbcore.ErrCollectionsUnsupported) {
 		return nil
@@ -524,10 +711,10 @@ retrySRRUpdate:
 	}
 
 	return err
-}
+})
 
 // Called when STREAMREQ isn't successful
-var addOwnershipHistorySRFCallback = func(args ...interface{}) error {
+var addOwnershipHistorySRFCallback = util.InstrumentOp("consumer.add_ownership_history_srf", func(args ...interface{}) error {
 	logPrefix := "Consumer::addOwnershipHistorySRFCallback"
 
 	c := args[0].(*Consumer)
@@ -549,7 +736,7 @@ retrySRFUpdate:
 	mutateIn = append(mutateIn, gocb.UpsertSpec("worker_requested_vb_stream", "", upsertOptions))
 	c.gocbMetaHandleMutex.RLock()
 	defer c.gocbMetaHandleMutex.RUnlock()
-	_, err := c.gocbMetaHandle.MutateIn(vbKey.Raw(), mutateIn, nil)
+	_, err := c.metaMutateIn(vbKey.Raw(), mutateIn, nil)
 
 	if errors.Is(err, gocbcore.ErrShutdown) || errors.Is(err, gocbcore.ErrCollectionsUnsupported) {
 		return nil
@@ -573,10 +760,10 @@ retrySRFUpdate:
 	}
 
 	return err
-}
+})
 
 // Called when STREAMREQ success response is received from DCP Producer
-var addOwnershipHistorySRSCallback = func(args ...interface{}) error {
+var addOwnershipHistorySRSCallback = util.InstrumentOp("consumer.add_ownership_history_srs", func(args ...interface{}) error {
 	logPrefix := "Consumer::addOwnershipHistorySRSCallback"
 
 	c := args[0].(*Consumer)
@@ -601,9 +788,10 @@ retrySRSUpdate:
 	mutateIn = append(mutateIn, gocb.UpsertSpec("node_uuid_requested_vb_stream", "", upsertOptions))
 	mutateIn = append(mutateIn, gocb.UpsertSpec("vb_uuid", vbBlob.VBuuid, upsertOptions))
 	mutateIn = append(mutateIn, gocb.UpsertSpec("worker_requested_vb_stream", "", upsertOptions))
+	mutateIn = append(mutateIn, gocb.UpsertSpec("handover", nil, upsertOptions))
 	c.gocbMetaHandleMutex.RLock()
 	defer c.gocbMetaHandleMutex.RUnlock()
-	_, err := c.gocbMetaHandle.MutateIn(vbKey.Raw(), mutateIn, nil)
+	_, err := c.metaMutateIn(vbKey.Raw(), mutateIn, nil)
 
 	if errors.Is(err, gocbcore.ErrShutdown) || errors.Is(err, gocbcore.ErrCollectionsUnsupported) {
 		return nil
@@ -627,9 +815,9 @@ retrySRSUpdate:
 	}
 
 	return err
-}
+})
 
-var addOwnershipHistorySECallback = func(args ...interface{}) error {
+var addOwnershipHistorySECallback = util.InstrumentOp("consumer.add_ownership_history_se", func(args ...interface{}) error {
 	logPrefix := "Consumer::addOwnershipHistorySECallback"
 
 	c := args[0].(*Consumer)
@@ -648,7 +836,7 @@ retrySEUpdate:
 
 	c.gocbMetaHandleMutex.RLock()
 	defer c.gocbMetaHandleMutex.RUnlock()
-	_, err := c.gocbMetaHandle.MutateIn(vbKey.Raw(), mutateIn, nil)
+	_, err := c.metaMutateIn(vbKey.Raw(), mutateIn, nil)
 
 	if errors.Is(err, gocbcore.ErrShutdown) || errors.Is(err, gocbcore.ErrCollectionsUnsupported) {
 		return nil
@@ -672,16 +860,70 @@ retrySEUpdate:
 	}
 
 	return err
-}
+})
+
+var setVbHandoverCallback = util.InstrumentOp("consumer.set_vb_handover", func(args ...interface{}) error {
+	logPrefix := "Consumer::setVbHandoverCallback"
+
+	c := args[0].(*Consumer)
+	vbKey := args[1].(common.Key)
+	handover := args[2].(*vbHandover)
+	upsertOptions := &gocb.UpsertSpecOptions{CreatePath: true}
+
+	mutateIn := make([]gocb.MutateInSpec, 0)
+	mutateIn = append(mutateIn, gocb.UpsertSpec("handover", handover, upsertOptions))
+
+	c.gocbMetaHandleMutex.RLock()
+	defer c.gocbMetaHandleMutex.RUnlock()
+	_, err := c.metaMutateIn(vbKey.Raw(), mutateIn, nil)
+
+	if errors.Is(err, gocbcore.ErrShutdown) || errors.Is(err, gocbcore.ErrCollectionsUnsupported) {
+		return nil
+	}
+
+	if err != nil {
+		logging.Errorf("%s [%s:%s:%d] Key: %rm, subdoc operation failed while publishing vb handover, err: %v",
+			logPrefix, c.workerName, c.tcpPort, c.Pid(), vbKey.Raw(), err)
+	}
+
+	return err
+})
 
-var getFailoverLogOpCallback = func(args ...interface{}) error {
+var ackVbHandoverCallback = util.InstrumentOp("consumer.ack_vb_handover", func(args ...interface{}) error {
+	logPrefix := "Consumer::ackVbHandoverCallback"
+
+	c := args[0].(*Consumer)
+	vbKey := args[1].(common.Key)
+	seqNo := args[2].(uint64)
+
+	mutateIn := make([]gocb.MutateInSpec, 0)
+	mutateIn = append(mutateIn, gocb.ReplaceSpec("handover.acked_seq_no", seqNo, nil))
+
+	c.gocbMetaHandleMutex.RLock()
+	defer c.gocbMetaHandleMutex.RUnlock()
+	_, err := c.metaMutateIn(vbKey.Raw(), mutateIn, nil)
+
+	if errors.Is(err, gocbcore.ErrShutdown) || errors.Is(err, gocbcore.ErrCollectionsUnsupported) ||
+		errors.Is(err, gocb.ErrPathNotFound) || errors.Is(err, gocb.ErrDocumentNotFound) {
+		return nil
+	}
+
+	if err != nil {
+		logging.Errorf("%s [%s:%s:%d] Key: %rm, subdoc operation failed while acking vb handover, err: %v",
+			logPrefix, c.workerName, c.tcpPort, c.Pid(), vbKey.Raw(), err)
+	}
+
+	return err
+})
+
+var getFailoverLogOpCallback = util.InstrumentOp("consumer.get_failover_log_op", func(args ...interface{}) error {
 	logPrefix := "Consumer::getFailoverLogOpCallback"
 
 	c := args[0].(*Consumer)
 	flogs := args[1].(*couchbase.FailoverLog)
 
 	if atomic.LoadUint32(&c.isTerminateRunning) == 1 {
-		logging.Tracef("%s [%s:%s:%d] Exiting as worker is terminating",
+		logging.AppTracef(c.app.AppName, "%s [%s:%s:%d] Exiting as worker is terminating",
 			logPrefix, c.workerName, c.tcpPort, c.Pid())
 		return nil
 	}
@@ -694,10 +936,10 @@ var getFailoverLogOpCallback = func(args ...interface{}) error {
 	}
 
 	return err
-}
+})
 
 // Fetches failover log from existing feed
-var getEFFailoverLogOpAllVbucketsCallback = func(args ...interface{}) error {
+var getEFFailoverLogOpAllVbucketsCallback = util.InstrumentOp("consumer.get_ef_failover_log_op_all_vbuckets", func(args ...interface{}) error {
 	logPrefix := "Consumer::getEFFailoverLogOpAllVbucketsCallback"
 
 	c := args[0].(*Consumer)
@@ -706,7 +948,7 @@ var getEFFailoverLogOpAllVbucketsCallback = func(args ...interface{}) error {
 	vbs := []uint16{vb}
 
 	if atomic.LoadUint32(&c.isTerminateRunning) == 1 {
-		logging.Tracef("%s [%s:%s:%d] Exiting as worker is terminating",
+		logging.AppTracef(c.app.AppName, "%s [%s:%s:%d] Exiting as worker is terminating",
 			logPrefix, c.workerName, c.tcpPort, c.Pid())
 		return nil
 	}
@@ -719,9 +961,9 @@ var getEFFailoverLogOpAllVbucketsCallback = func(args ...interface{}) error {
 	}
 
 	return err
-}
+})
 
-var startDCPFeedOpCallback = func(args ...interface{}) error {
+var startDCPFeedOpCallback = util.InstrumentOp("consumer.start_dcp_feed_op", func(args ...interface{}) error {
 	logPrefix := "Consumer::startDCPFeedOpCallback"
 
 	c := args[0].(*Consumer)
@@ -729,7 +971,7 @@ var startDCPFeedOpCallback = func(args ...interface{}) error {
 	kvHostPort := args[2].(string)
 
 	if atomic.LoadUint32(&c.isTerminateRunning) == 1 {
-		logging.Tracef("%s [%s:%s:%d] Exiting as worker is terminating",
+		logging.AppTracef(c.app.AppName, "%s [%s:%s:%d] Exiting as worker is terminating",
 			logPrefix, c.workerName, c.tcpPort, c.Pid())
 		return nil
 	}
@@ -741,18 +983,51 @@ var startDCPFeedOpCallback = func(args ...interface{}) error {
 	if err != nil {
 		logging.Errorf("%s [%s:%s:%d] Failed to start dcp feed for bucket: %v from kv node: %rs, err: %v",
 			logPrefix, c.workerName, c.tcpPort, c.Pid(), c.sourceKeyspace.BucketName, kvHostPort, err)
+		c.dcpFeedEvents.connectFailed(kvHostPort, err)
+		c.failureDomains.record(common.FailureDomainNetwork, "dcp_feed_connect", err)
 		return err
 	}
-	logging.Infof("%s [%s:%s:%d] Started up dcp feed for bucket: %v from kv node: %rs",
-		logPrefix, c.workerName, c.tcpPort, c.Pid(), c.sourceKeyspace.BucketName, kvHostPort)
+	logging.Infof("%s [%s:%s:%d] Started up dcp feed for bucket: %v from kv node: %rs, window size: %v noop interval: %vs connections: %v",
+		logPrefix, c.workerName, c.tcpPort, c.Pid(), c.sourceKeyspace.BucketName, kvHostPort,
+		c.dcpConfig["dcpWindowSize"], c.dcpConfig["noopInterval"], c.dcpConfig["numConnections"])
+	c.dcpFeedEvents.connected(kvHostPort)
 
 	// Lock not needed as caller already has grabbed write lock
 	c.kvHostDcpFeedMap[kvHostPort] = dcpFeed
 
 	return nil
-}
+})
 
-var populateDcpFeedVbEntriesCallback = func(args ...interface{}) error {
+var startBootstrapDCPFeedOpCallback = util.InstrumentOp("consumer.start_bootstrap_dcp_feed_op", func(args ...interface{}) error {
+	logPrefix := "Consumer::startBootstrapDCPFeedOpCallback"
+
+	c := args[0].(*Consumer)
+	feedName := args[1].(couchbase.DcpFeedName)
+	kvHostPort := args[2].(string)
+	dcpFeed := args[3].(**couchbase.DcpFeed)
+
+	if atomic.LoadUint32(&c.isTerminateRunning) == 1 {
+		logging.AppTracef(c.app.AppName, "%s [%s:%s:%d] Exiting as worker is terminating",
+			logPrefix, c.workerName, c.tcpPort, c.Pid())
+		return nil
+	}
+
+	feed, err := c.cbBucket.StartDcpFeedOver(
+		feedName, uint32(0), includeXATTRs, []string{kvHostPort}, 0xABCD, c.getBootstrapDcpConfig())
+
+	if err != nil {
+		logging.Errorf("%s [%s:%s:%d] Failed to start bootstrap dcp feed for bucket: %v from kv node: %rs, err: %v",
+			logPrefix, c.workerName, c.tcpPort, c.Pid(), c.sourceKeyspace.BucketName, kvHostPort, err)
+		return err
+	}
+	logging.Infof("%s [%s:%s:%d] Started up bootstrap dcp feed for bucket: %v from kv node: %rs",
+		logPrefix, c.workerName, c.tcpPort, c.Pid(), c.sourceKeyspace.BucketName, kvHostPort)
+
+	*dcpFeed = feed
+	return nil
+})
+
+var populateDcpFeedVbEntriesCallback = util.InstrumentOp("consumer.populate_dcp_feed_vb_entries", func(args ...interface{}) error {
 	logPrefix := "Consumer::populateDcpFeedVbEntriesCallback"
 
 	c := args[0].(*Consumer)
@@ -768,7 +1043,7 @@ var populateDcpFeedVbEntriesCallback = func(args ...interface{}) error {
 	kvHostDcpFeedMap := make(map[string]*couchbase.DcpFeed)
 
 	if atomic.LoadUint32(&c.isTerminateRunning) == 1 {
-		logging.Tracef("%s [%s:%s:%d] Exiting as worker is terminating",
+		logging.AppTracef(c.app.AppName, "%s [%s:%s:%d] Exiting as worker is terminating",
 			logPrefix, c.workerName, c.tcpPort, c.Pid())
 		return nil
 	}
@@ -828,9 +1103,9 @@ var populateDcpFeedVbEntriesCallback = func(args ...interface{}) error {
 	}
 
 	return nil
-}
+})
 
-var acquireDebuggerTokenCallback = func(args ...interface{}) error {
+var acquireDebuggerTokenCallback = util.InstrumentOp("consumer.acquire_debugger_token", func(args ...interface{}) error {
 	logPrefix := "Consumer::acquireDebuggerTokenCallback"
 
 	c := args[0].(*Consumer)
@@ -842,7 +1117,8 @@ var acquireDebuggerTokenCallback = func(args ...interface{}) error {
 
 	c.gocbMetaHandleMutex.RLock()
 	defer c.gocbMetaHandleMutex.RUnlock()
-	result, err := c.gocbMetaHandle.Get(key, nil)
+	c.producer.InjectMetadataLatency()
+	result, err := c.gocbMetaHandle.Get(key, &gocb.GetOptions{Transcoder: c.metaTranscoder})
 	if errors.Is(err, gocb.ErrDocumentNotFound) || errors.Is(err, gocbcore.ErrShutdown) || errors.Is(err, gocbcore.ErrCollectionsUnsupported) {
 		logging.Errorf("%s [%s:%s:%d] Key: %s, debugger token not found or bucket is closed, err: %v",
 			logPrefix, c.workerName, c.tcpPort, c.Pid(), key, err)
@@ -866,7 +1142,7 @@ var acquireDebuggerTokenCallback = func(args ...interface{}) error {
 
 	// Some other consumer has acquired the token
 	if instance.Status == common.MutationTrapped || instance.Token != token {
-		logging.Debugf("%s [%s:%s:%d] Some other consumer acquired the debugger token or token is stale",
+		logging.AppDebugf(c.app.AppName, "%s [%s:%s:%d] Some other consumer acquired the debugger token or token is stale",
 			logPrefix, c.workerName, c.tcpPort, c.Pid())
 		*success = false
 		return nil
@@ -875,7 +1151,8 @@ var acquireDebuggerTokenCallback = func(args ...interface{}) error {
 	instance.Host = c.HostPortAddr()
 	instance.Status = common.MutationTrapped
 	replaceOptions := &gocb.ReplaceOptions{Cas: result.Result.Cas(),
-		Expiry: 0}
+		Expiry: 0, Transcoder: c.metaTranscoder}
+	c.producer.InjectMetadataLatency()
 	_, err = c.gocbMetaHandle.Replace(key, instance, replaceOptions)
 	if err == nil {
 		logging.Infof("%s [%s:%s:%d] Debugger token acquired", logPrefix, c.workerName, c.tcpPort, c.Pid())
@@ -895,16 +1172,16 @@ var acquireDebuggerTokenCallback = func(args ...interface{}) error {
 		logPrefix, c.workerName, c.tcpPort, c.Pid(), err)
 
 	return err
-}
+})
 
-var checkIfVbStreamsOpenedCallback = func(args ...interface{}) error {
+var checkIfVbStreamsOpenedCallback = util.InstrumentOp("consumer.check_if_vb_streams_opened", func(args ...interface{}) error {
 	logPrefix := "Consumer::checkIfVbStreamsOpenedCallback"
 
 	c := args[0].(*Consumer)
 	vbs := args[1].([]uint16)
 
 	if atomic.LoadUint32(&c.isTerminateRunning) == 1 {
-		logging.Tracef("%s [%s:%s:%d] Exiting as worker is terminating",
+		logging.AppTracef(c.app.AppName, "%s [%s:%s:%d] Exiting as worker is terminating",
 			logPrefix, c.workerName, c.tcpPort, c.Pid())
 		return nil
 	}
@@ -922,4 +1199,4 @@ var checkIfVbStreamsOpenedCallback = func(args ...interface{}) error {
 	}
 
 	return nil
-}
+})
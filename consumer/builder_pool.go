@@ -0,0 +1,202 @@
+package consumer
+
+import (
+	"math"
+	"sync/atomic"
+
+	flatbuffers "github.com/google/flatbuffers/go"
+)
+
+const (
+	defaultBuilderPoolSize = 128
+
+	// Weight given to latest finished size while updating moving average
+	builderSizeAvgWeight = 0.1
+
+	// Builders grown past this are released instead of being pooled, so that a few
+	// large documents don't pin their buffers
+	maxPooledBuilderSize = 1 << 20
+)
+
+// Lower bound on capacity of builders pooled in each size class
+var builderSizeClasses = []int{1 << 10, 1 << 12, 1 << 14, 1 << 16, 1 << 18}
+
+// builderPool is a bounded pool of flatbuffer builders, binned by capacity into size
+// classes so that callers which know the size of their message get a builder which
+// fits it. Builders handed out for the first time without a size hint are pre-sized
+// using moving average of finished message sizes, so that large payloads don't
+// trigger repeated buffer growth
+type builderPool struct {
+	pools           []chan *pooledBuilder // One per size class
+	initialCapacity int
+
+	avgSize uint64 // Bits of float64 moving average, access via atomics
+
+	// Set under memory pressure, builders are released instead of being pooled
+	shedding uint32
+
+	getCounter    uint64
+	reuseCounter  uint64
+	resizeCounter uint64
+	dropCounter   uint64
+}
+
+// pooledBuilder carries capacity a builder was handed out with, so that growth
+// is counted once it's back. Builders which never make it back are simply
+// collected along with it
+type pooledBuilder struct {
+	*flatbuffers.Builder
+	capAtGet int
+}
+
+func newBuilderPool(poolSize, initialCapacity int) *builderPool {
+	if poolSize <= 0 {
+		poolSize = 1
+	}
+
+	if initialCapacity < 0 {
+		initialCapacity = 0
+	}
+
+	classSize := poolSize / len(builderSizeClasses)
+	if classSize <= 0 {
+		classSize = 1
+	}
+
+	pools := make([]chan *pooledBuilder, len(builderSizeClasses))
+	for i := range pools {
+		pools[i] = make(chan *pooledBuilder, classSize)
+	}
+
+	return &builderPool{
+		pools:           pools,
+		initialCapacity: initialCapacity,
+	}
+}
+
+// get hands out a builder with room for sizeHint bytes, taken from the size class
+// fitting it or the one above. Moving average of finished sizes is used if no hint
+// is passed
+func (bp *builderPool) get(sizeHint int) *pooledBuilder {
+	atomic.AddUint64(&bp.getCounter, 1)
+
+	if sizeHint <= 0 {
+		sizeHint = bp.initialCapacity
+		if avg := int(bp.loadAvgSize()); avg > sizeHint {
+			sizeHint = avg
+		}
+	}
+
+	class := getBuilderSizeClass(sizeHint)
+	var b *pooledBuilder
+	for i := class; i < len(bp.pools) && i <= class+1 && b == nil; i++ {
+		select {
+		case b = <-bp.pools[i]:
+			atomic.AddUint64(&bp.reuseCounter, 1)
+		default:
+		}
+	}
+
+	if b == nil {
+		size := sizeHint
+		if class < len(builderSizeClasses) && builderSizeClasses[class] > size {
+			size = builderSizeClasses[class]
+		}
+		b = &pooledBuilder{Builder: flatbuffers.NewBuilder(size)}
+	}
+
+	b.capAtGet = len(b.Bytes)
+	return b
+}
+
+func (bp *builderPool) put(b *pooledBuilder) {
+	if len(b.Bytes) > b.capAtGet {
+		atomic.AddUint64(&bp.resizeCounter, 1)
+	}
+	bp.updateAvgSize(float64(b.Offset()))
+
+	b.Reset()
+
+	if atomic.LoadUint32(&bp.shedding) == 1 || len(b.Bytes) > maxPooledBuilderSize {
+		atomic.AddUint64(&bp.dropCounter, 1)
+		return
+	}
+
+	// Pooled in the largest class it has room for
+	class := 0
+	for i, bound := range builderSizeClasses {
+		if len(b.Bytes) >= bound {
+			class = i
+		}
+	}
+
+	select {
+	case bp.pools[class] <- b:
+	default:
+		atomic.AddUint64(&bp.dropCounter, 1)
+	}
+}
+
+func (bp *builderPool) loadAvgSize() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&bp.avgSize))
+}
+
+func (bp *builderPool) updateAvgSize(finishedSize float64) {
+	for {
+		old := atomic.LoadUint64(&bp.avgSize)
+		avg := finishedSize
+		if old != 0 {
+			avg = (1-builderSizeAvgWeight)*math.Float64frombits(old) + builderSizeAvgWeight*finishedSize
+		}
+		if atomic.CompareAndSwapUint64(&bp.avgSize, old, math.Float64bits(avg)) {
+			return
+		}
+	}
+}
+
+// getBuilderSizeClass returns the smallest size class which fits size, or count of
+// size classes if none does
+func getBuilderSizeClass(size int) int {
+	for i, bound := range builderSizeClasses {
+		if size <= bound {
+			return i
+		}
+	}
+	return len(builderSizeClasses)
+}
+
+// shed releases pooled builders and stops pooling returned ones till shedding is unset
+func (bp *builderPool) shed(shed bool) {
+	if !shed {
+		atomic.StoreUint32(&bp.shedding, 0)
+		return
+	}
+
+	atomic.StoreUint32(&bp.shedding, 1)
+	for _, pool := range bp.pools {
+	drain:
+		for {
+			select {
+			case <-pool:
+			default:
+				break drain
+			}
+		}
+	}
+}
+
+func (bp *builderPool) stats() map[string]uint64 {
+	idle := 0
+	for _, pool := range bp.pools {
+		idle += len(pool)
+	}
+
+	return map[string]uint64{
+		"builder_pool_get_counter":    atomic.LoadUint64(&bp.getCounter),
+		"builder_pool_reuse_counter":  atomic.LoadUint64(&bp.reuseCounter),
+		"builder_pool_resize_counter": atomic.LoadUint64(&bp.resizeCounter),
+		"builder_pool_drop_counter":   atomic.LoadUint64(&bp.dropCounter),
+		"builder_pool_avg_size":       uint64(bp.loadAvgSize()),
+		"builder_pool_idle":           uint64(idle),
+	}
+}
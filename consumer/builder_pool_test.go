@@ -0,0 +1,85 @@
+package consumer
+
+import (
+	"testing"
+)
+
+func TestBuilderPool(t *testing.T) {
+	tests := []struct {
+		name     string
+		sizeHint int
+		grow     int // Bytes written into builder before it's put back
+		shed     bool
+		expected map[string]uint64
+	}{
+		{
+			name:     "fits size class",
+			sizeHint: 100,
+			grow:     100,
+			expected: map[string]uint64{"builder_pool_resize_counter": 0, "builder_pool_drop_counter": 0, "builder_pool_idle": 1},
+		},
+		{
+			name:     "grown past capacity",
+			sizeHint: 100,
+			grow:     4 * 1024,
+			expected: map[string]uint64{"builder_pool_resize_counter": 1, "builder_pool_drop_counter": 0, "builder_pool_idle": 1},
+		},
+		{
+			name:     "grown past pooled size",
+			sizeHint: 100,
+			grow:     2 * maxPooledBuilderSize,
+			expected: map[string]uint64{"builder_pool_resize_counter": 1, "builder_pool_drop_counter": 1, "builder_pool_idle": 0},
+		},
+		{
+			name:     "shedding",
+			sizeHint: 100,
+			grow:     100,
+			shed:     true,
+			expected: map[string]uint64{"builder_pool_resize_counter": 0, "builder_pool_drop_counter": 1, "builder_pool_idle": 0},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			bp := newBuilderPool(len(builderSizeClasses), 0)
+			bp.shed(test.shed)
+
+			b := bp.get(test.sizeHint)
+			if len(b.Bytes) < test.sizeHint || b.capAtGet != len(b.Bytes) {
+				t.Fatalf("capacity: %d capacity at get: %d size hint: %d", len(b.Bytes), b.capAtGet, test.sizeHint)
+			}
+
+			b.CreateByteString(make([]byte, test.grow))
+			bp.put(b)
+
+			stats := bp.stats()
+			for stat, expected := range test.expected {
+				if stats[stat] != expected {
+					t.Errorf("%s got: %d expected: %d", stat, stats[stat], expected)
+				}
+			}
+			if stats["builder_pool_avg_size"] < uint64(test.grow) {
+				t.Errorf("avg size got: %d expected at least: %d", stats["builder_pool_avg_size"], test.grow)
+			}
+		})
+	}
+}
+
+func TestBuilderPoolReuse(t *testing.T) {
+	bp := newBuilderPool(len(builderSizeClasses), 0)
+
+	b := bp.get(builderSizeClasses[1])
+	bp.put(b)
+
+	if reused := bp.get(builderSizeClasses[1]); reused != b {
+		t.Errorf("builder not reused from its size class")
+	}
+	if reused := bp.get(builderSizeClasses[1]); reused == b {
+		t.Errorf("builder handed out twice")
+	}
+
+	stats := bp.stats()
+	if stats["builder_pool_get_counter"] != 3 || stats["builder_pool_reuse_counter"] != 1 {
+		t.Errorf("got: %v expected 3 gets and 1 reuse", stats)
+	}
+}
@@ -1,8 +1,8 @@
 package consumer
 
 import (
-	"fmt"
 	"sort"
+	"sync/atomic"
 	"time"
 
 	"github.com/couchbase/eventing/common"
@@ -11,15 +11,28 @@ import (
 	"github.com/couchbase/gocb/v2"
 )
 
+// Checkpoint of an idle vb is rewritten every idle_checkpoint_interval, doubled after
+// every such write up to 2^maxIdleCheckpointBackoff times while vb stays idle
+const maxIdleCheckpointBackoff = 4
+
+type vbCheckpointState struct {
+	lastWrite  time.Time
+	idleWrites uint // Consecutive writes made while vb was idle
+}
+
 func (c *Consumer) doLastSeqNoCheckpoint() {
 	logPrefix := "Consumer::doLastSeqNoCheckpoint"
 
 	c.checkpointTicker = time.NewTicker(c.checkpointInterval)
 
+	if c.checkpointBatchInterval > 0 {
+		go c.runCheckpointBatcher()
+	}
+
 	var vbBlob vbucketKVBlob
 	var cas gocb.Cas
 	var isNoEnt bool
-	checkpoints := make([]time.Time, c.numVbuckets)
+	checkpoints := make([]vbCheckpointState, c.numVbuckets)
 	for {
 		select {
 		case <-c.checkpointTicker.C:
@@ -30,6 +43,11 @@ func (c *Consumer) doLastSeqNoCheckpoint() {
 				return
 			}
 
+			// Ownership given up while fenced mustn't be reclaimed by checkpointing
+			if c.isFenced() {
+				continue
+			}
+
 			err := util.Retry(util.NewFixedBackoff(clusterOpRetryInterval), c.retryCount, getEventingNodeAddrOpCallback, c)
 			if err == common.ErrRetryTimeout {
 				logging.Errorf("%s [%s:%s:%d] Exiting due to timeout", logPrefix, c.workerName, c.tcpPort, c.Pid())
@@ -43,13 +61,27 @@ func (c *Consumer) doLastSeqNoCheckpoint() {
 
 			sort.Sort(util.Uint16Slice(vbs))
 
+			if c.checkpointBatchInterval > 0 {
+				err = c.doBatchedCheckpoint(vbs, checkpoints)
+				if err == common.ErrRetryTimeout {
+					logging.Errorf("%s [%s:%s:%d] Exiting due to timeout", logPrefix, c.workerName, c.tcpPort, c.Pid())
+					return
+				}
+				continue
+			}
+
 			for _, vb := range vbs {
 
 				// only checkpoint stats for vbuckets that the consumer instance owns
 				if c.ConsumerName() == c.vbProcessingStats.getVbStat(vb, "assigned_worker") &&
 					c.NodeUUID() == c.vbProcessingStats.getVbStat(vb, "node_uuid") {
 
-					vbKey := fmt.Sprintf("%s::vb::%d", c.app.AppName, vb)
+					vbKey := common.CheckpointBlobKey(c.app.AppName, vb)
+
+					// Checkpoint of a vb being handed over belongs to its new owner
+					if c.vbHandovers.lingering(vb) {
+						continue
+					}
 
 					if c.isVbIdle(vb, &checkpoints[vb]) {
 						continue
@@ -82,6 +114,8 @@ func (c *Consumer) doLastSeqNoCheckpoint() {
 						continue
 					}
 
+					c.migrateCheckpointBlob(c.producer.AddMetadataPrefix(vbKey), vb, &vbBlob, cas)
+
 					// Steady state cluster
 					if c.NodeUUID() == vbBlob.NodeUUID && vbBlob.DCPStreamStatus == dcpStreamRunning {
 						err = c.updateCheckpointInfo(vbKey, vb, &vbBlob)
@@ -108,7 +142,7 @@ func (c *Consumer) doLastSeqNoCheckpoint() {
 				}
 			}
 
-		case <-c.stopConsumerCh:
+		case <-c.ctx.Done():
 			logging.Infof("%s [%s:%s:%d] Exited checkpointing routine",
 				logPrefix, c.workerName, c.tcpPort, c.Pid())
 			return
@@ -119,6 +153,21 @@ func (c *Consumer) doLastSeqNoCheckpoint() {
 func (c *Consumer) updateCheckpointInfo(vbKey string, vb uint16, vbBlob *vbucketKVBlob) error {
 	logPrefix := "Consumer::updateCheckpointInfo"
 
+	c.fillCheckpointInfo(vb, vbBlob)
+
+	err := util.Retry(util.NewFixedBackoff(bucketOpRetryInterval), c.retryCount, periodicCheckpointCallback,
+		c, c.producer.AddMetadataPrefix(vbKey), vbBlob)
+	if err == common.ErrRetryTimeout {
+		logging.Errorf("%s [%s:%s:%d] Exiting due to timeout", logPrefix, c.workerName, c.tcpPort, c.Pid())
+		return err
+	}
+
+	atomic.AddUint64(&c.checkpointsWritten, 1)
+	return nil
+}
+
+// fillCheckpointInfo populates checkpoint blob from vb stats of owned vbucket
+func (c *Consumer) fillCheckpointInfo(vb uint16, vbBlob *vbucketKVBlob) {
 	c.updateBackupVbStats(vb)
 	vbBlob.AssignedWorker = c.ConsumerName()
 	vbBlob.CurrentVBOwner = c.HostPortAddr()
@@ -136,27 +185,37 @@ func (c *Consumer) updateCheckpointInfo(vbKey string, vb uint16, vbBlob *vbucket
 	vbBlob.NextCronTimerToProcess = c.vbProcessingStats.getVbStat(vb, "next_cron_timer_to_process").(string)
 	vbBlob.VBuuid = c.vbProcessingStats.getVbStat(vb, "vb_uuid").(uint64)
 	vbBlob.ManifestUID = c.vbProcessingStats.getVbStat(vb, "manifest_id").(string)
+}
 
-	err := util.Retry(util.NewFixedBackoff(bucketOpRetryInterval), c.retryCount, periodicCheckpointCallback,
-		c, c.producer.AddMetadataPrefix(vbKey), vbBlob)
-	if err == common.ErrRetryTimeout {
-		logging.Errorf("%s [%s:%s:%d] Exiting due to timeout", logPrefix, c.workerName, c.tcpPort, c.Pid())
-		return err
+// isVbIdle tells if checkpoint write of vb can be skipped, as neither processed seqno
+// nor timer progress changed since its last write. Idle vbs are still checkpointed
+// every so often, at intervals growing while they stay idle
+func (c *Consumer) isVbIdle(vbno uint16, state *vbCheckpointState) bool {
+	currentTime := time.Now()
+	changed := c.isCheckpointStale(vbno)
+	if !state.lastWrite.IsZero() && !changed &&
+		currentTime.Sub(state.lastWrite) < c.idleCheckpointInterval<<state.idleWrites {
+		atomic.AddUint64(&c.checkpointsSkipped, 1)
+		return true
 	}
 
-	return nil
+	if changed {
+		state.idleWrites = 0
+	} else if state.idleWrites < maxIdleCheckpointBackoff {
+		state.idleWrites++
+	}
+	state.lastWrite = currentTime
+	return false
 }
 
-func (c *Consumer) isVbIdle(vbno uint16, checkpointTime *time.Time) bool {
-	currentTime := time.Now()
-	if checkpointTime.IsZero() == false &&
-		currentTime.Sub(*checkpointTime) < c.idleCheckpointInterval &&
-		c.backupVbStats.getVbStat(vbno, "last_processed_seq_no").(uint64) == c.vbProcessingStats.getVbStat(vbno, "last_processed_seq_no").(uint64) &&
-		c.backupVbStats.getVbStat(vbno, "last_doc_timer_feedback_seqno").(uint64) == c.vbProcessingStats.getVbStat(vbno, "last_doc_timer_feedback_seqno").(uint64) &&
-		c.backupVbStats.getVbStat(vbno, "sent_to_worker_counter").(uint64) == c.vbProcessingStats.getVbStat(vbno, "sent_to_worker_counter").(uint64) {
-		return true
+// isCheckpointStale compares vb stats against those as of last checkpoint write
+func (c *Consumer) isCheckpointStale(vbno uint16) bool {
+	for _, stat := range []string{"last_processed_seq_no", "last_doc_timer_feedback_seqno",
+		"sent_to_worker_counter", "processed_crontimer_counter"} {
+		if c.backupVbStats.getVbStat(vbno, stat).(uint64) != c.vbProcessingStats.getVbStat(vbno, stat).(uint64) {
+			return true
+		}
 	}
-	*checkpointTime = currentTime
 	return false
 }
 
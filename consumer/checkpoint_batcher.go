@@ -0,0 +1,254 @@
+package consumer
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/couchbase/eventing/common"
+	"github.com/couchbase/eventing/logging"
+	"github.com/couchbase/eventing/util"
+	"github.com/couchbase/gocb/v2"
+)
+
+type pendingCheckpoint struct {
+	vbKey  common.Key
+	vbBlob *vbucketKVBlob
+	cas    gocb.Cas // CAS of blob as of the bulk get, write fails if it changed since
+}
+
+// checkpointBatcher coalesces checkpoint writes across vbuckets, so that they get
+// flushed to metadata bucket together once every checkpointBatchInterval. Multiple
+// checkpoints of a vbucket within the interval are collapsed into the latest one
+type checkpointBatcher struct {
+	sync.Mutex
+	pending map[uint16]*pendingCheckpoint
+
+	bulkGetCounter     uint64
+	casMismatchCounter uint64
+	coalescedCounter   uint64
+	discardedCounter   uint64
+	flushCounter       uint64
+	writeCounter       uint64
+}
+
+func newCheckpointBatcher() *checkpointBatcher {
+	return &checkpointBatcher{
+		pending: make(map[uint16]*pendingCheckpoint),
+	}
+}
+
+func (b *checkpointBatcher) enqueue(vb uint16, vbKey common.Key, vbBlob *vbucketKVBlob, cas gocb.Cas) {
+	b.Lock()
+	defer b.Unlock()
+
+	if _, ok := b.pending[vb]; ok {
+		b.coalescedCounter++
+	}
+	b.pending[vb] = &pendingCheckpoint{vbKey: vbKey, vbBlob: vbBlob, cas: cas}
+}
+
+// discard drops queued checkpoint of a vbucket whose ownership is being given up,
+// a later flush would otherwise overwrite metadata of its new owner
+func (b *checkpointBatcher) discard(vb uint16) {
+	b.Lock()
+	defer b.Unlock()
+
+	if _, ok := b.pending[vb]; ok {
+		delete(b.pending, vb)
+		b.discardedCounter++
+	}
+}
+
+func (b *checkpointBatcher) drain() map[uint16]*pendingCheckpoint {
+	b.Lock()
+	defer b.Unlock()
+
+	batch := b.pending
+	b.pending = make(map[uint16]*pendingCheckpoint)
+	if len(batch) > 0 {
+		b.flushCounter++
+	}
+	return batch
+}
+
+func (b *checkpointBatcher) stats() map[string]uint64 {
+	b.Lock()
+	defer b.Unlock()
+
+	stats := make(map[string]uint64)
+	if b.flushCounter > 0 {
+		stats["checkpoint_batch_bulk_get_counter"] = b.bulkGetCounter
+		stats["checkpoint_batch_cas_mismatch_counter"] = b.casMismatchCounter
+		stats["checkpoint_batch_coalesced_counter"] = b.coalescedCounter
+		stats["checkpoint_batch_discarded_counter"] = b.discardedCounter
+		stats["checkpoint_batch_flush_counter"] = b.flushCounter
+		stats["checkpoint_batch_write_counter"] = b.writeCounter
+	}
+	return stats
+}
+
+func (c *Consumer) runCheckpointBatcher() {
+	logPrefix := "Consumer::runCheckpointBatcher"
+
+	flushTicker := time.NewTicker(c.checkpointBatchInterval)
+	defer flushTicker.Stop()
+
+	logging.Infof("%s [%s:%s:%d] Flushing checkpoints every %v",
+		logPrefix, c.workerName, c.tcpPort, c.Pid(), c.checkpointBatchInterval)
+
+	for {
+		select {
+		case <-flushTicker.C:
+			c.flushCheckpointBatch()
+
+		case <-c.ctx.Done():
+			logging.Infof("%s [%s:%s:%d] Exited checkpoint batcher routine",
+				logPrefix, c.workerName, c.tcpPort, c.Pid())
+			return
+		}
+	}
+}
+
+func (c *Consumer) flushCheckpointBatch() {
+	logPrefix := "Consumer::flushCheckpointBatch"
+
+	batch := c.checkpointBatcher.drain()
+	if len(batch) == 0 {
+		return
+	}
+
+	// Ownership given up while fenced mustn't be reclaimed by checkpointing
+	if c.isFenced() {
+		logging.Infof("%s [%s:%s:%d] Dropping %d checkpoints as consumer is fenced",
+			logPrefix, c.workerName, c.tcpPort, c.Pid(), len(batch))
+		return
+	}
+
+	start := time.Now()
+
+	// Ownership could have moved on since the checkpoint got queued
+	var discarded uint64
+	for vb := range batch {
+		if !c.ownsVbCheckpoint(vb) {
+			logging.Infof("%s [%s:%s:%d] vb: %d Dropping checkpoint as vb is no longer owned",
+				logPrefix, c.workerName, c.tcpPort, c.Pid(), vb)
+			delete(batch, vb)
+			discarded++
+		}
+	}
+
+	var written, casMismatches uint64
+	err := util.Retry(util.NewFixedBackoff(bucketOpRetryInterval), c.retryCount, bulkCheckpointCallback,
+		c, batch, &written, &casMismatches)
+	if err == common.ErrRetryTimeout {
+		logging.Errorf("%s [%s:%s:%d] Exiting due to timeout, %d checkpoints not written",
+			logPrefix, c.workerName, c.tcpPort, c.Pid(), len(batch))
+	}
+
+	c.checkpointBatcher.Lock()
+	c.checkpointBatcher.casMismatchCounter += casMismatches
+	c.checkpointBatcher.discardedCounter += discarded
+	c.checkpointBatcher.writeCounter += written
+	c.checkpointBatcher.Unlock()
+
+	logging.AppDebugf(c.app.AppName, "%s [%s:%s:%d] Flushed %d checkpoints in %v",
+		logPrefix, c.workerName, c.tcpPort, c.Pid(), written, time.Since(start))
+}
+
+// ownsVbCheckpoint reports if checkpoint of vb is to be written by the consumer
+func (c *Consumer) ownsVbCheckpoint(vb uint16) bool {
+	if c.ConsumerName() != c.vbProcessingStats.getVbStat(vb, "assigned_worker") ||
+		c.NodeUUID() != c.vbProcessingStats.getVbStat(vb, "node_uuid") {
+		return false
+	}
+
+	// Checkpoint of a vb being handed over belongs to its new owner
+	return !c.vbHandovers.lingering(vb)
+}
+
+// doBatchedCheckpoint fetches checkpoint blobs of owned vbuckets in bulk and hands
+// over steady state checkpoints to the batcher. Missing blobs are recreated inline
+func (c *Consumer) doBatchedCheckpoint(vbs []uint16, checkpoints []vbCheckpointState) error {
+	logPrefix := "Consumer::doBatchedCheckpoint"
+
+	vbKeys := make(map[uint16]common.Key)
+	for _, vb := range vbs {
+		// only checkpoint stats for vbuckets that the consumer instance owns
+		if !c.ownsVbCheckpoint(vb) {
+			continue
+		}
+
+		if c.isVbIdle(vb, &checkpoints[vb]) {
+			continue
+		}
+
+		vbKeys[vb] = c.producer.AddMetadataPrefix(common.CheckpointBlobKey(c.app.AppName, vb))
+	}
+
+	if len(vbKeys) == 0 {
+		return nil
+	}
+
+	vbBlobs := make(map[uint16]*vbucketKVBlob)
+	vbsNoEnt := make(map[uint16]bool)
+	vbsCas := make(map[uint16]gocb.Cas)
+
+	err := util.Retry(util.NewFixedBackoff(bucketOpRetryInterval), c.retryCount, getMultiOpCallback,
+		c, vbKeys, vbBlobs, vbsNoEnt, vbsCas)
+	if err == common.ErrRetryTimeout {
+		logging.Errorf("%s [%s:%s:%d] Exiting due to timeout", logPrefix, c.workerName, c.tcpPort, c.Pid())
+		return err
+	}
+
+	c.checkpointBatcher.Lock()
+	c.checkpointBatcher.bulkGetCounter++
+	c.checkpointBatcher.Unlock()
+
+	for _, vb := range vbs {
+		vbKey, ok := vbKeys[vb]
+		if !ok {
+			continue
+		}
+
+		if vbsNoEnt[vb] {
+			logging.Infof("%s [%s:%s:%d] vb: %d Creating the initial metadata blob entry",
+				logPrefix, c.workerName, c.tcpPort, c.Pid(), vb)
+
+			var vbBlob vbucketKVBlob
+			err = util.Retry(util.NewFixedBackoff(bucketOpRetryInterval), c.retryCount, recreateCheckpointBlobsFromVbStatsCallback,
+				c, vbKey, &vbBlob)
+			if err == common.ErrRetryTimeout {
+				logging.Errorf("%s [%s:%s:%d] Exiting due to timeout", logPrefix, c.workerName, c.tcpPort, c.Pid())
+				return err
+			}
+
+			err = c.updateCheckpointInfo(common.CheckpointBlobKey(c.app.AppName, vb), vb, &vbBlob)
+			if err == common.ErrRetryTimeout {
+				logging.Errorf("%s [%s:%s:%d] Exiting due to timeout", logPrefix, c.workerName, c.tcpPort, c.Pid())
+				return err
+			}
+			continue
+		}
+
+		vbBlob, ok := vbBlobs[vb]
+		if !ok {
+			continue
+		}
+
+		cas := c.migrateCheckpointBlob(vbKey, vb, vbBlob, vbsCas[vb])
+
+		// Steady state cluster, or race between previous owner(another eventing node)
+		// and new owner(current node)
+		if (c.NodeUUID() == vbBlob.NodeUUID && vbBlob.DCPStreamStatus == dcpStreamRunning) ||
+			(vbBlob.CurrentVBOwner == "" && c.checkIfCurrentNodeShouldOwnVb(vb) &&
+				c.checkIfCurrentConsumerShouldOwnVb(vb) && vbBlob.DCPStreamStatus == dcpStreamStopped) {
+
+			c.fillCheckpointInfo(vb, vbBlob)
+			c.checkpointBatcher.enqueue(vb, vbKey, vbBlob, cas)
+			atomic.AddUint64(&c.checkpointsWritten, 1)
+		}
+	}
+
+	return nil
+}
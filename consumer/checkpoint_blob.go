@@ -0,0 +1,179 @@
+package consumer
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+
+	"github.com/couchbase/eventing/common"
+	"github.com/couchbase/eventing/logging"
+	"github.com/couchbase/eventing/util"
+	"github.com/couchbase/gocb/v2"
+	"github.com/couchbase/gocbcore/v9"
+	"github.com/golang/snappy"
+)
+
+const (
+	// Schema version of checkpoint blobs written by this consumer
+	// v1: all fields in plain JSON, blobs predating versioning carry no schema_version
+	// v2: ownership history beyond ownershipHistoryRetained entries archived with snappy
+	checkpointBlobSchemaVersion = 2
+
+	// Ownership history entries kept as plain JSON, as they are appended to by subdoc ops
+	ownershipHistoryRetained = 16
+)
+
+var errCheckpointBlobNewerSchema = errors.New("checkpoint blob written with newer schema")
+
+func newVbucketKVBlobVer(vbBlob vbucketKVBlob) vbucketKVBlobVer {
+	vbBlob.SchemaVersion = checkpointBlobSchemaVersion
+	return vbucketKVBlobVer{
+		vbBlob,
+		util.EventingVer(),
+	}
+}
+
+func compressOwnershipHistory(entries []OwnershipEntry) (string, error) {
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(snappy.Encode(nil, data)), nil
+}
+
+func decompressOwnershipHistory(archive string) ([]OwnershipEntry, error) {
+	if archive == "" {
+		return nil, nil
+	}
+
+	compressed, err := base64.StdEncoding.DecodeString(archive)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := snappy.Decode(nil, compressed)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []OwnershipEntry
+	err = json.Unmarshal(data, &entries)
+	return entries, err
+}
+
+// fullOwnershipHistory returns archived ownership history followed by recent entries
+func (vbBlob *vbucketKVBlob) fullOwnershipHistory() ([]OwnershipEntry, error) {
+	archived, err := decompressOwnershipHistory(vbBlob.OwnershipHistoryArchive)
+	if err != nil {
+		return nil, err
+	}
+	return append(archived, vbBlob.OwnershipHistory...), nil
+}
+
+// migrate upgrades checkpoint blob to current schema and archives ownership history
+// that has grown beyond twice of ownershipHistoryRetained. Returns whether blob changed
+func (vbBlob *vbucketKVBlob) migrate() (bool, error) {
+	if vbBlob.SchemaVersion > checkpointBlobSchemaVersion {
+		return false, errCheckpointBlobNewerSchema
+	}
+
+	if vbBlob.SchemaVersion == checkpointBlobSchemaVersion &&
+		len(vbBlob.OwnershipHistory) <= 2*ownershipHistoryRetained {
+		return false, nil
+	}
+
+	if len(vbBlob.OwnershipHistory) > ownershipHistoryRetained {
+		history, err := vbBlob.fullOwnershipHistory()
+		if err != nil {
+			return false, err
+		}
+
+		archive, err := compressOwnershipHistory(history[:len(history)-ownershipHistoryRetained])
+		if err != nil {
+			return false, err
+		}
+
+		vbBlob.OwnershipHistoryArchive = archive
+		vbBlob.OwnershipHistory = history[len(history)-ownershipHistoryRetained:]
+	}
+
+	vbBlob.SchemaVersion = checkpointBlobSchemaVersion
+	return true, nil
+}
+
+// migrateCheckpointBlob rewrites blob read with given cas as per current schema. Blobs
+// written by newer consumers are left untouched, so that mixed mode clusters don't
+// lose fields they don't understand. Returns cas of the blob post migration
+func (c *Consumer) migrateCheckpointBlob(vbKey common.Key, vb uint16, vbBlob *vbucketKVBlob, cas gocb.Cas) gocb.Cas {
+	logPrefix := "Consumer::migrateCheckpointBlob"
+
+	fromVersion := vbBlob.SchemaVersion
+	changed, err := vbBlob.migrate()
+	if err == errCheckpointBlobNewerSchema {
+		logging.AppDebugf(c.app.AppName, "%s [%s:%s:%d] vb: %d Skipping migration of checkpoint blob with schema version: %d",
+			logPrefix, c.workerName, c.tcpPort, c.Pid(), vb, fromVersion)
+		return cas
+	}
+	if err != nil {
+		logging.Errorf("%s [%s:%s:%d] vb: %d Failed to migrate checkpoint blob, err: %v",
+			logPrefix, c.workerName, c.tcpPort, c.Pid(), vb, err)
+		return cas
+	}
+	if !changed {
+		return cas
+	}
+
+	var migrated bool
+	migratedCas := cas
+	err = util.Retry(util.NewFixedBackoff(bucketOpRetryInterval), c.retryCount, migrateCheckpointBlobCallback,
+		c, vbKey, vbBlob, cas, &migrated, &migratedCas)
+	if err == common.ErrRetryTimeout {
+		logging.Errorf("%s [%s:%s:%d] Exiting due to timeout", logPrefix, c.workerName, c.tcpPort, c.Pid())
+		return cas
+	}
+
+	if migrated {
+		logging.Infof("%s [%s:%s:%d] vb: %d Migrated checkpoint blob from schema version: %d to: %d, ownership history entries retained: %d",
+			logPrefix, c.workerName, c.tcpPort, c.Pid(), vb, fromVersion, vbBlob.SchemaVersion, len(vbBlob.OwnershipHistory))
+	}
+	return migratedCas
+}
+
+var migrateCheckpointBlobCallback = util.InstrumentOp("consumer.migrate_checkpoint_blob", func(args ...interface{}) error {
+	logPrefix := "Consumer::migrateCheckpointBlobCallback"
+
+	c := args[0].(*Consumer)
+	vbKey := args[1].(common.Key)
+	vbBlob := args[2].(*vbucketKVBlob)
+	cas := args[3].(gocb.Cas)
+	migrated := args[4].(*bool)
+	migratedCas := args[5].(*gocb.Cas)
+
+	upsertOptions := &gocb.UpsertSpecOptions{CreatePath: true}
+
+	mutateIn := make([]gocb.MutateInSpec, 0)
+	mutateIn = append(mutateIn, gocb.UpsertSpec("schema_version", vbBlob.SchemaVersion, upsertOptions))
+	mutateIn = append(mutateIn, gocb.UpsertSpec("ownership_history", vbBlob.OwnershipHistory, upsertOptions))
+	mutateIn = append(mutateIn, gocb.UpsertSpec("ownership_history_archive", vbBlob.OwnershipHistoryArchive, upsertOptions))
+
+	c.gocbMetaHandleMutex.RLock()
+	defer c.gocbMetaHandleMutex.RUnlock()
+
+	// Cas guards against ownership history appended post read, migration is retried
+	// on next read of the blob
+	result, err := c.metaMutateIn(vbKey.Raw(), mutateIn, &gocb.MutateInOptions{Cas: cas})
+	if errors.Is(err, gocb.ErrCasMismatch) || errors.Is(err, gocb.ErrDocumentNotFound) ||
+		errors.Is(err, gocbcore.ErrShutdown) || errors.Is(err, gocbcore.ErrCollectionsUnsupported) {
+		return nil
+	}
+
+	if err != nil {
+		logging.Errorf("%s [%s:%s:%d] Key: %ru, subdoc operation failed while migrating checkpoint blob, err: %v",
+			logPrefix, c.workerName, c.tcpPort, c.Pid(), vbKey.Raw(), err)
+		return err
+	}
+
+	*migrated = true
+	*migratedCas = result.Cas()
+	return nil
+})
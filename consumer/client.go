@@ -106,7 +106,9 @@ func (c *client) Serve() {
 					logPrefix, c.workerName, c.tcpPort, c.osPid, err)
 				return
 			}
-			logging.Infof("eventing-consumer [%s:%s:%d] %s", c.workerName, c.tcpPort, c.osPid, string(msg))
+			line := c.consumerHandle.app.SourceMap.Symbolicate(string(msg))
+			c.consumerHandle.workerStderr.add(line)
+			logging.Infof("eventing-consumer [%s:%s:%d] %s", c.workerName, c.tcpPort, c.osPid, line)
 		}
 	}(bufErr)
 
@@ -119,7 +121,7 @@ func (c *client) Serve() {
 					logPrefix, c.workerName, c.tcpPort, c.osPid, err)
 				return
 			}
-			c.consumerHandle.producer.WriteAppLog(string(msg))
+			c.consumerHandle.producer.WriteAppLog(c.consumerHandle.app.SourceMap.Symbolicate(string(msg)))
 		}
 	}(bufOut)
 
@@ -128,6 +130,10 @@ func (c *client) Serve() {
 		logging.Warnf("%s [%s:%s:%d] Exiting c++ worker with error: %v",
 			logPrefix, c.workerName, c.tcpPort, c.osPid, err)
 	}
+	if state := c.cmd.ProcessState; state != nil {
+		c.consumerHandle.workerExitStatus = state.String()
+		c.consumerHandle.workerExitCode = state.ExitCode()
+	}
 	c.consumerHandle.workerExited = true
 
 	c.consumerHandle.connMutex.Lock()
@@ -147,7 +153,7 @@ func (c *client) Serve() {
 		logging.Infof("%s [%s:%s:%d] Informing Eventing.Producer to stop Eventing.Consumer instance: %v",
 			logPrefix, c.workerName, c.tcpPort, c.osPid, c.consumerHandle)
 
-		c.consumerHandle.producer.KillAndRespawnEventingConsumer(c.consumerHandle)
+		c.consumerHandle.respawnWorker(fmt.Sprintf("worker exited, err: %v", err))
 		c.stopCalled = true
 	}
 }
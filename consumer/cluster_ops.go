@@ -9,7 +9,7 @@ import (
 	"github.com/couchbase/eventing/util"
 )
 
-var getEventingNodeAddrOpCallback = func(args ...interface{}) error {
+var getEventingNodeAddrOpCallback = util.InstrumentOp("consumer.get_eventing_node_addr_op", func(args ...interface{}) error {
 	logPrefix := "Consumer::getEventingNodeAddrOpCallback"
 
 	c := args[0].(*Consumer)
@@ -30,7 +30,7 @@ var getEventingNodeAddrOpCallback = func(args ...interface{}) error {
 	}
 
 	return err
-}
+})
 
 var getKvVbMap = func(args ...interface{}) error {
 	logPrefix := "Consumer::getKvVbMap"
@@ -0,0 +1,43 @@
+package consumer
+
+import (
+	"github.com/couchbase/eventing/logging"
+)
+
+// applyCollectionFilter restricts DCP streams to source collections when function
+// listens to more than one collection of source scope, so that KV doesn't send
+// mutations of other collections only for them to be dropped by filterMutations.
+// Streams of functions listening to a single collection aren't filtered by KV
+func (c *Consumer) applyCollectionFilter() {
+	logPrefix := "Consumer::applyCollectionFilter"
+
+	if len(c.srcCids) == 0 {
+		c.srcCids = map[uint32]string{c.srcCid: c.sourceKeyspace.CollectionName}
+	}
+
+	if len(c.srcCids) == 1 {
+		return
+	}
+
+	if collectionAware, ok := c.dcpConfig["collectionAware"].(bool); !ok || !collectionAware {
+		logging.Warnf("%s [%s:%s:%d] KV nodes don't support collections, streams won't be filtered by collection",
+			logPrefix, c.workerName, c.tcpPort, c.Pid())
+		return
+	}
+
+	cids := make([]uint32, 0, len(c.srcCids))
+	for cid := range c.srcCids {
+		cids = append(cids, cid)
+	}
+
+	// Config is shared with producer, so it's replaced rather than updated in place
+	dcpConfig := make(map[string]interface{}, len(c.dcpConfig)+1)
+	for k, v := range c.dcpConfig {
+		dcpConfig[k] = v
+	}
+	dcpConfig["collectionFilter"] = cids
+	c.dcpConfig = dcpConfig
+
+	logging.Infof("%s [%s:%s:%d] Streams restricted to collections: %v",
+		logPrefix, c.workerName, c.tcpPort, c.Pid(), c.srcCids)
+}
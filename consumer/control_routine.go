@@ -1,8 +1,6 @@
 package consumer
 
 import (
-	"encoding/json"
-	"fmt"
 	"sort"
 	"time"
 
@@ -32,17 +30,15 @@ func (c *Consumer) controlRoutine() error {
 				c.PauseConsumer()
 			}
 
-			c.CloseAllRunningDcpFeeds()
+			if !c.lingerVbsToGiveUp() {
+				c.CloseAllRunningDcpFeeds()
+			}
 
-			c.stopVbOwnerTakeoverCh = make(chan struct{})
+			c.rebalanceContext()
 
 			logging.Infof("%s [%s:%s:%d] Got notification that cluster state has changed",
 				logPrefix, c.workerName, c.tcpPort, c.Pid())
 
-			c.vbsStreamClosedRWMutex.Lock()
-			c.vbsStreamClosed = make(map[uint16]bool)
-			c.vbsStreamClosedRWMutex.Unlock()
-
 			if !c.vbsStateUpdateRunning {
 				logging.Infof("%s [%s:%s:%d] Kicking off vbsStateUpdate routine, isRebalanceOngoing %t",
 					logPrefix, c.workerName, c.tcpPort, c.Pid(), c.isRebalanceOngoing)
@@ -54,25 +50,16 @@ func (c *Consumer) controlRoutine() error {
 			logging.Infof("%s [%s:%s:%d] Got notification for settings change",
 				logPrefix, c.workerName, c.tcpPort, c.Pid())
 
-			settingsPath := metakvAppSettingsPath + c.app.AppName
-			sData, err := util.MetakvGet(settingsPath)
-			if err != nil {
-				logging.Errorf("%s [%s:%s:%d] Failed to fetch updated settings from metakv, err: %v",
-					logPrefix, c.workerName, c.tcpPort, c.Pid(), err)
-				continue
-			}
-
-			settings := make(map[string]interface{})
-			err = json.Unmarshal(sData, &settings)
+			settings, _, err := c.superSup.GetAppSettings(c.app.AppName)
 			if err != nil {
-				logging.Errorf("%s [%s:%s:%d] Failed to unmarshal settings received from metakv, err: %ru",
+				logging.Errorf("%s [%s:%s:%d] Failed to fetch updated settings, err: %v",
 					logPrefix, c.workerName, c.tcpPort, c.Pid(), err)
 				continue
 			}
 
-			if val, ok := settings["log_level"]; ok {
+			// Log level of the function on Go side is owned by producer
+			if val, ok := settings["log_level"]; ok && val.(string) != c.logLevel {
 				c.logLevel = val.(string)
-				logging.SetLogLevel(util.GetLogLevel(c.logLevel))
 				c.sendLogLevel(c.logLevel, false)
 			}
 
@@ -81,6 +68,48 @@ func (c *Consumer) controlRoutine() error {
 				c.sendTimerContextSize(c.timerContextSize, false)
 			}
 
+			if val, ok := settings["execution_timeout"]; ok && int(val.(float64)) != c.executionTimeout {
+				c.executionTimeout = int(val.(float64))
+				c.sendExecutionTimeout(c.executionTimeout)
+			}
+
+			if val, ok := settings["sock_batch_size"]; ok && int(val.(float64)) != c.socketWriteBatchSize {
+				c.socketWriteBatchSize = int(val.(float64))
+				c.sendSocketBatchSize(c.socketWriteBatchSize)
+			}
+
+			lanesChanged := false
+			if val, ok := settings["timer_lane_batch_size"]; ok && int(val.(float64)) != c.timerLaneBatchSize {
+				c.timerLaneBatchSize = int(val.(float64))
+				lanesChanged = true
+			}
+			if val, ok := settings["dcp_lane_batch_size"]; ok && int(val.(float64)) != c.dcpLaneBatchSize {
+				c.dcpLaneBatchSize = int(val.(float64))
+				lanesChanged = true
+			}
+			if lanesChanged {
+				c.sendDispatchLanes(c.timerLaneBatchSize, c.dcpLaneBatchSize)
+			}
+
+			retryChanged := false
+			if val, ok := settings["retry_count"]; ok && int(val.(float64)) != c.handlerRetryCount {
+				c.handlerRetryCount = int(val.(float64))
+				retryChanged = true
+			}
+			if val, ok := settings["retry_backoff"]; ok && int(val.(float64)) != c.handlerRetryBackoff {
+				c.handlerRetryBackoff = int(val.(float64))
+				retryChanged = true
+			}
+			if val, ok := settings["retry_on"]; ok {
+				if retryOn := util.ToStringArray(val); retryOnMask(retryOn) != retryOnMask(c.handlerRetryOn) {
+					c.handlerRetryOn = retryOn
+					retryChanged = true
+				}
+			}
+			if retryChanged {
+				c.sendRetryPolicy()
+			}
+
 			if val, ok := settings["vb_ownership_giveup_routine_count"]; ok {
 				c.vbOwnershipGiveUpRoutineCount = int(val.(float64))
 			}
@@ -89,6 +118,56 @@ func (c *Consumer) controlRoutine() error {
 				c.vbOwnershipTakeoverRoutineCount = int(val.(float64))
 			}
 
+			if val, ok := settings["auto_tune_vb_takeover_routines"]; ok {
+				c.autoTuneVbTakeoverRoutines = val.(bool)
+			}
+
+			if val, ok := settings["vb_takeover_routine_min_count"]; ok {
+				c.vbTakeoverRoutineMinCount = int(val.(float64))
+			}
+
+			if val, ok := settings["vb_takeover_routine_max_count"]; ok {
+				c.vbTakeoverRoutineMaxCount = int(val.(float64))
+			}
+
+			if val, ok := settings["vb_takeover_deadline"]; ok {
+				c.vbTakeoverDeadline = time.Duration(val.(float64)) * time.Second
+			}
+
+			if val, ok := settings["vb_force_takeover"]; ok {
+				c.forceVbTakeover = val.(bool)
+			}
+
+			if val, ok := settings["vb_handover_linger_timeout"]; ok {
+				c.vbHandoverLingerTimeout = time.Duration(val.(float64)) * time.Second
+			}
+
+			if val, ok := settings["worker_rss_limit"]; ok {
+				c.workerRSSLimit = int64(val.(float64)) * 1024 * 1024
+			}
+
+			if val, ok := settings["worker_cpu_limit"]; ok {
+				c.workerCPULimit = int(val.(float64))
+			}
+
+			if val, ok := settings["timer_integrity_check"]; ok {
+				c.timerIntegrityCheck = val.(string)
+			}
+
+			if val, ok := settings["include_xattrs"]; ok {
+				c.includeXattrs = val.(bool)
+			}
+
+			if val, ok := settings["skip_binary_docs"]; ok {
+				c.skipBinaryDocs = val.(bool)
+				c.binaryDocAllowed = c.checkBinaryDocAllowed()
+			}
+
+			c.applyDcpFlowControl(settings)
+
+		case <-c.heartbeatTicker.C:
+			c.sendHeartbeat()
+
 		case <-c.restartVbDcpStreamTicker.C:
 
 		retryVbsRemainingToRestream:
@@ -107,6 +186,11 @@ func (c *Consumer) controlRoutine() error {
 				continue
 			}
 
+			// Metadata updates are bound to fail while fenced, vbs are picked up post unfence
+			if c.isFenced() {
+				continue
+			}
+
 			// Verify if the app is deployed or not before trying to reopen vbucket DCP streams
 			// for the ones which recently have returned STREAMEND. QE frequently does flush
 			// on source bucket right after undeploy
@@ -174,10 +258,14 @@ func (c *Consumer) controlRoutine() error {
 				}
 
 				logging.Infof("%s [%s:%s:%d] vb: %d Issuing dcp close stream", logPrefix, c.workerName, c.tcpPort, c.Pid(), vb)
+				c.checkpointBatcher.discard(vb)
 				c.dcpCloseStreamCounter++
-				c.RLock()
-				err := c.vbDcpFeedMap[vb].DcpCloseStream(vb, vb)
-				c.RUnlock()
+				var err error
+				if feed, ok := c.vbDcpFeeds.get(vb); ok {
+					err = feed.DcpCloseStream(vb, vb)
+				} else {
+					err = errVbDcpFeedMissing
+				}
 				if err != nil {
 					c.dcpCloseStreamErrCounter++
 					logging.Errorf("%s [%s:%s:%d] vb: %v Failed to close dcp stream, err: %v",
@@ -192,7 +280,7 @@ func (c *Consumer) controlRoutine() error {
 				c.vbProcessingStats.updateVbStat(vb, "timestamp", time.Now().Format(time.RFC3339))
 
 				var vbBlob vbucketKVBlob
-				vbKey := fmt.Sprintf("%s::vb::%d", c.app.AppName, vb)
+				vbKey := common.CheckpointBlobKey(c.app.AppName, vb)
 
 				err = c.updateCheckpoint(vbKey, vb, &vbBlob)
 				if err == common.ErrRetryTimeout {
@@ -205,7 +293,7 @@ func (c *Consumer) controlRoutine() error {
 			logging.Infof("%s [%s:%s:%d] vbsToRestream len: %d dump: %v",
 				logPrefix, c.workerName, c.tcpPort, c.Pid(), len(vbsToRestream), util.Condense(vbsToRestream))
 
-			var vbsFailedToStartStream []uint16
+			var vbsFailedToStartStream, vbsDeferred []uint16
 
 			for _, vb := range vbsToRestream {
 				if c.checkIfVbAlreadyOwnedByCurrConsumer(vb) {
@@ -221,10 +309,21 @@ func (c *Consumer) controlRoutine() error {
 					continue
 				}
 
+				// Paused vbs get queued up again when they're resumed
+				if c.isVbPaused(vb) {
+					continue
+				}
+
+				if !c.streamReqTracker.allow(vb) {
+					vbsFailedToStartStream = append(vbsFailedToStartStream, vb)
+					vbsDeferred = append(vbsDeferred, vb)
+					continue
+				}
+
 				var vbBlob vbucketKVBlob
 				var cas gocb.Cas
 				var isNoEnt bool
-				vbKey := fmt.Sprintf("%s::vb::%d", c.app.AppName, vb)
+				vbKey := common.CheckpointBlobKey(c.app.AppName, vb)
 
 				logging.Infof("%s [%s:%s:%d] vb: %v, reclaiming it back by restarting dcp stream",
 					logPrefix, c.workerName, c.tcpPort, c.Pid(), vb)
@@ -235,7 +334,7 @@ func (c *Consumer) controlRoutine() error {
 					return err
 				}
 
-				err = c.updateVbOwnerAndStartDCPStream(vbKey, vb, &vbBlob)
+				err = c.updateVbOwnerAndStartDCPStream(c.ctx, vbKey, vb, &vbBlob)
 				if err == common.ErrRetryTimeout {
 					logging.Errorf("%s [%s:%s:%d] Exiting due to timeout", logPrefix, c.workerName, c.tcpPort, c.Pid())
 					return err
@@ -260,13 +359,14 @@ func (c *Consumer) controlRoutine() error {
 
 			sort.Sort(util.Uint16Slice(diff))
 
-			if vbsRemainingToRestream > 0 {
+			// Vbs in backoff are picked up on subsequent ticks
+			if vbsRemainingToRestream > len(vbsDeferred) {
 				logging.Infof("%s [%s:%s:%d] Retrying vbsToRestream, remaining len: %v dump: %v",
 					logPrefix, c.workerName, c.tcpPort, c.Pid(), vbsRemainingToRestream, util.Condense(diff))
 				goto retryVbsRemainingToRestream
 			}
 
-		case <-c.stopConsumerCh:
+		case <-c.ctx.Done():
 			logging.Infof("%s [%s:%s:%d] Exiting control routine", logPrefix, c.workerName, c.tcpPort, c.Pid())
 			return nil
 		}
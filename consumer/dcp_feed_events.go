@@ -0,0 +1,130 @@
+package consumer
+
+import (
+	"sync"
+	"time"
+
+	cm "github.com/couchbase/eventing/common"
+)
+
+const (
+	dcpFeedEventsToRetain = 50
+
+	dcpFeedConnect       = "connect"
+	dcpFeedConnectFailed = "connect_failed"
+	dcpFeedReconnect     = "reconnect"
+	dcpFeedDisconnect    = "disconnect"
+)
+
+// dcpFeedEvents tracks connection lifecycle of DCP feeds per KV node, as KV side
+// disconnects otherwise only show up in debug logs
+type dcpFeedEvents struct {
+	sync.Mutex
+	workerName     string
+	events         []*cm.DcpFeedEvent // Last dcpFeedEventsToRetain events, oldest first
+	shedEvents     bool               // Set under memory pressure, only counters are kept
+	counters       map[string]uint64
+	connectedAt    map[string]time.Time
+	disconnectedAt map[string]time.Time
+}
+
+func newDcpFeedEvents(workerName string) *dcpFeedEvents {
+	return &dcpFeedEvents{
+		workerName:     workerName,
+		events:         make([]*cm.DcpFeedEvent, 0, dcpFeedEventsToRetain),
+		counters:       make(map[string]uint64),
+		connectedAt:    make(map[string]time.Time),
+		disconnectedAt: make(map[string]time.Time),
+	}
+}
+
+func (d *dcpFeedEvents) record(kvNode, event, reason string, duration time.Duration) {
+	d.counters[event]++
+	if d.shedEvents {
+		return
+	}
+
+	d.events = append(d.events, &cm.DcpFeedEvent{
+		Timestamp:  time.Now(),
+		Worker:     d.workerName,
+		KVNode:     kvNode,
+		Event:      event,
+		Reason:     reason,
+		DurationMs: int64(duration / time.Millisecond),
+	})
+	if len(d.events) > dcpFeedEventsToRetain {
+		d.events = d.events[len(d.events)-dcpFeedEventsToRetain:]
+	}
+}
+
+// shed stops retaining events and drops ones retained so far
+func (d *dcpFeedEvents) shed(shed bool) {
+	d.Lock()
+	defer d.Unlock()
+
+	d.shedEvents = shed
+	if shed {
+		d.events = make([]*cm.DcpFeedEvent, 0)
+	}
+}
+
+// connected records connect, or reconnect along with downtime if feed against
+// the KV node had gone down earlier
+func (d *dcpFeedEvents) connected(kvNode string) {
+	d.Lock()
+	defer d.Unlock()
+
+	now := time.Now()
+	if downAt, ok := d.disconnectedAt[kvNode]; ok {
+		d.record(kvNode, dcpFeedReconnect, "", now.Sub(downAt))
+		delete(d.disconnectedAt, kvNode)
+	} else {
+		d.record(kvNode, dcpFeedConnect, "", 0)
+	}
+	d.connectedAt[kvNode] = now
+}
+
+func (d *dcpFeedEvents) connectFailed(kvNode string, err error) {
+	d.Lock()
+	defer d.Unlock()
+
+	d.record(kvNode, dcpFeedConnectFailed, err.Error(), 0)
+}
+
+// disconnected records disconnect along with uptime of the feed. Feeds that are
+// closed on purpose aren't expected to reconnect, so aren't tracked for downtime
+func (d *dcpFeedEvents) disconnected(kvNode, reason string, expected bool) {
+	d.Lock()
+	defer d.Unlock()
+
+	var uptime time.Duration
+	if upAt, ok := d.connectedAt[kvNode]; ok {
+		uptime = time.Since(upAt)
+		delete(d.connectedAt, kvNode)
+	}
+
+	d.record(kvNode, dcpFeedDisconnect, reason, uptime)
+	if !expected {
+		d.disconnectedAt[kvNode] = time.Now()
+	}
+}
+
+func (d *dcpFeedEvents) stats() map[string]uint64 {
+	d.Lock()
+	defer d.Unlock()
+
+	stats := make(map[string]uint64)
+	for event, count := range d.counters {
+		stats["dcp_feed_"+event+"_counter"] = count
+	}
+	return stats
+}
+
+func (d *dcpFeedEvents) lastEvents() []*cm.DcpFeedEvent {
+	d.Lock()
+	defer d.Unlock()
+
+	events := make([]*cm.DcpFeedEvent, len(d.events))
+	copy(events, d.events)
+	return events
+}
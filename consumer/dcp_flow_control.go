@@ -0,0 +1,44 @@
+package consumer
+
+import (
+	"github.com/couchbase/eventing/logging"
+)
+
+// applyDcpFlowControl picks up change in dcp_window_size, dcp_noop_interval and
+// dcp_num_connections. Those are negotiated with KV when a feed is opened, so feeds
+// already open carry on with earlier values until they're reopened on vb takeover
+// or feed restart
+func (c *Consumer) applyDcpFlowControl(settings map[string]interface{}) {
+	logPrefix := "Consumer::applyDcpFlowControl"
+
+	delta := make(map[string]interface{})
+
+	if val, ok := settings["dcp_window_size"]; ok && uint32(val.(float64)) != c.dcpConfig["dcpWindowSize"].(uint32) {
+		delta["dcpWindowSize"] = uint32(val.(float64))
+	}
+
+	if val, ok := settings["dcp_noop_interval"]; ok && int(val.(float64)) != c.dcpConfig["noopInterval"].(int) {
+		delta["noopInterval"] = int(val.(float64))
+	}
+
+	if val, ok := settings["dcp_num_connections"]; ok && int(val.(float64)) != c.dcpConfig["numConnections"].(int) {
+		delta["numConnections"] = int(val.(float64))
+	}
+
+	if len(delta) == 0 {
+		return
+	}
+
+	// Config is shared with feeds being opened, so it's replaced rather than updated in place
+	dcpConfig := make(map[string]interface{}, len(c.dcpConfig))
+	for k, v := range c.dcpConfig {
+		dcpConfig[k] = v
+	}
+	for k, v := range delta {
+		dcpConfig[k] = v
+	}
+	c.dcpConfig = dcpConfig
+
+	logging.Infof("%s [%s:%s:%d] DCP flow control updated: %v, applies to feeds opened from now on",
+		logPrefix, c.workerName, c.tcpPort, c.Pid(), delta)
+}
@@ -0,0 +1,262 @@
+package consumer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/couchbase/eventing/common"
+	"github.com/couchbase/eventing/logging"
+	"github.com/couchbase/eventing/util"
+	"github.com/couchbase/gocb/v2"
+	"github.com/couchbase/gocbcore/v9"
+)
+
+const (
+	// Dead letters waiting to be written to dead letter keyspace, beyond which they're dropped
+	deadLetterQueueCap = 10000
+
+	deadLetterKeyPrefix = "eventing::dlq"
+)
+
+// workerDeadLetter is a mutation the handler kept throwing for, as reported by the worker
+type workerDeadLetter struct {
+	Meta     dcpMetadata `json:"meta"`
+	Event    string      `json:"event"`
+	Value    string      `json:"value"`
+	IsBinary bool        `json:"is_binary"`
+	Error    string      `json:"error"`
+	Attempts int         `json:"attempts"`
+}
+
+// deadLetter is the document written to dead letter keyspace. Value of binary
+// documents is base64 encoded
+type deadLetter struct {
+	Function  string      `json:"function"`
+	Event     string      `json:"event"`
+	Key       string      `json:"key"`
+	Vbucket   uint16      `json:"vb"`
+	SeqNo     uint64      `json:"seq"`
+	Cas       string      `json:"cas"`
+	Value     interface{} `json:"value"`
+	IsBinary  bool        `json:"is_binary"`
+	Error     interface{} `json:"error"`
+	Attempts  int         `json:"attempts"`
+	Timestamp string      `json:"timestamp"`
+}
+
+func (l *deadLetter) docID() string {
+	return fmt.Sprintf("%s::%s::%d::%d", deadLetterKeyPrefix, l.Function, l.Vbucket, l.SeqNo)
+}
+
+// rawJSONOrString retains val as is if it's valid JSON, so that it's queryable
+// from dead letter keyspace
+func rawJSONOrString(val string) interface{} {
+	if json.Valid([]byte(val)) {
+		return json.RawMessage(val)
+	}
+	return val
+}
+
+// deadLetterHolds keeps checkpoint of a vb behind mutations whose dead letter isn't
+// written yet, as worker acks a mutation once it hands the letter over. Letters
+// that couldn't be written hold the checkpoint till vb is streamed again, so that
+// the mutation is replayed instead of being lost
+type deadLetterHolds struct {
+	sync.Mutex
+	seqNos map[uint16][]uint64
+}
+
+func newDeadLetterHolds() *deadLetterHolds {
+	return &deadLetterHolds{seqNos: make(map[uint16][]uint64)}
+}
+
+func (h *deadLetterHolds) hold(vb uint16, seqNo uint64) {
+	h.Lock()
+	defer h.Unlock()
+
+	h.seqNos[vb] = append(h.seqNos[vb], seqNo)
+}
+
+func (h *deadLetterHolds) release(vb uint16, seqNo uint64) {
+	h.Lock()
+	defer h.Unlock()
+
+	seqNos := h.seqNos[vb]
+	for i, held := range seqNos {
+		if held == seqNo {
+			seqNos = append(seqNos[:i], seqNos[i+1:]...)
+			break
+		}
+	}
+
+	if len(seqNos) == 0 {
+		delete(h.seqNos, vb)
+		return
+	}
+	h.seqNos[vb] = seqNos
+}
+
+func (h *deadLetterHolds) reset(vb uint16) {
+	h.Lock()
+	defer h.Unlock()
+
+	delete(h.seqNos, vb)
+}
+
+// limit returns how far checkpoint of a vb can advance towards seqNo
+func (h *deadLetterHolds) limit(vb uint16, seqNo uint64) uint64 {
+	h.Lock()
+	defer h.Unlock()
+
+	for _, held := range h.seqNos[vb] {
+		if held <= seqNo {
+			seqNo = held - 1
+		}
+	}
+	return seqNo
+}
+
+func (c *Consumer) sendDeadLetterRetries() {
+	logPrefix := "Consumer::sendDeadLetterRetries"
+
+	// Worker skips dead lettering altogether unless keyspace is configured
+	retries := -1
+	if c.deadLetterKeyspace != nil {
+		retries = c.deadLetterRetryCount
+	}
+
+	header, hBuilder := c.makeDeadLetterRetriesHeader(strconv.Itoa(retries))
+
+	c.msgProcessedRWMutex.Lock()
+	if _, ok := c.v8WorkerMessagesProcessed["dead_letter_retry_count"]; !ok {
+		c.v8WorkerMessagesProcessed["dead_letter_retry_count"] = 0
+	}
+	c.v8WorkerMessagesProcessed["dead_letter_retry_count"]++
+	c.msgProcessedRWMutex.Unlock()
+
+	m := &msgToTransmit{
+		msg: &message{
+			Header: header,
+		},
+		prioritize:    true,
+		headerBuilder: hBuilder,
+	}
+
+	logging.Infof("%s [%s:%s:%d] Sending dead letter retry count: %d",
+		logPrefix, c.workerName, c.tcpPort, c.Pid(), retries)
+
+	c.sendMessage(m)
+}
+
+func (c *Consumer) enqueueDeadLetter(msg string) {
+	logPrefix := "Consumer::enqueueDeadLetter"
+
+	var wl workerDeadLetter
+	err := json.Unmarshal([]byte(msg), &wl)
+	if err != nil {
+		logging.Errorf("%s [%s:%s:%d] Failed to unmarshal dead letter, msg: %ru err: %v",
+			logPrefix, c.workerName, c.tcpPort, c.Pid(), msg, err)
+		atomic.AddUint64(&c.deadLetterWriteFailure, 1)
+		return
+	}
+
+	letter := &deadLetter{
+		Function:  c.app.AppName,
+		Event:     wl.Event,
+		Key:       wl.Meta.DocID,
+		Vbucket:   wl.Meta.Vbucket,
+		SeqNo:     wl.Meta.SeqNo,
+		Cas:       wl.Meta.Cas,
+		Value:     wl.Value,
+		IsBinary:  wl.IsBinary,
+		Error:     rawJSONOrString(wl.Error),
+		Attempts:  wl.Attempts,
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+	}
+	if !wl.IsBinary {
+		letter.Value = rawJSONOrString(wl.Value)
+	}
+
+	c.deadLetterHolds.hold(letter.Vbucket, letter.SeqNo)
+
+	select {
+	case c.deadLetterCh <- letter:
+	default:
+		logging.Errorf("%s [%s:%s:%d] vb: %d seqNo: %d Dropping dead letter as queue is full, holding checkpoint for replay",
+			logPrefix, c.workerName, c.tcpPort, c.Pid(), letter.Vbucket, letter.SeqNo)
+		atomic.AddUint64(&c.deadLetterWriteFailure, 1)
+	}
+}
+
+var writeDeadLetterCallback = util.InstrumentOp("consumer.write_dead_letter", func(args ...interface{}) error {
+	logPrefix := "Consumer::writeDeadLetterCallback"
+
+	c := args[0].(*Consumer)
+	handle := args[1].(*gocb.Collection)
+	letter := args[2].(*deadLetter)
+
+	if atomic.LoadUint32(&c.isTerminateRunning) == 1 {
+		return nil
+	}
+
+	_, err := handle.Upsert(letter.docID(), letter, &gocb.UpsertOptions{Transcoder: c.deadLetterTranscoder})
+	if errors.Is(err, gocbcore.ErrShutdown) {
+		return nil
+	}
+
+	if err != nil {
+		logging.Errorf("%s [%s:%s:%d] Key: %s Failed to write dead letter, err: %v",
+			logPrefix, c.workerName, c.tcpPort, c.Pid(), letter.docID(), err)
+	}
+	return err
+})
+
+// processDeadLetters writes mutations dead lettered by the worker to configured keyspace
+func (c *Consumer) processDeadLetters() {
+	logPrefix := "Consumer::processDeadLetters"
+
+	if c.deadLetterKeyspace == nil {
+		return
+	}
+
+	ks := c.deadLetterKeyspace
+	var handle *gocb.Collection
+
+	for {
+		select {
+		case letter := <-c.deadLetterCh:
+			if handle == nil {
+				var err error
+				handle, err = c.superSup.GetMetadataHandle(ks.BucketName, ks.ScopeName, ks.CollectionName, c.app.AppName)
+				if err != nil {
+					logging.Errorf("%s [%s:%s:%d] Failed to get handle for dead letter keyspace bucket: %s scope: %s collection: %s, err: %v",
+						logPrefix, c.workerName, c.tcpPort, c.Pid(), ks.BucketName, ks.ScopeName, ks.CollectionName, err)
+					atomic.AddUint64(&c.deadLetterWriteFailure, 1)
+					c.failureDomains.note(common.FailureDomainKV, "dead_letter_write_failure", err)
+					continue
+				}
+			}
+
+			err := util.Retry(util.NewFixedBackoff(bucketOpRetryInterval), c.retryCount, writeDeadLetterCallback, c, handle, letter)
+			if err != nil {
+				logging.Errorf("%s [%s:%s:%d] vb: %d seqNo: %d Failed to write dead letter, holding checkpoint for replay, err: %v",
+					logPrefix, c.workerName, c.tcpPort, c.Pid(), letter.Vbucket, letter.SeqNo, err)
+				atomic.AddUint64(&c.deadLetterWriteFailure, 1)
+				c.failureDomains.note(common.FailureDomainKV, "dead_letter_write_failure", err)
+				continue
+			}
+			c.deadLetterHolds.release(letter.Vbucket, letter.SeqNo)
+			atomic.AddUint64(&c.deadLetterWritten, 1)
+
+		case <-c.ctx.Done():
+			logging.Infof("%s [%s:%s:%d] Exiting dead letter routine",
+				logPrefix, c.workerName, c.tcpPort, c.Pid())
+			return
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package consumer
+
+import (
+	"testing"
+)
+
+func TestDeadLetterHolds(t *testing.T) {
+	tests := []struct {
+		name     string
+		held     []uint64
+		released []uint64
+		seqNo    uint64
+		expected uint64
+	}{
+		{"nothing held", nil, nil, 100, 100},
+		{"held beyond seq no", []uint64{120}, nil, 100, 100},
+		{"held at seq no", []uint64{100}, nil, 100, 99},
+		{"oldest held wins", []uint64{50, 80}, nil, 100, 49},
+		{"released", []uint64{50, 80}, []uint64{50}, 100, 79},
+		{"all released", []uint64{50, 80}, []uint64{80, 50}, 100, 100},
+		{"release of unknown seq no", []uint64{50}, []uint64{60}, 100, 49},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			h := newDeadLetterHolds()
+			for _, seqNo := range test.held {
+				h.hold(3, seqNo)
+			}
+			for _, seqNo := range test.released {
+				h.release(3, seqNo)
+			}
+
+			if got := h.limit(3, test.seqNo); got != test.expected {
+				t.Errorf("got: %d expected: %d", got, test.expected)
+			}
+			if got := h.limit(4, test.seqNo); got != test.seqNo {
+				t.Errorf("other vb limited to: %d", got)
+			}
+
+			h.reset(3)
+			if got := h.limit(3, test.seqNo); got != test.seqNo {
+				t.Errorf("limited to: %d after reset", got)
+			}
+		})
+	}
+}
@@ -139,7 +139,7 @@ func (c *debugClient) Spawn(debuggerSpawned chan struct{}) {
 			logPrefix, c.workerName, c.debugTCPPort, c.osPid, err)
 	}
 
-	logging.Debugf("%s [%s:%s:%d] Exiting C++ worker spawned for debugger",
+	logging.AppDebugf(c.appName, "%s [%s:%s:%d] Exiting C++ worker spawned for debugger",
 		logPrefix, c.workerName, c.debugTCPPort, c.osPid)
 }
 
@@ -147,7 +147,7 @@ func (c *debugClient) Stop() {
 	logPrefix := "debugClient::Stop"
 	defer c.consumerHandle.recoverDebugger()
 
-	logging.Debugf("%s [%s:%s:%d] Stopping C++ worker spawned for debugger",
+	logging.AppDebugf(c.appName, "%s [%s:%s:%d] Stopping C++ worker spawned for debugger",
 		logPrefix, c.workerName, c.debugTCPPort, c.osPid)
 	c.consumerHandle.debugListener.Close()
 	err := util.KillProcess(c.osPid)
@@ -162,7 +162,7 @@ func (c *debugClient) String() string {
 		c.appName, c.workerName, c.debugTCPPort, c.osPid)
 }
 
-func (c *Consumer) startDebugger(e *cb.DcpEvent, instance common.DebuggerInstance) {
+func (c *Consumer) startDebugger(events []*cb.DcpEvent, instance common.DebuggerInstance) {
 	logPrefix := "Consumer::startDebuggerServer"
 	debuggerMutex.Lock()
 	defer debuggerMutex.Unlock()
@@ -311,9 +311,11 @@ func (c *Consumer) startDebugger(e *cb.DcpEvent, instance common.DebuggerInstanc
 		false, c.timerContextSize, c.producer.UsingTimer(), c.producer.SrcMutation())
 
 	c.sendInitV8Worker(payload, true, pBuilder)
-	c.sendDebuggerStart()
+	c.sendDebuggerStart(instance.Token)
 	c.sendLoadV8Worker(c.app.ParsedAppCode, true)
-	c.sendDcpEvent(e, true)
+	for _, e := range events {
+		c.sendDcpEvent(e, c.prefetchFor(e), true)
+	}
 }
 
 // ResolveHostname returns external IP address of this node.
@@ -0,0 +1,340 @@
+package consumer
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/couchbase/eventing/common"
+	mcd "github.com/couchbase/eventing/dcp/transport"
+	cb "github.com/couchbase/eventing/dcp/transport/client"
+	"github.com/couchbase/eventing/logging"
+	"github.com/couchbase/eventing/util"
+)
+
+const (
+	replayDirName         = "debugger_replay"
+	replayPersistInterval = 5 * time.Second
+
+	// Cap on key and value bytes retained per vb, older events give way first
+	replayMaxVbBytes = 256 * 1024
+)
+
+// replayEvent is a DCP event dispatched to cpp worker, retained so that it could
+// be replayed into the debugger
+type replayEvent struct {
+	Key      []byte          `json:"key"`
+	Value    []byte          `json:"value"`
+	Opcode   mcd.CommandCode `json:"opcode"`
+	Datatype uint8           `json:"datatype"`
+	Cas      uint64          `json:"cas"`
+	SeqNo    uint64          `json:"seq_no"`
+	Expiry   uint32          `json:"expiry"`
+	Flags    uint32          `json:"flags"`
+}
+
+func newReplayEvent(e *cb.DcpEvent) *replayEvent {
+	return &replayEvent{
+		Key:      append([]byte(nil), e.Key...),
+		Value:    append([]byte(nil), e.Value...),
+		Opcode:   e.Opcode,
+		Datatype: e.Datatype,
+		Cas:      e.Cas,
+		SeqNo:    e.Seqno,
+		Expiry:   e.Expiry,
+		Flags:    e.Flags,
+	}
+}
+
+func (r *replayEvent) size() int {
+	return len(r.Key) + len(r.Value)
+}
+
+func (r *replayEvent) dcpEvent(vb uint16) *cb.DcpEvent {
+	return &cb.DcpEvent{
+		Key:      r.Key,
+		Value:    r.Value,
+		Opcode:   r.Opcode,
+		Datatype: r.Datatype,
+		VBucket:  vb,
+		Cas:      r.Cas,
+		Seqno:    r.SeqNo,
+		Expiry:   r.Expiry,
+		Flags:    r.Flags,
+		Ctime:    time.Now().UnixNano(),
+	}
+}
+
+type replayVb struct {
+	events []*replayEvent // Oldest first
+	bytes  int
+	dirty  bool // Events yet to be persisted
+	seeded bool // Events persisted by earlier workers have been merged
+}
+
+func (v *replayVb) trim(count int) {
+	drop := 0
+	for len(v.events)-drop > count || v.bytes > replayMaxVbBytes {
+		v.bytes -= v.events[drop].size()
+		drop++
+	}
+	if drop > 0 {
+		v.events = append([]*replayEvent(nil), v.events[drop:]...)
+	}
+}
+
+// replayRings retains last few events dispatched to cpp worker per vb, enabled by
+// debugger_replay_events. Rings are persisted under eventing dir, so that events
+// survive worker respawns and are available to the consumer owning the vb next
+type replayRings struct {
+	sync.Mutex
+	count int
+	vbs   map[uint16]*replayVb
+}
+
+func newReplayRings(count int) *replayRings {
+	return &replayRings{
+		count: count,
+		vbs:   make(map[uint16]*replayVb),
+	}
+}
+
+func (r *replayRings) enabled() bool {
+	return r.count > 0
+}
+
+func (r *replayRings) get(vb uint16) *replayVb {
+	v, ok := r.vbs[vb]
+	if !ok {
+		v = &replayVb{}
+		r.vbs[vb] = v
+	}
+	return v
+}
+
+func (r *replayRings) add(e *cb.DcpEvent) {
+	if !r.enabled() || len(e.Key)+len(e.Value) > replayMaxVbBytes {
+		return
+	}
+
+	event := newReplayEvent(e)
+
+	r.Lock()
+	defer r.Unlock()
+
+	v := r.get(e.VBucket)
+	v.events = append(v.events, event)
+	v.bytes += event.size()
+	v.dirty = true
+	v.trim(r.count)
+}
+
+func (r *replayRings) dirtyVbs() []uint16 {
+	r.Lock()
+	defer r.Unlock()
+
+	var vbs []uint16
+	for vb, v := range r.vbs {
+		if v.dirty {
+			vbs = append(vbs, vb)
+		}
+	}
+	return vbs
+}
+
+func (r *replayRings) needsSeed(vb uint16) bool {
+	r.Lock()
+	defer r.Unlock()
+
+	return !r.get(vb).seeded
+}
+
+// seed merges events persisted earlier, which precede the ones retained so far
+func (r *replayRings) seed(vb uint16, persisted []*replayEvent) {
+	r.Lock()
+	defer r.Unlock()
+
+	v := r.get(vb)
+	if v.seeded {
+		return
+	}
+	v.seeded = true
+
+	var events []*replayEvent
+	for _, event := range persisted {
+		if len(v.events) > 0 && event.SeqNo >= v.events[0].SeqNo {
+			break
+		}
+		events = append(events, event)
+		v.bytes += event.size()
+	}
+	v.events = append(events, v.events...)
+	v.trim(r.count)
+}
+
+// snapshot returns events retained for the vb, oldest first. Clean marks them as
+// persisted
+func (r *replayRings) snapshot(vb uint16, clean bool) []*replayEvent {
+	r.Lock()
+	defer r.Unlock()
+
+	v := r.get(vb)
+	if clean {
+		v.dirty = false
+	}
+	events := make([]*replayEvent, len(v.events))
+	copy(events, v.events)
+	return events
+}
+
+func (c *Consumer) replayDir() string {
+	return filepath.Join(c.eventingDir, replayDirName, c.app.AppName)
+}
+
+// replayEvents returns events retained for the vb, including the ones persisted by
+// earlier workers
+func (c *Consumer) replayEvents(vb uint16, clean bool) []*replayEvent {
+	if c.replayRings.needsSeed(vb) {
+		c.replayRings.seed(vb, c.readReplayEvents(vb))
+	}
+	return c.replayRings.snapshot(vb, clean)
+}
+
+func (c *Consumer) readReplayEvents(vb uint16) []*replayEvent {
+	logPrefix := "Consumer::readReplayEvents"
+
+	path := filepath.Join(c.replayDir(), strconv.Itoa(int(vb))+".json")
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logging.Errorf("%s [%s:%s:%d] vb: %d Failed to read replay events, err: %v",
+				logPrefix, c.workerName, c.tcpPort, c.Pid(), vb, err)
+		}
+		return nil
+	}
+
+	var events []*replayEvent
+	err = json.Unmarshal(data, &events)
+	if err != nil {
+		logging.Errorf("%s [%s:%s:%d] vb: %d Failed to unmarshal replay events, err: %v",
+			logPrefix, c.workerName, c.tcpPort, c.Pid(), vb, err)
+		return nil
+	}
+	return events
+}
+
+func (c *Consumer) persistReplayEvents() {
+	logPrefix := "Consumer::persistReplayEvents"
+
+	if !c.replayRings.enabled() || c.eventingDir == "" {
+		return
+	}
+
+	ticker := time.NewTicker(replayPersistInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			vbs := c.replayRings.dirtyVbs()
+			if len(vbs) == 0 {
+				continue
+			}
+
+			dir := c.replayDir()
+			err := os.MkdirAll(dir, 0755)
+			if err != nil {
+				logging.Errorf("%s [%s:%s:%d] Failed to create replay dir: %s, err: %v",
+					logPrefix, c.workerName, c.tcpPort, c.Pid(), dir, err)
+				continue
+			}
+
+			for _, vb := range vbs {
+				c.writeReplayEvents(dir, vb, c.replayEvents(vb, true))
+			}
+
+		case <-c.ctx.Done():
+			logging.Infof("%s [%s:%s:%d] Exiting replay events routine",
+				logPrefix, c.workerName, c.tcpPort, c.Pid())
+			return
+		}
+	}
+}
+
+func (c *Consumer) writeReplayEvents(dir string, vb uint16, events []*replayEvent) {
+	logPrefix := "Consumer::writeReplayEvents"
+
+	data, err := json.Marshal(events)
+	if err != nil {
+		logging.Errorf("%s [%s:%s:%d] vb: %d Failed to marshal replay events, err: %v",
+			logPrefix, c.workerName, c.tcpPort, c.Pid(), vb, err)
+		return
+	}
+
+	// Written aside and renamed, so that readers never see a partially written ring
+	path := filepath.Join(dir, strconv.Itoa(int(vb))+".json")
+	err = ioutil.WriteFile(path+".tmp", data, 0640)
+	if err == nil {
+		err = os.Rename(path+".tmp", path)
+	}
+	if err != nil {
+		logging.Errorf("%s [%s:%s:%d] vb: %d Failed to persist replay events, err: %v",
+			logPrefix, c.workerName, c.tcpPort, c.Pid(), vb, err)
+	}
+}
+
+// ReplayToDebugger gets debugger spawned with last few events dispatched for the vb,
+// instead of waiting for a new mutation to trap. Returns false if the consumer doesn't
+// own the vb
+func (c *Consumer) ReplayToDebugger(vb uint16, count int) bool {
+	logPrefix := "Consumer::ReplayToDebugger"
+
+	if !util.Contains(vb, c.getCurrentlyOwnedVbs()) {
+		return false
+	}
+
+	events := c.replayEvents(vb, false)
+	if len(events) == 0 {
+		logging.Infof("%s [%s:%s:%d] vb: %d No events retained for replay, debugger would trap next mutation",
+			logPrefix, c.workerName, c.tcpPort, c.Pid(), vb)
+		c.producer.SetTrapEvent(true)
+		return true
+	}
+
+	if count > 0 && count < len(events) {
+		events = events[len(events)-count:]
+	}
+
+	dcpEvents := make([]*cb.DcpEvent, 0, len(events))
+	for _, event := range events {
+		dcpEvents = append(dcpEvents, event.dcpEvent(vb))
+	}
+
+	logging.Infof("%s [%s:%s:%d] vb: %d Replaying %d events into debugger, seq nos: %d - %d",
+		logPrefix, c.workerName, c.tcpPort, c.Pid(), vb, len(events), events[0].SeqNo, events[len(events)-1].SeqNo)
+
+	go c.replayToDebugger(dcpEvents)
+	return true
+}
+
+func (c *Consumer) replayToDebugger(events []*cb.DcpEvent) {
+	logPrefix := "Consumer::replayToDebugger"
+
+	var success bool
+	var instance common.DebuggerInstance
+
+	err := util.Retry(util.NewFixedBackoff(bucketOpRetryInterval), c.retryCount,
+		acquireDebuggerTokenCallback, c, c.producer.GetDebuggerToken(), &success, &instance)
+	if err == common.ErrRetryTimeout {
+		logging.Errorf("%s [%s:%s:%d] Exiting due to timeout", logPrefix, c.workerName, c.tcpPort, c.Pid())
+		return
+	}
+
+	if success {
+		c.startDebugger(events, instance)
+	}
+}
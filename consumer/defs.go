@@ -3,6 +3,8 @@ package consumer
 import (
 	"bufio"
 	"bytes"
+	"context"
+	"encoding/json"
 	"hash/crc32"
 	"net"
 	"os/exec"
@@ -16,7 +18,6 @@ import (
 	cb "github.com/couchbase/eventing/dcp/transport/client"
 	"github.com/couchbase/eventing/suptree"
 	"github.com/couchbase/gocb/v2"
-	flatbuffers "github.com/google/flatbuffers/go"
 )
 
 const (
@@ -37,6 +38,15 @@ const (
 	includeXATTRs = uint32(4)
 )
 
+// Source of a deletion event, passed to handler as part of metadata. Deletions
+// backfilled from disk are replayed off tombstones left to be purged, with no telling
+// when the document was deleted
+const (
+	deletionSourceDelete = "delete"
+	deletionSourceExpiry = "expiry"
+	deletionSourcePurge  = "purge"
+)
+
 const (
 	udsSockPathLimit     = 100
 	noOpMsgSendThreshold = 200
@@ -44,6 +54,13 @@ const (
 	// To decode messages from c++ world to Go
 	headerFragmentSize = 4
 
+	// Room for flatbuffer tables and fields of dcp payload, over its key and value
+	dcpPayloadOverhead = 64
+
+	// Payloads at least this large skip the send buffer on their way to worker socket.
+	// Those are still copied once, into their flatbuffer, while being encoded
+	directWritePayloadThreshold = 16 * 1024
+
 	// ClusterChangeNotifChBufSize limits buffer size for cluster change notif from producer
 	ClusterChangeNotifChBufSize = 10
 
@@ -70,6 +87,7 @@ const (
 	dcpStreamBootstrap             = "bootstrap"
 	dcpStreamRequested             = "stream_requested"
 	dcpStreamRequestFailed         = "stream_request_failed"
+	dcpStreamPaused                = "paused"
 	dcpStreamRunning               = "running"
 	dcpStreamStopped               = "stopped"
 	dcpStreamUninitialised         = ""
@@ -85,6 +103,7 @@ type xattrMetadata struct {
 	FunctionInstanceID string `json:"fiid"`
 	SeqNo              string `json:"seqno"`
 	ValueCRC           string `json:"crc"`
+	Origin             string `json:"origin,omitempty"` // Tags of functions whose handlers led to the write
 }
 
 type vbFlogEntry struct {
@@ -104,12 +123,27 @@ type dcpMetadata struct {
 	Vbucket uint16 `json:"vb"`
 	SeqNo   uint64 `json:"seq"`
 	Type    string `json:"datatype,omitempty"`
+
+	// Keyspace of the event within source bucket
+	Scope      string `json:"scope,omitempty"`
+	Collection string `json:"collection,omitempty"`
+
+	// Populated only for deletion and expiration events
+	DeletionSource  string                     `json:"deletion_source,omitempty"`
+	TombstoneXattrs map[string]json.RawMessage `json:"tombstone_xattrs,omitempty"`
+
+	// Populated only for mutations when prefetch key patterns are configured
+	Prefetched map[string]json.RawMessage `json:"prefetched,omitempty"`
+
+	// Origin tags of the mutation, worker carries them on to docs handler writes
+	Origin string `json:"origin,omitempty"`
 }
 
 type vbSeqNo struct {
-	SeqNo   uint64 `json:"seq"`
-	SkipAck int    `json:"skip_ack"` // 0: false 1: true
-	Vbucket uint16 `json:"vb"`
+	SeqNo      uint64 `json:"seq"`
+	AckedSeqNo uint64 `json:"acked_seq"` // Last seq no handler acked, in filter and pause acks
+	SkipAck    int    `json:"skip_ack"`  // 0: false 1: true
+	Vbucket    uint16 `json:"vb"`
 }
 
 // Consumer is responsible interacting with c++ v8 worker over local tcp port
@@ -117,10 +151,12 @@ type Consumer struct {
 	n1qlPrepareAll bool
 	app            *common.AppConfig
 	sourceKeyspace *common.Keyspace // source bucket
-	builderPool    *sync.Pool
+	builderPool    *builderPool
 	breakpadOn     bool
 	uuid           string
 	srcCid         uint32
+	srcCids        map[uint32]string // Collections listened to, keyed by id. Read-only
+	keyFilter      *keyFilter
 	retryCount     *int64
 
 	handlerFooters []string
@@ -138,6 +174,25 @@ type Consumer struct {
 	workerQueueCap    int64
 	workerQueueMemCap int64
 
+	// Feed consumption is throttled once cpp worker queue size reaches high watermark
+	// of workerQueueCap and until it drains to low watermark, both are item counts
+	workerQueueHighWatermark int64
+	workerQueueLowWatermark  int64
+	backpressureActive       bool
+	backpressureStartTs      time.Time
+	backpressureCounter      uint64
+	backpressureDurationMs   uint64
+
+	// cpp worker gets respawned if it stays beyond these limits
+	workerRSSLimit int64 // In bytes
+	workerCPULimit int   // In % of a core
+	workerUsage    *workerUsage
+
+	// Optional buffers are shed as per memory pressure level of eventing-producer,
+	// and feed consumption is throttled at the highest level
+	memPressureLevel      int32
+	memPressureThrottleMs uint64
+
 	cppThrPartitionMap    map[int][]uint16
 	cppWorkerThrCount     int // No. of worker threads per CPP worker process
 	crcTable              *crc32.Table
@@ -152,6 +207,8 @@ type Consumer struct {
 	aggDCPFeedMemCap           int64
 	cbBucket                   *couchbase.Bucket
 	checkpointInterval         time.Duration
+	checkpointBatchInterval    time.Duration
+	checkpointBatcher          *checkpointBatcher
 	compileInfo                *common.CompileStatus
 	controlRoutineWg           *sync.WaitGroup
 	dcpEventsRemaining         uint64
@@ -184,6 +241,7 @@ type Consumer struct {
 	isRebalanceOngoing            bool
 	isTerminateRunning            uint32                        // To signify if Consumer::Stop is running
 	kvHostDcpFeedMap              map[string]*couchbase.DcpFeed // Access controlled by hostDcpFeedRWMutex
+	kvHostBootstrapDcpFeedMap     map[string]*couchbase.DcpFeed // Feeds used for backfill, access controlled by hostDcpFeedRWMutex
 	hostDcpFeedRWMutex            *sync.RWMutex
 	kvNodes                       []string // Access controlled by kvNodesRWMutex
 	kvNodesRWMutex                *sync.RWMutex
@@ -191,7 +249,26 @@ type Consumer struct {
 	logLevel                      string
 	numVbuckets                   int
 	numTimerPartitions            int
+	timerIntegrityCheck           string
+	timerScanCh                   chan uint16 // vbs taken over, pending timer store verification
 	curlMaxAllowedRespSize        int
+	maxDocSizeBytes               int
+	maxDocSizeMode                string
+	maxDocSizeLog                 bool
+	atLeastOnce                   bool
+	useBootstrapDcpConnections    bool
+	bootstrapDcpBackfillThreshold int
+	bootstrapDcpPriority          string
+	bootstrapDcpFeedMutex         *sync.Mutex // Serializes starting of bootstrap feeds
+	bootstrapSeqNos               []uint64    // High seqnos cached for backfill checks, access controlled by bootstrapSeqNosMutex
+	bootstrapSeqNosFetchedAt      time.Time
+	bootstrapSeqNosMutex          *sync.Mutex
+	prefetchKeyPatterns           []string
+	prefetchKeySeparator          string
+	prefetchCh                    chan *cb.DcpEvent
+	prefetchPendingCount          int64             // Events queued for prefetch, yet to be sent to worker
+	vbBootstrapStreams            map[uint16]uint64 // vbs streaming over bootstrap feed to end seqno. Access controlled by vbBootstrapStreamsRWMutex
+	vbBootstrapStreamsRWMutex     *sync.RWMutex
 	nsServerPort                  string
 	reqStreamCh                   chan *streamRequestInfo
 	resetBootstrapDone            bool
@@ -201,11 +278,25 @@ type Consumer struct {
 	isPausing                     bool
 	superSup                      common.EventingSuperSup
 	allowTransactionMutations     bool
+	includeXattrs                 bool
+	skipBinaryDocs                bool
 	timerContextSize              int64
+	timerLaneBatchSize            int
+	deadLetterKeyspace            *common.Keyspace
+	deadLetterRetryCount          int
+	deadLetterCh                  chan *deadLetter
+	deadLetterHolds               *deadLetterHolds
+	deadLetterWritten             uint64
+	deadLetterWriteFailure        uint64
+	handlerRetryCount             int
+	handlerRetryBackoff           int // In ms
+	handlerRetryOn                []string
+	strictOrderCheck              bool
+	dispatchOrder                 *dispatchOrderChecker
+	dcpLaneBatchSize              int
 	vbDcpEventsRemaining          map[int]int64 // Access controlled by statsRWMutex
-	vbDcpFeedMap                  map[uint16]*couchbase.DcpFeed
-	vbEventingNodeAssignMap       map[uint16]string // Access controlled by vbEventingNodeAssignMapRWMutex
-	vbEventingNodeAssignRWMutex   *sync.RWMutex
+	vbDcpFeeds                    *vbDcpFeeds
+	vbEventingNodeAssignMap       atomic.Value // map[uint16]string snapshot published by producer, read-only
 	vbnos                         []uint16
 	vbEnqueuedForStreamReq        map[uint16]struct{} // Access controlled by vbEnqueuedForStreamReqRWMutex
 	vbEnqueuedForStreamReqRWMutex *sync.RWMutex
@@ -216,20 +307,43 @@ type Consumer struct {
 	vbsRemainingToRestream        []uint16 // Access controlled by default lock
 	vbsStateUpdateRunning         bool
 	prevRebalanceInComplete       bool
-	vbsStreamClosed               map[uint16]bool // Access controlled by vbsStreamClosedRWMutex
-	vbsStreamClosedRWMutex        *sync.RWMutex
-	vbStreamRequested             map[uint16]uint64 // map of vbs to start_seq_nos. Access controlled by vbsStreamRRWMutex
-	vbsStreamRRWMutex             *sync.RWMutex
+	vbStreamRequests              *vbStreamRequests
 	workerExited                  bool
+	workerExitCode                int    // Valid only if workerExitStatus is set
+	workerExitStatus              string // As reported by OS once cpp worker exits
 	workerCount                   int
-	workerVbucketMap              map[string][]uint16 // Access controlled by workerVbucketMapRWMutex
-	workerVbucketMapRWMutex       *sync.RWMutex
+	workerVbucketMap              atomic.Value // map[string][]uint16 snapshot published by producer, read-only
 
 	executionStats    map[string]interface{} // Access controlled by statsRWMutex
 	failureStats      map[string]interface{} // Access controlled by statsRWMutex
 	lcbExceptionStats map[string]uint64      // Access controlled by statsRWMutex
+	laneSample        *laneSample            // Access controlled by statsRWMutex
 	statsRWMutex      *sync.RWMutex
 
+	dcpFeedEvents    *dcpFeedEvents
+	failureDomains   *failureDomains
+	streamReqTracker *streamReqTracker
+
+	// Durations recorded in rebalance histograms of producer
+	streamOpenTimings    *vbTimings // Stream request till STREAMREQ response
+	timerTransferTimings *vbTimings // Filter sent to cpp worker till its ack
+
+	// Captured in incident record when cpp worker gets respawned
+	workerStderr   *lineRing
+	lastDispatched *dispatchRing
+
+	// Last few events dispatched per vb, replayed into debugger on request
+	replayRings *replayRings
+
+	// Set while producer has fenced the function on this node, owing to
+	// sustained metadata write failures
+	fenced  uint32
+	fenceWg sync.WaitGroup
+
+	// Stats payloads from cpp worker that failed schema validation
+	statsQuarantineCounter uint64
+	statsQuarantine        *statsQuarantine
+
 	// Time when last response from CPP worker was received on main loop
 	workerRespMainLoopTs atomic.Value
 	// Time when go side of cpp worker was initialised
@@ -244,9 +358,37 @@ type Consumer struct {
 	vbOwnershipGiveUpRoutineCount   int
 	vbOwnershipTakeoverRoutineCount int
 
+	// Auto tuning of takeover routine count, based on measured per vb takeover time
+	autoTuneVbTakeoverRoutines bool
+	vbTakeoverRoutineMinCount  int
+	vbTakeoverRoutineMaxCount  int
+	vbTakeoverRoutineCount     uint64 // Routine count used in last takeover attempt
+	vbTakeoverTimer            *vbTakeoverTimer
+
+	vbsStateUpdateTracker *vbsStateUpdateTracker
+
+	networkStats         *networkStats
+	metaTranscoder       *countingTranscoder
+	deadLetterTranscoder *countingTranscoder
+
+	// Overall deadline for vbsStateUpdate to own vbs assigned to the consumer. On
+	// exceeding it, vbs still owned by other nodes are forcibly taken over if enabled
+	vbTakeoverDeadline         time.Duration
+	forceVbTakeover            bool
+	vbTakeoverDeadlineExceeded uint64
+	vbForceTakeoverCount       uint64
+
+	// Time for which stream of a vb being given up is kept open, until new owner
+	// confirms it's streaming from the handover seq no. 0 disables lingering
+	vbHandoverLingerTimeout time.Duration
+	vbHandovers             *vbHandovers
+	vbHandoverCompleted     uint64
+	vbHandoverTimedOut      uint64
+
 	// N1QL related params
 	lcbInstCapacity int
 	n1qlConsistency string
+	n1qlTimeout     int
 
 	dcpStreamBoundary common.DcpStreamBoundary
 
@@ -259,6 +401,7 @@ type Consumer struct {
 	feedbackReadMsgBuffer    bytes.Buffer
 	feedbackWriteBatchSize   int
 	readMsgBuffer            bytes.Buffer
+	msgBatch                 *messageBatch // Access controlled by sendMsgBufferRWMutex
 	sendMsgBuffer            bytes.Buffer
 	sendMsgBufferRWMutex     *sync.RWMutex
 	sockFeedbackReader       *bufio.Reader
@@ -294,22 +437,50 @@ type Consumer struct {
 	signalConnectedCh         chan struct{}
 	signalFeedbackConnectedCh chan struct{}
 
+	// Capabilities advertised by C++ v8 worker in response to init
+	signalCapabilitiesCh chan struct{}
+	workerCapabilities   atomic.Value // *workerCapabilitiesMsg
+	loadChunkAttempts    int32
+
+	// Protocol version settled with C++ v8 worker by handshake at init
+	signalHandshakeCh chan *protocolHandshakeAck
+	protocolVersion   uint32
+
+	// Compile status reported by C++ v8 worker, hot swap of handler code waits on it.
+	// loadedAppCode is the handler code last sent to worker for load
+	signalCompileInfoCh chan *common.CompileStatus
+	hotSwapMutex        *sync.Mutex
+	loadedAppCode       atomic.Value // string
+
+	// Frames exchanged with worker carry CRC32C if asked for by worker_frame_checksums
+	// and the worker agreed to it during handshake
+	frameChecksumsWanted   bool
+	frameChecksums         uint32
+	frameChecksumFailures  uint64
+	workerChecksumFailures uint64
+
+	// Workers stamp docs they write with origin tags of the event being handled
+	// and function instance id, mutations carrying the latter are then dropped if
+	// seen back over DCP. Set by origin_tagging
+	originTagging bool
+
 	// Chan used by signal update of app handler settings
 	signalSettingsChangeCh chan struct{}
+	settingsSubscription   uint64
 
-	stopConsumerCh chan struct{}
+	// Cancelled on consumer stop, routines spawned by consumer exit on it
+	ctx       context.Context
+	cancelCtx context.CancelFunc
 
 	gracefulShutdownChan chan struct{}
 
 	clusterStateChangeNotifCh chan struct{}
 
-	// chan to signal vbucket ownership give up routine to stop.
-	// Will be triggered in case of stop rebalance operation
-	stopVbOwnerGiveupCh chan struct{}
-
-	// chan to signal vbucket ownership takeover routine to exit.
-	// Will be triggered in case of stop rebalance operation
-	stopVbOwnerTakeoverCh chan struct{}
+	// Context of ongoing rebalance, derived from ctx. Cancelled in case of stop
+	// rebalance operation, to signal vbucket ownership takeover to exit
+	rebalanceCtx      context.Context
+	rebalanceCancel   context.CancelFunc
+	rebalanceCtxMutex *sync.Mutex
 
 	debugFeedbackTCPPort string
 	debugIPCType         string
@@ -329,12 +500,22 @@ type Consumer struct {
 	dcpStreamReqCounter      uint64
 	dcpStreamReqErrCounter   uint64
 
+	bootstrapStreamSwitchCounter uint64
+
+	checkpointsWritten uint64
+	checkpointsSkipped uint64 // Of idle vbs, neither seqno nor timer progress changed since last write
+
 	adhocTimerResponsesRecieved uint64
 	timerMessagesProcessed      uint64
+	timerCancelRequests         uint64
+	timerCancelled              uint64
+	timerStoreCorruptions       uint64
+	timerStoreRepairs           uint64
 
 	// DCP and timer related counters
 	timerResponsesRecieved       uint64
 	aggMessagesSentCounter       uint64
+	directWritePayloadCounter    uint64
 	dcpDeletionCounter           uint64
 	dcpMutationCounter           uint64
 	dcpExpiryCounter             uint64
@@ -343,6 +524,14 @@ type Consumer struct {
 	timerMessagesProcessedPSec   int
 	suppressedDCPDeletionCounter uint64
 	suppressedDCPMutationCounter uint64
+	originSuppressedCounter      uint64
+	oversizedDocSkipCounter      uint64
+	binaryDocSkipCounter         uint64
+	keyFilteredCounter           uint64
+	oversizedDocTruncateCounter  uint64
+	prefetchDocCounter           uint64
+	prefetchMissCounter          uint64
+	prefetchErrCounter           uint64
 	sentEventsSize               int64
 	numSentEvents                int64
 
@@ -364,12 +553,18 @@ type Consumer struct {
 	sync.RWMutex
 	vbProcessingStats vbStats
 	backupVbStats     vbStats
+	readSeqNos        *readSeqNoBatcher
 
 	checkpointTicker         *time.Ticker
 	restartVbDcpStreamTicker *time.Ticker
 	statsTicker              *time.Ticker
 	updateStatsTicker        *time.Ticker
 	loadStatsTicker          *time.Ticker
+	heartbeatTicker          *time.Ticker
+
+	// Accessed only from control routine, while sending heartbeat to producer
+	heartbeatTs        time.Time
+	heartbeatProcessed uint64
 
 	insight               chan *common.Insight
 	languageCompatibility string
@@ -432,6 +627,9 @@ type vbucketKVBlob struct {
 	VBuuid                    uint64           `json:"vb_uuid"`
 	WorkerRequestedVbStream   string           `json:"worker_requested_vb_stream"`
 	ManifestUID               string           `json:"manifest_id"`
+	SchemaVersion             int              `json:"schema_version"`
+	OwnershipHistoryArchive   string           `json:"ownership_history_archive,omitempty"` // snappy compressed, base64 encoded
+	Handover                  *vbHandover      `json:"handover,omitempty"`
 
 	CurrentProcessedDocIDTimer   string `json:"currently_processed_doc_id_timer"`
 	LastCleanedUpDocIDTimerEvent string `json:"last_cleaned_up_doc_id_timer_event"`
@@ -449,6 +647,17 @@ type vbucketKVBlobVer struct {
 	EventingVersion string `json:"version"`
 }
 
+// vbHandover is published by owner of a vb lingering on it after giving it up. Owner
+// stops processing mutations beyond SeqNo, from where the new owner streams the vb
+// once owner sets AckedSeqNo to SeqNo
+type vbHandover struct {
+	AssignedWorker string `json:"assigned_worker"`
+	NodeUUID       string `json:"node_uuid"`
+	SeqNo          uint64 `json:"seq_no"`
+	AckedSeqNo     uint64 `json:"acked_seq_no"`
+	Timestamp      string `json:"timestamp"`
+}
+
 // OwnershipEntry captures the state of vbucket within the metadata blob
 type OwnershipEntry struct {
 	AssignedWorker string `json:"assigned_worker"`
@@ -462,8 +671,8 @@ type msgToTransmit struct {
 	msg            *message
 	sendToDebugger bool
 	prioritize     bool
-	headerBuilder  *flatbuffers.Builder
-	payloadBuilder *flatbuffers.Builder
+	headerBuilder  *pooledBuilder
+	payloadBuilder *pooledBuilder
 }
 
 type cppQueueSize struct {
@@ -471,6 +680,8 @@ type cppQueueSize struct {
 	AggQueueMemory      int64 `json:"agg_queue_memory"`
 	ProcessedEventsSize int64 `json:"processed_events_size"`
 	NumProcessedEvents  int64 `json:"num_processed_events"`
+	FeedbackQueueSize   int64 `json:"feedback_queue_size"`
+	Version             int   `json:"version"`
 }
 
 type streamRequestInfo struct {
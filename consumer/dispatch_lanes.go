@@ -0,0 +1,42 @@
+package consumer
+
+import (
+	"time"
+)
+
+// laneSample is the count of events dispatched per lane by the worker, retained
+// to derive throughput of each lane between successive execution stats
+type laneSample struct {
+	dcp   float64
+	timer float64
+	ts    time.Time
+}
+
+// updateLaneStats adds throughput of DCP and timer dispatch lanes and depth of DCP
+// lane to execution stats received from the worker. Timer lane backlog isn't known
+// ahead of scan, worker reports timer_lane_active_scans in its place. Caller is
+// expected to hold statsRWMutex
+func (c *Consumer) updateLaneStats(stats map[string]interface{}) {
+	if depth, ok := stats["agg_queue_size"]; ok {
+		stats["dcp_lane_queue_size"] = depth
+	}
+
+	dcp, _ := stats["dcp_lane_dispatched"].(float64)
+	timer, _ := stats["timer_lane_dispatched"].(float64)
+	now := time.Now()
+
+	prev := c.laneSample
+	c.laneSample = &laneSample{dcp: dcp, timer: timer, ts: now}
+	if prev == nil {
+		return
+	}
+
+	// Counters reset when worker is respawned
+	elapsed := now.Sub(prev.ts).Seconds()
+	if elapsed <= 0 || dcp < prev.dcp || timer < prev.timer {
+		return
+	}
+
+	stats["dcp_lane_throughput"] = (dcp - prev.dcp) / elapsed
+	stats["timer_lane_throughput"] = (timer - prev.timer) / elapsed
+}
@@ -0,0 +1,84 @@
+package consumer
+
+import (
+	"strconv"
+	"sync/atomic"
+
+	"github.com/couchbase/eventing/logging"
+)
+
+// Ordering guarantee: DCP events of a vb are handed to the handler in the order
+// they were received from DCP, irrespective of how they're batched on the socket
+// or which worker thread the vb is mapped to. Events of different vbs carry no
+// ordering guarantee relative to each other.
+//
+// Each DCP event is stamped with a dispatch seq, which increases monotonically per
+// vb over the lifetime of the consumer. Gaps are expected, as events of filtered
+// vbs are dropped by the worker. With strict_order_check enabled, worker flags
+// events processed out of dispatch order and reports dispatch seq of the last
+// event handler finished for each vb alongside acks, which is validated here.
+type dispatchOrderChecker struct {
+	dispatched []uint64 // Last dispatch seq stamped per vb
+	acked      []uint64 // Last dispatch seq acked by worker per vb
+	violations uint64
+}
+
+func newDispatchOrderChecker(numVbuckets int) *dispatchOrderChecker {
+	return &dispatchOrderChecker{
+		dispatched: make([]uint64, numVbuckets),
+		acked:      make([]uint64, numVbuckets),
+	}
+}
+
+func (d *dispatchOrderChecker) next(partition int16) uint64 {
+	if partition < 0 || int(partition) >= len(d.dispatched) {
+		return 0
+	}
+	return atomic.AddUint64(&d.dispatched[partition], 1)
+}
+
+// checkDispatchOrder validates dispatch seq acked by worker for a vb never goes back,
+// nor runs ahead of what has been dispatched
+func (c *Consumer) checkDispatchOrder(vb uint16, dispatchSeq uint64) {
+	logPrefix := "Consumer::checkDispatchOrder"
+
+	d := c.dispatchOrder
+	if !c.strictOrderCheck || dispatchSeq == 0 || int(vb) >= len(d.acked) {
+		return
+	}
+
+	dispatched := atomic.LoadUint64(&d.dispatched[vb])
+	acked := atomic.SwapUint64(&d.acked[vb], dispatchSeq)
+
+	if dispatchSeq < acked || dispatchSeq > dispatched {
+		atomic.AddUint64(&d.violations, 1)
+		logging.Errorf("%s [%s:%s:%d] vb: %d dispatch order violated, acked dispatch seq: %d previously acked: %d last dispatched: %d",
+			logPrefix, c.workerName, c.tcpPort, c.Pid(), vb, dispatchSeq, acked, dispatched)
+	}
+}
+
+func (c *Consumer) sendStrictOrderCheck() {
+	logPrefix := "Consumer::sendStrictOrderCheck"
+
+	header, hBuilder := c.makeStrictOrderCheckHeader(strconv.FormatBool(c.strictOrderCheck))
+
+	c.msgProcessedRWMutex.Lock()
+	if _, ok := c.v8WorkerMessagesProcessed["strict_order_check"]; !ok {
+		c.v8WorkerMessagesProcessed["strict_order_check"] = 0
+	}
+	c.v8WorkerMessagesProcessed["strict_order_check"]++
+	c.msgProcessedRWMutex.Unlock()
+
+	m := &msgToTransmit{
+		msg: &message{
+			Header: header,
+		},
+		prioritize:    true,
+		headerBuilder: hBuilder,
+	}
+
+	logging.Infof("%s [%s:%s:%d] Sending strict order check: %t",
+		logPrefix, c.workerName, c.tcpPort, c.Pid(), c.strictOrderCheck)
+
+	c.sendMessage(m)
+}
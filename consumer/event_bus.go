@@ -0,0 +1,60 @@
+package consumer
+
+import (
+	"encoding/json"
+
+	"github.com/couchbase/eventing/logging"
+)
+
+// workerBusEvent is an event emitted by handler through emitEvent(), or one being
+// handed to OnEvent of the handler
+type workerBusEvent struct {
+	Topic   string          `json:"topic"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// publishBusEvent passes event emitted by handler on to event bus of the node
+func (c *Consumer) publishBusEvent(msg string) {
+	logPrefix := "Consumer::publishBusEvent"
+
+	var evt workerBusEvent
+	err := json.Unmarshal([]byte(msg), &evt)
+	if err != nil || evt.Topic == "" {
+		logging.Errorf("%s [%s:%s:%d] Failed to unmarshal bus event, msg: %ru err: %v",
+			logPrefix, c.workerName, c.tcpPort, c.Pid(), msg, err)
+		return
+	}
+
+	c.superSup.PublishBusEvent(c.app.AppName, evt.Topic, evt.Payload)
+}
+
+// SendBusEvent hands event published on a topic the function subscribes to over to
+// the worker, to be passed on to OnEvent of the handler
+func (c *Consumer) SendBusEvent(topic string, payload []byte) error {
+	logPrefix := "Consumer::SendBusEvent"
+
+	meta, err := json.Marshal(&workerBusEvent{Topic: topic, Payload: payload})
+	if err != nil {
+		logging.Errorf("%s [%s:%s:%d] Failed to marshal bus event of topic: %s, err: %v",
+			logPrefix, c.workerName, c.tcpPort, c.Pid(), topic, err)
+		return err
+	}
+
+	header, hBuilder := c.makeBusEventHeader(string(meta))
+
+	c.msgProcessedRWMutex.Lock()
+	if _, ok := c.v8WorkerMessagesProcessed["bus_event"]; !ok {
+		c.v8WorkerMessagesProcessed["bus_event"] = 0
+	}
+	c.v8WorkerMessagesProcessed["bus_event"]++
+	c.msgProcessedRWMutex.Unlock()
+
+	m := &msgToTransmit{
+		msg: &message{
+			Header: header,
+		},
+		headerBuilder: hBuilder,
+	}
+
+	return c.sendMessage(m)
+}
@@ -19,7 +19,6 @@ import (
 	"github.com/couchbase/eventing/logging"
 	"github.com/couchbase/eventing/parser"
 	"github.com/couchbase/eventing/util"
-	flatbuffers "github.com/google/flatbuffers/go"
 )
 
 // ClearEventStats flushes event processing stats
@@ -70,10 +69,70 @@ func (c *Consumer) GetEventProcessingStats() map[string]uint64 {
 	stats["agg_queue_memory_cap"] = uint64(c.workerQueueMemCap)
 	stats["agg_queue_size_cap"] = uint64(c.workerQueueCap)
 
+	if counter := atomic.LoadUint64(&c.backpressureCounter); counter > 0 {
+		stats["backpressure_counter"] = counter
+		stats["backpressure_duration_ms"] = atomic.LoadUint64(&c.backpressureDurationMs)
+	}
+
+	stats["memory_pressure_level"] = uint64(c.memoryPressureLevel())
+	c.networkStats.stats(stats)
+	if throttled := atomic.LoadUint64(&c.memPressureThrottleMs); throttled > 0 {
+		stats["memory_pressure_throttle_ms"] = throttled
+	}
+
+	if counter := atomic.LoadUint64(&c.statsQuarantineCounter); counter > 0 {
+		stats["worker_stats_quarantine_counter"] = counter
+	}
+
+	for k, v := range c.dcpFeedEvents.stats() {
+		stats[k] = v
+	}
+
+	for k, v := range c.streamReqTracker.stats() {
+		stats[k] = v
+	}
+
+	for k, v := range c.checkpointBatcher.stats() {
+		stats[k] = v
+	}
+
+	for k, v := range c.readSeqNos.stats() {
+		stats[k] = v
+	}
+
+	if written := atomic.LoadUint64(&c.checkpointsWritten); written > 0 {
+		stats["checkpoints_written"] = written
+	}
+
+	if skipped := atomic.LoadUint64(&c.checkpointsSkipped); skipped > 0 {
+		stats["checkpoints_skipped"] = skipped
+	}
+
 	if c.aggMessagesSentCounter > 0 {
 		stats["agg_messages_sent_to_worker"] = c.aggMessagesSentCounter
 	}
 
+	if c.directWritePayloadCounter > 0 {
+		stats["direct_write_payloads_sent_to_worker"] = c.directWritePayloadCounter
+	}
+
+	if version := atomic.LoadUint32(&c.protocolVersion); version > 0 {
+		stats["worker_protocol_version"] = uint64(version)
+	}
+
+	if failures := atomic.LoadUint64(&c.frameChecksumFailures); failures > 0 {
+		stats["frame_checksum_failures"] = failures
+	}
+
+	if failures := atomic.LoadUint64(&c.workerChecksumFailures); failures > 0 {
+		stats["worker_frame_checksum_failures"] = failures
+	}
+
+	if framesSent, messagesSent := c.msgBatch.stats(); framesSent > 0 {
+		stats["batch_frames_sent_to_worker"] = framesSent
+		stats["messages_per_batch_frame"] = messagesSent / framesSent
+	}
+
 	if c.dcpDeletionCounter > 0 {
 		stats["dcp_deletion_sent_to_worker"] = c.dcpDeletionCounter
 	}
@@ -98,6 +157,38 @@ func (c *Consumer) GetEventProcessingStats() map[string]uint64 {
 		stats["dcp_mutation_suppressed_counter"] = c.suppressedDCPMutationCounter
 	}
 
+	if c.originSuppressedCounter > 0 {
+		stats["dcp_mutation_origin_suppressed_counter"] = c.originSuppressedCounter
+	}
+
+	if c.keyFilteredCounter > 0 {
+		stats["dcp_key_filtered_counter"] = c.keyFilteredCounter
+	}
+
+	if c.binaryDocSkipCounter > 0 {
+		stats["dcp_mutation_binary_skipped_counter"] = c.binaryDocSkipCounter
+	}
+
+	if c.oversizedDocSkipCounter > 0 {
+		stats["dcp_mutation_oversized_skipped_counter"] = c.oversizedDocSkipCounter
+	}
+
+	if c.oversizedDocTruncateCounter > 0 {
+		stats["dcp_mutation_oversized_truncated_counter"] = c.oversizedDocTruncateCounter
+	}
+
+	if c.prefetchDocCounter > 0 {
+		stats["prefetch_doc_counter"] = c.prefetchDocCounter
+	}
+
+	if c.prefetchMissCounter > 0 {
+		stats["prefetch_miss_counter"] = c.prefetchMissCounter
+	}
+
+	if c.prefetchErrCounter > 0 {
+		stats["prefetch_err_counter"] = c.prefetchErrCounter
+	}
+
 	if c.dcpCloseStreamCounter > 0 {
 		stats["dcp_stream_close_counter"] = c.dcpCloseStreamCounter
 	}
@@ -114,6 +205,14 @@ func (c *Consumer) GetEventProcessingStats() map[string]uint64 {
 		stats["dcp_stream_req_err_counter"] = c.dcpStreamReqErrCounter
 	}
 
+	if c.bootstrapStreamSwitchCounter > 0 {
+		stats["dcp_bootstrap_stream_switch_counter"] = c.bootstrapStreamSwitchCounter
+	}
+
+	if count := c.getBootstrapStreamCount(); count > 0 {
+		stats["dcp_bootstrap_streams"] = uint64(count)
+	}
+
 	if c.timerResponsesRecieved > 0 {
 		stats["timer_responses_received"] = c.timerResponsesRecieved
 	}
@@ -122,10 +221,32 @@ func (c *Consumer) GetEventProcessingStats() map[string]uint64 {
 		stats["timer_events"] = c.timerMessagesProcessed
 	}
 
+	if timerCancelRequests := atomic.LoadUint64(&c.timerCancelRequests); timerCancelRequests > 0 {
+		stats["timer_cancel_requests"] = timerCancelRequests
+	}
+
+	if c.timerCancelled > 0 {
+		stats["timer_cancelled"] = c.timerCancelled
+	}
+
+	if corruptions := atomic.LoadUint64(&c.timerStoreCorruptions); corruptions > 0 {
+		stats["timer_store_corruptions"] = corruptions
+	}
+
+	if repairs := atomic.LoadUint64(&c.timerStoreRepairs); repairs > 0 {
+		stats["timer_store_repairs"] = repairs
+	}
+
 	if c.errorParsingTimerResponses > 0 {
 		stats["error_parsing_timer_response"] = c.errorParsingTimerResponses
 	}
 
+	if c.builderPool != nil {
+		for stat, value := range c.builderPool.stats() {
+			stats[stat] = value
+		}
+	}
+
 	if c.isBootstrapping {
 		stats["is_bootstrapping"] = 1
 	}
@@ -149,6 +270,32 @@ func (c *Consumer) GetEventProcessingStats() map[string]uint64 {
 		stats["reb_vb_remaining_to_own"] = uint64(len(vbsRemainingToOwn))
 	}
 
+	if routineCount := atomic.LoadUint64(&c.vbTakeoverRoutineCount); routineCount > 0 {
+		stats["reb_vb_takeover_routine_count"] = routineCount
+		stats["reb_vb_takeover_avg_time_ms"] = uint64(c.vbTakeoverTimer.average() / time.Millisecond)
+	}
+
+	if deadlineExceeded := atomic.LoadUint64(&c.vbTakeoverDeadlineExceeded); deadlineExceeded > 0 {
+		stats["reb_vb_takeover_deadline_exceeded"] = deadlineExceeded
+	}
+
+	if forceTakeovers := atomic.LoadUint64(&c.vbForceTakeoverCount); forceTakeovers > 0 {
+		stats["reb_vb_force_takeover"] = forceTakeovers
+	}
+
+	if handovers := atomic.LoadUint64(&c.vbHandoverCompleted); handovers > 0 {
+		stats["reb_vb_handover_completed"] = handovers
+	}
+
+	if handoverTimeouts := atomic.LoadUint64(&c.vbHandoverTimedOut); handoverTimeouts > 0 {
+		stats["reb_vb_handover_timed_out"] = handoverTimeouts
+	}
+
+	if rss, cpuPercent := c.workerUsage.stats(); rss > 0 {
+		stats["worker_rss_bytes"] = rss
+		stats["worker_cpu_percent"] = cpuPercent
+	}
+
 	vbsRemainingToStreamReq := c.getVbRemainingToStreamReq()
 	if len(vbsRemainingToStreamReq) > 0 {
 		stats["reb_vb_remaining_to_stream_req"] = uint64(len(vbsRemainingToStreamReq))
@@ -363,9 +510,23 @@ func (c *Consumer) GetFailureStats() map[string]interface{} {
 		failureStats[k] = v
 	}
 
+	if c.deadLetterKeyspace != nil {
+		failureStats["dead_letter_written"] = float64(atomic.LoadUint64(&c.deadLetterWritten))
+		failureStats["dead_letter_write_failure"] = float64(atomic.LoadUint64(&c.deadLetterWriteFailure))
+	}
+
+	if c.strictOrderCheck {
+		failureStats["dispatch_order_violation"] = float64(atomic.LoadUint64(&c.dispatchOrder.violations))
+	}
+
 	return failureStats
 }
 
+// GetFailureDomains returns failures of the consumer attributed to failure domains
+func (c *Consumer) GetFailureDomains() map[string]*common.DomainFailures {
+	return c.failureDomains.snapshot(c.GetFailureStats())
+}
+
 // Pid returns the process id of CPP V8 worker
 func (c *Consumer) Pid() int {
 	pid, ok := c.osPid.Load().(int)
@@ -388,6 +549,11 @@ func (c *Consumer) GetLcbExceptionsStats() map[string]uint64 {
 	return lcbExceptionStats
 }
 
+// GetDcpFeedEvents returns recent connect/disconnect events of DCP feeds against KV nodes
+func (c *Consumer) GetDcpFeedEvents() []*common.DcpFeedEvent {
+	return c.dcpFeedEvents.lastEvents()
+}
+
 // SpawnCompilationWorker bring up a CPP worker to compile the user supplied handler code
 func (c *Consumer) SpawnCompilationWorker(appCode, appContent, appName, eventingPort string, handlerHeaders, handlerFooters []string) (*common.CompileStatus, error) {
 	logPrefix := "Consumer::SpawnCompilationWorker"
@@ -579,15 +745,12 @@ func (c *Consumer) initConsumer(appName string) {
 	c.connMutex = &sync.RWMutex{}
 	c.msgProcessedRWMutex = &sync.RWMutex{}
 	c.sendMsgBufferRWMutex = &sync.RWMutex{}
+	c.msgBatch = newMessageBatch()
 	c.app = &common.AppConfig{AppName: appName}
 
 	c.v8WorkerMessagesProcessed = make(map[string]uint64)
 
-	c.builderPool = &sync.Pool{
-		New: func() interface{} {
-			return flatbuffers.NewBuilder(0)
-		},
-	}
+	c.builderPool = newBuilderPool(defaultBuilderPoolSize, 0)
 }
 
 // InternalVbDistributionStats returns internal state of vbucket ownership distribution on local eventing node
@@ -624,6 +787,8 @@ func (c *Consumer) TimerDebugStats() map[int]map[string]interface{} {
 			stats[vb]["timers_in_past_counter"] = c.vbProcessingStats.getVbStat(uint16(vb), "timers_in_past_counter")
 			stats[vb]["timers_in_past_from_backfill_counter"] = c.vbProcessingStats.getVbStat(uint16(vb), "timers_in_past_from_backfill_counter")
 			stats[vb]["timers_recreated_from_dcp_backfill"] = c.vbProcessingStats.getVbStat(uint16(vb), "timers_recreated_from_dcp_backfill")
+			stats[vb]["last_doc_timer_feedback_seqno"] = c.vbProcessingStats.getVbStat(uint16(vb), "last_doc_timer_feedback_seqno")
+			stats[vb]["timer_feedback_lag"] = c.timerFeedbackLag(uint16(vb))
 		}
 	}
 
@@ -695,34 +860,17 @@ func (c *Consumer) Index() int {
 
 // VbEventingNodeAssignMapUpdate captures updated node to vbucket assignment
 func (c *Consumer) VbEventingNodeAssignMapUpdate(vbEventingNodeAssignMap map[uint16]string) {
-	c.vbEventingNodeAssignRWMutex.Lock()
-	defer c.vbEventingNodeAssignRWMutex.Unlock()
-
-	c.vbEventingNodeAssignMap = make(map[uint16]string)
-
-	for vb, node := range vbEventingNodeAssignMap {
-		c.vbEventingNodeAssignMap[vb] = node
-	}
+	c.vbEventingNodeAssignMap.Store(vbEventingNodeAssignMap)
 }
 
 // WorkerVbMapUpdate captures updated mapping of active consumers to vbuckets they should handle as per static planner
 func (c *Consumer) WorkerVbMapUpdate(workerVbucketMap map[string][]uint16) {
-	c.workerVbucketMapRWMutex.Lock()
-	defer c.workerVbucketMapRWMutex.Unlock()
-
-	c.workerVbucketMap = make(map[string][]uint16)
-
-	for workerName, assignedVbs := range workerVbucketMap {
-		c.workerVbucketMap[workerName] = assignedVbs
-	}
+	c.workerVbucketMap.Store(workerVbucketMap)
 }
 
 func (c *Consumer) GetAssignedVbs(workerName string) ([]uint16, error) {
-	c.workerVbucketMapRWMutex.RLock()
-	defer c.workerVbucketMapRWMutex.RUnlock()
-
-	if _, ok := c.workerVbucketMap[workerName]; ok {
-		return c.workerVbucketMap[workerName], nil
+	if assignedVbs, ok := c.getWorkerVbucketMap()[workerName]; ok {
+		return assignedVbs, nil
 	}
 
 	return nil, fmt.Errorf("worker not found")
@@ -782,6 +930,11 @@ func (c *Consumer) RemoveSupervisorToken() error {
 }
 
 func (c *Consumer) GetInsight() *common.Insight {
+	// Insight samples are optional and among the first to be shed under memory pressure
+	if c.shedDiagnostics() {
+		return nil
+	}
+
 	c.refreshInsight()
 	select {
 	case insight := <-c.insight:
@@ -0,0 +1,174 @@
+package consumer
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/couchbase/eventing/common"
+)
+
+const failureSamplesToRetain = 10
+
+// Failure domain of failure stats reported by cpp worker. Stats not listed here
+// are attributed to worker, as those are mostly events lost within the worker
+var workerFailureStatDomains = map[string]string{
+	"bucket_op_exception_count":           common.FailureDomainKV,
+	"bucket_cahce_overflow_count":         common.FailureDomainKV,
+	"bkt_ops_cas_mismatch_count":          common.FailureDomainKV,
+	"n1ql_op_exception_count":             common.FailureDomainHandler,
+	"timeout_count":                       common.FailureDomainHandler,
+	"timer_context_size_exceeded_counter": common.FailureDomainHandler,
+	"timer_callback_missing_counter":      common.FailureDomainHandler,
+	"dead_letter_counter":                 common.FailureDomainHandler,
+	"handler_retry_counter":               common.FailureDomainHandler,
+	"bus_events_lost":                     common.FailureDomainHandler,
+	"checkpoint_failure_count":            common.FailureDomainMetadata,
+	"curl_non_200_response":               common.FailureDomainNetwork,
+	"curl_timeout_count":                  common.FailureDomainNetwork,
+	"curl_failure_count":                  common.FailureDomainNetwork,
+	"curl_max_resp_size_exceeded":         common.FailureDomainNetwork,
+	"dead_letter_write_failure":           common.FailureDomainKV,
+}
+
+// Failure stats which don't count failures
+var nonFailureStats = map[string]struct{}{
+	"timestamp":                  {},
+	"bucket_op_cache_miss_count": {},
+	"handler_retry_success":      {},
+	"dead_letter_written":        {},
+}
+
+// failureDomains attributes failures of the consumer to failure domains. Failures
+// observed by consumer are counted as they happen, while failure stats of cpp worker
+// are attributed when they're refreshed. Recent failures are sampled per domain
+type failureDomains struct {
+	sync.Mutex
+	workerName  string
+	counters    map[string]map[string]uint64 // domain => operation => failures
+	samples     map[string][]*common.FailureSample
+	workerStats map[string]float64 // Failure stats of cpp worker seen last
+}
+
+func newFailureDomains(workerName string) *failureDomains {
+	return &failureDomains{
+		workerName:  workerName,
+		counters:    make(map[string]map[string]uint64),
+		samples:     make(map[string][]*common.FailureSample),
+		workerStats: make(map[string]float64),
+	}
+}
+
+func failureStatDomain(stat string) string {
+	if domain, ok := workerFailureStatDomains[stat]; ok {
+		return domain
+	}
+	return common.FailureDomainWorker
+}
+
+// record counts a failure of an operation performed by the consumer
+func (f *failureDomains) record(domain, source string, err error) {
+	f.Lock()
+	defer f.Unlock()
+
+	if _, ok := f.counters[domain]; !ok {
+		f.counters[domain] = make(map[string]uint64)
+	}
+	f.counters[domain][source]++
+	f.sample(domain, source, err.Error())
+}
+
+// note samples failure of an operation, which is already counted as part of
+// failure stats of the consumer
+func (f *failureDomains) note(domain, source string, err error) {
+	f.Lock()
+	defer f.Unlock()
+
+	f.sample(domain, source, err.Error())
+}
+
+// observeWorkerStats samples failure stats of cpp worker which went up since they
+// were seen last. Counters going down imply worker got respawned
+func (f *failureDomains) observeWorkerStats(stats map[string]interface{}) {
+	f.Lock()
+	defer f.Unlock()
+
+	for stat, val := range stats {
+		if _, ok := nonFailureStats[stat]; ok {
+			continue
+		}
+		count, ok := val.(float64)
+		if !ok {
+			continue
+		}
+
+		last := f.workerStats[stat]
+		if count < last {
+			last = 0
+		}
+		if count > last {
+			f.sample(failureStatDomain(stat), stat, fmt.Sprintf("%s went up by %d", stat, uint64(count-last)))
+		}
+		f.workerStats[stat] = count
+	}
+}
+
+// sample retains failure as one of the recent ones of the domain. Caller should
+// hold the lock
+func (f *failureDomains) sample(domain, source, message string) {
+	samples := append(f.samples[domain], &common.FailureSample{
+		Timestamp: time.Now(),
+		Worker:    f.workerName,
+		Source:    source,
+		Message:   message,
+	})
+	if len(samples) > failureSamplesToRetain {
+		samples = samples[len(samples)-failureSamplesToRetain:]
+	}
+	f.samples[domain] = samples
+}
+
+// snapshot attributes failure stats of the consumer along with failures recorded
+// by it to failure domains
+func (f *failureDomains) snapshot(failureStats map[string]interface{}) map[string]*common.DomainFailures {
+	domains := make(map[string]*common.DomainFailures)
+	get := func(domain string) *common.DomainFailures {
+		d, ok := domains[domain]
+		if !ok {
+			d = &common.DomainFailures{Counters: make(map[string]uint64)}
+			domains[domain] = d
+		}
+		return d
+	}
+
+	for stat, val := range failureStats {
+		if _, ok := nonFailureStats[stat]; ok {
+			continue
+		}
+		count, ok := val.(float64)
+		if !ok || count <= 0 {
+			continue
+		}
+		d := get(failureStatDomain(stat))
+		d.Counters[stat] += uint64(count)
+		d.Count += uint64(count)
+	}
+
+	f.Lock()
+	defer f.Unlock()
+
+	for domain, counters := range f.counters {
+		d := get(domain)
+		for source, count := range counters {
+			d.Counters[source] += count
+			d.Count += count
+		}
+	}
+
+	for domain, samples := range f.samples {
+		d := get(domain)
+		d.RecentErrors = make([]*common.FailureSample, len(samples))
+		copy(d.RecentErrors, samples)
+	}
+	return domains
+}
@@ -0,0 +1,84 @@
+package consumer
+
+import (
+	"errors"
+	"sync/atomic"
+
+	"github.com/couchbase/eventing/common"
+	"github.com/couchbase/eventing/logging"
+	"github.com/couchbase/eventing/util"
+)
+
+var errConsumerFenced = errors.New("consumer fenced owing to metadata write failures")
+
+func (c *Consumer) isFenced() bool {
+	return atomic.LoadUint32(&c.fenced) == 1
+}
+
+// Fence stops processing and gives up ownership of all vbs owned by the consumer.
+// Checkpoint blobs are marked free as soon as metadata writes start going through
+func (c *Consumer) Fence() {
+	logPrefix := "Consumer::Fence"
+
+	if !atomic.CompareAndSwapUint32(&c.fenced, 0, 1) {
+		return
+	}
+
+	vbsOwned := c.getCurrentlyOwnedVbs()
+	logging.Warnf("%s [%s:%s:%d] Fencing consumer, giving up ownership of vbs len: %d dump: %s",
+		logPrefix, c.workerName, c.tcpPort, c.Pid(), len(vbsOwned), util.Condense(vbsOwned))
+
+	c.CloseAllRunningDcpFeeds()
+
+	for _, vb := range vbsOwned {
+		c.vbProcessingStats.updateVbStat(vb, "dcp_stream_status", dcpStreamStopped)
+	}
+
+	c.fenceWg.Add(1)
+	go c.relinquishVbs(vbsOwned)
+}
+
+func (c *Consumer) relinquishVbs(vbs []uint16) {
+	logPrefix := "Consumer::relinquishVbs"
+
+	defer c.fenceWg.Done()
+
+	for _, vb := range vbs {
+		vbKey := common.CheckpointBlobKey(c.app.AppName, vb)
+
+		vbBlob := vbucketKVBlob{
+			LastSeqNoProcessed: c.vbProcessingStats.getVbStat(vb, "last_processed_seq_no").(uint64),
+			ManifestUID:        c.vbProcessingStats.getVbStat(vb, "manifest_id").(string),
+		}
+
+		err := c.updateCheckpoint(vbKey, vb, &vbBlob)
+		if err == common.ErrRetryTimeout {
+			logging.Errorf("%s [%s:%s:%d] Exiting due to timeout", logPrefix, c.workerName, c.tcpPort, c.Pid())
+			return
+		}
+	}
+
+	logging.Infof("%s [%s:%s:%d] Marked checkpoint blobs free for vbs len: %d",
+		logPrefix, c.workerName, c.tcpPort, c.Pid(), len(vbs))
+}
+
+// Unfence gets the consumer to reclaim vbs assigned to it as per planner
+func (c *Consumer) Unfence() {
+	logPrefix := "Consumer::Unfence"
+
+	if !c.isFenced() {
+		return
+	}
+
+	// Ownership given up while fenced must be persisted before reclaiming it
+	c.fenceWg.Wait()
+	atomic.StoreUint32(&c.fenced, 0)
+
+	vbsToHandle := c.vbsToHandle()
+	logging.Infof("%s [%s:%s:%d] Unfencing consumer, reclaiming vbs len: %d dump: %s",
+		logPrefix, c.workerName, c.tcpPort, c.Pid(), len(vbsToHandle), util.Condense(vbsToHandle))
+
+	c.Lock()
+	c.vbsRemainingToRestream = append(c.vbsRemainingToRestream, vbsToHandle...)
+	c.Unlock()
+}
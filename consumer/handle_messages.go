@@ -13,7 +13,7 @@ import (
 	mcd "github.com/couchbase/eventing/dcp/transport"
 	"github.com/couchbase/eventing/dcp/transport/client"
 	"github.com/couchbase/eventing/logging"
-	"github.com/google/flatbuffers/go"
+	"github.com/couchbase/eventing/util"
 )
 
 func (c *Consumer) sendLogLevel(logLevel string, sendToDebugger bool) {
@@ -67,7 +67,7 @@ func (c *Consumer) sendTimerContextSize(timerContextSize int64, sendToDebugger b
 
 func (c *Consumer) sendWorkerThrCount(thrCount int, sendToDebugger bool) {
 	var header []byte
-	var hBuilder *flatbuffers.Builder
+	var hBuilder *pooledBuilder
 	if sendToDebugger {
 		header, hBuilder = c.makeThrCountHeader(strconv.Itoa(thrCount))
 	} else {
@@ -97,7 +97,7 @@ func (c *Consumer) sendWorkerThrMap(thrPartitionMap map[int][]uint16, sendToDebu
 	header, hBuilder := c.makeThrMapHeader()
 
 	var payload []byte
-	var pBuilder *flatbuffers.Builder
+	var pBuilder *pooledBuilder
 	if sendToDebugger {
 		payload, pBuilder = c.makeThrMapPayload(thrPartitionMap, c.numVbuckets)
 	} else {
@@ -125,6 +125,86 @@ func (c *Consumer) sendWorkerThrMap(thrPartitionMap map[int][]uint16, sendToDebu
 	c.sendMessage(m)
 }
 
+func (c *Consumer) sendExecutionTimeout(executionTimeout int) {
+	logPrefix := "Consumer::sendExecutionTimeout"
+
+	header, hBuilder := c.makeExecutionTimeoutHeader(strconv.Itoa(executionTimeout))
+
+	c.msgProcessedRWMutex.Lock()
+	if _, ok := c.v8WorkerMessagesProcessed["execution_timeout"]; !ok {
+		c.v8WorkerMessagesProcessed["execution_timeout"] = 0
+	}
+	c.v8WorkerMessagesProcessed["execution_timeout"]++
+	c.msgProcessedRWMutex.Unlock()
+
+	m := &msgToTransmit{
+		msg: &message{
+			Header: header,
+		},
+		prioritize:    true,
+		headerBuilder: hBuilder,
+	}
+
+	logging.Infof("%s [%s:%s:%d] Sending execution timeout: %d",
+		logPrefix, c.workerName, c.tcpPort, c.Pid(), executionTimeout)
+
+	c.sendMessage(m)
+}
+
+func (c *Consumer) sendSocketBatchSize(batchSize int) {
+	logPrefix := "Consumer::sendSocketBatchSize"
+
+	header, hBuilder := c.makeSocketBatchSizeHeader(strconv.Itoa(batchSize))
+
+	c.msgProcessedRWMutex.Lock()
+	if _, ok := c.v8WorkerMessagesProcessed["sock_batch_size"]; !ok {
+		c.v8WorkerMessagesProcessed["sock_batch_size"] = 0
+	}
+	c.v8WorkerMessagesProcessed["sock_batch_size"]++
+	c.msgProcessedRWMutex.Unlock()
+
+	m := &msgToTransmit{
+		msg: &message{
+			Header: header,
+		},
+		prioritize:    true,
+		headerBuilder: hBuilder,
+	}
+
+	logging.Infof("%s [%s:%s:%d] Sending socket batch size: %d",
+		logPrefix, c.workerName, c.tcpPort, c.Pid(), batchSize)
+
+	c.sendMessage(m)
+}
+
+// sendDispatchLanes configures number of timer callbacks and DCP events a worker
+// thread dispatches in turns while a timer scan is in progress
+func (c *Consumer) sendDispatchLanes(timerBatchSize, dcpBatchSize int) {
+	logPrefix := "Consumer::sendDispatchLanes"
+
+	header, hBuilder := c.makeDispatchLanesHeader(fmt.Sprintf("%d:%d", timerBatchSize, dcpBatchSize))
+
+	c.msgProcessedRWMutex.Lock()
+	if _, ok := c.v8WorkerMessagesProcessed["dispatch_lanes"]; !ok {
+		c.v8WorkerMessagesProcessed["dispatch_lanes"] = 0
+	}
+	c.v8WorkerMessagesProcessed["dispatch_lanes"]++
+	c.msgProcessedRWMutex.Unlock()
+
+	m := &msgToTransmit{
+		msg: &message{
+			Header: header,
+		},
+		prioritize:    true,
+		headerBuilder: hBuilder,
+	}
+
+	logging.Infof("%s [%s:%s:%d] Sending timer lane batch size: %d dcp lane batch size: %d",
+		logPrefix, c.workerName, c.tcpPort, c.Pid(), timerBatchSize, dcpBatchSize)
+
+	c.sendMessage(m)
+}
+
 func (c *Consumer) sendWorkerMemQuota(memSize int64) {
 	header, hBuilder := c.makeHeader(appWorkerSetting, workerThreadMemQuota, 0, strconv.FormatInt(memSize, 10))
 	m := &msgToTransmit{
@@ -169,9 +249,9 @@ func (c *Consumer) SendAssignedVbs() {
 		logPrefix, c.workerName, c.tcpPort, c.Pid(), vbuckets)
 }
 
-func (c *Consumer) sendDebuggerStart() {
+func (c *Consumer) sendDebuggerStart(token string) {
 
-	header, hBuilder := c.makeV8DebuggerStartHeader()
+	header, hBuilder := c.makeV8DebuggerStartHeader(token)
 
 	c.msgProcessedRWMutex.Lock()
 	if _, ok := c.v8WorkerMessagesProcessed["debug_start"]; !ok {
@@ -215,7 +295,28 @@ func (c *Consumer) sendDebuggerStop() {
 	c.sendMessage(m)
 }
 
-func (c *Consumer) sendInitV8Worker(payload []byte, sendToDebugger bool, pBuilder *flatbuffers.Builder) {
+func (c *Consumer) sendCancelTimer(meta string) {
+	header, hBuilder := c.makeCancelTimerHeader(meta)
+
+	c.msgProcessedRWMutex.Lock()
+	if _, ok := c.v8WorkerMessagesProcessed["cancel_timer"]; !ok {
+		c.v8WorkerMessagesProcessed["cancel_timer"] = 0
+	}
+	c.v8WorkerMessagesProcessed["cancel_timer"]++
+	c.msgProcessedRWMutex.Unlock()
+
+	m := &msgToTransmit{
+		msg: &message{
+			Header: header,
+		},
+		prioritize:    true,
+		headerBuilder: hBuilder,
+	}
+
+	c.sendMessage(m)
+}
+
+func (c *Consumer) sendInitV8Worker(payload []byte, sendToDebugger bool, pBuilder *pooledBuilder) {
 
 	header, hBuilder := c.makeV8InitOpcodeHeader()
 
@@ -263,6 +364,15 @@ func (c *Consumer) sendCompileRequest(appCode string) {
 }
 
 func (c *Consumer) sendLoadV8Worker(appCode string, sendToDebugger bool) {
+	if !sendToDebugger {
+		c.loadedAppCode.Store(appCode)
+	}
+
+	if !sendToDebugger && len(appCode) > loadChunkSize && c.supportsChunkedLoad() {
+		atomic.StoreInt32(&c.loadChunkAttempts, 1)
+		c.sendLoadV8WorkerChunks(appCode, nil)
+		return
+	}
 
 	header, hBuilder := c.makeV8LoadOpcodeHeader(appCode)
 
@@ -329,6 +439,28 @@ func (c *Consumer) refreshCurlLatencyStats() {
 	c.sendMessage(m)
 }
 
+func (c *Consumer) refreshN1qlLatencyStats() {
+	header, hBuilder := c.makeHeader(v8WorkerEvent, v8WorkerN1qlLatencyStats, 0, "")
+
+	c.msgProcessedRWMutex.Lock()
+	if _, ok := c.v8WorkerMessagesProcessed["n1ql_latency_stats"]; !ok {
+		c.v8WorkerMessagesProcessed["n1ql_latency_stats"] = 0
+	}
+	c.v8WorkerMessagesProcessed["n1ql_latency_stats"]++
+	c.msgProcessedRWMutex.Unlock()
+
+	m := &msgToTransmit{
+		msg: &message{
+			Header: header,
+		},
+		sendToDebugger: false,
+		prioritize:     true,
+		headerBuilder:  hBuilder,
+	}
+
+	c.sendMessage(m)
+}
+
 func (c *Consumer) refreshInsight() {
 	header, hBuilder := c.makeHeader(v8WorkerEvent, v8WorkerInsight, 0, "")
 
@@ -445,7 +577,7 @@ func (c *Consumer) sendNoOpEvent(seqNo uint64, partition uint16) {
 	c.sendMessage(msg)
 }
 
-func (c *Consumer) sendDcpEvent(e *memcached.DcpEvent, sendToDebugger bool) {
+func (c *Consumer) sendDcpEvent(e *memcached.DcpEvent, prefetched map[string]json.RawMessage, sendToDebugger bool) {
 	m := dcpMetadata{
 		Cas:     strconv.FormatUint(e.Cas, 10),
 		DocID:   string(e.Key),
@@ -455,6 +587,10 @@ func (c *Consumer) sendDcpEvent(e *memcached.DcpEvent, sendToDebugger bool) {
 		SeqNo:   e.Seqno,
 	}
 
+	if collection, ok := c.srcCids[e.CollectionID]; ok {
+		m.Scope, m.Collection = c.sourceKeyspace.ScopeName, collection
+	}
+
 	isBinary := e.Datatype == dcpDatatypeBinary || e.Datatype == dcpDatatypeBinXattr
 	if e.Opcode == mcd.DCP_MUTATION {
 		if isBinary {
@@ -462,6 +598,20 @@ func (c *Consumer) sendDcpEvent(e *memcached.DcpEvent, sendToDebugger bool) {
 		} else {
 			m.Type = "json"
 		}
+		m.Prefetched = prefetched
+		m.Origin = e.Origin
+	}
+
+	if e.Opcode == mcd.DCP_DELETION || e.Opcode == mcd.DCP_EXPIRATION {
+		switch {
+		case e.Opcode == mcd.DCP_EXPIRATION:
+			m.DeletionSource = deletionSourceExpiry
+		case e.FromDisk:
+			m.DeletionSource = deletionSourcePurge
+		default:
+			m.DeletionSource = deletionSourceDelete
+		}
+		m.TombstoneXattrs = userXattrs(c.getXattrs(e))
 	}
 
 	metadata, err := json.Marshal(&m)
@@ -473,13 +623,14 @@ func (c *Consumer) sendDcpEvent(e *memcached.DcpEvent, sendToDebugger bool) {
 	}
 
 	var dcpHeader, payload []byte
-	var hBuilder, pBuilder *flatbuffers.Builder
+	var hBuilder, pBuilder *pooledBuilder
 	if e.Opcode == mcd.DCP_MUTATION {
 		dcpHeader, hBuilder = c.makeDcpMutationHeader(int16(e.VBucket), string(metadata))
-		payload, pBuilder = c.makeDcpPayload(e.Key, e.Value, isBinary)
+		payload, pBuilder = c.makeDcpPayload(e.Key, e.Value, e.Xattrs, isBinary)
 	} else if e.Opcode == mcd.DCP_DELETION || e.Opcode == mcd.DCP_EXPIRATION {
+		expired := e.Opcode == mcd.DCP_EXPIRATION
 		optionMap := map[string]interface{}{
-			"expired": e.Opcode == mcd.DCP_EXPIRATION,
+			"expired": expired,
 		}
 		options, err := json.Marshal(&optionMap)
 		if err != nil {
@@ -488,8 +639,8 @@ func (c *Consumer) sendDcpEvent(e *memcached.DcpEvent, sendToDebugger bool) {
 			return
 		}
 
-		dcpHeader, hBuilder = c.makeDcpDeletionHeader(int16(e.VBucket), string(metadata))
-		payload, pBuilder = c.makeDcpPayload(e.Key, options, false)
+		dcpHeader, hBuilder = c.makeDcpDeletionHeader(int16(e.VBucket), string(metadata), expired)
+		payload, pBuilder = c.makeDcpPayload(e.Key, options, nil, false)
 	}
 
 	msg := &msgToTransmit{
@@ -504,12 +655,59 @@ func (c *Consumer) sendDcpEvent(e *memcached.DcpEvent, sendToDebugger bool) {
 	}
 	if !sendToDebugger {
 		c.vbProcessingStats.updateVbStat(e.VBucket, "last_sent_seq_no", e.Seqno)
+		c.lastDispatched.add(e.Key, e.VBucket, e.Seqno, e.Opcode)
+		c.replayRings.add(e)
 	}
 	c.sentEventsSize += int64(len(dcpHeader) + len(payload))
 	c.numSentEvents++
 	c.sendMessage(msg)
 }
 
+// getXattrs returns xattrs carried by a mutation, or retained in tombstone of a deleted
+// or expired document. Xattrs whose value isn't valid json are left out
+func (c *Consumer) getXattrs(e *memcached.DcpEvent) map[string]json.RawMessage {
+	logPrefix := "Consumer::getXattrs"
+
+	if e.Datatype&uint8(includeXATTRs) == 0 {
+		return nil
+	}
+
+	_, xattrs, err := util.ParseXattrs(e.Value)
+	if err != nil {
+		c.dcpXattrParseError++
+		logging.Errorf("%s [%s:%s:%d] key: %ru failed to parse xattrs, err: %v",
+			logPrefix, c.workerName, c.tcpPort, c.Pid(), string(e.Key), err)
+		return nil
+	}
+
+	tombstoneXattrs := make(map[string]json.RawMessage)
+	for key, value := range xattrs {
+		if json.Valid(value) {
+			tombstoneXattrs[key] = json.RawMessage(value)
+		}
+	}
+	return tombstoneXattrs
+}
+
+// getMutationXattrs returns xattrs of a mutation encoded as json object, to be passed
+// on to handler along with the document
+func (c *Consumer) getMutationXattrs(e *memcached.DcpEvent) []byte {
+	logPrefix := "Consumer::getMutationXattrs"
+
+	xattrs := c.getXattrs(e)
+	if len(xattrs) == 0 {
+		return nil
+	}
+
+	data, err := json.Marshal(xattrs)
+	if err != nil {
+		logging.Errorf("%s [%s:%s:%d] key: %ru failed to marshal xattrs, err: %v",
+			logPrefix, c.workerName, c.tcpPort, c.Pid(), string(e.Key), err)
+		return nil
+	}
+	return data
+}
+
 func (c *Consumer) sendVbFilterData(vb uint16, seqNo uint64, skipAck bool) {
 	logPrefix := "Consumer::sendVbFilterData"
 
@@ -520,6 +718,9 @@ func (c *Consumer) sendVbFilterData(vb uint16, seqNo uint64, skipAck bool) {
 
 	if skipAck {
 		data.SkipAck = 1
+	} else {
+		// cpp worker acks once it's done with the vb, including its timer partition
+		c.timerTransferTimings.start(vb)
 	}
 
 	metadata, err := json.Marshal(&data)
@@ -632,9 +833,11 @@ func (c *Consumer) sendMessageLoop() {
 						return
 					}
 
-					err := io.ErrShortWrite
-					for ; err == io.ErrShortWrite; _, err = c.sendMsgBuffer.WriteTo(c.conn) {
-					}
+					c.msgBatch.seal(&c.sendMsgBuffer, c.frameChecksumsNegotiated())
+					buffers := c.msgBatch.buffers(&c.sendMsgBuffer)
+					n, err := buffers.WriteTo(c.conn)
+					atomic.AddUint64(&c.networkStats.workerOut, uint64(n))
+					c.msgBatch.reset()
 
 					if err != nil {
 						logging.Errorf("%s [%s:%s:%d] stoppingConsumer: %t write to downstream socket failed, err: %v",
@@ -646,7 +849,7 @@ func (c *Consumer) sendMessageLoop() {
 						}
 
 						c.stoppingConsumer = true
-						c.producer.KillAndRespawnEventingConsumer(c)
+						c.respawnWorker(fmt.Sprintf("write to worker socket failed, err: %v", err))
 					}
 
 					// Reset the sendMessage buffer and message counter
@@ -682,47 +885,74 @@ func (c *Consumer) sendMessage(m *msgToTransmit) error {
 
 	// Protocol encoding format:
 	//<headerSize><payloadSize><Header><Payload>
+	// Once negotiated with worker, messages batched up to sock_batch_size are packed
+	// into a single batch frame:
+	//<batchFrameFlag|batchSize><Batch>
+
+	// Large payloads aren't copied into send buffer, those are written to the socket
+	// right away, following messages batched ahead of them. Those go in batch frames
+	// if frames are checksummed, so that they're covered by it
+	directWrite := len(m.msg.Payload) >= directWritePayloadThreshold && !m.sendToDebugger && !c.frameChecksumsNegotiated()
 
 	c.sendMsgBufferRWMutex.Lock()
 	defer c.sendMsgBufferRWMutex.Unlock()
-	err := binary.Write(&c.sendMsgBuffer, binary.LittleEndian, uint32(len(m.msg.Header)))
-	if err != nil {
-		logging.Errorf("%s [%s:%s:%d] Failure while writing header size, err : %v",
-			logPrefix, c.workerName, c.tcpPort, c.Pid(), err)
-		return err
-	}
 
-	err = binary.Write(&c.sendMsgBuffer, binary.LittleEndian, uint32(len(m.msg.Payload)))
-	if err != nil {
-		logging.Errorf("%s [%s:%s:%d] Failure while writing payload size, err: %v",
-			logPrefix, c.workerName, c.tcpPort, c.Pid(), err)
-		return err
-	}
+	if !directWrite && c.batchFramesNegotiated() {
+		c.msgBatch.add(m.msg, &c.sendMsgBuffer)
+	} else {
+		c.msgBatch.seal(&c.sendMsgBuffer, c.frameChecksumsNegotiated())
 
-	err = binary.Write(&c.sendMsgBuffer, binary.LittleEndian, m.msg.Header)
-	if err != nil {
-		logging.Errorf("%s [%s:%s:%d] Failure while writing encoded header, err: %v",
-			logPrefix, c.workerName, c.tcpPort, c.Pid(), err)
-		return err
-	}
+		err := binary.Write(&c.sendMsgBuffer, binary.LittleEndian, uint32(len(m.msg.Header)))
+		if err != nil {
+			logging.Errorf("%s [%s:%s:%d] Failure while writing header size, err : %v",
+				logPrefix, c.workerName, c.tcpPort, c.Pid(), err)
+			return err
+		}
 
-	err = binary.Write(&c.sendMsgBuffer, binary.LittleEndian, m.msg.Payload)
-	if err != nil {
-		logging.Errorf("%s [%s:%s:%d] Failure while writing encoded payload, err: %v",
-			logPrefix, c.workerName, c.tcpPort, c.Pid(), err)
-		return err
+		err = binary.Write(&c.sendMsgBuffer, binary.LittleEndian, uint32(len(m.msg.Payload)))
+		if err != nil {
+			logging.Errorf("%s [%s:%s:%d] Failure while writing payload size, err: %v",
+				logPrefix, c.workerName, c.tcpPort, c.Pid(), err)
+			return err
+		}
+
+		// Byte slices are written as is, binary.Write would allocate a copy of them
+		_, err = c.sendMsgBuffer.Write(m.msg.Header)
+		if err != nil {
+			logging.Errorf("%s [%s:%s:%d] Failure while writing encoded header, err: %v",
+				logPrefix, c.workerName, c.tcpPort, c.Pid(), err)
+			return err
+		}
+
+		if !directWrite {
+			_, err = c.sendMsgBuffer.Write(m.msg.Payload)
+			if err != nil {
+				logging.Errorf("%s [%s:%s:%d] Failure while writing encoded payload, err: %v",
+					logPrefix, c.workerName, c.tcpPort, c.Pid(), err)
+				return err
+			}
+		}
 	}
 
 	c.sendMsgCounter++
 
-	if c.sendMsgCounter >= uint64(c.socketWriteBatchSize) || m.prioritize || m.sendToDebugger {
+	if c.sendMsgCounter >= uint64(c.effectiveSocketBatchSize()) || m.prioritize || m.sendToDebugger || directWrite {
+		c.msgBatch.seal(&c.sendMsgBuffer, c.frameChecksumsNegotiated())
+		buffers := c.msgBatch.buffers(&c.sendMsgBuffer)
+		if directWrite {
+			buffers = append(buffers, m.msg.Payload)
+		}
+		defer c.msgBatch.reset()
+
 		c.connMutex.Lock()
 		defer c.connMutex.Unlock()
 
 		if !m.sendToDebugger && c.conn != nil {
 
-			err := io.ErrShortWrite
-			for ; err == io.ErrShortWrite; _, err = c.sendMsgBuffer.WriteTo(c.conn) {
+			n, err := buffers.WriteTo(c.conn)
+			atomic.AddUint64(&c.networkStats.workerOut, uint64(n))
+			if directWrite {
+				c.directWritePayloadCounter++
 			}
 
 			if err != nil {
@@ -741,11 +971,11 @@ func (c *Consumer) sendMessage(m *msgToTransmit) error {
 					return err
 				}
 
-				c.producer.KillAndRespawnEventingConsumer(c)
+				c.respawnWorker(fmt.Sprintf("write to worker socket failed, err: %v", err))
 				return err
 			}
 		} else if c.debugConn != nil {
-			_, err := c.sendMsgBuffer.WriteTo(c.debugConn)
+			_, err := buffers.WriteTo(c.debugConn)
 			if err != nil {
 				logging.Errorf("%s [%s:%s:%d] Write to debug enabled worker socket failed, err: %v",
 					logPrefix, c.workerName, c.debugTCPPort, c.Pid(), err)
@@ -757,6 +987,7 @@ func (c *Consumer) sendMessage(m *msgToTransmit) error {
 		// Reset the sendMessage buffer and message counter
 		c.aggMessagesSentCounter += c.sendMsgCounter
 		c.sendMsgBuffer.Reset()
+		c.shrinkSendBuffer()
 		c.sendMsgCounter = 0
 	}
 
@@ -793,6 +1024,7 @@ func (c *Consumer) feedbackReadMessageLoop(feedbackReader *bufio.Reader) {
 		}
 
 		c.adhocTimerResponsesRecieved++
+		atomic.AddUint64(&c.networkStats.workerIn, uint64(bytesRead))
 
 		if bytesRead < len(buffer) {
 			buffer = buffer[:bytesRead]
@@ -807,10 +1039,16 @@ func (c *Consumer) feedbackReadMessageLoop(feedbackReader *bufio.Reader) {
 			}
 
 			headerSize := binary.LittleEndian.Uint32(buffer[:headerFragmentSize])
+			batch := headerSize&batchFrameFlag != 0
+			checksum := headerSize&checksumFrameFlag != 0
+			headerSize &^= batchFrameFlag | checksumFrameFlag
+			if checksum {
+				headerSize += checksumSize
+			}
 
 			if len(buffer) >= int(headerFragmentSize+headerSize) {
 
-				c.parseWorkerResponse(buffer[headerFragmentSize : headerFragmentSize+headerSize])
+				c.parseWorkerFrame(buffer[headerFragmentSize:headerFragmentSize+headerSize], batch, checksum)
 				buffer = buffer[headerFragmentSize+headerSize:]
 
 				c.feedbackReadMsgBuffer.Write(buffer)
@@ -855,6 +1093,7 @@ func (c *Consumer) readMessageLoop() {
 				logPrefix, c.workerName, c.tcpPort, c.Pid(), err)
 			return
 		}
+		atomic.AddUint64(&c.networkStats.workerIn, uint64(bytesRead))
 
 		if bytesRead < len(buffer) {
 			buffer = buffer[:bytesRead]
@@ -869,10 +1108,16 @@ func (c *Consumer) readMessageLoop() {
 			}
 
 			headerSize := binary.LittleEndian.Uint32(buffer[:headerFragmentSize])
+			batch := headerSize&batchFrameFlag != 0
+			checksum := headerSize&checksumFrameFlag != 0
+			headerSize &^= batchFrameFlag | checksumFrameFlag
+			if checksum {
+				headerSize += checksumSize
+			}
 
 			if len(buffer) >= int(headerFragmentSize+headerSize) {
 
-				c.parseWorkerResponse(buffer[headerFragmentSize : headerFragmentSize+headerSize])
+				c.parseWorkerFrame(buffer[headerFragmentSize:headerFragmentSize+headerSize], batch, checksum)
 				buffer = buffer[headerFragmentSize+headerSize:]
 
 				c.readMsgBuffer.Write(buffer)
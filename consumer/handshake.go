@@ -0,0 +1,142 @@
+package consumer
+
+import (
+	"encoding/json"
+	"sync/atomic"
+	"time"
+
+	"github.com/couchbase/eventing/common"
+	"github.com/couchbase/eventing/logging"
+)
+
+const (
+	// Version of message set spoken with cpp worker, to be bumped whenever messages
+	// change in ways older workers would misinterpret. Should be in sync with
+	// PROTOCOL_VERSION on cpp side
+	workerProtocolVersion = 5
+
+	// Oldest protocol version consumer can still speak, workers which don't
+	// handshake are assumed to speak it
+	minWorkerProtocolVersion = 1
+
+	// Messages are batched into a single frame since this version
+	protocolVersionBatchFrames = 2
+
+	// Batch frames could carry checksums since this version
+	protocolVersionFrameChecksums = 3
+
+	// Workers could stamp docs they write with origin tag since this version
+	protocolVersionOriginTags = 4
+
+	// Expirations are sent with their own dcp opcode since this version, older
+	// workers would drop them as unknown
+	protocolVersionExpirationOpcode = 5
+
+	// Time to wait for handshake ack from cpp worker before assuming it predates
+	// handshake
+	handshakeWaitTimeout = 10 * time.Second
+)
+
+type protocolHandshake struct {
+	Version        int    `json:"protocol_version"`
+	MinVersion     int    `json:"min_protocol_version"`
+	FrameChecksums bool   `json:"frame_checksums"`
+	OriginTag      string `json:"origin_tag,omitempty"`
+}
+
+type protocolHandshakeAck struct {
+	Version           int  `json:"protocol_version"`
+	MinVersion        int  `json:"min_protocol_version"`
+	NegotiatedVersion int  `json:"negotiated_version"`
+	FrameChecksums    bool `json:"frame_checksums"`
+	OriginTagging     bool `json:"origin_tagging"`
+}
+
+// negotiateProtocol settles on protocol version with cpp worker before anything else
+// is sent to it, so that mismatched binaries during rolling upgrade either fall back
+// to a message set both understand or fail fast
+func (c *Consumer) negotiateProtocol() error {
+	logPrefix := "Consumer::negotiateProtocol"
+
+	// Consumer handshakes afresh with every worker spawned for it
+	atomic.StoreUint32(&c.protocolVersion, 0)
+	atomic.StoreUint32(&c.frameChecksums, 0)
+	select {
+	case <-c.signalHandshakeCh:
+	default:
+	}
+
+	request := &protocolHandshake{
+		Version:        workerProtocolVersion,
+		MinVersion:     minWorkerProtocolVersion,
+		FrameChecksums: c.frameChecksumsWanted,
+	}
+	if c.originTagging {
+		request.OriginTag = c.functionInstanceID()
+	}
+	handshake, _ := json.Marshal(request)
+
+	header, hBuilder := c.makeHeader(v8WorkerEvent, v8WorkerHandshake, 0, string(handshake))
+	c.sendMessage(&msgToTransmit{
+		msg: &message{
+			Header: header,
+		},
+		prioritize:    true,
+		headerBuilder: hBuilder,
+	})
+
+	select {
+	case ack := <-c.signalHandshakeCh:
+		if ack.NegotiatedVersion < minWorkerProtocolVersion || ack.NegotiatedVersion > workerProtocolVersion {
+			logging.Errorf("%s [%s:%s:%d] No protocol version in common with worker, consumer speaks versions %d to %d, worker speaks %d to %d",
+				logPrefix, c.workerName, c.tcpPort, c.Pid(), minWorkerProtocolVersion, workerProtocolVersion,
+				ack.MinVersion, ack.Version)
+			return common.ErrWorkerProtocolMismatch
+		}
+		atomic.StoreUint32(&c.protocolVersion, uint32(ack.NegotiatedVersion))
+
+		if c.frameChecksumsWanted && ack.FrameChecksums && ack.NegotiatedVersion >= protocolVersionFrameChecksums {
+			atomic.StoreUint32(&c.frameChecksums, 1)
+		} else if c.frameChecksumsWanted {
+			logging.Warnf("%s [%s:%s:%d] Worker doesn't checksum frames, continuing without worker_frame_checksums",
+				logPrefix, c.workerName, c.tcpPort, c.Pid())
+		}
+
+		// Docs stamped by other workers of function are still dropped, only writes of
+		// this one go untagged
+		if c.originTagging && (!ack.OriginTagging || ack.NegotiatedVersion < protocolVersionOriginTags) {
+			logging.Warnf("%s [%s:%s:%d] Worker doesn't stamp origin tag on writes, its writes won't be suppressed by origin_tagging",
+				logPrefix, c.workerName, c.tcpPort, c.Pid())
+		}
+
+	case <-time.After(handshakeWaitTimeout):
+		logging.Warnf("%s [%s:%s:%d] No handshake ack received from worker, falling back to protocol version: %d",
+			logPrefix, c.workerName, c.tcpPort, c.Pid(), minWorkerProtocolVersion)
+		atomic.StoreUint32(&c.protocolVersion, minWorkerProtocolVersion)
+	}
+
+	logging.Infof("%s [%s:%s:%d] Negotiated protocol version: %d frame checksums: %t",
+		logPrefix, c.workerName, c.tcpPort, c.Pid(), atomic.LoadUint32(&c.protocolVersion), c.frameChecksumsNegotiated())
+	return nil
+}
+
+func (c *Consumer) handleHandshakeAck(msg string) {
+	logPrefix := "Consumer::handleHandshakeAck"
+
+	ack := &protocolHandshakeAck{}
+	if err := json.Unmarshal([]byte(msg), ack); err != nil {
+		logging.Errorf("%s [%s:%s:%d] Failed to unmarshal handshake ack, msg: %v err: %v",
+			logPrefix, c.workerName, c.tcpPort, c.Pid(), msg, err)
+		return
+	}
+
+	select {
+	case c.signalHandshakeCh <- ack:
+	default:
+	}
+}
+
+// batchFramesNegotiated tells if worker understands messages batched into a single frame
+func (c *Consumer) batchFramesNegotiated() bool {
+	return atomic.LoadUint32(&c.protocolVersion) >= protocolVersionBatchFrames
+}
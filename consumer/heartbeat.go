@@ -0,0 +1,44 @@
+package consumer
+
+import (
+	"time"
+
+	"github.com/couchbase/eventing/common"
+)
+
+// sendHeartbeat reports progress of the consumer to producer. It's sent from control
+// routine, so that producer gets to notice if the routine gets stuck
+func (c *Consumer) sendHeartbeat() {
+	now := time.Now()
+	ownedVbs := c.getCurrentlyOwnedVbs()
+
+	var processed uint64
+	for _, vb := range ownedVbs {
+		processed += c.vbProcessingStats.getVbStat(vb, "last_processed_seq_no").(uint64)
+	}
+
+	heartbeat := &common.ConsumerHeartbeat{
+		Worker:     c.workerName,
+		Pid:        c.Pid(),
+		Timestamp:  now,
+		OwnedVbs:   len(ownedVbs),
+		QueueDepth: int64(len(c.aggDCPFeed)),
+	}
+
+	// Processed seq nos drop as vbs are given up, rate is reported as 0 then
+	if elapsed := now.Sub(c.heartbeatTs).Seconds(); !c.heartbeatTs.IsZero() && elapsed > 0 && processed >= c.heartbeatProcessed {
+		heartbeat.ProcessedPerSec = uint64(float64(processed-c.heartbeatProcessed) / elapsed)
+	}
+	c.heartbeatTs = now
+	c.heartbeatProcessed = processed
+
+	if c.cppQueueSizes != nil {
+		heartbeat.QueueDepth += c.cppQueueSizes.AggQueueSize
+	}
+
+	if ts, ok := c.workerRespMainLoopTs.Load().(time.Time); ok {
+		heartbeat.LastWorkerResponse = ts
+	}
+
+	c.producer.ConsumerHeartbeat(heartbeat)
+}
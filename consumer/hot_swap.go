@@ -0,0 +1,52 @@
+package consumer
+
+import (
+	"time"
+
+	"github.com/couchbase/eventing/common"
+	"github.com/couchbase/eventing/logging"
+)
+
+// Time hot swap waits for C++ v8 worker to report compile status of handler code
+const hotSwapCompileTimeout = 30 * time.Second
+
+// HotSwapAppCode compile checks handler code on C++ v8 worker and, if it compiles,
+// loads it in place of the running one. DCP streams and vbucket ownership are left
+// untouched. Returned status carries compile error if code didn't get loaded
+func (c *Consumer) HotSwapAppCode(appCode string) (*common.CompileStatus, error) {
+	logPrefix := "Consumer::HotSwapAppCode"
+
+	c.hotSwapMutex.Lock()
+	defer c.hotSwapMutex.Unlock()
+
+	// Drop compile status left over from an earlier request that timed out
+	select {
+	case <-c.signalCompileInfoCh:
+	default:
+	}
+
+	c.sendCompileRequest(appCode)
+
+	var status *common.CompileStatus
+	select {
+	case status = <-c.signalCompileInfoCh:
+	case <-time.After(hotSwapCompileTimeout):
+		logging.Errorf("%s [%s:%s:%d] No compile status from worker within: %v",
+			logPrefix, c.workerName, c.tcpPort, c.Pid(), hotSwapCompileTimeout)
+		return nil, common.ErrCompileTimeout
+	case <-c.ctx.Done():
+		return nil, common.ErrConsumerStopped
+	}
+
+	if !status.CompileSuccess {
+		logging.Errorf("%s [%s:%s:%d] Handler code failed to compile, line: %d column: %d err: %s",
+			logPrefix, c.workerName, c.tcpPort, c.Pid(), status.Line, status.Column, status.Description)
+		return status, nil
+	}
+
+	c.sendLoadV8Worker(appCode, false)
+
+	logging.Infof("%s [%s:%s:%d] Loaded handler code of size: %d",
+		logPrefix, c.workerName, c.tcpPort, c.Pid(), len(appCode))
+	return status, nil
+}
@@ -0,0 +1,274 @@
+package consumer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/couchbase/eventing/common"
+	mcd "github.com/couchbase/eventing/dcp/transport"
+	"github.com/couchbase/eventing/logging"
+)
+
+const (
+	incidentStderrLines     = 200
+	incidentDispatchedCount = 100
+
+	// Stderr lines of cpp worker handed over to producer along with its exit
+	workerExitStderrLines = 20
+
+	// Caps on incident records retained per function
+	incidentsToRetain    = 10
+	incidentMaxSize      = 1024 * 1024
+	incidentsMaxDirBytes = 8 * 1024 * 1024
+)
+
+// Vb stats captured in incident records, for vbs owned by the worker
+var incidentVbStats = []string{
+	"dcp_stream_status",
+	"last_read_seq_no",
+	"last_sent_seq_no",
+	"last_processed_seq_no",
+	"last_checkpointed_seq_no",
+}
+
+// lineRing retains last few lines written by cpp worker to stderr
+type lineRing struct {
+	sync.Mutex
+	lines []string
+	next  int
+}
+
+func newLineRing(size int) *lineRing {
+	return &lineRing{
+		lines: make([]string, 0, size),
+	}
+}
+
+func (r *lineRing) add(line string) {
+	r.Lock()
+	defer r.Unlock()
+
+	if len(r.lines) < cap(r.lines) {
+		r.lines = append(r.lines, line)
+		return
+	}
+	r.lines[r.next] = line
+	r.next = (r.next + 1) % len(r.lines)
+}
+
+// snapshot returns retained lines, oldest first
+func (r *lineRing) snapshot() []string {
+	r.Lock()
+	defer r.Unlock()
+
+	lines := make([]string, 0, len(r.lines))
+	lines = append(lines, r.lines[r.next:]...)
+	return append(lines, r.lines[:r.next]...)
+}
+
+// dispatchRing retains keys of last few DCP events sent to cpp worker
+type dispatchRing struct {
+	sync.Mutex
+	events []*common.DispatchedEvent
+	next   int
+}
+
+func newDispatchRing(size int) *dispatchRing {
+	return &dispatchRing{
+		events: make([]*common.DispatchedEvent, 0, size),
+	}
+}
+
+func (r *dispatchRing) add(key []byte, vb uint16, seqNo uint64, opcode mcd.CommandCode) {
+	event := &common.DispatchedEvent{
+		Key:       string(key),
+		Vbucket:   vb,
+		SeqNo:     seqNo,
+		Opcode:    mcd.CommandNames[opcode],
+		Timestamp: time.Now().Format(time.RFC3339Nano),
+	}
+
+	r.Lock()
+	defer r.Unlock()
+
+	if len(r.events) < cap(r.events) {
+		r.events = append(r.events, event)
+		return
+	}
+	r.events[r.next] = event
+	r.next = (r.next + 1) % len(r.events)
+}
+
+func (r *dispatchRing) snapshot() []*common.DispatchedEvent {
+	r.Lock()
+	defer r.Unlock()
+
+	events := make([]*common.DispatchedEvent, 0, len(r.events))
+	events = append(events, r.events[r.next:]...)
+	return append(events, r.events[:r.next]...)
+}
+
+// respawnWorker captures an incident record of the cpp worker prior to getting it
+// respawned by producer
+func (c *Consumer) respawnWorker(reason string) {
+	exit := c.workerExit(reason)
+	c.captureIncident(exit)
+	c.producer.KillAndRespawnEventingConsumer(c, exit)
+}
+
+// workerExit describes how cpp worker went down. Exit status is only known if the
+// worker exited on its own, otherwise it's yet to be killed by producer
+func (c *Consumer) workerExit(reason string) *common.WorkerExit {
+	exit := &common.WorkerExit{
+		Worker:    c.workerName,
+		Reason:    reason,
+		ExitCode:  -1,
+		Timestamp: time.Now(),
+	}
+
+	if c.workerExitStatus != "" {
+		exit.ExitStatus = c.workerExitStatus
+		exit.ExitCode = c.workerExitCode
+	}
+
+	stderr := c.workerStderr.snapshot()
+	if len(stderr) > workerExitStderrLines {
+		stderr = stderr[len(stderr)-workerExitStderrLines:]
+	}
+	exit.Stderr = stderr
+	return exit
+}
+
+func (c *Consumer) captureIncident(exit *common.WorkerExit) {
+	logPrefix := "Consumer::captureIncident"
+
+	if c.eventingDir == "" {
+		return
+	}
+
+	now := time.Now()
+	incident := &common.WorkerIncident{
+		ID:             fmt.Sprintf("%d_%s", now.UnixNano(), c.workerName),
+		Function:       c.app.AppName,
+		Worker:         c.workerName,
+		Pid:            c.Pid(),
+		Reason:         exit.Reason,
+		ExitStatus:     exit.ExitStatus,
+		Timestamp:      now.Format(time.RFC3339Nano),
+		Stderr:         c.workerStderr.snapshot(),
+		LastDispatched: c.lastDispatched.snapshot(),
+		VbStats:        make(map[uint16]map[string]interface{}),
+		QueueSizes:     c.incidentQueueSizes(),
+	}
+
+	for _, vb := range c.getCurrentlyOwnedVbs() {
+		stats := make(map[string]interface{}, len(incidentVbStats))
+		for _, stat := range incidentVbStats {
+			stats[stat] = c.vbProcessingStats.getVbStat(vb, stat)
+		}
+		incident.VbStats[vb] = stats
+	}
+
+	data, err := json.Marshal(incident)
+	if err != nil {
+		logging.Errorf("%s [%s:%s:%d] Failed to marshal incident record, err: %v",
+			logPrefix, c.workerName, c.tcpPort, c.Pid(), err)
+		return
+	}
+
+	// Older stderr lines give way first, followed by dispatched events
+	for len(data) > incidentMaxSize && (len(incident.Stderr) > 0 || len(incident.LastDispatched) > 0) {
+		incident.Truncated = true
+		if len(incident.Stderr) > 0 {
+			incident.Stderr = incident.Stderr[(len(incident.Stderr)+1)/2:]
+		} else {
+			incident.LastDispatched = incident.LastDispatched[(len(incident.LastDispatched)+1)/2:]
+		}
+
+		data, err = json.Marshal(incident)
+		if err != nil {
+			return
+		}
+	}
+
+	dir := filepath.Join(c.eventingDir, common.IncidentsDir, c.app.AppName)
+	err = os.MkdirAll(dir, 0755)
+	if err != nil {
+		logging.Errorf("%s [%s:%s:%d] Failed to create incidents dir: %s, err: %v",
+			logPrefix, c.workerName, c.tcpPort, c.Pid(), dir, err)
+		return
+	}
+
+	path := filepath.Join(dir, incident.ID+".json")
+	err = ioutil.WriteFile(path, data, 0640)
+	if err != nil {
+		logging.Errorf("%s [%s:%s:%d] Failed to write incident record: %s, err: %v",
+			logPrefix, c.workerName, c.tcpPort, c.Pid(), path, err)
+		return
+	}
+
+	logging.Infof("%s [%s:%s:%d] Captured incident record: %s reason: %s",
+		logPrefix, c.workerName, c.tcpPort, c.Pid(), incident.ID, exit.Reason)
+
+	pruneIncidents(dir)
+}
+
+func (c *Consumer) incidentQueueSizes() map[string]int64 {
+	sizes := map[string]int64{
+		"agg_dcp_feed_size":   int64(len(c.aggDCPFeed)),
+		"agg_dcp_feed_memory": c.aggDCPFeedMem,
+		"sent_events_size":    c.sentEventsSize,
+		"num_sent_events":     c.numSentEvents,
+	}
+
+	if c.cppQueueSizes != nil {
+		sizes["agg_queue_size"] = c.cppQueueSizes.AggQueueSize
+		sizes["agg_queue_memory"] = c.cppQueueSizes.AggQueueMemory
+		sizes["processed_events_size"] = c.cppQueueSizes.ProcessedEventsSize
+		sizes["num_processed_events"] = c.cppQueueSizes.NumProcessedEvents
+		sizes["feedback_queue_size"] = c.cppQueueSizes.FeedbackQueueSize
+	}
+	return sizes
+}
+
+// pruneIncidents drops oldest incident records of a function beyond count and size caps
+func pruneIncidents(dir string) {
+	logPrefix := "Consumer::pruneIncidents"
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return
+	}
+
+	records := make([]os.FileInfo, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".json") {
+			records = append(records, entry)
+		}
+	}
+
+	// Newest first
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].ModTime().After(records[j].ModTime())
+	})
+
+	var total int64
+	for i, record := range records {
+		total += record.Size()
+		if i < incidentsToRetain && total <= incidentsMaxDirBytes {
+			continue
+		}
+
+		path := filepath.Join(dir, record.Name())
+		if err := os.Remove(path); err != nil {
+			logging.Errorf("%s Failed to remove incident record: %s, err: %v", logPrefix, path, err)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package consumer
+
+import (
+	"bytes"
+	"regexp"
+
+	"github.com/couchbase/eventing/logging"
+)
+
+// keyFilter passes events whose key has one of key_prefixes or matches one of
+// key_patterns of depcfg. All keys pass if neither is set. Read-only once built
+type keyFilter struct {
+	prefixes [][]byte
+	patterns []*regexp.Regexp
+}
+
+func newKeyFilter(appName string, prefixes, patterns []string) *keyFilter {
+	logPrefix := "Consumer::newKeyFilter"
+
+	f := &keyFilter{}
+	for _, prefix := range prefixes {
+		f.prefixes = append(f.prefixes, []byte(prefix))
+	}
+
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			// Validated on deploy, so only possible with a hand edited payload
+			logging.Errorf("%s [%s] Skipping key pattern: %ru, err: %v", logPrefix, appName, pattern, err)
+			continue
+		}
+		f.patterns = append(f.patterns, re)
+	}
+	return f
+}
+
+func (f *keyFilter) match(key []byte) bool {
+	if len(f.prefixes) == 0 && len(f.patterns) == 0 {
+		return true
+	}
+
+	for _, prefix := range f.prefixes {
+		if bytes.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+
+	for _, re := range f.patterns {
+		if re.Match(key) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,180 @@
+package consumer
+
+import (
+	"encoding/json"
+	"hash/crc32"
+	"math"
+	"sync/atomic"
+	"time"
+
+	"github.com/couchbase/eventing/logging"
+)
+
+const (
+	// Handler code beyond this size is sent to cpp worker in chunks of this size,
+	// should be in sync with MAX_LOAD_CHUNK_SIZE on cpp side
+	loadChunkSize = 512 * 1024
+
+	maxLoadChunkAttempts = 3
+
+	// Time to wait for capabilities from cpp worker before falling back to
+	// single message load
+	capabilitiesWaitTimeout = 10 * time.Second
+)
+
+// Status of chunked load reported by cpp worker, any other status needs all chunks resent
+const (
+	loadChunkStatusLoaded  = "loaded"
+	loadChunkStatusMissing = "missing"
+)
+
+type workerCapabilitiesMsg struct {
+	ChunkedLoad      bool `json:"chunked_load"`
+	MaxLoadChunkSize int  `json:"max_load_chunk_size"`
+}
+
+type loadChunkCommit struct {
+	Chunks   int    `json:"chunks"`
+	Size     int    `json:"size"`
+	Checksum uint32 `json:"checksum"`
+}
+
+type loadChunkAckMsg struct {
+	Status  string  `json:"status"`
+	Missing []int16 `json:"missing"`
+}
+
+func (c *Consumer) handleWorkerCapabilities(msg string) {
+	logPrefix := "Consumer::handleWorkerCapabilities"
+
+	capabilities := &workerCapabilitiesMsg{}
+	if err := json.Unmarshal([]byte(msg), capabilities); err != nil {
+		logging.Errorf("%s [%s:%s:%d] Failed to unmarshal worker capabilities, msg: %v err: %v",
+			logPrefix, c.workerName, c.tcpPort, c.Pid(), msg, err)
+		return
+	}
+
+	logging.Infof("%s [%s:%s:%d] Worker capabilities: %+v",
+		logPrefix, c.workerName, c.tcpPort, c.Pid(), capabilities)
+
+	c.workerCapabilities.Store(capabilities)
+	select {
+	case c.signalCapabilitiesCh <- struct{}{}:
+	default:
+	}
+}
+
+// supportsChunkedLoad waits for capabilities advertised by cpp worker post init
+func (c *Consumer) supportsChunkedLoad() bool {
+	logPrefix := "Consumer::supportsChunkedLoad"
+
+	if _, ok := c.workerCapabilities.Load().(*workerCapabilitiesMsg); !ok {
+		select {
+		case <-c.signalCapabilitiesCh:
+		case <-time.After(capabilitiesWaitTimeout):
+			logging.Warnf("%s [%s:%s:%d] No capabilities received from worker, falling back to single message load",
+				logPrefix, c.workerName, c.tcpPort, c.Pid())
+			return false
+		}
+	}
+
+	capabilities, ok := c.workerCapabilities.Load().(*workerCapabilitiesMsg)
+	return ok && capabilities.ChunkedLoad && capabilities.MaxLoadChunkSize >= loadChunkSize
+}
+
+// sendLoadV8WorkerChunks sends handler code in chunks followed by a commit carrying
+// checksum of complete code. If chunks is non-empty, only those chunks are resent
+func (c *Consumer) sendLoadV8WorkerChunks(appCode string, chunks []int16) {
+	logPrefix := "Consumer::sendLoadV8WorkerChunks"
+
+	numChunks := (len(appCode) + loadChunkSize - 1) / loadChunkSize
+	if numChunks > math.MaxInt16 {
+		logging.Errorf("%s [%s:%s:%d] Handler code size: %d needs more than %d chunks",
+			logPrefix, c.workerName, c.tcpPort, c.Pid(), len(appCode), math.MaxInt16)
+		return
+	}
+
+	if len(chunks) == 0 {
+		for i := 0; i < numChunks; i++ {
+			chunks = append(chunks, int16(i))
+		}
+	}
+
+	logging.Infof("%s [%s:%s:%d] Sending %d of %d chunks of handler code, size: %d",
+		logPrefix, c.workerName, c.tcpPort, c.Pid(), len(chunks), numChunks, len(appCode))
+
+	for _, chunk := range chunks {
+		if int(chunk) >= numChunks {
+			continue
+		}
+
+		start := int(chunk) * loadChunkSize
+		end := start + loadChunkSize
+		if end > len(appCode) {
+			end = len(appCode)
+		}
+
+		header, hBuilder := c.makeHeader(v8WorkerEvent, v8WorkerLoadChunk, chunk, appCode[start:end])
+		c.sendMessage(&msgToTransmit{
+			msg: &message{
+				Header: header,
+			},
+			prioritize:    true,
+			headerBuilder: hBuilder,
+		})
+	}
+
+	commit, _ := json.Marshal(&loadChunkCommit{
+		Chunks:   numChunks,
+		Size:     len(appCode),
+		Checksum: crc32.ChecksumIEEE([]byte(appCode)),
+	})
+
+	c.msgProcessedRWMutex.Lock()
+	c.v8WorkerMessagesProcessed["v8_load"]++
+	c.msgProcessedRWMutex.Unlock()
+
+	header, hBuilder := c.makeHeader(v8WorkerEvent, v8WorkerLoadChunkCommit, 0, string(commit))
+	c.sendMessage(&msgToTransmit{
+		msg: &message{
+			Header: header,
+		},
+		prioritize:    true,
+		headerBuilder: hBuilder,
+	})
+}
+
+// handleLoadChunkAck resends missing or corrupted chunks, bounded by maxLoadChunkAttempts
+func (c *Consumer) handleLoadChunkAck(msg string) {
+	logPrefix := "Consumer::handleLoadChunkAck"
+
+	var ack loadChunkAckMsg
+	if err := json.Unmarshal([]byte(msg), &ack); err != nil {
+		logging.Errorf("%s [%s:%s:%d] Failed to unmarshal load chunk ack, msg: %v err: %v",
+			logPrefix, c.workerName, c.tcpPort, c.Pid(), msg, err)
+		return
+	}
+
+	if ack.Status == loadChunkStatusLoaded {
+		logging.Infof("%s [%s:%s:%d] Handler code loaded from chunks",
+			logPrefix, c.workerName, c.tcpPort, c.Pid())
+		return
+	}
+
+	attempts := atomic.AddInt32(&c.loadChunkAttempts, 1)
+	if attempts > maxLoadChunkAttempts {
+		logging.Errorf("%s [%s:%s:%d] Giving up loading handler code after %d attempts, status: %s",
+			logPrefix, c.workerName, c.tcpPort, c.Pid(), maxLoadChunkAttempts, ack.Status)
+		return
+	}
+
+	logging.Warnf("%s [%s:%s:%d] Retrying handler code load, status: %s missing chunks: %v attempt: %d",
+		logPrefix, c.workerName, c.tcpPort, c.Pid(), ack.Status, ack.Missing, attempts)
+
+	var chunks []int16
+	if ack.Status == loadChunkStatusMissing {
+		chunks = ack.Missing
+	}
+	appCode, _ := c.loadedAppCode.Load().(string)
+	go c.sendLoadV8WorkerChunks(appCode, chunks)
+}
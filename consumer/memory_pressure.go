@@ -0,0 +1,105 @@
+package consumer
+
+import (
+	"bytes"
+	"sync/atomic"
+	"time"
+
+	"github.com/couchbase/eventing/logging"
+)
+
+// Memory pressure levels of eventing-producer. Each level sheds optional memory on
+// top of the ones below it, so that dispatch of events is impacted only as last resort
+const (
+	memPressureNone = iota
+
+	// Stop retaining dcp feed event history, insight samples from worker and
+	// quarantined stats payloads
+	memPressureShedDiagnostics
+
+	// Release pooled flatbuffer builders, cut down socket write batches and
+	// release grown send buffer
+	memPressureShrinkBuffers
+
+	// Stop reading from aggregated DCP feed, letting DCP flow control hold back KV
+	memPressureThrottleDcp
+)
+
+const (
+	// Socket write batch size is divided by this factor under memory pressure
+	memPressureSocketBatchDivisor = 4
+
+	// Send buffer grown beyond this capacity is released under memory pressure
+	memPressureSendBufferCap = 1024 * 1024
+
+	memPressureThrottleInterval = 10 * time.Millisecond
+)
+
+// SetMemoryPressureLevel sheds or restores optional buffers as per memory pressure level
+func (c *Consumer) SetMemoryPressureLevel(level int) {
+	logPrefix := "Consumer::SetMemoryPressureLevel"
+
+	prevLevel := int(atomic.SwapInt32(&c.memPressureLevel, int32(level)))
+	if prevLevel == level {
+		return
+	}
+
+	c.dcpFeedEvents.shed(level >= memPressureShedDiagnostics)
+	c.builderPool.shed(level >= memPressureShrinkBuffers)
+
+	logging.Infof("%s [%s:%s:%d] Memory pressure level changed from %d to %d",
+		logPrefix, c.workerName, c.tcpPort, c.Pid(), prevLevel, level)
+}
+
+func (c *Consumer) memoryPressureLevel() int {
+	return int(atomic.LoadInt32(&c.memPressureLevel))
+}
+
+func (c *Consumer) shedDiagnostics() bool {
+	return c.memoryPressureLevel() >= memPressureShedDiagnostics
+}
+
+// effectiveSocketBatchSize returns number of messages batched before writing to
+// worker socket, which is cut down under memory pressure
+func (c *Consumer) effectiveSocketBatchSize() int {
+	if c.memoryPressureLevel() < memPressureShrinkBuffers {
+		return c.socketWriteBatchSize
+	}
+
+	batchSize := c.socketWriteBatchSize / memPressureSocketBatchDivisor
+	if batchSize < 1 {
+		batchSize = 1
+	}
+	return batchSize
+}
+
+// shrinkSendBuffer releases send buffer and batch builder that have grown large, once
+// those have been flushed. Caller should hold sendMsgBufferRWMutex
+func (c *Consumer) shrinkSendBuffer() {
+	if c.memoryPressureLevel() < memPressureShrinkBuffers {
+		return
+	}
+
+	c.msgBatch.shrink()
+	if c.sendMsgBuffer.Cap() > memPressureSendBufferCap {
+		c.sendMsgBuffer = bytes.Buffer{}
+	}
+}
+
+// applyMemoryBackpressure holds off reading from aggregated DCP feed at the highest
+// memory pressure level. Returns true if caller should skip reading from feed
+func (c *Consumer) applyMemoryBackpressure() bool {
+	if c.memoryPressureLevel() < memPressureThrottleDcp {
+		return false
+	}
+
+	// STREAMBEGIN/END messages could be behind mutations during rebalance, and pausing
+	// or undeploy need the feed drained, so feed is kept flowing in those cases
+	if c.isRebalanceOngoing || c.isPausing || atomic.LoadUint32(&c.isTerminateRunning) == 1 {
+		return false
+	}
+
+	atomic.AddUint64(&c.memPressureThrottleMs, uint64(memPressureThrottleInterval/time.Millisecond))
+	time.Sleep(memPressureThrottleInterval)
+	return true
+}
@@ -0,0 +1,204 @@
+package consumer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"net"
+	"sync/atomic"
+
+	"github.com/couchbase/eventing/gen/flatbuf/header"
+	"github.com/couchbase/eventing/gen/flatbuf/response"
+	"github.com/couchbase/eventing/logging"
+	flatbuffers "github.com/google/flatbuffers/go"
+)
+
+const (
+	// Set on length prefix of a frame which carries a batch of messages, rather than
+	// a single one. Frames in either direction are far smaller than 2GB
+	batchFrameFlag = uint32(1) << 31
+
+	// Set on length prefix of a batch frame which carries CRC32C of its body right
+	// after the prefix:
+	// <batchFrameFlag|checksumFrameFlag|batchSize><crc32c><Batch>
+	checksumFrameFlag = uint32(1) << 30
+	checksumSize      = 4
+
+	// Room for length prefix and checksum ahead of a batch frame
+	batchPrefixSize = 4 + checksumSize
+
+	// Batch builder grown past this is released once flushed under memory pressure
+	memPressureBatchBuilderCap = 4 * 1024 * 1024
+)
+
+var castagnoliTable = crc32.MakeTable(crc32.Castagnoli)
+
+// messageBatch packs messages meant for worker into a single flatbuffer vector, so
+// that those batched up to sock_batch_size go out under one length prefix:
+// <batchFrameFlag|batchSize><Batch>
+// Sealed frame stays in builder till it's written out along with send buffer, so
+// that it isn't copied once more into it. Access controlled by sendMsgBufferRWMutex
+type messageBatch struct {
+	builder  *flatbuffers.Builder
+	messages []flatbuffers.UOffsetT
+
+	sealed    bool
+	sealedAt  int // Send buffer offset the sealed frame goes out at
+	prefix    [batchPrefixSize]byte
+	prefixLen int
+
+	framesSent   uint64 // Access via atomics, read by stats
+	messagesSent uint64 // Access via atomics, read by stats
+}
+
+func newMessageBatch() *messageBatch {
+	return &messageBatch{builder: flatbuffers.NewBuilder(0)}
+}
+
+// add packs msg into the batch. A batch sealed meanwhile is first spliced into buf,
+// as builder can't take more messages past its frame
+func (b *messageBatch) add(msg *message, buf *bytes.Buffer) {
+	if b.sealed {
+		b.spliceInto(buf)
+	}
+
+	hdr := b.builder.CreateByteVector(msg.Header)
+	payload := b.builder.CreateByteVector(msg.Payload)
+
+	header.MessageStart(b.builder)
+	header.MessageAddHeader(b.builder, hdr)
+	header.MessageAddPayload(b.builder, payload)
+	b.messages = append(b.messages, header.MessageEnd(b.builder))
+}
+
+// seal finishes messages added so far into a batch frame, which goes out ahead of
+// whatever is appended to buf from here on. Frame is prefixed with CRC32C of it if
+// checksum is set
+func (b *messageBatch) seal(buf *bytes.Buffer, checksum bool) {
+	if b.sealed || len(b.messages) == 0 {
+		return
+	}
+
+	header.BatchStartMessagesVector(b.builder, len(b.messages))
+	for i := len(b.messages) - 1; i >= 0; i-- {
+		b.builder.PrependUOffsetT(b.messages[i])
+	}
+	messages := b.builder.EndVector(len(b.messages))
+
+	header.BatchStart(b.builder)
+	header.BatchAddMessages(b.builder, messages)
+	b.builder.Finish(header.BatchEnd(b.builder))
+
+	frame := b.builder.FinishedBytes()
+	prefix := batchFrameFlag | uint32(len(frame))
+	b.prefixLen = 4
+	if checksum {
+		prefix |= checksumFrameFlag
+		binary.LittleEndian.PutUint32(b.prefix[4:], crc32.Checksum(frame, castagnoliTable))
+		b.prefixLen = batchPrefixSize
+	}
+	binary.LittleEndian.PutUint32(b.prefix[:4], prefix)
+
+	b.sealed = true
+	b.sealedAt = buf.Len()
+	atomic.AddUint64(&b.framesSent, 1)
+	atomic.AddUint64(&b.messagesSent, uint64(len(b.messages)))
+}
+
+// buffers lays out sealed frame and contents of buf in the order those go out to
+// worker, without copying either
+func (b *messageBatch) buffers(buf *bytes.Buffer) net.Buffers {
+	pending := buf.Bytes()
+	if !b.sealed {
+		return net.Buffers{pending}
+	}
+	return net.Buffers{pending[:b.sealedAt], b.prefix[:b.prefixLen], b.builder.FinishedBytes(), pending[b.sealedAt:]}
+}
+
+func (b *messageBatch) spliceInto(buf *bytes.Buffer) {
+	pending := make([]byte, 0, buf.Len()+b.prefixLen+len(b.builder.FinishedBytes()))
+	for _, chunk := range b.buffers(buf) {
+		pending = append(pending, chunk...)
+	}
+	buf.Reset()
+	buf.Write(pending)
+	b.reset()
+}
+
+func (b *messageBatch) stats() (framesSent, messagesSent uint64) {
+	return atomic.LoadUint64(&b.framesSent), atomic.LoadUint64(&b.messagesSent)
+}
+
+func (b *messageBatch) reset() {
+	b.builder.Reset()
+	b.messages = b.messages[:0]
+	b.sealed = false
+}
+
+func (b *messageBatch) shrink() {
+	if len(b.builder.Bytes) > memPressureBatchBuilderCap {
+		b.builder = flatbuffers.NewBuilder(0)
+	}
+}
+
+// parseWorkerFrame handles a frame read off worker socket, which carries either a
+// single response or a batch of those flushed together by worker. Frames failing
+// checksum are dropped and the worker is respawned, as the stream can't be trusted
+// past them
+func (c *Consumer) parseWorkerFrame(frame []byte, batch, checksum bool) {
+	logPrefix := "Consumer::parseWorkerFrame"
+
+	if checksum {
+		expected := binary.LittleEndian.Uint32(frame[:checksumSize])
+		frame = frame[checksumSize:]
+
+		if actual := crc32.Checksum(frame, castagnoliTable); actual != expected {
+			atomic.AddUint64(&c.frameChecksumFailures, 1)
+			logging.Errorf("%s [%s:%s:%d] Checksum mismatch on frame from worker, size: %d expected: %d actual: %d",
+				logPrefix, c.workerName, c.tcpPort, c.Pid(), len(frame), expected, actual)
+			c.respawnOnCorruptFrame("checksum mismatch on frame from worker")
+			return
+		}
+	}
+
+	if !batch {
+		c.parseWorkerResponse(frame)
+		return
+	}
+
+	responses := response.GetRootAsResponseBatch(frame, 0)
+	r := &response.Response{}
+	for i := 0; i < responses.ResponsesLength(); i++ {
+		if responses.Responses(r, i) {
+			c.routeResponse(r.MsgType(), r.Opcode(), string(r.Msg()))
+		}
+	}
+}
+
+// respawnOnCorruptFrame restarts worker once either side detects a corrupt frame, so
+// that events are replayed to a fresh worker from their last checkpoint
+func (c *Consumer) respawnOnCorruptFrame(reason string) {
+	if atomic.LoadUint32(&c.isTerminateRunning) == 1 || c.stoppingConsumer {
+		return
+	}
+
+	c.stoppingConsumer = true
+	c.respawnWorker(fmt.Sprintf("%s, frames exchanged with worker can't be trusted", reason))
+}
+
+// handleWorkerChecksumFailure is called when worker finds a frame sent to it failing
+// checksum. Worker drops everything it reads past that frame
+func (c *Consumer) handleWorkerChecksumFailure(msg string) {
+	logPrefix := "Consumer::handleWorkerChecksumFailure"
+
+	atomic.AddUint64(&c.workerChecksumFailures, 1)
+	logging.Errorf("%s [%s:%s:%d] Worker reported checksum mismatch on frame sent to it: %s",
+		logPrefix, c.workerName, c.tcpPort, c.Pid(), msg)
+	c.respawnOnCorruptFrame("checksum mismatch on frame sent to worker")
+}
+
+// frameChecksumsNegotiated tells if frames exchanged with worker carry checksums
+func (c *Consumer) frameChecksumsNegotiated() bool {
+	return atomic.LoadUint32(&c.frameChecksums) == 1
+}
@@ -0,0 +1,131 @@
+package consumer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"testing"
+)
+
+// readBatchFrame splits a batch frame off the start of wire, returning its body
+// and whatever follows it
+func readBatchFrame(t *testing.T, wire []byte, checksum bool) ([]byte, []byte) {
+	prefix := binary.LittleEndian.Uint32(wire)
+	if prefix&batchFrameFlag == 0 {
+		t.Fatalf("batch frame flag not set, prefix: %x", prefix)
+	}
+	if (prefix&checksumFrameFlag != 0) != checksum {
+		t.Fatalf("checksum frame flag got: %t expected: %t", prefix&checksumFrameFlag != 0, checksum)
+	}
+	wire = wire[4:]
+
+	size := int(prefix &^ (batchFrameFlag | checksumFrameFlag))
+	var crc uint32
+	if checksum {
+		crc = binary.LittleEndian.Uint32(wire)
+		wire = wire[checksumSize:]
+	}
+	if len(wire) < size {
+		t.Fatalf("frame size: %d exceeds bytes left: %d", size, len(wire))
+	}
+
+	frame := wire[:size]
+	if checksum && crc32.Checksum(frame, castagnoliTable) != crc {
+		t.Errorf("checksum mismatch on batch frame")
+	}
+	return frame, wire[size:]
+}
+
+func TestMessageBatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		ahead    string // Written to send buffer before batch is sealed
+		behind   string // Written to send buffer after batch is sealed
+		messages int
+		checksum bool
+	}{
+		{name: "empty batch", ahead: "a", behind: "b"},
+		{name: "batch only", messages: 2},
+		{name: "batch between send buffer writes", ahead: "a", behind: "b", messages: 3},
+		{name: "checksummed", behind: "b", messages: 1, checksum: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			b := newMessageBatch()
+
+			buf.WriteString(test.ahead)
+			for i := 0; i < test.messages; i++ {
+				b.add(&message{Header: []byte("header"), Payload: []byte("payload")}, &buf)
+			}
+			b.seal(&buf, test.checksum)
+			buf.WriteString(test.behind)
+
+			var wire []byte
+			for _, chunk := range b.buffers(&buf) {
+				wire = append(wire, chunk...)
+			}
+			b.reset()
+
+			if got := string(wire[:len(test.ahead)]); got != test.ahead {
+				t.Fatalf("got: %q expected: %q ahead of batch", got, test.ahead)
+			}
+			wire = wire[len(test.ahead):]
+
+			if test.messages > 0 {
+				_, wire = readBatchFrame(t, wire, test.checksum)
+			}
+
+			if string(wire) != test.behind {
+				t.Errorf("got: %q expected: %q behind batch", wire, test.behind)
+			}
+
+			framesSent, messagesSent := b.stats()
+			if expected := uint64(test.messages); messagesSent != expected {
+				t.Errorf("messages sent got: %d expected: %d", messagesSent, expected)
+			}
+			expectedFrames := uint64(0)
+			if test.messages > 0 {
+				expectedFrames = 1
+			}
+			if framesSent != expectedFrames {
+				t.Errorf("frames sent got: %d expected: %d", framesSent, expectedFrames)
+			}
+		})
+	}
+}
+
+func TestMessageBatchAddAfterSeal(t *testing.T) {
+	var buf bytes.Buffer
+	b := newMessageBatch()
+
+	b.add(&message{Header: []byte("first")}, &buf)
+	b.seal(&buf, false)
+	buf.WriteString("a")
+
+	// Sealed frame is spliced into send buffer ahead of what followed it
+	b.add(&message{Header: []byte("second")}, &buf)
+	if b.sealed {
+		t.Fatalf("batch still sealed after add")
+	}
+
+	_, rest := readBatchFrame(t, buf.Bytes(), false)
+	if string(rest) != "a" {
+		t.Errorf("got: %q expected: %q behind spliced batch", rest, "a")
+	}
+
+	b.seal(&buf, false)
+	var wire []byte
+	for _, chunk := range b.buffers(&buf) {
+		wire = append(wire, chunk...)
+	}
+
+	_, rest = readBatchFrame(t, wire, false)
+	if string(rest[:1]) != "a" {
+		t.Fatalf("got: %q expected spliced batch to go out first", rest)
+	}
+	if _, rest = readBatchFrame(t, rest[1:], false); len(rest) != 0 {
+		t.Errorf("got: %q trailing second batch", rest)
+	}
+}
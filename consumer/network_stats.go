@@ -0,0 +1,74 @@
+package consumer
+
+import (
+	"sync/atomic"
+
+	mcd "github.com/couchbase/eventing/dcp/transport"
+	cb "github.com/couchbase/eventing/dcp/transport/client"
+	"github.com/couchbase/gocb/v2"
+)
+
+// networkStats accounts bytes crossing I/O boundaries of the consumer. Producer sums
+// them up per function, while service manager rolls them up per node
+type networkStats struct {
+	dcpIn           uint64 // DCP events read from aggregated DCP feed
+	workerOut       uint64 // Messages written to worker sockets
+	workerIn        uint64 // Responses read from worker sockets
+	metadataIn      uint64 // Documents read from metadata bucket
+	metadataOut     uint64 // Documents written to metadata bucket
+	metadataSubdocs uint64 // Sub-document mutations, payload of which isn't exposed by gocb
+	deadLetterOut   uint64 // Dead letters written to dead letter keyspace
+}
+
+func (n *networkStats) addDcpEvent(e *cb.DcpEvent) {
+	atomic.AddUint64(&n.dcpIn, uint64(mcd.HDR_LEN+len(e.Key)+len(e.Value)))
+}
+
+func (n *networkStats) stats(stats map[string]uint64) {
+	stats["network_dcp_in_bytes"] = atomic.LoadUint64(&n.dcpIn)
+	stats["network_worker_out_bytes"] = atomic.LoadUint64(&n.workerOut)
+	stats["network_worker_in_bytes"] = atomic.LoadUint64(&n.workerIn)
+	stats["network_metadata_in_bytes"] = atomic.LoadUint64(&n.metadataIn)
+	stats["network_metadata_out_bytes"] = atomic.LoadUint64(&n.metadataOut)
+	stats["network_metadata_subdoc_ops"] = atomic.LoadUint64(&n.metadataSubdocs)
+	stats["network_dead_letter_out_bytes"] = atomic.LoadUint64(&n.deadLetterOut)
+}
+
+// countingTranscoder is a JSON transcoder which accounts size of encoded and
+// decoded documents, as gocb doesn't expose bytes transferred per operation
+type countingTranscoder struct {
+	*gocb.JSONTranscoder
+	in  *uint64
+	out *uint64
+}
+
+func newCountingTranscoder(in, out *uint64) *countingTranscoder {
+	return &countingTranscoder{
+		JSONTranscoder: gocb.NewJSONTranscoder(),
+		in:             in,
+		out:            out,
+	}
+}
+
+func (t *countingTranscoder) Decode(bytes []byte, flags uint32, out interface{}) error {
+	if t.in != nil {
+		atomic.AddUint64(t.in, uint64(len(bytes)))
+	}
+	return t.JSONTranscoder.Decode(bytes, flags, out)
+}
+
+func (t *countingTranscoder) Encode(value interface{}) ([]byte, uint32, error) {
+	bytes, flags, err := t.JSONTranscoder.Encode(value)
+	if err == nil && t.out != nil {
+		atomic.AddUint64(t.out, uint64(len(bytes)))
+	}
+	return bytes, flags, err
+}
+
+// metaMutateIn issues sub-document mutation against metadata bucket. Caller should
+// hold gocbMetaHandleMutex
+func (c *Consumer) metaMutateIn(key string, specs []gocb.MutateInSpec, opts *gocb.MutateInOptions) (*gocb.MutateInResult, error) {
+	atomic.AddUint64(&c.networkStats.metadataSubdocs, 1)
+	c.producer.InjectMetadataLatency()
+	return c.gocbMetaHandle.MutateIn(key, specs, opts)
+}
@@ -0,0 +1,167 @@
+package consumer
+
+import (
+	"encoding/json"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	mcd "github.com/couchbase/eventing/dcp/transport"
+	cb "github.com/couchbase/eventing/dcp/transport/client"
+	"github.com/couchbase/eventing/logging"
+)
+
+const (
+	// DCP events waiting on prefetch, beyond which DCP dispatch routine blocks
+	prefetchQueueCap = 1000
+
+	prefetchDrainPollInterval = 10 * time.Millisecond
+)
+
+// Placeholders allowed in prefetch key patterns. {key} expands to the mutation key
+// and {N} to N-th segment of the mutation key split by prefetch_key_separator
+var prefetchPlaceholderRegex = regexp.MustCompile(`\{(key|\d+)\}`)
+
+// isPrefetchEnabled returns true if related documents need to be fetched for
+// mutations. Go side KV access used for prefetch isn't collection aware, hence
+// prefetch is only supported when source keyspace is the default collection
+func (c *Consumer) isPrefetchEnabled() bool {
+	return len(c.prefetchKeyPatterns) > 0 &&
+		c.sourceKeyspace.ScopeName == "_default" &&
+		c.sourceKeyspace.CollectionName == "_default"
+}
+
+// expandPrefetchPattern derives key of related document from the mutation key.
+// Returns false if pattern refers to a key segment that isn't present
+func expandPrefetchPattern(pattern, key, separator string) (string, bool) {
+	segments := strings.Split(key, separator)
+	expanded := true
+
+	result := prefetchPlaceholderRegex.ReplaceAllStringFunc(pattern, func(placeholder string) string {
+		name := placeholder[1 : len(placeholder)-1]
+		if name == "key" {
+			return key
+		}
+
+		idx, err := strconv.Atoi(name)
+		if err != nil || idx >= len(segments) {
+			expanded = false
+			return ""
+		}
+		return segments[idx]
+	})
+
+	return result, expanded
+}
+
+// prefetchDocs fetches documents related to the mutation key as per configured
+// key patterns. Fetched documents are keyed by document id, documents that don't
+// exist are set to null. Non-JSON documents are skipped
+func (c *Consumer) prefetchDocs(key []byte) map[string]json.RawMessage {
+	logPrefix := "Consumer::prefetchDocs"
+
+	keys := make([]string, 0, len(c.prefetchKeyPatterns))
+	for _, pattern := range c.prefetchKeyPatterns {
+		if docID, ok := expandPrefetchPattern(pattern, string(key), c.prefetchKeySeparator); ok && docID != "" {
+			keys = append(keys, docID)
+		}
+	}
+
+	if len(keys) == 0 {
+		return nil
+	}
+
+	responses, err := c.cbBucket.GetBulk(keys)
+	if err != nil {
+		c.prefetchErrCounter++
+		logging.Errorf("%s [%s:%s:%d] key: %ru failed to prefetch related documents, err: %v",
+			logPrefix, c.workerName, c.tcpPort, c.Pid(), string(key), err)
+		return nil
+	}
+
+	docs := make(map[string]json.RawMessage, len(keys))
+	for _, docID := range keys {
+		response, ok := responses[docID]
+		if !ok {
+			c.prefetchMissCounter++
+			docs[docID] = json.RawMessage("null")
+			continue
+		}
+
+		if !json.Valid(response.Body) {
+			continue
+		}
+
+		c.prefetchDocCounter++
+		docs[docID] = json.RawMessage(response.Body)
+	}
+
+	return docs
+}
+
+// prefetchFor fetches documents related to the event, if it's a mutation and
+// prefetch is enabled
+func (c *Consumer) prefetchFor(e *cb.DcpEvent) map[string]json.RawMessage {
+	if e.Opcode != mcd.DCP_MUTATION || !c.isPrefetchEnabled() {
+		return nil
+	}
+	return c.prefetchDocs(e.Key)
+}
+
+// dispatchDcpEvent sends event to worker. With prefetch enabled, events are
+// queued up so that DCP dispatch routine isn't held up on KV fetches. All events
+// go through the queue to retain their order
+func (c *Consumer) dispatchDcpEvent(e *cb.DcpEvent) {
+	if !c.isPrefetchEnabled() {
+		c.sendDcpEvent(e, nil, false)
+		return
+	}
+
+	atomic.AddInt64(&c.prefetchPendingCount, 1)
+	select {
+	case c.prefetchCh <- e:
+	case <-c.ctx.Done():
+		atomic.AddInt64(&c.prefetchPendingCount, -1)
+	}
+}
+
+// prefetchPending returns true if events queued for prefetch are yet to be sent to worker
+func (c *Consumer) prefetchPending() bool {
+	return atomic.LoadInt64(&c.prefetchPendingCount) > 0
+}
+
+// waitForPrefetch blocks until events queued for prefetch are sent to worker
+func (c *Consumer) waitForPrefetch() {
+	for c.prefetchPending() {
+		select {
+		case <-time.After(prefetchDrainPollInterval):
+		case <-c.ctx.Done():
+			return
+		}
+	}
+}
+
+// processPrefetchEvents fetches related documents for queued events and sends
+// them on to worker, in the order they were queued
+func (c *Consumer) processPrefetchEvents() {
+	logPrefix := "Consumer::processPrefetchEvents"
+
+	if !c.isPrefetchEnabled() {
+		return
+	}
+
+	for {
+		select {
+		case e := <-c.prefetchCh:
+			c.sendDcpEvent(e, c.prefetchFor(e), false)
+			atomic.AddInt64(&c.prefetchPendingCount, -1)
+
+		case <-c.ctx.Done():
+			logging.Infof("%s [%s:%s:%d] Exiting prefetch routine",
+				logPrefix, c.workerName, c.tcpPort, c.Pid())
+			return
+		}
+	}
+}
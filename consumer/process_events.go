@@ -8,7 +8,6 @@ import (
 	"runtime"
 	"runtime/debug"
 	"sort"
-	"strconv"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -25,32 +24,19 @@ import (
 func (c *Consumer) processDCPEvents() {
 	logPrefix := "Consumer::processDCPEvents"
 
-	functionInstanceID := strconv.Itoa(int(c.app.FunctionID)) + "-" + c.app.FunctionInstanceID
+	functionInstanceID := c.functionInstanceID()
 
 	for {
-		if c.cppQueueSizes != nil {
-			if c.workerQueueCap < (c.numSentEvents-c.cppQueueSizes.NumProcessedEvents) ||
-				c.workerQueueMemCap < (c.sentEventsSize-c.cppQueueSizes.ProcessedEventsSize) {
-				logging.Debugf("%s [%s:%s:%d] Throttling, cpp queue sizes: %+v, num sent event: %d, events size: %d",
-					logPrefix, c.workerName, c.tcpPort, c.Pid(), c.cppQueueSizes, c.numSentEvents, c.sentEventsSize)
-
-				// avoid throttling when consumer is pausing or terminating
-				if !(c.isPausing || atomic.LoadUint32(&c.isTerminateRunning) == 1) {
-					time.Sleep(10 * time.Millisecond)
-				}
-
-				// If rebalance in ongoing, it's important to read dcp mutations as STREAMBEGIN/END messages could be behind them.
-				// And it is also important to not queue up mutations in consumer to contain rss growth when cpp queues are full.
-				// So *continue* only when there is no rebalance on going, or we are not pausing or we are not undeploying
-				if !(c.isRebalanceOngoing || c.isPausing || atomic.LoadUint32(&c.isTerminateRunning) == 1) {
-					continue
-				}
+		if len(c.aggDCPFeed) == 0 {
+			c.flushReadSeqNos()
+		}
 
-			}
+		if c.applyBackpressure() || c.applyMemoryBackpressure() || c.applyDcpQuota() {
+			continue
 		}
 
 		if len(c.reqStreamCh) > 0 || len(c.clusterStateChangeNotifCh) > 0 {
-			logging.Debugf("%s [%s:%s:%d] Throttling, len(c.reqStreamCh): %v, len(c.clusterStateChangeNotifCh): %v",
+			logging.AppDebugf(c.app.AppName, "%s [%s:%s:%d] Throttling, len(c.reqStreamCh): %v, len(c.clusterStateChangeNotifCh): %v",
 				logPrefix, c.workerName, c.tcpPort, c.Pid(), len(c.reqStreamCh), len(c.clusterStateChangeNotifCh))
 			runtime.Gosched()
 		}
@@ -64,6 +50,7 @@ func (c *Consumer) processDCPEvents() {
 			}
 
 			atomic.AddInt64(&c.aggDCPFeedMem, -int64(len(e.Value)))
+			c.networkStats.addDcpEvent(e)
 
 			c.msgProcessedRWMutex.Lock()
 			if _, ok := c.dcpMessagesProcessed[e.Opcode]; !ok {
@@ -78,9 +65,15 @@ func (c *Consumer) processDCPEvents() {
 					continue
 				}
 
-				logging.Tracef("%s [%s:%s:%d] Got DCP_MUTATION for key: %ru datatype: %v",
+				logging.AppTracef(c.app.AppName, "%s [%s:%s:%d] Got DCP_MUTATION for key: %ru datatype: %v",
 					logPrefix, c.workerName, c.tcpPort, c.Pid(), string(e.Key), e.Datatype)
 
+				if c.maxDocSizeBytes > 0 && len(e.Value) > c.maxDocSizeBytes {
+					if !c.handleOversizedDoc(e) {
+						continue
+					}
+				}
+
 				switch e.Datatype {
 				case dcpDatatypeJSON:
 					c.dcpMutationCounter++
@@ -90,6 +83,8 @@ func (c *Consumer) processDCPEvents() {
 					if c.binaryDocAllowed {
 						c.dcpMutationCounter++
 						c.sendEvent(e)
+					} else {
+						c.skipBinaryDoc(e)
 					}
 
 				case dcpDatatypeJSONXattr:
@@ -102,6 +97,8 @@ func (c *Consumer) processDCPEvents() {
 							continue
 						}
 						c.sendXattrDoc(e, functionInstanceID)
+					} else {
+						c.skipBinaryDoc(e)
 					}
 
 				}
@@ -130,6 +127,10 @@ func (c *Consumer) processDCPEvents() {
 				logging.Infof("%s [%s:%s:%d] vb: %d got STREAMREQ status: %v",
 					logPrefix, c.workerName, c.tcpPort, c.Pid(), e.VBucket, e.Status)
 
+				if elapsed, ok := c.streamOpenTimings.stop(e.VBucket); ok && e.Status == mcd.SUCCESS {
+					c.producer.RecordRebalanceDuration(common.RebalanceStreamOpen, elapsed)
+				}
+
 			retryCheckMetadataUpdated:
 				if metadataUpdated, ok := c.vbProcessingStats.getVbStat(e.VBucket, "vb_stream_request_metadata_updated").(bool); ok {
 					logging.Infof("%s [%s:%s:%d] vb: %d STREAMREQ metadataUpdated: %t",
@@ -148,13 +149,16 @@ func (c *Consumer) processDCPEvents() {
 				}
 
 				if e.Status == mcd.SUCCESS {
+					c.streamReqTracker.recordSuccess(e.VBucket)
+					c.resetReadSeqNo(e.VBucket)
+					c.scheduleTimerStoreVerification(e.VBucket)
 
 					vbFlog := &vbFlogEntry{statusCode: e.Status, streamReqRetry: false, vb: e.VBucket}
 
 					var vbBlob vbucketKVBlob
 					var cas gocb.Cas
 
-					vbKey := fmt.Sprintf("%s::vb::%d", c.app.AppName, e.VBucket)
+					vbKey := common.CheckpointBlobKey(c.app.AppName, e.VBucket)
 
 					err := util.Retry(util.NewFixedBackoff(bucketOpRetryInterval), c.retryCount, getOpCallback,
 						c, c.producer.AddMetadataPrefix(vbKey), &vbBlob, &cas, false)
@@ -187,6 +191,8 @@ func (c *Consumer) processDCPEvents() {
 						startSeqNo = seqNo
 					}
 
+					// Held dead letters are replayed from checkpoint by the new stream
+					c.deadLetterHolds.reset(e.VBucket)
 					c.sendUpdateProcessedSeqNo(e.VBucket, startSeqNo)
 
 					if val, ok := c.vbProcessingStats.getVbStat(e.VBucket, "bootstrap_stream_req_done").(bool); ok && !val {
@@ -253,6 +259,10 @@ func (c *Consumer) processDCPEvents() {
 				}
 
 				if e.Status != mcd.SUCCESS {
+					errClass := classifyStreamReqStatus(e.Status)
+					retryAfter := c.streamReqTracker.recordFailure(e.VBucket, errClass)
+					logging.Infof("%s [%s:%s:%d] vb: %d STREAMREQ failure class: %s retry after: %v",
+						logPrefix, c.workerName, c.tcpPort, c.Pid(), e.VBucket, errClass, retryAfter)
 
 					vbFlog := &vbFlogEntry{
 						flog:           e.FailoverLog,
@@ -262,7 +272,7 @@ func (c *Consumer) processDCPEvents() {
 						vb:             e.VBucket,
 					}
 
-					vbKey := fmt.Sprintf("%s::vb::%d", c.app.AppName, e.VBucket)
+					vbKey := common.CheckpointBlobKey(c.app.AppName, e.VBucket)
 
 					entry := OwnershipEntry{
 						AssignedWorker: c.ConsumerName(),
@@ -284,7 +294,14 @@ func (c *Consumer) processDCPEvents() {
 				}
 			case mcd.DCP_STREAMEND:
 				logging.Infof("%s [%s:%s:%d] vb: %d got STREAMEND", logPrefix, c.workerName, c.tcpPort, c.Pid(), e.VBucket)
+				if c.purgeBootstrapStream(e.VBucket) {
+					c.bootstrapStreamSwitchCounter++
+					logging.Infof("%s [%s:%s:%d] vb: %d stream over bootstrap dcp feed ended, will be reclaimed over steady-state feed",
+						logPrefix, c.workerName, c.tcpPort, c.Pid(), e.VBucket)
+				}
 				c.vbProcessingStats.updateVbStat(e.VBucket, "vb_stream_request_metadata_updated", false)
+				c.waitForPrefetch()
+				c.flushReadSeqNo(e.VBucket)
 				lastReadSeqNo := c.vbProcessingStats.getVbStat(e.VBucket, "last_read_seq_no").(uint64)
 				c.vbProcessingStats.updateVbStat(e.VBucket, "seq_no_at_stream_end", lastReadSeqNo)
 				c.vbProcessingStats.updateVbStat(e.VBucket, "timestamp", time.Now().Format(time.RFC3339))
@@ -298,17 +315,23 @@ func (c *Consumer) processDCPEvents() {
 
 			case mcd.DCP_SYSTEM_EVENT:
 				c.checkAndSendNoOp(e.Seqno, e.VBucket)
-				c.vbProcessingStats.updateVbStat(e.VBucket, "last_read_seq_no", e.Seqno)
+				c.recordReadSeqNo(e.VBucket, e.Seqno)
+				c.vbHandovers.read(e.VBucket, e.Seqno)
 				c.vbProcessingStats.updateVbStat(e.VBucket, "manifest_id", string(e.ManifestUID))
+				c.superSup.ObserveManifestUID(c.sourceKeyspace.BucketName, string(e.ManifestUID))
 
 			case mcd.DCP_SEQNO_ADVANCED:
 				c.checkAndSendNoOp(e.Seqno, e.VBucket)
-				c.vbProcessingStats.updateVbStat(e.VBucket, "last_read_seq_no", e.Seqno)
+				c.recordReadSeqNo(e.VBucket, e.Seqno)
+				c.vbHandovers.read(e.VBucket, e.Seqno)
+
+			case mcd.DCP_SNAPSHOT:
+				c.recordSnapshot(e.VBucket, e.SnapendSeq)
 
 			default:
 			}
 
-		case <-c.stopConsumerCh:
+		case <-c.ctx.Done():
 			logging.Infof("%s [%s:%s:%d] Exiting processDCPEvents routine",
 				logPrefix, c.workerName, c.tcpPort, c.Pid())
 			return
@@ -359,7 +382,7 @@ func (c *Consumer) processStatsEvents() {
 			c.dcpOpsProcessed = dcpOpCount
 			c.msgProcessedRWMutex.RUnlock()
 
-		case <-c.stopConsumerCh:
+		case <-c.ctx.Done():
 			logging.Infof("%s [%s:%s:%d] Exiting processStatsEvents routine",
 				logPrefix, c.workerName, c.tcpPort, c.Pid())
 			return
@@ -380,9 +403,13 @@ func (c *Consumer) processFilterEvents() {
 			logging.Infof("%s [%s:%s:%d] vb: %d seqNo: %d received on filterDataCh",
 				logPrefix, c.workerName, c.tcpPort, c.Pid(), e.Vbucket, e.SeqNo)
 
+			if elapsed, ok := c.timerTransferTimings.stop(e.Vbucket); ok {
+				c.producer.RecordRebalanceDuration(common.RebalanceTimerTransfer, elapsed)
+			}
+
 			c.handleStreamEnd(e.Vbucket, e.SeqNo)
 
-		case <-c.stopConsumerCh:
+		case <-c.ctx.Done():
 			logging.Infof("%s [%s:%s:%d] Exiting processFilterEvents routine",
 				logPrefix, c.workerName, c.tcpPort, c.Pid())
 			return
@@ -417,7 +444,7 @@ func (c *Consumer) startDcp(flogs couchbase.FailoverLog) error {
 		currentManifestUID, _ = c.getManifestUID(c.sourceKeyspace.BucketName)
 	}
 
-	logging.Debugf("%s [%s:%s:%d] get_all_vb_seqnos: len => %d dump => %v",
+	logging.AppDebugf(c.app.AppName, "%s [%s:%s:%d] get_all_vb_seqnos: len => %d dump => %v",
 		logPrefix, c.workerName, c.tcpPort, c.Pid(), len(vbSeqnos), vbSeqnos)
 
 	flogVbs := make([]uint16, 0)
@@ -432,6 +459,13 @@ func (c *Consumer) startDcp(flogs couchbase.FailoverLog) error {
 		logPrefix, c.workerName, c.tcpPort, c.Pid(), len(flogVbs), util.Condense(flogVbs), len(flogVbs), flogs)
 
 	for _, vb := range flogVbs {
+		if c.isVbPaused(vb) {
+			logging.Infof("%s [%s:%s:%d] vb: %d skipping dcp stream as it has been paused",
+				logPrefix, c.workerName, c.tcpPort, c.Pid(), vb)
+			c.vbProcessingStats.updateVbStat(vb, "dcp_stream_status", dcpStreamPaused)
+			continue
+		}
+
 		flog := flogs[vb]
 		vbuuid, _, err := flog.Latest()
 		if err != nil {
@@ -443,7 +477,7 @@ func (c *Consumer) startDcp(flogs couchbase.FailoverLog) error {
 		logging.Infof("%s [%s:%s:%d] vb: %d vbuuid: %d flog: %v going to start dcp stream",
 			logPrefix, c.workerName, c.tcpPort, c.Pid(), vb, vbuuid, flog)
 
-		vbKey := fmt.Sprintf("%s::vb::%d", c.app.AppName, vb)
+		vbKey := common.CheckpointBlobKey(c.app.AppName, vb)
 		var vbBlob vbucketKVBlob
 		var cas gocb.Cas
 		var isNoEnt bool
@@ -490,10 +524,7 @@ func (c *Consumer) startDcp(flogs couchbase.FailoverLog) error {
 			vbBlob.LastProcessedDocIDTimerEvent = time.Now().UTC().Format(time.RFC3339)
 			vbBlob.NextDocIDTimerToProcess = time.Now().UTC().Add(time.Second).Format(time.RFC3339)
 
-			vbBlobVer := vbucketKVBlobVer{
-				vbBlob,
-				util.EventingVer(),
-			}
+			vbBlobVer := newVbucketKVBlobVer(vbBlob)
 			err = util.Retry(util.NewFixedBackoff(bucketOpRetryInterval), c.retryCount, setOpCallback,
 				c, c.producer.AddMetadataPrefix(vbKey), &vbBlobVer)
 			if err == common.ErrRetryTimeout {
@@ -549,9 +580,7 @@ func (c *Consumer) startDcp(flogs couchbase.FailoverLog) error {
 
 			if vbBlob.NodeUUID == c.NodeUUID() || vbBlob.NodeUUID == "" {
 				// this specifically addresses the corner case described in MB-46092
-				c.workerVbucketMapRWMutex.RLock()
-				_, consumerPresent := c.workerVbucketMap[vbBlob.AssignedWorker]
-				c.workerVbucketMapRWMutex.RUnlock()
+				_, consumerPresent := c.getWorkerVbucketMap()[vbBlob.AssignedWorker]
 
 				if (vbBlob.AssignedWorker == c.ConsumerName() || vbBlob.AssignedWorker == "") || !consumerPresent {
 					if c.checkIfAlreadyEnqueued(vb) {
@@ -654,6 +683,21 @@ func (c *Consumer) addToAggChan(dcpFeed *couchbase.DcpFeed) {
 							logging.Infof("%s [%s:%s:%d] Closing dcp feed: %v, count: %d for bucket: %s",
 								logPrefix, c.workerName, c.tcpPort, c.Pid(), dcpFeed.GetName(),
 								len(dcpFeed.C), c.sourceKeyspace.BucketName)
+							if atomic.LoadUint32(&c.isTerminateRunning) == 1 {
+								c.dcpFeedEvents.disconnected(addr, "worker terminating", true)
+							} else {
+								c.dcpFeedEvents.disconnected(addr, "dcp feed closed", false)
+								c.failureDomains.record(common.FailureDomainNetwork, "dcp_feed_disconnect",
+									fmt.Errorf("dcp feed against kv node: %s closed", addr))
+							}
+						}
+					}
+					for addr, feed := range c.kvHostBootstrapDcpFeedMap {
+						if feed == dcpFeed {
+							delete(c.kvHostBootstrapDcpFeedMap, addr)
+							logging.Infof("%s [%s:%s:%d] Closing bootstrap dcp feed: %v, count: %d for bucket: %s",
+								logPrefix, c.workerName, c.tcpPort, c.Pid(), dcpFeed.GetName(),
+								len(dcpFeed.C), c.sourceKeyspace.BucketName)
 						}
 					}
 					c.hostDcpFeedRWMutex.Unlock()
@@ -667,11 +711,11 @@ func (c *Consumer) addToAggChan(dcpFeed *couchbase.DcpFeed) {
 				atomic.AddInt64(&c.aggDCPFeedMem, int64(len(e.Value)))
 				select {
 				case c.aggDCPFeed <- e:
-				case <-c.stopConsumerCh:
+				case <-c.ctx.Done():
 					return
 
 				}
-			case <-c.stopConsumerCh:
+			case <-c.ctx.Done():
 				return
 			}
 		}
@@ -696,6 +740,11 @@ func (c *Consumer) cleanupStaleDcpFeedHandles() error {
 	for kvAddr := range c.kvHostDcpFeedMap {
 		kvHostDcpFeedMapEntries = append(kvHostDcpFeedMapEntries, kvAddr)
 	}
+	for kvAddr := range c.kvHostBootstrapDcpFeedMap {
+		if _, ok := c.kvHostDcpFeedMap[kvAddr]; !ok {
+			kvHostDcpFeedMapEntries = append(kvHostDcpFeedMapEntries, kvAddr)
+		}
+	}
 	c.hostDcpFeedRWMutex.RUnlock()
 
 	kvAddrDcpFeedsToClose := util.StrSliceDiff(kvHostDcpFeedMapEntries, kvAddrListPerVbMap)
@@ -721,7 +770,16 @@ func (c *Consumer) cleanupStaleDcpFeedHandles() error {
 
 		c.hostDcpFeedRWMutex.Lock()
 		vbsMetadataToUpdate := c.dcpFeedVbMap[c.kvHostDcpFeedMap[kvAddr]]
+		if _, ok := c.kvHostDcpFeedMap[kvAddr]; ok {
+			c.dcpFeedEvents.disconnected(kvAddr, "kv node no longer hosts owned vbuckets", true)
+		}
 		delete(c.kvHostDcpFeedMap, kvAddr)
+		if feed, ok := c.kvHostBootstrapDcpFeedMap[kvAddr]; ok {
+			if feed != nil {
+				feed.Close()
+			}
+			delete(c.kvHostBootstrapDcpFeedMap, kvAddr)
+		}
 		c.hostDcpFeedRWMutex.Unlock()
 
 		for _, vb := range vbsMetadataToUpdate {
@@ -740,7 +798,7 @@ func (c *Consumer) clearUpOwnershipInfoFromMeta(vb uint16) error {
 	var vbBlob vbucketKVBlob
 	var cas gocb.Cas
 	logPrefix := "Consumer::clearUpOwnershipInfoFromMeta"
-	vbKey := fmt.Sprintf("%s::vb::%d", c.app.AppName, vb)
+	vbKey := common.CheckpointBlobKey(c.app.AppName, vb)
 
 	err := util.Retry(util.NewFixedBackoff(bucketOpRetryInterval), c.retryCount, getOpCallback,
 		c, c.producer.AddMetadataPrefix(vbKey), &vbBlob, &cas, false)
@@ -818,6 +876,28 @@ func (c *Consumer) dcpRequestStreamHandle(vb uint16, vbBlob *vbucketKVBlob, star
 		return err
 	}
 
+	// Vbs which are far behind get streamed until current high seqno over a dedicated
+	// feed, so that backfill doesn't starve steady-state streams. On STREAMEND they
+	// are reclaimed over steady-state feed
+	backfillEndSeqNo, isBackfill := c.getBackfillEndSeqNo(vb, start)
+
+	if isBackfill {
+		bootstrapFeed, err := c.getBootstrapDcpFeed(vbKvAddr)
+		if err == nil {
+			logging.Infof("%s [%s:%s:%d] vb: %d startSeq: %d highSeq: %d using bootstrap dcp feed: %v",
+				logPrefix, c.workerName, c.tcpPort, c.Pid(), vb, start, backfillEndSeqNo, bootstrapFeed.GetName())
+			return c.dcpRequestStream(vb, vbBlob, start, backfillEndSeqNo, mid, vbKvAddr, bootstrapFeed, true)
+		}
+
+		if err == common.ErrRetryTimeout {
+			logging.Errorf("%s [%s:%s:%d] Exiting due to timeout", logPrefix, c.workerName, c.tcpPort, c.Pid())
+			return err
+		}
+
+		logging.Errorf("%s [%s:%s:%d] vb: %d Failed to start bootstrap dcp feed, falling back to steady-state feed, err: %v",
+			logPrefix, c.workerName, c.tcpPort, c.Pid(), vb, err)
+	}
+
 	c.hostDcpFeedRWMutex.Lock()
 	dcpFeed, ok := c.kvHostDcpFeedMap[vbKvAddr]
 	if !ok {
@@ -837,12 +917,17 @@ func (c *Consumer) dcpRequestStreamHandle(vb uint16, vbBlob *vbucketKVBlob, star
 	}
 	c.hostDcpFeedRWMutex.Unlock()
 
-	c.Lock()
-	c.vbDcpFeedMap[vb] = dcpFeed
-	c.Unlock()
+	end := uint64(0xFFFFFFFFFFFFFFFF)
+	return c.dcpRequestStream(vb, vbBlob, start, end, mid, vbKvAddr, dcpFeed, false)
+}
+
+func (c *Consumer) dcpRequestStream(vb uint16, vbBlob *vbucketKVBlob, start, end uint64, mid, vbKvAddr string,
+	dcpFeed *couchbase.DcpFeed, isBootstrapFeed bool) error {
+	logPrefix := "Consumer::dcpRequestStream"
+
+	c.vbDcpFeeds.set(vb, dcpFeed)
 
 	opaque, flags := uint16(vb), uint32(0)
-	end := uint64(0xFFFFFFFFFFFFFFFF)
 
 	snapStart, snapEnd := start, start
 
@@ -853,31 +938,37 @@ func (c *Consumer) dcpRequestStreamHandle(vb uint16, vbBlob *vbucketKVBlob, star
 		return errDcpFeedsClosed
 	}
 
-	c.vbsStreamRRWMutex.Lock()
-	if _, ok := c.vbStreamRequested[vb]; !ok {
-		c.vbStreamRequested[vb] = start
-		logging.Infof("%s [%s:%s:%d] vb: %v Going to make DcpRequestStream call",
-			logPrefix, c.workerName, c.tcpPort, c.Pid(), vb)
-	} else {
-		c.vbsStreamRRWMutex.Unlock()
+	if !c.vbStreamRequests.add(vb, start) {
 		logging.Infof("%s [%s:%s:%d] vb: %v skipping DcpRequestStream call as one is already in-progress",
 			logPrefix, c.workerName, c.tcpPort, c.Pid(), vb)
 		return nil
 	}
-	c.vbsStreamRRWMutex.Unlock()
+	logging.Infof("%s [%s:%s:%d] vb: %v Going to make DcpRequestStream call",
+		logPrefix, c.workerName, c.tcpPort, c.Pid(), vb)
 
 	if atomic.LoadUint32(&c.isTerminateRunning) == 1 {
 		return fmt.Errorf("function is terminating")
 	}
 
+	if isBootstrapFeed {
+		c.addBootstrapStream(vb, end)
+	}
+
+	// Handover left behind by a stream that ended abruptly mustn't filter new stream
+	c.vbHandovers.finish(vb)
+
 	c.dcpStreamReqCounter++
-	err = dcpFeed.DcpRequestStream(vb, opaque, flags, vbBlob.VBuuid, start, end, snapStart, snapEnd, mid)
+	c.streamOpenTimings.start(vb)
+	err := dcpFeed.DcpRequestStream(vb, opaque, flags, vbBlob.VBuuid, start, end, snapStart, snapEnd, mid)
 	if err != nil {
 		c.dcpStreamReqErrCounter++
-		logging.Errorf("%s [%s:%s:%d] vb: %d STREAMREQ call failed on dcpFeed: %v, err: %v",
-			logPrefix, c.workerName, c.tcpPort, c.Pid(), vb, dcpFeed.GetName(), err)
+		c.streamOpenTimings.stop(vb)
+		retryAfter := c.streamReqTracker.recordFailure(vb, classifyStreamReqErr(err))
+		logging.Errorf("%s [%s:%s:%d] vb: %d STREAMREQ call failed on dcpFeed: %v, retry after: %v err: %v",
+			logPrefix, c.workerName, c.tcpPort, c.Pid(), vb, dcpFeed.GetName(), retryAfter, err)
 
 		c.purgeVbStreamRequested(logPrefix, vb)
+		c.purgeBootstrapStream(vb)
 
 		if c.checkIfCurrentConsumerShouldOwnVb(vb) {
 			c.Lock()
@@ -892,7 +983,11 @@ func (c *Consumer) dcpRequestStreamHandle(vb uint16, vbBlob *vbucketKVBlob, star
 		dcpFeed.Close()
 
 		c.hostDcpFeedRWMutex.Lock()
-		delete(c.kvHostDcpFeedMap, vbKvAddr)
+		if isBootstrapFeed {
+			delete(c.kvHostBootstrapDcpFeedMap, vbKvAddr)
+		} else {
+			delete(c.kvHostDcpFeedMap, vbKvAddr)
+		}
 		c.hostDcpFeedRWMutex.Unlock()
 
 		logging.Infof("%s [%s:%s:%d] vb: %d Closed and deleted dcpfeed mapping to kvAddr: %s",
@@ -918,7 +1013,7 @@ func (c *Consumer) dcpRequestStreamHandle(vb uint16, vbBlob *vbucketKVBlob, star
 			Timestamp:      time.Now().String(),
 		}
 
-		vbKey := fmt.Sprintf("%s::vb::%d", c.app.AppName, vb)
+		vbKey := common.CheckpointBlobKey(c.app.AppName, vb)
 		err = util.Retry(util.NewFixedBackoff(bucketOpRetryInterval), c.retryCount, addOwnershipHistorySRRCallback,
 			c, c.producer.AddMetadataPrefix(vbKey), &entry)
 		if err == common.ErrRetryTimeout {
@@ -966,9 +1061,15 @@ func (c *Consumer) handleFailoverLog() {
 				continue
 			}
 
+			if c.isVbPaused(vbFlog.vb) {
+				logging.Infof("%s [%s:%s:%d] vb: %d Skipping stream request retry as vb has been paused",
+					logPrefix, c.workerName, c.tcpPort, c.Pid(), vbFlog.vb)
+				continue
+			}
+
 			if vbFlog.streamReqRetry {
 
-				vbKey := fmt.Sprintf("%s::vb::%d", c.app.AppName, vbFlog.vb)
+				vbKey := common.CheckpointBlobKey(c.app.AppName, vbFlog.vb)
 				var vbBlob vbucketKVBlob
 				var cas gocb.Cas
 				var isNoEnt bool
@@ -1053,7 +1154,7 @@ func (c *Consumer) handleFailoverLog() {
 
 					select {
 					case c.reqStreamCh <- streamInfo:
-					case <-c.stopConsumerCh:
+					case <-c.ctx.Done():
 						return
 					}
 					c.vbProcessingStats.updateVbStat(vbFlog.vb, "start_seq_no", vbFlog.seqNo)
@@ -1064,7 +1165,7 @@ func (c *Consumer) handleFailoverLog() {
 				vbLabel:
 					for {
 						select {
-						case <-c.stopConsumerCh:
+						case <-c.ctx.Done():
 							return
 						default:
 							vbSeqNos, err := util.GetSeqnos(c.producer.NsServerHostPort(), "default", c.sourceKeyspace.BucketName, c.srcCid)
@@ -1082,6 +1183,14 @@ func (c *Consumer) handleFailoverLog() {
 
 					c.purgeVbStreamRequested(logPrefix, vbFlog.vb)
 
+					// Left to control routine to restream once backoff for the vbucket elapses
+					if !c.streamReqTracker.allow(vbFlog.vb) {
+						c.Lock()
+						c.vbsRemainingToRestream = append(c.vbsRemainingToRestream, vbFlog.vb)
+						c.Unlock()
+						continue
+					}
+
 					if c.checkIfAlreadyEnqueued(vbFlog.vb) {
 						continue
 					} else {
@@ -1098,7 +1207,7 @@ func (c *Consumer) handleFailoverLog() {
 					}
 					select {
 					case c.reqStreamCh <- streamInfo:
-					case <-c.stopConsumerCh:
+					case <-c.ctx.Done():
 						return
 					}
 					c.vbProcessingStats.updateVbStat(vbFlog.vb, "manifest_id", vbBlob.ManifestUID)
@@ -1107,7 +1216,7 @@ func (c *Consumer) handleFailoverLog() {
 				}
 			}
 
-		case <-c.stopConsumerCh:
+		case <-c.ctx.Done():
 			logging.Infof("%s [%s:%s:%d] Exiting failover log handling routine", logPrefix, c.workerName, c.tcpPort, c.Pid())
 			return
 		}
@@ -1144,11 +1253,11 @@ func (c *Consumer) sendEvent(e *cb.DcpEvent) error {
 	logPrefix := "Consumer::processTrappedEvent"
 
 	if !c.producer.IsTrapEvent() {
-		c.sendDcpEvent(e, false)
+		c.dispatchDcpEvent(e)
 		return nil
 	}
 
-	logging.Debugf("%s [%s:%s:%d] Trying to trap an event", logPrefix, c.workerName, c.tcpPort, c.Pid())
+	logging.AppDebugf(c.app.AppName, "%s [%s:%s:%d] Trying to trap an event", logPrefix, c.workerName, c.tcpPort, c.Pid())
 
 	var success bool
 	var instance common.DebuggerInstance
@@ -1161,14 +1270,19 @@ func (c *Consumer) sendEvent(e *cb.DcpEvent) error {
 	}
 
 	if success {
-		c.startDebugger(e, instance)
+		c.startDebugger([]*cb.DcpEvent{e}, instance)
 	} else {
-		c.sendDcpEvent(e, false)
+		c.dispatchDcpEvent(e)
 	}
 	return nil
 }
 
 func (c *Consumer) checkAndSendNoOp(seqNo uint64, partition uint16) {
+	// NoOp can't overtake mutations waiting on prefetch, one would follow anyway
+	if c.prefetchPending() {
+		return
+	}
+
 	lastSent := c.vbProcessingStats.getVbStat(partition, "last_sent_seq_no").(uint64)
 	if !c.producer.IsTrapEvent() && (seqNo-lastSent) >= noOpMsgSendThreshold {
 		c.sendNoOpEvent(seqNo, partition)
@@ -1257,7 +1371,7 @@ func (c *Consumer) processReqStreamMessages() {
 
 			streamReqWG.Wait()
 
-		case <-c.stopConsumerCh:
+		case <-c.ctx.Done():
 			logging.Infof("%s [%s:%s:%d] Exiting streamReq processing routine", logPrefix, c.workerName, c.tcpPort, c.Pid())
 			return
 		}
@@ -1268,6 +1382,7 @@ func (c *Consumer) handleStreamEnd(vBucket uint16, last_processed_seqno uint64)
 	logPrefix := "Consumer::handleStreamEnd"
 
 	c.purgeVbStreamRequested(logPrefix, vBucket)
+	c.checkpointBatcher.discard(vBucket)
 
 	c.inflightDcpStreamsRWMutex.Lock()
 	if _, exists := c.inflightDcpStreams[vBucket]; exists {
@@ -1277,23 +1392,33 @@ func (c *Consumer) handleStreamEnd(vBucket uint16, last_processed_seqno uint64)
 	}
 	c.inflightDcpStreamsRWMutex.Unlock()
 
-	vbKey := fmt.Sprintf("%s::vb::%d", c.app.AppName, vBucket)
+	// Mutations beyond handover seq no were left to the new owner. If it never took
+	// over, they're yet to be processed
+	handoverSeqNo, handedOver, lingered := c.vbHandovers.finish(vBucket)
+	if lingered && !handedOver && last_processed_seqno > handoverSeqNo {
+		last_processed_seqno = handoverSeqNo
+	}
 
-	seqNo := c.vbProcessingStats.getVbStat(vBucket, "last_read_seq_no").(uint64)
+	vbKey := common.CheckpointBlobKey(c.app.AppName, vBucket)
 
-	entry := OwnershipEntry{
-		AssignedWorker: c.ConsumerName(),
-		CurrentVBOwner: c.HostPortAddr(),
-		Operation:      dcpStreamStopped,
-		SeqNo:          seqNo,
-		Timestamp:      time.Now().String(),
-	}
+	var err error
+	if !handedOver {
+		seqNo := c.vbProcessingStats.getVbStat(vBucket, "last_read_seq_no").(uint64)
 
-	err := util.Retry(util.NewFixedBackoff(bucketOpRetryInterval), c.retryCount, addOwnershipHistorySECallback,
-		c, c.producer.AddMetadataPrefix(vbKey), &entry)
-	if err == common.ErrRetryTimeout {
-		logging.Errorf("%s [%s:%s:%d] Exiting due to timeout", logPrefix, c.workerName, c.tcpPort, c.Pid())
-		return
+		entry := OwnershipEntry{
+			AssignedWorker: c.ConsumerName(),
+			CurrentVBOwner: c.HostPortAddr(),
+			Operation:      dcpStreamStopped,
+			SeqNo:          seqNo,
+			Timestamp:      time.Now().String(),
+		}
+
+		err = util.Retry(util.NewFixedBackoff(bucketOpRetryInterval), c.retryCount, addOwnershipHistorySECallback,
+			c, c.producer.AddMetadataPrefix(vbKey), &entry)
+		if err == common.ErrRetryTimeout {
+			logging.Errorf("%s [%s:%s:%d] Exiting due to timeout", logPrefix, c.workerName, c.tcpPort, c.Pid())
+			return
+		}
 	}
 
 	c.filterVbEventsRWMutex.Lock()
@@ -1306,18 +1431,24 @@ func (c *Consumer) handleStreamEnd(vBucket uint16, last_processed_seqno uint64)
 	var cas gocb.Cas
 	c.vbProcessingStats.updateVbStat(vBucket, "last_processed_seq_no", last_processed_seqno)
 
-	err = util.Retry(util.NewFixedBackoff(bucketOpRetryInterval), c.retryCount, getOpCallback,
-		c, c.producer.AddMetadataPrefix(vbKey), &vbBlob, &cas, false)
-	if err == common.ErrRetryTimeout {
-		logging.Errorf("%s [%s:%s:%d] Exiting due to timeout", logPrefix, c.workerName, c.tcpPort, c.Pid())
-		return
-	}
+	if handedOver {
+		// New owner streams the vb from handover seq no, metadata belongs to it
+		logging.Infof("%s [%s:%s:%d] vb: %d got STREAMEND post handover at seq no: %d, skipping checkpoint update",
+			logPrefix, c.workerName, c.tcpPort, c.Pid(), vBucket, handoverSeqNo)
+	} else {
+		err = util.Retry(util.NewFixedBackoff(bucketOpRetryInterval), c.retryCount, getOpCallback,
+			c, c.producer.AddMetadataPrefix(vbKey), &vbBlob, &cas, false)
+		if err == common.ErrRetryTimeout {
+			logging.Errorf("%s [%s:%s:%d] Exiting due to timeout", logPrefix, c.workerName, c.tcpPort, c.Pid())
+			return
+		}
 
-	vbBlob.LastSeqNoProcessed = last_processed_seqno
-	err = c.updateCheckpoint(vbKey, vBucket, &vbBlob)
-	if err == common.ErrRetryTimeout {
-		logging.Errorf("%s [%s:%s:%d] Exiting due to timeout", logPrefix, c.workerName, c.tcpPort, c.Pid())
-		return
+		vbBlob.LastSeqNoProcessed = last_processed_seqno
+		err = c.updateCheckpoint(vbKey, vBucket, &vbBlob)
+		if err == common.ErrRetryTimeout {
+			logging.Errorf("%s [%s:%s:%d] Exiting due to timeout", logPrefix, c.workerName, c.tcpPort, c.Pid())
+			return
+		}
 	}
 
 	c.vbProcessingStats.updateVbStat(vBucket, "assigned_worker", "")
@@ -1327,6 +1458,13 @@ func (c *Consumer) handleStreamEnd(vBucket uint16, last_processed_seqno uint64)
 	c.vbProcessingStats.updateVbStat(vBucket, "dcp_stream_requested_worker", "")
 	c.vbProcessingStats.updateVbStat(vBucket, "vb_filter_ack_received", true)
 
+	if c.isVbPaused(vBucket) {
+		logging.Infof("%s [%s:%s:%d] vb: %d got STREAMEND, holding it as it has been paused",
+			logPrefix, c.workerName, c.tcpPort, c.Pid(), vBucket)
+		c.vbProcessingStats.updateVbStat(vBucket, "dcp_stream_status", dcpStreamPaused)
+		return
+	}
+
 	if c.checkIfCurrentConsumerShouldOwnVb(vBucket) {
 		logging.Infof("%s [%s:%s:%d] vb: %d got STREAMEND, needs to be reclaimed",
 			logPrefix, c.workerName, c.tcpPort, c.Pid(), vBucket)
@@ -1360,14 +1498,13 @@ func (c *Consumer) processAndSendDcpDelOrExpMessage(e *cb.DcpEvent, functionInst
 	logPrefix := "Consumer::processAndSendDcpMessage"
 	switch e.Datatype {
 	case uint8(includeXATTRs):
-		xattrLen := binary.BigEndian.Uint32(e.Value[0:4])
 		if c.producer.SrcMutation() && checkRecursiveEvent {
 			if isRecursive, err := c.isRecursiveDCPEvent(e, functionInstanceID); err == nil && isRecursive == true {
 				return false
 			}
 		}
-		e.Value = e.Value[xattrLen+4:]
-		logging.Tracef("%s [%s:%s:%d] Sending key: %ru to be processed by JS handlers",
+		// xattrs are retained in the value, they're passed on to handler as tombstone metadata
+		logging.AppTracef(c.app.AppName, "%s [%s:%s:%d] Sending key: %ru to be processed by JS handlers",
 			logPrefix, c.workerName, c.tcpPort, c.Pid(), string(e.Key))
 		c.sendEvent(e)
 	default:
@@ -1380,18 +1517,22 @@ func (c *Consumer) sendXattrDoc(e *cb.DcpEvent, functionInstanceID string) {
 	logPrefix := "Consumer::sendXattrDoc"
 
 	xattrLen := binary.BigEndian.Uint32(e.Value[0:4])
-	if c.producer.SrcMutation() {
+	if c.includeXattrs {
+		e.Xattrs = c.getMutationXattrs(e)
+	}
+
+	if c.producer.SrcMutation() || c.originTagging {
 		if isRecursive, err := c.isRecursiveDCPEvent(e, functionInstanceID); err == nil && isRecursive == true {
 			c.suppressedDCPMutationCounter++
 		} else {
-			logging.Tracef("%s [%s:%s:%d] No IntraHandlerRecursion, sending key: %ru to be processed by JS handlers",
+			logging.AppTracef(c.app.AppName, "%s [%s:%s:%d] No IntraHandlerRecursion, sending key: %ru to be processed by JS handlers",
 				logPrefix, c.workerName, c.tcpPort, c.Pid(), string(e.Key))
 			c.dcpMutationCounter++
 			e.Value = e.Value[xattrLen+4:]
 			c.sendEvent(e)
 		}
 	} else {
-		logging.Tracef("%s [%s:%s:%d] Sending key: %ru to be processed by JS handlers",
+		logging.AppTracef(c.app.AppName, "%s [%s:%s:%d] Sending key: %ru to be processed by JS handlers",
 			logPrefix, c.workerName, c.tcpPort, c.Pid(), string(e.Key))
 		c.dcpMutationCounter++
 		e.Value = e.Value[xattrLen+4:]
@@ -1399,6 +1540,45 @@ func (c *Consumer) sendXattrDoc(e *cb.DcpEvent, functionInstanceID string) {
 	}
 }
 
+// handleOversizedDoc applies the configured max_doc_size_mode to a mutation whose
+// value exceeds max_doc_size_bytes. Returns true if the event should still be
+// dispatched to the worker
+func (c *Consumer) handleOversizedDoc(e *cb.DcpEvent) bool {
+	logPrefix := "Consumer::handleOversizedDoc"
+
+	docSize := len(e.Value)
+
+	if c.maxDocSizeLog {
+		c.producer.WriteAppLog(fmt.Sprintf("Document key: %s vb: %d seq: %d size: %d exceeds max_doc_size_bytes: %d, action: %s",
+			string(e.Key), e.VBucket, e.Seqno, docSize, c.maxDocSizeBytes, c.maxDocSizeMode))
+	}
+
+	if c.maxDocSizeMode == common.MaxDocSizeModeMetadataOnly {
+		logging.AppDebugf(c.app.AppName, "%s [%s:%s:%d] vb: %d key: %ru size: %d exceeds max doc size: %d, dispatching metadata only",
+			logPrefix, c.workerName, c.tcpPort, c.Pid(), e.VBucket, string(e.Key), docSize, c.maxDocSizeBytes)
+
+		c.oversizedDocTruncateCounter++
+
+		// Drop the body along with any xattrs. Handler receives null for json
+		// documents and an empty buffer for binary documents
+		if e.Datatype == dcpDatatypeBinary || e.Datatype == dcpDatatypeBinXattr {
+			e.Datatype = dcpDatatypeBinary
+			e.Value = []byte{}
+		} else {
+			e.Datatype = dcpDatatypeJSON
+			e.Value = []byte("null")
+		}
+		return true
+	}
+
+	logging.AppDebugf(c.app.AppName, "%s [%s:%s:%d] vb: %d key: %ru size: %d exceeds max doc size: %d, skipping",
+		logPrefix, c.workerName, c.tcpPort, c.Pid(), e.VBucket, string(e.Key), docSize, c.maxDocSizeBytes)
+
+	c.oversizedDocSkipCounter++
+	c.checkAndSendNoOp(e.Seqno, e.VBucket)
+	return false
+}
+
 // return true if filter event else false
 func (c *Consumer) filterMutations(e *cb.DcpEvent) bool {
 	c.filterVbEventsRWMutex.RLock()
@@ -1408,8 +1588,18 @@ func (c *Consumer) filterMutations(e *cb.DcpEvent) bool {
 	}
 	c.filterVbEventsRWMutex.RUnlock()
 
-	c.vbProcessingStats.updateVbStat(e.VBucket, "last_read_seq_no", e.Seqno)
-	if c.srcCid != e.CollectionID {
+	if c.vbHandovers.filter(e.VBucket, e.Seqno) {
+		return true
+	}
+
+	c.recordReadSeqNo(e.VBucket, e.Seqno)
+	if _, ok := c.srcCids[e.CollectionID]; !ok {
+		c.checkAndSendNoOp(e.Seqno, e.VBucket)
+		return true
+	}
+
+	if !c.keyFilter.match(e.Key) {
+		c.keyFilteredCounter++
 		c.checkAndSendNoOp(e.Seqno, e.VBucket)
 		return true
 	}
@@ -1417,6 +1607,12 @@ func (c *Consumer) filterMutations(e *cb.DcpEvent) bool {
 	return false
 }
 
+// skipBinaryDoc drops binary mutation the function isn't to see, acking its seqno
+func (c *Consumer) skipBinaryDoc(e *cb.DcpEvent) {
+	c.binaryDocSkipCounter++
+	c.checkAndSendNoOp(e.Seqno, e.VBucket)
+}
+
 func (c *Consumer) isTransactionMutation(e *cb.DcpEvent) bool {
 	return bytes.HasPrefix(e.Key, cb.TransactionMutationPrefix)
 }
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/couchbase/eventing/common"
@@ -24,6 +25,12 @@ const (
 	filterEvent
 	reservedEvent
 	pauseConsumer
+	busEvent
+)
+
+const (
+	busOpcode int8 = iota
+	busDeliver
 )
 
 const (
@@ -35,6 +42,7 @@ const (
 const (
 	timerOpcode int8 = iota
 	timer
+	cancelTimer
 )
 
 const (
@@ -58,6 +66,10 @@ const (
 	v8WorkerLcbExceptions
 	v8WorkerCurlLatencyStats
 	v8WorkerInsight
+	v8WorkerLoadChunk
+	v8WorkerLoadChunkCommit
+	v8WorkerHandshake
+	v8WorkerN1qlLatencyStats
 )
 
 const (
@@ -65,6 +77,7 @@ const (
 	dcpDeletion
 	dcpMutation
 	dcpNoOp
+	dcpExpiration
 )
 
 const (
@@ -75,6 +88,12 @@ const (
 	timerContextSize
 	vbMap
 	workerThreadMemQuota
+	handlerExecutionTimeout
+	socketBatchSize
+	dispatchLanes
+	deadLetterRetries
+	handlerRetryPolicy
+	strictOrderCheck
 )
 
 // message and opcode types for interpreting messages from C++ To Go
@@ -85,6 +104,8 @@ const (
 	bucketOpsResponse
 	bucketOpsFilterAck
 	pauseAck
+	deadLetterResponse
+	busEventResponse
 )
 
 const (
@@ -101,14 +122,21 @@ const (
 	lcbExceptions
 	curlLatencyStats
 	insight
+	workerCapabilities
+	loadChunkAck
+	handshakeAck
+	frameChecksumMismatch
+	n1qlLatencyStats
 )
 
 const (
 	docTimerResponseOpcode int8 = iota
+	timerAckOpcode
 )
 
 const (
 	bucketOpsResponseOpcode int8 = iota
+	handlerAckOpcode
 )
 
 const (
@@ -120,87 +148,134 @@ type message struct {
 	Payload []byte
 }
 
-func (c *Consumer) makeDcpMutationHeader(partition int16, mutationMeta string) ([]byte, *flatbuffers.Builder) {
+func (c *Consumer) makeDcpMutationHeader(partition int16, mutationMeta string) ([]byte, *pooledBuilder) {
 	return c.makeDcpHeader(dcpMutation, partition, mutationMeta)
 }
 
-func (c *Consumer) makeDcpDeletionHeader(partition int16, deletionMeta string) ([]byte, *flatbuffers.Builder) {
+// makeDcpDeletionHeader tags expired documents with their own opcode, so that worker
+// can tell them apart from explicit deletes. Workers predating the opcode get a
+// deletion instead, expiry is still carried in the payload options
+func (c *Consumer) makeDcpDeletionHeader(partition int16, deletionMeta string, expired bool) ([]byte, *pooledBuilder) {
+	if expired && atomic.LoadUint32(&c.protocolVersion) >= protocolVersionExpirationOpcode {
+		return c.makeDcpHeader(dcpExpiration, partition, deletionMeta)
+	}
 	return c.makeDcpHeader(dcpDeletion, partition, deletionMeta)
 }
 
-func (c *Consumer) makeDcpNoOpHeader(partition int16, meta string) ([]byte, *flatbuffers.Builder) {
+func (c *Consumer) makeDcpNoOpHeader(partition int16, meta string) ([]byte, *pooledBuilder) {
 	return c.makeDcpHeader(dcpNoOp, partition, meta)
 }
 
-func (c *Consumer) makeDcpHeader(opcode int8, partition int16, meta string) ([]byte, *flatbuffers.Builder) {
-	return c.makeHeader(dcpEvent, opcode, partition, meta)
+func (c *Consumer) makeDcpHeader(opcode int8, partition int16, meta string) ([]byte, *pooledBuilder) {
+	return c.makeSeqHeader(dcpEvent, opcode, partition, c.dispatchOrder.next(partition), meta)
 }
 
-func (c *Consumer) filterEventHeader(opcode int8, partition int16, meta string) ([]byte, *flatbuffers.Builder) {
+func (c *Consumer) filterEventHeader(opcode int8, partition int16, meta string) ([]byte, *pooledBuilder) {
 	return c.makeHeader(filterEvent, opcode, partition, meta)
 }
 
-func (c *Consumer) makeVbFilterHeader(partition int16, meta string) ([]byte, *flatbuffers.Builder) {
+func (c *Consumer) makeVbFilterHeader(partition int16, meta string) ([]byte, *pooledBuilder) {
 	return c.filterEventHeader(vbFilter, partition, meta)
 }
 
-func (c *Consumer) makePauseConsumerHeader() ([]byte, *flatbuffers.Builder) {
+func (c *Consumer) makePauseConsumerHeader() ([]byte, *pooledBuilder) {
 	return c.makeHeader(pauseConsumer, 0, 0, "")
 }
-func (c *Consumer) makeProcessedSeqNoHeader(partition int16, meta string) ([]byte, *flatbuffers.Builder) {
+func (c *Consumer) makeProcessedSeqNoHeader(partition int16, meta string) ([]byte, *pooledBuilder) {
 	return c.filterEventHeader(processedSeqNo, partition, meta)
 }
 
-func (c *Consumer) makeV8DebuggerStartHeader() ([]byte, *flatbuffers.Builder) {
-	return c.makeV8DebuggerHeader(startDebug, "")
+// makeV8DebuggerStartHeader passes token of debug session, which frontend has to
+// present while connecting to the debugger
+func (c *Consumer) makeV8DebuggerStartHeader(token string) ([]byte, *pooledBuilder) {
+	return c.makeV8DebuggerHeader(startDebug, token)
 }
 
-func (c *Consumer) makeV8DebuggerStopHeader() ([]byte, *flatbuffers.Builder) {
+func (c *Consumer) makeV8DebuggerStopHeader() ([]byte, *pooledBuilder) {
 	return c.makeV8DebuggerHeader(stopDebug, "")
 }
 
-func (c *Consumer) makeV8DebuggerHeader(opcode int8, meta string) ([]byte, *flatbuffers.Builder) {
+func (c *Consumer) makeV8DebuggerHeader(opcode int8, meta string) ([]byte, *pooledBuilder) {
 	return c.makeHeader(debuggerEvent, opcode, 0, meta)
 }
 
-func (c *Consumer) makeV8InitOpcodeHeader() ([]byte, *flatbuffers.Builder) {
+func (c *Consumer) makeCancelTimerHeader(meta string) ([]byte, *pooledBuilder) {
+	return c.makeHeader(timerEvent, cancelTimer, 0, meta)
+}
+
+func (c *Consumer) makeBusEventHeader(meta string) ([]byte, *pooledBuilder) {
+	return c.makeHeader(busEvent, busDeliver, 0, meta)
+}
+
+func (c *Consumer) makeV8InitOpcodeHeader() ([]byte, *pooledBuilder) {
 	return c.makeV8EventHeader(v8WorkerInit, "")
 }
 
-func (c *Consumer) makeV8CompileOpcodeHeader(appCode string) ([]byte, *flatbuffers.Builder) {
+func (c *Consumer) makeV8CompileOpcodeHeader(appCode string) ([]byte, *pooledBuilder) {
 	return c.makeV8EventHeader(v8WorkerCompile, appCode)
 }
 
-func (c *Consumer) makeV8LoadOpcodeHeader(appCode string) ([]byte, *flatbuffers.Builder) {
+func (c *Consumer) makeV8LoadOpcodeHeader(appCode string) ([]byte, *pooledBuilder) {
 	return c.makeV8EventHeader(v8WorkerLoad, appCode)
 }
 
-func (c *Consumer) makeV8EventHeader(opcode int8, meta string) ([]byte, *flatbuffers.Builder) {
+func (c *Consumer) makeV8EventHeader(opcode int8, meta string) ([]byte, *pooledBuilder) {
 	return c.makeHeader(v8WorkerEvent, opcode, 0, meta)
 }
 
-func (c *Consumer) makeLogLevelHeader(meta string) ([]byte, *flatbuffers.Builder) {
+func (c *Consumer) makeLogLevelHeader(meta string) ([]byte, *pooledBuilder) {
 	return c.makeHeader(appWorkerSetting, logLevel, 0, meta)
 }
 
-func (c *Consumer) makeTimerContextSizeHeader(meta string) ([]byte, *flatbuffers.Builder) {
+func (c *Consumer) makeTimerContextSizeHeader(meta string) ([]byte, *pooledBuilder) {
 	return c.makeHeader(appWorkerSetting, timerContextSize, 0, meta)
 }
 
-func (c *Consumer) makeThrCountHeader(meta string) ([]byte, *flatbuffers.Builder) {
+func (c *Consumer) makeExecutionTimeoutHeader(meta string) ([]byte, *pooledBuilder) {
+	return c.makeHeader(appWorkerSetting, handlerExecutionTimeout, 0, meta)
+}
+
+func (c *Consumer) makeSocketBatchSizeHeader(meta string) ([]byte, *pooledBuilder) {
+	return c.makeHeader(appWorkerSetting, socketBatchSize, 0, meta)
+}
+
+func (c *Consumer) makeDispatchLanesHeader(meta string) ([]byte, *pooledBuilder) {
+	return c.makeHeader(appWorkerSetting, dispatchLanes, 0, meta)
+}
+
+func (c *Consumer) makeDeadLetterRetriesHeader(meta string) ([]byte, *pooledBuilder) {
+	return c.makeHeader(appWorkerSetting, deadLetterRetries, 0, meta)
+}
+
+func (c *Consumer) makeRetryPolicyHeader(meta string) ([]byte, *pooledBuilder) {
+	return c.makeHeader(appWorkerSetting, handlerRetryPolicy, 0, meta)
+}
+
+func (c *Consumer) makeStrictOrderCheckHeader(meta string) ([]byte, *pooledBuilder) {
+	return c.makeHeader(appWorkerSetting, strictOrderCheck, 0, meta)
+}
+
+func (c *Consumer) makeThrCountHeader(meta string) ([]byte, *pooledBuilder) {
 	return c.makeHeader(appWorkerSetting, workerThreadCount, 0, meta)
 }
 
-func (c *Consumer) makeThrMapHeader() ([]byte, *flatbuffers.Builder) {
+func (c *Consumer) makeThrMapHeader() ([]byte, *pooledBuilder) {
 	return c.makeHeader(appWorkerSetting, workerThreadPartitionMap, 0, "")
 }
 
-func (c *Consumer) makeVbMapHeader() ([]byte, *flatbuffers.Builder) {
+func (c *Consumer) makeVbMapHeader() ([]byte, *pooledBuilder) {
 	return c.makeHeader(appWorkerSetting, vbMap, 0, "")
 }
 
-func (c *Consumer) makeHeader(event int8, opcode int8, partition int16, meta string) (encodedHeader []byte, builder *flatbuffers.Builder) {
-	builder = c.getBuilder()
+func (c *Consumer) makeHeader(event int8, opcode int8, partition int16, meta string) (encodedHeader []byte, pooled *pooledBuilder) {
+	return c.makeSeqHeader(event, opcode, partition, 0, meta)
+}
+
+// makeSeqHeader stamps header with dispatch seq of the message within its partition.
+// A seq of 0 means message isn't subject to ordering checks
+func (c *Consumer) makeSeqHeader(event int8, opcode int8, partition int16, seq uint64, meta string) (encodedHeader []byte, pooled *pooledBuilder) {
+	pooled = c.getBuilder()
+	builder := pooled.Builder
 
 	metadata := builder.CreateString(meta)
 
@@ -210,6 +285,7 @@ func (c *Consumer) makeHeader(event int8, opcode int8, partition int16, meta str
 	header.HeaderAddOpcode(builder, opcode)
 	header.HeaderAddPartition(builder, partition)
 	header.HeaderAddMetadata(builder, metadata)
+	header.HeaderAddSeq(builder, seq)
 
 	headerPos := header.HeaderEnd(builder)
 	builder.Finish(headerPos)
@@ -236,8 +312,9 @@ func (c *Consumer) createHandlerFooters(builder *flatbuffers.Builder) flatbuffer
 	return builder.EndVector(len(c.handlerFooters))
 }
 
-func (c *Consumer) makeThrMapPayload(thrMap map[int][]uint16, partitionCount int) (encodedPayload []byte, builder *flatbuffers.Builder) {
-	builder = c.getBuilder()
+func (c *Consumer) makeThrMapPayload(thrMap map[int][]uint16, partitionCount int) (encodedPayload []byte, pooled *pooledBuilder) {
+	pooled = c.getBuilder()
+	builder := pooled.Builder
 
 	tMaps := make([]flatbuffers.UOffsetT, 0)
 
@@ -273,8 +350,9 @@ func (c *Consumer) makeThrMapPayload(thrMap map[int][]uint16, partitionCount int
 	return
 }
 
-func (c *Consumer) makeVbMapPayload(assgnedVbs []uint16) (encodedPayload []byte, builder *flatbuffers.Builder) {
-	builder = c.getBuilder()
+func (c *Consumer) makeVbMapPayload(assgnedVbs []uint16) (encodedPayload []byte, pooled *pooledBuilder) {
+	pooled = c.getBuilder()
+	builder := pooled.Builder
 	payload.PayloadStartVbMapVector(builder, len(assgnedVbs))
 	for i := len(assgnedVbs) - 1; i >= 0; i-- {
 		builder.PrependUint16(assgnedVbs[i])
@@ -288,19 +366,28 @@ func (c *Consumer) makeVbMapPayload(assgnedVbs []uint16) (encodedPayload []byte,
 	return
 }
 
-func (c *Consumer) makeDcpPayload(key, value []byte, isBinary bool) (encodedPayload []byte, builder *flatbuffers.Builder) {
-	builder = c.getBuilder()
+func (c *Consumer) makeDcpPayload(key, value, xattrs []byte, isBinary bool) (encodedPayload []byte, pooled *pooledBuilder) {
+	pooled = c.getSizedBuilder(len(key) + len(value) + len(xattrs) + dcpPayloadOverhead)
+	builder := pooled.Builder
 
 	binary := make([]byte, 1)
 	flatbuffers.WriteBool(binary, isBinary)
 	keyPos := builder.CreateByteString(key)
 	valPos := builder.CreateByteString(value)
 
+	var xattrsPos flatbuffers.UOffsetT
+	if len(xattrs) > 0 {
+		xattrsPos = builder.CreateByteString(xattrs)
+	}
+
 	payload.PayloadStart(builder)
 
 	payload.PayloadAddIsBinary(builder, binary[0])
 	payload.PayloadAddKey(builder, keyPos)
 	payload.PayloadAddValue(builder, valPos)
+	if len(xattrs) > 0 {
+		payload.PayloadAddXattrs(builder, xattrsPos)
+	}
 
 	payloadPos := payload.PayloadEnd(builder)
 	builder.Finish(payloadPos)
@@ -312,8 +399,9 @@ func (c *Consumer) makeDcpPayload(key, value []byte, isBinary bool) (encodedPayl
 func (c *Consumer) makeV8InitPayload(appName, debuggerPort, currHost, eventingDir, eventingPort,
 	eventingSSLPort, depCfg string, capacity, executionTimeout, checkpointInterval int,
 	skipLcbBootstrap bool, timerContextSize int64,
-	usingTimer, srcMutation bool) (encodedPayload []byte, builder *flatbuffers.Builder) {
-	builder = c.getBuilder()
+	usingTimer, srcMutation bool) (encodedPayload []byte, pooled *pooledBuilder) {
+	pooled = c.getBuilder()
+	builder := pooled.Builder
 
 	app := builder.CreateString(appName)
 	dp := builder.CreateString(debuggerPort)
@@ -365,6 +453,7 @@ func (c *Consumer) makeV8InitPayload(appName, debuggerPort, currHost, eventingDi
 	payload.PayloadAddHandlerHeaders(builder, handlerHeaders)
 	payload.PayloadAddHandlerFooters(builder, handlerFooters)
 	payload.PayloadAddN1qlConsistency(builder, n1qlConsistency)
+	payload.PayloadAddN1qlTimeout(builder, int32(c.n1qlTimeout))
 	payload.PayloadAddLcbRetryCount(builder, int32(c.lcbRetryCount))
 	payload.PayloadAddLcbTimeout(builder, int32(c.lcbTimeout))
 	payload.PayloadAddSrcMutation(builder, smu[0])
@@ -426,28 +515,39 @@ func (c *Consumer) routeResponse(msgType, opcode int8, msg string) {
 		case latencyStats:
 			c.workerRespMainLoopTs.Store(time.Now())
 
-			deltas := make(common.StatsData)
-			err := json.Unmarshal([]byte(msg), &deltas)
+			deltas, err := parseCounterStats(msg)
 			if err != nil {
-				logging.Errorf("%s [%s:%s:%d] Failed to unmarshal latency stats, msg: %v err: %v",
-					logPrefix, c.workerName, c.tcpPort, c.Pid(), msg, err)
+				c.quarantineStats(opcode, msg, err)
+				return
 			}
+			c.statsAccepted(opcode)
 			c.producer.AppendLatencyStats(deltas)
 
 		case curlLatencyStats:
 			c.workerRespMainLoopTs.Store(time.Now())
 
-			deltas := make(common.StatsData)
-			err := json.Unmarshal([]byte(msg), &deltas)
+			deltas, err := parseCounterStats(msg)
 			if err != nil {
-				logging.Errorf("%s [%s:%s:%d] Failed to unmarshal curl latency stats, msg: %v err: %v",
-					logPrefix, c.workerName, c.tcpPort, c.Pid(), msg, err)
+				c.quarantineStats(opcode, msg, err)
+				return
 			}
+			c.statsAccepted(opcode)
 			c.producer.AppendCurlLatencyStats(deltas)
 
+		case n1qlLatencyStats:
+			c.workerRespMainLoopTs.Store(time.Now())
+
+			deltas, err := parseCounterStats(msg)
+			if err != nil {
+				c.quarantineStats(opcode, msg, err)
+				return
+			}
+			c.statsAccepted(opcode)
+			c.producer.AppendN1qlLatencyStats(deltas)
+
 		case insight:
 			c.workerRespMainLoopTs.Store(time.Now())
-			logging.Debugf("%s [%s:%s:%d] Received insight: %v", logPrefix, c.workerName, c.tcpPort, c.Pid(), msg)
+			logging.AppDebugf(c.app.AppName, "%s [%s:%s:%d] Received insight: %v", logPrefix, c.workerName, c.tcpPort, c.Pid(), msg)
 			insight := common.NewInsight()
 			err := json.Unmarshal([]byte(msg), insight)
 			if err != nil {
@@ -459,59 +559,91 @@ func (c *Consumer) routeResponse(msgType, opcode int8, msg string) {
 		case failureStats:
 			c.workerRespMainLoopTs.Store(time.Now())
 
-			c.statsRWMutex.Lock()
-			defer c.statsRWMutex.Unlock()
-			err := json.Unmarshal([]byte(msg), &c.failureStats)
+			stats, err := parseFailureStats(msg)
 			if err != nil {
-				logging.Errorf("%s [%s:%s:%d] Failed to unmarshal failure stats, msg: %v err: %v",
-					logPrefix, c.workerName, c.tcpPort, c.Pid(), msg, err)
+				c.quarantineStats(opcode, msg, err)
+				return
 			}
+			c.statsAccepted(opcode)
+			c.failureDomains.observeWorkerStats(stats)
+
+			c.statsRWMutex.Lock()
+			defer c.statsRWMutex.Unlock()
+			c.failureStats = stats
 		case executionStats:
 			c.workerRespMainLoopTs.Store(time.Now())
 
+			stats, err := parseExecutionStats(msg)
+			if err != nil {
+				c.quarantineStats(opcode, msg, err)
+				return
+			}
+			c.statsAccepted(opcode)
+
 			c.statsRWMutex.Lock()
 			defer c.statsRWMutex.Unlock()
-			err := json.Unmarshal([]byte(msg), &c.executionStats)
-			if err != nil {
-				logging.Errorf("%s [%s:%s:%d] Failed to unmarshal execution stats, msg: %v err: %v",
-					logPrefix, c.workerName, c.tcpPort, c.Pid(), msg, err)
-			} else {
-				if val, ok := c.executionStats["timer_create_counter"]; ok {
-					c.timerResponsesRecieved = uint64(val.(float64))
-				}
-				if val, ok := c.executionStats["timer_msg_counter"]; ok {
-					c.timerMessagesProcessed = uint64(val.(float64))
-				}
+			c.executionStats = stats
+			c.updateLaneStats(stats)
+			if val, ok := c.executionStats["timer_create_counter"].(float64); ok {
+				c.timerResponsesRecieved = uint64(val)
+			}
+			if val, ok := c.executionStats["timer_msg_counter"].(float64); ok {
+				c.timerMessagesProcessed = uint64(val)
+			}
+			if val, ok := c.executionStats["timer_cancel_counter"].(float64); ok {
+				c.timerCancelled = uint64(val)
 			}
 		case compileInfo:
-			err := json.Unmarshal([]byte(msg), &c.compileInfo)
+			info := &common.CompileStatus{}
+			err := json.Unmarshal([]byte(msg), info)
 			if err != nil {
 				logging.Errorf("%s [%s:%s:%d] Failed to unmarshal compilation stats, msg: %v err: %v",
 					logPrefix, c.workerName, c.tcpPort, c.Pid(), msg, err)
 			}
+			c.compileInfo = info
+
+			select {
+			case c.signalCompileInfoCh <- info:
+			default:
+			}
 		case queueSize:
 			c.workerRespMainLoopTs.Store(time.Now())
 
-			err := json.Unmarshal([]byte(msg), &c.cppQueueSizes)
+			sizes, err := parseQueueSizes(msg)
 			if err != nil {
-				logging.Errorf("%s [%s:%s:%d] Failed to unmarshal cpp queue sizes, msg: %v err: %v",
-					logPrefix, c.workerName, c.tcpPort, c.Pid(), msg, err)
+				c.quarantineStats(opcode, msg, err)
+				return
 			}
+			c.statsAccepted(opcode)
+			c.cppQueueSizes = sizes
+		case workerCapabilities:
+			c.handleWorkerCapabilities(msg)
+		case loadChunkAck:
+			c.handleLoadChunkAck(msg)
+		case handshakeAck:
+			c.handleHandshakeAck(msg)
+		case frameChecksumMismatch:
+			c.handleWorkerChecksumFailure(msg)
 		case lcbExceptions:
 			c.workerRespMainLoopTs.Store(time.Now())
 
-			c.statsRWMutex.Lock()
-			defer c.statsRWMutex.Unlock()
-			err := json.Unmarshal([]byte(msg), &c.lcbExceptionStats)
+			stats, err := parseCounterStats(msg)
 			if err != nil {
-				logging.Errorf("%s [%s:%s:%d] Failed to unmarshal lcb exception stats, msg: %v err: %v",
-					logPrefix, c.workerName, c.tcpPort, c.Pid(), msg, err)
+				c.quarantineStats(opcode, msg, err)
+				return
 			}
+			c.statsAccepted(opcode)
+
+			c.statsRWMutex.Lock()
+			defer c.statsRWMutex.Unlock()
+			c.lcbExceptionStats = stats
 		}
 
 	case bucketOpsResponse:
+		// Worker appends dispatch seq of last message it processed for the vb,
+		// when strict order check is enabled
 		data := strings.Split(msg, "::")
-		if len(data) != 2 {
+		if len(data) != 2 && len(data) != 3 {
 			logging.Errorf("%s [%s:%s:%d] Invalid bucket ops message received: %s",
 				logPrefix, c.workerName, c.tcpPort, c.Pid(), msg)
 			return
@@ -530,12 +662,34 @@ func (c *Consumer) routeResponse(msgType, opcode int8, msg string) {
 				logPrefix, c.workerName, c.tcpPort, c.Pid(), seqNoStr, msg, err)
 			return
 		}
+
+		if len(data) == 3 && opcode == handlerAckOpcode {
+			dispatchSeq, err := strconv.ParseUint(data[2], 10, 64)
+			if err != nil {
+				logging.Errorf("%s [%s:%s:%d] Failed to convert dispatchSeqStr: %s to uint64, msg: %s err: %v",
+					logPrefix, c.workerName, c.tcpPort, c.Pid(), data[2], msg, err)
+				return
+			}
+			c.checkDispatchOrder(uint16(vb), dispatchSeq)
+		}
+
+		// With at least once delivery, checkpoint advances only once handler is done
+		// with the mutation. Otherwise it advances as mutations are sent to the handler
+		if c.atLeastOnce != (opcode == handlerAckOpcode) {
+			return
+		}
+
+		seqNo = c.deadLetterHolds.limit(uint16(vb), seqNo)
 		prevSeqNo := c.vbProcessingStats.getVbStat(uint16(vb), "last_processed_seq_no").(uint64)
 		if seqNo > prevSeqNo {
 			c.vbProcessingStats.updateVbStat(uint16(vb), "last_processed_seq_no", seqNo)
-			logging.Tracef("%s [%s:%s:%d] vb: %d Updating last_processed_seq_no to seqNo: %d",
+			logging.AppTracef(c.app.AppName, "%s [%s:%s:%d] vb: %d Updating last_processed_seq_no to seqNo: %d",
 				logPrefix, c.workerName, c.tcpPort, c.Pid(), vb, seqNo)
 		}
+	case docTimerResponse:
+		if opcode == timerAckOpcode {
+			c.handleTimerAck(msg)
+		}
 	case bucketOpsFilterAck:
 		var ack vbSeqNo
 		err := json.Unmarshal([]byte(msg), &ack)
@@ -545,8 +699,15 @@ func (c *Consumer) routeResponse(msgType, opcode int8, msg string) {
 			return
 		}
 
-		logging.Infof("%s [%s:%s:%d] vb: %d seqNo: %d skip_ack: %d received filter ack from C++",
-			logPrefix, c.workerName, c.tcpPort, c.Pid(), ack.Vbucket, ack.SeqNo, ack.SkipAck)
+		logging.Infof("%s [%s:%s:%d] vb: %d seqNo: %d acked seqNo: %d skip_ack: %d received filter ack from C++",
+			logPrefix, c.workerName, c.tcpPort, c.Pid(), ack.Vbucket, ack.SeqNo, ack.AckedSeqNo, ack.SkipAck)
+
+		// With at least once delivery, mutations handler didn't ack are replayed by
+		// whoever streams the vb next
+		if c.atLeastOnce {
+			ack.SeqNo = ack.AckedSeqNo
+		}
+		ack.SeqNo = c.deadLetterHolds.limit(ack.Vbucket, ack.SeqNo)
 
 		if ack.SkipAck == 0 {
 			c.filterDataCh <- &ack
@@ -561,8 +722,17 @@ func (c *Consumer) routeResponse(msgType, opcode int8, msg string) {
 		}
 
 		for _, ack := range acks {
+			ack := ack
+			if c.atLeastOnce {
+				ack.SeqNo = ack.AckedSeqNo
+			}
+			ack.SeqNo = c.deadLetterHolds.limit(ack.Vbucket, ack.SeqNo)
 			c.filterDataCh <- &ack
 		}
+	case deadLetterResponse:
+		c.enqueueDeadLetter(msg)
+	case busEventResponse:
+		c.publishBusEvent(msg)
 	default:
 		logging.Infof("%s [%s:%s:%d] Unknown message %s",
 			logPrefix, c.workerName, c.tcpPort, c.Pid(), msg)
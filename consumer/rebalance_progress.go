@@ -0,0 +1,81 @@
+package consumer
+
+import (
+	"sync"
+	"time"
+
+	"github.com/couchbase/eventing/common"
+)
+
+// vbsStateUpdateTracker records progress made by vbsStateUpdate routine, so that a
+// stuck rebalance can be pinned down to the worker and vbs it's blocked on
+type vbsStateUpdateTracker struct {
+	sync.RWMutex
+	running          bool
+	startTime        time.Time
+	lastProgressTime time.Time
+	attempts         int
+	vbsToOwn         int
+	vbsToGiveUp      int
+}
+
+func (t *vbsStateUpdateTracker) start(vbsToOwn, vbsToGiveUp int) {
+	t.Lock()
+	defer t.Unlock()
+
+	t.running = true
+	t.startTime = time.Now()
+	t.lastProgressTime = t.startTime
+	t.attempts = 0
+	t.vbsToOwn = vbsToOwn
+	t.vbsToGiveUp = vbsToGiveUp
+}
+
+func (t *vbsStateUpdateTracker) attempt() {
+	t.Lock()
+	defer t.Unlock()
+
+	t.attempts++
+}
+
+func (t *vbsStateUpdateTracker) progress() {
+	t.Lock()
+	defer t.Unlock()
+
+	t.lastProgressTime = time.Now()
+}
+
+func (t *vbsStateUpdateTracker) stop() {
+	t.Lock()
+	defer t.Unlock()
+
+	t.running = false
+}
+
+// GetRebalanceProgress reports vbs the worker is yet to own or give up, along with
+// when its last vbsStateUpdate run started and last took over a vb
+func (c *Consumer) GetRebalanceProgress() *common.WorkerRebalanceProgress {
+	t := c.vbsStateUpdateTracker
+	t.RLock()
+	progress := &common.WorkerRebalanceProgress{
+		Running:     t.running,
+		Attempts:    t.attempts,
+		VbsToOwn:    t.vbsToOwn,
+		VbsToGiveUp: t.vbsToGiveUp,
+	}
+	if !t.startTime.IsZero() {
+		progress.StartTime = t.startTime.Format(time.RFC3339)
+		progress.LastProgressTime = t.lastProgressTime.Format(time.RFC3339)
+	}
+	t.RUnlock()
+
+	progress.VbsRemainingToOwn = c.getVbRemainingToOwn()
+	progress.VbsRemainingToGiveUp = c.getVbRemainingToGiveUp()
+	if progress.VbsRemainingToOwn == nil {
+		progress.VbsRemainingToOwn = make([]uint16, 0)
+	}
+	if progress.VbsRemainingToGiveUp == nil {
+		progress.VbsRemainingToGiveUp = make([]uint16, 0)
+	}
+	return progress
+}
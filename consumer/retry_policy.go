@@ -0,0 +1,52 @@
+package consumer
+
+import (
+	"fmt"
+
+	"github.com/couchbase/eventing/common"
+	"github.com/couchbase/eventing/logging"
+)
+
+// Bits of retry_on mask understood by worker, one per kind of handler failure
+var retryOnBits = map[string]int{
+	common.RetryOnTimeout:     1 << 0,
+	common.RetryOnLcbError:    1 << 1,
+	common.RetryOnJsException: 1 << 2,
+}
+
+func retryOnMask(kinds []string) int {
+	mask := 0
+	for _, kind := range kinds {
+		mask |= retryOnBits[kind]
+	}
+	return mask
+}
+
+// sendRetryPolicy configures how many times and after how long worker re-runs the
+// handler for a mutation it failed for, and the kinds of failures retried
+func (c *Consumer) sendRetryPolicy() {
+	logPrefix := "Consumer::sendRetryPolicy"
+
+	mask := retryOnMask(c.handlerRetryOn)
+	header, hBuilder := c.makeRetryPolicyHeader(fmt.Sprintf("%d:%d:%d", c.handlerRetryCount, c.handlerRetryBackoff, mask))
+
+	c.msgProcessedRWMutex.Lock()
+	if _, ok := c.v8WorkerMessagesProcessed["retry_policy"]; !ok {
+		c.v8WorkerMessagesProcessed["retry_policy"] = 0
+	}
+	c.v8WorkerMessagesProcessed["retry_policy"]++
+	c.msgProcessedRWMutex.Unlock()
+
+	m := &msgToTransmit{
+		msg: &message{
+			Header: header,
+		},
+		prioritize:    true,
+		headerBuilder: hBuilder,
+	}
+
+	logging.Infof("%s [%s:%s:%d] Sending retry count: %d backoff: %dms retry on: %v",
+		logPrefix, c.workerName, c.tcpPort, c.Pid(), c.handlerRetryCount, c.handlerRetryBackoff, c.handlerRetryOn)
+
+	c.sendMessage(m)
+}
@@ -0,0 +1,30 @@
+package consumer
+
+import (
+	"testing"
+
+	"github.com/couchbase/eventing/common"
+)
+
+func TestRetryOnMask(t *testing.T) {
+	tests := []struct {
+		name     string
+		kinds    []string
+		expected int
+	}{
+		{"none", nil, 0},
+		{"timeout", []string{common.RetryOnTimeout}, 1},
+		{"lcb error", []string{common.RetryOnLcbError}, 2},
+		{"all", []string{common.RetryOnTimeout, common.RetryOnLcbError, common.RetryOnJsException}, 7},
+		{"duplicates", []string{common.RetryOnJsException, common.RetryOnJsException}, 4},
+		{"unknown kind", []string{"unknown", common.RetryOnTimeout}, 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := retryOnMask(test.kinds); got != test.expected {
+				t.Errorf("got: %d expected: %d", got, test.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package consumer
+
+import (
+	"sync"
+	"time"
+
+	"github.com/couchbase/eventing/logging"
+)
+
+const (
+	// Weight given to latest vb takeover duration while updating moving average
+	vbTakeoverTimeAvgWeight = 0.2
+
+	// Expected time for a single takeover routine to finish its share of vbs,
+	// used to derive routine count from measured per vb takeover time
+	vbTakeoverTargetDuration = 30 * time.Second
+
+	// Per vb takeover time assumed before any takeover has been measured
+	defaultVbTakeoverTime = time.Second
+)
+
+// vbTakeoverTimer tracks moving average of time taken to take over a vbucket
+type vbTakeoverTimer struct {
+	sync.RWMutex
+	avg     time.Duration
+	samples uint64
+}
+
+func (t *vbTakeoverTimer) record(d time.Duration) {
+	t.Lock()
+	defer t.Unlock()
+
+	if t.samples == 0 {
+		t.avg = d
+	} else {
+		t.avg = time.Duration((1-vbTakeoverTimeAvgWeight)*float64(t.avg) + vbTakeoverTimeAvgWeight*float64(d))
+	}
+	t.samples++
+}
+
+func (t *vbTakeoverTimer) average() time.Duration {
+	t.RLock()
+	defer t.RUnlock()
+
+	if t.samples == 0 {
+		return defaultVbTakeoverTime
+	}
+	return t.avg
+}
+
+// getTakeoverRoutineCount returns number of routines to use for taking over
+// vbsToOwn vbuckets. When auto tuning is enabled count is derived from measured
+// per vb takeover time, so that each routine roughly finishes within
+// vbTakeoverTargetDuration. Upper bound is shared across all workers on the node
+func (c *Consumer) getTakeoverRoutineCount(vbsToOwn int) int {
+	logPrefix := "Consumer::getTakeoverRoutineCount"
+
+	if !c.autoTuneVbTakeoverRoutines || vbsToOwn == 0 {
+		return c.vbOwnershipTakeoverRoutineCount
+	}
+
+	avgTakeoverTime := c.vbTakeoverTimer.average()
+
+	vbsPerRoutine := int(vbTakeoverTargetDuration / avgTakeoverTime)
+	if vbsPerRoutine < 1 {
+		vbsPerRoutine = 1
+	}
+
+	count := (vbsToOwn + vbsPerRoutine - 1) / vbsPerRoutine
+
+	maxCount := c.vbTakeoverRoutineMaxCount
+	if c.workerCount > 1 {
+		maxCount = maxCount / c.workerCount
+	}
+	if maxCount < c.vbTakeoverRoutineMinCount {
+		maxCount = c.vbTakeoverRoutineMinCount
+	}
+
+	if count < c.vbTakeoverRoutineMinCount {
+		count = c.vbTakeoverRoutineMinCount
+	}
+	if count > maxCount {
+		count = maxCount
+	}
+
+	logging.Infof("%s [%s:%s:%d] vbs to own: %d avg takeover time: %v routine count: %d bounds: [%d, %d]",
+		logPrefix, c.workerName, c.tcpPort, c.Pid(), vbsToOwn, avgTakeoverTime, count,
+		c.vbTakeoverRoutineMinCount, maxCount)
+
+	return count
+}
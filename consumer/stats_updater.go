@@ -1,6 +1,7 @@
 package consumer
 
 import (
+	"fmt"
 	"time"
 
 	"github.com/couchbase/eventing/logging"
@@ -123,11 +124,11 @@ func (c *Consumer) loadStatsFromConsumer() {
 					logging.Infof("%s [%s:%s:%d] stoppingConsumer: %t re-spawning eventing, %s at %s",
 						logPrefix, c.workerName, c.tcpPort, c.Pid(), c.stoppingConsumer, stopReason, lastTs.String())
 					c.stoppingConsumer = true
-					c.producer.KillAndRespawnEventingConsumer(c)
+					c.respawnWorker(fmt.Sprintf("worker unresponsive, %s at %s", stopReason, lastTs.String()))
 				}
 			}
 
-		case <-c.stopConsumerCh:
+		case <-c.ctx.Done():
 			logging.Infof("%s [%s:%s:%d] Exiting cpp worker stats loader routine",
 				logPrefix, c.workerName, c.tcpPort, c.Pid())
 			return
@@ -142,7 +143,7 @@ func (c *Consumer) updateWorkerStats() {
 		select {
 		case <-c.updateStatsTicker.C:
 			if c.workerExited {
-				logging.Debugf("%s [%s:%s:%d] Skipping sending worker stat opcode as worker exited",
+				logging.AppDebugf(c.app.AppName, "%s [%s:%s:%d] Skipping sending worker stat opcode as worker exited",
 					logPrefix, c.workerName, c.tcpPort, c.Pid())
 				continue
 			}
@@ -153,8 +154,9 @@ func (c *Consumer) updateWorkerStats() {
 			c.sendGetLatencyStats()
 			c.sendGetLcbExceptionStats(false)
 			c.refreshCurlLatencyStats()
+			c.refreshN1qlLatencyStats()
 
-		case <-c.stopConsumerCh:
+		case <-c.ctx.Done():
 			logging.Infof("%s [%s:%s:%d] Exiting cpp worker stats updater routine",
 				logPrefix, c.workerName, c.tcpPort, c.Pid())
 			return
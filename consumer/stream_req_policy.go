@@ -0,0 +1,205 @@
+package consumer
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	mcd "github.com/couchbase/eventing/dcp/transport"
+)
+
+// Classes of STREAMREQ failures, each retried as per its own policy
+const (
+	streamReqErrRollback     = "rollback"
+	streamReqErrNotMyVbucket = "not_my_vbucket"
+	streamReqErrTempFail     = "temp_fail"
+	streamReqErrAccess       = "eaccess"
+	streamReqErrOther        = "other"
+)
+
+const (
+	// Consecutive failures of a vbucket after which its stream requests are
+	// held off for streamReqCircuitCooldown
+	streamReqCircuitThreshold = 10
+	streamReqCircuitCooldown  = 2 * time.Minute
+)
+
+var errStreamReqDeferred = errors.New("stream request deferred as per retry policy")
+
+type streamReqRetryPolicy struct {
+	InitialInterval time.Duration
+	MaxInterval     time.Duration
+	Multiplier      float64
+	// Fraction of interval randomised on either side, to avoid retries from
+	// all vbuckets hitting KV at once
+	Jitter float64
+	// Rollback is part of regular stream negotiation, so doesn't count towards
+	// tripping the circuit
+	CountsTowardsCircuit bool
+}
+
+var streamReqRetryPolicies = map[string]*streamReqRetryPolicy{
+	streamReqErrRollback: {
+		CountsTowardsCircuit: false,
+	},
+	streamReqErrNotMyVbucket: {
+		InitialInterval:      time.Second,
+		MaxInterval:          10 * time.Second,
+		Multiplier:           2,
+		Jitter:               0.2,
+		CountsTowardsCircuit: true,
+	},
+	streamReqErrTempFail: {
+		InitialInterval:      500 * time.Millisecond,
+		MaxInterval:          30 * time.Second,
+		Multiplier:           2,
+		Jitter:               0.5,
+		CountsTowardsCircuit: true,
+	},
+	streamReqErrAccess: {
+		InitialInterval:      5 * time.Second,
+		MaxInterval:          time.Minute,
+		Multiplier:           2,
+		Jitter:               0.2,
+		CountsTowardsCircuit: true,
+	},
+	streamReqErrOther: {
+		InitialInterval:      time.Second,
+		MaxInterval:          10 * time.Second,
+		Multiplier:           1.5,
+		Jitter:               0.5,
+		CountsTowardsCircuit: true,
+	},
+}
+
+func classifyStreamReqStatus(status mcd.Status) string {
+	switch status {
+	case mcd.ROLLBACK:
+		return streamReqErrRollback
+	case mcd.NOT_MY_VBUCKET:
+		return streamReqErrNotMyVbucket
+	case mcd.TMPFAIL, mcd.ENOMEM:
+		return streamReqErrTempFail
+	case mcd.EACCESS:
+		return streamReqErrAccess
+	default:
+		return streamReqErrOther
+	}
+}
+
+func classifyStreamReqErr(err error) string {
+	if res, ok := err.(*mcd.MCResponse); ok {
+		return classifyStreamReqStatus(res.Status)
+	}
+	return streamReqErrOther
+}
+
+func (p *streamReqRetryPolicy) backoff(attempt int) time.Duration {
+	if p.InitialInterval <= 0 || attempt <= 0 {
+		return 0
+	}
+
+	interval := float64(p.InitialInterval) * math.Pow(p.Multiplier, float64(attempt-1))
+	if interval > float64(p.MaxInterval) {
+		interval = float64(p.MaxInterval)
+	}
+
+	delta := p.Jitter * interval
+	return time.Duration(interval - delta + rand.Float64()*2*delta)
+}
+
+type vbStreamReqState struct {
+	consecutiveFailures int
+	nextAttempt         time.Time
+}
+
+// streamReqTracker holds per vbucket retry state of stream requests
+type streamReqTracker struct {
+	sync.Mutex
+	vbs                map[uint16]*vbStreamReqState
+	errCounters        map[string]uint64
+	circuitOpenCounter uint64
+}
+
+func newStreamReqTracker() *streamReqTracker {
+	return &streamReqTracker{
+		vbs:         make(map[uint16]*vbStreamReqState),
+		errCounters: make(map[string]uint64),
+	}
+}
+
+// recordFailure returns time after which stream request for the vbucket could be retried
+func (t *streamReqTracker) recordFailure(vb uint16, errClass string) time.Duration {
+	t.Lock()
+	defer t.Unlock()
+
+	t.errCounters[errClass]++
+
+	policy, ok := streamReqRetryPolicies[errClass]
+	if !ok {
+		policy = streamReqRetryPolicies[streamReqErrOther]
+	}
+
+	state, ok := t.vbs[vb]
+	if !ok {
+		state = &vbStreamReqState{}
+		t.vbs[vb] = state
+	}
+
+	if !policy.CountsTowardsCircuit {
+		state.nextAttempt = time.Now()
+		return 0
+	}
+
+	state.consecutiveFailures++
+	delay := policy.backoff(state.consecutiveFailures)
+	if state.consecutiveFailures >= streamReqCircuitThreshold {
+		// Circuit stays open till a stream request succeeds, allowing one
+		// attempt per cooldown
+		t.circuitOpenCounter++
+		delay = streamReqCircuitCooldown
+	}
+
+	state.nextAttempt = time.Now().Add(delay)
+	return delay
+}
+
+func (t *streamReqTracker) recordSuccess(vb uint16) {
+	t.Lock()
+	defer t.Unlock()
+
+	delete(t.vbs, vb)
+}
+
+func (t *streamReqTracker) allow(vb uint16) bool {
+	t.Lock()
+	defer t.Unlock()
+
+	state, ok := t.vbs[vb]
+	return !ok || !time.Now().Before(state.nextAttempt)
+}
+
+func (t *streamReqTracker) stats() map[string]uint64 {
+	t.Lock()
+	defer t.Unlock()
+
+	stats := make(map[string]uint64)
+	for errClass, count := range t.errCounters {
+		stats["dcp_stream_req_err_"+errClass] = count
+	}
+
+	var circuitOpen uint64
+	for _, state := range t.vbs {
+		if state.consecutiveFailures >= streamReqCircuitThreshold {
+			circuitOpen++
+		}
+	}
+
+	if t.circuitOpenCounter > 0 {
+		stats["dcp_stream_req_circuit_open_counter"] = t.circuitOpenCounter
+		stats["dcp_stream_req_circuit_open_vbs"] = circuitOpen
+	}
+	return stats
+}
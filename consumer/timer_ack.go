@@ -0,0 +1,58 @@
+package consumer
+
+import (
+	"encoding/json"
+
+	"github.com/couchbase/eventing/logging"
+)
+
+// timerAck is sent by worker over feedback channel for every vb it fired timers of
+// since its last ack. SeqNo is that of the latest mutation whose timer fired
+type timerAck struct {
+	Vbucket     uint16 `json:"vb"`
+	SeqNo       uint64 `json:"seq"`
+	TimersFired uint64 `json:"timers_fired"`
+}
+
+// handleTimerAck advances timer progress of vb, which gets checkpointed as
+// last_doc_timer_feedback_seqno
+func (c *Consumer) handleTimerAck(msg string) {
+	logPrefix := "Consumer::handleTimerAck"
+
+	var ack timerAck
+	if err := json.Unmarshal([]byte(msg), &ack); err != nil {
+		logging.Errorf("%s [%s:%s:%d] Failed to unmarshal timer ack, msg: %v err: %v",
+			logPrefix, c.workerName, c.tcpPort, c.Pid(), msg, err)
+		return
+	}
+
+	if int(ack.Vbucket) >= c.numVbuckets {
+		logging.Errorf("%s [%s:%s:%d] Invalid vb in timer ack, msg: %v",
+			logPrefix, c.workerName, c.tcpPort, c.Pid(), msg)
+		return
+	}
+
+	prevSeqNo := c.vbProcessingStats.getVbStat(ack.Vbucket, "last_doc_timer_feedback_seqno").(uint64)
+	if ack.SeqNo > prevSeqNo {
+		c.vbProcessingStats.updateVbStat(ack.Vbucket, "last_doc_timer_feedback_seqno", ack.SeqNo)
+	}
+
+	// Doc timers fired by worker are counted in sent_to_worker_counter, which also
+	// keeps checkpoints of vbs with timer progress from being skipped as idle
+	fired := c.vbProcessingStats.getVbStat(ack.Vbucket, "sent_to_worker_counter").(uint64)
+	c.vbProcessingStats.updateVbStat(ack.Vbucket, "sent_to_worker_counter", fired+ack.TimersFired)
+
+	logging.AppTracef(c.app.AppName, "%s [%s:%s:%d] vb: %d timer ack seqNo: %d timers fired: %d",
+		logPrefix, c.workerName, c.tcpPort, c.Pid(), ack.Vbucket, ack.SeqNo, ack.TimersFired)
+}
+
+// timerFeedbackLag is the count of seqnos of vb processed past the latest mutation
+// whose timer fired
+func (c *Consumer) timerFeedbackLag(vb uint16) uint64 {
+	processed := c.vbProcessingStats.getVbStat(vb, "last_processed_seq_no").(uint64)
+	fired := c.vbProcessingStats.getVbStat(vb, "last_doc_timer_feedback_seqno").(uint64)
+	if fired == 0 || processed <= fired {
+		return 0
+	}
+	return processed - fired
+}
@@ -0,0 +1,349 @@
+package consumer
+
+import (
+	"errors"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/couchbase/eventing/common"
+	"github.com/couchbase/eventing/logging"
+	"github.com/couchbase/eventing/timers"
+	"github.com/couchbase/gocb/v2"
+)
+
+const (
+	// Rows preceding span start probed for alarms which span no longer covers
+	timerScanLookbackRows = int64(64)
+
+	// Bound on rows scanned per vb, so that stores with timers far out in the
+	// future don't hold up the scan
+	timerScanMaxRows = int64(1024)
+)
+
+var errTimerRecordCorrupt = errors.New("timer record corrupt")
+
+// timerRecordStore reads and repairs records of timer stores
+type timerRecordStore interface {
+	// get returns errTimerRecordCorrupt along with cas if record couldn't be decoded
+	get(key string, value interface{}) (cas gocb.Cas, absent bool, err error)
+	remove(key string, cas gocb.Cas) error
+	replace(key string, value interface{}, cas gocb.Cas) error
+	upsert(key string, value interface{}) error
+}
+
+// timerStoreScanner verifies timer store of a partition, as laid out by timers package
+type timerStoreScanner struct {
+	records timerRecordStore
+	store   string // Key prefix of the timer store
+	repair  bool
+	report  *common.TimerIntegrityReport
+	stopped func() bool
+}
+
+// metaTimerRecords accesses timer store records in metadata keyspace of the consumer
+type metaTimerRecords struct {
+	c *Consumer
+}
+
+// VerifyTimerStore verifies timer store of vbs owned by the consumer, all of them if
+// none are specified. Corrupt records and dangling alarms are removed if policy is repair
+func (c *Consumer) VerifyTimerStore(vbs []uint16, policy string) []*common.TimerIntegrityReport {
+	if len(vbs) == 0 {
+		vbs = c.getCurrentlyOwnedVbs()
+	}
+
+	reports := make([]*common.TimerIntegrityReport, 0)
+	for _, vb := range vbs {
+		if !c.isTimerPartition(vb) || !c.checkIfVbAlreadyOwnedByCurrConsumer(vb) {
+			continue
+		}
+		reports = append(reports, c.verifyTimerStore(vb, policy))
+	}
+	return reports
+}
+
+// verifyTakenOverTimerStores verifies timer store of vbs as consumer takes them over,
+// as per timer_integrity_check
+func (c *Consumer) verifyTakenOverTimerStores() {
+	if !c.producer.UsingTimer() {
+		return
+	}
+
+	for {
+		select {
+		case vb := <-c.timerScanCh:
+			policy := c.timerIntegrityCheck
+			if policy == common.TimerIntegrityOff || !c.isTimerPartition(vb) {
+				continue
+			}
+			c.verifyTimerStore(vb, policy)
+
+		case <-c.ctx.Done():
+			return
+		}
+	}
+}
+
+// scheduleTimerStoreVerification queues up vb for verification without blocking the
+// caller. Vbs are dropped if the queue is full, those get verified on their next takeover
+func (c *Consumer) scheduleTimerStoreVerification(vb uint16) {
+	if c.timerIntegrityCheck == common.TimerIntegrityOff {
+		return
+	}
+
+	select {
+	case c.timerScanCh <- vb:
+	default:
+	}
+}
+
+// isTimerPartition tells if timers are stored against the vb. cpp worker folds timers
+// into every numVbuckets/numTimerPartitions'th vb
+func (c *Consumer) isTimerPartition(vb uint16) bool {
+	if c.numTimerPartitions <= 0 || c.numTimerPartitions >= c.numVbuckets {
+		return true
+	}
+	return int(vb)%(c.numVbuckets/c.numTimerPartitions) == 0
+}
+
+func (c *Consumer) verifyTimerStore(vb uint16, policy string) *common.TimerIntegrityReport {
+	logPrefix := "Consumer::verifyTimerStore"
+
+	report := &common.TimerIntegrityReport{Vb: vb, Worker: c.workerName, Policy: policy}
+	scanner := &timerStoreScanner{
+		records: &metaTimerRecords{c: c},
+		store:   timers.StoreKey(c.producer.GetMetadataPrefix(), int(vb)),
+		repair:  policy == common.TimerIntegrityRepair,
+		report:  report,
+		stopped: func() bool { return atomic.LoadUint32(&c.isTerminateRunning) == 1 },
+	}
+
+	err := scanner.scan()
+	if err != nil {
+		report.Error = err.Error()
+		logging.Errorf("%s [%s:%s:%d] vb: %d timer store verification failed, err: %v",
+			logPrefix, c.workerName, c.tcpPort, c.Pid(), vb, err)
+	}
+
+	corruptions := report.Corruptions()
+	atomic.AddUint64(&c.timerStoreCorruptions, uint64(corruptions))
+	atomic.AddUint64(&c.timerStoreRepairs, uint64(report.Repaired))
+
+	if corruptions > 0 || report.DanglingAlarms > 0 {
+		logging.Warnf("%s [%s:%s:%d] vb: %d timer store verified, report: %+v",
+			logPrefix, c.workerName, c.tcpPort, c.Pid(), vb, *report)
+	} else {
+		logging.Debugf("%s [%s:%s:%d] vb: %d timer store verified, report: %+v",
+			logPrefix, c.workerName, c.tcpPort, c.Pid(), vb, *report)
+	}
+	return report
+}
+
+func (s *timerStoreScanner) scan() error {
+	report := s.report
+	span := timers.Span{}
+	spanKey := timers.SpanKey(s.store)
+	spanCas, absent, err := s.records.get(spanKey, &span)
+	if err == errTimerRecordCorrupt {
+		// Span is rebuilt from rows found, scanning as far back as allowed
+		report.SpanCorrupt = true
+		span.Stop = roundDownToTimerRow(time.Now().Unix())
+		span.Start = span.Stop - (timerScanMaxRows-timerScanLookbackRows)*timers.Resolution
+	} else if err != nil {
+		return err
+	} else if absent {
+		return nil
+	}
+
+	if span.Start > span.Stop || span.Start%timers.Resolution != 0 || span.Stop%timers.Resolution != 0 {
+		report.SpanCorrupt = true
+		if span.Start > span.Stop {
+			span.Start, span.Stop = span.Stop, span.Start
+		}
+		span.Start = roundDownToTimerRow(span.Start)
+		span.Stop = roundDownToTimerRow(span.Stop + timers.Resolution - 1)
+	}
+	report.SpanStart, report.SpanStop = span.Start, span.Stop
+
+	scanStop := span.Stop
+	scanStart := span.Start - timerScanLookbackRows*timers.Resolution
+	if maxStop := scanStart + timerScanMaxRows*timers.Resolution; scanStop > maxStop {
+		scanStop = maxStop
+		report.Truncated = true
+	}
+
+	earliest := span.Start
+	for due := scanStart; due <= scanStop; due += timers.Resolution {
+		if s.stopped() {
+			return nil
+		}
+
+		report.RowsScanned++
+		alarms, err := s.scanRow(due)
+		if err != nil {
+			return err
+		}
+
+		if alarms > 0 && due < span.Start {
+			report.RowsBeforeSpan++
+			if due < earliest {
+				earliest = due
+			}
+		}
+	}
+
+	if !s.repair || (!report.SpanCorrupt && report.RowsBeforeSpan == 0) {
+		return nil
+	}
+
+	// Moving span back has cpp worker pick up alarms it would otherwise have skipped
+	span.Start = earliest
+	if spanCas == 0 {
+		err = s.records.upsert(spanKey, span)
+	} else {
+		err = s.records.replace(spanKey, span, spanCas)
+	}
+	if err != nil {
+		return err
+	}
+	report.Repaired++
+	return nil
+}
+
+// scanRow verifies alarms chained in the row due at given time along with their
+// contexts, returns count of alarms which would fire
+func (s *timerStoreScanner) scanRow(due int64) (int, error) {
+	report, repair := s.report, s.repair
+
+	var counter int64
+	_, absent, err := s.records.get(timers.RootKey(s.store, due), &counter)
+	if err == errTimerRecordCorrupt {
+		// Alarms of the row can't be located without its counter
+		report.CorruptAlarms++
+		return 0, nil
+	}
+	if err != nil || absent {
+		return 0, err
+	}
+
+	alarms := 0
+	for seq := timers.InitSeq; seq <= counter; seq++ {
+		alarm := timers.AlarmRecord{}
+		alarmKey := timers.AlarmKey(s.store, due, seq)
+		alarmCas, absent, err := s.records.get(alarmKey, &alarm)
+		if err != nil && err != errTimerRecordCorrupt {
+			return alarms, err
+		}
+		if absent {
+			continue
+		}
+
+		if err == errTimerRecordCorrupt || alarm.AlarmDue != due || !strings.HasPrefix(alarm.ContextRef, timers.ContextKeyPrefix(s.store)) {
+			report.CorruptAlarms++
+			if repair && s.records.remove(alarmKey, alarmCas) == nil {
+				report.Repaired++
+			}
+			continue
+		}
+
+		ctxRecord := timers.ContextRecord{}
+		contextCas, absent, err := s.records.get(alarm.ContextRef, &ctxRecord)
+		if err != nil && err != errTimerRecordCorrupt {
+			return alarms, err
+		}
+
+		switch {
+		case err == errTimerRecordCorrupt:
+			// Timer can't be fired without its context, so the alarm goes along
+			report.CorruptContexts++
+			if repair && s.records.remove(alarm.ContextRef, contextCas) == nil &&
+				s.records.remove(alarmKey, alarmCas) == nil {
+				report.Repaired++
+			}
+
+		case absent || ctxRecord.AlarmRef != alarmKey:
+			report.DanglingAlarms++
+			if repair && s.records.remove(alarmKey, alarmCas) == nil {
+				report.Repaired++
+			}
+
+		default:
+			report.Alarms++
+			alarms++
+		}
+	}
+	return alarms, nil
+}
+
+func (m *metaTimerRecords) get(key string, value interface{}) (gocb.Cas, bool, error) {
+	c := m.c
+	c.gocbMetaHandleMutex.RLock()
+	defer c.gocbMetaHandleMutex.RUnlock()
+	if c.gocbMetaHandle == nil {
+		return 0, false, errDcpFeedsClosed
+	}
+
+	c.producer.InjectMetadataLatency()
+	result, err := c.gocbMetaHandle.Get(key, &gocb.GetOptions{Transcoder: c.metaTranscoder})
+	if errors.Is(err, gocb.ErrDocumentNotFound) {
+		return 0, true, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+
+	if err = result.Content(value); err != nil {
+		return result.Cas(), false, errTimerRecordCorrupt
+	}
+	return result.Cas(), false, nil
+}
+
+func (m *metaTimerRecords) remove(key string, cas gocb.Cas) error {
+	logPrefix := "Consumer::removeTimerRecord"
+	c := m.c
+
+	c.gocbMetaHandleMutex.RLock()
+	defer c.gocbMetaHandleMutex.RUnlock()
+	if c.gocbMetaHandle == nil {
+		return errDcpFeedsClosed
+	}
+
+	c.producer.InjectMetadataLatency()
+	_, err := c.gocbMetaHandle.Remove(key, &gocb.RemoveOptions{Cas: cas})
+	if err != nil {
+		logging.Errorf("%s [%s:%s:%d] Failed to remove timer record: %ru, err: %v",
+			logPrefix, c.workerName, c.tcpPort, c.Pid(), key, err)
+	}
+	return err
+}
+
+func (m *metaTimerRecords) replace(key string, value interface{}, cas gocb.Cas) error {
+	c := m.c
+	c.gocbMetaHandleMutex.RLock()
+	defer c.gocbMetaHandleMutex.RUnlock()
+	if c.gocbMetaHandle == nil {
+		return errDcpFeedsClosed
+	}
+
+	c.producer.InjectMetadataLatency()
+	_, err := c.gocbMetaHandle.Replace(key, value, &gocb.ReplaceOptions{Cas: cas, Transcoder: c.metaTranscoder})
+	return err
+}
+
+func (m *metaTimerRecords) upsert(key string, value interface{}) error {
+	c := m.c
+	c.gocbMetaHandleMutex.RLock()
+	defer c.gocbMetaHandleMutex.RUnlock()
+	if c.gocbMetaHandle == nil {
+		return errDcpFeedsClosed
+	}
+
+	c.producer.InjectMetadataLatency()
+	_, err := c.gocbMetaHandle.Upsert(key, value, &gocb.UpsertOptions{Transcoder: c.metaTranscoder})
+	return err
+}
+
+func roundDownToTimerRow(ts int64) int64 {
+	return ts / timers.Resolution * timers.Resolution
+}
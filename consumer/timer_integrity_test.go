@@ -0,0 +1,189 @@
+package consumer
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/couchbase/eventing/common"
+	"github.com/couchbase/eventing/timers"
+	"github.com/couchbase/gocb/v2"
+)
+
+// memTimerRecords keeps timer store records in memory, encoded the way they're in KV
+type memTimerRecords struct {
+	docs map[string][]byte
+	cas  map[string]gocb.Cas
+	next gocb.Cas
+}
+
+func newMemTimerRecords() *memTimerRecords {
+	return &memTimerRecords{docs: make(map[string][]byte), cas: make(map[string]gocb.Cas)}
+}
+
+func (m *memTimerRecords) set(key string, value interface{}) {
+	var doc []byte
+	if raw, ok := value.(string); ok {
+		doc = []byte(raw)
+	} else {
+		doc, _ = json.Marshal(value)
+	}
+	m.next++
+	m.docs[key], m.cas[key] = doc, m.next
+}
+
+func (m *memTimerRecords) get(key string, value interface{}) (gocb.Cas, bool, error) {
+	doc, ok := m.docs[key]
+	if !ok {
+		return 0, true, nil
+	}
+	if err := json.Unmarshal(doc, value); err != nil {
+		return m.cas[key], false, errTimerRecordCorrupt
+	}
+	return m.cas[key], false, nil
+}
+
+func (m *memTimerRecords) remove(key string, cas gocb.Cas) error {
+	if m.cas[key] != cas {
+		return gocb.ErrCasMismatch
+	}
+	delete(m.docs, key)
+	delete(m.cas, key)
+	return nil
+}
+
+func (m *memTimerRecords) replace(key string, value interface{}, cas gocb.Cas) error {
+	if m.cas[key] != cas {
+		return gocb.ErrCasMismatch
+	}
+	m.set(key, value)
+	return nil
+}
+
+func (m *memTimerRecords) upsert(key string, value interface{}) error {
+	m.set(key, value)
+	return nil
+}
+
+// writeTimer lays out a timer the way timer store of the worker does
+func writeTimer(records *memTimerRecords, store string, due int64, ref string) (string, string) {
+	rootKey := timers.RootKey(store, due)
+	seq := timers.InitSeq
+	var counter int64
+	if _, absent, _ := records.get(rootKey, &counter); !absent {
+		seq = counter + 1
+	}
+	records.set(rootKey, seq)
+
+	alarmKey := timers.AlarmKey(store, due, seq)
+	contextKey := timers.ContextKeyPrefix(store) + ref
+	records.set(alarmKey, timers.AlarmRecord{AlarmDue: due, ContextRef: contextKey})
+	records.set(contextKey, timers.ContextRecord{Context: map[string]string{"ref": ref}, AlarmRef: alarmKey})
+	return alarmKey, contextKey
+}
+
+func TestTimerStoreScan(t *testing.T) {
+	store := timers.StoreKey(common.NewKey("eventing", "1234", "").GetPrefix(), 16)
+	start := time.Now().Unix() / timers.Resolution * timers.Resolution
+	stop := start + 10*timers.Resolution
+
+	tests := []struct {
+		name     string
+		repair   bool
+		setup    func(records *memTimerRecords)
+		expected common.TimerIntegrityReport
+		verify   func(t *testing.T, records *memTimerRecords)
+	}{
+		{
+			name:     "no store",
+			setup:    func(records *memTimerRecords) {},
+			expected: common.TimerIntegrityReport{},
+		},
+		{
+			name: "healthy store",
+			setup: func(records *memTimerRecords) {
+				records.set(timers.SpanKey(store), timers.Span{Start: start, Stop: stop})
+				writeTimer(records, store, start, "a")
+				writeTimer(records, store, start, "b")
+				writeTimer(records, store, stop, "c")
+			},
+			expected: common.TimerIntegrityReport{Alarms: 3},
+		},
+		{
+			name:   "dangling alarm",
+			repair: true,
+			setup: func(records *memTimerRecords) {
+				records.set(timers.SpanKey(store), timers.Span{Start: start, Stop: stop})
+				writeTimer(records, store, start, "a")
+				_, contextKey := writeTimer(records, store, start, "b")
+				records.remove(contextKey, records.cas[contextKey])
+			},
+			expected: common.TimerIntegrityReport{Alarms: 1, DanglingAlarms: 1, Repaired: 1},
+			verify: func(t *testing.T, records *memTimerRecords) {
+				if _, ok := records.docs[timers.AlarmKey(store, start, timers.InitSeq+1)]; ok {
+					t.Errorf("dangling alarm not removed")
+				}
+			},
+		},
+		{
+			name: "corrupt alarm and context",
+			setup: func(records *memTimerRecords) {
+				records.set(timers.SpanKey(store), timers.Span{Start: start, Stop: stop})
+				alarmKey, _ := writeTimer(records, store, start, "a")
+				records.set(alarmKey, "{")
+				_, contextKey := writeTimer(records, store, stop, "b")
+				records.set(contextKey, "{")
+			},
+			expected: common.TimerIntegrityReport{CorruptAlarms: 1, CorruptContexts: 1},
+		},
+		{
+			name:   "alarms before span",
+			repair: true,
+			setup: func(records *memTimerRecords) {
+				records.set(timers.SpanKey(store), timers.Span{Start: start, Stop: stop})
+				writeTimer(records, store, start-2*timers.Resolution, "a")
+				writeTimer(records, store, start, "b")
+			},
+			expected: common.TimerIntegrityReport{Alarms: 2, RowsBeforeSpan: 1, Repaired: 1},
+			verify: func(t *testing.T, records *memTimerRecords) {
+				span := timers.Span{}
+				records.get(timers.SpanKey(store), &span)
+				if span.Start != start-2*timers.Resolution {
+					t.Errorf("span start: %d expected: %d", span.Start, start-2*timers.Resolution)
+				}
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			records := newMemTimerRecords()
+			test.setup(records)
+
+			report := &common.TimerIntegrityReport{}
+			scanner := &timerStoreScanner{
+				records: records,
+				store:   store,
+				repair:  test.repair,
+				report:  report,
+				stopped: func() bool { return false },
+			}
+			if err := scanner.scan(); err != nil {
+				t.Fatalf("scan failed, err: %v", err)
+			}
+
+			if report.Alarms != test.expected.Alarms ||
+				report.DanglingAlarms != test.expected.DanglingAlarms ||
+				report.CorruptAlarms != test.expected.CorruptAlarms ||
+				report.CorruptContexts != test.expected.CorruptContexts ||
+				report.RowsBeforeSpan != test.expected.RowsBeforeSpan ||
+				report.Repaired != test.expected.Repaired {
+				t.Errorf("report: %+v expected: %+v", *report, test.expected)
+			}
+
+			if test.verify != nil {
+				test.verify(t, records)
+			}
+		})
+	}
+}
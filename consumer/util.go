@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"hash/crc32"
 	"strconv"
+	"strings"
 
 	"github.com/couchbase/eventing/common"
 	"github.com/couchbase/eventing/dcp/transport/client"
@@ -18,7 +19,7 @@ func (c *Consumer) checkIfAlreadyEnqueued(vb uint16) bool {
 	defer c.vbEnqueuedForStreamReqRWMutex.RUnlock()
 
 	if _, ok := c.vbEnqueuedForStreamReq[vb]; ok {
-		logging.Tracef("%s [%s:%s:%d] vb: %d already enqueued",
+		logging.AppTracef(c.app.AppName, "%s [%s:%s:%d] vb: %d already enqueued",
 			logPrefix, c.workerName, c.tcpPort, c.Pid(), vb)
 		return true
 	}
@@ -49,6 +50,36 @@ func (c *Consumer) deleteFromEnqueueMap(vb uint16) {
 	delete(c.vbEnqueuedForStreamReq, vb)
 }
 
+// functionInstanceID identifies the deployment of function, workers stamp it on docs
+// they write
+func (c *Consumer) functionInstanceID() string {
+	return strconv.Itoa(int(c.app.FunctionID)) + "-" + c.app.FunctionInstanceID
+}
+
+// userXattrs drops system xattrs, i.e. ones prefixed with underscore, which belong
+// to services like sync gateway, transactions and eventing itself
+func userXattrs(xattrs map[string]json.RawMessage) map[string]json.RawMessage {
+	for key := range xattrs {
+		if strings.HasPrefix(key, "_") {
+			delete(xattrs, key)
+		}
+	}
+	if len(xattrs) == 0 {
+		return nil
+	}
+	return xattrs
+}
+
+// hasOriginTag reports whether tag is among comma separated origin tags
+func hasOriginTag(origin, tag string) bool {
+	for _, t := range strings.Split(origin, ",") {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
 func (c *Consumer) isRecursiveDCPEvent(evt *memcached.DcpEvent, functionInstanceID string) (bool, error) {
 	logPrefix := "Consumer::isRecursiveDCPEvent"
 
@@ -77,6 +108,18 @@ func (c *Consumer) isRecursiveDCPEvent(evt *memcached.DcpEvent, functionInstance
 			return false, err
 		}
 
+		// Stamped seqno is that of the mutation carrying the stamp, so doc was written
+		// by a worker of some function rather than by anyone else since. Tag of this
+		// function among origin tags means write follows from its own handler, be it
+		// directly or through other functions
+		if c.originTagging && xMeta.Origin != "" && seqno == evt.Seqno {
+			if hasOriginTag(xMeta.Origin, functionInstanceID) {
+				c.originSuppressedCounter++
+				return true, nil
+			}
+			evt.Origin = xMeta.Origin
+		}
+
 		if xMeta.FunctionInstanceID == functionInstanceID && seqno == evt.Seqno {
 			checksum := crc32.Checksum(body, util.CrcTable)
 			xChecksum, err := strconv.ParseUint(xMeta.ValueCRC, 0, 32)
@@ -95,16 +138,19 @@ func (c *Consumer) isRecursiveDCPEvent(evt *memcached.DcpEvent, functionInstance
 }
 
 func (c *Consumer) purgeVbStreamRequested(logPrefix string, vb uint16) {
-	c.vbsStreamRRWMutex.Lock()
-	if _, ok := c.vbStreamRequested[vb]; ok {
-		delete(c.vbStreamRequested, vb)
-		logging.Infof("%s [%s:%s:%d] vb: %d purging entry from vbStreamRequested",
+	if c.vbStreamRequests.remove(vb) {
+		logging.Infof("%s [%s:%s:%d] vb: %d purging entry from vbStreamRequests",
 			logPrefix, c.workerName, c.tcpPort, c.Pid(), vb)
 	}
-	c.vbsStreamRRWMutex.Unlock()
 }
 
+// checkBinaryDocAllowed returns true if binary mutations are to be sent to worker, those
+// are dropped if skip_binary_docs is set or language compatibility predates 6.6.2
 func (c *Consumer) checkBinaryDocAllowed() bool {
+	if c.skipBinaryDocs {
+		return false
+	}
+
 	langCompatibility, _ := common.FrameCouchbaseVersionShort(c.languageCompatibility)
 	binDocSupportVersion := common.CouchbaseVerMap["6.6.2"]
 	return langCompatibility.Compare(binDocSupportVersion)
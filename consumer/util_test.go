@@ -0,0 +1,79 @@
+package consumer
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestHasOriginTag(t *testing.T) {
+	tests := []struct {
+		origin   string
+		tag      string
+		expected bool
+	}{
+		{"", "1-a", false},
+		{"1-a", "1-a", true},
+		{"2-b,1-a", "1-a", true},
+		{"1-a,2-b", "2-b", true},
+		{"11-a,2-b", "1-a", false},
+		{"2-b,3-c", "1-a", false},
+	}
+
+	for _, test := range tests {
+		if got := hasOriginTag(test.origin, test.tag); got != test.expected {
+			t.Errorf("origin: %q tag: %q got: %v expected: %v", test.origin, test.tag, got, test.expected)
+		}
+	}
+}
+
+func TestUserXattrs(t *testing.T) {
+	tests := []struct {
+		name     string
+		xattrs   map[string]json.RawMessage
+		expected map[string]json.RawMessage
+	}{
+		{"none", nil, nil},
+		{"system only", map[string]json.RawMessage{"_sync": json.RawMessage(`{}`), "_txn": json.RawMessage(`{}`)}, nil},
+		{
+			"mixed",
+			map[string]json.RawMessage{"_eventing": json.RawMessage(`{}`), "audit": json.RawMessage(`{"by":"a"}`)},
+			map[string]json.RawMessage{"audit": json.RawMessage(`{"by":"a"}`)},
+		},
+		{
+			"underscore within name",
+			map[string]json.RawMessage{"my_attr": json.RawMessage(`1`)},
+			map[string]json.RawMessage{"my_attr": json.RawMessage(`1`)},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := userXattrs(test.xattrs); !reflect.DeepEqual(got, test.expected) {
+				t.Errorf("got: %s expected: %s", got, test.expected)
+			}
+		})
+	}
+}
+
+func TestCheckBinaryDocAllowed(t *testing.T) {
+	tests := []struct {
+		name                  string
+		languageCompatibility string
+		skipBinaryDocs        bool
+		expected              bool
+	}{
+		{"supported", "6.6.2", false, true},
+		{"predates binary docs", "6.5.0", false, false},
+		{"skipped", "6.6.2", true, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := &Consumer{languageCompatibility: test.languageCompatibility, skipBinaryDocs: test.skipBinaryDocs}
+			if got := c.checkBinaryDocAllowed(); got != test.expected {
+				t.Errorf("got: %v expected: %v", got, test.expected)
+			}
+		})
+	}
+}
@@ -1,6 +1,8 @@
 package consumer
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"hash/crc32"
 	"net"
@@ -17,7 +19,6 @@ import (
 	"github.com/couchbase/eventing/logging"
 	"github.com/couchbase/eventing/suptree"
 	"github.com/couchbase/eventing/util"
-	flatbuffers "github.com/google/flatbuffers/go"
 )
 
 // NewConsumer called by producer to create consumer handle
@@ -41,6 +42,8 @@ func NewConsumer(hConfig *common.HandlerConfig, pConfig *common.ProcessConfig, r
 		bucketCacheAge:                  hConfig.BucketCacheAge,
 		cbBucket:                        b,
 		checkpointInterval:              time.Duration(hConfig.CheckpointInterval) * time.Millisecond,
+		checkpointBatchInterval:         time.Duration(hConfig.CheckpointBatchInterval) * time.Millisecond,
+		checkpointBatcher:               newCheckpointBatcher(),
 		idleCheckpointInterval:          time.Duration(hConfig.IdleCheckpointInterval) * time.Millisecond,
 		clusterStateChangeNotifCh:       make(chan struct{}, ClusterChangeNotifChBufSize),
 		connMutex:                       &sync.RWMutex{},
@@ -49,9 +52,14 @@ func NewConsumer(hConfig *common.HandlerConfig, pConfig *common.ProcessConfig, r
 		cppWorkerThrCount:               hConfig.CPPWorkerThrCount,
 		crcTable:                        crc32.MakeTable(crc32.Castagnoli),
 		dcpConfig:                       dcpConfig,
+		dcpFeedEvents:                   newDcpFeedEvents(fmt.Sprintf("worker_%s_%d", app.AppName, index)),
 		dcpFeedVbMap:                    make(map[*couchbase.DcpFeed][]uint16),
 		dcpStreamBoundary:               hConfig.StreamBoundary,
 		diagDir:                         pConfig.DiagDir,
+		workerStderr:                    newLineRing(incidentStderrLines),
+		failureDomains:                  newFailureDomains(fmt.Sprintf("worker_%s_%d", app.AppName, index)),
+		lastDispatched:                  newDispatchRing(incidentDispatchedCount),
+		replayRings:                     newReplayRings(hConfig.DebuggerReplayEvents),
 		debuggerPort:                    pConfig.DebuggerPort,
 		eventingAdminPort:               pConfig.EventingPort,
 		eventingSSLPort:                 pConfig.EventingSSLPort,
@@ -79,24 +87,47 @@ func NewConsumer(hConfig *common.HandlerConfig, pConfig *common.ProcessConfig, r
 		hostDcpFeedRWMutex:              &sync.RWMutex{},
 		insight:                         make(chan *common.Insight),
 		kvHostDcpFeedMap:                make(map[string]*couchbase.DcpFeed),
+		kvHostBootstrapDcpFeedMap:       make(map[string]*couchbase.DcpFeed),
 		kvNodesRWMutex:                  &sync.RWMutex{},
 		lcbInstCapacity:                 hConfig.LcbInstCapacity,
 		n1qlConsistency:                 hConfig.N1qlConsistency,
+		n1qlTimeout:                     hConfig.N1qlTimeout,
 		logLevel:                        hConfig.LogLevel,
 		msgProcessedRWMutex:             &sync.RWMutex{},
 		nsServerPort:                    nsServerPort,
 		numVbuckets:                     numVbuckets,
 		numTimerPartitions:              hConfig.NumTimerPartitions,
+		timerIntegrityCheck:             hConfig.TimerIntegrityCheck,
+		timerScanCh:                     make(chan uint16, numVbuckets),
 		curlMaxAllowedRespSize:          hConfig.CurlMaxAllowedRespSize,
+		maxDocSizeBytes:                 hConfig.MaxDocSizeBytes,
+		maxDocSizeMode:                  hConfig.MaxDocSizeMode,
+		maxDocSizeLog:                   hConfig.MaxDocSizeLog,
+		atLeastOnce:                     hConfig.DeliveryGuarantee == common.DeliveryAtLeastOnce,
+		useBootstrapDcpConnections:      hConfig.UseBootstrapDcpFeeds,
+		bootstrapDcpBackfillThreshold:   hConfig.BootstrapFeedThreshold,
+		bootstrapDcpPriority:            hConfig.BootstrapFeedPriority,
+		bootstrapDcpFeedMutex:           &sync.Mutex{},
+		bootstrapSeqNosMutex:            &sync.Mutex{},
+		prefetchKeyPatterns:             hConfig.PrefetchKeyPatterns,
+		prefetchKeySeparator:            hConfig.PrefetchKeySeparator,
+		prefetchCh:                      make(chan *memcached.DcpEvent, prefetchQueueCap),
+		vbBootstrapStreams:              make(map[uint16]uint64),
+		vbBootstrapStreamsRWMutex:       &sync.RWMutex{},
 		opsTimestamp:                    time.Now(),
 		producer:                        p,
 		reqStreamCh:                     make(chan *streamRequestInfo, numVbuckets*10),
 		restartVbDcpStreamTicker:        time.NewTicker(restartVbDcpStreamTickInterval),
 		retryCount:                      retryCount,
+		msgBatch:                        newMessageBatch(),
 		sendMsgBufferRWMutex:            &sync.RWMutex{},
 		sendMsgCounter:                  0,
 		signalBootstrapFinishCh:         make(chan struct{}, 1),
 		signalConnectedCh:               make(chan struct{}, 1),
+		signalCapabilitiesCh:            make(chan struct{}, 1),
+		signalHandshakeCh:               make(chan *protocolHandshakeAck, 1),
+		signalCompileInfoCh:             make(chan *common.CompileStatus, 1),
+		hotSwapMutex:                    &sync.Mutex{},
 		signalFeedbackConnectedCh:       make(chan struct{}, 1),
 		signalSettingsChangeCh:          make(chan struct{}, 1),
 		socketWriteBatchSize:            hConfig.SocketWriteBatchSize,
@@ -104,53 +135,86 @@ func NewConsumer(hConfig *common.HandlerConfig, pConfig *common.ProcessConfig, r
 		socketWriteLoopStopCh:           make(chan struct{}, 1),
 		socketWriteTicker:               time.NewTicker(socketWriteTimerInterval),
 		statsRWMutex:                    &sync.RWMutex{},
+		statsQuarantine:                 newStatsQuarantine(),
 		statsTickDuration:               time.Duration(hConfig.StatsLogInterval) * time.Millisecond,
 		streamReqRWMutex:                &sync.RWMutex{},
-		stopVbOwnerTakeoverCh:           make(chan struct{}),
-		stopConsumerCh:                  make(chan struct{}),
+		streamReqTracker:                newStreamReqTracker(),
+		streamOpenTimings:               newVbTimings(),
+		timerTransferTimings:            newVbTimings(),
+		rebalanceCtxMutex:               &sync.Mutex{},
+		networkStats:                    &networkStats{},
 		superSup:                        s,
 		tcpPort:                         pConfig.SockIdentifier,
 		allowTransactionMutations:       hConfig.AllowTransactionMutations,
+		includeXattrs:                   hConfig.IncludeXattrs,
+		skipBinaryDocs:                  hConfig.SkipBinaryDocs,
+		frameChecksumsWanted:            hConfig.WorkerFrameChecksums,
+		originTagging:                   hConfig.OriginTagging,
 		timerContextSize:                hConfig.TimerContextSize,
+		timerLaneBatchSize:              hConfig.TimerLaneBatchSize,
+		deadLetterKeyspace:              hConfig.DeadLetterKeyspace,
+		deadLetterRetryCount:            hConfig.DeadLetterRetryCount,
+		deadLetterCh:                    make(chan *deadLetter, deadLetterQueueCap),
+		deadLetterHolds:                 newDeadLetterHolds(),
+		handlerRetryCount:               hConfig.RetryCount,
+		handlerRetryBackoff:             hConfig.RetryBackoff,
+		handlerRetryOn:                  hConfig.RetryOn,
+		strictOrderCheck:                hConfig.StrictOrderCheck,
+		dispatchOrder:                   newDispatchOrderChecker(numVbuckets),
+		dcpLaneBatchSize:                hConfig.DcpLaneBatchSize,
 		updateStatsTicker:               time.NewTicker(updateCPPStatsTickInterval),
 		loadStatsTicker:                 time.NewTicker(updateCPPStatsTickInterval),
+		heartbeatTicker:                 time.NewTicker(common.ConsumerHeartbeatInterval),
 		uuid:                            uuid,
-		vbDcpFeedMap:                    make(map[uint16]*couchbase.DcpFeed),
+		vbDcpFeeds:                      newVbDcpFeeds(),
 		vbEnqueuedForStreamReq:          make(map[uint16]struct{}),
 		vbEnqueuedForStreamReqRWMutex:   &sync.RWMutex{},
 		vbFlogChan:                      make(chan *vbFlogEntry, 1024),
 		vbnos:                           vbnos,
 		vbDcpEventsRemaining:            make(map[int]int64),
-		vbEventingNodeAssignMap:         vbEventingNodeAssignMap,
-		vbEventingNodeAssignRWMutex:     &sync.RWMutex{},
 		vbOwnershipGiveUpRoutineCount:   rConfig.VBOwnershipGiveUpRoutineCount,
 		vbOwnershipTakeoverRoutineCount: rConfig.VBOwnershipTakeoverRoutineCount,
+		autoTuneVbTakeoverRoutines:      rConfig.AutoTuneVBTakeoverRoutines,
+		vbTakeoverRoutineMinCount:       rConfig.VBTakeoverRoutineMinCount,
+		vbTakeoverRoutineMaxCount:       rConfig.VBTakeoverRoutineMaxCount,
+		vbTakeoverDeadline:              time.Duration(rConfig.VBTakeoverDeadline) * time.Second,
+		forceVbTakeover:                 rConfig.ForceVBTakeover,
+		vbHandoverLingerTimeout:         time.Duration(rConfig.VBHandoverLingerTimeout) * time.Second,
+		vbHandovers:                     newVbHandovers(numVbuckets),
+		readSeqNos:                      newReadSeqNoBatcher(),
+		keyFilter:                       newKeyFilter(app.AppName, hConfig.KeyPrefixes, hConfig.KeyPatterns),
+		vbTakeoverTimer:                 &vbTakeoverTimer{},
+		vbsStateUpdateTracker:           &vbsStateUpdateTracker{},
 		vbsRemainingToCleanup:           make([]uint16, 0),
 		vbsRemainingToClose:             make([]uint16, 0),
 		vbsRemainingToGiveUp:            make([]uint16, 0),
 		vbsRemainingToOwn:               make([]uint16, 0),
 		vbsRemainingToRestream:          make([]uint16, 0),
-		vbsStreamClosed:                 make(map[uint16]bool),
-		vbsStreamClosedRWMutex:          &sync.RWMutex{},
-		vbStreamRequested:               make(map[uint16]uint64),
-		vbsStreamRRWMutex:               &sync.RWMutex{},
+		vbStreamRequests:                newVbStreamRequests(),
 		workerName:                      fmt.Sprintf("worker_%s_%d", app.AppName, index),
 		vbProcessingStats:               newVbProcessingStats(app.AppName, uint16(numVbuckets), uuid, fmt.Sprintf("worker_%s_%d", app.AppName, index)),
 		workerCount:                     len(workerVbucketMap),
 		workerQueueCap:                  hConfig.WorkerQueueCap,
 		workerQueueMemCap:               hConfig.WorkerQueueMemCap,
+		workerQueueHighWatermark:        hConfig.WorkerQueueCap * int64(hConfig.WorkerQueueHighWatermark) / 100,
+		workerQueueLowWatermark:         hConfig.WorkerQueueCap * int64(hConfig.WorkerQueueLowWatermark) / 100,
 		workerRespMainLoopThreshold:     hConfig.WorkerResponseTimeout,
-		workerVbucketMap:                workerVbucketMap,
-		workerVbucketMapRWMutex:         &sync.RWMutex{},
+		workerRSSLimit:                  hConfig.WorkerRSSLimit,
+		workerCPULimit:                  hConfig.WorkerCPULimit,
+		workerUsage:                     newWorkerUsage(),
 	}
 
+	consumer.ctx, consumer.cancelCtx = context.WithCancel(p.Context())
+	consumer.metaTranscoder = newCountingTranscoder(&consumer.networkStats.metadataIn, &consumer.networkStats.metadataOut)
+	consumer.deadLetterTranscoder = newCountingTranscoder(nil, &consumer.networkStats.deadLetterOut)
+	consumer.vbEventingNodeAssignMap.Store(vbEventingNodeAssignMap)
+	consumer.workerVbucketMap.Store(workerVbucketMap)
 	consumer.srcCid = p.GetSourceCid()
+	consumer.srcCids = p.GetSourceCollectionIDs()
+	consumer.applyCollectionFilter()
 	consumer.binaryDocAllowed = consumer.checkBinaryDocAllowed()
-	consumer.builderPool = &sync.Pool{
-		New: func() interface{} {
-			return flatbuffers.NewBuilder(0)
-		},
-	}
+	consumer.builderPool = newBuilderPool(hConfig.BuilderPoolSize, hConfig.BuilderInitialCapacity)
+	consumer.SetMemoryPressureLevel(s.MemoryPressureLevel())
 
 	return consumer
 }
@@ -194,6 +258,11 @@ func (c *Consumer) Serve() {
 		return
 	}
 
+	if len(c.prefetchKeyPatterns) > 0 && !c.isPrefetchEnabled() {
+		logging.Warnf("%s [%s:%s:%d] Prefetch of related documents is supported only for default collection, source scope: %s collection: %s",
+			logPrefix, c.workerName, c.tcpPort, c.Pid(), c.sourceKeyspace.ScopeName, c.sourceKeyspace.CollectionName)
+	}
+
 	err = c.updategocbMetaHandle()
 	if err != nil {
 		logging.Errorf("%s [%s:%s:%d] Exiting due to timeout", logPrefix, c.workerName, c.tcpPort, c.Pid(), err)
@@ -270,6 +339,8 @@ checkIfPlannerRunning:
 		return
 	}
 
+	atomic.StoreUint64(&c.settingsSubscription, c.superSup.SubscribeAppSettings(c.app.AppName, c.onSettingsChange))
+
 	c.controlRoutineWg.Add(1)
 	go c.controlRoutine()
 
@@ -309,11 +380,18 @@ func (c *Consumer) HandleV8Worker() error {
 	<-c.signalConnectedCh
 	<-c.signalFeedbackConnectedCh
 
-	logging.SetLogLevel(util.GetLogLevel(c.logLevel))
+	if err := c.negotiateProtocol(); err != nil {
+		return err
+	}
+
 	c.sendLogLevel(c.logLevel, false)
 	c.sendWorkerThrMap(nil, false)
 	c.sendWorkerThrCount(0, false)
 	c.sendWorkerMemQuota(c.aggDCPFeedMemCap * int64(2))
+	c.sendDispatchLanes(c.timerLaneBatchSize, c.dcpLaneBatchSize)
+	c.sendDeadLetterRetries()
+	c.sendRetryPolicy()
+	c.sendStrictOrderCheck()
 	err := util.Retry(util.NewFixedBackoff(clusterOpRetryInterval), c.retryCount, getEventingNodeAddrOpCallback, c)
 	if err == common.ErrRetryTimeout {
 		logging.Errorf("%s [%s:%s:%d] Exiting due to timeout", logPrefix, c.workerName, c.tcpPort, c.Pid())
@@ -346,8 +424,13 @@ func (c *Consumer) HandleV8Worker() error {
 
 	go c.processDCPEvents()
 	go c.processFilterEvents()
+	go c.processDeadLetters()
+	go c.processPrefetchEvents()
+	go c.persistReplayEvents()
 	go c.processStatsEvents()
 	go c.loadStatsFromConsumer()
+	go c.enforceWorkerLimits()
+	go c.verifyTakenOverTimerStores()
 	return nil
 }
 
@@ -368,6 +451,10 @@ func (c *Consumer) Stop(context string) {
 	logging.Infof("%s [%s:%s:%d] Gracefully shutting down consumer routine",
 		logPrefix, c.workerName, c.tcpPort, c.Pid())
 
+	if id := atomic.SwapUint64(&c.settingsSubscription, 0); id != 0 {
+		c.superSup.UnsubscribeAppSettings(c.app.AppName, id)
+	}
+
 	err := c.RemoveSupervisorToken()
 	if err != nil {
 		logging.Errorf("%v", err)
@@ -414,6 +501,10 @@ func (c *Consumer) Stop(context string) {
 		c.loadStatsTicker.Stop()
 	}
 
+	if c.heartbeatTicker != nil {
+		c.heartbeatTicker.Stop()
+	}
+
 	logging.Infof("%s [%s:%s:%d] Sent signal to stop cpp worker stat collection routine",
 		logPrefix, c.workerName, c.tcpPort, c.Pid())
 
@@ -433,11 +524,13 @@ func (c *Consumer) Stop(context string) {
 				}
 			}
 		}
+
+		c.closeBootstrapDcpFeeds()
 	}()
 
 	logging.Infof("%s [%s:%s:%d] Closed all dcpfeed handles", logPrefix, c.workerName, c.tcpPort, c.Pid())
 
-	close(c.stopConsumerCh)
+	c.cancelCtx()
 
 	if c.conn != nil {
 		c.conn.Close()
@@ -502,8 +595,27 @@ func (c *Consumer) NotifyRebalanceStop() {
 	logging.Infof("%s [%s:%s:%d] Updated isRebalanceOngoing to %t",
 		logPrefix, c.workerName, c.tcpPort, c.Pid(), c.isRebalanceOngoing)
 
-	if c.vbsStateUpdateRunning {
-		close(c.stopVbOwnerTakeoverCh)
+	c.cancelRebalance()
+}
+
+// rebalanceContext returns context of ongoing rebalance, starting a fresh one if
+// previous rebalance was stopped
+func (c *Consumer) rebalanceContext() context.Context {
+	c.rebalanceCtxMutex.Lock()
+	defer c.rebalanceCtxMutex.Unlock()
+
+	if c.rebalanceCtx == nil || c.rebalanceCtx.Err() != nil {
+		c.rebalanceCtx, c.rebalanceCancel = context.WithCancel(c.ctx)
+	}
+	return c.rebalanceCtx
+}
+
+func (c *Consumer) cancelRebalance() {
+	c.rebalanceCtxMutex.Lock()
+	defer c.rebalanceCtxMutex.Unlock()
+
+	if c.rebalanceCancel != nil {
+		c.rebalanceCancel()
 	}
 }
 
@@ -514,7 +626,15 @@ func (c *Consumer) NotifySettingsChange() {
 	logging.Infof("%s [%s:%s:%d] Got notification about application settings update",
 		logPrefix, c.workerName, c.tcpPort, c.Pid())
 
-	c.signalSettingsChangeCh <- struct{}{}
+	// Pending notification suffices, as latest settings are read from settings cache
+	select {
+	case c.signalSettingsChangeCh <- struct{}{}:
+	default:
+	}
+}
+
+func (c *Consumer) onSettingsChange(settings map[string]interface{}, revision uint64) {
+	c.NotifySettingsChange()
 }
 
 // SignalStopDebugger signal C++ consumer to stop debugger
@@ -528,13 +648,42 @@ func (c *Consumer) SignalStopDebugger() error {
 	return nil
 }
 
-func (c *Consumer) getBuilder() *flatbuffers.Builder {
-	return c.builderPool.Get().(*flatbuffers.Builder)
+// CancelTimer gets timer created by the handler with given callback and reference
+// removed from timer store, as if handler had called cancelTimer on it
+func (c *Consumer) CancelTimer(callback, reference string) error {
+	logPrefix := "Consumer::CancelTimer"
+
+	if !c.producer.UsingTimer() {
+		return common.ErrTimersNotInUse
+	}
+
+	meta, err := json.Marshal(map[string]string{
+		"callback":  callback,
+		"reference": reference,
+	})
+	if err != nil {
+		return err
+	}
+
+	logging.Infof("%s [%s:%s:%d] Cancelling timer callback: %s reference: %ru",
+		logPrefix, c.workerName, c.tcpPort, c.Pid(), callback, reference)
+
+	atomic.AddUint64(&c.timerCancelRequests, 1)
+	c.sendCancelTimer(string(meta))
+	return nil
+}
+
+func (c *Consumer) getBuilder() *pooledBuilder {
+	return c.builderPool.get(0)
+}
+
+// getSizedBuilder returns a builder with room for a message of given size
+func (c *Consumer) getSizedBuilder(size int) *pooledBuilder {
+	return c.builderPool.get(size)
 }
 
-func (c *Consumer) putBuilder(b *flatbuffers.Builder) {
-	b.Reset()
-	c.builderPool.Put(b)
+func (c *Consumer) putBuilder(b *pooledBuilder) {
+	c.builderPool.put(b)
 }
 
 func (c *Consumer) getKvNodes() []string {
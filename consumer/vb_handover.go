@@ -0,0 +1,300 @@
+package consumer
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/couchbase/eventing/common"
+	"github.com/couchbase/eventing/logging"
+	"github.com/couchbase/eventing/util"
+	"github.com/couchbase/gocb/v2"
+)
+
+const vbHandoverPollInterval = time.Second
+
+// Handover of a vb during rebalance, enabled by vb_handover_linger_timeout:
+//  1. Owner giving up the vb picks seq no of the last mutation it let through as
+//     handover seq no, atomically with filter, and publishes it in checkpoint blob.
+//     Mutations beyond it aren't processed anymore
+//  2. Owner acks the handover in checkpoint blob once its worker has processed
+//     everything up to handover seq no
+//  3. New owner waits for the ack and streams the vb from handover seq no, instead
+//     of waiting for owner to close its stream
+//  4. Owner closes its stream once checkpoint blob shows new owner's stream as
+//     running, leaving metadata as is on STREAMEND
+//
+// If new owner doesn't take over within linger timeout, owner closes its stream and
+// checkpoints no further than handover seq no, so that vb is taken over as usual.
+type vbHandovers struct {
+	sync.RWMutex
+	seqNos     map[uint16]uint64 // Handover seq no of lingering vbs
+	confirmed  map[uint16]struct{}
+	readSeqNos []uint64 // Last seq no read per vb, stored under read lock
+}
+
+func newVbHandovers(numVbuckets int) *vbHandovers {
+	return &vbHandovers{
+		seqNos:     make(map[uint16]uint64),
+		confirmed:  make(map[uint16]struct{}),
+		readSeqNos: make([]uint64, numVbuckets),
+	}
+}
+
+// start marks vb as lingering and returns its handover seq no. As write lock keeps
+// filter out, no mutation beyond the returned seq no can slip through
+func (h *vbHandovers) start(vb uint16, lastReadSeqNo uint64) uint64 {
+	h.Lock()
+	defer h.Unlock()
+
+	seqNo := atomic.LoadUint64(&h.readSeqNos[vb])
+	if lastReadSeqNo > seqNo {
+		seqNo = lastReadSeqNo
+	}
+
+	h.seqNos[vb] = seqNo
+	delete(h.confirmed, vb)
+	return seqNo
+}
+
+func (h *vbHandovers) lingering(vb uint16) bool {
+	h.RLock()
+	defer h.RUnlock()
+
+	_, ok := h.seqNos[vb]
+	return ok
+}
+
+// filter returns true for mutations of a lingering vb beyond its handover seq no,
+// otherwise records seq no as read
+func (h *vbHandovers) filter(vb uint16, seqNo uint64) bool {
+	h.RLock()
+	defer h.RUnlock()
+
+	handoverSeqNo, ok := h.seqNos[vb]
+	if ok && seqNo > handoverSeqNo {
+		return true
+	}
+
+	atomic.StoreUint64(&h.readSeqNos[vb], seqNo)
+	return false
+}
+
+// read records seq no of events which don't go through filter
+func (h *vbHandovers) read(vb uint16, seqNo uint64) {
+	h.RLock()
+	defer h.RUnlock()
+
+	if _, ok := h.seqNos[vb]; !ok {
+		atomic.StoreUint64(&h.readSeqNos[vb], seqNo)
+	}
+}
+
+func (h *vbHandovers) confirm(vb uint16) {
+	h.Lock()
+	defer h.Unlock()
+
+	if _, ok := h.seqNos[vb]; ok {
+		h.confirmed[vb] = struct{}{}
+	}
+}
+
+// finish drops handover of a vb. Returns handover seq no, whether new owner confirmed
+// the handover and whether vb was lingering at all
+func (h *vbHandovers) finish(vb uint16) (uint64, bool, bool) {
+	h.Lock()
+	defer h.Unlock()
+
+	seqNo, ok := h.seqNos[vb]
+	_, confirmed := h.confirmed[vb]
+	delete(h.seqNos, vb)
+	delete(h.confirmed, vb)
+	atomic.StoreUint64(&h.readSeqNos[vb], 0)
+	return seqNo, confirmed, ok
+}
+
+// lingerVbsToGiveUp hands over vbs owned by the consumer, which it isn't supposed to
+// own as per plan. Returns false if lingering isn't enabled, in which case caller is
+// expected to drop dcp feeds right away
+func (c *Consumer) lingerVbsToGiveUp() bool {
+	logPrefix := "Consumer::lingerVbsToGiveUp"
+
+	if c.vbHandoverLingerTimeout <= 0 || util.Contains(c.NodeUUID(), c.ejectNodesUUIDs) {
+		return false
+	}
+
+	for _, vb := range c.getCurrentlyOwnedVbs() {
+		if c.checkIfCurrentConsumerShouldOwnVb(vb) || c.vbHandovers.lingering(vb) {
+			continue
+		}
+
+		err := c.startVbHandover(vb)
+		if err == nil {
+			continue
+		}
+
+		logging.Errorf("%s [%s:%s:%d] vb: %d Failed to publish handover, closing stream right away, err: %v",
+			logPrefix, c.workerName, c.tcpPort, c.Pid(), vb, err)
+		c.closeHandedOverVbStream(vb)
+	}
+	return true
+}
+
+func (c *Consumer) startVbHandover(vb uint16) error {
+	logPrefix := "Consumer::startVbHandover"
+
+	// Stat is batched and only covers vbs which didn't read a mutation since stream
+	// started, handover seq no is otherwise picked by filter
+	seqNo := c.vbHandovers.start(vb, c.vbProcessingStats.getVbStat(vb, "last_read_seq_no").(uint64))
+
+	handover := &vbHandover{
+		AssignedWorker: c.ConsumerName(),
+		NodeUUID:       c.NodeUUID(),
+		SeqNo:          seqNo,
+		Timestamp:      time.Now().String(),
+	}
+
+	vbKey := common.CheckpointBlobKey(c.app.AppName, vb)
+	err := util.Retry(util.NewFixedBackoff(bucketOpRetryInterval), c.retryCount, setVbHandoverCallback,
+		c, c.producer.AddMetadataPrefix(vbKey), handover)
+	if err != nil {
+		return err
+	}
+
+	logging.Infof("%s [%s:%s:%d] vb: %d Lingering on stream until new owner streams from handover seq no: %d",
+		logPrefix, c.workerName, c.tcpPort, c.Pid(), vb, seqNo)
+
+	go c.lingerOnVb(vb, seqNo)
+	return nil
+}
+
+// lingerOnVb keeps stream of a vb being given up open, until new owner confirms its
+// stream is running or linger timeout expires
+func (c *Consumer) lingerOnVb(vb uint16, seqNo uint64) {
+	logPrefix := "Consumer::lingerOnVb"
+
+	ticker := time.NewTicker(vbHandoverPollInterval)
+	defer ticker.Stop()
+
+	timeout := time.NewTimer(c.vbHandoverLingerTimeout)
+	defer timeout.Stop()
+
+	vbKey := common.CheckpointBlobKey(c.app.AppName, vb)
+	var acked bool
+	var prevSentSeqNo uint64
+
+	for {
+		select {
+		case <-ticker.C:
+			if !acked {
+				acked, prevSentSeqNo = c.isVbHandoverProcessed(vb, seqNo, prevSentSeqNo)
+				if acked {
+					err := util.Retry(util.NewFixedBackoff(bucketOpRetryInterval), c.retryCount, ackVbHandoverCallback,
+						c, c.producer.AddMetadataPrefix(vbKey), seqNo)
+					if err == common.ErrRetryTimeout {
+						logging.Errorf("%s [%s:%s:%d] Exiting due to timeout", logPrefix, c.workerName, c.tcpPort, c.Pid())
+						return
+					}
+
+					logging.Infof("%s [%s:%s:%d] vb: %d Processed up to handover seq no: %d, acked handover",
+						logPrefix, c.workerName, c.tcpPort, c.Pid(), vb, seqNo)
+				}
+			}
+
+			var vbBlob vbucketKVBlob
+			var cas gocb.Cas
+
+			err := util.Retry(util.NewFixedBackoff(bucketOpRetryInterval), c.retryCount, getOpCallback,
+				c, c.producer.AddMetadataPrefix(vbKey), &vbBlob, &cas, false)
+			if err == common.ErrRetryTimeout {
+				logging.Errorf("%s [%s:%s:%d] Exiting due to timeout", logPrefix, c.workerName, c.tcpPort, c.Pid())
+				return
+			}
+
+			if !c.isVbHandoverConfirmed(&vbBlob) {
+				continue
+			}
+
+			c.vbHandovers.confirm(vb)
+			atomic.AddUint64(&c.vbHandoverCompleted, 1)
+
+			logging.Infof("%s [%s:%s:%d] vb: %d Handed over at seq no: %d to node: %rs worker: %s, closing stream",
+				logPrefix, c.workerName, c.tcpPort, c.Pid(), vb, seqNo, vbBlob.CurrentVBOwner, vbBlob.AssignedWorker)
+			c.closeHandedOverVbStream(vb)
+			return
+
+		case <-timeout.C:
+			atomic.AddUint64(&c.vbHandoverTimedOut, 1)
+
+			logging.Warnf("%s [%s:%s:%d] vb: %d New owner didn't take over within linger timeout: %v, closing stream",
+				logPrefix, c.workerName, c.tcpPort, c.Pid(), vb, c.vbHandoverLingerTimeout)
+			c.closeHandedOverVbStream(vb)
+			return
+
+		case <-c.ctx.Done():
+			return
+		}
+	}
+}
+
+// isVbHandoverProcessed returns true once worker is done with mutations up to handover
+// seq no. Mutations skipped right before the handover never get acked by the worker,
+// so it's also done once it acked all it was sent and nothing was sent since last poll
+func (c *Consumer) isVbHandoverProcessed(vb uint16, seqNo, prevSentSeqNo uint64) (bool, uint64) {
+	processedSeqNo := c.vbProcessingStats.getVbStat(vb, "last_processed_seq_no").(uint64)
+	sentSeqNo := c.vbProcessingStats.getVbStat(vb, "last_sent_seq_no").(uint64)
+
+	if processedSeqNo >= seqNo {
+		return true, sentSeqNo
+	}
+	return processedSeqNo >= sentSeqNo && sentSeqNo == prevSentSeqNo, sentSeqNo
+}
+
+// isVbHandoverConfirmed returns true once checkpoint blob shows the vb streamed by
+// a consumer other than this one
+func (c *Consumer) isVbHandoverConfirmed(vbBlob *vbucketKVBlob) bool {
+	if vbBlob.DCPStreamStatus != dcpStreamRunning || vbBlob.NodeUUID == "" {
+		return false
+	}
+	return vbBlob.NodeUUID != c.NodeUUID() || vbBlob.AssignedWorker != c.ConsumerName()
+}
+
+// isVbHandoverOffered returns true if current owner of the vb, as per checkpoint
+// blob, is lingering on it for another consumer to take over. Stream must not be
+// started before isVbHandoverAcked
+func (c *Consumer) isVbHandoverOffered(vbBlob *vbucketKVBlob) bool {
+	handover := vbBlob.Handover
+	if handover == nil {
+		return false
+	}
+
+	// Handover published by a previous owner is stale
+	if handover.NodeUUID != vbBlob.NodeUUID || handover.AssignedWorker != vbBlob.AssignedWorker {
+		return false
+	}
+	return handover.NodeUUID != c.NodeUUID() || handover.AssignedWorker != c.ConsumerName()
+}
+
+// isVbHandoverAcked returns true once owner offering the handover processed all
+// mutations up to handover seq no
+func isVbHandoverAcked(handover *vbHandover) bool {
+	return handover.AckedSeqNo >= handover.SeqNo
+}
+
+func (c *Consumer) closeHandedOverVbStream(vb uint16) {
+	logPrefix := "Consumer::closeHandedOverVbStream"
+
+	c.checkpointBatcher.discard(vb)
+	c.dcpCloseStreamCounter++
+	var err error
+	if feed, ok := c.vbDcpFeeds.get(vb); ok {
+		err = feed.DcpCloseStream(vb, vb)
+	} else {
+		err = errVbDcpFeedMissing
+	}
+	if err != nil {
+		c.dcpCloseStreamErrCounter++
+		logging.Errorf("%s [%s:%s:%d] vb: %d Failed to close dcp stream, err: %v",
+			logPrefix, c.workerName, c.tcpPort, c.Pid(), vb, err)
+	}
+}
@@ -0,0 +1,90 @@
+package consumer
+
+import (
+	"testing"
+)
+
+func TestVbHandovers(t *testing.T) {
+	tests := []struct {
+		name          string
+		read          []uint64
+		lastReadSeqNo uint64
+		expected      uint64
+		filtered      []uint64
+		passed        []uint64
+	}{
+		{
+			name:     "handover at last mutation read",
+			read:     []uint64{5, 8, 12},
+			expected: 12,
+			filtered: []uint64{13, 20},
+			passed:   []uint64{12},
+		},
+		{
+			name:          "stale stat doesn't lower handover seq no",
+			read:          []uint64{5, 8, 12},
+			lastReadSeqNo: 8,
+			expected:      12,
+			filtered:      []uint64{13},
+		},
+		{
+			name:          "no mutation read since stream started",
+			lastReadSeqNo: 40,
+			expected:      40,
+			filtered:      []uint64{41},
+			passed:        []uint64{40},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			h := newVbHandovers(4)
+			for _, seqNo := range test.read {
+				if h.filter(1, seqNo) {
+					t.Fatalf("seq no: %d filtered before handover", seqNo)
+				}
+			}
+
+			if seqNo := h.start(1, test.lastReadSeqNo); seqNo != test.expected {
+				t.Errorf("handover seq no: %d expected: %d", seqNo, test.expected)
+			}
+			for _, seqNo := range test.filtered {
+				if !h.filter(1, seqNo) {
+					t.Errorf("seq no: %d not filtered", seqNo)
+				}
+			}
+			for _, seqNo := range test.passed {
+				if h.filter(1, seqNo) {
+					t.Errorf("seq no: %d filtered", seqNo)
+				}
+			}
+			if h.filter(2, test.expected+1) {
+				t.Errorf("vb not handed over filtered")
+			}
+
+			if seqNo, _, lingered := h.finish(1); !lingered || seqNo != test.expected {
+				t.Errorf("finish returned seq no: %d lingered: %v", seqNo, lingered)
+			}
+			if seqNo := h.start(1, 0); seqNo != 0 {
+				t.Errorf("read seq no not reset on finish, handover seq no: %d", seqNo)
+			}
+		})
+	}
+}
+
+func TestIsVbHandoverAcked(t *testing.T) {
+	tests := []struct {
+		handover vbHandover
+		expected bool
+	}{
+		{vbHandover{SeqNo: 10}, false},
+		{vbHandover{SeqNo: 10, AckedSeqNo: 10}, true},
+		{vbHandover{}, true},
+	}
+
+	for _, test := range tests {
+		if got := isVbHandoverAcked(&test.handover); got != test.expected {
+			t.Errorf("handover: %+v got: %v expected: %v", test.handover, got, test.expected)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package consumer
+
+import (
+	"time"
+
+	"github.com/couchbase/eventing/logging"
+	"github.com/couchbase/eventing/util"
+)
+
+func (c *Consumer) isVbPaused(vb uint16) bool {
+	return c.producer.IsVbPaused(vb)
+}
+
+// PauseVbs closes streams of vbs owned by the consumer. STREAMEND handling checkpoints
+// them at last processed seqno and skips reclaiming them while they stay paused
+func (c *Consumer) PauseVbs(vbs []uint16) {
+	logPrefix := "Consumer::PauseVbs"
+
+	vbsClosed := make([]uint16, 0)
+	for _, vb := range vbs {
+		if !c.checkIfVbAlreadyOwnedByCurrConsumer(vb) {
+			continue
+		}
+
+		feed, ok := c.vbDcpFeeds.get(vb)
+		if !ok {
+			continue
+		}
+
+		c.dcpCloseStreamCounter++
+		err := feed.DcpCloseStream(vb, vb)
+		if err != nil {
+			c.dcpCloseStreamErrCounter++
+			logging.Errorf("%s [%s:%s:%d] vb: %d Failed to close dcp stream, err: %v",
+				logPrefix, c.workerName, c.tcpPort, c.Pid(), vb, err)
+			continue
+		}
+
+		lastSeqNo := c.vbProcessingStats.getVbStat(vb, "last_read_seq_no").(uint64)
+		c.vbProcessingStats.updateVbStat(vb, "seq_no_after_close_stream", lastSeqNo)
+		c.vbProcessingStats.updateVbStat(vb, "timestamp", time.Now().Format(time.RFC3339))
+		vbsClosed = append(vbsClosed, vb)
+	}
+
+	logging.Infof("%s [%s:%s:%d] Issued dcp close stream for paused vbs len: %d dump: %s",
+		logPrefix, c.workerName, c.tcpPort, c.Pid(), len(vbsClosed), util.Condense(vbsClosed))
+}
+
+// ResumeVbs gets the consumer to reclaim resumed vbs assigned to it as per planner
+func (c *Consumer) ResumeVbs(vbs []uint16) {
+	logPrefix := "Consumer::ResumeVbs"
+
+	vbsToRestream := make([]uint16, 0)
+	for _, vb := range vbs {
+		if c.vbProcessingStats.getVbStat(vb, "dcp_stream_status") == dcpStreamPaused {
+			c.vbProcessingStats.updateVbStat(vb, "dcp_stream_status", dcpStreamStopped)
+		}
+
+		if !c.checkIfCurrentConsumerShouldOwnVb(vb) || c.checkIfVbAlreadyOwnedByCurrConsumer(vb) {
+			continue
+		}
+		vbsToRestream = append(vbsToRestream, vb)
+	}
+
+	logging.Infof("%s [%s:%s:%d] Reclaiming resumed vbs len: %d dump: %s",
+		logPrefix, c.workerName, c.tcpPort, c.Pid(), len(vbsToRestream), util.Condense(vbsToRestream))
+
+	c.Lock()
+	c.vbsRemainingToRestream = append(c.vbsRemainingToRestream, vbsToRestream...)
+	c.Unlock()
+}
@@ -0,0 +1,115 @@
+package consumer
+
+import (
+	"sync/atomic"
+)
+
+const (
+	// Pending last_read_seq_no of a vb is written to vbProcessingStats at least once
+	// every these many events read for it
+	vbStatFlushInterval = 64
+)
+
+// readSeqNoBatcher defers last_read_seq_no updates of vbProcessingStats, which would
+// otherwise take the vb stat lock for every event read off the feed. Pending seqno of
+// a vb is written at the end of its snapshot, every vbStatFlushInterval events, and
+// whenever the consumer catches up with its feed. Only accessed from processDCPEvents
+type readSeqNoBatcher struct {
+	vbs   map[uint16]*pendingReadSeqNo
+	dirty map[uint16]struct{}
+
+	updatesSaved     uint64
+	snapshotsDeduped uint64
+}
+
+type pendingReadSeqNo struct {
+	seqNo   uint64
+	snapEnd uint64
+	events  int
+}
+
+func newReadSeqNoBatcher() *readSeqNoBatcher {
+	return &readSeqNoBatcher{
+		vbs:   make(map[uint16]*pendingReadSeqNo),
+		dirty: make(map[uint16]struct{}),
+	}
+}
+
+func (b *readSeqNoBatcher) get(vb uint16) *pendingReadSeqNo {
+	p, ok := b.vbs[vb]
+	if !ok {
+		p = &pendingReadSeqNo{}
+		b.vbs[vb] = p
+	}
+	return p
+}
+
+func (b *readSeqNoBatcher) stats() map[string]uint64 {
+	stats := make(map[string]uint64)
+	if saved := atomic.LoadUint64(&b.updatesSaved); saved > 0 {
+		stats["vb_stat_updates_saved"] = saved
+	}
+	if deduped := atomic.LoadUint64(&b.snapshotsDeduped); deduped > 0 {
+		stats["dcp_snapshot_markers_deduped"] = deduped
+	}
+	return stats
+}
+
+// recordReadSeqNo notes seqno of event read for vb, writing it to vbProcessingStats
+// only if the snapshot is done or enough events have piled up
+func (c *Consumer) recordReadSeqNo(vb uint16, seqNo uint64) {
+	b := c.readSeqNos
+	p := b.get(vb)
+	if _, ok := b.dirty[vb]; ok {
+		atomic.AddUint64(&b.updatesSaved, 1)
+	}
+
+	p.seqNo = seqNo
+	p.events++
+	b.dirty[vb] = struct{}{}
+
+	if seqNo >= p.snapEnd || p.events >= vbStatFlushInterval {
+		c.flushReadSeqNo(vb)
+	}
+}
+
+// recordSnapshot notes snapshot window of vb. Marker ends the previous snapshot, so
+// seqno pending for it is written, unless the marker repeats current window
+func (c *Consumer) recordSnapshot(vb uint16, snapEnd uint64) {
+	b := c.readSeqNos
+	p := b.get(vb)
+	if p.snapEnd == snapEnd {
+		atomic.AddUint64(&b.snapshotsDeduped, 1)
+		return
+	}
+
+	c.flushReadSeqNo(vb)
+	p.snapEnd = snapEnd
+}
+
+// resetReadSeqNo drops state kept for vb, on stream request last_read_seq_no is set
+// to start seqno of the new stream
+func (c *Consumer) resetReadSeqNo(vb uint16) {
+	delete(c.readSeqNos.vbs, vb)
+	delete(c.readSeqNos.dirty, vb)
+}
+
+func (c *Consumer) flushReadSeqNo(vb uint16) {
+	b := c.readSeqNos
+	if _, ok := b.dirty[vb]; !ok {
+		return
+	}
+
+	p := b.vbs[vb]
+	c.vbProcessingStats.updateVbStat(vb, "last_read_seq_no", p.seqNo)
+	p.events = 0
+	delete(b.dirty, vb)
+}
+
+// flushReadSeqNos writes seqnos pending for all vbs, so that last_read_seq_no is
+// current while the consumer waits on its feed
+func (c *Consumer) flushReadSeqNos() {
+	for vb := range c.readSeqNos.dirty {
+		c.flushReadSeqNo(vb)
+	}
+}
@@ -0,0 +1,77 @@
+package consumer
+
+import (
+	"errors"
+	"sync"
+
+	couchbase "github.com/couchbase/eventing/dcp"
+)
+
+var errVbDcpFeedMissing = errors.New("no dcp feed recorded for vbucket")
+
+// vbDcpFeeds tracks DCP feed on which stream was last requested for each vb. It's
+// guarded by a lock of its own, so that stream requests and close streams made from
+// takeover, giveup and pause paths don't contend on consumer default lock
+type vbDcpFeeds struct {
+	sync.RWMutex
+	feeds map[uint16]*couchbase.DcpFeed
+}
+
+func newVbDcpFeeds() *vbDcpFeeds {
+	return &vbDcpFeeds{
+		feeds: make(map[uint16]*couchbase.DcpFeed),
+	}
+}
+
+func (f *vbDcpFeeds) set(vb uint16, feed *couchbase.DcpFeed) {
+	f.Lock()
+	defer f.Unlock()
+
+	f.feeds[vb] = feed
+}
+
+// get returns feed of a vb. Lock isn't held while caller operates on the feed
+func (f *vbDcpFeeds) get(vb uint16) (*couchbase.DcpFeed, bool) {
+	f.RLock()
+	defer f.RUnlock()
+
+	feed, ok := f.feeds[vb]
+	return feed, ok && feed != nil
+}
+
+// vbStreamRequests tracks vbs with an in-flight stream request along with start
+// seq no requested, so that concurrent stream requests for a vb are collapsed
+type vbStreamRequests struct {
+	sync.Mutex
+	startSeqNos map[uint16]uint64
+}
+
+func newVbStreamRequests() *vbStreamRequests {
+	return &vbStreamRequests{
+		startSeqNos: make(map[uint16]uint64),
+	}
+}
+
+// add records stream request for a vb. Returns false if one is already in-flight
+func (r *vbStreamRequests) add(vb uint16, start uint64) bool {
+	r.Lock()
+	defer r.Unlock()
+
+	if _, ok := r.startSeqNos[vb]; ok {
+		return false
+	}
+	r.startSeqNos[vb] = start
+	return true
+}
+
+// remove purges stream request of a vb. Returns false if none was in-flight
+func (r *vbStreamRequests) remove(vb uint16) bool {
+	r.Lock()
+	defer r.Unlock()
+
+	if _, ok := r.startSeqNos[vb]; !ok {
+		return false
+	}
+	delete(r.startSeqNos, vb)
+	return true
+}
@@ -0,0 +1,39 @@
+package consumer
+
+import (
+	"sync"
+	"time"
+)
+
+// vbTimings tracks start of an in-flight phase per vb, like a stream request awaiting
+// response from KV, so that its duration could be recorded once it's over
+type vbTimings struct {
+	sync.Mutex
+	starts map[uint16]time.Time
+}
+
+func newVbTimings() *vbTimings {
+	return &vbTimings{
+		starts: make(map[uint16]time.Time),
+	}
+}
+
+func (t *vbTimings) start(vb uint16) {
+	t.Lock()
+	defer t.Unlock()
+
+	t.starts[vb] = time.Now()
+}
+
+// stop returns time elapsed since start of the phase. Returns false if none was in-flight
+func (t *vbTimings) stop(vb uint16) (time.Duration, bool) {
+	t.Lock()
+	defer t.Unlock()
+
+	start, ok := t.starts[vb]
+	if !ok {
+		return 0, false
+	}
+	delete(t.starts, vb)
+	return time.Since(start), true
+}
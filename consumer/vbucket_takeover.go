@@ -1,10 +1,12 @@
 package consumer
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/couchbase/eventing/common"
@@ -20,6 +22,7 @@ var (
 	errUnexpectedVbStreamStatus = errors.New("unexpected vbucket stream status")
 	errVbOwnedByAnotherWorker   = errors.New("vbucket is owned by another worker on same node")
 	errVbOwnedByAnotherNode     = errors.New("vbucket is owned by another node")
+	errVbHandoverUnacked        = errors.New("vbucket handover is yet to be acked by current owner")
 )
 
 func (c *Consumer) checkAndUpdateMetadata() {
@@ -34,7 +37,7 @@ func (c *Consumer) checkAndUpdateMetadata() {
 			continue
 		}
 
-		vbKey := fmt.Sprintf("%s::vb::%d", c.app.AppName, vb)
+		vbKey := common.CheckpointBlobKey(c.app.AppName, vb)
 
 		err := util.Retry(util.NewFixedBackoff(bucketOpRetryInterval), c.retryCount, getOpCallback,
 			c, c.producer.AddMetadataPrefix(vbKey), &vbBlob, &cas, false)
@@ -104,6 +107,7 @@ func (c *Consumer) vbsStateUpdate() {
 			c.prevRebalanceInComplete = true
 		}
 		c.vbsStateUpdateRunning = false
+		c.vbsStateUpdateTracker.stop()
 		// confirm rebalance is done
 		c.isRebalanceOngoing = false
 		logging.Infof("%s [%s:%s:%d] Updated vbsStateUpdateRunning to %t, isRebalanceOngoing to %t",
@@ -116,6 +120,7 @@ func (c *Consumer) vbsStateUpdate() {
 	if len(c.vbsRemainingToGiveUp) == 0 && len(c.vbsRemainingToOwn) == 0 {
 		return
 	}
+	c.vbsStateUpdateTracker.start(len(c.vbsRemainingToOwn), len(c.vbsRemainingToGiveUp))
 
 	vbsOwned := c.getCurrentlyOwnedVbs()
 	sort.Sort(util.Uint16Slice(vbsOwned))
@@ -125,18 +130,33 @@ func (c *Consumer) vbsStateUpdate() {
 		util.Condense(c.vbsRemainingToOwn), util.Condense(c.vbsRemainingToGiveUp),
 		len(vbsOwned), util.Condense(vbsOwned))
 
+	// Takeover bails out on rebalance stop or consumer stop. Deadline bounds the overall
+	// time spent owning vbs, as a node that never releases a vb would otherwise keep
+	// takeover retrying forever
+	rebalanceCtx := c.rebalanceContext()
+	ctx := rebalanceCtx
+	if c.vbTakeoverDeadline > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(rebalanceCtx, c.vbTakeoverDeadline)
+		defer cancel()
+	}
+
 retryStreamUpdate:
-	vbsDistribution := util.VbucketDistribution(c.vbsRemainingToOwn, c.vbOwnershipTakeoverRoutineCount)
+	c.vbsStateUpdateTracker.attempt()
+	routineCount := c.getTakeoverRoutineCount(len(c.vbsRemainingToOwn))
+	atomic.StoreUint64(&c.vbTakeoverRoutineCount, uint64(routineCount))
+
+	vbsDistribution := util.VbucketDistribution(c.vbsRemainingToOwn, routineCount)
 
 	for k, v := range vbsDistribution {
-		logging.Tracef("%s [%s:%s:%d] vb takeover routine id: %d, vbs assigned len: %d dump: %v",
+		logging.AppTracef(c.app.AppName, "%s [%s:%s:%d] vb takeover routine id: %d, vbs assigned len: %d dump: %v",
 			logPrefix, c.workerName, c.tcpPort, c.Pid(), k, len(v), util.Condense(v))
 	}
 
 	var wg sync.WaitGroup
-	wg.Add(c.vbOwnershipTakeoverRoutineCount)
+	wg.Add(routineCount)
 
-	for i := 0; i < c.vbOwnershipTakeoverRoutineCount; i++ {
+	for i := 0; i < routineCount; i++ {
 		go func(c *Consumer, i int, vbsRemainingToOwn []uint16, wg *sync.WaitGroup) {
 
 			defer wg.Done()
@@ -148,18 +168,16 @@ retryStreamUpdate:
 				}
 
 				select {
-				case _, ok := <-c.stopVbOwnerTakeoverCh:
-					if ok == false {
-						logging.Infof("%s [%s:takeover_r_%d:%s:%d] Exiting vb ownership takeover routine, next vb: %d",
-							logPrefix, c.workerName, i, c.tcpPort, c.Pid(), vb)
-						return
-					}
+				case <-ctx.Done():
+					logging.Infof("%s [%s:takeover_r_%d:%s:%d] Exiting vb ownership takeover routine, next vb: %d err: %v",
+						logPrefix, c.workerName, i, c.tcpPort, c.Pid(), vb, ctx.Err())
+					return
 				default:
 				}
 
 				c.inflightDcpStreamsRWMutex.RLock()
 				if _, ok := c.inflightDcpStreams[vb]; ok {
-					logging.Tracef("%s [%s:takeover_r_%d:%s:%d] vb: %d skipping vbTakeover as dcp request stream already in flight",
+					logging.AppTracef(c.app.AppName, "%s [%s:takeover_r_%d:%s:%d] vb: %d skipping vbTakeover as dcp request stream already in flight",
 						logPrefix, c.workerName, i, c.tcpPort, c.Pid(), vb)
 					c.inflightDcpStreamsRWMutex.RUnlock()
 					continue
@@ -174,11 +192,22 @@ retryStreamUpdate:
 					continue
 				}
 
-				err := util.Retry(util.NewFixedBackoff(vbTakeoverRetryInterval), c.retryCount, vbTakeoverCallback, c, vb)
+				if !c.producer.AcquireVbTakeoverSlot(ctx.Done()) {
+					logging.Infof("%s [%s:takeover_r_%d:%s:%d] Exiting vb ownership takeover routine while waiting for takeover slot, next vb: %d",
+						logPrefix, c.workerName, i, c.tcpPort, c.Pid(), vb)
+					return
+				}
+
+				takeoverStart := time.Now()
+				err := util.Retry(util.NewFixedBackoff(vbTakeoverRetryInterval), c.retryCount, vbTakeoverCallback, c, ctx, vb)
+				c.producer.ReleaseVbTakeoverSlot()
 				if err == common.ErrRetryTimeout {
 					logging.Errorf("%s [%s:%s:%d] Exiting due to timeout", logPrefix, c.workerName, c.tcpPort, c.Pid())
 					return
 				}
+				c.vbTakeoverTimer.record(time.Since(takeoverStart))
+				c.producer.RecordRebalanceDuration(common.RebalanceVbTakeover, time.Since(takeoverStart))
+				c.vbsStateUpdateTracker.progress()
 			}
 
 		}(c, i, vbsDistribution[i], &wg)
@@ -186,8 +215,6 @@ retryStreamUpdate:
 
 	wg.Wait()
 
-	c.stopVbOwnerTakeoverCh = make(chan struct{})
-
 	c.vbsRemainingToOwn = c.getVbRemainingToOwn()
 	c.vbsRemainingToGiveUp = c.getVbRemainingToGiveUp()
 
@@ -198,18 +225,98 @@ retryStreamUpdate:
 		// Retry logic in-case previous attempt to own/start dcp stream didn't succeed
 		// because some other node has already opened(or hasn't closed) the vb dcp stream
 		if (len(c.vbsRemainingToOwn) > 0 || len(c.vbsRemainingToGiveUp) > 0) && !c.dcpFeedsClosed {
-			time.Sleep(dcpStreamRequestRetryInterval)
-			goto retryStreamUpdate
+			select {
+			case <-time.After(dcpStreamRequestRetryInterval):
+			case <-ctx.Done():
+			}
+
+			switch ctx.Err() {
+			case nil:
+				goto retryStreamUpdate
+			case context.DeadlineExceeded:
+				c.handleVbTakeoverDeadline(rebalanceCtx)
+			default:
+				logging.Infof("%s [%s:%s:%d] Takeover cancelled, vbsRemainingToOwn => %v vbRemainingToGiveUp => %v",
+					logPrefix, c.workerName, c.tcpPort, c.Pid(),
+					util.Condense(c.vbsRemainingToOwn), util.Condense(c.vbsRemainingToGiveUp))
+				return
+			}
 		}
 	}
 
 	c.checkAndUpdateMetadata()
 }
 
-func (c *Consumer) doVbTakeover(vb uint16) error {
+// handleVbTakeoverDeadline escalates vbs that couldn't be owned within the takeover
+// deadline. If force takeover is enabled, vbs assigned to this consumer are owned
+// irrespective of which node metadata claims as current owner, in which case the
+// previous owner, if still streaming, could end up processing same mutations
+func (c *Consumer) handleVbTakeoverDeadline(ctx context.Context) {
+	logPrefix := "Consumer::handleVbTakeoverDeadline"
+
+	atomic.AddUint64(&c.vbTakeoverDeadlineExceeded, 1)
+	logging.Errorf("%s [%s:%s:%d] Takeover deadline: %v exceeded, force takeover: %t vbsRemainingToOwn => %v vbRemainingToGiveUp => %v",
+		logPrefix, c.workerName, c.tcpPort, c.Pid(), c.vbTakeoverDeadline, c.forceVbTakeover,
+		util.Condense(c.vbsRemainingToOwn), util.Condense(c.vbsRemainingToGiveUp))
+
+	if !c.forceVbTakeover {
+		return
+	}
+
+	for _, vb := range c.vbsRemainingToOwn {
+		if ctx.Err() != nil || !c.isRebalanceOngoing || c.dcpFeedsClosed {
+			return
+		}
+
+		if err := c.doForceVbTakeover(ctx, vb); err != nil {
+			logging.Errorf("%s [%s:%s:%d] vb: %d force takeover failed, err: %v",
+				logPrefix, c.workerName, c.tcpPort, c.Pid(), vb, err)
+		}
+	}
+
+	c.vbsRemainingToOwn = c.getVbRemainingToOwn()
+	c.vbsRemainingToGiveUp = c.getVbRemainingToGiveUp()
+}
+
+func (c *Consumer) doForceVbTakeover(ctx context.Context, vb uint16) error {
+	logPrefix := "Consumer::doForceVbTakeover"
+
+	if !c.checkIfCurrentNodeShouldOwnVb(vb) || !c.checkIfCurrentConsumerShouldOwnVb(vb) {
+		return nil
+	}
+
+	c.inflightDcpStreamsRWMutex.RLock()
+	_, inflight := c.inflightDcpStreams[vb]
+	c.inflightDcpStreamsRWMutex.RUnlock()
+	if inflight || c.checkIfAlreadyEnqueued(vb) {
+		return nil
+	}
+
+	var vbBlob vbucketKVBlob
+	var cas gocb.Cas
+	var isNoEnt bool
+
+	vbKey := common.CheckpointBlobKey(c.app.AppName, vb)
+
+	err := util.Retry(util.NewFixedBackoff(bucketOpRetryInterval), c.retryCount, getOpCallback,
+		c, c.producer.AddMetadataPrefix(vbKey), &vbBlob, &cas, true, &isNoEnt, true)
+	if err == common.ErrRetryTimeout {
+		logging.Errorf("%s [%s:%s:%d] Exiting due to timeout", logPrefix, c.workerName, c.tcpPort, c.Pid())
+		return err
+	}
+
+	logging.Warnf("%s [%s:%s:%d] vb: %d forcing takeover, dcp stream status: %s curr owner: %rs worker: %s stream requested by: %rs",
+		logPrefix, c.workerName, c.tcpPort, c.Pid(), vb, vbBlob.DCPStreamStatus,
+		vbBlob.CurrentVBOwner, vbBlob.AssignedWorker, vbBlob.NodeRequestedVbStream)
+
+	atomic.AddUint64(&c.vbForceTakeoverCount, 1)
+	return c.updateVbOwnerAndStartDCPStream(ctx, vbKey, vb, &vbBlob)
+}
+
+func (c *Consumer) doVbTakeover(ctx context.Context, vb uint16) error {
 	logPrefix := "Consumer::doVbTakeover"
 
-	if !c.isRebalanceOngoing {
+	if ctx.Err() != nil || !c.isRebalanceOngoing {
 		logging.Infof("%s [%s:%s:%d] vb: %d Skipping vbTakeover as rebalance has been stopped",
 			logPrefix, c.workerName, c.tcpPort, c.Pid(), vb)
 		c.deleteFromEnqueueMap(vb)
@@ -220,7 +327,7 @@ func (c *Consumer) doVbTakeover(vb uint16) error {
 	var cas gocb.Cas
 	var isNoEnt bool
 
-	vbKey := fmt.Sprintf("%s::vb::%d", c.app.AppName, vb)
+	vbKey := common.CheckpointBlobKey(c.app.AppName, vb)
 
 	err := util.Retry(util.NewFixedBackoff(bucketOpRetryInterval), c.retryCount, getOpCallback,
 		c, c.producer.AddMetadataPrefix(vbKey), &vbBlob, &cas, true, &isNoEnt, true)
@@ -249,20 +356,38 @@ func (c *Consumer) doVbTakeover(vb uint16) error {
 				logging.Infof("%s [%s:%s:%d] vb: %d node: %rs taking ownership. Old node: %rs isn't alive any more as per ns_server vbuuid: %s vblob.uuid: %s",
 					logPrefix, c.workerName, c.tcpPort, c.Pid(), vb, c.HostPortAddr(), vbBlob.CurrentVBOwner,
 					c.NodeUUID(), vbBlob.NodeUUID)
-				return c.updateVbOwnerAndStartDCPStream(vbKey, vb, &vbBlob)
+				return c.updateVbOwnerAndStartDCPStream(ctx, vbKey, vb, &vbBlob)
 			}
 
 			// Case 1b: Invalid worker on another node is owning up vbucket stream
 			if !util.Contains(vbBlob.AssignedWorker, possibleConsumers) {
-				return c.updateVbOwnerAndStartDCPStream(vbKey, vb, &vbBlob)
+				return c.updateVbOwnerAndStartDCPStream(ctx, vbKey, vb, &vbBlob)
 			}
 
 			// Case 1c: Invalid node uuid is marked as owner of the vbucket
 			if !util.Contains(vbBlob.NodeUUID, c.eventingNodeUUIDs) && !util.Contains(vbBlob.NodeUUID, c.ejectNodesUUIDs) {
-				return c.updateVbOwnerAndStartDCPStream(vbKey, vb, &vbBlob)
+				return c.updateVbOwnerAndStartDCPStream(ctx, vbKey, vb, &vbBlob)
 			}
 		}
 
+		// Current owner is lingering on the vb after giving it up. It has stopped processing
+		// mutations beyond handover seq no, so stream is started from there once it's
+		// done processing mutations up to it
+		if c.isVbHandoverOffered(&vbBlob) {
+			if !isVbHandoverAcked(vbBlob.Handover) {
+				logging.Infof("%s [%s:%s:%d] vb: %d handover seq no: %d acked seq no: %d, waiting on node: %rs worker: %s",
+					logPrefix, c.workerName, c.tcpPort, c.Pid(), vb, vbBlob.Handover.SeqNo,
+					vbBlob.Handover.AckedSeqNo, vbBlob.CurrentVBOwner, vbBlob.AssignedWorker)
+				return errVbHandoverUnacked
+			}
+
+			logging.Infof("%s [%s:%s:%d] vb: %d taking over from node: %rs worker: %s at handover seq no: %d",
+				logPrefix, c.workerName, c.tcpPort, c.Pid(), vb, vbBlob.CurrentVBOwner,
+				vbBlob.AssignedWorker, vbBlob.Handover.SeqNo)
+			vbBlob.LastSeqNoProcessed = vbBlob.Handover.SeqNo
+			return c.updateVbOwnerAndStartDCPStream(ctx, vbKey, vb, &vbBlob)
+		}
+
 		if vbBlob.NodeUUID == c.NodeUUID() {
 			// Case 2a: Current consumer has already spawned DCP stream for the vbucket
 			if vbBlob.AssignedWorker == c.ConsumerName() {
@@ -281,7 +406,7 @@ func (c *Consumer) doVbTakeover(vb uint16) error {
 				//         t3 - Eventing rebalance was kicked off and KV rolled back metadata bucket to t1
 				//         This would currently cause rebalance to get stuck
 				//         In this case, it makes sense to revoke ownership metadata of old owners.
-				return c.updateVbOwnerAndStartDCPStream(vbKey, vb, &vbBlob)
+				return c.updateVbOwnerAndStartDCPStream(ctx, vbKey, vb, &vbBlob)
 			}
 
 			// Case 2c: An existing & running consumer on current Eventing node  has owned up the vbucket
@@ -298,7 +423,7 @@ func (c *Consumer) doVbTakeover(vb uint16) error {
 		if vbBlob.DCPStreamRequested {
 			if (vbBlob.NodeUUIDRequestedVbStream == c.NodeUUID() && vbBlob.WorkerRequestedVbStream == c.ConsumerName()) ||
 				(vbBlob.NodeUUIDRequestedVbStream == "" && vbBlob.WorkerRequestedVbStream == "") {
-				return c.updateVbOwnerAndStartDCPStream(vbKey, vb, &vbBlob)
+				return c.updateVbOwnerAndStartDCPStream(ctx, vbKey, vb, &vbBlob)
 			}
 
 			if vbBlob.NodeUUIDRequestedVbStream != c.NodeUUID() &&
@@ -307,7 +432,7 @@ func (c *Consumer) doVbTakeover(vb uint16) error {
 					"Old node: %rs isn't alive any more as per ns_server vbuuid: %s node requested stream uuid: %s",
 					logPrefix, c.workerName, c.tcpPort, c.Pid(), c.HostPortAddr(), vb, vbBlob.NodeRequestedVbStream,
 					c.NodeUUID(), vbBlob.NodeUUIDRequestedVbStream)
-				return c.updateVbOwnerAndStartDCPStream(vbKey, vb, &vbBlob)
+				return c.updateVbOwnerAndStartDCPStream(ctx, vbKey, vb, &vbBlob)
 			}
 
 			logging.Infof("%s [%s:%s:%d] vb: %d. STREAMREQ already issued by hostPort: %s worker: %s uuid: %s",
@@ -319,7 +444,7 @@ func (c *Consumer) doVbTakeover(vb uint16) error {
 		logging.Infof("%s [%s:%s:%d] vb: %d vbblob stream status: %s, starting dcp stream",
 			logPrefix, c.workerName, c.tcpPort, c.Pid(), vb, vbBlob.DCPStreamStatus)
 
-		return c.updateVbOwnerAndStartDCPStream(vbKey, vb, &vbBlob)
+		return c.updateVbOwnerAndStartDCPStream(ctx, vbKey, vb, &vbBlob)
 
 	default:
 		return errUnexpectedVbStreamStatus
@@ -327,17 +452,11 @@ func (c *Consumer) doVbTakeover(vb uint16) error {
 }
 
 func (c *Consumer) checkIfCurrentNodeShouldOwnVb(vb uint16) bool {
-	c.vbEventingNodeAssignRWMutex.RLock()
-	defer c.vbEventingNodeAssignRWMutex.RUnlock()
-
-	return c.vbEventingNodeAssignMap[vb] == c.HostPortAddr()
+	return c.getVbEventingNodeAssignMap()[vb] == c.HostPortAddr()
 }
 
 func (c *Consumer) checkIfCurrentConsumerShouldOwnVb(vb uint16) bool {
-	c.workerVbucketMapRWMutex.Lock()
-	defer c.workerVbucketMapRWMutex.Unlock()
-
-	for _, v := range c.workerVbucketMap[c.workerName] {
+	for _, v := range c.getWorkerVbucketMap()[c.workerName] {
 		if vb == v {
 			return true
 		}
@@ -345,7 +464,7 @@ func (c *Consumer) checkIfCurrentConsumerShouldOwnVb(vb uint16) bool {
 	return false
 }
 
-func (c *Consumer) updateVbOwnerAndStartDCPStream(vbKey string, vb uint16, vbBlob *vbucketKVBlob) error {
+func (c *Consumer) updateVbOwnerAndStartDCPStream(ctx context.Context, vbKey string, vb uint16, vbBlob *vbucketKVBlob) error {
 	logPrefix := "Consumer::updateVbOwnerAndStartDCPStream"
 
 	if c.checkIfVbAlreadyOwnedByCurrConsumer(vb) {
@@ -354,6 +473,16 @@ func (c *Consumer) updateVbOwnerAndStartDCPStream(vbKey string, vb uint16, vbBlo
 		return nil
 	}
 
+	if c.isFenced() {
+		return errConsumerFenced
+	}
+
+	if !c.streamReqTracker.allow(vb) {
+		logging.AppDebugf(c.app.AppName, "%s [%s:%s:%d] vb: %d Deferring stream request as per retry policy",
+			logPrefix, c.workerName, c.tcpPort, c.Pid(), vb)
+		return errStreamReqDeferred
+	}
+
 	if c.checkIfAlreadyEnqueued(vb) {
 		return nil
 	}
@@ -368,11 +497,16 @@ func (c *Consumer) updateVbOwnerAndStartDCPStream(vbKey string, vb uint16, vbBlo
 	logging.Infof("%s [%s:%s:%d] vb: %d Sending streamRequestInfo size: %d",
 		logPrefix, c.workerName, c.tcpPort, c.Pid(), vb, len(c.reqStreamCh))
 
-	c.reqStreamCh <- &streamRequestInfo{
+	select {
+	case c.reqStreamCh <- &streamRequestInfo{
 		vb:          vb,
 		vbBlob:      vbBlob,
 		startSeqNo:  vbBlob.LastSeqNoProcessed,
 		manifestUID: vbBlob.ManifestUID,
+	}:
+	case <-ctx.Done():
+		c.deleteFromEnqueueMap(vb)
+		return ctx.Err()
 	}
 
 	return nil
@@ -409,16 +543,13 @@ func (c *Consumer) updateCheckpoint(vbKey string, vb uint16, vbBlob *vbucketKVBl
 	c.vbProcessingStats.updateVbStat(vb, "dcp_stream_status", vbBlob.DCPStreamStatus)
 	c.vbProcessingStats.updateVbStat(vb, "node_uuid", vbBlob.NodeUUID)
 	c.vbProcessingStats.updateVbStat(vb, "last_processed_seq_no", vbBlob.LastSeqNoProcessed)
-	logging.Tracef("%s [%s:%s:%d] vb: %v Stopped dcp stream, updated checkpoint blob in bucket",
+	logging.AppTracef(c.app.AppName, "%s [%s:%s:%d] vb: %v Stopped dcp stream, updated checkpoint blob in bucket",
 		logPrefix, c.workerName, c.tcpPort, c.Pid(), vb)
 	return nil
 }
 
 func (c *Consumer) checkIfConsumerShouldOwnVb(vb uint16, workerName string) bool {
-	c.workerVbucketMapRWMutex.RLock()
-	defer c.workerVbucketMapRWMutex.RUnlock()
-
-	for _, v := range c.workerVbucketMap[workerName] {
+	for _, v := range c.getWorkerVbucketMap()[workerName] {
 		if vb == v {
 			return true
 		}
@@ -427,10 +558,7 @@ func (c *Consumer) checkIfConsumerShouldOwnVb(vb uint16, workerName string) bool
 }
 
 func (c *Consumer) getConsumerForGivenVbucket(vb uint16) string {
-	c.workerVbucketMapRWMutex.RLock()
-	defer c.workerVbucketMapRWMutex.RUnlock()
-
-	for workerName, vbs := range c.workerVbucketMap {
+	for workerName, vbs := range c.getWorkerVbucketMap() {
 		for _, v := range vbs {
 			if vb == v {
 				return workerName
@@ -460,15 +588,12 @@ func (c *Consumer) checkIfVbAlreadyRequestedByCurrConsumer(vb uint16) bool {
 }
 
 func (c *Consumer) getVbRemainingToOwn() []uint16 {
-	c.vbEventingNodeAssignRWMutex.RLock()
-	defer c.vbEventingNodeAssignRWMutex.RUnlock()
-
 	var vbsRemainingToOwn []uint16
 
-	for vb := range c.vbEventingNodeAssignMap {
+	for vb := range c.getVbEventingNodeAssignMap() {
 		if (c.vbProcessingStats.getVbStat(vb, "node_uuid") != c.NodeUUID() ||
 			c.vbProcessingStats.getVbStat(vb, "assigned_worker") != c.ConsumerName()) &&
-			c.checkIfCurrentConsumerShouldOwnVb(vb) {
+			c.checkIfCurrentConsumerShouldOwnVb(vb) && !c.isVbPaused(vb) {
 
 			vbsRemainingToOwn = append(vbsRemainingToOwn, vb)
 		}
@@ -481,12 +606,9 @@ func (c *Consumer) getVbRemainingToOwn() []uint16 {
 
 // Returns the list of vbs that a given consumer should own as per the producer's plan
 func (c *Consumer) getVbsOwned() []uint16 {
-	c.vbEventingNodeAssignRWMutex.RLock()
-	defer c.vbEventingNodeAssignRWMutex.RUnlock()
-
 	var vbsOwned []uint16
 
-	for vb, v := range c.vbEventingNodeAssignMap {
+	for vb, v := range c.getVbEventingNodeAssignMap() {
 		if v == c.HostPortAddr() && c.checkIfCurrentNodeShouldOwnVb(vb) &&
 			c.checkIfConsumerShouldOwnVb(vb, c.ConsumerName()) {
 
@@ -514,12 +636,9 @@ func (c *Consumer) getVbRemainingToGiveUp() []uint16 {
 }
 
 func (c *Consumer) getVbRemainingToStreamReq() []uint16 {
-	c.vbEventingNodeAssignRWMutex.RLock()
-	defer c.vbEventingNodeAssignRWMutex.RUnlock()
-
 	var vbRemainingToStreamReq []uint16
 
-	for vb := range c.vbEventingNodeAssignMap {
+	for vb := range c.getVbEventingNodeAssignMap() {
 		if (c.vbProcessingStats.getVbStat(vb, "dcp_stream_requested_node_uuid") != c.NodeUUID() ||
 			c.vbProcessingStats.getVbStat(vb, "dcp_stream_requested_worker") != c.ConsumerName()) &&
 			c.checkIfCurrentConsumerShouldOwnVb(vb) {
@@ -574,10 +693,7 @@ func (c *Consumer) verifyVbsCurrentlyOwned(vbsToMigrate []uint16) []uint16 {
 }
 
 func (c *Consumer) vbsToHandle() []uint16 {
-	c.workerVbucketMapRWMutex.RLock()
-	defer c.workerVbucketMapRWMutex.RUnlock()
-
-	return c.workerVbucketMap[c.ConsumerName()]
+	return c.getWorkerVbucketMap()[c.ConsumerName()]
 }
 
 func (c *Consumer) doCleanupForPreviouslyOwnedVbs() error {
@@ -607,7 +723,7 @@ func (c *Consumer) doCleanupForPreviouslyOwnedVbs() error {
 func (c *Consumer) cleanupVbMetadata(vb uint16) error {
 	logPrefix := "Consumer::cleanupVbMetadata"
 
-	vbKey := fmt.Sprintf("%s::vb::%d", c.app.AppName, vb)
+	vbKey := common.CheckpointBlobKey(c.app.AppName, vb)
 
 	var vbBlob vbucketKVBlob
 	var cas gocb.Cas
@@ -644,6 +760,9 @@ func (c *Consumer) CloseAllRunningDcpFeeds() {
 	for _, dcpFeed := range c.kvHostDcpFeedMap {
 		runningDcpFeeds = append(runningDcpFeeds, dcpFeed)
 	}
+	for _, dcpFeed := range c.kvHostBootstrapDcpFeedMap {
+		runningDcpFeeds = append(runningDcpFeeds, dcpFeed)
+	}
 	c.hostDcpFeedRWMutex.RUnlock()
 
 	logging.Infof("%s [%s:%s:%d] Going to close all active dcp feeds. Active feed count: %d",
@@ -671,3 +790,17 @@ func (c *Consumer) CloseAllRunningDcpFeeds() {
 	logging.Infof("%s [%s:%s:%d] Finished reset of vb related stats",
 		logPrefix, c.workerName, c.tcpPort, c.Pid())
 }
+
+func (c *Consumer) getVbEventingNodeAssignMap() map[uint16]string {
+	if vbEventingNodeAssignMap, ok := c.vbEventingNodeAssignMap.Load().(map[uint16]string); ok {
+		return vbEventingNodeAssignMap
+	}
+	return nil
+}
+
+func (c *Consumer) getWorkerVbucketMap() map[string][]uint16 {
+	if workerVbucketMap, ok := c.workerVbucketMap.Load().(map[string][]uint16); ok {
+		return workerVbucketMap
+	}
+	return nil
+}
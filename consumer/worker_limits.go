@@ -0,0 +1,191 @@
+package consumer
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/couchbase/eventing/common"
+	"github.com/couchbase/eventing/logging"
+)
+
+const (
+	workerLimitsCheckInterval = 5 * time.Second
+
+	// Consecutive samples breaching a limit, prior to getting cpp worker respawned.
+	// CPU usage is let to spike for longer, as it doesn't put the node at risk
+	workerRSSBreachSamples = 3
+	workerCPUBreachSamples = 6
+
+	// USER_HZ, which procfs reports CPU time in
+	clockTicksPerSec = 100
+)
+
+// workerUsage tracks resource usage of cpp worker, as sampled from procfs
+type workerUsage struct {
+	sync.RWMutex
+	pid         int
+	rss         uint64 // In bytes
+	cpuPercent  uint64 // In % of a core
+	cpuTicks    uint64
+	sampledAt   time.Time
+	rssBreaches int
+	cpuBreaches int
+}
+
+func newWorkerUsage() *workerUsage {
+	return &workerUsage{}
+}
+
+// readProcUsage returns RSS in bytes and CPU time in clock ticks of a process
+func readProcUsage(pid int) (uint64, uint64, error) {
+	statm, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/statm", pid))
+	if err != nil {
+		return 0, 0, err
+	}
+
+	fields := strings.Fields(string(statm))
+	if len(fields) < 2 {
+		return 0, 0, fmt.Errorf("unexpected statm: %s", string(statm))
+	}
+	pages, err := strconv.ParseUint(fields[1], 10, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	stat, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// Process name could have spaces in it, fields following it start with state
+	pos := strings.LastIndexByte(string(stat), ')')
+	if pos < 0 {
+		return 0, 0, fmt.Errorf("unexpected stat: %s", string(stat))
+	}
+	fields = strings.Fields(string(stat[pos+1:]))
+	if len(fields) < 13 {
+		return 0, 0, fmt.Errorf("unexpected stat: %s", string(stat))
+	}
+	utime, err := strconv.ParseUint(fields[11], 10, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	stime, err := strconv.ParseUint(fields[12], 10, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return pages * uint64(os.Getpagesize()), utime + stime, nil
+}
+
+func (u *workerUsage) sample(pid int) error {
+	rss, cpuTicks, err := readProcUsage(pid)
+	if err != nil {
+		return err
+	}
+
+	u.Lock()
+	defer u.Unlock()
+
+	now := time.Now()
+	if u.pid == pid && cpuTicks >= u.cpuTicks {
+		if elapsed := now.Sub(u.sampledAt).Seconds(); elapsed > 0 {
+			u.cpuPercent = uint64(float64(cpuTicks-u.cpuTicks) * 100 / clockTicksPerSec / elapsed)
+		}
+	} else {
+		u.cpuPercent = 0
+		u.rssBreaches = 0
+		u.cpuBreaches = 0
+	}
+
+	u.pid = pid
+	u.rss = rss
+	u.cpuTicks = cpuTicks
+	u.sampledAt = now
+	return nil
+}
+
+// breached counts consecutive samples beyond the limits. Returns the limit breached
+// for long enough along with reason, if any
+func (u *workerUsage) breached(rssLimit int64, cpuLimit int) (string, string) {
+	u.Lock()
+	defer u.Unlock()
+
+	if rssLimit > 0 && u.rss > uint64(rssLimit) {
+		u.rssBreaches++
+	} else {
+		u.rssBreaches = 0
+	}
+
+	if cpuLimit > 0 && u.cpuPercent > uint64(cpuLimit) {
+		u.cpuBreaches++
+	} else {
+		u.cpuBreaches = 0
+	}
+
+	if u.rssBreaches >= workerRSSBreachSamples {
+		return common.WorkerLimitRSS, fmt.Sprintf("worker rss: %d bytes beyond limit: %d bytes", u.rss, rssLimit)
+	}
+
+	if u.cpuBreaches >= workerCPUBreachSamples {
+		return common.WorkerLimitCPU, fmt.Sprintf("worker cpu usage: %d%% beyond limit: %d%% for %v",
+			u.cpuPercent, cpuLimit, workerLimitsCheckInterval*workerCPUBreachSamples)
+	}
+	return "", ""
+}
+
+func (u *workerUsage) stats() (uint64, uint64) {
+	u.RLock()
+	defer u.RUnlock()
+
+	return u.rss, u.cpuPercent
+}
+
+// enforceWorkerLimits samples resource usage of cpp worker and gets it respawned, if
+// it stays beyond worker_rss_limit or worker_cpu_limit. Limits aren't enforced where
+// procfs isn't available
+func (c *Consumer) enforceWorkerLimits() {
+	logPrefix := "Consumer::enforceWorkerLimits"
+
+	ticker := time.NewTicker(workerLimitsCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			pid := c.Pid()
+			if pid <= 0 || c.workerExited {
+				continue
+			}
+
+			err := c.workerUsage.sample(pid)
+			if err != nil {
+				logging.Infof("%s [%s:%s:%d] Unable to sample worker resource usage, limits won't be enforced, err: %v",
+					logPrefix, c.workerName, c.tcpPort, c.Pid(), err)
+				return
+			}
+
+			limit, reason := c.workerUsage.breached(c.workerRSSLimit, c.workerCPULimit)
+			if limit == "" || c.stoppingConsumer {
+				continue
+			}
+
+			logging.Errorf("%s [%s:%s:%d] Re-spawning worker, %s",
+				logPrefix, c.workerName, c.tcpPort, c.Pid(), reason)
+			c.producer.RecordWorkerLimitBreach(limit)
+			c.stoppingConsumer = true
+			c.respawnWorker(reason)
+			return
+
+		case <-c.ctx.Done():
+			logging.Infof("%s [%s:%s:%d] Exiting worker limits routine",
+				logPrefix, c.workerName, c.tcpPort, c.Pid())
+			return
+		}
+	}
+}
@@ -0,0 +1,238 @@
+package consumer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/couchbase/eventing/common"
+	"github.com/couchbase/eventing/logging"
+)
+
+const (
+	// Version of stats payloads understood by consumer, payloads without version
+	// come from workers predating versioning and are treated as version 0
+	workerStatsVersion = 1
+
+	quarantinedPayloadMaxSize = 1024
+
+	// Consecutive malformed payloads of same kind after which protocol drift
+	// between cpp worker and consumer is suspected
+	statsProtocolDriftThreshold = 5
+)
+
+// statsQuarantine tracks consecutive malformed stats payloads per opcode
+type statsQuarantine struct {
+	sync.Mutex
+	consecutive map[int8]int
+}
+
+type quarantinedPayload struct {
+	Timestamp string `json:"timestamp"`
+	Worker    string `json:"worker"`
+	Opcode    int8   `json:"opcode"`
+	Error     string `json:"error"`
+	Payload   string `json:"payload"`
+	Truncated bool   `json:"truncated"`
+}
+
+func newStatsQuarantine() *statsQuarantine {
+	return &statsQuarantine{
+		consecutive: make(map[int8]int),
+	}
+}
+
+// decodeStatsObject strictly decodes a single JSON object and strips its version field
+func decodeStatsObject(msg string) (map[string]interface{}, error) {
+	decoder := json.NewDecoder(strings.NewReader(msg))
+
+	var stats map[string]interface{}
+	if err := decoder.Decode(&stats); err != nil {
+		return nil, err
+	}
+	if decoder.More() {
+		return nil, fmt.Errorf("trailing data after stats object")
+	}
+	if stats == nil {
+		return nil, fmt.Errorf("stats payload isn't a JSON object")
+	}
+
+	if val, ok := stats["version"]; ok {
+		version, ok := val.(float64)
+		if !ok || version != math.Trunc(version) {
+			return nil, fmt.Errorf("invalid stats version: %v", val)
+		}
+		if err := checkStatsVersion(int(version)); err != nil {
+			return nil, err
+		}
+		delete(stats, "version")
+	}
+
+	return stats, nil
+}
+
+func checkStatsVersion(version int) error {
+	if version < 0 || version > workerStatsVersion {
+		return fmt.Errorf("unsupported stats version: %d, supported up to: %d", version, workerStatsVersion)
+	}
+	return nil
+}
+
+// parseFailureStats expects numeric counters along with timestamp string, as
+// producer aggregates them across consumers by type asserting on those
+func parseFailureStats(msg string) (map[string]interface{}, error) {
+	stats, err := decodeStatsObject(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	for k, v := range stats {
+		if err := checkStatType(k, v); err != nil {
+			return nil, err
+		}
+	}
+	return stats, nil
+}
+
+// parseExecutionStats additionally allows one level of nested counters e.g. curl stats
+func parseExecutionStats(msg string) (map[string]interface{}, error) {
+	stats, err := decodeStatsObject(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	for k, v := range stats {
+		nested, ok := v.(map[string]interface{})
+		if !ok {
+			if err := checkStatType(k, v); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		for nk, nv := range nested {
+			if _, ok := nv.(float64); !ok {
+				return nil, fmt.Errorf("stat %s.%s has unexpected type %T", k, nk, nv)
+			}
+		}
+	}
+	return stats, nil
+}
+
+func checkStatType(key string, val interface{}) error {
+	if key == "timestamp" {
+		if _, ok := val.(string); !ok {
+			return fmt.Errorf("stat %s has unexpected type %T", key, val)
+		}
+		return nil
+	}
+
+	if _, ok := val.(float64); !ok {
+		return fmt.Errorf("stat %s has unexpected type %T", key, val)
+	}
+	return nil
+}
+
+func parseQueueSizes(msg string) (*cppQueueSize, error) {
+	decoder := json.NewDecoder(strings.NewReader(msg))
+	decoder.DisallowUnknownFields()
+
+	var sizes *cppQueueSize
+	if err := decoder.Decode(&sizes); err != nil {
+		return nil, err
+	}
+	if decoder.More() {
+		return nil, fmt.Errorf("trailing data after queue sizes")
+	}
+	if sizes == nil {
+		return nil, fmt.Errorf("queue sizes payload isn't a JSON object")
+	}
+
+	if err := checkStatsVersion(sizes.Version); err != nil {
+		return nil, err
+	}
+
+	if sizes.AggQueueSize < 0 || sizes.AggQueueMemory < 0 || sizes.ProcessedEventsSize < 0 ||
+		sizes.NumProcessedEvents < 0 || sizes.FeedbackQueueSize < 0 {
+		return nil, fmt.Errorf("negative queue sizes")
+	}
+	return sizes, nil
+}
+
+func parseCounterStats(msg string) (common.StatsData, error) {
+	decoder := json.NewDecoder(strings.NewReader(msg))
+
+	var stats common.StatsData
+	if err := decoder.Decode(&stats); err != nil {
+		return nil, err
+	}
+	if decoder.More() {
+		return nil, fmt.Errorf("trailing data after stats object")
+	}
+	if stats == nil {
+		return nil, fmt.Errorf("stats payload isn't a JSON object")
+	}
+	return stats, nil
+}
+
+// quarantineStats drops malformed stats payload, counting it and capturing a
+// truncated copy under diag dir for diagnostics
+func (c *Consumer) quarantineStats(opcode int8, msg string, err error) {
+	logPrefix := "Consumer::quarantineStats"
+
+	atomic.AddUint64(&c.statsQuarantineCounter, 1)
+	c.failureDomains.record(common.FailureDomainWorker, "stats_quarantined", err)
+
+	capture := &quarantinedPayload{
+		Timestamp: time.Now().Format(time.RFC3339Nano),
+		Worker:    c.workerName,
+		Opcode:    opcode,
+		Error:     err.Error(),
+		Payload:   msg,
+	}
+	if len(msg) > quarantinedPayloadMaxSize {
+		capture.Payload = msg[:quarantinedPayloadMaxSize]
+		capture.Truncated = true
+	}
+
+	logging.Errorf("%s [%s:%s:%d] Quarantined stats payload, opcode: %d payload: %rm err: %v",
+		logPrefix, c.workerName, c.tcpPort, c.Pid(), opcode, capture.Payload, err)
+
+	c.statsQuarantine.Lock()
+	c.statsQuarantine.consecutive[opcode]++
+	consecutive := c.statsQuarantine.consecutive[opcode]
+	c.statsQuarantine.Unlock()
+
+	if consecutive == statsProtocolDriftThreshold {
+		logging.Errorf("%s [%s:%s:%d] %d consecutive malformed stats payloads for opcode: %d, possible protocol drift between eventing-consumer and eventing-producer",
+			logPrefix, c.workerName, c.tcpPort, c.Pid(), consecutive, opcode)
+	}
+
+	if c.diagDir == "" || c.shedDiagnostics() {
+		return
+	}
+
+	data, mErr := json.Marshal(capture)
+	if mErr != nil {
+		return
+	}
+
+	path := filepath.Join(c.diagDir, fmt.Sprintf("%s_quarantined_stats.json", c.workerName))
+	if wErr := ioutil.WriteFile(path, data, 0640); wErr != nil {
+		logging.Errorf("%s [%s:%s:%d] Failed to capture quarantined stats payload to: %s, err: %v",
+			logPrefix, c.workerName, c.tcpPort, c.Pid(), path, wErr)
+	}
+}
+
+func (c *Consumer) statsAccepted(opcode int8) {
+	c.statsQuarantine.Lock()
+	defer c.statsQuarantine.Unlock()
+
+	delete(c.statsQuarantine.consecutive, opcode)
+}
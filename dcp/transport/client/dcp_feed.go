@@ -26,6 +26,7 @@ const openConnFlag = uint32(0x1)
 const bufferAckPeriod = 20
 const includeDeleteTime = uint32(0x20)
 const dcpSeqnoAdvExtrasLen = 8
+const snapshotTypeDisk = uint32(0x2)
 
 var TransactionMutationPrefix = []byte("_txn")
 
@@ -62,6 +63,12 @@ type DcpFeed struct {
 	enableReadDeadline int32 // 0 => Read deadline is disabled in doReceive, 1 => enabled
 
 	collectionAware bool // Check if all kv nodes are above version 7
+
+	priority string // DCP connection priority requested from producer, empty => server default
+
+	noopInterval int // In seconds, interval at which producer sends NOOPs on idle connection
+
+	collectionFilter []string // Collection ids in hex streams are restricted to, empty => no filter
 }
 
 // NewDcpFeed creates a new DCP Feed.
@@ -83,6 +90,18 @@ func NewDcpFeed(
 	}
 
 	feed.collectionAware = config["collectionAware"].(bool)
+	if val, ok := config["priority"]; ok && val != nil {
+		feed.priority = val.(string)
+	}
+	feed.noopInterval = 120
+	if val, ok := config["noopInterval"]; ok && val != nil {
+		feed.noopInterval = val.(int)
+	}
+	if val, ok := config["collectionFilter"]; ok && val != nil && feed.collectionAware {
+		for _, cid := range val.([]uint32) {
+			feed.collectionFilter = append(feed.collectionFilter, strconv.FormatUint(uint64(cid), 16))
+		}
+	}
 	mc.Hijack()
 	feed.conn = mc
 	rcvch := make(chan []interface{}, dataChanSize)
@@ -342,6 +361,7 @@ func (feed *DcpFeed) handlePacket(
 	case transport.DCP_MUTATION, transport.DCP_DELETION,
 		transport.DCP_EXPIRATION:
 		event = newDcpEvent(pkt, stream)
+		event.FromDisk = stream.SnapshotType&snapshotTypeDisk != 0
 		stream.Seqno = event.Seqno
 		feed.stats.TotalMutation++
 		sendAck = true
@@ -361,6 +381,7 @@ func (feed *DcpFeed) handlePacket(
 		event.SnapshotType = binary.BigEndian.Uint32(pkt.Extras[16:20])
 		stream.Snapstart = event.SnapstartSeq
 		stream.Snapend = event.SnapendSeq
+		stream.SnapshotType = event.SnapshotType
 		feed.stats.TotalSnapShot++
 		sendAck = true
 		if (stream.Snapend - stream.Snapstart) > 50000 {
@@ -675,7 +696,7 @@ func (feed *DcpFeed) doDcpOpen(
 
 	// send a DCP control message to set_noop_interval
 	if true /*set_noop_interval*/ {
-		if err := feed.doControlRequest(opaque, "set_noop_interval", []byte("120"), rcvch); err != nil {
+		if err := feed.doControlRequest(opaque, "set_noop_interval", []byte(strconv.Itoa(feed.noopInterval)), rcvch); err != nil {
 			return err
 		}
 	}
@@ -692,6 +713,13 @@ func (feed *DcpFeed) doDcpOpen(
 			return err
 		}
 	}
+
+	// send a DCP control message to set priority of this connection
+	if feed.priority != "" {
+		if err := feed.doControlRequest(opaque, "set_priority", []byte(feed.priority), rcvch); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -755,6 +783,7 @@ func (feed *DcpFeed) doDcpRequestStream(
 	requestValue := &StreamRequestValue{}
 	if feed.collectionAware {
 		requestValue.ManifestUID = manifestUID
+		requestValue.CollectionIDs = feed.collectionFilter
 		body, _ := json.Marshal(requestValue)
 		rq.Body = body
 	}
@@ -942,7 +971,8 @@ func vbOpaque(opq32 uint32) uint16 {
 }
 
 type StreamRequestValue struct {
-	ManifestUID string `json:"uid,omitempty"`
+	ManifestUID   string   `json:"uid,omitempty"`
+	CollectionIDs []string `json:"collections,omitempty"`
 }
 
 // DcpStream is per stream data structure over an DCP Connection.
@@ -956,7 +986,8 @@ type DcpStream struct {
 	EndSeq           uint64 // end sequence number
 	Snapstart        uint64
 	Snapend          uint64
-	LastSeen         int64 // UnixNano value of last seen
+	SnapshotType     uint32 // Flags of the current snapshot
+	LastSeen         int64  // UnixNano value of last seen
 	connected        bool
 	collectionsAware bool
 }
@@ -971,6 +1002,9 @@ type DcpEvent struct {
 	VBuuid       uint64                // This field is set by downstream
 	Key, Value   []byte                // Item key/value
 	OldValue     []byte                // TODO: TBD: old document value
+	Xattrs       []byte                // Item xattrs as JSON object, set by downstream
+	Origin       string                // Origin tags stamped by eventing on the item, set by downstream
+	FromDisk     bool                  // Item was read off a disk snapshot, i.e. backfilled
 	Cas          uint64                // CAS value of the item
 	CollectionID uint32                // Collection Id
 	// meta fields
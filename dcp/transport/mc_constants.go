@@ -108,6 +108,7 @@ const (
 	NOT_MY_VBUCKET  = Status(0x07)
 	ERANGE          = Status(0x22)
 	ROLLBACK        = Status(0x23)
+	EACCESS         = Status(0x24)
 	UNKNOWN_COMMAND = Status(0x81)
 	ENOMEM          = Status(0x82)
 	TMPFAIL         = Status(0x86)
@@ -215,6 +216,7 @@ func init() {
 	StatusNames[UNKNOWN_COMMAND] = "UNKNOWN_COMMAND"
 	StatusNames[ERANGE] = "ERANGE"
 	StatusNames[ROLLBACK] = "ROLLBACK"
+	StatusNames[EACCESS] = "EACCESS"
 	StatusNames[ENOMEM] = "ENOMEM"
 	StatusNames[TMPFAIL] = "TMPFAIL"
 
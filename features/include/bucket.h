@@ -99,6 +99,12 @@ public:
   const std::string &ScopeName() const { return scope_name_; };
   const std::string &CollectionName() const { return collection_name_; };
 
+  // Durability requested for writes issued through this bucket, trades write
+  // latency for being able to read own writes from replicas / after failover
+  void SetDurabilityLevel(lcb_DURABILITY_LEVEL level) {
+    durability_level_ = level;
+  }
+
 private:
   Error FormatErrorAndDestroyConn(const std::string &message,
                                   const lcb_STATUS &error) const;
@@ -132,8 +138,11 @@ private:
   size_t scope_length_, collection_length_;
   lcb_INSTANCE *connection_{nullptr};
   bool is_connected_{false};
+  lcb_DURABILITY_LEVEL durability_level_{LCB_DURABILITYLEVEL_NONE};
 };
 
+lcb_DURABILITY_LEVEL DurabilityLevelFromString(const std::string &level);
+
 class BucketBinding {
   friend BucketFactory;
   friend BucketOps;
@@ -142,11 +151,15 @@ public:
   BucketBinding(v8::Isolate *isolate, std::shared_ptr<BucketFactory> factory,
                 const std::string &bucket_name, const std::string &scope_name,
                 const std::string &collection_name, std::string alias,
-                bool block_mutation, bool is_source_bucket)
+                bool block_mutation, bool is_source_bucket,
+                lcb_DURABILITY_LEVEL durability_level =
+                    LCB_DURABILITYLEVEL_NONE)
       : block_mutation_(block_mutation), is_source_bucket_(is_source_bucket),
         bucket_name_(bucket_name), bucket_alias_(std::move(alias)),
         factory_(std::move(factory)),
-        bucket_(isolate, bucket_name, scope_name, collection_name) {}
+        bucket_(isolate, bucket_name, scope_name, collection_name) {
+    bucket_.SetDurabilityLevel(durability_level);
+  }
 
   Error InstallBinding(v8::Isolate *isolate,
                        const v8::Local<v8::Context> &context);
@@ -249,5 +262,7 @@ private:
 // TODO : Must be implemented by the component that wants to use Bucket
 void AddLcbException(const IsolateData *isolate_data, lcb_STATUS error);
 std::string GetFunctionInstanceID(v8::Isolate *isolate);
+std::string GetOriginTag();
+std::string GetOriginStamp(v8::Isolate *isolate);
 
 #endif
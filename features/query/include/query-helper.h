@@ -90,5 +90,6 @@ private:
 } // namespace Query
 
 void AddLcbException(const IsolateData *isolate_data, int code);
+void AddN1qlError(const IsolateData *isolate_data, int code);
 
 #endif
@@ -12,6 +12,7 @@
 #ifndef QUERY_MGR_H
 #define QUERY_MGR_H
 
+#include <chrono>
 #include <libcouchbase/couchbase.h>
 #include <string>
 #include <unordered_map>
@@ -50,5 +51,8 @@ private:
 } // namespace Query
 
 void QueryFunction(const v8::FunctionCallbackInfo<v8::Value> &args);
+void UpdateN1qlLatencyHistogram(
+    v8::Isolate *isolate,
+    const std::chrono::high_resolution_clock::time_point &start);
 
 #endif
@@ -156,6 +156,7 @@ Query::Helper::GetPosParams(const v8::Local<v8::Value> &arg) const {
   auto isolate_data = UnwrapData(isolate_);
   for (const auto &err_code : info.err_codes) {
     AddLcbException(isolate_data, static_cast<int>(err_code));
+    AddN1qlError(isolate_data, static_cast<int>(err_code));
   }
   return {false};
 }
@@ -235,6 +236,7 @@ Query::Helper::GetErrorCodes(const std::string &error) {
 void Query::Helper::AccountLCBError(int err_code) {
   auto isolate_data = UnwrapData(isolate_);
   AddLcbException(isolate_data, err_code);
+  AddN1qlError(isolate_data, err_code);
 }
 
 void Query::Helper::HandleRowError(const Query::Row &row) {
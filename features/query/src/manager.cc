@@ -25,6 +25,8 @@
 #include <nlohmann/json.hpp>
 
 extern std::atomic<int64_t> n1ql_op_exception_count;
+extern std::atomic<int64_t> n1ql_query_counter;
+extern std::atomic<int64_t> n1ql_query_success;
 
 void Query::Manager::ClearQueries() {
   for (auto &iterator : iterators_) {
@@ -74,7 +76,9 @@ void QueryFunction(const v8::FunctionCallbackInfo<v8::Value> &args) {
     return;
   }
 
+  ++n1ql_query_counter;
   auto start_time = GetUnixTime();
+  const auto query_start = std::chrono::high_resolution_clock::now();
   v8::HandleScope handle_scope(isolate);
   const auto max_timeout = UnwrapData(isolate)->op_timeout;
   auto query_mgr = UnwrapData(isolate)->query_mgr;
@@ -162,11 +166,14 @@ void QueryFunction(const v8::FunctionCallbackInfo<v8::Value> &args) {
       continue;
     }
 
+    // Latency is till the first row, rest of the rows are pulled by handler
+    UpdateN1qlLatencyHistogram(isolate, query_start);
     if (first_row.is_error) {
       helper->HandleRowError(first_row);
       return;
     }
 
+    ++n1ql_query_success;
     v8::Locker locker(isolate);
     auto wrapper = new Query::WrapStop(isolate, iterator, it_info.iterable);
     args.GetReturnValue().Set(wrapper->value_.Get(isolate));
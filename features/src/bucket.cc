@@ -10,6 +10,7 @@
 // permissions and limitations under the License.
 
 #include <algorithm>
+#include <chrono>
 #include <memory>
 #include <mutex>
 #include <ostream>
@@ -29,6 +30,65 @@
 std::atomic<int64_t> bucket_op_exception_count = {0};
 std::atomic<int64_t> bucket_op_cachemiss_count = {0};
 std::atomic<int64_t> lcb_retry_failure = {0};
+std::atomic<int64_t> durable_write_counter = {0};
+std::atomic<int64_t> durable_write_latency_us = {0};
+
+lcb_DURABILITY_LEVEL DurabilityLevelFromString(const std::string &level) {
+  if (level == "majority")
+    return LCB_DURABILITYLEVEL_MAJORITY;
+  if (level == "majority_and_persist_active")
+    return LCB_DURABILITYLEVEL_MAJORITY_AND_PERSIST_TO_ACTIVE;
+  if (level == "persist_to_majority")
+    return LCB_DURABILITYLEVEL_PERSIST_TO_MAJORITY;
+  return LCB_DURABILITYLEVEL_NONE;
+}
+
+namespace {
+// Accounts for time spent by writes waiting on durability requirements
+class DurableWriteTimer {
+public:
+  explicit DurableWriteTimer(lcb_DURABILITY_LEVEL level)
+      : enabled_(level != LCB_DURABILITYLEVEL_NONE),
+        start_(std::chrono::steady_clock::now()) {}
+
+  ~DurableWriteTimer() {
+    if (!enabled_) {
+      return;
+    }
+    ++durable_write_counter;
+    durable_write_latency_us +=
+        std::chrono::duration_cast<std::chrono::microseconds>(
+            std::chrono::steady_clock::now() - start_)
+            .count();
+  }
+
+private:
+  bool enabled_;
+  std::chrono::steady_clock::time_point start_;
+};
+
+// Stamps origin tags on the doc, so that functions among them drop the
+// mutation when it comes back over DCP. Returns index of the next spec
+std::size_t AddOriginTagSpec(lcb_SUBDOCSPECS *specs, std::size_t index,
+                             const std::string &origin_path,
+                             const std::string &origin_value) {
+  if (origin_value.empty()) {
+    return index;
+  }
+  lcb_subdocspecs_dict_upsert(
+      specs, index,
+      LCB_SUBDOCSPECS_F_MKINTERMEDIATES | LCB_SUBDOCSPECS_F_XATTRPATH,
+      origin_path.c_str(), origin_path.size(), origin_value.c_str(),
+      origin_value.size());
+  return index + 1;
+}
+
+// Origin tags are a string, hence quoted when set as xattr value
+std::string OriginTagValue(v8::Isolate *isolate) {
+  auto origin_tags = GetOriginStamp(isolate);
+  return origin_tags.empty() ? origin_tags : "\"" + origin_tags + "\"";
+}
+} // namespace
 
 BucketFactory::BucketFactory(v8::Isolate *isolate,
                              const v8::Local<v8::Context> &context)
@@ -321,7 +381,11 @@ Bucket::CounterWithoutXattr(const std::string &key, uint64_t cas,
                            collection_name_.c_str(), collection_length_);
   lcb_cmdsubdoc_key(cmd, key.c_str(), key.length());
   lcb_cmdsubdoc_timeout(cmd, lcb_timeout);
+  if (durability_level_ != LCB_DURABILITYLEVEL_NONE) {
+    lcb_cmdsubdoc_durability(cmd, durability_level_);
+  }
 
+  DurableWriteTimer durable_write_timer(durability_level_);
   auto [err_code, result] = TryLcbCmdWithRefreshConnIfNecessary(
       *cmd, max_retry, max_timeout, LcbSubdocSet);
   lcb_cmdsubdoc_destroy(cmd);
@@ -343,8 +407,11 @@ Bucket::CounterWithXattr(const std::string &key, uint64_t cas, lcb_U32 expiry,
             nullptr, nullptr};
   }
 
+  auto origin_value = OriginTagValue(isolate_);
+  std::string origin_path("_eventing.origin");
+
   lcb_SUBDOCSPECS *specs;
-  lcb_subdocspecs_create(&specs, 4);
+  lcb_subdocspecs_create(&specs, origin_value.empty() ? 4 : 5);
 
   auto function_instance_id = GetFunctionInstanceID(isolate_);
   std::string function_instance_id_path("_eventing.fiid");
@@ -369,7 +436,9 @@ Bucket::CounterWithXattr(const std::string &key, uint64_t cas, lcb_U32 expiry,
       value_crc32_path.c_str(), value_crc32_path.size(),
       value_crc32_macro.c_str(), value_crc32_macro.size());
 
-  lcb_subdocspecs_counter(specs, 3, 0, "count", strlen("count"), delta);
+  auto body_index = AddOriginTagSpec(specs, 3, origin_path, origin_value);
+  lcb_subdocspecs_counter(specs, body_index, 0, "count", strlen("count"),
+                          delta);
 
   const auto max_retry = UnwrapData(isolate_)->lcb_retry_count;
   const auto lcb_timeout = UnwrapData(isolate_)->lcb_timeout;
@@ -386,7 +455,11 @@ Bucket::CounterWithXattr(const std::string &key, uint64_t cas, lcb_U32 expiry,
 
   lcb_cmdsubdoc_key(cmd, key.c_str(), key.length());
   lcb_cmdsubdoc_timeout(cmd, lcb_timeout);
+  if (durability_level_ != LCB_DURABILITYLEVEL_NONE) {
+    lcb_cmdsubdoc_durability(cmd, durability_level_);
+  }
 
+  DurableWriteTimer durable_write_timer(durability_level_);
   auto [err_code, result] = TryLcbCmdWithRefreshConnIfNecessary(
       *cmd, max_retry, max_timeout, LcbSubdocSet);
   lcb_cmdsubdoc_destroy(cmd);
@@ -412,8 +485,11 @@ Bucket::SetWithXattr(const std::string &key, const std::string &value,
   BucketCache::Fetch().Invalidate(
       BucketCache::MakeKey(bucket_name_, scope_name_, collection_name_, key));
 
+  auto origin_value = OriginTagValue(isolate_);
+  std::string origin_path("_eventing.origin");
+
   lcb_SUBDOCSPECS *specs;
-  lcb_subdocspecs_create(&specs, 4);
+  lcb_subdocspecs_create(&specs, origin_value.empty() ? 4 : 5);
   auto function_instance_id = GetFunctionInstanceID(isolate_);
   std::string function_instance_id_path("_eventing.fiid");
   lcb_subdocspecs_dict_upsert(
@@ -437,7 +513,9 @@ Bucket::SetWithXattr(const std::string &key, const std::string &value,
       value_crc32_path.c_str(), value_crc32_path.size(),
       value_crc32_macro.c_str(), value_crc32_macro.size());
 
-  lcb_subdocspecs_replace(specs, 3, 0, "", 0, value.data(), value.size());
+  auto body_index = AddOriginTagSpec(specs, 3, origin_path, origin_value);
+  lcb_subdocspecs_replace(specs, body_index, 0, "", 0, value.data(),
+                          value.size());
 
   const auto max_retry = UnwrapData(isolate_)->lcb_retry_count;
   const auto lcb_timeout = UnwrapData(isolate_)->lcb_timeout;
@@ -453,7 +531,11 @@ Bucket::SetWithXattr(const std::string &key, const std::string &value,
   lcb_cmdsubdoc_key(cmd, key.data(), key.size());
   lcb_cmdsubdoc_store_semantics(cmd, op_type);
   lcb_cmdsubdoc_timeout(cmd, lcb_timeout);
+  if (durability_level_ != LCB_DURABILITYLEVEL_NONE) {
+    lcb_cmdsubdoc_durability(cmd, durability_level_);
+  }
 
+  DurableWriteTimer durable_write_timer(durability_level_);
   auto [err_code, result] = TryLcbCmdWithRefreshConnIfNecessary(
       *cmd, max_retry, max_timeout, LcbSubdocSet);
   lcb_cmdsubdoc_destroy(cmd);
@@ -493,7 +575,11 @@ Bucket::SetWithoutXattr(const std::string &key, const std::string &value,
   lcb_cmdstore_key(cmd, key.data(), key.size());
   lcb_cmdstore_value(cmd, value.data(), value.size());
   lcb_cmdstore_timeout(cmd, lcb_timeout);
+  if (durability_level_ != LCB_DURABILITYLEVEL_NONE) {
+    lcb_cmdstore_durability(cmd, durability_level_);
+  }
 
+  DurableWriteTimer durable_write_timer(durability_level_);
   auto [err_code, result] =
       TryLcbCmdWithRefreshConnIfNecessary(*cmd, max_retry, max_timeout, LcbSet);
   lcb_cmdstore_destroy(cmd);
@@ -516,8 +602,11 @@ Bucket::DeleteWithXattr(const std::string &key, uint64_t cas) {
   BucketCache::Fetch().Invalidate(
       BucketCache::MakeKey(bucket_name_, scope_name_, collection_name_, key));
 
+  auto origin_value = OriginTagValue(isolate_);
+  std::string origin_path("_eventing.origin");
+
   lcb_SUBDOCSPECS *specs;
-  lcb_subdocspecs_create(&specs, 4);
+  lcb_subdocspecs_create(&specs, origin_value.empty() ? 4 : 5);
 
   auto function_instance_id = GetFunctionInstanceID(isolate_);
   std::string function_instance_id_path("_eventing.fiid");
@@ -542,7 +631,8 @@ Bucket::DeleteWithXattr(const std::string &key, uint64_t cas) {
       value_crc32_path.c_str(), value_crc32_path.size(),
       value_crc32_macro.c_str(), value_crc32_macro.size());
 
-  lcb_subdocspecs_remove(specs, 3, 0, "", 0);
+  auto body_index = AddOriginTagSpec(specs, 3, origin_path, origin_value);
+  lcb_subdocspecs_remove(specs, body_index, 0, "", 0);
 
   const auto max_retry = UnwrapData(isolate_)->lcb_retry_count;
   const auto lcb_timeout = UnwrapData(isolate_)->lcb_timeout;
@@ -558,7 +648,11 @@ Bucket::DeleteWithXattr(const std::string &key, uint64_t cas) {
                            collection_name_.c_str(), collection_length_);
   lcb_cmdsubdoc_key(cmd, key.c_str(), key.length());
   lcb_cmdsubdoc_timeout(cmd, lcb_timeout);
+  if (durability_level_ != LCB_DURABILITYLEVEL_NONE) {
+    lcb_cmdsubdoc_durability(cmd, durability_level_);
+  }
 
+  DurableWriteTimer durable_write_timer(durability_level_);
   auto [err_code, result] = TryLcbCmdWithRefreshConnIfNecessary(
       *cmd, max_retry, max_timeout, LcbSubdocDelete);
   lcb_cmdsubdoc_destroy(cmd);
@@ -594,7 +688,11 @@ Bucket::DeleteWithoutXattr(const std::string &key, uint64_t cas) {
 
   lcb_cmdremove_key(cmd, key.c_str(), key.length());
   lcb_cmdremove_timeout(cmd, lcb_timeout);
+  if (durability_level_ != LCB_DURABILITYLEVEL_NONE) {
+    lcb_cmdremove_durability(cmd, durability_level_);
+  }
 
+  DurableWriteTimer durable_write_timer(durability_level_);
   auto [err_code, result] = TryLcbCmdWithRefreshConnIfNecessary(
       *cmd, max_retry, max_timeout, LcbDelete);
   lcb_cmdremove_destroy(cmd);
@@ -876,7 +974,9 @@ void BucketBinding::BucketDelete<uint32_t>(
 std::tuple<Error, std::unique_ptr<lcb_STATUS>, std::unique_ptr<Result>>
 BucketBinding::BucketSet(const std::string &key, const std::string &value,
                          bool is_source_bucket, Bucket *bucket) {
-  if (is_source_bucket) {
+  // Writes to other keyspaces are stamped too, origin tags are what breaks
+  // cycles running through other functions
+  if (is_source_bucket || !GetOriginTag().empty()) {
     return bucket->SetWithXattr(key, value);
   }
   return bucket->SetWithoutXattr(key, value);
@@ -885,7 +985,7 @@ BucketBinding::BucketSet(const std::string &key, const std::string &value,
 std::tuple<Error, std::unique_ptr<lcb_STATUS>, std::unique_ptr<Result>>
 BucketBinding::BucketDelete(const std::string &key, bool is_source_bucket,
                             Bucket *bucket) {
-  if (is_source_bucket) {
+  if (is_source_bucket || !GetOriginTag().empty()) {
     return bucket->DeleteWithXattr(key);
   }
   return bucket->DeleteWithoutXattr(key);
@@ -393,7 +393,7 @@ Info BucketOps::VerifyBucketObject(v8::Local<v8::Value> bucket_binding) {
 std::tuple<Error, std::unique_ptr<lcb_STATUS>, std::unique_ptr<Result>>
 BucketOps::Delete(const std::string &key, uint64_t cas, bool is_source_bucket,
                   Bucket *bucket) {
-  if (is_source_bucket) {
+  if (is_source_bucket || !GetOriginTag().empty()) {
     return bucket->DeleteWithXattr(key, cas);
   }
   return bucket->DeleteWithoutXattr(key, cas);
@@ -402,7 +402,7 @@ BucketOps::Delete(const std::string &key, uint64_t cas, bool is_source_bucket,
 std::tuple<Error, std::unique_ptr<lcb_STATUS>, std::unique_ptr<Result>>
 BucketOps::Counter(const std::string &key, uint64_t cas, lcb_U32 expiry,
                    int64_t delta, bool is_source_bucket, Bucket *bucket) {
-  if (is_source_bucket) {
+  if (is_source_bucket || !GetOriginTag().empty()) {
     return bucket->CounterWithXattr(key, cas, expiry, delta);
   }
   return bucket->CounterWithoutXattr(key, cas, expiry, delta);
@@ -412,7 +412,7 @@ std::tuple<Error, std::unique_ptr<lcb_STATUS>, std::unique_ptr<Result>>
 BucketOps::Set(const std::string &key, const std::string &value,
                lcb_STORE_OPERATION op_type, lcb_U32 expiry, uint64_t cas,
                lcb_U32 doc_type, bool is_source_bucket, Bucket *bucket) {
-  if (is_source_bucket) {
+  if (is_source_bucket || !GetOriginTag().empty()) {
     lcb_SUBDOC_STORE_SEMANTICS cmd_flag = LCB_SUBDOC_STORE_REPLACE;
     if (op_type == LCB_STORE_UPSERT) {
       cmd_flag = LCB_SUBDOC_STORE_UPSERT;
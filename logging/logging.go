@@ -6,6 +6,7 @@ import "strings"
 import "time"
 import "bytes"
 import "runtime/debug"
+import "sync"
 import l "log"
 
 type LogLevel int
@@ -105,12 +106,16 @@ func init() {
 
 func printf(at LogLevel, format string, v ...interface{}) {
 	if baselevel >= at {
-		format := RedactFormat(format)
-		ts := time.Now().Format("2006-01-02T15:04:05.000-07:00")
-		msg := fmt.Sprintf(ts+" ["+at.String()+"] "+format, v...)
-		if !strings.Contains(msg, "[gocb] Threshold Log:") { // sigh
-			target.Print(msg)
-		}
+		emit(at, format, v...)
+	}
+}
+
+func emit(at LogLevel, format string, v ...interface{}) {
+	format = RedactFormat(format)
+	ts := time.Now().Format("2006-01-02T15:04:05.000-07:00")
+	msg := fmt.Sprintf(ts+" ["+at.String()+"] "+format, v...)
+	if !strings.Contains(msg, "[gocb] Threshold Log:") { // sigh
+		target.Print(msg)
 	}
 }
 
@@ -161,6 +166,54 @@ func SetLogLevel(to LogLevel) {
 	baselevel = to
 }
 
+// per app log level overrides, applied to App* variants
+var appLevelsMutex sync.RWMutex
+var appLevels = make(map[string]LogLevel)
+
+func SetAppLogLevel(appName string, to LogLevel) {
+	appLevelsMutex.Lock()
+	defer appLevelsMutex.Unlock()
+	appLevels[appName] = to
+}
+
+func ClearAppLogLevel(appName string) {
+	appLevelsMutex.Lock()
+	defer appLevelsMutex.Unlock()
+	delete(appLevels, appName)
+}
+
+// AppLogLevel returns log level override of the app, falls back to base log level
+func AppLogLevel(appName string) LogLevel {
+	appLevelsMutex.RLock()
+	defer appLevelsMutex.RUnlock()
+	if level, ok := appLevels[appName]; ok {
+		return level
+	}
+	return baselevel
+}
+
+func IsAppEnabled(appName string, at LogLevel) bool {
+	return AppLogLevel(appName) >= at
+}
+
+func appPrintf(appName string, at LogLevel, format string, v ...interface{}) {
+	if IsAppEnabled(appName, at) {
+		emit(at, format, v...)
+	}
+}
+
+func AppVerbosef(appName string, format string, v ...interface{}) {
+	appPrintf(appName, Verbose, format, v...)
+}
+
+func AppDebugf(appName string, format string, v ...interface{}) {
+	appPrintf(appName, Debug, format, v...)
+}
+
+func AppTracef(appName string, format string, v ...interface{}) {
+	appPrintf(appName, Trace, format, v...)
+}
+
 func StackTrace() string {
 	var buf bytes.Buffer
 	lines := strings.Split(string(debug.Stack()), "\n")
@@ -45,6 +45,9 @@ var function_name = regexp.MustCompile(
 var requiredFunctions = map[string]struct{}{"OnUpdate": struct{}{},
 	"OnDelete": struct{}{}}
 
+var n1qlUse = regexp.MustCompile(
+	`N1QL([[:space:]]*)\(`)
+
 var n1qlQueryUse = regexp.MustCompile(
 	`N1qlQuery([[:space:]]*)\(`)
 
@@ -335,6 +338,12 @@ func UsingTimer(input string) bool {
 	return timer_use.MatchString(bare)
 }
 
+// UsingN1QL returns true if handler issues queries, either inline or by calling N1QL()
+func UsingN1QL(input string) bool {
+	bare := stripAll(input)
+	return n1qlUse.MatchString(bare) || len(findQueries(input)) != 0
+}
+
 func ListDeprecatedFunctions(input string) []string {
 	bare := stripAll(input)
 	listOfFns := []string{}
@@ -13,7 +13,7 @@ import (
 	"github.com/couchbase/gocbcore/v9"
 )
 
-var getFailoverLogOpCallback = func(args ...interface{}) error {
+var getFailoverLogOpCallback = util.InstrumentOp("producer.get_failover_log_op", func(args ...interface{}) error {
 	logPrefix := "Producer::getFailoverLogOpCallback"
 
 	p := args[0].(*Producer)
@@ -29,9 +29,9 @@ var getFailoverLogOpCallback = func(args ...interface{}) error {
 	}
 
 	return err
-}
+})
 
-var cleanupMetadataCallback = func(args ...interface{}) error {
+var cleanupMetadataCallback = util.InstrumentOp("producer.cleanup_metadata", func(args ...interface{}) error {
 	logPrefix := "Producer::cleanupMetadataCallback"
 
 	p := args[0].(*Producer)
@@ -57,9 +57,9 @@ var cleanupMetadataCallback = func(args ...interface{}) error {
 	}
 
 	return err
-}
+})
 
-var dcpGetSeqNosCallback = func(args ...interface{}) error {
+var dcpGetSeqNosCallback = util.InstrumentOp("producer.dcp_get_seq_nos", func(args ...interface{}) error {
 	logPrefix := "Producer::dcpGetSeqNosCallback"
 
 	p := args[0].(*Producer)
@@ -74,9 +74,9 @@ var dcpGetSeqNosCallback = func(args ...interface{}) error {
 	}
 
 	return err
-}
+})
 
-var clearDebuggerInstanceCallback = func(args ...interface{}) error {
+var clearDebuggerInstanceCallback = util.InstrumentOp("producer.clear_debugger_instance", func(args ...interface{}) error {
 	logPrefix := "Producer::clearDebuggerInstanceCallback"
 
 	p := args[0].(*Producer)
@@ -93,6 +93,7 @@ var clearDebuggerInstanceCallback = func(args ...interface{}) error {
 
 	key := p.AddMetadataPrefix(p.app.AppName).Raw() + "::" + common.DebuggerTokenKey
 	var instance common.DebuggerInstance
+	p.metaLatency.inject()
 	result, err := p.metadataHandle.Get(key, nil)
 	if errors.Is(err, gocb.ErrDocumentNotFound) || errors.Is(err, gocbcore.ErrShutdown) || errors.Is(err, gocbcore.ErrCollectionsUnsupported) {
 		logging.Errorf("%s [%s:%d] Abnormal case - debugger instance blob is absent or bucket is closed",
@@ -108,6 +109,7 @@ var clearDebuggerInstanceCallback = func(args ...interface{}) error {
 	instance = common.DebuggerInstance{}
 	replaceOptions := &gocb.ReplaceOptions{Cas: result.Result.Cas(),
 		Expiry: 0}
+	p.metaLatency.inject()
 	_, err = p.metadataHandle.Replace(key, instance, replaceOptions)
 	if err != nil {
 		logging.Errorf("%s [%s:%d] Unable to clear debugger instance, err: %v",
@@ -115,9 +117,9 @@ var clearDebuggerInstanceCallback = func(args ...interface{}) error {
 		return err
 	}
 	return err
-}
+})
 
-var writeDebuggerURLCallback = func(args ...interface{}) error {
+var writeDebuggerURLCallback = util.InstrumentOp("producer.write_debugger_url", func(args ...interface{}) error {
 	logPrefix := "Producer::writeDebuggerURLCallback"
 
 	p := args[0].(*Producer)
@@ -135,6 +137,7 @@ var writeDebuggerURLCallback = func(args ...interface{}) error {
 
 	key := p.AddMetadataPrefix(p.app.AppName).Raw() + "::" + common.DebuggerTokenKey
 	var instance common.DebuggerInstance
+	p.metaLatency.inject()
 	result, err := p.metadataHandle.Get(key, nil)
 	if errors.Is(err, gocb.ErrDocumentNotFound) || errors.Is(err, gocbcore.ErrShutdown) || errors.Is(err, gocbcore.ErrCollectionsUnsupported) {
 		logging.Errorf("%s [%s:%d] Abnormal case - debugger instance blob is absent or bucket is closed",
@@ -147,9 +150,18 @@ var writeDebuggerURLCallback = func(args ...interface{}) error {
 		return err
 	}
 
+	// Token, host and status are retained, those route callers to the trapping worker
+	err = result.Content(&instance)
+	if err != nil {
+		logging.Errorf("%s [%s:%d] Unable to decode debugger instance blob, err: %v",
+			logPrefix, p.appName, p.LenRunningConsumers(), err)
+		return err
+	}
+
 	instance.URL = url
 	replaceOptions := &gocb.ReplaceOptions{Cas: result.Result.Cas(),
 		Expiry: 0}
+	p.metaLatency.inject()
 	_, err = p.metadataHandle.Replace(key, instance, replaceOptions)
 	if err != nil {
 		logging.Errorf("%s [%s:%d] Unable to write debugger URL, err: %v",
@@ -157,9 +169,9 @@ var writeDebuggerURLCallback = func(args ...interface{}) error {
 		return err
 	}
 	return err
-}
+})
 
-var setOpCallback = func(args ...interface{}) error {
+var setOpCallback = util.InstrumentOp("producer.set_op", func(args ...interface{}) error {
 	logPrefix := "Producer::setOpCallback"
 
 	p := args[0].(*Producer)
@@ -178,6 +190,7 @@ var setOpCallback = func(args ...interface{}) error {
 		return nil
 	}
 
+	p.metaLatency.inject()
 	_, err := p.metadataHandle.Upsert(key.Raw(), blob, nil)
 	if errors.Is(err, gocbcore.ErrShutdown) || errors.Is(err, gocbcore.ErrCollectionsUnsupported) {
 		return nil
@@ -188,7 +201,7 @@ var setOpCallback = func(args ...interface{}) error {
 			logPrefix, p.appName, p.LenRunningConsumers(), key.Raw(), err)
 	}
 	return err
-}
+})
 
 var openDcpStreamFromZero = func(args ...interface{}) error {
 	logPrefix := "Producer::openDcpStreamFromZero"
@@ -216,7 +229,7 @@ var openDcpStreamFromZero = func(args ...interface{}) error {
 	return err
 }
 
-var getOpCallback = func(args ...interface{}) error {
+var getOpCallback = util.InstrumentOp("producer.get_op", func(args ...interface{}) error {
 	logPrefix := "Producer::getOpCallback"
 
 	p := args[0].(*Producer)
@@ -225,6 +238,7 @@ var getOpCallback = func(args ...interface{}) error {
 
 	p.metadataHandleMutex.RLock()
 	defer p.metadataHandleMutex.RUnlock()
+	p.metaLatency.inject()
 	result, err := p.metadataHandle.Get(key.Raw(), nil)
 	if errors.Is(err, gocb.ErrDocumentNotFound) || errors.Is(err, gocbcore.ErrShutdown) || errors.Is(err, gocbcore.ErrCollectionsUnsupported) {
 		return nil
@@ -237,15 +251,16 @@ var getOpCallback = func(args ...interface{}) error {
 
 	err = result.Content(&blob)
 	return err
-}
+})
 
-var deleteOpCallback = func(args ...interface{}) error {
+var deleteOpCallback = util.InstrumentOp("producer.delete_op", func(args ...interface{}) error {
 	logPrefix := "Producer::deleteOpCallback"
 	p := args[0].(*Producer)
 	key := args[1].(string)
 
 	p.metadataHandleMutex.RLock()
 	defer p.metadataHandleMutex.RUnlock()
+	p.metaLatency.inject()
 	_, err := p.metadataHandle.Remove(key, nil)
 	if errors.Is(err, gocb.ErrDocumentNotFound) || errors.Is(err, gocbcore.ErrShutdown) || errors.Is(err, gocbcore.ErrCollectionsUnsupported) {
 		return nil
@@ -267,7 +282,7 @@ var deleteOpCallback = func(args ...interface{}) error {
 		}
 	}
 	return err
-}
+})
 
 var checkIfQueuesAreDrained = func(args ...interface{}) error {
 	p := args[0].(*Producer)
@@ -13,7 +13,7 @@ import (
 	"github.com/couchbase/eventing/util"
 )
 
-var getClusterInfoCacheOpCallback = func(args ...interface{}) error {
+var getClusterInfoCacheOpCallback = util.InstrumentOp("producer.get_cluster_info_cache_op", func(args ...interface{}) error {
 	logPrefix := "Producer::getClusterInfoCacheOpCallback"
 
 	p := args[0].(*Producer)
@@ -29,9 +29,9 @@ var getClusterInfoCacheOpCallback = func(args ...interface{}) error {
 	}
 
 	return err
-}
+})
 
-var getNsServerNodesAddressesOpCallback = func(args ...interface{}) error {
+var getNsServerNodesAddressesOpCallback = util.InstrumentOp("producer.get_ns_server_nodes_addresses_op", func(args ...interface{}) error {
 	logPrefix := "Producer::getNsServerNodesAddressesOpCallback"
 
 	p := args[0].(*Producer)
@@ -48,9 +48,9 @@ var getNsServerNodesAddressesOpCallback = func(args ...interface{}) error {
 	}
 
 	return err
-}
+})
 
-var getKVNodesAddressesOpCallback = func(args ...interface{}) error {
+var getKVNodesAddressesOpCallback = util.InstrumentOp("producer.get_kv_nodes_addresses_op", func(args ...interface{}) error {
 	logPrefix := "Producer::getKVNodesAddressesOpCallback"
 
 	p := args[0].(*Producer)
@@ -75,9 +75,9 @@ var getKVNodesAddressesOpCallback = func(args ...interface{}) error {
 	}
 
 	return err
-}
+})
 
-var getEventingNodesAddressesOpCallback = func(args ...interface{}) error {
+var getEventingNodesAddressesOpCallback = util.InstrumentOp("producer.get_eventing_nodes_addresses_op", func(args ...interface{}) error {
 	logPrefix := "Producer::getEventingNodesAddressesOpCallback"
 
 	p := args[0].(*Producer)
@@ -98,7 +98,7 @@ var getEventingNodesAddressesOpCallback = func(args ...interface{}) error {
 		return nil
 	}
 
-}
+})
 
 var getHTTPServiceAuth = func(args ...interface{}) error {
 	logPrefix := "Producer::getHTTPServiceAuth"
@@ -116,7 +116,7 @@ var getHTTPServiceAuth = func(args ...interface{}) error {
 	return err
 }
 
-var metakvGetCallback = func(args ...interface{}) error {
+var metakvGetCallback = util.InstrumentOp("producer.metakv_get", func(args ...interface{}) error {
 	logPrefix := "Producer::metakvGetCallback"
 
 	p := args[0].(*Producer)
@@ -135,9 +135,24 @@ var metakvGetCallback = func(args ...interface{}) error {
 	}
 
 	return nil
-}
+})
+
+var getVbPlanCallback = util.InstrumentOp("producer.get_vb_plan", func(args ...interface{}) error {
+	logPrefix := "Producer::getVbPlanCallback"
+
+	p := args[0].(*Producer)
+	vbPlan := args[1].(*[]string)
 
-var metakvAppCallback = func(args ...interface{}) error {
+	var err error
+	*vbPlan, err = p.getVbPlan()
+	if err != nil {
+		logging.Errorf("%s [%s:%d] Failed to read previous vbucket plan, err: %v",
+			logPrefix, p.appName, p.LenRunningConsumers(), err)
+	}
+	return err
+})
+
+var metakvAppCallback = util.InstrumentOp("producer.metakv_app", func(args ...interface{}) error {
 	logPrefix := "Producer::metakvAppCallback"
 
 	p := args[0].(*Producer)
@@ -157,4 +172,4 @@ var metakvAppCallback = func(args ...interface{}) error {
 		return fmt.Errorf("Empty value from metakv lookup")
 	}
 	return nil
-}
+})
@@ -0,0 +1,102 @@
+package producer
+
+import (
+	"time"
+
+	"github.com/couchbase/eventing/common"
+	"github.com/couchbase/eventing/logging"
+	"github.com/couchbase/eventing/util"
+)
+
+const (
+	// Interval at which debugger instance blob is polled to learn if a worker on any
+	// eventing node has trapped a mutation for the session
+	debuggerTrapPollInterval = time.Second
+)
+
+// WaitForDebuggerURL waits till a worker on any eventing node traps a mutation for the
+// debug session and returns the DevTools URL it serves the session on, so that callers
+// needn't know which node would trap
+func (p *Producer) WaitForDebuggerURL(token string, timeout time.Duration) (string, error) {
+	deadline := time.Now().Add(timeout)
+
+	for {
+		instance, err := p.getDebuggerInstance()
+		if err != nil {
+			return "", err
+		}
+
+		if instance.Token != token {
+			return "", common.ErrDebuggerSessionEnded
+		}
+
+		if instance.Status == common.MutationTrapped && instance.URL != "" {
+			return instance.URL, nil
+		}
+
+		if time.Now().After(deadline) {
+			return "", common.ErrDebuggerTrapTimeout
+		}
+
+		select {
+		case <-time.After(debuggerTrapPollInterval):
+		case <-p.ctx.Done():
+			return "", common.ErrDebuggerSessionEnded
+		}
+	}
+}
+
+// watchDebuggerTrap tears down the trap on this node once a worker on some node traps
+// a mutation for the session or the session is stopped, so that consumers stop
+// competing for debugger token with every mutation
+func (p *Producer) watchDebuggerTrap(token string) {
+	logPrefix := "Producer::watchDebuggerTrap"
+
+	ticker := time.NewTicker(debuggerTrapPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if !p.IsTrapEvent() || p.GetDebuggerToken() != token {
+				return
+			}
+
+			instance, err := p.getDebuggerInstance()
+			if err != nil {
+				continue
+			}
+
+			switch {
+			case instance.Token == "":
+				logging.Infof("%s [%s:%d] Debugger session stopped, tearing down trap",
+					logPrefix, p.appName, p.LenRunningConsumers())
+
+			case instance.Token != token:
+				// Superseded by another session, which sets up trap of its own
+				return
+
+			case instance.Status == common.MutationTrapped:
+				logging.Infof("%s [%s:%d] Mutation trapped by worker on host: %rs, tearing down trap",
+					logPrefix, p.appName, p.LenRunningConsumers(), instance.Host)
+
+			default:
+				continue
+			}
+
+			p.SetTrapEvent(false)
+			return
+
+		case <-p.ctx.Done():
+			return
+		}
+	}
+}
+
+func (p *Producer) getDebuggerInstance() (common.DebuggerInstance, error) {
+	var instance common.DebuggerInstance
+	key := p.AddMetadataPrefix(p.app.AppName + "::" + common.DebuggerTokenKey)
+	err := util.Retry(util.NewFixedBackoff(bucketOpRetryInterval), &p.retryCount,
+		getOpCallback, p, key, &instance)
+	return instance, err
+}
@@ -0,0 +1,111 @@
+package producer
+
+import (
+	"sync"
+	"time"
+
+	"github.com/couchbase/eventing/common"
+	"github.com/couchbase/eventing/logging"
+)
+
+// debuggerSessionManager stops the debug session of function once its TTL lapses,
+// so that a forgotten session doesn't keep production traffic trapped on a worker.
+// Session itself lives in debugger instance blob, hence there's at most one per
+// function across the cluster
+type debuggerSessionManager struct {
+	sync.Mutex
+	token  string
+	expiry *time.Timer
+}
+
+func newDebuggerSessionManager() *debuggerSessionManager {
+	return &debuggerSessionManager{}
+}
+
+// armDebuggerSessionExpiry schedules session to be stopped at its expiry, replacing
+// expiry of any session it superseded
+func (p *Producer) armDebuggerSessionExpiry(instance common.DebuggerInstance) {
+	logPrefix := "Producer::armDebuggerSessionExpiry"
+
+	m := p.debuggerSessions
+	m.Lock()
+	defer m.Unlock()
+
+	if m.expiry != nil {
+		m.expiry.Stop()
+		m.expiry = nil
+	}
+
+	m.token = instance.Token
+	if instance.ExpiresAt.IsZero() {
+		return
+	}
+
+	token := instance.Token
+	m.expiry = time.AfterFunc(time.Until(instance.ExpiresAt), func() {
+		p.expireDebuggerSession(token)
+	})
+
+	logging.Infof("%s [%s:%d] Debugger session expires at: %v",
+		logPrefix, p.appName, p.LenRunningConsumers(), instance.ExpiresAt)
+}
+
+// disarmDebuggerSessionExpiry is called once session is stopped
+func (p *Producer) disarmDebuggerSessionExpiry() {
+	m := p.debuggerSessions
+	m.Lock()
+	defer m.Unlock()
+
+	if m.expiry != nil {
+		m.expiry.Stop()
+		m.expiry = nil
+	}
+	m.token = ""
+}
+
+// expireDebuggerSession stops session if it's still the live one. Node hosting the
+// trapping worker stops it, every node does so if no mutation got trapped yet
+func (p *Producer) expireDebuggerSession(token string) {
+	logPrefix := "Producer::expireDebuggerSession"
+
+	p.debuggerSessions.Lock()
+	live := p.debuggerSessions.token == token
+	p.debuggerSessions.Unlock()
+	if !live {
+		return
+	}
+
+	instance, err := p.getDebuggerInstance()
+	if err != nil || instance.Token != token {
+		return
+	}
+
+	consumers := p.getConsumers()
+	if instance.Host != "" && (len(consumers) == 0 || consumers[0].HostPortAddr() != instance.Host) {
+		return
+	}
+
+	logging.Infof("%s [%s:%d] Debugger session started at: %v expired, stopping it",
+		logPrefix, p.appName, p.LenRunningConsumers(), instance.StartedAt)
+	p.SignalStopDebugger()
+}
+
+// GetDebuggerSession returns debug session of function, nil if there's none
+func (p *Producer) GetDebuggerSession() (*common.DebuggerSession, error) {
+	instance, err := p.getDebuggerInstance()
+	if err != nil {
+		return nil, err
+	}
+
+	if instance.Token == "" {
+		return nil, nil
+	}
+
+	return &common.DebuggerSession{
+		AppName:   p.appName,
+		Host:      instance.Host,
+		Status:    instance.Status,
+		StartedAt: instance.StartedAt,
+		ExpiresAt: instance.ExpiresAt,
+	}, nil
+}
@@ -1,8 +1,10 @@
 package producer
 
 import (
+	"context"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/couchbase/eventing/common"
@@ -29,6 +31,12 @@ const (
 
 	supervisorTimeout = 60 * time.Second
 
+	// Number of DCP feed connection events reported for an app across all its consumers
+	dcpFeedEventsToRetain = 100
+
+	// Number of recent failures reported per failure domain for an app across all its consumers
+	failureSamplesToRetain = 20
+
 	// KV blob suffixes to assist in choose right consumer instance
 	// for instantiating V8 Debugger instance
 	startDebuggerFlag    = "startDebugger"
@@ -65,6 +73,7 @@ type Producer struct {
 	isRebalanceOngoing     int32
 	isSrcMutation          bool
 	isUsingTimer           bool
+	isUsingN1ql            bool
 	firstRebalanceDone     bool
 	kvPort                 string
 	kvHostPorts            []string
@@ -79,18 +88,53 @@ type Producer struct {
 	stateChangeCh          chan state
 	undeployHandler        chan bool
 	retryCount             int64
-	stopCh                 chan struct{}
 	stopUndeployWaitCh     chan struct{}
-	stopChClosed           bool
 	stopProducerCh         chan struct{}
 	superSup               common.EventingSuperSup
 	trapEvent              bool
 	debuggerToken          string
+	debuggerSessions       *debuggerSessionManager
+	hotSwapMutex           *sync.Mutex
+	hotSwapRevision        float64 // hot_swap_revision of settings whose code consumers run
+	busEventCounter        uint64  // Picks consumer that runs OnEvent for the next bus event
 	uuid                   string
 	workerSpawnCounter     uint64
 
+	// Respawns of cpp workers owing to breach of resource limits, survive consumers
+	workerRSSLimitBreached uint64
+	workerCPULimitBreached uint64
+
+	// Backs off restarts of cpp workers which crash in quick succession
+	workerRestarts *workerRestartTracker
+
+	// Distribution of durations per rebalance phase, read-only map once created
+	rebalanceHistograms map[string]*util.Histogram
+
+	liveness *consumerLiveness
+
+	// Caps rate at which consumers pull DCP events, as per dcp_throughput_quota
+	dcpQuota *throughputQuota
+
+	// Delays metadata bucket ops, as per metadata_latency_inject_percent
+	metaLatency *latencyInjector
+
+	// Cancelled on producer stop or pause. Consumers derive their context from it
+	ctx       context.Context
+	cancelCtx context.CancelFunc
+
 	latencyStats     *util.Stats
 	curlLatencyStats *util.Stats
+	n1qlLatencyStats *util.Stats
+
+	// Fences function on this node on sustained metadata write failures
+	metadataFence *metadataFence
+
+	rebalanceTracker *rebalanceTracker
+	metadataCleanup  *metadataCleanupTracker
+	lastError        *lastErrorTracker
+
+	// Vbs paused by an admin for targeted intervention
+	pausedVbs *pausedVbsTracker
 
 	handlerConfig   *common.HandlerConfig
 	processConfig   *common.ProcessConfig
@@ -114,6 +158,7 @@ type Producer struct {
 	localAddress      string
 	eventingNodeAddrs []string
 	kvNodeAddrs       []string
+	queryNodeAddrs    []string
 	nsServerNodeAddrs []string
 	ejectNodeUUIDs    []string
 	eventingNodeUUIDs []string
@@ -147,6 +192,10 @@ type Producer struct {
 	vbEventingNodeAssignMap     map[uint16]string // Access controlled by vbEventingNodeAssignRWMutex
 	vbEventingNodeAssignRWMutex *sync.RWMutex
 
+	// Immutable copy of vbEventingNodeAssignMap, republished after every planner run.
+	// Readers must not modify the returned map
+	vbEventingNodeAssignSnapshot atomic.Value
+
 	MemoryQuota int64
 
 	// copy of KV vbmap, needed while opening up dcp feed
@@ -175,8 +224,15 @@ type Producer struct {
 	workerVbucketMap   map[string][]uint16 // Access controlled by workerVbMapRWMutex
 	workerVbMapRWMutex *sync.RWMutex
 
+	// Immutable copy of workerVbucketMap, republished after every initWorkerVbMap call
+	workerVbMapSnapshot atomic.Value
+
 	srcCid  uint32
 	metaCid uint32
+
+	// Collection id to name of source collections, source collection included. Populated
+	// before consumers are spawned and read-only thereafter
+	srcCids map[uint32]string
 	// Supervisor of workers responsible for
 	// pipelining messages to V8
 	workerSupervisor *suptree.Supervisor
@@ -58,11 +58,29 @@ func (p *Producer) parseDepcfg() error {
 	p.handlerConfig.SourceKeyspace.BucketName = string(depcfg.SourceBucket())
 	p.handlerConfig.SourceKeyspace.ScopeName = common.CheckAndReturnDefaultForScopeOrCollection(string(depcfg.SourceScope()))
 	p.handlerConfig.SourceKeyspace.CollectionName = common.CheckAndReturnDefaultForScopeOrCollection(string(depcfg.SourceCollection()))
+	p.handlerConfig.SourceCollections = make([]string, 0, depcfg.SourceCollectionsLength())
+	for idx := 0; idx < depcfg.SourceCollectionsLength(); idx++ {
+		p.handlerConfig.SourceCollections = append(p.handlerConfig.SourceCollections,
+			common.CheckAndReturnDefaultForScopeOrCollection(string(depcfg.SourceCollections(idx))))
+	}
+	p.handlerConfig.KeyPrefixes = make([]string, 0, depcfg.KeyPrefixesLength())
+	for idx := 0; idx < depcfg.KeyPrefixesLength(); idx++ {
+		p.handlerConfig.KeyPrefixes = append(p.handlerConfig.KeyPrefixes, string(depcfg.KeyPrefixes(idx)))
+	}
+	p.handlerConfig.KeyPatterns = make([]string, 0, depcfg.KeyPatternsLength())
+	for idx := 0; idx < depcfg.KeyPatternsLength(); idx++ {
+		p.handlerConfig.KeyPatterns = append(p.handlerConfig.KeyPatterns, string(depcfg.KeyPatterns(idx)))
+	}
 	p.cfgData = string(cfgData)
 	p.metadataKeyspace.BucketName = string(depcfg.MetadataBucket())
 	p.metadataKeyspace.ScopeName = common.CheckAndReturnDefaultForScopeOrCollection(string(depcfg.MetadataScope()))
 	p.metadataKeyspace.CollectionName = common.CheckAndReturnDefaultForScopeOrCollection(string(depcfg.MetadataCollection()))
 
+	sourceCollections := map[string]struct{}{p.handlerConfig.SourceKeyspace.CollectionName: struct{}{}}
+	for _, collection := range p.handlerConfig.SourceCollections {
+		sourceCollections[collection] = struct{}{}
+	}
+
 	p.isSrcMutation = false
 	binding := new(cfg.Bucket)
 	for idx := 0; idx < depcfg.BucketsLength(); idx++ {
@@ -70,9 +88,9 @@ func (p *Producer) parseDepcfg() error {
 			scopeName := common.CheckAndReturnDefaultForScopeOrCollection(string(binding.ScopeName()))
 			collectionName := common.CheckAndReturnDefaultForScopeOrCollection(string(binding.CollectionName()))
 
+			_, sourceCollection := sourceCollections[collectionName]
 			if string(binding.BucketName()) == p.handlerConfig.SourceKeyspace.BucketName &&
-				scopeName == p.handlerConfig.SourceKeyspace.ScopeName &&
-				collectionName == p.handlerConfig.SourceKeyspace.CollectionName &&
+				scopeName == p.handlerConfig.SourceKeyspace.ScopeName && sourceCollection &&
 				string(config.Access(idx)) == "rw" {
 				p.isSrcMutation = true
 				break
@@ -96,41 +114,56 @@ func (p *Producer) parseDepcfg() error {
 		return uErr
 	}
 
+	// Code read above already carries swaps up to this revision
+	p.hotSwapRevision, _ = settings["hot_swap_revision"].(float64)
+
+	s, sErr := common.ParseHandlerSettings(sData)
+	if sErr != nil {
+		logging.Errorf("%s [%s] Invalid settings received from metakv, err: %v", logPrefix, p.appName, sErr)
+		return sErr
+	}
+
 	// N1QL related configuration
 
-	if val, ok := settings["n1ql_consistency"]; ok {
-		p.handlerConfig.N1qlConsistency = val.(string)
+	if s.N1qlConsistency != nil {
+		p.handlerConfig.N1qlConsistency = *s.N1qlConsistency
 	} else {
 		p.handlerConfig.N1qlConsistency = "none"
 	}
 
-	if val, ok := settings["lcb_inst_capacity"]; ok {
-		p.handlerConfig.LcbInstCapacity = int(val.(float64))
+	if s.N1qlTimeout != nil {
+		p.handlerConfig.N1qlTimeout = *s.N1qlTimeout
+	} else {
+		p.handlerConfig.N1qlTimeout = 0
+	}
+
+	if s.LcbInstCapacity != nil {
+		p.handlerConfig.LcbInstCapacity = *s.LcbInstCapacity
 	} else {
 		p.handlerConfig.LcbInstCapacity = 10
 	}
 
 	// Handler related configurations
-	if val, ok := settings["n1ql_prepare_all"]; ok {
-		p.handlerConfig.N1qlPrepareAll = val.(bool)
+	if s.N1qlPrepareAll != nil {
+		p.handlerConfig.N1qlPrepareAll = *s.N1qlPrepareAll
 	} else {
 		p.handlerConfig.N1qlPrepareAll = false
 	}
 
-	if val, ok := settings["language_compatibility"]; ok {
-		p.handlerConfig.LanguageCompatibility = val.(string)
+	if s.LanguageCompatibility != nil {
+		p.handlerConfig.LanguageCompatibility = *s.LanguageCompatibility
 	} else {
 		p.handlerConfig.LanguageCompatibility = common.LanguageCompatibility[0]
 	}
 
-	if val, ok := settings["checkpoint_interval"]; ok {
-		p.handlerConfig.CheckpointInterval = int(val.(float64))
+	if s.CheckpointInterval != nil {
+		p.handlerConfig.CheckpointInterval = *s.CheckpointInterval
 	} else {
 		p.handlerConfig.CheckpointInterval = 60000
 	}
 
-	if val, ok := settings["cpp_worker_thread_count"]; ok {
-		p.handlerConfig.CPPWorkerThrCount = int(val.(float64))
+	if s.CPPWorkerThrCount != nil {
+		p.handlerConfig.CPPWorkerThrCount = *s.CPPWorkerThrCount
 	} else {
 		p.handlerConfig.CPPWorkerThrCount = 2
 	}
@@ -138,81 +171,87 @@ func (p *Producer) parseDepcfg() error {
 	if lifecycleState == "pause" { // lifecycleState is "" in mixed mode
 		// We know that the handler should ways be in from_prior state in pause cycle
 		p.handlerConfig.StreamBoundary = common.DcpStreamBoundary("from_prior")
-	} else if val, ok := settings["dcp_stream_boundary"]; ok {
+	} else if s.StreamBoundary != nil {
 		// Leave the settings as it is because it's an upgraded cluster without a life cycle Op yet
 		// Likely possible that the handler crashed after the store was changed
 		// or the function is in undeploy cycle where we use the value supplied by the user
-		p.handlerConfig.StreamBoundary = common.DcpStreamBoundary(val.(string))
+		p.handlerConfig.StreamBoundary = common.DcpStreamBoundary(*s.StreamBoundary)
 	} else {
 		p.handlerConfig.StreamBoundary = common.DcpStreamBoundary("everything")
 	}
 
-	if val, ok := settings["execution_timeout"]; ok {
-		p.handlerConfig.ExecutionTimeout = int(val.(float64))
+	if s.ExecutionTimeout != nil {
+		p.handlerConfig.ExecutionTimeout = *s.ExecutionTimeout
 	} else {
 		p.handlerConfig.ExecutionTimeout = 60
 	}
 
-	if val, ok := settings["feedback_batch_size"]; ok {
-		p.handlerConfig.FeedbackBatchSize = int(val.(float64))
+	if s.FeedbackBatchSize != nil {
+		p.handlerConfig.FeedbackBatchSize = *s.FeedbackBatchSize
 	} else {
 		p.handlerConfig.FeedbackBatchSize = 100
 	}
 
-	if val, ok := settings["feedback_read_buffer_size"]; ok {
-		p.handlerConfig.FeedbackReadBufferSize = int(val.(float64))
+	if s.FeedbackReadBufferSize != nil {
+		p.handlerConfig.FeedbackReadBufferSize = *s.FeedbackReadBufferSize
 	} else {
 		p.handlerConfig.FeedbackReadBufferSize = 65536
 	}
 
-	if val, ok := settings["handler_footers"]; ok {
-		p.handlerConfig.HandlerFooters = util.ToStringArray(val)
+	if s.HandlerFooters != nil {
+		p.handlerConfig.HandlerFooters = s.HandlerFooters
 	}
 
-	if val, ok := settings["handler_headers"]; ok {
-		p.handlerConfig.HandlerHeaders = util.ToStringArray(val)
+	if s.HandlerHeaders != nil {
+		p.handlerConfig.HandlerHeaders = s.HandlerHeaders
 	} else {
 		p.handlerConfig.HandlerHeaders = common.GetDefaultHandlerHeaders()
 	}
 
-	if val, ok := settings["idle_checkpoint_interval"]; ok {
-		p.handlerConfig.IdleCheckpointInterval = int(val.(float64))
+	if s.CheckpointBatchInterval != nil {
+		p.handlerConfig.CheckpointBatchInterval = *s.CheckpointBatchInterval
+	} else {
+		p.handlerConfig.CheckpointBatchInterval = 1000
+	}
+
+	if s.IdleCheckpointInterval != nil {
+		p.handlerConfig.IdleCheckpointInterval = *s.IdleCheckpointInterval
 	} else {
 		p.handlerConfig.IdleCheckpointInterval = 30000
 	}
 
-	if val, ok := settings["log_level"]; ok {
-		p.handlerConfig.LogLevel = val.(string)
+	if s.LogLevel != nil {
+		p.handlerConfig.LogLevel = *s.LogLevel
 	} else {
 		p.handlerConfig.LogLevel = "INFO"
 	}
 
-	if val, ok := settings["num_timer_partitions"]; ok {
-		p.handlerConfig.NumTimerPartitions = int(math.Min(float64(util.RoundUpToNearestPowerOf2(val.(float64))), float64(p.numVbuckets)))
+	if s.NumTimerPartitions != nil {
+		p.handlerConfig.NumTimerPartitions = int(math.Min(float64(util.RoundUpToNearestPowerOf2(float64(*s.NumTimerPartitions))), float64(p.numVbuckets)))
 	} else {
 		p.handlerConfig.NumTimerPartitions = p.numVbuckets
 	}
 
-	if val, ok := settings["sock_batch_size"]; ok {
-		p.handlerConfig.SocketWriteBatchSize = int(val.(float64))
+	if s.SocketWriteBatchSize != nil {
+		p.handlerConfig.SocketWriteBatchSize = *s.SocketWriteBatchSize
 	} else {
 		p.handlerConfig.SocketWriteBatchSize = 100
 	}
 
-	if val, ok := settings["tick_duration"]; ok {
-		p.handlerConfig.StatsLogInterval = int(val.(float64))
+	if s.StatsLogInterval != nil {
+		p.handlerConfig.StatsLogInterval = *s.StatsLogInterval
 	} else {
 		p.handlerConfig.StatsLogInterval = 60 * 1000
 	}
 
-	if val, ok := settings["user_prefix"]; ok {
-		p.app.UserPrefix = val.(string)
+	if s.UserPrefix != nil {
+		p.app.UserPrefix = *s.UserPrefix
 	} else {
 		p.app.UserPrefix = "eventing"
 	}
 
-	if val, ok := settings["worker_count"]; ok {
-		p.handlerConfig.WorkerCount = int(val.(float64))
+	if s.WorkerCount != nil {
+		p.handlerConfig.WorkerCount = *s.WorkerCount
 	} else if string(config.Version()) == "" {
 		p.handlerConfig.WorkerCount = 3
 	} else if handlerVer, err := common.FrameCouchbaseVersion(string(config.Version())); err == nil {
@@ -229,179 +268,436 @@ func (p *Producer) parseDepcfg() error {
 		p.handlerConfig.WorkerCount = 1
 	}
 
-	if val, ok := settings["worker_feedback_queue_cap"]; ok {
-		p.handlerConfig.FeedbackQueueCap = int64(val.(float64))
+	if s.FeedbackQueueCap != nil {
+		p.handlerConfig.FeedbackQueueCap = *s.FeedbackQueueCap
 	} else {
 		p.handlerConfig.FeedbackQueueCap = int64(500)
 	}
 
-	if val, ok := settings["worker_queue_cap"]; ok {
-		p.handlerConfig.WorkerQueueCap = int64(val.(float64))
+	if s.WorkerQueueCap != nil {
+		p.handlerConfig.WorkerQueueCap = *s.WorkerQueueCap
 	} else {
 		p.handlerConfig.WorkerQueueCap = int64(100 * 1000)
 	}
 
-	if val, ok := settings["worker_queue_mem_cap"]; ok {
-		p.handlerConfig.WorkerQueueMemCap = int64(val.(float64)) * 1024 * 1024
+	if s.WorkerQueueMemCap != nil {
+		p.handlerConfig.WorkerQueueMemCap = *s.WorkerQueueMemCap * 1024 * 1024
 	} else {
 		p.handlerConfig.WorkerQueueMemCap = p.consumerMemQuota()
 	}
 
-	if val, ok := settings["worker_response_timeout"]; ok {
-		p.handlerConfig.WorkerResponseTimeout = int(val.(float64))
+	if s.WorkerQueueHighWatermark != nil {
+		p.handlerConfig.WorkerQueueHighWatermark = *s.WorkerQueueHighWatermark
+	} else {
+		p.handlerConfig.WorkerQueueHighWatermark = 90
+	}
+
+	if s.WorkerQueueLowWatermark != nil {
+		p.handlerConfig.WorkerQueueLowWatermark = *s.WorkerQueueLowWatermark
+	} else {
+		p.handlerConfig.WorkerQueueLowWatermark = 60
+	}
+
+	if s.WorkerResponseTimeout != nil {
+		p.handlerConfig.WorkerResponseTimeout = *s.WorkerResponseTimeout
 	} else {
 		p.handlerConfig.WorkerResponseTimeout = 5 * 60 // in seconds
 	}
 
-	if val, ok := settings["lcb_retry_count"]; ok {
-		p.handlerConfig.LcbRetryCount = int(val.(float64))
+	if s.WorkerRSSLimit != nil {
+		p.handlerConfig.WorkerRSSLimit = int64(*s.WorkerRSSLimit) * 1024 * 1024
+	} else {
+		p.handlerConfig.WorkerRSSLimit = 0
+	}
+
+	if s.WorkerCPULimit != nil {
+		p.handlerConfig.WorkerCPULimit = *s.WorkerCPULimit
+	} else {
+		p.handlerConfig.WorkerCPULimit = 0
+	}
+
+	if s.DcpThroughputQuota != nil {
+		p.handlerConfig.DcpThroughputQuota = *s.DcpThroughputQuota
+	} else {
+		p.handlerConfig.DcpThroughputQuota = 0
+	}
+
+	if s.CPPThreadQuota != nil {
+		p.handlerConfig.CPPThreadQuota = *s.CPPThreadQuota
+	} else {
+		p.handlerConfig.CPPThreadQuota = 0
+	}
+
+	if s.MetaLatencyInjectPercent != nil {
+		p.handlerConfig.MetaLatencyInjectPercent = *s.MetaLatencyInjectPercent
+	} else {
+		p.handlerConfig.MetaLatencyInjectPercent = 0
+	}
+
+	if s.MetaLatencyInjectMs != nil {
+		p.handlerConfig.MetaLatencyInjectMs = *s.MetaLatencyInjectMs
+	} else {
+		p.handlerConfig.MetaLatencyInjectMs = 0
+	}
+
+	if s.LcbRetryCount != nil {
+		p.handlerConfig.LcbRetryCount = *s.LcbRetryCount
 	} else {
 		p.handlerConfig.LcbRetryCount = 0
 	}
 
-	if val, ok := settings["lcb_timeout"]; ok {
-		p.handlerConfig.LcbTimeout = int(val.(float64))
+	if s.LcbTimeout != nil {
+		p.handlerConfig.LcbTimeout = *s.LcbTimeout
 	} else {
 		p.handlerConfig.LcbTimeout = 5
 	}
 
-	if val, ok := settings["bucket_cache_size"]; ok {
-		p.handlerConfig.BucketCacheSize = int64(val.(float64))
+	if s.BucketCacheSize != nil {
+		p.handlerConfig.BucketCacheSize = *s.BucketCacheSize
 	} else {
 		p.handlerConfig.BucketCacheSize = 64 * 1024 * 1024
 	}
 
-	if val, ok := settings["bucket_cache_age"]; ok {
-		p.handlerConfig.BucketCacheAge = int64(val.(float64))
+	if s.BucketCacheAge != nil {
+		p.handlerConfig.BucketCacheAge = *s.BucketCacheAge
 	} else {
 		p.handlerConfig.BucketCacheAge = 1000
 	}
 
-	if val, ok := settings["curl_max_allowed_resp_size"]; ok {
-		p.handlerConfig.CurlMaxAllowedRespSize = int(val.(float64))
+	if s.CurlMaxAllowedRespSize != nil {
+		p.handlerConfig.CurlMaxAllowedRespSize = *s.CurlMaxAllowedRespSize
 	} else {
 		p.handlerConfig.CurlMaxAllowedRespSize = 100
 	}
 
+	if s.MaxDocSizeBytes != nil {
+		p.handlerConfig.MaxDocSizeBytes = *s.MaxDocSizeBytes
+	} else {
+		p.handlerConfig.MaxDocSizeBytes = 0
+	}
+
+	if s.MaxDocSizeMode != nil {
+		p.handlerConfig.MaxDocSizeMode = *s.MaxDocSizeMode
+	} else {
+		p.handlerConfig.MaxDocSizeMode = common.MaxDocSizeModeSkip
+	}
+
+	if s.DeliveryGuarantee != nil {
+		p.handlerConfig.DeliveryGuarantee = *s.DeliveryGuarantee
+	} else {
+		p.handlerConfig.DeliveryGuarantee = common.DeliveryBestEffort
+	}
+
+	if s.TimerIntegrityCheck != nil {
+		p.handlerConfig.TimerIntegrityCheck = *s.TimerIntegrityCheck
+	} else {
+		p.handlerConfig.TimerIntegrityCheck = common.TimerIntegritySkip
+	}
+
+	if s.WorkerIPCType != nil {
+		p.handlerConfig.WorkerIPCType = *s.WorkerIPCType
+	} else {
+		p.handlerConfig.WorkerIPCType = common.WorkerIPCAuto
+	}
+
+	if s.DeadLetterBucket != nil && *s.DeadLetterBucket != "" {
+		keyspace := &common.Keyspace{BucketName: *s.DeadLetterBucket}
+		if s.DeadLetterScope != nil {
+			keyspace.ScopeName = *s.DeadLetterScope
+		}
+		if s.DeadLetterCollection != nil {
+			keyspace.CollectionName = *s.DeadLetterCollection
+		}
+		keyspace.ScopeName = common.CheckAndReturnDefaultForScopeOrCollection(keyspace.ScopeName)
+		keyspace.CollectionName = common.CheckAndReturnDefaultForScopeOrCollection(keyspace.CollectionName)
+		p.handlerConfig.DeadLetterKeyspace = keyspace
+	} else {
+		p.handlerConfig.DeadLetterKeyspace = nil
+	}
+
+	if s.DeadLetterRetryCount != nil {
+		p.handlerConfig.DeadLetterRetryCount = *s.DeadLetterRetryCount
+	} else {
+		p.handlerConfig.DeadLetterRetryCount = 2
+	}
+
+	if s.RetryCount != nil {
+		p.handlerConfig.RetryCount = *s.RetryCount
+	} else {
+		p.handlerConfig.RetryCount = 0
+	}
+
+	if s.RetryBackoff != nil {
+		p.handlerConfig.RetryBackoff = *s.RetryBackoff
+	} else {
+		p.handlerConfig.RetryBackoff = 1000
+	}
+
+	if s.RetryOn != nil {
+		p.handlerConfig.RetryOn = s.RetryOn
+	} else {
+		p.handlerConfig.RetryOn = common.GetDefaultRetryOn()
+	}
+
+	if s.StrictOrderCheck != nil {
+		p.handlerConfig.StrictOrderCheck = *s.StrictOrderCheck
+	} else {
+		p.handlerConfig.StrictOrderCheck = false
+	}
+
+	if s.MaxDocSizeLog != nil {
+		p.handlerConfig.MaxDocSizeLog = *s.MaxDocSizeLog
+	} else {
+		p.handlerConfig.MaxDocSizeLog = false
+	}
+
+	if s.BuilderPoolSize != nil {
+		p.handlerConfig.BuilderPoolSize = *s.BuilderPoolSize
+	} else {
+		p.handlerConfig.BuilderPoolSize = 128
+	}
+
+	if s.BuilderInitialCapacity != nil {
+		p.handlerConfig.BuilderInitialCapacity = *s.BuilderInitialCapacity
+	} else {
+		p.handlerConfig.BuilderInitialCapacity = 0
+	}
+
+	if s.UseBootstrapDcpFeeds != nil {
+		p.handlerConfig.UseBootstrapDcpFeeds = *s.UseBootstrapDcpFeeds
+	} else {
+		p.handlerConfig.UseBootstrapDcpFeeds = false
+	}
+
+	if s.BootstrapFeedThreshold != nil {
+		p.handlerConfig.BootstrapFeedThreshold = *s.BootstrapFeedThreshold
+	} else {
+		p.handlerConfig.BootstrapFeedThreshold = 10000
+	}
+
+	if s.BootstrapFeedPriority != nil {
+		p.handlerConfig.BootstrapFeedPriority = *s.BootstrapFeedPriority
+	} else {
+		p.handlerConfig.BootstrapFeedPriority = "low"
+	}
+
+	if s.PrefetchKeyPatterns != nil {
+		p.handlerConfig.PrefetchKeyPatterns = s.PrefetchKeyPatterns
+	}
+
+	if s.PrefetchKeySeparator != nil {
+		p.handlerConfig.PrefetchKeySeparator = *s.PrefetchKeySeparator
+	} else {
+		p.handlerConfig.PrefetchKeySeparator = "::"
+	}
+
+	if s.DebuggerReplayEvents != nil {
+		p.handlerConfig.DebuggerReplayEvents = *s.DebuggerReplayEvents
+	} else {
+		p.handlerConfig.DebuggerReplayEvents = 0
+	}
+
 	// Metastore related configuration
 
-	if val, ok := settings["timer_context_size"]; ok {
-		p.handlerConfig.TimerContextSize = int64(val.(float64))
+	if s.TimerLaneBatchSize != nil {
+		p.handlerConfig.TimerLaneBatchSize = *s.TimerLaneBatchSize
+	} else {
+		p.handlerConfig.TimerLaneBatchSize = 100
+	}
+
+	if s.DcpLaneBatchSize != nil {
+		p.handlerConfig.DcpLaneBatchSize = *s.DcpLaneBatchSize
+	} else {
+		p.handlerConfig.DcpLaneBatchSize = 100
+	}
+
+	if s.TimerContextSize != nil {
+		p.handlerConfig.TimerContextSize = *s.TimerContextSize
 	} else {
 		p.handlerConfig.TimerContextSize = 1024
 	}
 
-	if val, ok := settings["timer_queue_mem_cap"]; ok {
-		p.handlerConfig.TimerQueueMemCap = uint64(val.(float64)) * 1024 * 1024
+	if s.TimerQueueMemCap != nil {
+		p.handlerConfig.TimerQueueMemCap = *s.TimerQueueMemCap * 1024 * 1024
 	} else {
 		p.handlerConfig.TimerQueueMemCap = uint64(p.consumerMemQuota())
 	}
 
-	if val, ok := settings["timer_queue_size"]; ok {
-		p.handlerConfig.TimerQueueSize = uint64(val.(float64))
+	if s.TimerQueueSize != nil {
+		p.handlerConfig.TimerQueueSize = *s.TimerQueueSize
 	} else {
 		p.handlerConfig.TimerQueueSize = 10000
 	}
 
-	if val, ok := settings["undeploy_routine_count"]; ok {
-		p.handlerConfig.UndeployRoutineCount = int(val.(float64))
+	if s.UndeployRoutineCount != nil {
+		p.handlerConfig.UndeployRoutineCount = *s.UndeployRoutineCount
 	} else {
 		p.handlerConfig.UndeployRoutineCount = util.CPUCount(true)
 	}
 
-	if val, ok := settings["allow_transaction_mutations"]; ok {
-		p.handlerConfig.AllowTransactionMutations = val.(bool)
+	if s.AllowTransactionMutations != nil {
+		p.handlerConfig.AllowTransactionMutations = *s.AllowTransactionMutations
 	} else {
 		p.handlerConfig.AllowTransactionMutations = false
 	}
 
+	if s.IncludeXattrs != nil {
+		p.handlerConfig.IncludeXattrs = *s.IncludeXattrs
+	} else {
+		p.handlerConfig.IncludeXattrs = false
+	}
+
+	if s.SkipBinaryDocs != nil {
+		p.handlerConfig.SkipBinaryDocs = *s.SkipBinaryDocs
+	} else {
+		p.handlerConfig.SkipBinaryDocs = false
+	}
+
+	if s.WorkerFrameChecksums != nil {
+		p.handlerConfig.WorkerFrameChecksums = *s.WorkerFrameChecksums
+	} else {
+		p.handlerConfig.WorkerFrameChecksums = false
+	}
+
+	if s.OriginTagging != nil {
+		p.handlerConfig.OriginTagging = *s.OriginTagging
+	} else {
+		p.handlerConfig.OriginTagging = false
+	}
+
+	if s.SubscribeTopics != nil {
+		p.handlerConfig.SubscribeTopics = s.SubscribeTopics
+	} else {
+		p.handlerConfig.SubscribeTopics = []string{}
+	}
+
 	// Rebalance related configurations
 
-	if val, ok := settings["vb_ownership_giveup_routine_count"]; ok {
-		p.rebalanceConfig.VBOwnershipGiveUpRoutineCount = int(val.(float64))
+	if s.VBOwnershipGiveUpRoutineCount != nil {
+		p.rebalanceConfig.VBOwnershipGiveUpRoutineCount = *s.VBOwnershipGiveUpRoutineCount
 	} else {
 		p.rebalanceConfig.VBOwnershipGiveUpRoutineCount = 3
 	}
 
-	if val, ok := settings["vb_ownership_takeover_routine_count"]; ok {
-		p.rebalanceConfig.VBOwnershipTakeoverRoutineCount = int(val.(float64))
+	if s.VBOwnershipTakeoverRoutineCount != nil {
+		p.rebalanceConfig.VBOwnershipTakeoverRoutineCount = *s.VBOwnershipTakeoverRoutineCount
 	} else {
 		p.rebalanceConfig.VBOwnershipTakeoverRoutineCount = 3
 	}
 
+	if s.AutoTuneVBTakeoverRoutines != nil {
+		p.rebalanceConfig.AutoTuneVBTakeoverRoutines = *s.AutoTuneVBTakeoverRoutines
+	} else {
+		p.rebalanceConfig.AutoTuneVBTakeoverRoutines = false
+	}
+
+	if s.VBTakeoverRoutineMinCount != nil {
+		p.rebalanceConfig.VBTakeoverRoutineMinCount = *s.VBTakeoverRoutineMinCount
+	} else {
+		p.rebalanceConfig.VBTakeoverRoutineMinCount = 1
+	}
+
+	if s.VBTakeoverRoutineMaxCount != nil {
+		p.rebalanceConfig.VBTakeoverRoutineMaxCount = *s.VBTakeoverRoutineMaxCount
+	} else {
+		p.rebalanceConfig.VBTakeoverRoutineMaxCount = 16
+	}
+
+	if s.VBTakeoverDeadline != nil {
+		p.rebalanceConfig.VBTakeoverDeadline = *s.VBTakeoverDeadline
+	} else {
+		p.rebalanceConfig.VBTakeoverDeadline = 0
+	}
+
+	if s.ForceVBTakeover != nil {
+		p.rebalanceConfig.ForceVBTakeover = *s.ForceVBTakeover
+	} else {
+		p.rebalanceConfig.ForceVBTakeover = false
+	}
+
+	if s.VBHandoverLingerTimeout != nil {
+		p.rebalanceConfig.VBHandoverLingerTimeout = *s.VBHandoverLingerTimeout
+	} else {
+		p.rebalanceConfig.VBHandoverLingerTimeout = 0
+	}
+
 	// Application logging related configurations
 
-	if val, ok := settings["app_log_dir"]; ok {
-		os.MkdirAll(val.(string), 0755)
-		p.appLogPath = fmt.Sprintf("%s/%s", val.(string), p.appName)
+	if s.AppLogDir != nil {
+		os.MkdirAll(*s.AppLogDir, 0755)
+		p.appLogPath = fmt.Sprintf("%s/%s", *s.AppLogDir, p.appName)
 	} else {
 		os.MkdirAll(p.processConfig.EventingDir, 0755)
 		p.appLogPath = fmt.Sprintf("%s/%s.log", p.processConfig.EventingDir, p.appName)
 	}
 
-	if val, ok := settings["app_log_max_size"]; ok {
-		p.appLogMaxSize = int64(val.(float64))
+	if s.AppLogMaxSize != nil {
+		p.appLogMaxSize = *s.AppLogMaxSize
 	} else {
 		p.appLogMaxSize = 1024 * 1024 * 40
 	}
 
-	if val, ok := settings["app_log_max_files"]; ok {
-		p.appLogMaxFiles = int64(val.(float64))
+	if s.AppLogMaxFiles != nil {
+		p.appLogMaxFiles = *s.AppLogMaxFiles
 	} else {
 		p.appLogMaxFiles = int64(10)
 	}
 
-	if val, ok := settings["enable_applog_rotation"]; ok {
-		p.appLogRotation = val.(bool)
+	if s.AppLogRotation != nil {
+		p.appLogRotation = *s.AppLogRotation
 	} else {
 		p.appLogRotation = true
 	}
 
 	// DCP connection related configurations
 
-	if val, ok := settings["agg_dcp_feed_mem_cap"]; ok {
-		p.handlerConfig.AggDCPFeedMemCap = int64(val.(float64)) * 1024 * 1024
+	if s.AggDCPFeedMemCap != nil {
+		p.handlerConfig.AggDCPFeedMemCap = *s.AggDCPFeedMemCap * 1024 * 1024
 	} else {
 		p.handlerConfig.AggDCPFeedMemCap = p.consumerMemQuota()
 	}
 
-	if val, ok := settings["data_chan_size"]; ok {
-		p.dcpConfig["dataChanSize"] = int(val.(float64))
+	if s.DataChanSize != nil {
+		p.dcpConfig["dataChanSize"] = *s.DataChanSize
 	} else {
 		p.dcpConfig["dataChanSize"] = 50
 	}
 
-	if val, ok := settings["dcp_window_size"]; ok {
-		p.dcpConfig["dcpWindowSize"] = uint32(val.(float64))
+	if s.DcpWindowSize != nil {
+		p.dcpConfig["dcpWindowSize"] = *s.DcpWindowSize
 	} else {
 		p.dcpConfig["dcpWindowSize"] = uint32(20 * 1024 * 1024)
 	}
 
 	p.dcpConfig["latencyTick"] = p.handlerConfig.StatsLogInterval
 
-	if val, ok := settings["dcp_gen_chan_size"]; ok {
-		p.dcpConfig["genChanSize"] = int(val.(float64))
+	if s.DcpGenChanSize != nil {
+		p.dcpConfig["genChanSize"] = *s.DcpGenChanSize
 	} else {
 		p.dcpConfig["genChanSize"] = 10000
 	}
 
-	if val, ok := settings["dcp_num_connections"]; ok {
-		p.dcpConfig["numConnections"] = int(val.(float64))
+	if s.DcpNumConnections != nil {
+		p.dcpConfig["numConnections"] = *s.DcpNumConnections
 	} else {
 		p.dcpConfig["numConnections"] = 1
 	}
 
+	if s.DcpNoopInterval != nil {
+		p.dcpConfig["noopInterval"] = *s.DcpNoopInterval
+	} else {
+		p.dcpConfig["noopInterval"] = 120
+	}
+
 	p.dcpConfig["activeVbOnly"] = true
 	p.app.Settings = settings
 
-	var logLevel string
-	if val, ok := settings["log_level"]; ok {
-		logLevel = val.(string)
-	} else {
-		logLevel = "INFO"
+	logLevel := "INFO"
+	if s.LogLevel != nil {
+		logLevel = *s.LogLevel
 	}
 
-	logging.SetLogLevel(util.GetLogLevel(logLevel))
+	logging.SetAppLogLevel(p.appName, util.GetLogLevel(logLevel))
 
 	logging.Infof("%s [%s] Loaded function => wc: %v bucket: %v Scope: %v Collection: %s statsTickD: %v",
 		logPrefix, p.appName, p.handlerConfig.WorkerCount, p.SourceBucket(), p.SourceScope(), p.SourceCollection(),
@@ -411,6 +707,24 @@ func (p *Producer) parseDepcfg() error {
 		return fmt.Errorf("%v", errorUnexpectedWorkerCount)
 	}
 
+	// Workers beyond vb count would never be assigned a vb, on any topology. Clamped
+	// the same way on every node, so that planners agree on vb to worker mapping
+	if p.handlerConfig.WorkerCount > p.numVbuckets {
+		logging.Warnf("%s [%s] worker_count: %d exceeds vbucket count: %d, spawning %d workers instead",
+			logPrefix, p.appName, p.handlerConfig.WorkerCount, p.numVbuckets, p.numVbuckets)
+		p.handlerConfig.WorkerCount = p.numVbuckets
+	}
+
+	if p.handlerConfig.CPPWorkerThrCount > p.numVbuckets {
+		logging.Warnf("%s [%s] cpp_worker_thread_count: %d exceeds vbucket count: %d, spawning %d threads instead",
+			logPrefix, p.appName, p.handlerConfig.CPPWorkerThrCount, p.numVbuckets, p.numVbuckets)
+		p.handlerConfig.CPPWorkerThrCount = p.numVbuckets
+	}
+
+	p.applyCPPThreadQuota()
+	p.dcpQuota.setRate(p.handlerConfig.DcpThroughputQuota)
+	p.metaLatency.setConfig(p.handlerConfig.MetaLatencyInjectPercent, p.handlerConfig.MetaLatencyInjectMs)
+
 	p.nsServerHostPort = net.JoinHostPort(util.Localhost(), p.nsServerPort)
 
 	p.kvHostPorts, err = util.KVNodesAddresses(p.auth, p.nsServerHostPort, p.SourceBucket())
@@ -0,0 +1,20 @@
+package producer
+
+import (
+	"sync/atomic"
+
+	"github.com/couchbase/eventing/common"
+)
+
+// DeliverBusEvent hands event published on a topic the function subscribes to over
+// to one of its consumers, picked round robin. Bus events aren't tied to a vbucket,
+// so any worker of the function may run OnEvent for it
+func (p *Producer) DeliverBusEvent(topic string, payload []byte) error {
+	consumers := p.getConsumers()
+	if len(consumers) == 0 {
+		return common.ErrNoRunningConsumers
+	}
+
+	idx := atomic.AddUint64(&p.busEventCounter, 1) % uint64(len(consumers))
+	return consumers[idx].SendBusEvent(topic, payload)
+}
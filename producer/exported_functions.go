@@ -3,6 +3,7 @@ package producer
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"fmt"
 	"net"
 	"os"
@@ -57,10 +58,19 @@ func (p *Producer) GetInsight() *common.Insight {
 			wrapper.Accumulate(insight)
 		}
 	}
-	logging.Debugf("%s [%s:%d] Producer insight is %V", logPrefix, p.appName, p.LenRunningConsumers(), wrapper)
+	for num, line := range wrapper.Lines {
+		line.LastException = p.app.SourceMap.Symbolicate(line.LastException)
+		wrapper.Lines[num] = line
+	}
+	logging.AppDebugf(p.appName, "%s [%s:%d] Producer insight is %V", logPrefix, p.appName, p.LenRunningConsumers(), wrapper)
 	return wrapper
 }
 
+// GetSourceMap returns map of script lines loaded in V8 to lines of handler code
+func (p *Producer) GetSourceMap() *common.SourceMap {
+	return p.app.SourceMap
+}
+
 func (p *Producer) AggregateCurlStats(in interface{}, curlMap map[string]float64) {
 	for key, val := range in.(map[string]interface{}) {
 		if oldVal, ok := curlMap[key]; ok {
@@ -77,6 +87,7 @@ func (p *Producer) GetExecutionStats() map[string]interface{} {
 	executionStats["timestamp"] = make(map[int]string)
 	executionStats["curl"] = make(map[string]interface{})
 	curlMap := make(map[string]float64)
+	n1qlMap := make(map[string]interface{})
 
 	for _, c := range p.getConsumers() {
 		for k, v := range c.GetExecutionStats() {
@@ -90,6 +101,11 @@ func (p *Producer) GetExecutionStats() map[string]interface{} {
 				continue
 			}
 
+			if k == "n1ql" {
+				p.AggregateN1qlStats(v, n1qlMap)
+				continue
+			}
+
 			if _, ok := executionStats[k]; !ok {
 				executionStats[k] = float64(0)
 			}
@@ -99,6 +115,9 @@ func (p *Producer) GetExecutionStats() map[string]interface{} {
 	}
 	executionStats["curl"] = curlMap
 
+	n1qlMap["latency_stats"] = p.n1qlLatency()
+	executionStats["n1ql"] = n1qlMap
+
 	return executionStats
 }
 
@@ -140,11 +159,81 @@ func (p *Producer) GetLcbExceptionsStats() map[string]uint64 {
 	return exceptionStats
 }
 
+// GetFailureDomains returns failures aggregated from Eventing.Consumer instances per
+// failure domain, along with most recent failures of each domain
+func (p *Producer) GetFailureDomains() map[string]*common.DomainFailures {
+	domains := make(map[string]*common.DomainFailures)
+	get := func(domain string) *common.DomainFailures {
+		d, ok := domains[domain]
+		if !ok {
+			d = &common.DomainFailures{Counters: make(map[string]uint64)}
+			domains[domain] = d
+		}
+		return d
+	}
+
+	for _, c := range p.getConsumers() {
+		for domain, failures := range c.GetFailureDomains() {
+			d := get(domain)
+			d.Count += failures.Count
+			for source, count := range failures.Counters {
+				d.Counters[source] += count
+			}
+			d.RecentErrors = append(d.RecentErrors, failures.RecentErrors...)
+		}
+	}
+
+	if p.workerSpawnCounter > 0 {
+		d := get(common.FailureDomainWorker)
+		d.Counters["worker_spawn_counter"] += p.workerSpawnCounter
+		d.Count += p.workerSpawnCounter
+	}
+
+	for _, d := range domains {
+		sort.Slice(d.RecentErrors, func(i, j int) bool {
+			return d.RecentErrors[i].Timestamp.Before(d.RecentErrors[j].Timestamp)
+		})
+		if len(d.RecentErrors) > failureSamplesToRetain {
+			d.RecentErrors = d.RecentErrors[len(d.RecentErrors)-failureSamplesToRetain:]
+		}
+	}
+	return domains
+}
+
+// GetDcpFeedEvents returns recent DCP feed connection events across all consumers, oldest first
+func (p *Producer) GetDcpFeedEvents() []*common.DcpFeedEvent {
+	events := make([]*common.DcpFeedEvent, 0)
+
+	for _, c := range p.getConsumers() {
+		events = append(events, c.GetDcpFeedEvents()...)
+	}
+
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].Timestamp.Before(events[j].Timestamp)
+	})
+
+	if len(events) > dcpFeedEventsToRetain {
+		events = events[len(events)-dcpFeedEventsToRetain:]
+	}
+	return events
+}
+
 // GetAppCode returns handler code for the current app
 func (p *Producer) GetAppCode() string {
 	return p.app.AppCode
 }
 
+// RecordWorkerLimitBreach is called by consumers prior to respawning cpp worker which
+// breached one of its resource limits
+func (p *Producer) RecordWorkerLimitBreach(limit string) {
+	switch limit {
+	case common.WorkerLimitRSS:
+		atomic.AddUint64(&p.workerRSSLimitBreached, 1)
+	case common.WorkerLimitCPU:
+		atomic.AddUint64(&p.workerCPULimitBreached, 1)
+	}
+}
+
 // GetEventProcessingStats exposes dcp/timer processing stats
 func (p *Producer) GetEventProcessingStats() map[string]uint64 {
 	aggStats := make(map[string]uint64)
@@ -163,6 +252,39 @@ func (p *Producer) GetEventProcessingStats() map[string]uint64 {
 		aggStats["worker_spawn_counter"] = p.workerSpawnCounter
 	}
 
+	if breached := atomic.LoadUint64(&p.workerRSSLimitBreached); breached > 0 {
+		aggStats["worker_rss_limit_breached"] = breached
+	}
+
+	if breached := atomic.LoadUint64(&p.workerCPULimitBreached); breached > 0 {
+		aggStats["worker_cpu_limit_breached"] = breached
+	}
+
+	p.liveness.RLock()
+	if stale := len(p.liveness.stale); stale > 0 {
+		aggStats["stale_consumers"] = uint64(stale)
+	}
+	p.liveness.RUnlock()
+
+	if consecutive, backoffMs := p.workerRestarts.recent(); consecutive > 0 {
+		aggStats["worker_consecutive_restarts"] = consecutive
+		aggStats["worker_restart_backoff_ms"] = backoffMs
+	}
+
+	if throttled := p.dcpQuota.throttled(); throttled > 0 {
+		aggStats["dcp_quota_throttle_ms"] = throttled
+	}
+
+	// Prefixed so that artificial delays aren't mistaken for KV slowness
+	if injected, injectedMs := p.metaLatency.stats(); injected > 0 {
+		aggStats["injected_metadata_delays"] = injected
+		aggStats["injected_metadata_delay_ms"] = injectedMs
+	}
+
+	for k, v := range p.superSup.GetVbTakeoverSlotStats(p.appName) {
+		aggStats[k] = v
+	}
+
 	return aggStats
 }
 
@@ -171,8 +293,45 @@ func (p *Producer) GetNsServerPort() string {
 	return p.nsServerPort
 }
 
+// Context returns context of producer, which gets cancelled on producer stop or pause
+func (p *Producer) Context() context.Context {
+	return p.ctx
+}
+
+// AcquireVbTakeoverSlot waits for a node-wide slot to takeover a vbucket, shared
+// with other functions being rebalanced simultaneously
+func (p *Producer) AcquireVbTakeoverSlot(cancelCh <-chan struct{}) bool {
+	return p.superSup.AcquireVbTakeoverSlot(p.appName, cancelCh)
+}
+
+// ReleaseVbTakeoverSlot returns slot acquired for vbucket takeover
+func (p *Producer) ReleaseVbTakeoverSlot() {
+	p.superSup.ReleaseVbTakeoverSlot(p.appName)
+}
+
 // IsEventingNodeAlive verifies if a hostPortAddr combination is an active eventing node
 func (p *Producer) IsEventingNodeAlive(eventingHostPortAddr, nodeUUID string) bool {
+	logPrefix := "Producer::IsEventingNodeAlive"
+
+	// ns_server is the authority on cluster membership. Health gossip, which learns about
+	// node failures ahead of it, only confirms nodes that ns_server already reports as
+	// failed or ejected and never overrides its view
+	if p.isEventingNodeInCluster(eventingHostPortAddr, nodeUUID) {
+		if liveness := p.superSup.PeerLiveness(eventingHostPortAddr, nodeUUID, p.appName); liveness == common.PeerDown || liveness == common.PeerFenced {
+			logging.AppDebugf(p.appName, "%s [%s:%d] Eventing node addr: %rs uuid: %s reported %s by health gossip, but is active as per ns_server",
+				logPrefix, p.appName, p.LenRunningConsumers(), eventingHostPortAddr, nodeUUID, liveness)
+		}
+		return true
+	}
+
+	if liveness := p.superSup.PeerLiveness(eventingHostPortAddr, nodeUUID, p.appName); liveness == common.PeerDown {
+		logging.AppDebugf(p.appName, "%s [%s:%d] Eventing node addr: %rs uuid: %s not in cluster, confirmed %s by health gossip",
+			logPrefix, p.appName, p.LenRunningConsumers(), eventingHostPortAddr, nodeUUID, liveness)
+	}
+	return false
+}
+
+func (p *Producer) isEventingNodeInCluster(eventingHostPortAddr, nodeUUID string) bool {
 	eventingNodeAddrs := (*[]string)(atomic.LoadPointer(
 		(*unsafe.Pointer)(unsafe.Pointer(&p.eventingNodeAddrs))))
 	if eventingNodeAddrs != nil {
@@ -184,11 +343,7 @@ func (p *Producer) IsEventingNodeAlive(eventingHostPortAddr, nodeUUID string) bo
 	}
 
 	// To assist in the case of hostname update
-	if util.Contains(nodeUUID, p.eventingNodeUUIDs) {
-		return true
-	}
-
-	return false
+	return util.Contains(nodeUUID, p.eventingNodeUUIDs)
 }
 
 // KvHostPorts returns host:port combination for kv service
@@ -225,6 +380,11 @@ func (p *Producer) GetSourceCid() uint32 {
 	return atomic.LoadUint32(&p.srcCid)
 }
 
+// GetSourceCollectionIDs returns collections function listens to, keyed by collection id
+func (p *Producer) GetSourceCollectionIDs() map[uint32]string {
+	return p.srcCids
+}
+
 func (p *Producer) GetMetadataCid() uint32 {
 	return atomic.LoadUint32(&p.metaCid)
 }
@@ -384,6 +544,18 @@ func (p *Producer) WriteAppLog(log string) {
 	fmt.Fprintf(p.appLogWriter, "%s [INFO] %s\n", ts, log)
 }
 
+// AppLogPath returns path of active app log file of the function
+func (p *Producer) AppLogPath() string {
+	return p.appLogPath
+}
+
+// RotateAppLog gets app log rotated ahead of app_log_max_size
+func (p *Producer) RotateAppLog() {
+	if p.appLogWriter != nil {
+		p.appLogWriter.requestRotation()
+	}
+}
+
 var valid_logline = regexp.MustCompile(`^[0-9]{4}-[0-9]{2}-[0-9]{2}T[0-9]{2}:[0-9]{2}:[0-9]{2}\.[0-9]{3}`)
 
 // GetAppLog returns tail of app log, trying to fetch up to 'sz' bytes
@@ -443,7 +615,7 @@ func (p *Producer) vbDistributionStats() error {
 	vbBlob := make(map[string]interface{})
 
 	for vb := 0; vb < p.numVbuckets; vb++ {
-		vbKey := fmt.Sprintf("%s::vb::%d", p.appName, vb)
+		vbKey := common.CheckpointBlobKey(p.appName, uint16(vb))
 		err := util.Retry(util.NewFixedBackoff(bucketOpRetryInterval), &p.retryCount, getOpCallback,
 			p, p.AddMetadataPrefix(vbKey), &vbBlob)
 		if err == common.ErrRetryTimeout {
@@ -513,7 +685,7 @@ func (p *Producer) getSeqsProcessed() error {
 	vbBlob := make(map[string]interface{})
 
 	for vb := 0; vb < p.numVbuckets; vb++ {
-		vbKey := fmt.Sprintf("%s::vb::%d", p.appName, vb)
+		vbKey := common.CheckpointBlobKey(p.appName, uint16(vb))
 		err := util.Retry(util.NewFixedBackoff(bucketOpRetryInterval), &p.retryCount, getOpCallback,
 			p, p.AddMetadataPrefix(vbKey), &vbBlob)
 		if err == common.ErrRetryTimeout {
@@ -571,6 +743,10 @@ func (p *Producer) RebalanceTaskProgress() *common.RebalanceProgress {
 		logging.Infof("%s [%s:%d] Producer bootstrapping", logPrefix, p.appName, p.LenRunningConsumers())
 	}
 
+	if producerLevelProgress.VbsRemainingToShuffle == 0 {
+		go p.finishRebalanceReport("completed")
+	}
+
 	return producerLevelProgress
 }
 
@@ -604,19 +780,17 @@ func (p *Producer) CleanupMetadataBucket(skipCheckpointBlobs bool) error {
 	}
 
 	vbsToCleanup := make([]uint16, 0)
-	p.vbEventingNodeAssignRWMutex.RLock()
-	for vb, node := range p.vbEventingNodeAssignMap {
+	for vb, node := range p.VbEventingNodeAssignMapSnapshot() {
 		if node == eventingNodeAddr {
 			vbsToCleanup = append(vbsToCleanup, vb)
 		}
 	}
-	p.vbEventingNodeAssignRWMutex.RUnlock()
 
 	sort.Sort(util.Uint16Slice(vbsToCleanup))
 	logging.Infof("%s [%s:%d] Eventing node: %s vbs to cleanup len: %d dump: %s",
 		logPrefix, p.appName, p.LenRunningConsumers(), eventingNodeAddr, len(vbsToCleanup), util.Condense(vbsToCleanup))
 
-	vbsDistribution := util.VbucketNodeAssignment(vbsToCleanup, p.handlerConfig.UndeployRoutineCount)
+	p.metadataCleanup.start(len(vbsToCleanup))
 
 	// ensure that metadata handle has been switched over and refreshed before the cleanup activity starts
 	p.superSup.CheckAndSwitchgocbBucket(p.MetadataBucket(), p.appName, p.superSup.GetSecuritySetting())
@@ -625,20 +799,62 @@ func (p *Producer) CleanupMetadataBucket(skipCheckpointBlobs bool) error {
 		logging.Warnf("%s [%s:%d] Failed to refresh meta data handle during undeploy, using the existing handle. Err: %v", logPrefix, p.appName, p.LenRunningConsumers(), err)
 	}
 
-	var undeployWG sync.WaitGroup
-	undeployWG.Add(p.handlerConfig.UndeployRoutineCount)
+	for attempt := 1; ; attempt++ {
+		p.metadataCleanup.update(func(status *common.MetadataCleanupStatus) {
+			status.Attempts = attempt
+		})
 
-	for i := 0; i < p.handlerConfig.UndeployRoutineCount; i++ {
-		go p.cleanupMetadataImpl(i, vbsDistribution[i], &undeployWG, skipCheckpointBlobs)
-	}
+		vbsDistribution := util.VbucketNodeAssignment(vbsToCleanup, p.handlerConfig.UndeployRoutineCount)
+		routineErrs := make([]error, p.handlerConfig.UndeployRoutineCount)
 
-	undeployWG.Wait()
-	return nil
+		var undeployWG sync.WaitGroup
+		undeployWG.Add(p.handlerConfig.UndeployRoutineCount)
+
+		for i := 0; i < p.handlerConfig.UndeployRoutineCount; i++ {
+			go func(i int) {
+				defer undeployWG.Done()
+				routineErrs[i] = p.cleanupMetadataImpl(i, vbsDistribution[i], skipCheckpointBlobs)
+			}(i)
+		}
+
+		undeployWG.Wait()
+
+		// Vbuckets handled by routines that ran into errors are cleaned up afresh
+		vbsToCleanup = make([]uint16, 0)
+		for i, routineErr := range routineErrs {
+			if routineErr != nil {
+				err = routineErr
+				vbsToCleanup = append(vbsToCleanup, vbsDistribution[i]...)
+			}
+		}
+
+		if len(vbsToCleanup) == 0 {
+			p.metadataCleanup.finish(nil)
+			logging.Infof("%s [%s:%d] Metadata cleanup completed in attempts: %d",
+				logPrefix, p.appName, p.LenRunningConsumers(), attempt)
+			return nil
+		}
+
+		p.metadataCleanup.update(func(status *common.MetadataCleanupStatus) {
+			status.LastError = err.Error()
+		})
+
+		if attempt == metadataCleanupMaxAttempts {
+			p.metadataCleanup.finish(err)
+			logging.Errorf("%s [%s:%d] Giving up on metadata cleanup after attempts: %d, vbs left len: %d dump: %s err: %v",
+				logPrefix, p.appName, p.LenRunningConsumers(), attempt, len(vbsToCleanup), util.Condense(vbsToCleanup), err)
+			return err
+		}
+
+		sort.Sort(util.Uint16Slice(vbsToCleanup))
+		logging.Warnf("%s [%s:%d] Metadata cleanup attempt: %d failed for vbs len: %d dump: %s err: %v, retrying",
+			logPrefix, p.appName, p.LenRunningConsumers(), attempt, len(vbsToCleanup), util.Condense(vbsToCleanup), err)
+		time.Sleep(time.Duration(attempt) * metadataCleanupRetryInterval)
+	}
 }
 
-func (p *Producer) cleanupMetadataImpl(id int, vbsToCleanup []uint16, undeployWG *sync.WaitGroup, skipCheckpointBlobs bool) error {
+func (p *Producer) cleanupMetadataImpl(id int, vbsToCleanup []uint16, skipCheckpointBlobs bool) error {
 	logPrefix := "Producer::cleanupMetadataImpl"
-	defer undeployWG.Done()
 
 	sort.Sort(util.Uint16Slice(vbsToCleanup))
 	logging.Infof("%s [%s:%d:id_%d] vbs to cleanup len: %d dump: %s",
@@ -693,6 +909,10 @@ func (p *Producer) cleanupMetadataImpl(id int, vbsToCleanup []uint16, undeployWG
 	rw := &sync.RWMutex{}
 	receivedVbSeqNos := make(map[uint16]uint64)
 
+	// Closed by cleanup routine on failing to delete an artifact
+	var deleteErr error
+	deleteFailedCh := make(chan struct{})
+
 	go func(b *couchbase.Bucket, dcpFeed *couchbase.DcpFeed, wg *sync.WaitGroup,
 		receivedVbSeqNos map[uint16]uint64, rw *sync.RWMutex) {
 
@@ -716,8 +936,8 @@ func (p *Producer) cleanupMetadataImpl(id int, vbsToCleanup []uint16, undeployWG
 				case mcd.DCP_MUTATION:
 					docID := string(e.Key)
 
-					if strings.HasPrefix(docID, prefix) {
-						if skipCheckpointBlobs && strings.Contains(docID, "::vb::") {
+					if common.IsMetadataKey(prefix, docID) {
+						if skipCheckpointBlobs && strings.Contains(docID, common.CheckpointBlobKeyInfix) {
 							continue
 						}
 
@@ -725,8 +945,20 @@ func (p *Producer) cleanupMetadataImpl(id int, vbsToCleanup []uint16, undeployWG
 						if err == common.ErrRetryTimeout {
 							logging.Errorf("%s [%s:%d:id_%d] Exiting due to timeout",
 								logPrefix, p.appName, p.LenRunningConsumers(), id)
+
+							p.metadataCleanup.update(func(status *common.MetadataCleanupStatus) {
+								status.DeleteErrors++
+							})
+							rw.Lock()
+							deleteErr = fmt.Errorf("failed to delete metadata artifact, err: %v", err)
+							rw.Unlock()
+							close(deleteFailedCh)
 							return
 						}
+
+						p.metadataCleanup.update(func(status *common.MetadataCleanupStatus) {
+							status.DocsDeleted++
+						})
 					}
 
 				case mcd.DCP_STREAMREQ:
@@ -775,7 +1007,7 @@ func (p *Producer) cleanupMetadataImpl(id int, vbsToCleanup []uint16, undeployWG
 
 		vbuuid, _, _ := flog.Latest()
 
-		logging.Debugf("%s [%s:%d:id_%d] vb: %d starting DCP feed",
+		logging.AppDebugf(p.appName, "%s [%s:%d:id_%d] vb: %d starting DCP feed",
 			logPrefix, p.appName, p.LenRunningConsumers(), id, vb)
 
 		util.Retry(util.NewFixedBackoff(time.Second), &p.retryCount, openDcpStreamFromZero, dcpFeed, vb, vbuuid, p, id, &keyspaceExist)
@@ -797,6 +1029,14 @@ func (p *Producer) cleanupMetadataImpl(id int, vbsToCleanup []uint16, undeployWG
 
 		for {
 			select {
+			case <-deleteFailedCh:
+				dcpFeed.Close()
+				logging.Errorf("%s [%s:%d:id_%d] Closed dcpFeed spawned for cleaning up metadata bucket artifacts, as deletion failed",
+					logPrefix, p.appName, p.LenRunningConsumers(), id)
+
+				ticker.Stop()
+				return
+
 			case <-ticker.C:
 				receivedVbs := make([]uint16, 0)
 				rw.RLock()
@@ -838,12 +1078,21 @@ func (p *Producer) cleanupMetadataImpl(id int, vbsToCleanup []uint16, undeployWG
 				logging.Infof("%s [%s:%d:id_%d] Closed dcpFeed spawned for cleaning up metadata bucket artifacts",
 					logPrefix, p.appName, p.LenRunningConsumers(), id)
 
+				p.metadataCleanup.update(func(status *common.MetadataCleanupStatus) {
+					status.VbsCleanedUp += len(vbs)
+				})
+
 				ticker.Stop()
 				return
 			}
 		}
 	}(&wg, dcpFeed)
-	return nil
+
+	wg.Wait()
+
+	rw.RLock()
+	defer rw.RUnlock()
+	return deleteErr
 }
 
 // UpdateMemoryQuota allows tuning of memory quota for Eventing
@@ -865,6 +1114,14 @@ func (p *Producer) UpdateMemoryQuota(quota int64) {
 	}
 }
 
+// SetMemoryPressureLevel gets consumers to shed optional memory as per memory
+// pressure level of eventing-producer
+func (p *Producer) SetMemoryPressureLevel(level int) {
+	for _, c := range p.getConsumers() {
+		c.SetMemoryPressureLevel(level)
+	}
+}
+
 // TimerDebugStats captures timer related stats to assist in debugging mismtaches during rebalance
 func (p *Producer) TimerDebugStats() map[int]map[string]interface{} {
 	aggStats := make(map[int]map[string]interface{})
@@ -892,6 +1149,12 @@ func (p *Producer) TimerDebugStats() map[int]map[string]interface{} {
 				aggStats[vb]["timers_in_past_counter"] = timersInPastCounter
 				aggStats[vb]["timers_in_past_from_backfill_counter"] = timersInPastFromBackfill
 				aggStats[vb]["timers_recreated_from_dcp_backfill"] = timersCreatedFromBackfill
+
+				// Only the consumer owning vb has timer progress of it
+				if seqNo := stats["last_doc_timer_feedback_seqno"].(uint64); seqNo > aggStats[vb]["last_doc_timer_feedback_seqno"].(uint64) {
+					aggStats[vb]["last_doc_timer_feedback_seqno"] = seqNo
+					aggStats[vb]["timer_feedback_lag"] = stats["timer_feedback_lag"]
+				}
 			}
 		}
 	}
@@ -991,11 +1254,10 @@ func (p *Producer) VbSeqnoStats() map[int][]map[string]interface{} {
 
 // CleanupUDSs clears up UDS created for communication between Go and eventing-consumer
 func (p *Producer) CleanupUDSs() {
-	if p.processConfig.IPCType == "af_unix" {
+	if p.processConfig.IPCType == common.WorkerIPCUnix {
 
 		for _, c := range p.getConsumers() {
-			udsSockPath := fmt.Sprintf("%s/%s_%s.sock", os.TempDir(), p.nsServerHostPort, c.ConsumerName())
-			feedbackSockPath := fmt.Sprintf("%s/feedback_%s_%s.sock", os.TempDir(), p.nsServerHostPort, c.ConsumerName())
+			udsSockPath, feedbackSockPath := p.workerSockPaths(c.Index())
 
 			os.Remove(udsSockPath)
 			os.Remove(feedbackSockPath)
@@ -1053,7 +1315,7 @@ func (p *Producer) CheckpointBlobDump() map[string]interface{} {
 
 	for vb := 0; vb < p.numVbuckets; vb++ {
 		vbBlob := make(map[string]interface{})
-		vbKey := fmt.Sprintf("%s::vb::%d", p.appName, vb)
+		vbKey := common.CheckpointBlobKey(p.appName, uint16(vb))
 		err := util.Retry(util.NewFixedBackoff(bucketOpRetryInterval), &p.retryCount, getOpCallback, p, p.AddMetadataPrefix(vbKey), &vbBlob)
 		if err == common.ErrRetryTimeout {
 			logging.Errorf("%s [%s:%d] Exiting due to timeout", logPrefix, p.appName, p.LenRunningConsumers())
@@ -1102,14 +1364,21 @@ func (p *Producer) GetMetaStoreStats() map[string]uint64 {
 	return metaStats
 }
 
-// WriteDebuggerToken stores debugger token into metadata bucket
-func (p *Producer) WriteDebuggerToken(token string, hostnames []string) error {
+// WriteDebuggerToken stores debugger token into metadata bucket, session is stopped
+// once ttl lapses unless ttl is 0
+func (p *Producer) WriteDebuggerToken(token string, hostnames []string, replay *common.DebuggerReplay, ttl time.Duration) error {
 	logPrefix := "Producer::WriteDebuggerToken"
 
 	data := &common.DebuggerInstance{
 		Token:           token,
 		Status:          common.WaitingForMutation,
 		NodesExternalIP: hostnames,
+		Replay:          replay,
+		StartedAt:       time.Now(),
+	}
+
+	if ttl > 0 {
+		data.ExpiresAt = data.StartedAt.Add(ttl)
 	}
 
 	key := p.AddMetadataPrefix(p.app.AppName + "::" + common.DebuggerTokenKey)
@@ -1191,3 +1460,49 @@ func (p *Producer) AppendLatencyStats(deltas common.StatsData) {
 func (p *Producer) UndeployHandler(skipMetadataCleanup bool) {
 	p.undeployHandler <- skipMetadataCleanup
 }
+
+// VbEventingNodeAssignMapSnapshot returns the latest published vbucket to eventing node
+// assignment. Returned map is shared across callers and must not be modified
+func (p *Producer) VbEventingNodeAssignMapSnapshot() map[uint16]string {
+	if vbEventingNodeAssignMap, ok := p.vbEventingNodeAssignSnapshot.Load().(map[uint16]string); ok {
+		return vbEventingNodeAssignMap
+	}
+	return make(map[uint16]string)
+}
+
+// WorkerVbMapSnapshot returns the latest published worker to vbucket assignment.
+// Returned map is shared across callers and must not be modified
+func (p *Producer) WorkerVbMapSnapshot() map[string][]uint16 {
+	if workerVbucketMap, ok := p.workerVbMapSnapshot.Load().(map[string][]uint16); ok {
+		return workerVbucketMap
+	}
+	return make(map[string][]uint16)
+}
+
+// GetOwnershipMap returns vbucket to eventing node and worker assignment along with
+// stream status of vbuckets owned by workers on local eventing node
+func (p *Producer) GetOwnershipMap() *common.OwnershipMap {
+	ownership := &common.OwnershipMap{
+		VbEventingNodeAssignMap: p.VbEventingNodeAssignMapSnapshot(),
+		WorkerVbucketMap:        p.WorkerVbMapSnapshot(),
+		VbStreamStatus:          make(map[uint16]*common.VbOwnership),
+		PausedVbs:               p.GetPausedVbs().Vbs,
+	}
+
+	for _, c := range p.getConsumers() {
+		for vb, stats := range c.VbProcessingStats() {
+			assignedWorker, _ := stats["assigned_worker"].(string)
+			if assignedWorker != c.ConsumerName() {
+				continue
+			}
+
+			vbOwnership := &common.VbOwnership{AssignedWorker: assignedWorker}
+			vbOwnership.CurrentOwner, _ = stats["current_vb_owner"].(string)
+			vbOwnership.NodeUUID, _ = stats["node_uuid"].(string)
+			vbOwnership.StreamStatus, _ = stats["stream_status"].(string)
+			ownership.VbStreamStatus[vb] = vbOwnership
+		}
+	}
+
+	return ownership
+}
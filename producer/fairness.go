@@ -0,0 +1,102 @@
+package producer
+
+import (
+	"sync"
+	"time"
+
+	"github.com/couchbase/eventing/logging"
+)
+
+const (
+	// Upper bound on a single wait handed out to consumers, so that they get to
+	// notice pause, undeploy or rebalance while the function is over its quota
+	maxDcpQuotaWait = 100 * time.Millisecond
+)
+
+// throughputQuota is a token bucket shared by consumers of the function, which caps
+// rate at which they pull DCP events off their feeds. Up to a second worth of events
+// could be pulled in a burst
+type throughputQuota struct {
+	sync.Mutex
+	rate        float64 // Events per sec, 0 implies no quota
+	tokens      float64
+	lastRefill  time.Time
+	throttledMs uint64
+}
+
+func newThroughputQuota() *throughputQuota {
+	return &throughputQuota{}
+}
+
+func (q *throughputQuota) setRate(rate int) {
+	q.Lock()
+	defer q.Unlock()
+
+	q.rate = float64(rate)
+	q.tokens = q.rate
+	q.lastRefill = time.Now()
+}
+
+// reserve takes a token off the bucket. If none is available, it returns time to
+// wait before trying again
+func (q *throughputQuota) reserve() time.Duration {
+	q.Lock()
+	defer q.Unlock()
+
+	if q.rate <= 0 {
+		return 0
+	}
+
+	now := time.Now()
+	q.tokens += now.Sub(q.lastRefill).Seconds() * q.rate
+	if q.tokens > q.rate {
+		q.tokens = q.rate
+	}
+	q.lastRefill = now
+
+	if q.tokens >= 1 {
+		q.tokens--
+		return 0
+	}
+
+	wait := time.Duration((1 - q.tokens) / q.rate * float64(time.Second))
+	if wait > maxDcpQuotaWait {
+		wait = maxDcpQuotaWait
+	}
+	q.throttledMs += uint64(wait / time.Millisecond)
+	return wait
+}
+
+func (q *throughputQuota) throttled() uint64 {
+	q.Lock()
+	defer q.Unlock()
+
+	return q.throttledMs
+}
+
+// ReserveDcpQuota is called by consumers before pulling an event off their DCP feed,
+// returns time they ought to wait if the function is over its dcp_throughput_quota
+func (p *Producer) ReserveDcpQuota() time.Duration {
+	return p.dcpQuota.reserve()
+}
+
+// applyCPPThreadQuota caps cpp_worker_thread_count so that C++ worker threads spawned
+// for the function on this node stay within cpp_thread_quota. Every worker gets at
+// least a thread, even if worker_count exceeds the quota
+func (p *Producer) applyCPPThreadQuota() {
+	logPrefix := "Producer::applyCPPThreadQuota"
+
+	quota := p.handlerConfig.CPPThreadQuota
+	if quota <= 0 || p.handlerConfig.WorkerCount*p.handlerConfig.CPPWorkerThrCount <= quota {
+		return
+	}
+
+	thrCount := quota / p.handlerConfig.WorkerCount
+	if thrCount < 1 {
+		thrCount = 1
+	}
+
+	logging.Warnf("%s [%s] worker_count: %d with cpp_worker_thread_count: %d exceeds cpp_thread_quota: %d, spawning %d threads per worker instead",
+		logPrefix, p.appName, p.handlerConfig.WorkerCount, p.handlerConfig.CPPWorkerThrCount, quota, thrCount)
+	p.handlerConfig.CPPWorkerThrCount = thrCount
+}
@@ -0,0 +1,171 @@
+package producer
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/couchbase/eventing/common"
+	"github.com/couchbase/eventing/logging"
+	"github.com/couchbase/gocbcore/v9"
+)
+
+const (
+	// Metadata writes failing without a single success for this long, fence
+	// the function on this node
+	metadataFenceFailureWindow = 2 * time.Minute
+	metadataFenceMinFailures   = 10
+
+	metadataFenceProbeInterval = 10 * time.Second
+	metadataFenceProbeKey      = "eventing::fence_probe"
+)
+
+// metadataFence tracks health of metadata writes made by consumers. A node
+// with broken KV connectivity otherwise keeps claiming vb ownership while
+// it can't checkpoint, thrashing against owners on other nodes
+type metadataFence struct {
+	sync.Mutex
+	failures     uint64
+	firstFailure time.Time
+	fenced       bool
+	fencedSince  time.Time
+	fenceCounter uint64
+
+	totalFailures uint64
+}
+
+func newMetadataFence() *metadataFence {
+	return &metadataFence{}
+}
+
+// RecordMetadataWrite is called by consumers post every metadata write
+func (p *Producer) RecordMetadataWrite(err error) {
+	logPrefix := "Producer::RecordMetadataWrite"
+
+	f := p.metadataFence
+	f.Lock()
+	if err == nil {
+		f.failures = 0
+		f.firstFailure = time.Time{}
+		f.Unlock()
+		return
+	}
+
+	f.totalFailures++
+	f.failures++
+	if f.firstFailure.IsZero() {
+		f.firstFailure = time.Now()
+	}
+
+	if f.fenced || f.failures < metadataFenceMinFailures || time.Since(f.firstFailure) < metadataFenceFailureWindow {
+		f.Unlock()
+		return
+	}
+
+	f.fenced = true
+	f.fencedSince = time.Now()
+	f.fenceCounter++
+	failures, since := f.failures, f.firstFailure
+	f.Unlock()
+
+	logging.Errorf("%s [%s:%d] %d metadata writes failed since %v, last err: %v. Fencing function on this node",
+		logPrefix, p.appName, p.LenRunningConsumers(), failures, since.Format(time.RFC3339), err)
+	p.recordError("Fenced as %d metadata writes failed since %s, last err: %v", failures, since.Format(time.RFC3339), err)
+
+	go p.fence()
+}
+
+// fence gets consumers to give up ownership of all vbs and stop processing,
+// till metadata writes are found to be working again
+func (p *Producer) fence() {
+	logPrefix := "Producer::fence"
+
+	for _, c := range p.getConsumers() {
+		c.Fence()
+	}
+
+	logging.Infof("%s [%s:%d] Fenced consumers, probing metadata bucket every %v",
+		logPrefix, p.appName, p.LenRunningConsumers(), metadataFenceProbeInterval)
+
+	ctx := p.ctx
+	probeTicker := time.NewTicker(metadataFenceProbeInterval)
+	defer probeTicker.Stop()
+
+	for {
+		select {
+		case <-probeTicker.C:
+			if err := p.probeMetadataWrite(); err != nil {
+				logging.AppDebugf(p.appName, "%s [%s:%d] Metadata write probe failed, err: %v",
+					logPrefix, p.appName, p.LenRunningConsumers(), err)
+				continue
+			}
+
+			p.unfence()
+			return
+
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (p *Producer) unfence() {
+	logPrefix := "Producer::unfence"
+
+	f := p.metadataFence
+	f.Lock()
+	fencedFor := time.Since(f.fencedSince)
+	f.fenced = false
+	f.failures = 0
+	f.firstFailure = time.Time{}
+	f.Unlock()
+
+	logging.Infof("%s [%s:%d] Metadata writes recovered after being fenced for %v, unfencing consumers",
+		logPrefix, p.appName, p.LenRunningConsumers(), fencedFor)
+
+	for _, c := range p.getConsumers() {
+		c.Unfence()
+	}
+}
+
+func (p *Producer) probeMetadataWrite() error {
+	p.metadataHandleMutex.RLock()
+	defer p.metadataHandleMutex.RUnlock()
+
+	if p.metadataHandle == nil {
+		return errors.New("metadata handle not initialized")
+	}
+
+	key := p.AddMetadataPrefix(metadataFenceProbeKey + "::" + p.uuid)
+	p.metaLatency.inject()
+	_, err := p.metadataHandle.Upsert(key.Raw(), time.Now().String(), nil)
+	if errors.Is(err, gocbcore.ErrShutdown) {
+		return nil
+	}
+	return err
+}
+
+// IsFenced reports if the function has been fenced on this node
+func (p *Producer) IsFenced() bool {
+	p.metadataFence.Lock()
+	defer p.metadataFence.Unlock()
+
+	return p.metadataFence.fenced
+}
+
+// GetFencingStatus returns fencing state of the function on this node
+func (p *Producer) GetFencingStatus() *common.FencingStatus {
+	f := p.metadataFence
+	f.Lock()
+	defer f.Unlock()
+
+	status := &common.FencingStatus{
+		Fenced:                f.fenced,
+		FenceCounter:          f.fenceCounter,
+		MetadataWriteFailures: f.totalFailures,
+	}
+	if f.fenced {
+		status.FencedSince = f.fencedSince.Format(time.RFC3339)
+	}
+	return status
+}
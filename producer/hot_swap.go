@@ -0,0 +1,104 @@
+package producer
+
+import (
+	"github.com/couchbase/eventing/common"
+	"github.com/couchbase/eventing/gen/flatbuf/cfg"
+	"github.com/couchbase/eventing/logging"
+	"github.com/couchbase/eventing/parser"
+	"github.com/couchbase/eventing/util"
+)
+
+// hotSwapOnRevision loads handler code saved in primary store into running consumers
+// once hot_swap_revision in settings moves past the revision producer has loaded
+func (p *Producer) hotSwapOnRevision(settings map[string]interface{}) {
+	logPrefix := "Producer::hotSwapOnRevision"
+
+	revision, _ := settings["hot_swap_revision"].(float64)
+	if revision == p.hotSwapRevision {
+		return
+	}
+
+	var cfgData []byte
+	err := util.Retry(util.NewFixedBackoff(bucketOpRetryInterval), &p.retryCount, metakvAppCallback,
+		p, metakvAppsPath, metakvChecksumPath, p.appName, &cfgData)
+	if err == common.ErrRetryTimeout {
+		logging.Errorf("%s [%s:%d] Exiting due to timeout", logPrefix, p.appName, p.LenRunningConsumers())
+		return
+	}
+
+	config := cfg.GetRootAsConfig(cfgData, 0)
+	appCode := string(config.AppCode())
+	p.hotSwapRevision = revision
+	p.cfgData = string(cfgData)
+
+	if appCode == p.app.AppCode {
+		return
+	}
+
+	status, err := p.hotSwapAppCode(appCode)
+	if err != nil || !status.CompileSuccess {
+		logging.Errorf("%s [%s:%d] Hot swap revision: %v failed, status: %+v err: %v",
+			logPrefix, p.appName, p.LenRunningConsumers(), revision, status, err)
+		return
+	}
+
+	logging.Infof("%s [%s:%d] Hot swap revision: %v rolled out", logPrefix, p.appName, p.LenRunningConsumers(), revision)
+}
+
+// hotSwapAppCode pushes updated handler code to running consumers one after another,
+// without tearing down their DCP streams. Each worker compile checks the code before
+// loading it, if any of them rejects it consumers swapped so far are rolled back to
+// the code they were running
+func (p *Producer) hotSwapAppCode(appCode string) (*common.CompileStatus, error) {
+	logPrefix := "Producer::hotSwapAppCode"
+
+	p.hotSwapMutex.Lock()
+	defer p.hotSwapMutex.Unlock()
+
+	// Timer store is set up at deploy based on timer usage, which a swap can't revisit
+	if parser.UsingTimer(appCode) != p.isUsingTimer {
+		return nil, common.ErrHotSwapTimerUse
+	}
+
+	n1qlParams := "{ 'consistency': '" + p.handlerConfig.N1qlConsistency + "' }"
+	parsedAppCode, _ := parser.TranspileQueries(appCode, n1qlParams)
+	prevAppCode := p.app.ParsedAppCode
+
+	status := &common.CompileStatus{CompileSuccess: true}
+	swapped := make([]common.EventingConsumer, 0)
+
+	for _, c := range p.getConsumers() {
+		var err error
+		status, err = c.HotSwapAppCode(parsedAppCode)
+		if err != nil || !status.CompileSuccess {
+			logging.Errorf("%s [%s:%d] Hot swap failed on consumer: %s, rolling back %d consumers, err: %v",
+				logPrefix, p.appName, p.LenRunningConsumers(), c.ConsumerName(), len(swapped), err)
+			p.rollbackHotSwap(swapped, prevAppCode)
+			return status, err
+		}
+		swapped = append(swapped, c)
+	}
+
+	p.app.AppCode = appCode
+	p.isUsingN1ql = parser.UsingN1QL(appCode)
+	p.app.ParsedAppCode = parsedAppCode
+	p.app.SourceMap = common.NewSourceMap(p.app.AppName, p.handlerConfig.HandlerHeaders,
+		p.app.ParsedAppCode, p.handlerConfig.HandlerFooters)
+
+	logging.Infof("%s [%s:%d] Handler code hot swapped on %d consumers",
+		logPrefix, p.appName, p.LenRunningConsumers(), len(swapped))
+	return status, nil
+}
+
+// rollbackHotSwap loads code consumers were running prior to an aborted hot swap
+func (p *Producer) rollbackHotSwap(consumers []common.EventingConsumer, appCode string) {
+	logPrefix := "Producer::rollbackHotSwap"
+
+	for _, c := range consumers {
+		status, err := c.HotSwapAppCode(appCode)
+		if err != nil || !status.CompileSuccess {
+			logging.Errorf("%s [%s:%d] Failed to roll back consumer: %s, err: %v",
+				logPrefix, p.appName, p.LenRunningConsumers(), c.ConsumerName(), err)
+		}
+	}
+}
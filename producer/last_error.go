@@ -0,0 +1,41 @@
+package producer
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/couchbase/eventing/common"
+)
+
+// lastErrorTracker retains most recent error encountered by the function on this
+// node, surfaced as part of status summary
+type lastErrorTracker struct {
+	sync.RWMutex
+	err *common.FunctionError
+}
+
+func (p *Producer) recordError(format string, args ...interface{}) {
+	t := p.lastError
+	t.Lock()
+	defer t.Unlock()
+
+	t.err = &common.FunctionError{
+		Message:   fmt.Sprintf(format, args...),
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+	}
+}
+
+// GetLastError returns most recent error encountered by the function on this node
+func (p *Producer) GetLastError() *common.FunctionError {
+	t := p.lastError
+	t.RLock()
+	defer t.RUnlock()
+
+	if t.err == nil {
+		return nil
+	}
+
+	err := *t.err
+	return &err
+}
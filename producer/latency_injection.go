@@ -0,0 +1,57 @@
+package producer
+
+import (
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// latencyInjector delays a share of metadata bucket ops made by producer and its
+// consumers, so that behaviour of checkpointing, vb ownership and rebalance under
+// slow KV can be verified. Meant for resilience testing, off unless
+// metadata_latency_inject_percent and metadata_latency_inject_ms are both set
+type latencyInjector struct {
+	sync.RWMutex
+	percent int
+	delay   time.Duration
+
+	injected   uint64
+	injectedMs uint64
+}
+
+func newLatencyInjector() *latencyInjector {
+	return &latencyInjector{}
+}
+
+func (l *latencyInjector) setConfig(percent, delayMs int) {
+	l.Lock()
+	defer l.Unlock()
+
+	l.percent = percent
+	l.delay = time.Duration(delayMs) * time.Millisecond
+}
+
+func (l *latencyInjector) inject() {
+	l.RLock()
+	percent, delay := l.percent, l.delay
+	l.RUnlock()
+
+	if percent <= 0 || delay <= 0 || rand.Intn(100) >= percent {
+		return
+	}
+
+	time.Sleep(delay)
+	atomic.AddUint64(&l.injected, 1)
+	atomic.AddUint64(&l.injectedMs, uint64(delay/time.Millisecond))
+}
+
+func (l *latencyInjector) stats() (uint64, uint64) {
+	return atomic.LoadUint64(&l.injected), atomic.LoadUint64(&l.injectedMs)
+}
+
+// InjectMetadataLatency is called ahead of metadata bucket ops, delays the caller
+// as per metadata_latency_inject_percent and metadata_latency_inject_ms
+func (p *Producer) InjectMetadataLatency() {
+	p.metaLatency.inject()
+}
@@ -0,0 +1,128 @@
+package producer
+
+import (
+	"sync"
+	"time"
+
+	"github.com/couchbase/eventing/common"
+	"github.com/couchbase/eventing/logging"
+)
+
+// consumerLiveness tracks heartbeats of consumers, keyed by worker name. Consumers
+// yet to heartbeat are accounted since they were first noticed by producer
+type consumerLiveness struct {
+	sync.RWMutex
+	heartbeats map[string]*common.ConsumerHeartbeat
+	firstSeen  map[string]time.Time
+	stale      map[string]bool
+}
+
+func newConsumerLiveness() *consumerLiveness {
+	return &consumerLiveness{
+		heartbeats: make(map[string]*common.ConsumerHeartbeat),
+		firstSeen:  make(map[string]time.Time),
+		stale:      make(map[string]bool),
+	}
+}
+
+// ConsumerHeartbeat is called periodically by consumers from their control routine
+func (p *Producer) ConsumerHeartbeat(heartbeat *common.ConsumerHeartbeat) {
+	logPrefix := "Producer::ConsumerHeartbeat"
+
+	p.liveness.Lock()
+	defer p.liveness.Unlock()
+
+	p.liveness.heartbeats[heartbeat.Worker] = heartbeat
+	if p.liveness.stale[heartbeat.Worker] {
+		delete(p.liveness.stale, heartbeat.Worker)
+		logging.Infof("%s [%s:%d] Consumer: %s heartbeating again, no longer stale",
+			logPrefix, p.appName, p.LenRunningConsumers(), heartbeat.Worker)
+	}
+}
+
+// GetLiveness returns liveness of running consumers, as per their heartbeats
+func (p *Producer) GetLiveness() []*common.ConsumerLiveness {
+	consumers := p.getConsumers()
+	now := time.Now()
+
+	p.liveness.Lock()
+	defer p.liveness.Unlock()
+
+	running := make(map[string]struct{}, len(consumers))
+	liveness := make([]*common.ConsumerLiveness, 0, len(consumers))
+	for _, c := range consumers {
+		workerName := c.ConsumerName()
+		running[workerName] = struct{}{}
+
+		since, ok := p.liveness.firstSeen[workerName]
+		if !ok {
+			since = now
+			p.liveness.firstSeen[workerName] = now
+		}
+
+		heartbeat, ok := p.liveness.heartbeats[workerName]
+		if ok {
+			since = heartbeat.Timestamp
+		}
+
+		missed := int(now.Sub(since) / common.ConsumerHeartbeatInterval)
+		liveness = append(liveness, &common.ConsumerLiveness{
+			Worker:           workerName,
+			Stale:            missed >= common.ConsumerStaleAfter,
+			MissedHeartbeats: missed,
+			LastHeartbeat:    heartbeat,
+		})
+	}
+
+	for workerName := range p.liveness.firstSeen {
+		if _, ok := running[workerName]; !ok {
+			p.liveness.forget(workerName)
+		}
+	}
+	return liveness
+}
+
+// forget purges heartbeats of a consumer, so that its respawned instance isn't held
+// to heartbeats of the earlier one. Caller is expected to hold the lock
+func (l *consumerLiveness) forget(workerName string) {
+	delete(l.firstSeen, workerName)
+	delete(l.heartbeats, workerName)
+	delete(l.stale, workerName)
+}
+
+// monitorConsumerLiveness flags consumers which miss heartbeats, so that stuck
+// consumers get noticed without anyone looking up /liveness
+func (p *Producer) monitorConsumerLiveness() {
+	logPrefix := "Producer::monitorConsumerLiveness"
+
+	ticker := time.NewTicker(common.ConsumerHeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			for _, liveness := range p.GetLiveness() {
+				if !liveness.Stale {
+					continue
+				}
+
+				p.liveness.Lock()
+				alreadyStale := p.liveness.stale[liveness.Worker]
+				p.liveness.stale[liveness.Worker] = true
+				p.liveness.Unlock()
+
+				if alreadyStale {
+					continue
+				}
+
+				logging.Warnf("%s [%s:%d] Consumer: %s is stale, missed %d heartbeats",
+					logPrefix, p.appName, p.LenRunningConsumers(), liveness.Worker, liveness.MissedHeartbeats)
+				p.recordError("Consumer: %s is stale, missed %d heartbeats", liveness.Worker, liveness.MissedHeartbeats)
+			}
+
+		case <-p.ctx.Done():
+			logging.Infof("%s [%s:%d] Got message on stop chan, exiting", logPrefix, p.appName, p.LenRunningConsumers())
+			return
+		}
+	}
+}
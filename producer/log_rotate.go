@@ -29,6 +29,9 @@ type appLogCloser struct {
 
 	size int64
 
+	// Set when node-level retention asks for rotation ahead of maxSize
+	rotate int32
+
 	exitCh chan struct{}
 }
 
@@ -154,7 +157,7 @@ func (wc *appLogCloser) cleanupTask() {
 			return
 		default:
 		}
-		if atomic.LoadInt64(&wc.size) > atomic.LoadInt64(&wc.maxSize) {
+		if atomic.LoadInt64(&wc.size) > atomic.LoadInt64(&wc.maxSize) || atomic.CompareAndSwapInt32(&wc.rotate, 1, 0) {
 			wc.manageLogFiles()
 		} else {
 			wc.Flush()
@@ -163,6 +166,11 @@ func (wc *appLogCloser) cleanupTask() {
 	}
 }
 
+// requestRotation gets current log file rotated by cleanup task, irrespective of its size
+func (wc *appLogCloser) requestRotation() {
+	atomic.StoreInt32(&wc.rotate, 1)
+}
+
 func (wc *appLogCloser) init() {
 	go wc.cleanupTask()
 }
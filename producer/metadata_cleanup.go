@@ -0,0 +1,68 @@
+package producer
+
+import (
+	"sync"
+	"time"
+
+	"github.com/couchbase/eventing/common"
+)
+
+const (
+	metadataCleanupRunning   = "running"
+	metadataCleanupCompleted = "completed"
+	metadataCleanupFailed    = "failed"
+
+	// Attempts made at clearing up vbuckets, whose cleanup routine ran into errors
+	metadataCleanupMaxAttempts   = 3
+	metadataCleanupRetryInterval = 5 * time.Second
+)
+
+// metadataCleanupTracker captures progress of metadata cleanup post undeploy
+type metadataCleanupTracker struct {
+	sync.Mutex
+	status *common.MetadataCleanupStatus
+}
+
+func (t *metadataCleanupTracker) start(vbsToCleanup int) {
+	t.Lock()
+	defer t.Unlock()
+
+	t.status = &common.MetadataCleanupStatus{
+		State:        metadataCleanupRunning,
+		StartTs:      time.Now().Format(time.RFC3339),
+		VbsToCleanup: vbsToCleanup,
+	}
+}
+
+func (t *metadataCleanupTracker) update(fn func(status *common.MetadataCleanupStatus)) {
+	t.Lock()
+	defer t.Unlock()
+
+	if t.status != nil {
+		fn(t.status)
+	}
+}
+
+func (t *metadataCleanupTracker) finish(err error) {
+	t.update(func(status *common.MetadataCleanupStatus) {
+		status.State = metadataCleanupCompleted
+		if err != nil {
+			status.State = metadataCleanupFailed
+			status.LastError = err.Error()
+		}
+		status.EndTs = time.Now().Format(time.RFC3339)
+	})
+}
+
+// GetMetadataCleanupStatus returns progress of latest metadata cleanup, if any
+func (p *Producer) GetMetadataCleanupStatus() *common.MetadataCleanupStatus {
+	t := p.metadataCleanup
+	t.Lock()
+	defer t.Unlock()
+
+	if t.status == nil {
+		return nil
+	}
+	status := *t.status
+	return &status
+}
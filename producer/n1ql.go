@@ -0,0 +1,85 @@
+package producer
+
+import (
+	"net"
+	"sync/atomic"
+	"unsafe"
+
+	"github.com/couchbase/eventing/common"
+	"github.com/couchbase/eventing/logging"
+	"github.com/couchbase/eventing/util"
+)
+
+// refreshQueryNodes picks up query nodes in the cluster. Handlers issuing N1QL fail
+// every query while there are none, which is flagged upfront instead of per query
+func (p *Producer) refreshQueryNodes() {
+	logPrefix := "Producer::refreshQueryNodes"
+
+	hostAddress := net.JoinHostPort(util.Localhost(), p.nsServerPort)
+	queryNodeAddrs, err := util.QueryNodesAddresses(p.auth, hostAddress)
+	if err != nil {
+		logging.Errorf("%s [%s:%d] Failed to get query nodes, err: %v",
+			logPrefix, p.appName, p.LenRunningConsumers(), err)
+		return
+	}
+
+	prevQueryNodeAddrs := p.getQueryNodeAddrs()
+	atomic.StorePointer(
+		(*unsafe.Pointer)(unsafe.Pointer(&p.queryNodeAddrs)), unsafe.Pointer(&queryNodeAddrs))
+
+	if util.CompareStringSlices(prevQueryNodeAddrs, queryNodeAddrs) {
+		return
+	}
+
+	if len(queryNodeAddrs) == 0 && p.isUsingN1ql {
+		logging.Warnf("%s [%s:%d] Handler issues N1QL but there are no query nodes in the cluster, queries will fail",
+			logPrefix, p.appName, p.LenRunningConsumers())
+		return
+	}
+	logging.Infof("%s [%s:%d] Got query nodes: %rs n1ql_timeout: %d",
+		logPrefix, p.appName, p.LenRunningConsumers(), queryNodeAddrs, p.handlerConfig.N1qlTimeout)
+}
+
+func (p *Producer) getQueryNodeAddrs() []string {
+	queryNodeAddrs := (*[]string)(atomic.LoadPointer(
+		(*unsafe.Pointer)(unsafe.Pointer(&p.queryNodeAddrs))))
+	if queryNodeAddrs != nil {
+		return *queryNodeAddrs
+	}
+	return nil
+}
+
+// AppendN1qlLatencyStats accumulates latency histogram deltas of queries issued by workers
+func (p *Producer) AppendN1qlLatencyStats(deltas common.StatsData) {
+	p.n1qlLatencyStats.Append(deltas)
+}
+
+// AggregateN1qlStats adds n1ql section of execution stats of a consumer to n1qlMap.
+// Counters are summed up, nested ones like error codes are summed up per key
+func (p *Producer) AggregateN1qlStats(in interface{}, n1qlMap map[string]interface{}) {
+	for key, val := range in.(map[string]interface{}) {
+		switch val := val.(type) {
+		case float64:
+			prev, _ := n1qlMap[key].(float64)
+			n1qlMap[key] = prev + val
+
+		case map[string]interface{}:
+			nested, ok := n1qlMap[key].(map[string]interface{})
+			if !ok {
+				nested = make(map[string]interface{})
+				n1qlMap[key] = nested
+			}
+			p.AggregateN1qlStats(val, nested)
+		}
+	}
+}
+
+// n1qlLatency returns latency histogram of queries, typed alike rest of n1ql section
+// so that it sums up the same way across nodes
+func (p *Producer) n1qlLatency() map[string]interface{} {
+	latency := make(map[string]interface{})
+	for bucket, count := range p.n1qlLatencyStats.Get() {
+		latency[bucket] = float64(count)
+	}
+	return latency
+}
@@ -1,12 +1,10 @@
 package producer
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
 	"math"
 	"net"
-	"os"
-	"runtime"
 	"sort"
 	"strings"
 	"sync"
@@ -51,6 +49,18 @@ func NewProducer(appName, debuggerPort, eventingPort, eventingSSLPort, eventingD
 		plannerNodeMappingsRWMutex:   &sync.RWMutex{},
 		undeployHandler:              make(chan bool, 2),
 		metadataHandleMutex:          &sync.RWMutex{},
+		metadataFence:                newMetadataFence(),
+		rebalanceTracker:             &rebalanceTracker{},
+		metadataCleanup:              &metadataCleanupTracker{},
+		lastError:                    &lastErrorTracker{},
+		pausedVbs:                    newPausedVbsTracker(),
+		workerRestarts:               newWorkerRestartTracker(),
+		rebalanceHistograms:          newRebalanceHistograms(),
+		liveness:                     newConsumerLiveness(),
+		dcpQuota:                     newThroughputQuota(),
+		metaLatency:                  newLatencyInjector(),
+		debuggerSessions:             newDebuggerSessionManager(),
+		hotSwapMutex:                 &sync.Mutex{},
 		MemoryQuota:                  memoryQuota,
 		retryCount:                   -1,
 		runningConsumersRWMutex:      &sync.RWMutex{},
@@ -59,7 +69,6 @@ func NewProducer(appName, debuggerPort, eventingPort, eventingSSLPort, eventingD
 		isSrcMutation:                true,
 		isUsingTimer:                 true,
 		statsRWMutex:                 &sync.RWMutex{},
-		stopCh:                       make(chan struct{}, 1),
 		stopUndeployWaitCh:           make(chan struct{}, 1),
 		superSup:                     superSup,
 		topologyChangeCh:             make(chan *common.TopologyChangeMsg, 10),
@@ -77,6 +86,7 @@ func NewProducer(appName, debuggerPort, eventingPort, eventingSSLPort, eventingD
 		rebalanceConfig:              &common.RebalanceConfig{},
 		latencyStats:                 util.NewStats(),
 		curlLatencyStats:             util.NewStats(),
+		n1qlLatencyStats:             util.NewStats(),
 	}
 
 	p.handlerConfig.SourceKeyspace = &common.Keyspace{}
@@ -87,6 +97,7 @@ func NewProducer(appName, debuggerPort, eventingPort, eventingSSLPort, eventingD
 	p.processConfig.EventingSSLPort = eventingSSLPort
 	p.processConfig.BreakpadOn = util.BreakpadOn()
 	p.eventingNodeUUIDs = append(p.eventingNodeUUIDs, uuid)
+	p.ctx, p.cancelCtx = context.WithCancel(context.Background())
 	p.parseDepcfg()
 
 	atomic.StoreUint32(&p.srcCid, math.MaxUint32)
@@ -137,6 +148,22 @@ func (p *Producer) Serve() {
 	}
 	atomic.StoreUint32(&p.srcCid, srcCid)
 
+	srcCids := map[uint32]string{srcCid: p.handlerConfig.SourceKeyspace.CollectionName}
+	for _, collection := range p.handlerConfig.SourceCollections {
+		cid, err := p.superSup.GetCollectionID(p.handlerConfig.SourceKeyspace.BucketName, p.handlerConfig.SourceKeyspace.ScopeName, collection)
+		if err == common.BucketNotWatched || err == collections.SCOPE_NOT_FOUND || err == collections.COLLECTION_NOT_FOUND {
+			p.undeployHandler <- false
+			logging.Errorf("%s [%s] source collection: %s not found %v", logPrefix, p.appName, collection, err)
+			return
+		}
+		if err != nil {
+			logging.Errorf("%s [%s] Error in getting id of source collection: %s, err: %v", logPrefix, p.appName, collection, err)
+			return
+		}
+		srcCids[cid] = collection
+	}
+	p.srcCids = srcCids
+
 	metaCid, err := p.superSup.GetCollectionID(p.metadataKeyspace.BucketName, p.metadataKeyspace.ScopeName, p.metadataKeyspace.CollectionName)
 	if err == common.BucketNotWatched || err == collections.SCOPE_NOT_FOUND || err == collections.COLLECTION_NOT_FOUND {
 		p.undeployHandler <- true
@@ -151,8 +178,13 @@ func (p *Producer) Serve() {
 
 	n1qlParams := "{ 'consistency': '" + p.handlerConfig.N1qlConsistency + "' }"
 	p.app.ParsedAppCode, _ = parser.TranspileQueries(p.app.AppCode, n1qlParams)
+	p.app.SourceMap = common.NewSourceMap(p.app.AppName, p.handlerConfig.HandlerHeaders,
+		p.app.ParsedAppCode, p.handlerConfig.HandlerFooters)
 
 	p.isUsingTimer = parser.UsingTimer(p.app.AppCode)
+	p.isUsingN1ql = parser.UsingN1QL(p.app.AppCode)
+	p.refreshQueryNodes()
+	p.loadPausedVbs()
 
 	p.updateStatsTicker = time.NewTicker(time.Duration(p.handlerConfig.CheckpointInterval) * time.Millisecond)
 
@@ -225,6 +257,7 @@ func (p *Producer) Serve() {
 	}
 
 	p.startBucket()
+	p.superSup.SubscribeBusTopics(p.appName, p.handlerConfig.SubscribeTopics)
 
 	p.bootstrapFinishCh <- struct{}{}
 
@@ -232,6 +265,7 @@ func (p *Producer) Serve() {
 	logging.Infof("%s [%s:%d] Bootstrapping status: %t", logPrefix, p.appName, p.LenRunningConsumers(), p.isBootstrapping)
 
 	go p.updateStats()
+	go p.monitorConsumerLiveness()
 
 	// Inserting twice because producer can be stopped either because of pause/undeploy
 	for i := 0; i < 2; i++ {
@@ -243,6 +277,8 @@ func (p *Producer) Serve() {
 		case msg := <-p.topologyChangeCh:
 			logging.Infof("%s [%s:%d] Got topology change msg: %rm from super_supervisor",
 				logPrefix, p.appName, p.LenRunningConsumers(), msg)
+			p.refreshQueryNodes()
+			p.loadPausedVbs()
 
 			switch msg.CType {
 			case common.StartRebalanceCType, common.StartFailoverCType:
@@ -253,6 +289,8 @@ func (p *Producer) Serve() {
 				// grab list of old kv nodes
 				oldKvNodes := p.getKvNodeAddrs()
 
+				prevAssignMap, _ := p.vbEventingNodeAssignSnapshot.Load().(map[uint16]string)
+
 				// vbEventingNodeAssign() would update list of KV nodes. We need them soon after this call
 				err = p.vbEventingNodeAssign(p.SourceBucket())
 				if err == common.ErrRetryTimeout {
@@ -302,45 +340,39 @@ func (p *Producer) Serve() {
 					p.firstRebalanceDone = true
 				}
 
+				p.startRebalanceReport(msg.CType, prevAssignMap)
+
 			case common.StopRebalanceCType:
 				for _, eventingConsumer := range p.getConsumers() {
 					logging.Infof("%s [%s:%d] Consumer: %s sent stop rebalance message from producer",
 						logPrefix, p.appName, p.LenRunningConsumers(), eventingConsumer.ConsumerName())
 					eventingConsumer.NotifyRebalanceStop()
 				}
+				p.finishRebalanceReport("stopped")
 			}
 
 			atomic.StoreInt32(&p.isRebalanceOngoing, 0)
 
 		case <-p.notifySettingsChangeCh:
-			logging.Infof("%s [%s:%d] Notifying consumers about settings change", logPrefix, p.appName, p.LenRunningConsumers())
-
-			for _, eventingConsumer := range p.getConsumers() {
-				eventingConsumer.NotifySettingsChange()
-			}
-
-			settingsPath := metakvAppSettingsPath + p.app.AppName
-			sData, err := util.MetakvGet(settingsPath)
+			// Consumers get notified by node-wide settings cache they've subscribed to
+			settings, revision, err := p.superSup.GetAppSettings(p.app.AppName)
 			if err != nil {
-				logging.Errorf("%s [%s:%d] Failed to fetch updated settings from metakv, err: %v",
+				logging.Errorf("%s [%s:%d] Failed to fetch updated settings, err: %v",
 					logPrefix, p.appName, p.LenRunningConsumers(), err)
 				continue
 			}
 
-			settings := make(map[string]interface{})
-			err = json.Unmarshal(sData, &settings)
-			if err != nil {
-				logging.Errorf("%s [%s:%d] Failed to unmarshal settings received from metakv, err: %v",
-					logPrefix, p.appName, p.LenRunningConsumers(), err)
-				continue
-			}
+			logging.Infof("%s [%s:%d] Applying settings revision: %d", logPrefix, p.appName, p.LenRunningConsumers(), revision)
 
 			logLevel, ok := settings["log_level"].(string)
 			if ok {
-				logging.SetLogLevel(util.GetLogLevel(logLevel))
+				logging.SetAppLogLevel(p.appName, util.GetLogLevel(logLevel))
 				p.updateAppLogSetting(settings)
 			}
 
+			p.applySettingsDelta(settings)
+			p.hotSwapOnRevision(settings)
+
 		case msg := <-p.stateChangeCh:
 			switch msg {
 			case pause:
@@ -410,10 +442,14 @@ func (p *Producer) Stop(context string) {
 		logPrefix, p.appName, p.LenRunningConsumers())
 
 	p.isTerminateRunning = true
+	logging.ClearAppLogLevel(p.appName)
 
 	close(p.stopUndeployWaitCh)
+	p.disarmDebuggerSessionExpiry()
+	p.superSup.UnsubscribeBusTopics(p.appName)
 	p.latencyStats.Close()
 	p.curlLatencyStats.Close()
+	p.n1qlLatencyStats.Close()
 
 	p.listenerRWMutex.RLock()
 	if p.consumerListeners != nil {
@@ -457,10 +493,7 @@ func (p *Producer) Stop(context string) {
 	logging.Infof("%s [%s:%d] Closed function log writer handle",
 		logPrefix, p.appName, p.LenRunningConsumers())
 
-	if !p.stopChClosed {
-		close(p.stopCh)
-		p.stopChClosed = true
-	}
+	p.cancelCtx()
 
 	if p.workerSupervisor != nil {
 		p.workerSupervisor.Stop(p.appName)
@@ -484,9 +517,7 @@ func (p *Producer) startBucket() {
 	for i := 0; i < p.handlerConfig.WorkerCount; i++ {
 		workerName := fmt.Sprintf("worker_%s_%d", p.appName, i)
 
-		p.workerVbMapRWMutex.RLock()
-		vbsAssigned := p.workerVbucketMap[workerName]
-		p.workerVbMapRWMutex.RUnlock()
+		vbsAssigned := p.WorkerVbMapSnapshot()[workerName]
 
 		p.handleV8Consumer(workerName, vbsAssigned, i, false)
 	}
@@ -499,93 +530,20 @@ func (p *Producer) handleV8Consumer(workerName string, vbnos []uint16, index int
 	defer p.handleV8ConsumerMutex.Unlock()
 
 	// Separate out of band socket to pipeline data from Eventing-consumer to Eventing-producer
-	var feedbackListener net.Listener
-
-	var listener net.Listener
-	var err error
-
-	// For windows use tcp socket based communication
-	// For linux/macos use unix domain sockets
-	// https://github.com/golang/go/issues/6895 - uds pathname limited to 108 chars
-
-	// Adding host port in uds path in order to make it across different nodes on a cluster_run setup
-	pathNameSuffix := fmt.Sprintf("%s_%d_%d.sock", p.nsServerHostPort, index, p.app.FunctionID)
-	udsSockPath := fmt.Sprintf("%s/%s", os.TempDir(), pathNameSuffix)
-	feedbackSockPath := fmt.Sprintf("%s/f_%s", os.TempDir(), pathNameSuffix)
-
-	logging.Infof("%s [%s:%d] udsSockPath len: %d dump: %s feedbackSockPath len: %d dump: %s",
-		logPrefix, p.appName, p.LenRunningConsumers(), len(udsSockPath), udsSockPath, len(feedbackSockPath), feedbackSockPath)
-
-	if runtime.GOOS == "windows" || len(feedbackSockPath) > udsSockPathLimit {
-		feedbackListener, err = net.Listen("tcp", net.JoinHostPort(util.Localhost(), "0"))
-		if err != nil {
-			logging.Errorf("%s [%s:%d] Failed to listen on feedback tcp port, err: %v", logPrefix, p.appName, p.LenRunningConsumers(), err)
-		}
-
-		_, p.processConfig.FeedbackSockIdentifier, err = net.SplitHostPort(feedbackListener.Addr().String())
-		if err != nil {
-			logging.Errorf("%s [%s:%d] Failed to parse feedback tcp port, err: %v", logPrefix, p.appName, p.LenRunningConsumers(), err)
-		}
-
-		listener, err = net.Listen("tcp", net.JoinHostPort(util.Localhost(), "0"))
-		if err != nil {
-			logging.Errorf("%s [%s:%d] Failed to listen on tcp port, err: %v", logPrefix, p.appName, p.LenRunningConsumers(), err)
-		}
-
-		_, p.processConfig.SockIdentifier, err = net.SplitHostPort(listener.Addr().String())
-		if err != nil {
-			logging.Errorf("%s [%s:%d] Failed to parse tcp port, err: %v", logPrefix, p.appName, p.LenRunningConsumers(), err)
-		}
-
-		p.processConfig.IPCType = "af_inet"
-
-	} else {
-		os.Remove(udsSockPath)
-		os.Remove(feedbackSockPath)
-
-		feedbackListener, err = net.Listen("unix", feedbackSockPath)
-		if err != nil {
-			logging.Errorf("%s [%s:%d] Failed to listen on feedback unix domain socket, err: %v", logPrefix, p.appName, p.LenRunningConsumers(), err)
-		}
-		p.processConfig.FeedbackSockIdentifier = feedbackSockPath
-
-		listener, err = net.Listen("unix", udsSockPath)
-		if err != nil {
-			logging.Errorf("%s [%s:%d] Failed to listen on unix domain socket, err: %v", logPrefix, p.appName, p.LenRunningConsumers(), err)
-		}
-		p.processConfig.SockIdentifier = udsSockPath
-
-		p.processConfig.IPCType = "af_unix"
+	listener, feedbackListener, err := p.listenForWorker(index)
+	if err != nil {
+		logging.Errorf("%s [%s:%d] Failed to set up sockets for worker: %s, err: %v",
+			logPrefix, p.appName, p.LenRunningConsumers(), workerName, err)
+		return
 	}
 
 	logging.Infof("%s [%s:%d] Spawning consumer to listen on socket: %rs feedback socket: %rs index: %d vbs len: %d dump: %s",
 		logPrefix, p.appName, p.LenRunningConsumers(), p.processConfig.SockIdentifier, p.processConfig.FeedbackSockIdentifier,
 		index, len(vbnos), util.Condense(vbnos))
 
-	vbEventingNodeAssignMap := make(map[uint16]string)
-	workerVbucketMap := make(map[string][]uint16)
-
-	func() {
-		p.vbEventingNodeAssignRWMutex.RLock()
-		defer p.vbEventingNodeAssignRWMutex.RUnlock()
-
-		for vb, node := range p.vbEventingNodeAssignMap {
-			vbEventingNodeAssignMap[vb] = node
-		}
-	}()
-
-	func() {
-		p.workerVbMapRWMutex.RLock()
-		defer p.workerVbMapRWMutex.RUnlock()
-
-		for workerName, assignedVbs := range p.workerVbucketMap {
-			workerVbucketMap[workerName] = assignedVbs
-		}
-	}()
-
 	c := consumer.NewConsumer(p.handlerConfig, p.processConfig, p.rebalanceConfig, index, p.uuid, p.nsServerPort,
 		p.eventingNodeUUIDs, vbnos, p.app, p.dcpConfig, p, p.superSup, p.numVbuckets,
-		&p.retryCount, vbEventingNodeAssignMap, workerVbucketMap)
+		&p.retryCount, p.VbEventingNodeAssignMapSnapshot(), p.WorkerVbMapSnapshot())
 
 	if notifyRebalance {
 		logging.Infof("%s [%s:%d] Consumer: %s notifying about cluster state change",
@@ -636,7 +594,12 @@ func (p *Producer) handleV8Consumer(workerName string, vbnos []uint16, index int
 					logging.Errorf("%s [%s:%d] Exiting due to timeout", logPrefix, p.appName, p.LenRunningConsumers())
 					return
 				}
-			case <-p.stopCh:
+				if err == common.ErrWorkerProtocolMismatch {
+					logging.Errorf("%s [%s:%d] Exiting as eventing-consumer binary doesn't match with eventing-producer",
+						logPrefix, p.appName, p.LenRunningConsumers())
+					return
+				}
+			case <-p.ctx.Done():
 				logging.Infof("%s [%s:%d] Got message on stop chan, exiting", logPrefix, p.appName, p.LenRunningConsumers())
 				return
 			}
@@ -665,7 +628,7 @@ func (p *Producer) handleV8Consumer(workerName string, vbnos []uint16, index int
 					logPrefix, p.appName, p.LenRunningConsumers(), c.ConsumerName(), c.Index(), accepted.conn)
 				c.SetFeedbackConnHandle(accepted.conn)
 				c.SignalFeedbackConnected()
-			case <-p.stopCh:
+			case <-p.ctx.Done():
 				logging.Infof("%s [%s:%d] Got message on stop chan, exiting feedback loop", logPrefix, p.appName, p.LenRunningConsumers())
 				return
 			}
@@ -674,11 +637,15 @@ func (p *Producer) handleV8Consumer(workerName string, vbnos []uint16, index int
 }
 
 // KillAndRespawnEventingConsumer cleans up a dead consumer handle from list of active running consumers
-func (p *Producer) KillAndRespawnEventingConsumer(c common.EventingConsumer) {
+// and restarts it, backing off if the worker has been restarted in quick succession. Respawned
+// consumer resumes streaming vbs it owns from their last checkpoint
+func (p *Producer) KillAndRespawnEventingConsumer(c common.EventingConsumer, exit *common.WorkerExit) {
 	logPrefix := "Producer::KillAndRespawnEventingConsumer"
 
 	p.superSup.IncWorkerRespawnedCount()
 	p.workerSpawnCounter++
+	p.recordError("Respawning worker: %s as it crashed or stopped responding, reason: %s exit status: %s",
+		c.ConsumerName(), exit.Reason, exit.ExitStatus)
 
 	consumerIndex := c.Index()
 
@@ -702,6 +669,10 @@ func (p *Producer) KillAndRespawnEventingConsumer(c common.EventingConsumer) {
 	delete(p.workerNameConsumerMap, c.ConsumerName())
 	p.workerNameConsumerMapRWMutex.Unlock()
 
+	p.liveness.Lock()
+	p.liveness.forget(c.ConsumerName())
+	p.liveness.Unlock()
+
 	logging.Infof("%s [%s:%d] IndexToPurge: %d ConsumerIndex: %d Shutting down Eventing.Consumer instance: %v",
 		logPrefix, p.appName, p.LenRunningConsumers(), indexToPurge, consumerIndex, c)
 
@@ -733,12 +704,30 @@ func (p *Producer) KillAndRespawnEventingConsumer(c common.EventingConsumer) {
 		return
 	}
 
+	workerName := fmt.Sprintf("worker_%s_%d", p.appName, consumerIndex)
+	backoff := p.workerRestarts.record(workerName, exit)
+	if backoff > 0 {
+		logging.Warnf("%s [%s:%d] ConsumerIndex: %d backing off for %v prior to respawning, worker has been restarted in quick succession",
+			logPrefix, p.appName, p.LenRunningConsumers(), consumerIndex, backoff)
+
+		select {
+		case <-time.After(backoff):
+		case <-p.ctx.Done():
+			logging.Infof("%s [%s:%d] ConsumerIndex: %d Not respawning consumer as the Function is stopping",
+				logPrefix, p.appName, p.LenRunningConsumers(), consumerIndex)
+			return
+		}
+
+		if p.isPausing {
+			logging.Infof("%s [%s:%d] Not respawning consumer as the Function is pausing",
+				logPrefix, p.appName, p.LenRunningConsumers())
+			return
+		}
+	}
+
 	logging.Infof("%s [%s:%d] ConsumerIndex: %d respawning the Eventing.Consumer instance",
 		logPrefix, p.appName, p.LenRunningConsumers(), consumerIndex)
-	workerName := fmt.Sprintf("worker_%s_%d", p.appName, consumerIndex)
-	p.workerVbMapRWMutex.RLock()
-	vbsAssigned := p.workerVbucketMap[workerName]
-	p.workerVbMapRWMutex.RUnlock()
+	vbsAssigned := p.WorkerVbMapSnapshot()[workerName]
 
 	p.handleV8Consumer(workerName, vbsAssigned, consumerIndex, true)
 }
@@ -762,11 +751,8 @@ func (p *Producer) getKvNodeAddrs() []string {
 }
 
 func (p *Producer) getEventingNodeAssignedVbuckets(eventingNode string) []uint16 {
-	p.vbEventingNodeAssignRWMutex.RLock()
-	defer p.vbEventingNodeAssignRWMutex.RUnlock()
-
 	var vbnos []uint16
-	for vbno, node := range p.vbEventingNodeAssignMap {
+	for vbno, node := range p.VbEventingNodeAssignMapSnapshot() {
 		if node == eventingNode {
 			vbnos = append(vbnos, vbno)
 		}
@@ -801,10 +787,41 @@ func (p *Producer) NotifyPrepareTopologyChange(ejectNodes, keepNodes []string, c
 	}
 }
 
-// SignalStartDebugger sets up necessary flags to signal debugger start
+// SignalStartDebugger sets up necessary flags to signal debugger start. If the session
+// asked for replay, consumer owning the vb spawns debugger with events retained for it
 func (p *Producer) SignalStartDebugger(token string) error {
+	logPrefix := "Producer::SignalStartDebugger"
+
 	p.debuggerToken = token
-	p.trapEvent = true
+
+	key := p.AddMetadataPrefix(p.app.AppName + "::" + common.DebuggerTokenKey)
+	var instance common.DebuggerInstance
+	err := util.Retry(util.NewFixedBackoff(bucketOpRetryInterval), &p.retryCount, getOpCallback, p, key, &instance)
+	if err == common.ErrRetryTimeout {
+		logging.Errorf("%s [%s:%d] Exiting due to timeout, debugger would trap next mutation",
+			logPrefix, p.appName, p.LenRunningConsumers())
+		p.trapEvent = true
+		return err
+	}
+
+	if instance.Token == token {
+		p.armDebuggerSessionExpiry(instance)
+	}
+
+	if instance.Token != token || instance.Replay == nil {
+		p.trapEvent = true
+		go p.watchDebuggerTrap(token)
+		return nil
+	}
+
+	for _, c := range p.getConsumers() {
+		if c.ReplayToDebugger(instance.Replay.Vbucket, instance.Replay.Count) {
+			return nil
+		}
+	}
+
+	logging.Infof("%s [%s:%d] vb: %d not owned by this node, skipping replay",
+		logPrefix, p.appName, p.LenRunningConsumers(), instance.Replay.Vbucket)
 	return nil
 }
 
@@ -820,12 +837,15 @@ func (p *Producer) SignalStopDebugger() error {
 		return err
 	}
 
+	// Session which is yet to trap a mutation is stopped right away on this node,
+	// traps on other nodes are torn down once they see the session gone
 	consumers := p.getConsumers()
-	if consumers[0].HostPortAddr() != instance.Host {
+	if instance.Host != "" && consumers[0].HostPortAddr() != instance.Host {
 		util.StopDebugger(instance.Host, p.appName)
 		return nil
 	}
 
+	p.disarmDebuggerSessionExpiry()
 	p.trapEvent = false
 	p.debuggerToken = ""
 	for _, c := range consumers {
@@ -841,8 +861,8 @@ func (p *Producer) SignalStopDebugger() error {
 	return nil
 }
 
-// GetDebuggerURL returns V8 Debugger url
-func (p *Producer) GetDebuggerURL() (string, error) {
+// GetDebuggerURL returns V8 Debugger url, only to callers holding token of the session
+func (p *Producer) GetDebuggerURL(token string) (string, error) {
 	logPrefix := "Producer::GetDebuggerURL"
 
 	var instance common.DebuggerInstance
@@ -854,6 +874,10 @@ func (p *Producer) GetDebuggerURL() (string, error) {
 		return "", common.ErrRetryTimeout
 	}
 
+	if instance.Token != "" && instance.Token != token {
+		return "", common.ErrDebuggerTokenMismatch
+	}
+
 	return instance.URL, nil
 }
 
@@ -877,7 +901,7 @@ func (p *Producer) updateStats() {
 				return
 			}
 
-		case <-p.stopCh:
+		case <-p.ctx.Done():
 			logging.Infof("%s [%s:%d] Got message on stop chan, exiting", logPrefix, p.appName, p.LenRunningConsumers())
 			p.updateStatsTicker.Stop()
 			return
@@ -921,6 +945,30 @@ func (p *Producer) undeployHandlerWait() {
 	}
 }
 
+// CancelTimer cancels a timer created by the function. Timer store is shared by all
+// eventing nodes, so any of the running consumers can remove the timer
+func (p *Producer) CancelTimer(callback, reference string) error {
+	consumers := p.getConsumers()
+	if len(consumers) == 0 {
+		return fmt.Errorf("no running consumers for function: %s", p.appName)
+	}
+	return consumers[0].CancelTimer(callback, reference)
+}
+
+// VerifyTimerStore verifies timer store of given vbs owned by consumers on this node,
+// all owned vbs if none are specified
+func (p *Producer) VerifyTimerStore(vbs []uint16, policy string) ([]*common.TimerIntegrityReport, error) {
+	if !p.UsingTimer() {
+		return nil, common.ErrTimersNotInUse
+	}
+
+	reports := make([]*common.TimerIntegrityReport, 0)
+	for _, c := range p.getConsumers() {
+		reports = append(reports, c.VerifyTimerStore(vbs, policy)...)
+	}
+	return reports, nil
+}
+
 func (p *Producer) getConsumers() []common.EventingConsumer {
 	workers := make([]common.EventingConsumer, 0)
 
@@ -986,10 +1034,7 @@ func (p *Producer) pauseProducer() error {
 		p.appLogWriter.Close()
 	}
 
-	if !p.stopChClosed {
-		close(p.stopCh)
-		p.stopChClosed = true
-	}
+	p.cancelCtx()
 
 	p.isPausing = false
 	return nil
@@ -997,8 +1042,7 @@ func (p *Producer) pauseProducer() error {
 
 func (p *Producer) resumeProducer() error {
 	p.isBootstrapping = true
-	p.stopChClosed = false
-	p.stopCh = make(chan struct{}, 1)
+	p.ctx, p.cancelCtx = context.WithCancel(context.Background())
 
 	err := p.parseDepcfg()
 	if err == common.ErrRetryTimeout {
@@ -1019,9 +1063,13 @@ func (p *Producer) resumeProducer() error {
 
 	n1qlParams := "{ 'consistency': '" + p.handlerConfig.N1qlConsistency + "' }"
 	p.app.ParsedAppCode, _ = parser.TranspileQueries(p.app.AppCode, n1qlParams)
+	p.app.SourceMap = common.NewSourceMap(p.app.AppName, p.handlerConfig.HandlerHeaders,
+		p.app.ParsedAppCode, p.handlerConfig.HandlerFooters)
 	p.updateStatsTicker = time.NewTicker(time.Duration(p.handlerConfig.CheckpointInterval) * time.Millisecond)
 
 	p.isUsingTimer = parser.UsingTimer(p.app.AppCode)
+	p.isUsingN1ql = parser.UsingN1QL(p.app.AppCode)
+	p.refreshQueryNodes()
 
 	p.isPlannerRunning = true
 	p.vbNodeWorkerMap()
@@ -1029,11 +1077,13 @@ func (p *Producer) resumeProducer() error {
 	p.isPlannerRunning = false
 
 	p.startBucket()
+	p.superSup.SubscribeBusTopics(p.appName, p.handlerConfig.SubscribeTopics)
 
 	p.bootstrapFinishCh <- struct{}{}
 
 	p.isBootstrapping = false
 	go p.updateStats()
+	go p.monitorConsumerLiveness()
 	for i := len(p.notifyInitCh); i < 2; i++ {
 		p.notifyInitCh <- struct{}{}
 	}
@@ -0,0 +1,42 @@
+package producer
+
+import (
+	"time"
+
+	"github.com/couchbase/eventing/common"
+	"github.com/couchbase/eventing/util"
+)
+
+// Upper bounds of histogram buckets in milliseconds per rebalance phase. vb takeover
+// and timer transfer span metadata updates and cpp worker round trips, whereas stream
+// open is a single round trip to KV
+var rebalanceHistogramBoundsMs = map[string][]int64{
+	common.RebalanceVbTakeover:    {10, 50, 100, 250, 500, 1000, 2500, 5000, 10000, 30000, 60000},
+	common.RebalanceTimerTransfer: {10, 50, 100, 250, 500, 1000, 2500, 5000, 10000, 30000, 60000},
+	common.RebalanceStreamOpen:    {1, 5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000},
+}
+
+func newRebalanceHistograms() map[string]*util.Histogram {
+	histograms := make(map[string]*util.Histogram, len(rebalanceHistogramBoundsMs))
+	for phase, boundsMs := range rebalanceHistogramBoundsMs {
+		histograms[phase] = util.NewHistogram(boundsMs)
+	}
+	return histograms
+}
+
+// RecordRebalanceDuration is called by consumers as a vb makes it through one of the
+// rebalance phases. Histograms are held by producer, so that they survive respawns
+func (p *Producer) RecordRebalanceDuration(phase string, d time.Duration) {
+	if h, ok := p.rebalanceHistograms[phase]; ok {
+		h.Observe(d)
+	}
+}
+
+// GetRebalanceHistograms returns distribution of durations per rebalance phase
+func (p *Producer) GetRebalanceHistograms() map[string]*common.Histogram {
+	histograms := make(map[string]*common.Histogram, len(p.rebalanceHistograms))
+	for phase, h := range p.rebalanceHistograms {
+		histograms[phase] = h.Snapshot()
+	}
+	return histograms
+}
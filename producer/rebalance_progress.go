@@ -0,0 +1,62 @@
+package producer
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/couchbase/eventing/common"
+)
+
+// GetRebalanceProgress aggregates vbucket ownership transfer progress across
+// running consumers. Completion is estimated from rate at which vbs have been
+// moved since the earliest worker started its vbsStateUpdate run
+func (p *Producer) GetRebalanceProgress() *common.AppRebalanceProgress {
+	progress := &common.AppRebalanceProgress{
+		RebalanceOngoing: atomic.LoadInt32(&p.isRebalanceOngoing) == 1,
+		Workers:          make(map[string]*common.WorkerRebalanceProgress),
+	}
+
+	var startTime, lastProgressTime time.Time
+	for _, c := range p.getConsumers() {
+		workerProgress := c.GetRebalanceProgress()
+		progress.Workers[c.ConsumerName()] = workerProgress
+
+		progress.VbsRemainingToOwn += len(workerProgress.VbsRemainingToOwn)
+		progress.VbsRemainingToGiveUp += len(workerProgress.VbsRemainingToGiveUp)
+
+		if !workerProgress.Running {
+			continue
+		}
+		progress.RebalanceOngoing = true
+		progress.VbsToMove += workerProgress.VbsToOwn + workerProgress.VbsToGiveUp
+
+		if ts, err := time.Parse(time.RFC3339, workerProgress.StartTime); err == nil {
+			if startTime.IsZero() || ts.Before(startTime) {
+				startTime = ts
+			}
+		}
+		if ts, err := time.Parse(time.RFC3339, workerProgress.LastProgressTime); err == nil {
+			if ts.After(lastProgressTime) {
+				lastProgressTime = ts
+			}
+		}
+	}
+
+	if startTime.IsZero() {
+		return progress
+	}
+	progress.StartTime = startTime.Format(time.RFC3339)
+	progress.LastProgressTime = lastProgressTime.Format(time.RFC3339)
+
+	remaining := progress.VbsRemainingToOwn + progress.VbsRemainingToGiveUp
+	moved := progress.VbsToMove - remaining
+	if moved <= 0 || remaining <= 0 {
+		return progress
+	}
+
+	elapsed := time.Since(startTime)
+	eta := time.Duration(float64(elapsed) * float64(remaining) / float64(moved))
+	progress.EstimatedSecondsRemaining = int64(eta / time.Second)
+	progress.EstimatedCompletion = time.Now().Add(eta).Format(time.RFC3339)
+	return progress
+}
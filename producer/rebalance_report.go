@@ -0,0 +1,167 @@
+package producer
+
+import (
+	"sync"
+	"time"
+
+	"github.com/couchbase/eventing/common"
+	"github.com/couchbase/eventing/logging"
+	"github.com/couchbase/eventing/util"
+)
+
+const (
+	// Reports of past topology changes kept in metadata bucket per eventing node
+	rebalanceReportsRetained = 10
+
+	rebalanceReportsKey = "rebalance_reports"
+)
+
+// rebalanceTracker captures a topology change from planner run till vbucket
+// shuffling settles down, to be persisted as a report in metadata bucket
+type rebalanceTracker struct {
+	sync.Mutex
+	report    *common.RebalanceReport
+	startTime time.Time
+	stats     map[string]uint64
+}
+
+func (p *Producer) rebalanceReportKey(nodeUUID string) common.Key {
+	return p.AddMetadataPrefix(p.appName + "::" + rebalanceReportsKey + "::" + nodeUUID)
+}
+
+// startRebalanceReport is called post planner run, with vbucket to node assignment
+// prior to the topology change
+func (p *Producer) startRebalanceReport(changeType common.ChangeType, prevAssignMap map[uint16]string) {
+	logPrefix := "Producer::startRebalanceReport"
+
+	report := &common.RebalanceReport{
+		NodeUUID:   p.uuid,
+		ChangeType: string(changeType),
+		StartTs:    time.Now().Format(time.RFC3339),
+	}
+
+	var selfAddr string
+	if consumers := p.getConsumers(); len(consumers) > 0 {
+		selfAddr = consumers[0].HostPortAddr()
+	}
+
+	p.vbEventingNodeAssignRWMutex.RLock()
+	for vb, node := range p.vbEventingNodeAssignMap {
+		prevNode := prevAssignMap[vb]
+		if prevNode == node {
+			continue
+		}
+
+		report.VbsMoved++
+		if selfAddr == "" {
+			continue
+		}
+		if node == selfAddr {
+			report.VbsGained++
+		} else if prevNode == selfAddr {
+			report.VbsRelinquished++
+		}
+	}
+	p.vbEventingNodeAssignRWMutex.RUnlock()
+
+	t := p.rebalanceTracker
+	t.Lock()
+	defer t.Unlock()
+
+	// A topology change arriving before the previous one settled down supersedes it
+	if t.report != nil {
+		logging.Infof("%s [%s:%d] Discarding report of unfinished topology change started at: %s",
+			logPrefix, p.appName, p.LenRunningConsumers(), t.report.StartTs)
+	}
+
+	t.report = report
+	t.startTime = time.Now()
+	t.stats = p.GetEventProcessingStats()
+
+	logging.Infof("%s [%s:%d] Tracking topology change: %s vbs moved: %d gained: %d relinquished: %d",
+		logPrefix, p.appName, p.LenRunningConsumers(), changeType, report.VbsMoved, report.VbsGained, report.VbsRelinquished)
+}
+
+// finishRebalanceReport persists report of topology change being tracked, if any
+func (p *Producer) finishRebalanceReport(status string) {
+	logPrefix := "Producer::finishRebalanceReport"
+
+	t := p.rebalanceTracker
+	t.Lock()
+	report, startTime, startStats := t.report, t.startTime, t.stats
+	t.report = nil
+	t.stats = nil
+	t.Unlock()
+
+	if report == nil {
+		return
+	}
+
+	stats := p.GetEventProcessingStats()
+	report.Status = status
+	report.EndTs = time.Now().Format(time.RFC3339)
+	report.DurationMs = time.Since(startTime).Nanoseconds() / int64(time.Millisecond)
+	report.StreamRequests = counterDelta(stats, startStats, "dcp_stream_req_counter")
+	report.StreamRequestErrors = counterDelta(stats, startStats, "dcp_stream_req_err_counter")
+	report.StreamCloseErrors = counterDelta(stats, startStats, "dcp_stream_close_err_counter")
+
+	logging.Infof("%s [%s:%d] Topology change: %s %s in %v, report: %#v",
+		logPrefix, p.appName, p.LenRunningConsumers(), report.ChangeType, status, time.Since(startTime), report)
+
+	key := p.rebalanceReportKey(p.uuid)
+
+	var reports []*common.RebalanceReport
+	err := util.Retry(util.NewFixedBackoff(bucketOpRetryInterval), &p.retryCount, getOpCallback, p, key, &reports)
+	if err == common.ErrRetryTimeout {
+		logging.Errorf("%s [%s:%d] Exiting due to timeout", logPrefix, p.appName, p.LenRunningConsumers())
+		return
+	}
+
+	reports = append(reports, report)
+	if len(reports) > rebalanceReportsRetained {
+		reports = reports[len(reports)-rebalanceReportsRetained:]
+	}
+
+	err = util.Retry(util.NewFixedBackoff(bucketOpRetryInterval), &p.retryCount, setOpCallback, p, key, reports)
+	if err == common.ErrRetryTimeout {
+		logging.Errorf("%s [%s:%d] Exiting due to timeout", logPrefix, p.appName, p.LenRunningConsumers())
+	}
+}
+
+// GetRebalanceReports returns reports of recent topology changes persisted by
+// eventing nodes part of the cluster, keyed by node uuid
+func (p *Producer) GetRebalanceReports() (map[string][]*common.RebalanceReport, error) {
+	logPrefix := "Producer::GetRebalanceReports"
+
+	nodeUUIDs := append([]string{p.uuid}, p.eventingNodeUUIDs...)
+
+	nodeReports := make(map[string][]*common.RebalanceReport)
+	for _, nodeUUID := range nodeUUIDs {
+		if _, ok := nodeReports[nodeUUID]; ok {
+			continue
+		}
+
+		var reports []*common.RebalanceReport
+		err := util.Retry(util.NewFixedBackoff(bucketOpRetryInterval), &p.retryCount, getOpCallback,
+			p, p.rebalanceReportKey(nodeUUID), &reports)
+		if err == common.ErrRetryTimeout {
+			logging.Errorf("%s [%s:%d] Exiting due to timeout", logPrefix, p.appName, p.LenRunningConsumers())
+			return nil, err
+		}
+
+		if reports == nil {
+			reports = make([]*common.RebalanceReport, 0)
+		}
+		nodeReports[nodeUUID] = reports
+	}
+
+	return nodeReports, nil
+}
+
+func counterDelta(current, previous map[string]uint64, counter string) uint64 {
+	// Counters restart from zero on respawn of workers
+	if current[counter] < previous[counter] {
+		return current[counter]
+	}
+	return current[counter] - previous[counter]
+}
@@ -0,0 +1,187 @@
+package producer
+
+import (
+	"fmt"
+	"reflect"
+	"sync/atomic"
+
+	"github.com/couchbase/eventing/logging"
+	"github.com/couchbase/eventing/util"
+)
+
+// applySettingsDelta compares tunables that can be changed without redeploying
+// the function against currently applied handler config. log_level,
+// execution_timeout, sock_batch_size, dispatch lane batch sizes and retry policy
+// are pushed to running C++ workers by consumers themselves. dcp_throughput_quota
+// and metadata latency injection apply right away, DCP flow control settings to feeds opened from then on,
+// change in worker_count or cpp_thread_quota requires respawning consumers
+func (p *Producer) applySettingsDelta(settings map[string]interface{}) {
+	logPrefix := "Producer::applySettingsDelta"
+
+	if val, ok := settings["processing_status"]; ok && !val.(bool) {
+		return
+	}
+
+	delta := make(map[string]interface{})
+
+	if val, ok := settings["log_level"]; ok && val.(string) != p.handlerConfig.LogLevel {
+		p.handlerConfig.LogLevel = val.(string)
+		delta["log_level"] = p.handlerConfig.LogLevel
+	}
+
+	if val, ok := settings["execution_timeout"]; ok && int(val.(float64)) != p.handlerConfig.ExecutionTimeout {
+		p.handlerConfig.ExecutionTimeout = int(val.(float64))
+		delta["execution_timeout"] = p.handlerConfig.ExecutionTimeout
+	}
+
+	if val, ok := settings["sock_batch_size"]; ok && int(val.(float64)) != p.handlerConfig.SocketWriteBatchSize {
+		p.handlerConfig.SocketWriteBatchSize = int(val.(float64))
+		delta["sock_batch_size"] = p.handlerConfig.SocketWriteBatchSize
+	}
+
+	if val, ok := settings["timer_lane_batch_size"]; ok && int(val.(float64)) != p.handlerConfig.TimerLaneBatchSize {
+		p.handlerConfig.TimerLaneBatchSize = int(val.(float64))
+		delta["timer_lane_batch_size"] = p.handlerConfig.TimerLaneBatchSize
+	}
+
+	if val, ok := settings["dcp_lane_batch_size"]; ok && int(val.(float64)) != p.handlerConfig.DcpLaneBatchSize {
+		p.handlerConfig.DcpLaneBatchSize = int(val.(float64))
+		delta["dcp_lane_batch_size"] = p.handlerConfig.DcpLaneBatchSize
+	}
+
+	if val, ok := settings["retry_count"]; ok && int(val.(float64)) != p.handlerConfig.RetryCount {
+		p.handlerConfig.RetryCount = int(val.(float64))
+		delta["retry_count"] = p.handlerConfig.RetryCount
+	}
+
+	if val, ok := settings["retry_backoff"]; ok && int(val.(float64)) != p.handlerConfig.RetryBackoff {
+		p.handlerConfig.RetryBackoff = int(val.(float64))
+		delta["retry_backoff"] = p.handlerConfig.RetryBackoff
+	}
+
+	if val, ok := settings["retry_on"]; ok {
+		if retryOn := util.ToStringArray(val); !reflect.DeepEqual(retryOn, p.handlerConfig.RetryOn) {
+			p.handlerConfig.RetryOn = retryOn
+			delta["retry_on"] = p.handlerConfig.RetryOn
+		}
+	}
+
+	if val, ok := settings["dcp_throughput_quota"]; ok && int(val.(float64)) != p.handlerConfig.DcpThroughputQuota {
+		p.handlerConfig.DcpThroughputQuota = int(val.(float64))
+		p.dcpQuota.setRate(p.handlerConfig.DcpThroughputQuota)
+		delta["dcp_throughput_quota"] = p.handlerConfig.DcpThroughputQuota
+	}
+
+	injectChanged := false
+	if val, ok := settings["metadata_latency_inject_percent"]; ok && int(val.(float64)) != p.handlerConfig.MetaLatencyInjectPercent {
+		p.handlerConfig.MetaLatencyInjectPercent = int(val.(float64))
+		delta["metadata_latency_inject_percent"] = p.handlerConfig.MetaLatencyInjectPercent
+		injectChanged = true
+	}
+	if val, ok := settings["metadata_latency_inject_ms"]; ok && int(val.(float64)) != p.handlerConfig.MetaLatencyInjectMs {
+		p.handlerConfig.MetaLatencyInjectMs = int(val.(float64))
+		delta["metadata_latency_inject_ms"] = p.handlerConfig.MetaLatencyInjectMs
+		injectChanged = true
+	}
+	if injectChanged {
+		p.metaLatency.setConfig(p.handlerConfig.MetaLatencyInjectPercent, p.handlerConfig.MetaLatencyInjectMs)
+	}
+
+	p.applyDcpFlowControl(settings, delta)
+
+	respawn := false
+	if val, ok := settings["cpp_thread_quota"]; ok && int(val.(float64)) != p.handlerConfig.CPPThreadQuota {
+		respawn = true
+		delta["cpp_thread_quota"] = int(val.(float64))
+	}
+
+	workerCount := p.handlerConfig.WorkerCount
+	if val, ok := settings["worker_count"]; ok && int(val.(float64)) != p.handlerConfig.WorkerCount {
+		workerCount = int(val.(float64))
+		delta["worker_count"] = workerCount
+		respawn = true
+	}
+
+	if len(delta) == 0 {
+		return
+	}
+
+	logging.Infof("%s [%s:%d] Applying settings delta: %v", logPrefix, p.appName, p.LenRunningConsumers(), delta)
+
+	if !respawn {
+		return
+	}
+
+	if p.isBootstrapping || p.isPausing || atomic.LoadInt32(&p.isRebalanceOngoing) == 1 {
+		logging.Infof("%s [%s:%d] Function is bootstrapping, pausing or rebalancing, worker_count: %d will be applied on next resume",
+			logPrefix, p.appName, p.LenRunningConsumers(), workerCount)
+		return
+	}
+
+	err := p.respawnConsumers()
+	if err != nil {
+		logging.Errorf("%s [%s:%d] Failed to respawn consumers with worker_count: %d, err: %v",
+			logPrefix, p.appName, p.LenRunningConsumers(), workerCount, err)
+		return
+	}
+
+	logging.Infof("%s [%s:%d] Respawned consumers with worker_count: %d cpp_worker_thread_count: %d",
+		logPrefix, p.appName, p.LenRunningConsumers(), p.handlerConfig.WorkerCount, p.handlerConfig.CPPWorkerThrCount)
+}
+
+// respawnConsumers stops running consumers after checkpointing and brings them
+// back as per latest settings. Streams are resumed from last checkpoint, same
+// as in case of function pause and resume
+func (p *Producer) respawnConsumers() error {
+	err := p.pauseProducer()
+	if err != nil {
+		return err
+	}
+
+	err = p.updatemetadataHandle()
+	if err != nil {
+		return fmt.Errorf("Failed to get meta data handle, err: %v", err)
+	}
+
+	err = p.resumeProducer()
+	if err != nil {
+		return err
+	}
+
+	// Supervisor isn't involved in this cycle, so consume bootstrap status on its behalf
+	go p.SignalBootstrapFinish()
+	return nil
+}
+
+// applyDcpFlowControl updates DCP flow control settings handed over to consumers spawned
+// from here on and used for feeds opened by producer. Config is shared with consumers
+// already running, so it's replaced rather than updated in place
+func (p *Producer) applyDcpFlowControl(settings map[string]interface{}, delta map[string]interface{}) {
+	dcpConfig := make(map[string]interface{}, len(p.dcpConfig))
+	for k, v := range p.dcpConfig {
+		dcpConfig[k] = v
+	}
+
+	changed := false
+	if val, ok := settings["dcp_window_size"]; ok && uint32(val.(float64)) != dcpConfig["dcpWindowSize"].(uint32) {
+		dcpConfig["dcpWindowSize"] = uint32(val.(float64))
+		delta["dcp_window_size"] = dcpConfig["dcpWindowSize"]
+		changed = true
+	}
+
+	if val, ok := settings["dcp_noop_interval"]; ok && int(val.(float64)) != dcpConfig["noopInterval"].(int) {
+		dcpConfig["noopInterval"] = int(val.(float64))
+		delta["dcp_noop_interval"] = dcpConfig["noopInterval"]
+		changed = true
+	}
+
+	if val, ok := settings["dcp_num_connections"]; ok && int(val.(float64)) != dcpConfig["numConnections"].(int) {
+		dcpConfig["numConnections"] = int(val.(float64))
+		delta["dcp_num_connections"] = dcpConfig["numConnections"]
+		changed = true
+	}
+
+	if changed {
+		p.dcpConfig = dcpConfig
+	}
+}
@@ -0,0 +1,184 @@
+package producer
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/couchbase/eventing/common"
+	"github.com/couchbase/eventing/logging"
+	"github.com/couchbase/eventing/util"
+)
+
+// pausedVbsTracker holds vbs an admin has paused processing for on this node.
+// It outlives consumers, so that respawned workers don't stream paused vbs
+type pausedVbsTracker struct {
+	sync.RWMutex
+	vbs map[uint16]time.Time
+}
+
+func newPausedVbsTracker() *pausedVbsTracker {
+	return &pausedVbsTracker{
+		vbs: make(map[uint16]time.Time),
+	}
+}
+
+// PauseVbs stops processing of vbs by closing their streams. Checkpoints of paused
+// vbs are held at last processed seqno till they're resumed
+func (p *Producer) PauseVbs(vbs []uint16) []uint16 {
+	logPrefix := "Producer::PauseVbs"
+
+	t := p.pausedVbs
+	t.Lock()
+	paused := make([]uint16, 0, len(vbs))
+	for _, vb := range vbs {
+		if int(vb) >= p.numVbuckets {
+			continue
+		}
+		if _, ok := t.vbs[vb]; ok {
+			continue
+		}
+		t.vbs[vb] = time.Now()
+		paused = append(paused, vb)
+	}
+	t.Unlock()
+
+	if len(paused) == 0 {
+		return paused
+	}
+
+	sort.Sort(util.Uint16Slice(paused))
+	logging.Infof("%s [%s:%d] Pausing vbs len: %d dump: %s",
+		logPrefix, p.appName, p.LenRunningConsumers(), len(paused), util.Condense(paused))
+
+	for _, c := range p.getConsumers() {
+		c.PauseVbs(paused)
+	}
+	return paused
+}
+
+// ResumeVbs gets consumers to restream paused vbs from their checkpoints
+func (p *Producer) ResumeVbs(vbs []uint16) []uint16 {
+	logPrefix := "Producer::ResumeVbs"
+
+	t := p.pausedVbs
+	t.Lock()
+	resumed := make([]uint16, 0, len(vbs))
+	for _, vb := range vbs {
+		if _, ok := t.vbs[vb]; !ok {
+			continue
+		}
+		delete(t.vbs, vb)
+		resumed = append(resumed, vb)
+	}
+	t.Unlock()
+
+	if len(resumed) == 0 {
+		return resumed
+	}
+
+	sort.Sort(util.Uint16Slice(resumed))
+	logging.Infof("%s [%s:%d] Resuming vbs len: %d dump: %s",
+		logPrefix, p.appName, p.LenRunningConsumers(), len(resumed), util.Condense(resumed))
+
+	for _, c := range p.getConsumers() {
+		c.ResumeVbs(resumed)
+	}
+	return resumed
+}
+
+// IsVbPaused reports if processing of vb has been paused by an admin
+func (p *Producer) IsVbPaused(vb uint16) bool {
+	t := p.pausedVbs
+	t.RLock()
+	defer t.RUnlock()
+
+	_, ok := t.vbs[vb]
+	return ok
+}
+
+// GetPausedVbs returns vbs paused on this node along with when they were paused
+func (p *Producer) GetPausedVbs() *common.PausedVbs {
+	t := p.pausedVbs
+	t.RLock()
+	defer t.RUnlock()
+
+	pausedVbs := &common.PausedVbs{
+		Vbs:      make([]uint16, 0, len(t.vbs)),
+		PausedAt: make(map[uint16]string),
+	}
+	for vb, ts := range t.vbs {
+		pausedVbs.Vbs = append(pausedVbs.Vbs, vb)
+		pausedVbs.PausedAt[vb] = ts.Format(time.RFC3339)
+	}
+	sort.Sort(util.Uint16Slice(pausedVbs.Vbs))
+	return pausedVbs
+}
+
+// loadPausedVbs syncs vbs paused on this node with ones persisted in metakv, so that
+// pauses applied while the node was away hold once it takes over those vbs
+func (p *Producer) loadPausedVbs() {
+	logPrefix := "Producer::loadPausedVbs"
+
+	data, err := util.MetakvGet(common.MetakvPausedVbsPath + p.appName)
+	if err != nil {
+		logging.Errorf("%s [%s:%d] Failed to read paused vbs, err: %v",
+			logPrefix, p.appName, p.LenRunningConsumers(), err)
+		return
+	}
+
+	persisted := &common.PausedVbs{}
+	if len(data) > 0 {
+		if err = json.Unmarshal(data, persisted); err != nil {
+			logging.Errorf("%s [%s:%d] Failed to unmarshal paused vbs, err: %v",
+				logPrefix, p.appName, p.LenRunningConsumers(), err)
+			return
+		}
+	}
+
+	t := p.pausedVbs
+	t.Lock()
+	paused := make([]uint16, 0)
+	for vb, ts := range persisted.PausedAt {
+		if int(vb) >= p.numVbuckets {
+			continue
+		}
+		if _, ok := t.vbs[vb]; ok {
+			continue
+		}
+		pausedAt, err := time.Parse(time.RFC3339, ts)
+		if err != nil {
+			pausedAt = time.Now()
+		}
+		t.vbs[vb] = pausedAt
+		paused = append(paused, vb)
+	}
+
+	resumed := make([]uint16, 0)
+	for vb := range t.vbs {
+		if _, ok := persisted.PausedAt[vb]; !ok {
+			delete(t.vbs, vb)
+			resumed = append(resumed, vb)
+		}
+	}
+	t.Unlock()
+
+	if len(paused) > 0 {
+		sort.Sort(util.Uint16Slice(paused))
+		logging.Infof("%s [%s:%d] Pausing persisted vbs len: %d dump: %s",
+			logPrefix, p.appName, p.LenRunningConsumers(), len(paused), util.Condense(paused))
+		for _, c := range p.getConsumers() {
+			c.PauseVbs(paused)
+		}
+	}
+
+	if len(resumed) > 0 {
+		sort.Sort(util.Uint16Slice(resumed))
+		logging.Infof("%s [%s:%d] Resuming vbs no longer persisted as paused len: %d dump: %s",
+			logPrefix, p.appName, p.LenRunningConsumers(), len(resumed), util.Condense(resumed))
+		for _, c := range p.getConsumers() {
+			c.ResumeVbs(resumed)
+		}
+	}
+}
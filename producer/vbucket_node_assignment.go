@@ -62,6 +62,17 @@ func (p *Producer) vbEventingNodeAssign(bucketName string) error {
 		return err
 	}
 
+	// Sticky assignment plans off the stored plan, falling back to a fresh plan on a
+	// read failure would shuffle vbuckets around, so reads are retried instead
+	var prevPlan []string
+	if util.IsStickyVbAssignment() {
+		err = util.Retry(util.NewFixedBackoff(time.Second), &p.retryCount, getVbPlanCallback, p, &prevPlan)
+		if err == common.ErrRetryTimeout {
+			logging.Errorf("%s [%s:%d] Exiting due to timeout", logPrefix, p.appName, p.LenRunningConsumers())
+			return err
+		}
+	}
+
 	var keepNodes []string
 	err = json.Unmarshal(data, &keepNodes)
 	if err != nil {
@@ -84,59 +95,90 @@ func (p *Producer) vbEventingNodeAssign(bucketName string) error {
 		return fmt.Errorf("KeepNodes is empty")
 	}
 
+	// Nodes marked for maintenance keep serving vbuckets they already own, but
+	// don't get any assignment in newly generated plan
+	maintenanceNodes := util.GetMaintenanceNodes()
+
 	// Only includes nodes that supposed to be part of cluster post StartTopologyChange call
 	eventingNodeAddrs := make([]string, 0)
 	for _, uuid := range p.eventingNodeUUIDs {
+		if util.Contains(uuid, maintenanceNodes) {
+			continue
+		}
 		eventingNodeAddrs = append(eventingNodeAddrs, addrUUIDMap[uuid])
 	}
-	sort.Strings(eventingNodeAddrs)
 
-	logging.Infof("%s [%s:%d] EventingNodeUUIDs: %v eventingNodeAddrs: %rs",
-		logPrefix, p.appName, p.LenRunningConsumers(), p.eventingNodeUUIDs, eventingNodeAddrs)
-
-	vbucketsPerNode := p.numVbuckets / len(eventingNodeAddrs)
-	var vbNo int
-	var startVb uint16
+	if len(eventingNodeAddrs) == 0 {
+		logging.Errorf("%s [%s:%d] All eventing nodes: %v are marked for maintenance, ignoring maintenance_nodes: %v",
+			logPrefix, p.appName, p.LenRunningConsumers(), p.eventingNodeUUIDs, maintenanceNodes)
 
-	vbCountPerNode := make([]int, len(eventingNodeAddrs))
-	for i := 0; i < len(eventingNodeAddrs); i++ {
-		vbCountPerNode[i] = vbucketsPerNode
-		vbNo += vbucketsPerNode
+		for _, uuid := range p.eventingNodeUUIDs {
+			eventingNodeAddrs = append(eventingNodeAddrs, addrUUIDMap[uuid])
+		}
+	} else if len(maintenanceNodes) > 0 {
+		logging.Infof("%s [%s:%d] Skipping vbucket assignment for nodes marked for maintenance: %v",
+			logPrefix, p.appName, p.LenRunningConsumers(), maintenanceNodes)
 	}
+	sort.Strings(eventingNodeAddrs)
 
-	remainingVbs := p.numVbuckets - vbNo
-	if remainingVbs > 0 {
-		for i := 0; i < remainingVbs; i++ {
-			vbCountPerNode[i] = vbCountPerNode[i] + 1
+	// Plan has to be identical across nodes, so peers found unhealthy over health gossip
+	// aren't dropped from it. Their vbuckets get picked up by takeover till ns_server
+	// reflects the failure
+	for _, uuid := range p.eventingNodeUUIDs {
+		addr := addrUUIDMap[uuid]
+		if liveness := p.superSup.PeerLiveness(addr, uuid, p.appName); liveness == common.PeerDown || liveness == common.PeerFenced {
+			logging.Warnf("%s [%s:%d] Eventing node addr: %rs uuid: %s part of plan is reported %s by health gossip",
+				logPrefix, p.appName, p.LenRunningConsumers(), addr, uuid, liveness)
 		}
 	}
 
+	logging.Infof("%s [%s:%d] EventingNodeUUIDs: %v eventingNodeAddrs: %rs",
+		logPrefix, p.appName, p.LenRunningConsumers(), p.eventingNodeUUIDs, eventingNodeAddrs)
+
+	vbCountPerNode := p.vbCountPerNode(eventingNodeAddrs)
+	vbPlan := planVbAssignment(p.numVbuckets, eventingNodeAddrs, vbCountPerNode, prevPlan)
+	if prevPlan != nil {
+		logging.Infof("%s [%s:%d] Sticky vbucket assignment, vbs moved: %d",
+			logPrefix, p.appName, p.LenRunningConsumers(), p.numVbuckets-countKept(vbPlan, prevPlan))
+	}
+
 	p.plannerNodeMappingsRWMutex.Lock()
 	defer p.plannerNodeMappingsRWMutex.Unlock()
 	p.plannerNodeMappings = make([]*common.PlannerNodeVbMapping, 0)
 
+	nodeVbs := make(map[string][]uint16)
+	for vb, node := range vbPlan {
+		p.vbEventingNodeAssignMap[uint16(vb)] = node
+		nodeVbs[node] = append(nodeVbs[node], uint16(vb))
+	}
+
 	for i, v := range vbCountPerNode {
+		vbs := nodeVbs[eventingNodeAddrs[i]]
+
+		var startVb uint16
+		if len(vbs) > 0 {
+			startVb = vbs[0]
+		}
 
-		logging.Infof("%s [%s:%d] EventingNodeUUIDs: %v Eventing node index: %d eventing node addr: %rs startVb: %v vbs count: %v",
-			logPrefix, p.appName, p.LenRunningConsumers(), p.eventingNodeUUIDs, i, eventingNodeAddrs[i], startVb, v)
+		logging.Infof("%s [%s:%d] EventingNodeUUIDs: %v Eventing node index: %d eventing node addr: %rs startVb: %v vbs count: %v vbs: %s",
+			logPrefix, p.appName, p.LenRunningConsumers(), p.eventingNodeUUIDs, i, eventingNodeAddrs[i], startVb, v, util.Condense(vbs))
 
 		nodeMapping := &common.PlannerNodeVbMapping{
 			Hostname: eventingNodeAddrs[i],
 			StartVb:  int(startVb),
 			VbsCount: v,
+			Vbs:      util.Condense(vbs),
 		}
 		p.plannerNodeMappings = append(p.plannerNodeMappings, nodeMapping)
-
-		for j := 0; j < v; j++ {
-			p.vbEventingNodeAssignMap[startVb] = eventingNodeAddrs[i]
-			startVb++
-		}
 	}
 
+	p.storeVbPlan(vbPlan)
+
 	vbEventingNodeAssignMap := make(map[uint16]string)
 	for vb, node := range p.vbEventingNodeAssignMap {
 		vbEventingNodeAssignMap[vb] = node
 	}
+	p.vbEventingNodeAssignSnapshot.Store(vbEventingNodeAssignMap)
 
 	for _, consumer := range p.getConsumers() {
 		consumer.VbEventingNodeAssignMapUpdate(vbEventingNodeAssignMap)
@@ -145,15 +187,185 @@ func (p *Producer) vbEventingNodeAssign(bucketName string) error {
 	return nil
 }
 
+// vbCountPerNode splits vbuckets across eventing nodes in proportion to their
+// weight. Weights come from ns_server, so every eventing node arrives at the same
+// split. Falls back to even split if weights aren't available for all nodes
+func (p *Producer) vbCountPerNode(eventingNodeAddrs []string) []int {
+	logPrefix := "Producer::vbCountPerNode"
+
+	weights := make([]float64, len(eventingNodeAddrs))
+	for i := range weights {
+		weights[i] = 1
+	}
+
+	source := util.GetVbAssignmentWeight()
+	if source != util.VbAssignmentWeightNone {
+		nodeWeights, err := util.EventingNodesWeights(p.nsServerHostPort, source)
+		if err != nil {
+			logging.Errorf("%s [%s:%d] Failed to fetch eventing node weights, source: %s, falling back to even split. err: %v",
+				logPrefix, p.appName, p.LenRunningConsumers(), source, err)
+		} else {
+			for i, addr := range eventingNodeAddrs {
+				if weight, ok := nodeWeights[addr]; ok && weight > 0 {
+					weights[i] = weight
+					continue
+				}
+
+				logging.Errorf("%s [%s:%d] Weight missing for eventing node: %rs, source: %s, falling back to even split",
+					logPrefix, p.appName, p.LenRunningConsumers(), addr, source)
+				for j := range weights {
+					weights[j] = 1
+				}
+				break
+			}
+		}
+	}
+
+	vbCountPerNode := splitVbsByWeight(p.numVbuckets, weights)
+
+	logging.Infof("%s [%s:%d] Weight source: %s weights: %v vbs per node: %v",
+		logPrefix, p.appName, p.LenRunningConsumers(), source, weights, vbCountPerNode)
+
+	return vbCountPerNode
+}
+
+// splitVbsByWeight splits vbuckets using largest remainder method, ties are broken
+// by node order which is already sorted
+func splitVbsByWeight(numVbuckets int, weights []float64) []int {
+	var totalWeight float64
+	for _, weight := range weights {
+		totalWeight += weight
+	}
+
+	vbCountPerNode := make([]int, len(weights))
+	remainders := make([]float64, len(weights))
+	var vbNo int
+	for i, weight := range weights {
+		share := float64(numVbuckets) * weight / totalWeight
+		vbCountPerNode[i] = int(share)
+		remainders[i] = share - float64(vbCountPerNode[i])
+		vbNo += vbCountPerNode[i]
+	}
+
+	order := make([]int, len(weights))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return remainders[order[i]] > remainders[order[j]]
+	})
+
+	for i := 0; i < numVbuckets-vbNo; i++ {
+		vbCountPerNode[order[i%len(order)]]++
+	}
+
+	return vbCountPerNode
+}
+
+// planVbAssignment returns eventing node for every vbucket. Given previous plan,
+// vbuckets stay with their previous owner as long as it's within its share, and
+// only the excess gets handed over to nodes short of their share. Planning again
+// for the same topology yields the same plan, so nodes that read the plan after
+// another node has already stored the new one still arrive at the same result
+func planVbAssignment(numVbuckets int, eventingNodeAddrs []string, vbCountPerNode []int, prevPlan []string) []string {
+	vbPlan := make([]string, numVbuckets)
+
+	if prevPlan == nil {
+		var vb int
+		for i, count := range vbCountPerNode {
+			for j := 0; j < count; j++ {
+				vbPlan[vb] = eventingNodeAddrs[i]
+				vb++
+			}
+		}
+		return vbPlan
+	}
+
+	share := make(map[string]int)
+	for i, count := range vbCountPerNode {
+		share[eventingNodeAddrs[i]] = count
+	}
+
+	kept := make(map[string]int)
+	freeVbs := make([]int, 0)
+	for vb, node := range prevPlan {
+		if count, ok := share[node]; ok && kept[node] < count {
+			vbPlan[vb] = node
+			kept[node]++
+			continue
+		}
+		freeVbs = append(freeVbs, vb)
+	}
+
+	for i, count := range vbCountPerNode {
+		node := eventingNodeAddrs[i]
+		for ; kept[node] < count; kept[node]++ {
+			vbPlan[freeVbs[0]] = node
+			freeVbs = freeVbs[1:]
+		}
+	}
+
+	return vbPlan
+}
+
+func countKept(vbPlan, prevPlan []string) int {
+	var count int
+	for vb := range vbPlan {
+		if vbPlan[vb] == prevPlan[vb] {
+			count++
+		}
+	}
+	return count
+}
+
+// getVbPlan returns plan stored by the last planning, nil if function hasn't been
+// planned for yet. Plan that can't be read or doesn't cover every vbucket is an error
+func (p *Producer) getVbPlan() ([]string, error) {
+	data, err := util.MetakvGet(common.MetakvVbPlanPath + p.appName)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) == 0 {
+		return nil, nil
+	}
+
+	var vbPlan []string
+	err = json.Unmarshal(data, &vbPlan)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(vbPlan) != p.numVbuckets {
+		return nil, fmt.Errorf("plan covers %d vbuckets, expected %d", len(vbPlan), p.numVbuckets)
+	}
+	return vbPlan, nil
+}
+
+func (p *Producer) storeVbPlan(vbPlan []string) {
+	logPrefix := "Producer::storeVbPlan"
+
+	data, err := json.Marshal(vbPlan)
+	if err != nil {
+		logging.Errorf("%s [%s:%d] Failed to marshal vbucket plan, err: %v",
+			logPrefix, p.appName, p.LenRunningConsumers(), err)
+		return
+	}
+
+	err = util.MetakvSet(common.MetakvVbPlanPath+p.appName, data, nil)
+	if err != nil {
+		logging.Errorf("%s [%s:%d] Failed to store vbucket plan, err: %v",
+			logPrefix, p.appName, p.LenRunningConsumers(), err)
+	}
+}
+
 func (p *Producer) vbNodeWorkerMap() {
 	logPrefix := "Producer::vbNodeWorkerMap"
 
 	nodeVbsToHandle := make(map[string][]uint16)
 
 	func() {
-		p.vbEventingNodeAssignRWMutex.RLock()
-		defer p.vbEventingNodeAssignRWMutex.RUnlock()
-		for vb, node := range p.vbEventingNodeAssignMap {
+		for vb, node := range p.VbEventingNodeAssignMapSnapshot() {
 			if _, ok := nodeVbsToHandle[node]; !ok {
 				nodeVbsToHandle[node] = make([]uint16, 0)
 			}
@@ -219,7 +431,7 @@ func (p *Producer) vbNodeWorkerMap() {
 
 	for _, vb := range vbs {
 		info := p.vbMapping[vb]
-		logging.Tracef("%s [%s:%d] vb: %d node: %s worker: %s",
+		logging.AppTracef(p.appName, "%s [%s:%d] vb: %d node: %s worker: %s",
 			logPrefix, p.appName, p.LenRunningConsumers(), vb, info.ownerNode, info.assignedWorker)
 	}
 }
@@ -238,9 +450,7 @@ func (p *Producer) initWorkerVbMap() map[string][]uint16 {
 	// vbuckets the current eventing node is responsible to handle
 	var vbucketsToHandle []uint16
 
-	p.vbEventingNodeAssignRWMutex.RLock()
-	defer p.vbEventingNodeAssignRWMutex.RUnlock()
-	for k, v := range p.vbEventingNodeAssignMap {
+	for k, v := range p.VbEventingNodeAssignMapSnapshot() {
 		if v == eventingNodeAddr {
 			vbucketsToHandle = append(vbucketsToHandle, k)
 		}
@@ -251,6 +461,11 @@ func (p *Producer) initWorkerVbMap() map[string][]uint16 {
 	logging.Infof("%s [%s:%d] eventingAddr: %rs vbucketsToHandle, len: %d dump: %v",
 		logPrefix, p.appName, p.LenRunningConsumers(), eventingNodeAddr, len(vbucketsToHandle), util.Condense(vbucketsToHandle))
 
+	if idle := p.handlerConfig.WorkerCount - len(vbucketsToHandle); idle > 0 && len(vbucketsToHandle) > 0 {
+		logging.Warnf("%s [%s:%d] worker_count: %d exceeds vbs owned by this node: %d, %d workers would stay idle until topology changes",
+			logPrefix, p.appName, p.LenRunningConsumers(), p.handlerConfig.WorkerCount, len(vbucketsToHandle), idle)
+	}
+
 	vbucketPerWorker := len(vbucketsToHandle) / p.handlerConfig.WorkerCount
 	var startVbIndex int
 
@@ -294,6 +509,7 @@ func (p *Producer) initWorkerVbMap() map[string][]uint16 {
 	for workerName, assignedVbs := range p.workerVbucketMap {
 		workerVbucketMap[workerName] = assignedVbs
 	}
+	p.workerVbMapSnapshot.Store(workerVbucketMap)
 
 	logging.Infof("%s [%s:%d] Sending workerVbucketMap: %v to all consumers",
 		logPrefix, p.appName, p.LenRunningConsumers(), workerVbucketMap)
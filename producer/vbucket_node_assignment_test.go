@@ -0,0 +1,92 @@
+package producer
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitVbsByWeight(t *testing.T) {
+	tests := []struct {
+		name        string
+		numVbuckets int
+		weights     []float64
+		expected    []int
+	}{
+		{"single node", 1024, []float64{1}, []int{1024}},
+		{"even split", 1024, []float64{1, 1}, []int{512, 512}},
+		{"remainder to first nodes", 1024, []float64{1, 1, 1}, []int{342, 341, 341}},
+		{"weighted", 1024, []float64{3, 1}, []int{768, 256}},
+		{"weighted with remainder", 64, []float64{2, 1, 1, 1}, []int{25, 13, 13, 13}},
+		{"largest remainder wins", 10, []float64{1, 2}, []int{3, 7}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := splitVbsByWeight(test.numVbuckets, test.weights)
+			if !reflect.DeepEqual(got, test.expected) {
+				t.Errorf("got: %v expected: %v", got, test.expected)
+			}
+
+			var total int
+			for _, count := range got {
+				total += count
+			}
+			if total != test.numVbuckets {
+				t.Errorf("split covers %d vbuckets, expected %d", total, test.numVbuckets)
+			}
+		})
+	}
+}
+
+func TestPlanVbAssignment(t *testing.T) {
+	tests := []struct {
+		name     string
+		nodes    []string
+		counts   []int
+		prevPlan []string
+		expected []string
+	}{
+		{
+			name:     "fresh plan",
+			nodes:    []string{"a", "b"},
+			counts:   []int{4, 4},
+			expected: []string{"a", "a", "a", "a", "b", "b", "b", "b"},
+		},
+		{
+			name:     "same topology keeps plan",
+			nodes:    []string{"a", "b"},
+			counts:   []int{4, 4},
+			prevPlan: []string{"b", "a", "b", "a", "b", "a", "b", "a"},
+			expected: []string{"b", "a", "b", "a", "b", "a", "b", "a"},
+		},
+		{
+			name:     "node added takes only excess",
+			nodes:    []string{"a", "b", "c"},
+			counts:   []int{3, 3, 2},
+			prevPlan: []string{"a", "a", "a", "a", "b", "b", "b", "b"},
+			expected: []string{"a", "a", "a", "c", "b", "b", "b", "c"},
+		},
+		{
+			name:     "node removed hands over its vbuckets",
+			nodes:    []string{"a", "c"},
+			counts:   []int{4, 4},
+			prevPlan: []string{"a", "a", "a", "c", "b", "b", "b", "c"},
+			expected: []string{"a", "a", "a", "c", "a", "c", "c", "c"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := planVbAssignment(len(test.expected), test.nodes, test.counts, test.prevPlan)
+			if !reflect.DeepEqual(got, test.expected) {
+				t.Errorf("got: %v expected: %v", got, test.expected)
+			}
+
+			// Planning again off the new plan must not move anything
+			again := planVbAssignment(len(got), test.nodes, test.counts, got)
+			if moved := len(got) - countKept(again, got); moved != 0 {
+				t.Errorf("replanning moved %d vbuckets", moved)
+			}
+		})
+	}
+}
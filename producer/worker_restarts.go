@@ -0,0 +1,120 @@
+package producer
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/couchbase/eventing/common"
+)
+
+const (
+	workerRestartBaseBackoff = time.Second
+	workerRestartMaxBackoff  = 2 * time.Minute
+
+	// cpp worker staying up this long since its last restart is deemed to have recovered,
+	// so that its next restart isn't backed off
+	workerRestartStableAfter = 5 * time.Minute
+)
+
+type workerRestart struct {
+	restarts    uint64
+	consecutive int
+	backoff     time.Duration
+	lastRestart time.Time
+	lastExit    *common.WorkerExit
+}
+
+// workerRestartTracker supervises restarts of cpp workers of the function. First restart
+// of a worker is immediate, subsequent ones in quick succession are backed off
+// exponentially so that a worker crashing on every event doesn't spin
+type workerRestartTracker struct {
+	sync.RWMutex
+	workers map[string]*workerRestart
+}
+
+func newWorkerRestartTracker() *workerRestartTracker {
+	return &workerRestartTracker{
+		workers: make(map[string]*workerRestart),
+	}
+}
+
+// record notes exit of a cpp worker and returns backoff to apply prior to restarting it
+func (t *workerRestartTracker) record(workerName string, exit *common.WorkerExit) time.Duration {
+	t.Lock()
+	defer t.Unlock()
+
+	w, ok := t.workers[workerName]
+	if !ok {
+		w = &workerRestart{}
+		t.workers[workerName] = w
+	}
+
+	now := time.Now()
+	if !w.lastRestart.IsZero() && now.Sub(w.lastRestart.Add(w.backoff)) > workerRestartStableAfter {
+		w.consecutive = 0
+	}
+
+	w.backoff = 0
+	if w.consecutive > 0 {
+		w.backoff = workerRestartMaxBackoff
+		if shift := uint(w.consecutive - 1); shift < 16 && workerRestartBaseBackoff<<shift < workerRestartMaxBackoff {
+			w.backoff = workerRestartBaseBackoff << shift
+		}
+	}
+
+	w.restarts++
+	w.consecutive++
+	w.lastRestart = now
+	w.lastExit = exit
+	return w.backoff
+}
+
+func (t *workerRestartTracker) stats() []*common.WorkerRestartStats {
+	t.RLock()
+	defer t.RUnlock()
+
+	stats := make([]*common.WorkerRestartStats, 0, len(t.workers))
+	for workerName, w := range t.workers {
+		stats = append(stats, &common.WorkerRestartStats{
+			Worker:              workerName,
+			Restarts:            w.restarts,
+			ConsecutiveRestarts: w.consecutive,
+			BackoffMs:           int64(w.backoff / time.Millisecond),
+			LastRestart:         w.lastRestart,
+			LastExit:            w.lastExit,
+		})
+	}
+
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Worker < stats[j].Worker
+	})
+	return stats
+}
+
+// recent returns max of consecutive restarts and backoff across workers, which are
+// yet to stay up for long enough since their last restart
+func (t *workerRestartTracker) recent() (uint64, uint64) {
+	t.RLock()
+	defer t.RUnlock()
+
+	var consecutive, backoffMs uint64
+	for _, w := range t.workers {
+		if time.Since(w.lastRestart.Add(w.backoff)) > workerRestartStableAfter {
+			continue
+		}
+		if uint64(w.consecutive) > consecutive {
+			consecutive = uint64(w.consecutive)
+		}
+		if ms := uint64(w.backoff / time.Millisecond); ms > backoffMs {
+			backoffMs = ms
+		}
+	}
+	return consecutive, backoffMs
+}
+
+// GetWorkerRestarts returns restarts of cpp workers of the function, along with how
+// each one last went down
+func (p *Producer) GetWorkerRestarts() []*common.WorkerRestartStats {
+	return p.workerRestarts.stats()
+}
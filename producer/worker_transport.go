@@ -0,0 +1,116 @@
+package producer
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"runtime"
+
+	"github.com/couchbase/eventing/common"
+	"github.com/couchbase/eventing/logging"
+	"github.com/couchbase/eventing/util"
+)
+
+// listenForWorker sets up main and feedback sockets the worker spawned for consumer
+// at index would connect to, as per worker_ipc_type. Transport picked is recorded in
+// processConfig and gets passed on to the worker as it's spawned
+func (p *Producer) listenForWorker(index int) (listener, feedbackListener net.Listener, err error) {
+	logPrefix := "Producer::listenForWorker"
+
+	udsSockPath, feedbackSockPath := p.workerSockPaths(index)
+
+	logging.Infof("%s [%s:%d] worker_ipc_type: %s udsSockPath len: %d dump: %s feedbackSockPath len: %d dump: %s",
+		logPrefix, p.appName, p.LenRunningConsumers(), p.handlerConfig.WorkerIPCType, len(udsSockPath), udsSockPath,
+		len(feedbackSockPath), feedbackSockPath)
+
+	// Windows named pipes aren't supported by net package, so workers there use tcp
+	udsUsable := runtime.GOOS != "windows" && len(feedbackSockPath) <= udsSockPathLimit
+
+	switch {
+	case p.handlerConfig.WorkerIPCType == common.WorkerIPCTCP:
+		// Asked for explicitly, e.g. where socket files can't be created in temp dir
+
+	case !udsUsable:
+		if p.handlerConfig.WorkerIPCType == common.WorkerIPCUnix {
+			logging.Warnf("%s [%s:%d] Unix domain sockets unusable on %s with path len: %d, falling back to tcp",
+				logPrefix, p.appName, p.LenRunningConsumers(), runtime.GOOS, len(feedbackSockPath))
+		}
+
+	default:
+		listener, feedbackListener, err = p.listenUnix(udsSockPath, feedbackSockPath)
+		if err == nil {
+			return
+		}
+		logging.Warnf("%s [%s:%d] Failed to listen on unix domain socket, falling back to tcp, err: %v",
+			logPrefix, p.appName, p.LenRunningConsumers(), err)
+	}
+
+	return p.listenTCP()
+}
+
+// workerSockPaths returns paths of unix domain sockets used by worker at index
+func (p *Producer) workerSockPaths(index int) (string, string) {
+	// https://github.com/golang/go/issues/6895 - uds pathname limited to 108 chars
+	// Adding host port in uds path in order to make it across different nodes on a cluster_run setup
+	pathNameSuffix := fmt.Sprintf("%s_%d_%d.sock", p.nsServerHostPort, index, p.app.FunctionID)
+	return fmt.Sprintf("%s/%s", os.TempDir(), pathNameSuffix), fmt.Sprintf("%s/f_%s", os.TempDir(), pathNameSuffix)
+}
+
+func (p *Producer) listenUnix(udsSockPath, feedbackSockPath string) (net.Listener, net.Listener, error) {
+	os.Remove(udsSockPath)
+	os.Remove(feedbackSockPath)
+
+	feedbackListener, err := net.Listen("unix", feedbackSockPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	listener, err := net.Listen("unix", udsSockPath)
+	if err != nil {
+		feedbackListener.Close()
+		return nil, nil, err
+	}
+
+	p.processConfig.FeedbackSockIdentifier = feedbackSockPath
+	p.processConfig.SockIdentifier = udsSockPath
+	p.processConfig.IPCType = common.WorkerIPCUnix
+	return listener, feedbackListener, nil
+}
+
+func (p *Producer) listenTCP() (net.Listener, net.Listener, error) {
+	logPrefix := "Producer::listenTCP"
+
+	feedbackListener, err := net.Listen("tcp", net.JoinHostPort(util.Localhost(), "0"))
+	if err != nil {
+		logging.Errorf("%s [%s:%d] Failed to listen on feedback tcp port, err: %v", logPrefix, p.appName, p.LenRunningConsumers(), err)
+		return nil, nil, err
+	}
+
+	listener, err := net.Listen("tcp", net.JoinHostPort(util.Localhost(), "0"))
+	if err != nil {
+		logging.Errorf("%s [%s:%d] Failed to listen on tcp port, err: %v", logPrefix, p.appName, p.LenRunningConsumers(), err)
+		feedbackListener.Close()
+		return nil, nil, err
+	}
+
+	_, feedbackPort, err := net.SplitHostPort(feedbackListener.Addr().String())
+	if err != nil {
+		logging.Errorf("%s [%s:%d] Failed to parse feedback tcp port, err: %v", logPrefix, p.appName, p.LenRunningConsumers(), err)
+		listener.Close()
+		feedbackListener.Close()
+		return nil, nil, err
+	}
+
+	_, port, err := net.SplitHostPort(listener.Addr().String())
+	if err != nil {
+		logging.Errorf("%s [%s:%d] Failed to parse tcp port, err: %v", logPrefix, p.appName, p.LenRunningConsumers(), err)
+		listener.Close()
+		feedbackListener.Close()
+		return nil, nil, err
+	}
+
+	p.processConfig.FeedbackSockIdentifier = feedbackPort
+	p.processConfig.SockIdentifier = port
+	p.processConfig.IPCType = common.WorkerIPCTCP
+	return listener, feedbackListener, nil
+}
@@ -0,0 +1,33 @@
+package servicemanager
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// getAppLogUsage serves /getAppLogUsage, reporting disk usage of app logs of functions
+// running on this node against app_log_max_total_size, along with rotated files evicted
+// and rotations forced to stay within it
+func (m *ServiceMgr) getAppLogUsage(w http.ResponseWriter, r *http.Request) {
+	if !m.validateAuth(w, r, EventingPermissionManage) {
+		return
+	}
+
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	data, err := json.MarshalIndent(m.superSup.GetAppLogUsage(), "", " ")
+	if err != nil {
+		w.Header().Add(headerKey, strconv.Itoa(m.statusCodes.errMarshalResp.Code))
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "Failed to marshal app log usage, err: %v", err)
+		return
+	}
+
+	w.Header().Add(headerKey, strconv.Itoa(m.statusCodes.ok.Code))
+	fmt.Fprintf(w, "%v", string(data))
+}
@@ -10,7 +10,7 @@ import (
 	"github.com/couchbase/eventing/util"
 )
 
-var getEventingNodesAddressesOpCallback = func(args ...interface{}) error {
+var getEventingNodesAddressesOpCallback = util.InstrumentOp("service_manager.get_eventing_nodes_addresses_op", func(args ...interface{}) error {
 	logPrefix := "ServiceMgr::getEventingNodesAddressesOpCallback"
 
 	m := args[0].(*ServiceMgr)
@@ -35,7 +35,7 @@ var getEventingNodesAddressesOpCallback = func(args ...interface{}) error {
 		return nil
 	}
 
-}
+})
 
 var getHTTPServiceAuth = func(args ...interface{}) error {
 	logPrefix := "ServiceMgr::getHTTPServiceAuth"
@@ -53,7 +53,7 @@ var getHTTPServiceAuth = func(args ...interface{}) error {
 	return nil
 }
 
-var storeKeepNodesCallback = func(args ...interface{}) error {
+var storeKeepNodesCallback = util.InstrumentOp("service_manager.store_keep_nodes", func(args ...interface{}) error {
 	logPrefix := "ServiceMgr::storeKeepNodesCallback"
 
 	keepNodeUUIDs := args[0].([]string)
@@ -74,9 +74,9 @@ var storeKeepNodesCallback = func(args ...interface{}) error {
 
 	logging.Infof("%s Keep nodes UUID(s): %v", logPrefix, keepNodeUUIDs)
 	return nil
-}
+})
 
-var stopRebalanceCallback = func(args ...interface{}) error {
+var stopRebalanceCallback = util.InstrumentOp("service_manager.stop_rebalance", func(args ...interface{}) error {
 	logPrefix := "rebalancer::stopRebalanceCallback"
 
 	taskID := args[0].(string)
@@ -92,7 +92,7 @@ var stopRebalanceCallback = func(args ...interface{}) error {
 	}
 
 	return nil
-}
+})
 
 var cleanupEventingMetaKvPath = func(args ...interface{}) error {
 	logPrefix := "ServiceMgr::cleanupEventingMetaKvPath"
@@ -107,7 +107,7 @@ var cleanupEventingMetaKvPath = func(args ...interface{}) error {
 	return err
 }
 
-var metakvGetCallback = func(args ...interface{}) error {
+var metakvGetCallback = util.InstrumentOp("service_manager.metakv_get", func(args ...interface{}) error {
 	logPrefix := "ServiceMgr::metakvGetCallback"
 
 	path := args[0].(string)
@@ -121,9 +121,9 @@ var metakvGetCallback = func(args ...interface{}) error {
 	}
 
 	return nil
-}
+})
 
-var metaKVSetCallback = func(args ...interface{}) error {
+var metaKVSetCallback = util.InstrumentOp("service_manager.meta_kv_set", func(args ...interface{}) error {
 	logPrefix := "ServiceMgr::metaKVSetCallback"
 
 	path := args[0].(string)
@@ -135,9 +135,9 @@ var metaKVSetCallback = func(args ...interface{}) error {
 	}
 
 	return err
-}
+})
 
-var getDeployedAppsCallback = func(args ...interface{}) error {
+var getDeployedAppsCallback = util.InstrumentOp("service_manager.get_deployed_apps", func(args ...interface{}) error {
 	logPrefix := "ServiceMgr::getDeployedAppsCallback"
 
 	aggDeployedApps := args[0].(*map[string]map[string]string)
@@ -150,9 +150,9 @@ var getDeployedAppsCallback = func(args ...interface{}) error {
 	}
 
 	return err
-}
+})
 
-var getPausingAppsCallback = func(args ...interface{}) error {
+var getPausingAppsCallback = util.InstrumentOp("service_manager.get_pausing_apps", func(args ...interface{}) error {
 	logPrefix := "ServiceMgr::getPausingAppsCallback"
 
 	aggPausingApps := args[0].(*map[string]map[string]string)
@@ -165,9 +165,9 @@ var getPausingAppsCallback = func(args ...interface{}) error {
 	}
 
 	return err
-}
+})
 
-var getBootstrappingAppsCallback = func(args ...interface{}) error {
+var getBootstrappingAppsCallback = util.InstrumentOp("service_manager.get_bootstrapping_apps", func(args ...interface{}) error {
 	logPrefix := "ServiceMgr::getBootstrappingAppsCallback"
 
 	aggBootstrappingApps := args[0].(*map[string]map[string]string)
@@ -180,4 +180,4 @@ var getBootstrappingAppsCallback = func(args ...interface{}) error {
 	}
 
 	return err
-}
+})
@@ -0,0 +1,68 @@
+package servicemanager
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/couchbase/eventing/common"
+	"github.com/couchbase/eventing/logging"
+)
+
+const (
+	// Upper bound on time startDebugger waits for a mutation to be trapped
+	maxDebuggerTrapWait = 5 * time.Minute
+)
+
+// getDebuggerTrapWait parses wait=secs passed to startDebugger, 0 implies caller
+// doesn't want to wait for a mutation to be trapped
+func (m *ServiceMgr) getDebuggerTrapWait(r *http.Request) (time.Duration, *runtimeInfo) {
+	info := &runtimeInfo{Code: m.statusCodes.ok.Code}
+
+	wait := r.URL.Query().Get("wait")
+	if wait == "" {
+		return 0, info
+	}
+
+	secs, err := strconv.Atoi(wait)
+	if err != nil || secs <= 0 {
+		info.Code = m.statusCodes.errInvalidConfig.Code
+		info.Info = fmt.Sprintf("Invalid wait: %s, expected positive number of seconds", wait)
+		return 0, info
+	}
+
+	timeout := time.Duration(secs) * time.Second
+	if timeout > maxDebuggerTrapWait {
+		timeout = maxDebuggerTrapWait
+	}
+	return timeout, info
+}
+
+// sendTrappedDebuggerURL waits for a worker on any eventing node to trap a mutation for
+// the debug session and writes DevTools URL of that worker. Traps on other nodes are
+// torn down by their producers as they learn of it
+func (m *ServiceMgr) sendTrappedDebuggerURL(w http.ResponseWriter, appName, token string, timeout time.Duration) {
+	logPrefix := "ServiceMgr::sendTrappedDebuggerURL"
+	info := &runtimeInfo{}
+
+	debugURL, err := m.superSup.WaitForDebuggerURL(appName, token, timeout)
+	if err == common.ErrDebuggerTrapTimeout {
+		w.Header().Add(headerKey, strconv.Itoa(m.statusCodes.ok.Code))
+		fmt.Fprintf(w, "Function: %s Started Debugger, no mutation trapped within %v", appName, timeout)
+		return
+	}
+
+	if err != nil {
+		info.Code = m.statusCodes.errRequestedOpFailed.Code
+		info.Info = fmt.Sprintf("Function: %s debugger started but failed to get debugger url, err: %v", appName, err)
+		m.sendErrorInfo(w, info)
+		return
+	}
+
+	logging.Infof("%s Function: %s mutation trapped, debugger url: %rs", logPrefix, appName, debugURL)
+	debugURL = strings.Replace(debugURL, "[::1]", "127.0.0.1", -1)
+	w.Header().Add(headerKey, strconv.Itoa(m.statusCodes.ok.Code))
+	fmt.Fprintf(w, "%s", debugURL)
+}
@@ -0,0 +1,140 @@
+package servicemanager
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/couchbase/eventing/audit"
+	"github.com/couchbase/eventing/common"
+	"github.com/couchbase/eventing/gen/auditevent"
+	"github.com/couchbase/eventing/logging"
+)
+
+const (
+	// Response header startDebugger hands out session token in, which is to be passed
+	// back to getDebuggerUrl either as token=X or in the same header
+	debuggerTokenHeader = "X-Debugger-Token"
+
+	// Debug sessions are stopped past this unless debugger_session_ttl says otherwise
+	defaultDebuggerSessionTTL = time.Hour
+)
+
+// getDebuggerToken reads token of debug session passed by caller
+func getDebuggerToken(r *http.Request) string {
+	if token := r.URL.Query().Get("token"); token != "" {
+		return token
+	}
+	return r.Header.Get(debuggerTokenHeader)
+}
+
+// getDebuggerSessionTTL reads debugger_session_ttl in seconds from config, 0 implies
+// sessions never expire
+func getDebuggerSessionTTL(config common.Config) time.Duration {
+	if val, ok := config["debugger_session_ttl"]; ok {
+		if secs, ok := val.(float64); ok {
+			return time.Duration(secs) * time.Second
+		}
+	}
+	return defaultDebuggerSessionTTL
+}
+
+// getDebuggerSessions serves /getDebuggerSessions, listing debug sessions live on
+// deployed functions. Session tokens aren't listed
+func (m *ServiceMgr) getDebuggerSessions(w http.ResponseWriter, r *http.Request) {
+	logPrefix := "ServiceMgr::getDebuggerSessions"
+
+	if !m.validateAuth(w, r, EventingPermissionManage) {
+		return
+	}
+
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	sessions := make([]*common.DebuggerSession, 0)
+	for appName := range m.superSup.GetDeployedApps() {
+		session, err := m.superSup.GetDebuggerSession(appName)
+		if err != nil {
+			logging.Errorf("%s Function: %s failed to read debugger session, err: %v", logPrefix, appName, err)
+			continue
+		}
+		if session != nil {
+			sessions = append(sessions, session)
+		}
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].AppName < sessions[j].AppName
+	})
+
+	data, err := json.MarshalIndent(sessions, "", " ")
+	if err != nil {
+		w.Header().Add(headerKey, strconv.Itoa(m.statusCodes.errMarshalResp.Code))
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "Failed to marshal debugger sessions, err: %v", err)
+		return
+	}
+
+	w.Header().Add(headerKey, strconv.Itoa(m.statusCodes.ok.Code))
+	fmt.Fprintf(w, "%v", string(data))
+}
+
+// terminateDebuggerSession serves /terminateDebuggerSession?name=X, stopping debug
+// session of the function regardless of who started it
+func (m *ServiceMgr) terminateDebuggerSession(w http.ResponseWriter, r *http.Request) {
+	logPrefix := "ServiceMgr::terminateDebuggerSession"
+
+	if !m.validateAuth(w, r, EventingPermissionManage) {
+		return
+	}
+
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	appName := r.URL.Query().Get("name")
+	if appName == "" {
+		w.Header().Add(headerKey, strconv.Itoa(m.statusCodes.errInvalidConfig.Code))
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Function name not specified")
+		return
+	}
+
+	logging.Infof("%s REST Call: %v %v", logPrefix, r.URL.Path, r.Method)
+	audit.Log(auditevent.StopDebug, r, appName)
+
+	if !m.checkIfDeployed(appName) {
+		info := &runtimeInfo{
+			Code: m.statusCodes.errAppNotDeployed.Code,
+			Info: fmt.Sprintf("Function: %s not deployed", appName),
+		}
+		m.sendErrorInfo(w, info)
+		return
+	}
+
+	session, err := m.superSup.GetDebuggerSession(appName)
+	if err != nil {
+		info := &runtimeInfo{
+			Code: m.statusCodes.errRequestedOpFailed.Code,
+			Info: fmt.Sprintf("Function: %s failed to read debugger session, err: %v", appName, err),
+		}
+		m.sendErrorInfo(w, info)
+		return
+	}
+
+	if session == nil {
+		w.Header().Add(headerKey, strconv.Itoa(m.statusCodes.ok.Code))
+		fmt.Fprintf(w, "Function: %s has no debugger session", appName)
+		return
+	}
+
+	m.superSup.SignalStopDebugger(appName)
+	w.Header().Add(headerKey, strconv.Itoa(m.statusCodes.ok.Code))
+	fmt.Fprintf(w, "Function: %s debugger session terminated", appName)
+}
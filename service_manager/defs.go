@@ -31,6 +31,10 @@ const (
 	metakvTempAppsPath       = metakvEventingPath + "tempApps/"
 	metakvChecksumPath       = metakvEventingPath + "checksum/"
 	metakvTempChecksumPath   = metakvEventingPath + "tempchecksum/"
+	metakvAppDiagnosticsPath = metakvEventingPath + "diagnostics/" // last compile and deployment diagnostics of function
+	metakvAppHistoryPath     = metakvEventingPath + "history/"     // versions deployed of function
+	metakvAppVersionsPath    = metakvEventingPath + "versions/"    // function definitions deployed, per version
+	metakvVersionChecksum    = metakvEventingPath + "versionchecksum/"
 	stopRebalance            = "stopRebalance"
 	startRebalance           = "startRebalance"
 	startFailover            = "startFailover"
@@ -54,11 +58,26 @@ const (
 	maxApplicationNameLength = 100
 	maxAliasLength           = 20 // Technically, there isn't any limit on a JavaScript variable length.
 	maxPrefixLength          = 16
+	maxHandlerRetryCount     = 10 // Retries run on the worker thread, holding up rest of its events
 
 	rebalanceStalenessCounter = 400
 )
 
 var (
+	// Failure domains reported as metrics, failures of each are exposed as <domain>_failures
+	failureDomains = []string{common.FailureDomainHandler, common.FailureDomainKV,
+		common.FailureDomainWorker, common.FailureDomainNetwork, common.FailureDomainMetadata}
+
+	// Rebalance phases reported as histogram metrics
+	rebalanceHistogramMetrics = []struct {
+		name  string
+		phase string
+	}{
+		{"rebalance_vb_takeover_duration_ms", common.RebalanceVbTakeover},
+		{"rebalance_timer_transfer_duration_ms", common.RebalanceTimerTransfer},
+		{"dcp_stream_open_latency_ms", common.RebalanceStreamOpen},
+	}
+
 	funtionTypes = map[string]struct{}{
 		"sbm":    struct{}{},
 		"notsbm": struct{}{},
@@ -85,6 +104,12 @@ type ServiceMgr struct {
 	config                  util.ConfigHolder
 	clusterEncryptionConfig *cbauth.ClusterEncryptionConfig
 	configMutex             *sync.RWMutex
+	diagnosticsMutex        *sync.Mutex
+	deploymentHistoryMutex  *sync.Mutex
+	recommendationMutex     *sync.RWMutex
+	backlogSamples          map[string][]*backlogSample // Access controlled by recommendationMutex
+	recommendations         map[string][]recommendation // Access controlled by recommendationMutex
+	statusSummary           *statusSummaryCache
 	httpServerSignal        chan bool
 	httpServerMutex         *sync.Mutex
 	ejectNodeUUIDs          []string
@@ -196,6 +221,7 @@ type application struct {
 	Name               string                 `json:"appname"`
 	Settings           map[string]interface{} `json:"settings"`
 	Metainfo           map[string]interface{} `json:"metainfo,omitempty"`
+	Diagnostics        *deploymentDiagnostics `json:"diagnostics,omitempty"`
 }
 
 type depCfg struct {
@@ -208,6 +234,10 @@ type depCfg struct {
 	MetadataBucket     string            `json:"metadata_bucket"`
 	MetadataScope      string            `json:"metadata_scope"`
 	MetadataCollection string            `json:"metadata_collection"`
+	SourceCollections  []string          `json:"source_collections,omitempty"` // Of source scope, listened to along with source collection
+	KeyPrefixes        []string          `json:"key_prefixes,omitempty"`       // Events are sent to handler only if key has one of these prefixes
+	KeyPatterns        []string          `json:"key_patterns,omitempty"`       // or matches one of these regexes. All keys pass if neither is set
+	DependsOn          []string          `json:"depends_on,omitempty"`         // Functions deployed before and undeployed after this one
 }
 
 type bucket struct {
@@ -216,6 +246,7 @@ type bucket struct {
 	ScopeName      string `json:"scope_name"`
 	CollectionName string `json:"collection_name"`
 	Access         string `json:"access"`
+	Durability     string `json:"durability,omitempty"`
 }
 
 type backlogStat struct {
@@ -224,12 +255,15 @@ type backlogStat struct {
 
 type stats struct {
 	CheckpointBlobDump              interface{} `json:"checkpoint_blob_dump,omitempty"`
+	DcpFeedEvents                   interface{} `json:"dcp_feed_events,omitempty"`
 	DCPFeedBoundary                 interface{} `json:"dcp_feed_boundary"`
 	DocTimerDebugStats              interface{} `json:"doc_timer_debug_stats,omitempty"`
 	EventProcessingStats            interface{} `json:"event_processing_stats,omitempty"`
 	EventsRemaining                 interface{} `json:"events_remaining,omitempty"`
 	ExecutionStats                  interface{} `json:"execution_stats,omitempty"`
 	FailureStats                    interface{} `json:"failure_stats,omitempty"`
+	FailureDomains                  interface{} `json:"failure_domains,omitempty"`
+	FencingStatus                   interface{} `json:"fencing_status,omitempty"`
 	FunctionName                    interface{} `json:"function_name"`
 	GocbCredsRequestCounter         interface{} `json:"gocb_creds_request_counter,omitempty"`
 	FunctionID                      interface{} `json:"function_id,omitempty"`
@@ -246,8 +280,10 @@ type stats struct {
 	SpanBlobDump                    interface{} `json:"span_blob_dump,omitempty"`
 	VbDcpEventsRemaining            interface{} `json:"dcp_event_backlog_per_vb,omitempty"`
 	VbDistributionStatsFromMetadata interface{} `json:"vb_distribution_stats_from_metadata,omitempty"`
+	VbPagination                    interface{} `json:"vb_pagination,omitempty"`
 	VbSeqnoStats                    interface{} `json:"vb_seq_no_stats,omitempty"`
 	WorkerPids                      interface{} `json:"worker_pids,omitempty"`
+	WorkerRestarts                  interface{} `json:"worker_restarts,omitempty"`
 }
 
 type configResponse struct {
@@ -265,6 +301,8 @@ type appStatus struct {
 	NumDeployedNodes      int    `json:"num_deployed_nodes"`
 	DeploymentStatus      bool   `json:"deployment_status"`
 	ProcessingStatus      bool   `json:"processing_status"`
+
+	Diagnostics *deploymentDiagnostics `json:"diagnostics,omitempty"`
 }
 
 type annotation struct {
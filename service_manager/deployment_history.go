@@ -0,0 +1,714 @@
+package servicemanager
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/couchbase/eventing/audit"
+	"github.com/couchbase/eventing/common"
+	"github.com/couchbase/eventing/gen/auditevent"
+	"github.com/couchbase/eventing/logging"
+	"github.com/couchbase/eventing/util"
+)
+
+const (
+	deploymentVersionsToRetain = 10
+
+	// Beyond this many lines added or removed, differing lines aren't aligned and are
+	// reported as removed and added in entirety. Bounds memory of a diff to about the
+	// square of it
+	maxCodeDiffEdits = 512
+)
+
+// deploymentVersion describes a deployment of a function. Code, bindings and settings
+// deployed are stored separately, under the version, as function definition
+type deploymentVersion struct {
+	Version    int    `json:"version"`
+	CodeHash   string `json:"code_hash"`
+	DeployUser string `json:"deploy_user,omitempty"`
+	Deployed   string `json:"deployed"`
+}
+
+type deploymentHistory struct {
+	LastVersion int                  `json:"last_version"`
+	Versions    []*deploymentVersion `json:"versions"`
+}
+
+// lineEdit keeps lines of base code, drops the ones following those and inserts new ones
+// after, in that order
+type lineEdit struct {
+	Keep   int      `json:"keep,omitempty"`
+	Drop   int      `json:"drop,omitempty"`
+	Insert []string `json:"insert,omitempty"`
+}
+
+// versionSnapshot is function definition stored for a version. Code of all but the latest
+// version is stored as edits rebuilding it from code of the version that followed it
+type versionSnapshot struct {
+	application
+	CodeDelta []lineEdit `json:"code_delta,omitempty"`
+}
+
+type settingChange struct {
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
+
+type deploymentDiff struct {
+	From          int                      `json:"from"`
+	To            int                      `json:"to"`
+	CodeChanged   bool                     `json:"code_changed"`
+	Code          []string                 `json:"code,omitempty"`
+	Settings      map[string]settingChange `json:"settings"`
+	DepcfgChanged bool                     `json:"depcfg_changed"`
+}
+
+func codeHash(appCode string) string {
+	hash := sha256.Sum256([]byte(appCode))
+	return hex.EncodeToString(hash[:])
+}
+
+func deploymentVersionKey(appName string, version int) string {
+	return appName + "/" + strconv.Itoa(version)
+}
+
+func (m *ServiceMgr) getDeploymentHistory(appName string) (*deploymentHistory, error) {
+	history := &deploymentHistory{}
+
+	data, err := util.MetakvGet(metakvAppHistoryPath + appName)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) == 0 {
+		return history, nil
+	}
+
+	err = json.Unmarshal(data, history)
+	if err != nil {
+		return nil, err
+	}
+	return history, nil
+}
+
+func (m *ServiceMgr) getVersionSnapshot(appName string, version int) (*versionSnapshot, error) {
+	data, err := util.ReadAppContent(metakvAppVersionsPath, metakvVersionChecksum, deploymentVersionKey(appName, version))
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := &versionSnapshot{}
+	err = json.Unmarshal(data, snapshot)
+	if err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+// getDeploymentVersion returns definition deployed as the version, rebuilding its code
+// from code of the versions that followed it
+func (m *ServiceMgr) getDeploymentVersion(appName string, version int) (*application, error) {
+	snapshot, err := m.getVersionSnapshot(appName, version)
+	if err != nil {
+		return nil, err
+	}
+	if snapshot.CodeDelta == nil {
+		return &snapshot.application, nil
+	}
+
+	history, err := m.getDeploymentHistory(appName)
+	if err != nil {
+		return nil, err
+	}
+
+	deltas := [][]lineEdit{snapshot.CodeDelta}
+	var code []string
+	for _, later := range history.Versions {
+		if later.Version <= version {
+			continue
+		}
+
+		laterSnapshot, err := m.getVersionSnapshot(appName, later.Version)
+		if err != nil {
+			return nil, err
+		}
+		if laterSnapshot.CodeDelta == nil {
+			code = strings.Split(laterSnapshot.AppHandlers, "\n")
+			break
+		}
+		deltas = append(deltas, laterSnapshot.CodeDelta)
+	}
+	if code == nil {
+		return nil, fmt.Errorf("no version after: %d stores code in full", version)
+	}
+
+	for i := len(deltas) - 1; i >= 0; i-- {
+		code, err = applyLineEdits(code, deltas[i])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	snapshot.AppHandlers = strings.Join(code, "\n")
+	return &snapshot.application, nil
+}
+
+// storeVersionSnapshot writes definition of the version, with code stored as edits
+// against the next version if there's delta
+func (m *ServiceMgr) storeVersionSnapshot(appName string, version int, snapshot *versionSnapshot) error {
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+
+	return util.WriteAppContent(metakvAppVersionsPath, metakvVersionChecksum,
+		deploymentVersionKey(appName, version), data, true)
+}
+
+// recordDeploymentVersion stores function definition being deployed as a new version
+// in its history, dropping the oldest versions beyond those retained. Curl credentials
+// aren't stored along, redeploy carries over those of the current definition
+func (m *ServiceMgr) recordDeploymentVersion(app *application, user string) {
+	logPrefix := "ServiceMgr::recordDeploymentVersion"
+
+	m.deploymentHistoryMutex.Lock()
+	defer m.deploymentHistoryMutex.Unlock()
+
+	history, err := m.getDeploymentHistory(app.Name)
+	if err != nil {
+		logging.Errorf("%s Function: %s failed to read deployment history, err: %v", logPrefix, app.Name, err)
+		return
+	}
+
+	snapshot := versionSnapshot{application: *app}
+	snapshot.Settings = util.DeepCopy(app.Settings)
+	snapshot.Metainfo = nil
+	snapshot.Diagnostics = nil
+	snapshot.DeploymentConfig.Curl = make([]common.Curl, len(app.DeploymentConfig.Curl))
+	for i, binding := range app.DeploymentConfig.Curl {
+		binding.Username, binding.Password, binding.BearerKey = "", "", ""
+		snapshot.DeploymentConfig.Curl[i] = binding
+	}
+
+	version := &deploymentVersion{
+		Version:    history.LastVersion + 1,
+		CodeHash:   codeHash(app.AppHandlers),
+		DeployUser: user,
+		Deployed:   time.Now().Format(time.RFC3339Nano),
+	}
+
+	err = m.storeVersionSnapshot(app.Name, version.Version, &snapshot)
+	if err != nil {
+		logging.Errorf("%s Function: %s failed to store version: %d, err: %v", logPrefix, app.Name, version.Version, err)
+		return
+	}
+
+	var previous *deploymentVersion
+	if len(history.Versions) > 0 {
+		previous = history.Versions[len(history.Versions)-1]
+	}
+
+	history.LastVersion = version.Version
+	history.Versions = append(history.Versions, version)
+
+	var expired []*deploymentVersion
+	if len(history.Versions) > deploymentVersionsToRetain {
+		expired = history.Versions[:len(history.Versions)-deploymentVersionsToRetain]
+		history.Versions = history.Versions[len(history.Versions)-deploymentVersionsToRetain:]
+	}
+
+	data, err := json.Marshal(history)
+	if err != nil {
+		logging.Errorf("%s Function: %s failed to marshal deployment history, err: %v", logPrefix, app.Name, err)
+		return
+	}
+
+	err = util.MetakvSet(metakvAppHistoryPath+app.Name, data, nil)
+	if err != nil {
+		logging.Errorf("%s Function: %s failed to store deployment history, err: %v", logPrefix, app.Name, err)
+		return
+	}
+
+	for _, old := range expired {
+		m.deleteDeploymentVersion(app.Name, old.Version)
+	}
+
+	// Only the latest version keeps its code in full
+	if previous != nil {
+		m.storeCodeDelta(app.Name, previous.Version, app.AppHandlers)
+	}
+
+	logging.Infof("%s Function: %s recorded deployment version: %d code hash: %s",
+		logPrefix, app.Name, version.Version, version.CodeHash)
+}
+
+// storeCodeDelta rewrites code stored in full for the version as edits against code of
+// the version that followed it
+func (m *ServiceMgr) storeCodeDelta(appName string, version int, laterCode string) {
+	logPrefix := "ServiceMgr::storeCodeDelta"
+
+	snapshot, err := m.getVersionSnapshot(appName, version)
+	if err != nil {
+		logging.Errorf("%s Function: %s failed to read version: %d, err: %v", logPrefix, appName, version, err)
+		return
+	}
+	if snapshot.CodeDelta != nil {
+		return
+	}
+
+	delta, ok := lineEdits(strings.Split(laterCode, "\n"), strings.Split(snapshot.AppHandlers, "\n"))
+	if !ok {
+		return
+	}
+	snapshot.AppHandlers = ""
+	snapshot.CodeDelta = delta
+
+	err = m.storeVersionSnapshot(appName, version, snapshot)
+	if err != nil {
+		logging.Errorf("%s Function: %s failed to store code delta of version: %d, err: %v", logPrefix, appName, version, err)
+	}
+}
+
+func (m *ServiceMgr) deleteDeploymentVersion(appName string, version int) {
+	logPrefix := "ServiceMgr::deleteDeploymentVersion"
+
+	key := deploymentVersionKey(appName, version)
+	if err := util.MetaKvDelete(metakvVersionChecksum+key, nil); err != nil {
+		logging.Errorf("%s Function: %s failed to delete checksum of version: %d, err: %v", logPrefix, appName, version, err)
+	}
+	if err := util.MetakvRecursiveDelete(metakvAppVersionsPath + key + "/"); err != nil {
+		logging.Errorf("%s Function: %s failed to delete version: %d, err: %v", logPrefix, appName, version, err)
+	}
+}
+
+func (m *ServiceMgr) deleteDeploymentHistory(appName string) {
+	logPrefix := "ServiceMgr::deleteDeploymentHistory"
+
+	m.deploymentHistoryMutex.Lock()
+	defer m.deploymentHistoryMutex.Unlock()
+
+	if err := util.MetakvRecursiveDelete(metakvVersionChecksum + appName + "/"); err != nil {
+		logging.Errorf("%s Function: %s failed to delete checksums of versions, err: %v", logPrefix, appName, err)
+	}
+	if err := util.MetakvRecursiveDelete(metakvAppVersionsPath + appName + "/"); err != nil {
+		logging.Errorf("%s Function: %s failed to delete versions, err: %v", logPrefix, appName, err)
+	}
+	if err := util.MetaKvDelete(metakvAppHistoryPath+appName, nil); err != nil {
+		logging.Errorf("%s Function: %s failed to delete deployment history, err: %v", logPrefix, appName, err)
+	}
+}
+
+// getDeploymentHistoryHandler serves /getDeploymentHistory?name=X listing deployed versions
+// of the function, with version=N it returns definition deployed as that version
+func (m *ServiceMgr) getDeploymentHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	if !m.validateAuth(w, r, EventingPermissionManage) {
+		return
+	}
+
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	values := r.URL.Query()
+	appName := values.Get("name")
+	if appName == "" {
+		w.Header().Add(headerKey, strconv.Itoa(m.statusCodes.errInvalidConfig.Code))
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Function name needs to be specified")
+		return
+	}
+
+	var response interface{}
+	if versionStr := values.Get("version"); versionStr != "" {
+		version, err := strconv.Atoi(versionStr)
+		if err != nil {
+			w.Header().Add(headerKey, strconv.Itoa(m.statusCodes.errInvalidConfig.Code))
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "Invalid version: %s", versionStr)
+			return
+		}
+
+		app, ok := m.readDeploymentVersion(w, appName, version)
+		if !ok {
+			return
+		}
+		response = app
+	} else {
+		history, err := m.getDeploymentHistory(appName)
+		if err != nil {
+			w.Header().Add(headerKey, strconv.Itoa(m.statusCodes.errReadReq.Code))
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, "Function: %s failed to read deployment history, err: %v", appName, err)
+			return
+		}
+		response = history.Versions
+	}
+
+	data, err := json.MarshalIndent(response, "", " ")
+	if err != nil {
+		w.Header().Add(headerKey, strconv.Itoa(m.statusCodes.errMarshalResp.Code))
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "Failed to marshal deployment history, err: %v", err)
+		return
+	}
+
+	w.Header().Add(headerKey, strconv.Itoa(m.statusCodes.ok.Code))
+	fmt.Fprintf(w, "%v", string(data))
+}
+
+// diffDeploymentVersions serves /diffDeploymentVersions?name=X&from=N&to=M comparing
+// code, settings and bindings of two deployed versions of the function
+func (m *ServiceMgr) diffDeploymentVersions(w http.ResponseWriter, r *http.Request) {
+	if !m.validateAuth(w, r, EventingPermissionManage) {
+		return
+	}
+
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	values := r.URL.Query()
+	appName := values.Get("name")
+	from, fromErr := strconv.Atoi(values.Get("from"))
+	to, toErr := strconv.Atoi(values.Get("to"))
+	if appName == "" || fromErr != nil || toErr != nil {
+		w.Header().Add(headerKey, strconv.Itoa(m.statusCodes.errInvalidConfig.Code))
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Function name, from and to versions need to be specified")
+		return
+	}
+
+	fromApp, ok := m.readDeploymentVersion(w, appName, from)
+	if !ok {
+		return
+	}
+	toApp, ok := m.readDeploymentVersion(w, appName, to)
+	if !ok {
+		return
+	}
+
+	diff := &deploymentDiff{
+		From:          from,
+		To:            to,
+		CodeChanged:   fromApp.AppHandlers != toApp.AppHandlers,
+		Settings:      diffSettings(fromApp.Settings, toApp.Settings),
+		DepcfgChanged: !reflect.DeepEqual(fromApp.DeploymentConfig, toApp.DeploymentConfig),
+	}
+	if diff.CodeChanged {
+		diff.Code = diffLines(strings.Split(fromApp.AppHandlers, "\n"), strings.Split(toApp.AppHandlers, "\n"))
+	}
+
+	data, err := json.MarshalIndent(diff, "", " ")
+	if err != nil {
+		w.Header().Add(headerKey, strconv.Itoa(m.statusCodes.errMarshalResp.Code))
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "Failed to marshal diff, err: %v", err)
+		return
+	}
+
+	w.Header().Add(headerKey, strconv.Itoa(m.statusCodes.ok.Code))
+	fmt.Fprintf(w, "%v", string(data))
+}
+
+// redeployVersion serves /redeployVersion?name=X&version=N restoring code, bindings and
+// settings of an earlier version into the undeployed function and deploying it
+func (m *ServiceMgr) redeployVersion(w http.ResponseWriter, r *http.Request) {
+	logPrefix := "ServiceMgr::redeployVersion"
+
+	if !m.validateAuth(w, r, EventingPermissionManage) {
+		return
+	}
+
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	values := r.URL.Query()
+	appName := values.Get("name")
+	version, err := strconv.Atoi(values.Get("version"))
+	if appName == "" || err != nil {
+		w.Header().Add(headerKey, strconv.Itoa(m.statusCodes.errInvalidConfig.Code))
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Function name and version need to be specified")
+		return
+	}
+
+	logging.Infof("%s REST Call: %v %v", logPrefix, r.URL.Path, r.Method)
+	audit.Log(auditevent.SetSettings, r, appName)
+
+	if m.checkIfDeployed(appName) {
+		info := &runtimeInfo{
+			Code: m.statusCodes.errAppDeployed.Code,
+			Info: fmt.Sprintf("Function: %s needs to be undeployed before redeploying an earlier version", appName),
+		}
+		m.sendErrorInfo(w, info)
+		return
+	}
+
+	snapshot, ok := m.readDeploymentVersion(w, appName, version)
+	if !ok {
+		return
+	}
+
+	app, info := m.getTempStore(appName)
+	if info.Code != m.statusCodes.ok.Code {
+		m.sendErrorInfo(w, info)
+		return
+	}
+
+	// Carry over credentials of current bindings, as versions are stored without those
+	creds := make(map[string]common.Curl)
+	for _, binding := range app.DeploymentConfig.Curl {
+		creds[binding.Value+"@"+binding.Hostname] = binding
+	}
+	for i, binding := range snapshot.DeploymentConfig.Curl {
+		if current, ok := creds[binding.Value+"@"+binding.Hostname]; ok {
+			snapshot.DeploymentConfig.Curl[i].Username = current.Username
+			snapshot.DeploymentConfig.Curl[i].Password = current.Password
+			snapshot.DeploymentConfig.Curl[i].BearerKey = current.BearerKey
+		}
+	}
+
+	app.AppHandlers = snapshot.AppHandlers
+	app.DeploymentConfig = snapshot.DeploymentConfig
+	app.Settings = snapshot.Settings
+	if app.Settings == nil {
+		app.Settings = make(map[string]interface{})
+	}
+	app.Settings["deployment_status"] = false
+	app.Settings["processing_status"] = false
+
+	if info = m.saveTempStore(app); info.Code != m.statusCodes.ok.Code {
+		m.sendErrorInfo(w, info)
+		return
+	}
+
+	data, err := json.Marshal(map[string]interface{}{"deployment_status": true, "processing_status": true})
+	if err != nil {
+		w.Header().Add(headerKey, strconv.Itoa(m.statusCodes.errMarshalResp.Code))
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "Failed to marshal settings, err: %v", err)
+		return
+	}
+
+	info = m.setSettings(appName, data, false, m.getRequestUser(r))
+	if info.Code != m.statusCodes.ok.Code {
+		m.sendErrorInfo(w, info)
+		return
+	}
+
+	logging.Infof("%s Function: %s redeploying version: %d", logPrefix, appName, version)
+	w.Header().Add(headerKey, strconv.Itoa(m.statusCodes.ok.Code))
+	m.sendSettingsWarnings(w, info)
+}
+
+// readDeploymentVersion fetches definition deployed as the version, writing out an error
+// response if it couldn't be
+func (m *ServiceMgr) readDeploymentVersion(w http.ResponseWriter, appName string, version int) (*application, bool) {
+	app, err := m.getDeploymentVersion(appName, version)
+	if err == util.AppNotExist {
+		w.Header().Add(headerKey, strconv.Itoa(m.statusCodes.errAppNotFoundTs.Code))
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprintf(w, "Function: %s version: %d not found in deployment history", appName, version)
+		return nil, false
+	}
+	if err != nil {
+		w.Header().Add(headerKey, strconv.Itoa(m.statusCodes.errReadReq.Code))
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "Function: %s failed to read version: %d, err: %v", appName, version, err)
+		return nil, false
+	}
+	return app, true
+}
+
+func diffSettings(from, to map[string]interface{}) map[string]settingChange {
+	changes := make(map[string]settingChange)
+	for setting, fromValue := range from {
+		if toValue, ok := to[setting]; !ok || !reflect.DeepEqual(fromValue, toValue) {
+			changes[setting] = settingChange{From: fromValue, To: to[setting]}
+		}
+	}
+	for setting, toValue := range to {
+		if _, ok := from[setting]; !ok {
+			changes[setting] = settingChange{To: toValue}
+		}
+	}
+	return changes
+}
+
+// diffLines returns lines of to, prefixed by "+ " if added and "  " if unchanged,
+// interleaved with lines of from removed in it, prefixed by "- "
+func diffLines(from, to []string) []string {
+	edits, ok := lineEdits(from, to)
+	if !ok {
+		edits = []lineEdit{{Drop: len(from), Insert: to}}
+	}
+
+	diff := make([]string, 0, len(to))
+	pos := 0
+	for _, edit := range edits {
+		for _, line := range from[pos : pos+edit.Keep] {
+			diff = append(diff, "  "+line)
+		}
+		pos += edit.Keep
+
+		for _, line := range from[pos : pos+edit.Drop] {
+			diff = append(diff, "- "+line)
+		}
+		pos += edit.Drop
+
+		for _, line := range edit.Insert {
+			diff = append(diff, "+ "+line)
+		}
+	}
+	return diff
+}
+
+// lineEdits returns shortest edits turning from into to, found by Myers' diff. Returns
+// false if it takes more than maxCodeDiffEdits lines added or removed
+func lineEdits(from, to []string) ([]lineEdit, bool) {
+	prefix := 0
+	for prefix < len(from) && prefix < len(to) && from[prefix] == to[prefix] {
+		prefix++
+	}
+
+	suffix := 0
+	for suffix < len(from)-prefix && suffix < len(to)-prefix &&
+		from[len(from)-1-suffix] == to[len(to)-1-suffix] {
+		suffix++
+	}
+
+	a, b := from[prefix:len(from)-suffix], to[prefix:len(to)-suffix]
+	n, m := len(a), len(b)
+
+	limit := n + m
+	if limit > maxCodeDiffEdits {
+		limit = maxCodeDiffEdits
+	}
+
+	// v[offset+k] holds furthest x reached on diagonal k = x - y. trace[d] holds v after
+	// d edits, over diagonals -d to d
+	offset := limit + 1
+	v := make([]int, 2*limit+3)
+	trace := make([][]int, 0)
+	done := false
+	for d := 0; d <= limit && !done; d++ {
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				done = true
+				break
+			}
+		}
+		trace = append(trace, append([]int(nil), v[offset-d:offset+d+1]...))
+	}
+	if !done {
+		return nil, false
+	}
+
+	// Walk back from the end, noting per line whether it's kept, dropped or inserted
+	ops := make([]byte, 0, n+m)
+	x, y := n, m
+	for d := len(trace) - 1; d > 0; d-- {
+		prev := trace[d-1]
+		k := x - y
+
+		var prevK int
+		if k == -d || (k != d && prev[k-1+d-1] < prev[k+1+d-1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := prev[prevK+d-1]
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			ops = append(ops, ' ')
+			x--
+			y--
+		}
+		if x == prevX {
+			ops = append(ops, '+')
+			y--
+		} else {
+			ops = append(ops, '-')
+			x--
+		}
+	}
+	for ; x > 0; x-- {
+		ops = append(ops, ' ')
+	}
+
+	edits := []lineEdit{{Keep: prefix}}
+	j := 0
+	for i := len(ops) - 1; i >= 0; i-- {
+		edit := &edits[len(edits)-1]
+		switch ops[i] {
+		case ' ':
+			if edit.Drop != 0 || len(edit.Insert) != 0 {
+				edits = append(edits, lineEdit{})
+				edit = &edits[len(edits)-1]
+			}
+			edit.Keep++
+			j++
+		case '-':
+			if len(edit.Insert) != 0 {
+				edits = append(edits, lineEdit{})
+				edit = &edits[len(edits)-1]
+			}
+			edit.Drop++
+		case '+':
+			edit.Insert = append(edit.Insert, b[j])
+			j++
+		}
+	}
+
+	if suffix != 0 {
+		edit := &edits[len(edits)-1]
+		if edit.Drop != 0 || len(edit.Insert) != 0 {
+			edits = append(edits, lineEdit{})
+			edit = &edits[len(edits)-1]
+		}
+		edit.Keep += suffix
+	}
+	return edits, true
+}
+
+// applyLineEdits rebuilds code from base it was diffed against
+func applyLineEdits(base []string, edits []lineEdit) ([]string, error) {
+	code := make([]string, 0, len(base))
+	pos := 0
+	for _, edit := range edits {
+		if pos+edit.Keep+edit.Drop > len(base) {
+			return nil, fmt.Errorf("edits run past %d lines of base code", len(base))
+		}
+		code = append(code, base[pos:pos+edit.Keep]...)
+		pos += edit.Keep + edit.Drop
+		code = append(code, edit.Insert...)
+	}
+	if pos != len(base) {
+		return nil, fmt.Errorf("edits cover %d of %d lines of base code", pos, len(base))
+	}
+	return code, nil
+}
@@ -0,0 +1,128 @@
+package servicemanager
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestDiffLines(t *testing.T) {
+	tests := []struct {
+		name     string
+		from     string
+		to       string
+		expected []string
+	}{
+		{"unchanged", "a\nb", "a\nb", []string{"  a", "  b"}},
+		{"line added", "a\nc", "a\nb\nc", []string{"  a", "+ b", "  c"}},
+		{"line removed", "a\nb\nc", "a\nc", []string{"  a", "- b", "  c"}},
+		{"line changed", "a\nb\nc", "a\nx\nc", []string{"  a", "- b", "+ x", "  c"}},
+		{"lines moved", "a\nb\nc\nd", "b\nc\na\nd", []string{"- a", "  b", "  c", "+ a", "  d"}},
+		{"all replaced", "a\nb", "x", []string{"- a", "- b", "+ x"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := diffLines(strings.Split(test.from, "\n"), strings.Split(test.to, "\n"))
+			if !reflect.DeepEqual(got, test.expected) {
+				t.Errorf("got: %q expected: %q", got, test.expected)
+			}
+		})
+	}
+}
+
+func TestDiffLinesPastEditLimit(t *testing.T) {
+	from := make([]string, maxCodeDiffEdits)
+	to := make([]string, maxCodeDiffEdits)
+	for i := range from {
+		from[i] = "from" + strconv.Itoa(i)
+		to[i] = "to" + strconv.Itoa(i)
+	}
+
+	if _, ok := lineEdits(from, to); ok {
+		t.Fatalf("edits found past limit of %d", maxCodeDiffEdits)
+	}
+
+	diff := diffLines(from, to)
+	if len(diff) != len(from)+len(to) || diff[0] != "- from0" || diff[len(from)] != "+ to0" {
+		t.Errorf("got: %d lines expected all of from removed and to added", len(diff))
+	}
+}
+
+func TestApplyLineEdits(t *testing.T) {
+	tests := []struct {
+		name string
+		from string
+		to   string
+	}{
+		{"unchanged", "a\nb", "a\nb"},
+		{"empty code", "", "a\nb"},
+		{"prefix and suffix kept", "a\nb\nc\nd", "a\nx\ny\nd"},
+		{"interleaved changes", "a\nb\nc\nd\ne\nf", "b\nx\nd\ne\ny\nz"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			from, to := strings.Split(test.from, "\n"), strings.Split(test.to, "\n")
+
+			edits, ok := lineEdits(from, to)
+			if !ok {
+				t.Fatalf("no edits found")
+			}
+			got, err := applyLineEdits(from, edits)
+			if err != nil {
+				t.Fatalf("failed to apply edits: %+v, err: %v", edits, err)
+			}
+			if !reflect.DeepEqual(got, to) {
+				t.Errorf("got: %q expected: %q", got, to)
+			}
+		})
+	}
+
+	if _, err := applyLineEdits([]string{"a"}, []lineEdit{{Keep: 2}}); err == nil {
+		t.Errorf("edits running past base code applied")
+	}
+}
+
+func TestDiffSettings(t *testing.T) {
+	tests := []struct {
+		name     string
+		from     map[string]interface{}
+		to       map[string]interface{}
+		expected map[string]settingChange
+	}{
+		{
+			name:     "unchanged",
+			from:     map[string]interface{}{"worker_count": 1.0},
+			to:       map[string]interface{}{"worker_count": 1.0},
+			expected: map[string]settingChange{},
+		},
+		{
+			name:     "changed",
+			from:     map[string]interface{}{"worker_count": 1.0},
+			to:       map[string]interface{}{"worker_count": 3.0},
+			expected: map[string]settingChange{"worker_count": {From: 1.0, To: 3.0}},
+		},
+		{
+			name:     "added and removed",
+			from:     map[string]interface{}{"log_level": "INFO"},
+			to:       map[string]interface{}{"timer_context_size": 1024.0},
+			expected: map[string]settingChange{"log_level": {From: "INFO"}, "timer_context_size": {To: 1024.0}},
+		},
+		{
+			name:     "nested value changed",
+			from:     map[string]interface{}{"handler_headers": []interface{}{"a"}},
+			to:       map[string]interface{}{"handler_headers": []interface{}{"a", "b"}},
+			expected: map[string]settingChange{"handler_headers": {From: []interface{}{"a"}, To: []interface{}{"a", "b"}}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := diffSettings(test.from, test.to); !reflect.DeepEqual(got, test.expected) {
+				t.Errorf("got: %v expected: %v", got, test.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package servicemanager
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/couchbase/cbauth"
+	"github.com/couchbase/eventing/common"
+	"github.com/couchbase/eventing/logging"
+	"github.com/couchbase/eventing/util"
+)
+
+// deploymentDiagnostics captures outcome of last compilation and deployment of a
+// function, so that it's available without going through logs
+type deploymentDiagnostics struct {
+	CompileInfo         *common.CompileStatus `json:"compile_info,omitempty"`
+	LastDeployRequested string                `json:"last_deploy_requested,omitempty"`
+	LastDeployed        string                `json:"last_deployed,omitempty"`
+	DeployUser          string                `json:"deploy_user,omitempty"`
+	BootstrapDurationMs int64                 `json:"bootstrap_duration_ms,omitempty"`
+}
+
+func (m *ServiceMgr) getDiagnostics(appName string) (*deploymentDiagnostics, error) {
+	diagnostics := &deploymentDiagnostics{}
+
+	data, err := util.MetakvGet(metakvAppDiagnosticsPath + appName)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) == 0 {
+		return diagnostics, nil
+	}
+
+	err = json.Unmarshal(data, diagnostics)
+	if err != nil {
+		return nil, err
+	}
+	return diagnostics, nil
+}
+
+func (m *ServiceMgr) updateDiagnostics(appName string, update func(*deploymentDiagnostics) bool) {
+	logPrefix := "ServiceMgr::updateDiagnostics"
+
+	m.diagnosticsMutex.Lock()
+	defer m.diagnosticsMutex.Unlock()
+
+	diagnostics, err := m.getDiagnostics(appName)
+	if err != nil {
+		logging.Errorf("%s Function: %s failed to read diagnostics, err: %v", logPrefix, appName, err)
+		return
+	}
+
+	if !update(diagnostics) {
+		return
+	}
+
+	data, err := json.Marshal(diagnostics)
+	if err != nil {
+		logging.Errorf("%s Function: %s failed to marshal diagnostics, err: %v", logPrefix, appName, err)
+		return
+	}
+
+	err = util.MetakvSet(metakvAppDiagnosticsPath+appName, data, nil)
+	if err != nil {
+		logging.Errorf("%s Function: %s failed to store diagnostics, err: %v", logPrefix, appName, err)
+	}
+}
+
+func (m *ServiceMgr) recordCompileInfo(appName string, compileInfo *common.CompileStatus) {
+	if compileInfo == nil {
+		return
+	}
+
+	m.updateDiagnostics(appName, func(diagnostics *deploymentDiagnostics) bool {
+		diagnostics.CompileInfo = compileInfo
+		return true
+	})
+}
+
+func (m *ServiceMgr) recordDeployRequest(appName, user string) {
+	m.updateDiagnostics(appName, func(diagnostics *deploymentDiagnostics) bool {
+		diagnostics.LastDeployRequested = time.Now().Format(time.RFC3339Nano)
+		diagnostics.LastDeployed = ""
+		diagnostics.DeployUser = user
+		diagnostics.BootstrapDurationMs = 0
+		return true
+	})
+}
+
+// RecordBootstrapFinished is called by supervisor once function, whose bootstrap
+// on this node began at started, has finished bootstrapping here. The latest node
+// to finish following the last deploy request marks the function deployed across
+// the cluster
+func (m *ServiceMgr) RecordBootstrapFinished(appName string, started, finished time.Time) {
+	logPrefix := "ServiceMgr::RecordBootstrapFinished"
+
+	m.updateDiagnostics(appName, func(diagnostics *deploymentDiagnostics) bool {
+		requested, err := time.Parse(time.RFC3339Nano, diagnostics.LastDeployRequested)
+		if err != nil || started.Before(requested) {
+			return false
+		}
+
+		if deployed, err := time.Parse(time.RFC3339Nano, diagnostics.LastDeployed); err == nil && !finished.After(deployed) {
+			return false
+		}
+
+		diagnostics.LastDeployed = finished.Format(time.RFC3339Nano)
+		diagnostics.BootstrapDurationMs = int64(finished.Sub(requested) / time.Millisecond)
+		logging.Infof("%s Function: %s bootstrapped on this node in %v, %v since deploy request",
+			logPrefix, appName, finished.Sub(started), finished.Sub(requested))
+		return true
+	})
+}
+
+func (m *ServiceMgr) deleteDiagnostics(appName string) {
+	logPrefix := "ServiceMgr::deleteDiagnostics"
+
+	m.diagnosticsMutex.Lock()
+	defer m.diagnosticsMutex.Unlock()
+
+	err := util.MetaKvDelete(metakvAppDiagnosticsPath+appName, nil)
+	if err != nil {
+		logging.Errorf("%s Function: %s failed to delete diagnostics, err: %v", logPrefix, appName, err)
+	}
+}
+
+func (m *ServiceMgr) getRequestUser(r *http.Request) string {
+	creds, err := cbauth.AuthWebCreds(r)
+	if err != nil || creds == nil {
+		return ""
+	}
+	return creds.Name()
+}
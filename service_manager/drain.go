@@ -0,0 +1,173 @@
+package servicemanager
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/couchbase/cbauth"
+	"github.com/couchbase/cbauth/service"
+	"github.com/couchbase/eventing/common"
+	"github.com/couchbase/eventing/logging"
+	"github.com/couchbase/eventing/util"
+)
+
+type drainStatus struct {
+	NodeUUID              string `json:"node_uuid"`
+	Draining              bool   `json:"draining"`
+	Drained               bool   `json:"drained"`
+	VbsOwnedPerPlan       int    `json:"vbs_owned_per_plan"`
+	VbsRemainingToShuffle int    `json:"vbs_remaining_to_shuffle"`
+}
+
+// drainNodeHandler moves vbuckets off an eventing node ahead of its removal, so
+// that subsequent rebalance doesn't have to shuffle any vbuckets or timers.
+// POST marks the node as maintenance node, which excludes it from the planner,
+// and kicks off internal rebalance. Vbuckets are given up to their planned owners
+// along with timers stored against them. GET reports drain progress and DELETE
+// brings the node back into vbucket assignment
+func (m *ServiceMgr) drainNodeHandler(w http.ResponseWriter, r *http.Request) {
+	logPrefix := "ServiceMgr::drainNodeHandler"
+
+	w.Header().Set("Content-Type", "application/json")
+	if !m.validateAuth(w, r, EventingPermissionManage) {
+		cbauth.SendForbidden(w, EventingPermissionManage)
+		return
+	}
+
+	logging.Infof("%s REST Call: %v %v", logPrefix, r.URL.Path, r.Method)
+
+	nodeUUID := r.URL.Query().Get("uuid")
+	if nodeUUID == "" {
+		nodeUUID = m.uuid
+	}
+
+	nodeAddr, info := m.getNodeAddrFromUUID(nodeUUID)
+	if info.Code != m.statusCodes.ok.Code {
+		m.sendErrorInfo(w, info)
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		status, info := m.getDrainStatus(nodeUUID, nodeAddr)
+		if info.Code != m.statusCodes.ok.Code {
+			m.sendErrorInfo(w, info)
+			return
+		}
+
+		info.Info = status
+		m.sendRuntimeInfo(w, info)
+
+	case "POST":
+		if info = m.setNodeDraining(nodeUUID, true); info.Code != m.statusCodes.ok.Code {
+			m.sendErrorInfo(w, info)
+			return
+		}
+
+		err := m.checkTopologyChangeReadiness(service.TopologyChangeTypeRebalance)
+		if err != nil {
+			info.Code = m.statusCodes.errRequestedOpFailed.Code
+			info.Info = fmt.Sprintf("Node: %s marked for drain, but failed to start moving vbuckets, err: %v", nodeUUID, err)
+			m.sendErrorInfo(w, info)
+			return
+		}
+
+		// Vbuckets move between all eventing nodes, so every one of them needs to replan.
+		// Rebalance token in metakv gets them to, as it does for rebalance from ns_server
+		changeID := fmt.Sprintf("drain_%s_%d", nodeUUID, time.Now().UnixNano())
+		logging.Infof("%s Triggering rebalance to drain node: %s, writing rebalance token: %s to metakv",
+			logPrefix, nodeUUID, changeID)
+		util.Retry(util.NewFixedBackoff(time.Second), nil, cleanupEventingMetaKvPath, metakvRebalanceTokenPath)
+		util.Retry(util.NewFixedBackoff(time.Second), nil, metaKVSetCallback, metakvRebalanceTokenPath+changeID, changeID)
+
+		info.Info = fmt.Sprintf("Started draining node: %s", nodeUUID)
+		m.sendRuntimeInfo(w, info)
+
+	case "DELETE":
+		if info = m.setNodeDraining(nodeUUID, false); info.Code != m.statusCodes.ok.Code {
+			m.sendErrorInfo(w, info)
+			return
+		}
+
+		info.Info = fmt.Sprintf("Node: %s will be considered for vbucket assignment from next rebalance", nodeUUID)
+		m.sendRuntimeInfo(w, info)
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (m *ServiceMgr) getNodeAddrFromUUID(nodeUUID string) (string, *runtimeInfo) {
+	info := &runtimeInfo{}
+
+	nodeAddrs, err := m.getActiveNodeAddrs()
+	if err != nil {
+		info.Code = m.statusCodes.errActiveEventingNodes.Code
+		info.Info = fmt.Sprintf("Failed to fetch active Eventing nodes, err: %v", err)
+		return "", info
+	}
+
+	addrUUIDMap, err := util.GetNodeUUIDs("/uuid", nodeAddrs)
+	if err != nil {
+		info.Code = m.statusCodes.errRequestedOpFailed.Code
+		info.Info = fmt.Sprintf("Failed to fetch Eventing node uuids, err: %v", err)
+		return "", info
+	}
+
+	nodeAddr, ok := addrUUIDMap[nodeUUID]
+	if !ok {
+		info.Code = m.statusCodes.errInvalidConfig.Code
+		info.Info = fmt.Sprintf("Node: %s isn't an active Eventing node", nodeUUID)
+		return "", info
+	}
+
+	info.Code = m.statusCodes.ok.Code
+	return nodeAddr, info
+}
+
+// setNodeDraining adds or removes node from maintenance_nodes in Eventing config
+func (m *ServiceMgr) setNodeDraining(nodeUUID string, draining bool) (info *runtimeInfo) {
+	c, info := m.getConfig()
+	if info.Code != m.statusCodes.ok.Code {
+		return
+	}
+
+	maintenanceNodes := make([]interface{}, 0)
+	for _, node := range util.GetMaintenanceNodes() {
+		if node != nodeUUID {
+			maintenanceNodes = append(maintenanceNodes, node)
+		}
+	}
+	if draining {
+		maintenanceNodes = append(maintenanceNodes, nodeUUID)
+	}
+
+	if c == nil {
+		c = make(common.Config)
+	}
+	c["maintenance_nodes"] = maintenanceNodes
+	return m.saveConfig(c)
+}
+
+func (m *ServiceMgr) getDrainStatus(nodeUUID, nodeAddr string) (*drainStatus, *runtimeInfo) {
+	info := &runtimeInfo{}
+
+	progress, _, errMap := util.GetProgress("/getRebalanceProgress", []string{nodeAddr})
+	if len(errMap) > 0 {
+		info.Code = m.statusCodes.errRequestedOpFailed.Code
+		info.Info = fmt.Sprintf("Failed to fetch vbucket ownership from node: %s, err: %v", nodeUUID, errMap)
+		return nil, info
+	}
+
+	status := &drainStatus{
+		NodeUUID:              nodeUUID,
+		Draining:              util.Contains(nodeUUID, util.GetMaintenanceNodes()),
+		VbsOwnedPerPlan:       progress.VbsOwnedPerPlan,
+		VbsRemainingToShuffle: progress.VbsRemainingToShuffle,
+	}
+	status.Drained = status.Draining && status.VbsOwnedPerPlan == 0 && status.VbsRemainingToShuffle == 0
+
+	info.Code = m.statusCodes.ok.Code
+	return status, info
+}
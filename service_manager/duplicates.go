@@ -0,0 +1,176 @@
+package servicemanager
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/couchbase/eventing/logging"
+)
+
+const (
+	duplicateCheckOff   = "off"
+	duplicateCheckWarn  = "warn"
+	duplicateCheckBlock = "block"
+
+	defaultDuplicateCheck = duplicateCheckWarn
+)
+
+type duplicateFunctions struct {
+	Fingerprint    string   `json:"fingerprint"`
+	SourceKeyspace string   `json:"source_keyspace"`
+	Functions      []string `json:"functions"`
+	Deployed       []string `json:"deployed"`
+}
+
+// functionFingerprint hashes handler code, ignoring indentation and blank lines,
+// along with the source keyspace it listens to
+func functionFingerprint(app *application) string {
+	lines := make([]string, 0)
+	for _, line := range strings.Split(app.AppHandlers, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+
+	hash := sha256.New()
+	hash.Write([]byte(sourceKeyspaceOf(app)))
+	hash.Write([]byte{0})
+	hash.Write([]byte(strings.Join(lines, "\n")))
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func sourceKeyspaceOf(app *application) string {
+	return fmt.Sprintf("%s:%s:%s", app.DeploymentConfig.SourceBucket,
+		app.DeploymentConfig.SourceScope, app.DeploymentConfig.SourceCollection)
+}
+
+func isAppDeployed(app *application) bool {
+	deployed, ok := app.Settings["deployment_status"].(bool)
+	return ok && deployed
+}
+
+func (m *ServiceMgr) getDuplicateCheckMode() string {
+	config, info := m.getConfig()
+	if info.Code != m.statusCodes.ok.Code {
+		return defaultDuplicateCheck
+	}
+
+	if mode, ok := config["duplicate_function_check"].(string); ok {
+		return mode
+	}
+	return defaultDuplicateCheck
+}
+
+// findDeployedDuplicates returns deployed functions having same code and source keyspace as app
+func (m *ServiceMgr) findDeployedDuplicates(app *application) []string {
+	fingerprint := functionFingerprint(app)
+
+	duplicates := make([]string, 0)
+	for _, other := range m.getTempStoreAll() {
+		if other.Name == app.Name || !isAppDeployed(&other) {
+			continue
+		}
+
+		if functionFingerprint(&other) == fingerprint {
+			duplicates = append(duplicates, other.Name)
+		}
+	}
+
+	sort.Strings(duplicates)
+	return duplicates
+}
+
+// checkDuplicateDeployment warns about or blocks deployment of a function identical to one
+// already deployed, as per duplicate_function_check config
+func (m *ServiceMgr) checkDuplicateDeployment(app *application) (info *runtimeInfo) {
+	logPrefix := "ServiceMgr::checkDuplicateDeployment"
+
+	info = &runtimeInfo{}
+	info.Code = m.statusCodes.ok.Code
+
+	mode := m.getDuplicateCheckMode()
+	if mode == duplicateCheckOff {
+		return
+	}
+
+	duplicates := m.findDeployedDuplicates(app)
+	if len(duplicates) == 0 {
+		return
+	}
+
+	msg := fmt.Sprintf("Function: %s has same code and source keyspace: %s as deployed function(s): %v",
+		app.Name, sourceKeyspaceOf(app), duplicates)
+
+	if mode == duplicateCheckBlock {
+		info.Code = m.statusCodes.errDuplicateFunction.Code
+		info.Info = msg + ", set duplicate_function_check to warn to deploy anyway"
+		logging.Errorf("%s %s", logPrefix, info.Info)
+		return
+	}
+
+	logging.Warnf("%s %s, every mutation would be processed multiple times", logPrefix, msg)
+	return
+}
+
+// getDuplicateFunctions lists groups of functions that have same code and source keyspace
+func (m *ServiceMgr) getDuplicateFunctions(w http.ResponseWriter, r *http.Request) {
+	if !m.validateAuth(w, r, EventingPermissionManage) {
+		return
+	}
+
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	groups := make(map[string]*duplicateFunctions)
+	for _, app := range m.getTempStoreAll() {
+		fingerprint := functionFingerprint(&app)
+
+		group, ok := groups[fingerprint]
+		if !ok {
+			group = &duplicateFunctions{
+				Fingerprint:    fingerprint,
+				SourceKeyspace: sourceKeyspaceOf(&app),
+				Deployed:       make([]string, 0),
+			}
+			groups[fingerprint] = group
+		}
+
+		group.Functions = append(group.Functions, app.Name)
+		if isAppDeployed(&app) {
+			group.Deployed = append(group.Deployed, app.Name)
+		}
+	}
+
+	duplicates := make([]*duplicateFunctions, 0)
+	for _, group := range groups {
+		if len(group.Functions) < 2 {
+			continue
+		}
+
+		sort.Strings(group.Functions)
+		sort.Strings(group.Deployed)
+		duplicates = append(duplicates, group)
+	}
+
+	sort.Slice(duplicates, func(i, j int) bool {
+		return duplicates[i].Functions[0] < duplicates[j].Functions[0]
+	})
+
+	data, err := json.MarshalIndent(duplicates, "", " ")
+	if err != nil {
+		w.Header().Add(headerKey, strconv.Itoa(m.statusCodes.errMarshalResp.Code))
+		fmt.Fprintf(w, "Failed to marshal duplicate functions, err: %v", err)
+		return
+	}
+
+	w.Header().Add(headerKey, strconv.Itoa(m.statusCodes.ok.Code))
+	fmt.Fprintf(w, "%v", string(data))
+}
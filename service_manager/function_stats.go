@@ -0,0 +1,283 @@
+package servicemanager
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/couchbase/eventing/common"
+	"github.com/couchbase/eventing/logging"
+	"github.com/couchbase/eventing/util"
+)
+
+// Latency percentiles reported from histogram merged across nodes
+var functionStatsPercentiles = []int{50, 80, 90, 95, 99}
+
+// functionStats captures stats of a function aggregated across its consumers, and
+// when merged, across eventing nodes
+type functionStats struct {
+	FunctionName         string                 `json:"function_name"`
+	Nodes                int                    `json:"nodes"`
+	EventProcessingStats map[string]uint64      `json:"event_processing_stats"`
+	ExecutionStats       map[string]interface{} `json:"execution_stats"`
+	FailureStats         map[string]interface{} `json:"failure_stats"`
+	LcbExceptionStats    map[string]uint64      `json:"lcb_exception_stats"`
+	LatencyStats         common.StatsData       `json:"latency_stats"`
+	CurlLatencyStats     common.StatsData       `json:"curl_latency_stats"`
+	LatencyPercentiles   map[string]int         `json:"latency_percentile_stats,omitempty"`
+	NodeErrors           map[string]string      `json:"node_errors,omitempty"`
+}
+
+func newFunctionStats(appName string) *functionStats {
+	return &functionStats{
+		FunctionName:         appName,
+		EventProcessingStats: make(map[string]uint64),
+		ExecutionStats:       make(map[string]interface{}),
+		FailureStats:         make(map[string]interface{}),
+		LcbExceptionStats:    make(map[string]uint64),
+		LatencyStats:         make(common.StatsData),
+		CurlLatencyStats:     make(common.StatsData),
+	}
+}
+
+func (m *ServiceMgr) localFunctionStats(appName string) *functionStats {
+	fnStats := newFunctionStats(appName)
+	fnStats.Nodes = 1
+	fnStats.merge(&functionStats{
+		EventProcessingStats: m.superSup.GetEventProcessingStats(appName),
+		ExecutionStats:       m.superSup.GetExecutionStats(appName),
+		FailureStats:         m.superSup.GetFailureStats(appName),
+		LcbExceptionStats:    m.superSup.GetLcbExceptionsStats(appName),
+		LatencyStats:         m.superSup.GetLatencyStats(appName),
+		CurlLatencyStats:     m.superSup.GetCurlLatencyStats(appName),
+	})
+	return fnStats
+}
+
+func mergeUintStats(dst, src map[string]uint64) {
+	for k, v := range src {
+		dst[k] += v
+	}
+}
+
+// mergeStats sums up numeric stats, others e.g. timestamps are retained as is
+func mergeStats(dst, src map[string]interface{}) {
+	for k, v := range src {
+		value, ok := v.(float64)
+		if !ok {
+			if number, isInt := v.(uint64); isInt {
+				value, ok = float64(number), true
+			} else if number, isInt := v.(int64); isInt {
+				value, ok = float64(number), true
+			}
+		}
+
+		if !ok {
+			// Nested sections e.g. n1ql are summed up per key
+			if nested, isNested := v.(map[string]interface{}); isNested {
+				prevNested, ok := dst[k].(map[string]interface{})
+				if !ok {
+					prevNested = make(map[string]interface{})
+					dst[k] = prevNested
+				}
+				mergeStats(prevNested, nested)
+				continue
+			}
+			dst[k] = v
+			continue
+		}
+
+		prev, _ := dst[k].(float64)
+		dst[k] = prev + value
+	}
+}
+
+func (s *functionStats) merge(other *functionStats) {
+	mergeUintStats(s.EventProcessingStats, other.EventProcessingStats)
+	mergeStats(s.ExecutionStats, other.ExecutionStats)
+	mergeStats(s.FailureStats, other.FailureStats)
+	mergeUintStats(s.LcbExceptionStats, other.LcbExceptionStats)
+	mergeUintStats(s.LatencyStats, other.LatencyStats)
+	mergeUintStats(s.CurlLatencyStats, other.CurlLatencyStats)
+}
+
+func (s *functionStats) computePercentiles() {
+	if len(s.LatencyStats) == 0 {
+		return
+	}
+
+	s.LatencyPercentiles = make(map[string]int)
+	for _, p := range functionStatsPercentiles {
+		s.LatencyPercentiles[fmt.Sprintf("p%d", p)] = percentileN(s.LatencyStats, p)
+	}
+}
+
+// aggregateFunctionStats merges stats of the function from all eventing nodes
+func (m *ServiceMgr) aggregateFunctionStats(appName string) *functionStats {
+	logPrefix := "ServiceMgr::aggregateFunctionStats"
+
+	aggStats := newFunctionStats(appName)
+
+	util.Retry(util.NewFixedBackoff(time.Second), nil, getEventingNodesAddressesOpCallback, m)
+	netClient := util.CheckTLSandGetClient(util.HTTPRequestTimeout)
+
+	for _, nodeAddr := range m.eventingNodeAddrs {
+		url := util.CheckTLSandReplaceProtocol("http://%s/getLocalFunctionStats?name=%s", nodeAddr, appName)
+
+		nodeStats, err := fetchFunctionStats(netClient, url)
+		if err != nil {
+			logging.Errorf("%s Function: %s failed to gather stats from node: %rs, err: %v", logPrefix, appName, nodeAddr, err)
+			if aggStats.NodeErrors == nil {
+				aggStats.NodeErrors = make(map[string]string)
+			}
+			aggStats.NodeErrors[nodeAddr] = err.Error()
+			continue
+		}
+
+		aggStats.Nodes++
+		aggStats.merge(nodeStats)
+	}
+
+	aggStats.computePercentiles()
+	return aggStats
+}
+
+func fetchFunctionStats(netClient *util.Client, url string) (*functionStats, error) {
+	res, err := netClient.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code: %d", res.StatusCode)
+	}
+
+	buf, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	nodeStats := newFunctionStats("")
+	err = json.Unmarshal(buf, nodeStats)
+	return nodeStats, err
+}
+
+// prometheusFormat renders numeric stats in Prometheus text exposition format
+func (s *functionStats) prometheusFormat() []byte {
+	fmtStr := "%v%v{functionName=\"%v\"} %v\n"
+	out := make([]byte, 0, APPROX_METRIC_SIZE*(len(s.EventProcessingStats)+len(s.ExecutionStats)+len(s.FailureStats)))
+
+	appendUints := func(stats map[string]uint64) {
+		names := make([]string, 0, len(stats))
+		for name := range stats {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			out = append(out, []byte(fmt.Sprintf(fmtStr, METRICS_PREFIX, name, s.FunctionName, stats[name]))...)
+		}
+	}
+
+	appendNumbers := func(stats map[string]interface{}) {
+		names := make([]string, 0, len(stats))
+		for name, value := range stats {
+			if _, ok := value.(float64); ok {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			value := strconv.FormatFloat(stats[name].(float64), 'f', -1, 64)
+			out = append(out, []byte(fmt.Sprintf(fmtStr, METRICS_PREFIX, name, s.FunctionName, value))...)
+		}
+	}
+
+	appendUints(s.EventProcessingStats)
+	appendNumbers(s.ExecutionStats)
+	appendNumbers(s.FailureStats)
+
+	lcbStats := make(map[string]uint64)
+	for code, count := range s.LcbExceptionStats {
+		lcbStats["lcb_exception_"+strings.ToLower(code)] = count
+	}
+	appendUints(lcbStats)
+
+	for _, p := range functionStatsPercentiles {
+		if value, ok := s.LatencyPercentiles[fmt.Sprintf("p%d", p)]; ok {
+			out = append(out, []byte(fmt.Sprintf("%vlatency_percentile{functionName=\"%v\",percentile=\"%d\"} %v\n",
+				METRICS_PREFIX, s.FunctionName, p, value))...)
+		}
+	}
+
+	return out
+}
+
+// getLocalFunctionStats returns stats of the function aggregated across consumers on this node
+func (m *ServiceMgr) getLocalFunctionStats(w http.ResponseWriter, r *http.Request) {
+	if !m.validateAuth(w, r, EventingPermissionManage) {
+		return
+	}
+
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	values := r.URL.Query()
+	if len(values["name"]) == 0 {
+		w.Header().Add(headerKey, strconv.Itoa(m.statusCodes.errInvalidConfig.Code))
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Function name not specified")
+		return
+	}
+
+	data, err := json.Marshal(m.localFunctionStats(values["name"][0]))
+	if err != nil {
+		w.Header().Add(headerKey, strconv.Itoa(m.statusCodes.errMarshalResp.Code))
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "Failed to marshal function stats, err: %v", err)
+		return
+	}
+
+	w.Header().Add(headerKey, strconv.Itoa(m.statusCodes.ok.Code))
+	fmt.Fprintf(w, "%v", string(data))
+}
+
+// functionStatsHandler serves /api/v1/stats?appName=X with stats of the function
+// merged across all eventing nodes, as JSON or in Prometheus text format
+func (m *ServiceMgr) functionStatsHandler(w http.ResponseWriter, r *http.Request, appName string) {
+	if !m.checkIfDeployed(appName) {
+		info := &runtimeInfo{
+			Code: m.statusCodes.errAppNotDeployed.Code,
+			Info: fmt.Sprintf("Function: %s not deployed", appName),
+		}
+		m.sendErrorInfo(w, info)
+		return
+	}
+
+	aggStats := m.aggregateFunctionStats(appName)
+
+	if r.URL.Query().Get("format") == "prometheus" {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		w.WriteHeader(http.StatusOK)
+		w.Write(aggStats.prometheusFormat())
+		return
+	}
+
+	response, err := json.MarshalIndent(aggStats, "", " ")
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error":"Failed to marshal response for stats, err: %v"}`, err)
+		return
+	}
+
+	fmt.Fprintf(w, "%s", string(response))
+}
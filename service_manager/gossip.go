@@ -0,0 +1,178 @@
+package servicemanager
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/couchbase/eventing/common"
+	"github.com/couchbase/eventing/logging"
+	"github.com/couchbase/eventing/util"
+)
+
+const (
+	healthGossipInterval = 3 * time.Second
+	healthGossipTimeout  = 2 * time.Second
+)
+
+// gossipPeerHealth periodically exchanges health with rest of the eventing nodes,
+// so that node failures and fencing are learnt about ahead of ns_server
+func (m *ServiceMgr) gossipPeerHealth() {
+	logPrefix := "ServiceMgr::gossipPeerHealth"
+
+	ticker := time.NewTicker(healthGossipInterval)
+	defer ticker.Stop()
+
+	// Own address isn't known upfront, it's learnt from the first exchange with self
+	var selfAddr string
+
+	for {
+		select {
+		case <-ticker.C:
+			selfAddr = m.exchangePeerHealth(selfAddr)
+
+		case <-m.finch:
+			logging.Infof("%s Exiting health gossip routine", logPrefix)
+			return
+		}
+	}
+}
+
+func (m *ServiceMgr) exchangePeerHealth(selfAddr string) string {
+	logPrefix := "ServiceMgr::exchangePeerHealth"
+
+	err := getEventingNodesAddressesOpCallback(m)
+	if err != nil {
+		return selfAddr
+	}
+	nodeAddrs := append([]string(nil), m.eventingNodeAddrs...)
+
+	payload, err := json.Marshal(m.superSup.LocalNodeHealth())
+	if err != nil {
+		logging.Errorf("%s Failed to marshal local node health, err: %v", logPrefix, err)
+		return selfAddr
+	}
+
+	netClient := util.CheckTLSandGetClient(healthGossipTimeout)
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, nodeAddr := range nodeAddrs {
+		if nodeAddr == selfAddr {
+			continue
+		}
+
+		wg.Add(1)
+		go func(nodeAddr string) {
+			defer wg.Done()
+
+			url := util.CheckTLSandReplaceProtocol("http://%s/gossipHealth", nodeAddr)
+			res, err := netClient.Post(url, "application/json", bytes.NewReader(payload))
+			if err != nil {
+				logging.Debugf("%s Failed to exchange health with node: %rs, err: %v", logPrefix, nodeAddr, err)
+				return
+			}
+			defer res.Body.Close()
+
+			if res.StatusCode != http.StatusOK {
+				logging.Debugf("%s Node: %rs responded with status: %d", logPrefix, nodeAddr, res.StatusCode)
+				return
+			}
+
+			data, err := ioutil.ReadAll(res.Body)
+			if err != nil {
+				logging.Debugf("%s Failed to read health of node: %rs, err: %v", logPrefix, nodeAddr, err)
+				return
+			}
+
+			var health common.NodeHealth
+			err = json.Unmarshal(data, &health)
+			if err != nil {
+				logging.Debugf("%s Failed to unmarshal health of node: %rs, err: %v", logPrefix, nodeAddr, err)
+				return
+			}
+
+			if health.NodeUUID == m.uuid {
+				mu.Lock()
+				selfAddr = nodeAddr
+				mu.Unlock()
+				return
+			}
+
+			health.HostPortAddr = nodeAddr
+			m.superSup.UpdatePeerHealth(&health)
+		}(nodeAddr)
+	}
+	wg.Wait()
+
+	return selfAddr
+}
+
+// gossipHealth records health of the calling eventing node and responds with health
+// of this node
+func (m *ServiceMgr) gossipHealth(w http.ResponseWriter, r *http.Request) {
+	logPrefix := "ServiceMgr::gossipHealth"
+
+	if !m.validateAuth(w, r, EventingPermissionManage) {
+		return
+	}
+
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Failed to read request body, err: %v", err)
+		return
+	}
+
+	var health common.NodeHealth
+	err = json.Unmarshal(data, &health)
+	if err != nil {
+		logging.Errorf("%s Failed to unmarshal node health, err: %v", logPrefix, err)
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Failed to unmarshal node health, err: %v", err)
+		return
+	}
+	m.superSup.UpdatePeerHealth(&health)
+
+	response, err := json.Marshal(m.superSup.LocalNodeHealth())
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "Failed to marshal node health, err: %v", err)
+		return
+	}
+
+	w.Header().Add(headerKey, strconv.Itoa(m.statusCodes.ok.Code))
+	fmt.Fprintf(w, "%v", string(response))
+}
+
+// getPeerHealth returns health last gossiped by other eventing nodes, keyed by node uuid
+func (m *ServiceMgr) getPeerHealth(w http.ResponseWriter, r *http.Request) {
+	if !m.validateAuth(w, r, EventingPermissionManage) {
+		return
+	}
+
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	data, err := json.MarshalIndent(m.superSup.GetPeerHealth(), "", " ")
+	if err != nil {
+		w.Header().Add(headerKey, strconv.Itoa(m.statusCodes.errMarshalResp.Code))
+		fmt.Fprintf(w, "Failed to marshal peer health, err: %v", err)
+		return
+	}
+
+	w.Header().Add(headerKey, strconv.Itoa(m.statusCodes.ok.Code))
+	fmt.Fprintf(w, "%v", string(data))
+}
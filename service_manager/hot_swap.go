@@ -0,0 +1,181 @@
+package servicemanager
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+
+	"github.com/couchbase/eventing/common"
+	"github.com/couchbase/eventing/logging"
+	"github.com/couchbase/eventing/parser"
+	"github.com/couchbase/eventing/util"
+)
+
+// hotSwapAppCode serves /hotSwapAppCode?name=X, swapping handler code of a deployed
+// function with the code in request body, without restarting its DCP streams. Code is
+// saved to primary store and rolled out to every eventing node by bumping the hot swap
+// revision in settings of the function, so respawned workers load it as well
+func (m *ServiceMgr) hotSwapAppCode(w http.ResponseWriter, r *http.Request) {
+	logPrefix := "ServiceMgr::hotSwapAppCode"
+
+	if !m.validateAuth(w, r, EventingPermissionManage) {
+		return
+	}
+
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	appName := r.URL.Query().Get("name")
+	if appName == "" {
+		w.Header().Add(headerKey, strconv.Itoa(m.statusCodes.errInvalidConfig.Code))
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Function name not specified")
+		return
+	}
+
+	logging.Infof("%s REST Call: %v %v", logPrefix, r.URL.Path, r.Method)
+
+	if !m.checkIfDeployed(appName) {
+		info := &runtimeInfo{
+			Code: m.statusCodes.errAppNotDeployed.Code,
+			Info: fmt.Sprintf("Function: %s not deployed", appName),
+		}
+		m.sendErrorInfo(w, info)
+		return
+	}
+
+	appCode, err := ioutil.ReadAll(r.Body)
+	if err != nil || len(appCode) == 0 {
+		info := &runtimeInfo{
+			Code: m.statusCodes.errReadReq.Code,
+			Info: fmt.Sprintf("Function: %s failed to read handler code from request, err: %v", appName, err),
+		}
+		m.sendErrorInfo(w, info)
+		return
+	}
+
+	if info := m.saveHotSwap(appName, string(appCode)); info.Code != m.statusCodes.ok.Code {
+		m.sendErrorInfo(w, info)
+		return
+	}
+
+	logging.Infof("%s Function: %s handler code saved for hot swap, size: %d", logPrefix, appName, len(appCode))
+
+	w.Header().Add(headerKey, strconv.Itoa(m.statusCodes.ok.Code))
+	fmt.Fprintf(w, "Function: %s handler code swap rolling out", appName)
+}
+
+// saveHotSwap compiles handler code and stores it in temp and primary stores, then
+// bumps hot_swap_revision in settings. Settings change notifies eventing nodes, each
+// of which loads the stored code into running consumers of the function
+func (m *ServiceMgr) saveHotSwap(appName, appCode string) (info *runtimeInfo) {
+	logPrefix := "ServiceMgr::saveHotSwap"
+
+	if info = m.checkLifeCycleOpsDuringRebalance(); info.Code != m.statusCodes.ok.Code {
+		return
+	}
+
+	app, info := m.getTempStore(appName)
+	if info.Code != m.statusCodes.ok.Code {
+		return
+	}
+
+	info = &runtimeInfo{}
+
+	// Timer store is set up at deploy based on timer usage, which a swap can't revisit
+	if parser.UsingTimer(appCode) != parser.UsingTimer(app.AppHandlers) {
+		info.Code = m.statusCodes.errInvalidConfig.Code
+		info.Info = fmt.Sprintf("Function: %s %v", appName, common.ErrHotSwapTimerUse)
+		return
+	}
+
+	settingsPath := metakvAppSettingsPath + appName
+	sData, err := util.MetakvGet(settingsPath)
+	if err != nil {
+		info.Code = m.statusCodes.errGetConfig.Code
+		info.Info = fmt.Sprintf("Function: %s failed to read settings, err: %v", appName, err)
+		logging.Errorf("%s %s", logPrefix, info.Info)
+		return
+	}
+
+	settings := make(map[string]interface{})
+	if err = json.Unmarshal(sData, &settings); err != nil {
+		info.Code = m.statusCodes.errUnmarshalPld.Code
+		info.Info = fmt.Sprintf("Function: %s failed to unmarshal settings, err: %v", appName, err)
+		logging.Errorf("%s %s", logPrefix, info.Info)
+		return
+	}
+
+	app.AppHandlers = appCode
+	app.Settings = settings
+
+	preparedApp, _ := applicationAdapter(&app)
+	appContent := util.EncodeAppPayload(&preparedApp)
+
+	compressPayload := m.checkCompressHandler()
+	payload, err := util.MaybeCompress(appContent, compressPayload)
+	if err != nil {
+		info.Code = m.statusCodes.errSaveAppPs.Code
+		info.Info = fmt.Sprintf("Function: %s Error in compressing: %v", appName, err)
+		logging.Errorf("%s %s", logPrefix, info.Info)
+		return
+	}
+	if len(payload) > util.MaxFunctionSize() {
+		info.Code = m.statusCodes.errAppCodeSize.Code
+		info.Info = fmt.Sprintf("Function: %s handler Code size is more than %d. Code Size: %d", appName, util.MaxFunctionSize(), len(payload))
+		logging.Errorf("%s %s", logPrefix, info.Info)
+		return
+	}
+
+	compilationInfo, err := m.compileAppCode(&app, appContent)
+	m.recordCompileInfo(appName, compilationInfo)
+	if err != nil || !compilationInfo.CompileSuccess {
+		info.Code = m.statusCodes.errHandlerCompile.Code
+		info.Info = compilationInfo
+		return
+	}
+
+	if info = m.saveTempStore(app); info.Code != m.statusCodes.ok.Code {
+		return
+	}
+
+	info = &runtimeInfo{}
+	if err = util.DeleteStaleAppContent(metakvAppsPath, appName); err != nil {
+		info.Code = m.statusCodes.errSaveAppPs.Code
+		info.Info = fmt.Sprintf("Function: %s failed to clean up stale entry, err: %v", appName, err)
+		logging.Errorf("%s %s", logPrefix, info.Info)
+		return
+	}
+
+	if err = util.WriteAppContent(metakvAppsPath, metakvChecksumPath, appName, appContent, compressPayload); err != nil {
+		info.Code = m.statusCodes.errSaveAppPs.Code
+		info.Info = fmt.Sprintf("Function: %s unable to save to primary store, err: %v", appName, err)
+		logging.Errorf("%s %s", logPrefix, info.Info)
+		return
+	}
+
+	revision, _ := settings["hot_swap_revision"].(float64)
+	settings["hot_swap_revision"] = revision + 1
+
+	sData, err = json.MarshalIndent(&settings, "", " ")
+	if err != nil {
+		info.Code = m.statusCodes.errMarshalResp.Code
+		info.Info = fmt.Sprintf("Function: %s failed to marshal settings, err: %v", appName, err)
+		logging.Errorf("%s %s", logPrefix, info.Info)
+		return
+	}
+
+	if err = util.MetakvSet(settingsPath, sData, nil); err != nil {
+		info.Code = m.statusCodes.errSetSettingsPs.Code
+		info.Info = fmt.Sprintf("Function: %s failed to store updated settings in metakv, err: %v", appName, err)
+		logging.Errorf("%s %s", logPrefix, info.Info)
+		return
+	}
+
+	info.Code = m.statusCodes.ok.Code
+	return
+}
@@ -28,7 +28,6 @@ import (
 	"github.com/couchbase/cbauth/service"
 	"github.com/couchbase/eventing/audit"
 	"github.com/couchbase/eventing/common"
-	"github.com/couchbase/eventing/consumer"
 	"github.com/couchbase/eventing/gen/auditevent"
 	"github.com/couchbase/eventing/gen/flatbuf/cfg"
 	"github.com/couchbase/eventing/logging"
@@ -161,6 +160,9 @@ func (m *ServiceMgr) deletePrimaryStore(appName string) (info *runtimeInfo) {
 		return
 	}
 
+	m.deleteDiagnostics(appName)
+	m.deleteDeploymentHistory(appName)
+
 	// TODO : This must be changed to app not deployed / found
 	info.Code = m.statusCodes.ok.Code
 	info.Info = fmt.Sprintf("Function: %s deleting in the background", appName)
@@ -479,7 +481,15 @@ func (m *ServiceMgr) getDebuggerURL(w http.ResponseWriter, r *http.Request) {
 	logging.Debugf("%s Function: %s got request to get V8 debugger url", logPrefix, appName)
 
 	if m.checkIfDeployed(appName) {
-		debugURL, _ := m.superSup.GetDebuggerURL(appName)
+		debugURL, err := m.superSup.GetDebuggerURL(appName, getDebuggerToken(r))
+		if err == common.ErrDebuggerTokenMismatch {
+			info := &runtimeInfo{
+				Code: m.statusCodes.errDebuggerToken.Code,
+				Info: fmt.Sprintf("Function: %s debugger url is only handed out to the session which started it", appName),
+			}
+			m.sendErrorInfo(w, info)
+			return
+		}
 		debugURL = strings.Replace(debugURL, "[::1]", "127.0.0.1", -1)
 		w.Header().Add(headerKey, strconv.Itoa(m.statusCodes.ok.Code))
 		fmt.Fprintf(w, "%s", debugURL)
@@ -526,10 +536,24 @@ func (m *ServiceMgr) logFileLocation(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
 	c := m.config.Load()
-	fmt.Fprintf(w, `{"log_dir":"%v"}`, c["eventing_dir"])
+	locations := map[string]interface{}{
+		"log_dir":               c["eventing_dir"],
+		"eventing_dir":          c["eventing_dir"],
+		"previous_eventing_dir": c["previous_eventing_dir"],
+		"diag_dir":              c["diag_dir"],
+	}
+
+	data, err := json.MarshalIndent(locations, "", " ")
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error":"Failed to marshal response, err: %v"}`, err)
+		return
+	}
+
+	fmt.Fprintf(w, "%s", string(data))
 }
 
-func (m *ServiceMgr) notifyDebuggerStart(appName string, hostnames []string) (info *runtimeInfo) {
+func (m *ServiceMgr) notifyDebuggerStart(appName string, hostnames []string, replay *common.DebuggerReplay, ttl time.Duration) (token string, info *runtimeInfo) {
 	logPrefix := "ServiceMgr::notifyDebuggerStart"
 	info = &runtimeInfo{}
 
@@ -540,8 +564,8 @@ func (m *ServiceMgr) notifyDebuggerStart(appName string, hostnames []string) (in
 		return
 	}
 
-	token := uuidGen.Str()
-	m.superSup.WriteDebuggerToken(appName, token, hostnames)
+	token = uuidGen.Str()
+	m.superSup.WriteDebuggerToken(appName, token, hostnames, replay, ttl)
 	logging.Infof("%s Function: %s notifying on debugger path %s",
 		logPrefix, appName, common.MetakvDebuggerPath+appName)
 
@@ -628,10 +652,33 @@ func (m *ServiceMgr) startDebugger(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if info = m.notifyDebuggerStart(appName, GetNodesHostname(data)); info.Code != m.statusCodes.ok.Code {
+	replay, err := GetDebuggerReplay(data)
+	if err != nil {
+		info.Code = m.statusCodes.errInvalidConfig.Code
+		info.Info = fmt.Sprintf("Invalid replay in request, err : %v", err)
 		m.sendErrorInfo(w, info)
 		return
 	}
+
+	wait, info := m.getDebuggerTrapWait(r)
+	if info.Code != m.statusCodes.ok.Code {
+		m.sendErrorInfo(w, info)
+		return
+	}
+
+	token, info := m.notifyDebuggerStart(appName, GetNodesHostname(data), replay, getDebuggerSessionTTL(config))
+	if info.Code != m.statusCodes.ok.Code {
+		m.sendErrorInfo(w, info)
+		return
+	}
+
+	// Session token is needed to fetch debugger url later on
+	w.Header().Add(debuggerTokenHeader, token)
+
+	if wait > 0 {
+		m.sendTrappedDebuggerURL(w, appName, token, wait)
+		return
+	}
 	w.Header().Add(headerKey, strconv.Itoa(m.statusCodes.ok.Code))
 	fmt.Fprintf(w, "Function: %s Started Debugger", appName)
 }
@@ -1110,6 +1157,32 @@ func (m *ServiceMgr) getLatencyStats(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprintf(w, "Function: %s not deployed", appName)
 }
 
+// getOpStats returns latency and failures of KV, metakv and ns_server calls made
+// by eventing-producer on this node, per instrumented operation
+func (m *ServiceMgr) getOpStats(w http.ResponseWriter, r *http.Request) {
+	logPrefix := "ServiceMgr::getOpStats"
+	if !m.validateAuth(w, r, EventingPermissionManage) {
+		return
+	}
+
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	data, err := json.MarshalIndent(util.GetOpStats(), "", " ")
+	if err != nil {
+		w.Header().Add(headerKey, strconv.Itoa(m.statusCodes.errMarshalResp.Code))
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "Failed to marshal op stats, err: %v\n", err)
+		logging.Errorf("%s Failed to marshal op stats, err: %v", logPrefix, err)
+		return
+	}
+
+	w.Header().Add(headerKey, strconv.Itoa(m.statusCodes.ok.Code))
+	fmt.Fprintf(w, "%s", string(data))
+}
+
 func (m *ServiceMgr) getExecutionStats(w http.ResponseWriter, r *http.Request) {
 	logPrefix := "ServiceMgr::getExecutionStats"
 	if !m.validateAuth(w, r, EventingPermissionManage) {
@@ -1231,12 +1304,14 @@ func (m *ServiceMgr) setSettingsHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	if info := m.setSettings(appName, data, force); info.Code != m.statusCodes.ok.Code {
+	info := m.setSettings(appName, data, force, m.getRequestUser(r))
+	if info.Code != m.statusCodes.ok.Code {
 		m.sendErrorInfo(w, info)
 		return
 	}
 
 	w.Header().Add(headerKey, strconv.Itoa(m.statusCodes.ok.Code))
+	m.sendSettingsWarnings(w, info)
 }
 
 func (m *ServiceMgr) getSettings(appName string) (*map[string]interface{}, *runtimeInfo) {
@@ -1256,7 +1331,7 @@ func (m *ServiceMgr) getSettings(appName string) (*map[string]interface{}, *runt
 	return &app.Settings, &info
 }
 
-func (m *ServiceMgr) setSettings(appName string, data []byte, force bool) (info *runtimeInfo) {
+func (m *ServiceMgr) setSettings(appName string, data []byte, force bool, user string) (info *runtimeInfo) {
 	logPrefix := "ServiceMgr::setSettings"
 
 	info = &runtimeInfo{}
@@ -1347,6 +1422,12 @@ func (m *ServiceMgr) setSettings(appName string, data []byte, force bool) (info
 	for setting := range settings {
 		app.Settings[setting] = settings[setting]
 	}
+	workerCountWarnings := m.clampWorkerCounts(appName, app.Settings)
+
+	if info = m.validateDeadLetterSource(&app); info.Code != m.statusCodes.ok.Code {
+		logging.Errorf("%s %s", logPrefix, info.Info)
+		return
+	}
 
 	processingStatus, pOk := app.Settings["processing_status"].(bool)
 	deploymentStatus, dOk := app.Settings["deployment_status"].(bool)
@@ -1464,6 +1545,8 @@ func (m *ServiceMgr) setSettings(appName string, data []byte, force bool) (info
 					logging.Errorf("%s %s", logPrefix, info.Info)
 					return
 				}
+				m.recordDeployRequest(appName, user)
+				m.recordDeploymentVersion(&app, user)
 			}
 		}
 	} else {
@@ -1499,6 +1582,13 @@ func (m *ServiceMgr) setSettings(appName string, data []byte, force bool) (info
 	info.Code = m.statusCodes.ok.Code
 	info.Info = fmt.Sprintf("Function: %s stored settings", appName)
 	logging.Infof("%s %s", logPrefix, info.Info)
+
+	if len(workerCountWarnings) > 0 {
+		info.Info = warningsInfo{
+			Status:   info.Info.(string),
+			Warnings: workerCountWarnings,
+		}
+	}
 	return
 }
 
@@ -1528,6 +1618,18 @@ func (m *ServiceMgr) parseFunctionPayload(data []byte, fnName string) applicatio
 	depcfg.SourceCollection = common.CheckAndReturnDefaultForScopeOrCollection(string(dcfg.SourceCollection()))
 	depcfg.MetadataCollection = common.CheckAndReturnDefaultForScopeOrCollection(string(dcfg.MetadataCollection()))
 	depcfg.MetadataScope = common.CheckAndReturnDefaultForScopeOrCollection(string(dcfg.MetadataScope()))
+	for i := 0; i < dcfg.SourceCollectionsLength(); i++ {
+		depcfg.SourceCollections = append(depcfg.SourceCollections, string(dcfg.SourceCollections(i)))
+	}
+	for i := 0; i < dcfg.KeyPrefixesLength(); i++ {
+		depcfg.KeyPrefixes = append(depcfg.KeyPrefixes, string(dcfg.KeyPrefixes(i)))
+	}
+	for i := 0; i < dcfg.KeyPatternsLength(); i++ {
+		depcfg.KeyPatterns = append(depcfg.KeyPatterns, string(dcfg.KeyPatterns(i)))
+	}
+	for i := 0; i < dcfg.DependsOnLength(); i++ {
+		depcfg.DependsOn = append(depcfg.DependsOn, string(dcfg.DependsOn(i)))
+	}
 
 	var buckets []bucket
 	b := new(cfg.Bucket)
@@ -1540,6 +1642,7 @@ func (m *ServiceMgr) parseFunctionPayload(data []byte, fnName string) applicatio
 				Access:         string(config.Access(i)),
 				ScopeName:      common.CheckAndReturnDefaultForScopeOrCollection(string(b.ScopeName())),
 				CollectionName: common.CheckAndReturnDefaultForScopeOrCollection(string(b.CollectionName())),
+				Durability:     string(b.Durability()),
 			}
 			buckets = append(buckets, newBucket)
 		}
@@ -1704,6 +1807,7 @@ func (m *ServiceMgr) getTempStore(appName string) (application, *runtimeInfo) {
 				info.Code = m.statusCodes.ok.Code
 				// Hide some internal settings from being exported
 				delete(app.Settings, "handler_uuid")
+				delete(app.Settings, "hot_swap_revision")
 				return app, info
 			}
 		} else if name == appName {
@@ -1970,6 +2074,12 @@ func (m *ServiceMgr) savePrimaryStore(app *application) (info *runtimeInfo) {
 		return
 	}
 
+	if isAppDeployed(app) && !m.checkIfDeployed(app.Name) {
+		if info = m.checkDuplicateDeployment(app); info.Code != m.statusCodes.ok.Code {
+			return
+		}
+	}
+
 	mhVersion := common.CouchbaseVerMap["mad-hatter"]
 	if app.Settings["deployment_status"].(bool) && app.Settings["processing_status"].(bool) && m.superSup.GetAppState(app.Name) == common.AppStatePaused && !m.compareEventingVersion(mhVersion) {
 		info.Code = m.statusCodes.errClusterVersion.Code
@@ -2000,6 +2110,8 @@ func (m *ServiceMgr) savePrimaryStore(app *application) (info *runtimeInfo) {
 		}
 	}
 
+	workerCountWarnings := m.clampWorkerCounts(app.Name, app.Settings)
+
 	logging.Infof("%v Function UUID: %v for function name: %v stored in primary store", logPrefix, app.FunctionID, app.Name)
 
 	preparedApplication, _ := applicationAdapter(app)
@@ -2020,23 +2132,8 @@ func (m *ServiceMgr) savePrimaryStore(app *application) (info *runtimeInfo) {
 		return
 	}
 
-	c := &consumer.Consumer{}
-	var handlerHeaders []string
-	if headers, exists := app.Settings["handler_headers"]; exists {
-		handlerHeaders = util.ToStringArray(headers)
-	} else {
-		handlerHeaders = common.GetDefaultHandlerHeaders()
-	}
-
-	var n1qlParams string
-	if consistency, exists := app.Settings["n1ql_consistency"]; exists {
-		n1qlParams = "{ 'consistency': '" + consistency.(string) + "' }"
-	}
-	parsedCode, _ := parser.TranspileQueries(app.AppHandlers, n1qlParams)
-
-	handlerFooters := util.ToStringArray(app.Settings["handler_footers"])
-	compilationInfo, err := c.SpawnCompilationWorker(parsedCode, string(appContent), app.Name, m.adminHTTPPort,
-		handlerHeaders, handlerFooters)
+	compilationInfo, err := m.compileAppCode(app, appContent)
+	m.recordCompileInfo(app.Name, compilationInfo)
 	if err != nil || !compilationInfo.CompileSuccess {
 		info.Code = m.statusCodes.errHandlerCompile.Code
 		info.Info = compilationInfo
@@ -2086,6 +2183,7 @@ func (m *ServiceMgr) savePrimaryStore(app *application) (info *runtimeInfo) {
 		info.Info = fmt.Sprintf("Function: %s failed to determine warnings, err : %v", app.Name, err)
 		return
 	}
+	wInfo.Warnings = append(wInfo.Warnings, workerCountWarnings...)
 
 	info.Code = m.statusCodes.ok.Code
 	info.Info = *wInfo
@@ -2174,6 +2272,158 @@ func (m *ServiceMgr) getDcpEventsRemaining(w http.ResponseWriter, r *http.Reques
 	fmt.Fprintf(w, "Function: %s not deployed", appName)
 }
 
+// getOwnershipMap returns vbucket to eventing node and worker assignment along with
+// stream status of each vbucket owned by local eventing node
+func (m *ServiceMgr) getOwnershipMap(w http.ResponseWriter, r *http.Request) {
+	if !m.validateAuth(w, r, EventingPermissionManage) {
+		return
+	}
+
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	values := r.URL.Query()
+	if len(values["name"]) == 0 {
+		w.Header().Add(headerKey, strconv.Itoa(m.statusCodes.errInvalidConfig.Code))
+		fmt.Fprintf(w, "Function name not specified")
+		return
+	}
+
+	appName := values["name"][0]
+	ownership := m.superSup.GetOwnershipMap(appName)
+	if !m.checkIfDeployed(appName) || ownership == nil {
+		w.Header().Add(headerKey, strconv.Itoa(m.statusCodes.errAppNotDeployed.Code))
+		fmt.Fprintf(w, "Function: %s not deployed", appName)
+		return
+	}
+
+	data, err := json.MarshalIndent(ownership, "", " ")
+	if err != nil {
+		w.Header().Add(headerKey, strconv.Itoa(m.statusCodes.errMarshalResp.Code))
+		fmt.Fprintf(w, "Failed to marshal ownership map, err: %v", err)
+		return
+	}
+
+	w.Header().Add(headerKey, strconv.Itoa(m.statusCodes.ok.Code))
+	fmt.Fprintf(w, "%v", string(data))
+}
+
+// getRebalanceReports returns reports of recent topology changes for a function,
+// so that cost of rebalances can be trended over time
+func (m *ServiceMgr) getRebalanceReports(w http.ResponseWriter, r *http.Request) {
+	if !m.validateAuth(w, r, EventingPermissionManage) {
+		return
+	}
+
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	values := r.URL.Query()
+	if len(values["name"]) == 0 {
+		w.Header().Add(headerKey, strconv.Itoa(m.statusCodes.errInvalidConfig.Code))
+		fmt.Fprintf(w, "Function name not specified")
+		return
+	}
+
+	appName := values["name"][0]
+	if !m.checkIfDeployed(appName) {
+		w.Header().Add(headerKey, strconv.Itoa(m.statusCodes.errAppNotDeployed.Code))
+		fmt.Fprintf(w, "Function: %s not deployed", appName)
+		return
+	}
+
+	reports, err := m.superSup.GetRebalanceReports(appName)
+	if err != nil {
+		w.Header().Add(headerKey, strconv.Itoa(m.statusCodes.errAppNotDeployed.Code))
+		fmt.Fprintf(w, "Failed to read rebalance reports of function: %s, err: %v", appName, err)
+		return
+	}
+
+	data, err := json.MarshalIndent(reports, "", " ")
+	if err != nil {
+		w.Header().Add(headerKey, strconv.Itoa(m.statusCodes.errMarshalResp.Code))
+		fmt.Fprintf(w, "Failed to marshal rebalance reports, err: %v", err)
+		return
+	}
+
+	w.Header().Add(headerKey, strconv.Itoa(m.statusCodes.ok.Code))
+	fmt.Fprintf(w, "%v", string(data))
+}
+
+// getMetadataCleanupStatus returns progress of clearing up metadata of an undeployed
+// function, for vbuckets assigned to this node
+func (m *ServiceMgr) getMetadataCleanupStatus(w http.ResponseWriter, r *http.Request) {
+	if !m.validateAuth(w, r, EventingPermissionManage) {
+		return
+	}
+
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	values := r.URL.Query()
+	if len(values["name"]) == 0 {
+		w.Header().Add(headerKey, strconv.Itoa(m.statusCodes.errInvalidConfig.Code))
+		fmt.Fprintf(w, "Function name not specified")
+		return
+	}
+
+	appName := values["name"][0]
+	status := m.superSup.GetMetadataCleanupStatus(appName)
+	if status == nil {
+		w.Header().Add(headerKey, strconv.Itoa(m.statusCodes.errAppNotFound.Code))
+		fmt.Fprintf(w, "No metadata cleanup recorded for function: %s", appName)
+		return
+	}
+
+	data, err := json.MarshalIndent(status, "", " ")
+	if err != nil {
+		w.Header().Add(headerKey, strconv.Itoa(m.statusCodes.errMarshalResp.Code))
+		fmt.Fprintf(w, "Failed to marshal metadata cleanup status, err: %v", err)
+		return
+	}
+
+	w.Header().Add(headerKey, strconv.Itoa(m.statusCodes.ok.Code))
+	fmt.Fprintf(w, "%v", string(data))
+}
+
+// getSourceMap returns mapping from lines of script loaded in V8 to lines of handler
+// code, for symbolicating stack traces captured outside of eventing
+func (m *ServiceMgr) getSourceMap(w http.ResponseWriter, r *http.Request) {
+	if !m.validateAuth(w, r, EventingPermissionManage) {
+		return
+	}
+
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	values := r.URL.Query()
+	if len(values["name"]) == 0 {
+		w.Header().Add(headerKey, strconv.Itoa(m.statusCodes.errInvalidConfig.Code))
+		fmt.Fprintf(w, "Function name not specified")
+		return
+	}
+
+	appName := values["name"][0]
+	sourceMap := m.superSup.GetSourceMap(appName)
+	if !m.checkIfDeployed(appName) || sourceMap == nil {
+		w.Header().Add(headerKey, strconv.Itoa(m.statusCodes.errAppNotDeployed.Code))
+		fmt.Fprintf(w, "Function: %s not deployed", appName)
+		return
+	}
+
+	data, _ := json.MarshalIndent(sourceMap, "", " ")
+	w.Header().Add(headerKey, strconv.Itoa(m.statusCodes.ok.Code))
+	fmt.Fprintf(w, "%v", string(data))
+}
+
 func (m *ServiceMgr) getAggPausingApps(w http.ResponseWriter, r *http.Request) {
 	logPrefix := "ServiceMgr::getAggPausingApps"
 
@@ -2261,6 +2511,28 @@ func (m *ServiceMgr) getBootstrappingApps(w http.ResponseWriter, r *http.Request
 	w.Write(data)
 }
 
+func (m *ServiceMgr) getBootstrapAttempts(w http.ResponseWriter, r *http.Request) {
+	if !m.validateAuth(w, r, EventingPermissionManage) {
+		return
+	}
+
+	values := r.URL.Query()
+	if _, ok := values["name"]; !ok {
+		m.sendErrorInfo(w, &runtimeInfo{Code: m.statusCodes.errInvalidConfig.Code, Info: "Function name not supplied"})
+		return
+	}
+	appName := values["name"][0]
+
+	attempts := m.superSup.BootstrapAttempts(appName)
+	data, err := json.MarshalIndent(attempts, "", " ")
+	if err != nil {
+		fmt.Fprintf(w, "Failed to marshal bootstrap attempts, err: %v", err)
+		return
+	}
+
+	w.Write(data)
+}
+
 func (m *ServiceMgr) getEventingConsumerPids(w http.ResponseWriter, r *http.Request) {
 	if !m.validateAuth(w, r, EventingPermissionManage) {
 		return
@@ -2306,7 +2578,12 @@ func (m *ServiceMgr) getCreds(w http.ResponseWriter, r *http.Request) {
 	}
 
 	strippedEndpoint := util.StripScheme(string(data))
-	username, password, err := cbauth.GetMemcachedServiceAuth(strippedEndpoint)
+	getAuth := cbauth.GetMemcachedServiceAuth
+	if m.isQueryEndpoint(strippedEndpoint) {
+		// N1QL is served over http, memcached creds don't apply to it
+		getAuth = cbauth.GetHTTPServiceAuth
+	}
+	username, password, err := getAuth(strippedEndpoint)
 	if err != nil {
 		logging.Errorf("%s Failed to get credentials for endpoint: %rs, err: %v", logPrefix, strippedEndpoint, err)
 		w.Header().Add(headerKey, strconv.Itoa(m.statusCodes.errRbacCreds.Code))
@@ -2320,6 +2597,19 @@ func (m *ServiceMgr) getCreds(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// isQueryEndpoint returns true if endpoint is the query service of a node in the cluster
+func (m *ServiceMgr) isQueryEndpoint(endpoint string) bool {
+	logPrefix := "ServiceMgr::isQueryEndpoint"
+
+	nsServer := net.JoinHostPort(util.Localhost(), m.restPort)
+	queryNodes, err := util.QueryNodesAddresses(m.auth, nsServer)
+	if err != nil {
+		logging.Errorf("%s Failed to get query nodes addresses, err: %v", logPrefix, err)
+		return false
+	}
+	return util.Contains(endpoint, queryNodes)
+}
+
 func (m *ServiceMgr) getKVNodesAddresses(w http.ResponseWriter, r *http.Request) {
 	logPrefix := "ServiceMgr::getKVNodesAddresses"
 	if !m.validateLocalAuth(w, r) {
@@ -2616,6 +2906,7 @@ func (m *ServiceMgr) functionsHandler(w http.ResponseWriter, r *http.Request) {
 	functionsResume := regexp.MustCompile("^/api/v1/functions/(.*[^/])/resume/?$")
 	functionsAppcode := regexp.MustCompile("^/api/v1/functions/(.*[^/])/appcode(/checksum)?/?$")
 	functionsConfig := regexp.MustCompile("^/api/v1/functions/(.*[^/])/config/?$")
+	functionsValidate := regexp.MustCompile("^/api/v1/functions/(.*[^/])/validate/?$")
 
 	if match := functionsNameRetry.FindStringSubmatch(r.URL.Path); len(match) != 0 {
 		appName := match[1]
@@ -2711,10 +3002,11 @@ func (m *ServiceMgr) functionsHandler(w http.ResponseWriter, r *http.Request) {
 				return
 			}
 
-			if info = m.setSettings(appName, data, false); info.Code != m.statusCodes.ok.Code {
+			if info = m.setSettings(appName, data, false, m.getRequestUser(r)); info.Code != m.statusCodes.ok.Code {
 				m.sendErrorInfo(w, info)
 				return
 			}
+			m.sendSettingsWarnings(w, info)
 		default:
 			w.WriteHeader(http.StatusMethodNotAllowed)
 			return
@@ -2799,6 +3091,8 @@ func (m *ServiceMgr) functionsHandler(w http.ResponseWriter, r *http.Request) {
 			w.WriteHeader(http.StatusMethodNotAllowed)
 			return
 		}
+	} else if match := functionsValidate.FindStringSubmatch(r.URL.Path); len(match) != 0 {
+		m.validateAppCode(w, r, match[1])
 	} else if match := functionsConfig.FindStringSubmatch(r.URL.Path); len(match) != 0 {
 		appName := match[1]
 		switch r.Method {
@@ -2926,7 +3220,7 @@ func (m *ServiceMgr) functionsHandler(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		if info = m.setSettings(appName, data, false); info.Code != m.statusCodes.ok.Code {
+		if info = m.setSettings(appName, data, false, m.getRequestUser(r)); info.Code != m.statusCodes.ok.Code {
 			m.sendErrorInfo(w, info)
 			return
 		}
@@ -2974,7 +3268,7 @@ func (m *ServiceMgr) functionsHandler(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		if info = m.setSettings(appName, data, false); info.Code != m.statusCodes.ok.Code {
+		if info = m.setSettings(appName, data, false, m.getRequestUser(r)); info.Code != m.statusCodes.ok.Code {
 			m.sendErrorInfo(w, info)
 			return
 		}
@@ -3063,7 +3357,7 @@ func (m *ServiceMgr) functionsHandler(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		if info = m.setSettings(appName, data, false); info.Code != m.statusCodes.ok.Code {
+		if info = m.setSettings(appName, data, false, m.getRequestUser(r)); info.Code != m.statusCodes.ok.Code {
 			m.sendErrorInfo(w, info)
 			return
 		}
@@ -3103,7 +3397,7 @@ func (m *ServiceMgr) functionsHandler(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		if info = m.setSettings(appName, data, false); info.Code != m.statusCodes.ok.Code {
+		if info = m.setSettings(appName, data, false, m.getRequestUser(r)); info.Code != m.statusCodes.ok.Code {
 			m.sendErrorInfo(w, info)
 			return
 		}
@@ -3402,6 +3696,14 @@ func (m *ServiceMgr) statusHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Diagnostics are fetched only for status of a single function, as those are
+	// read from metakv
+	if status, ok := response.(*singleAppStatusResponse); ok {
+		if diagnostics, err := m.getDiagnostics(appNameFromURI); err == nil {
+			status.App.Diagnostics = diagnostics
+		}
+	}
+
 	data, err := json.MarshalIndent(response, "", " ")
 	if err != nil {
 		info.Code = m.statusCodes.errMarshalResp.Code
@@ -3538,13 +3840,28 @@ func (m *ServiceMgr) statsHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if r.Method == "GET" {
+		if appName := r.URL.Query().Get("appName"); appName != "" {
+			m.functionStatsHandler(w, r, appName)
+			return
+		}
+
 		// Check whether type=full is present in query
 		fullStats := false
 		if typeParam := r.URL.Query().Get("type"); typeParam != "" {
 			fullStats = typeParam == "full"
 		}
 
-		statsList := m.populateStats(fullStats)
+		filter, err := parseStatsFilter(r.URL.Query(), m.superSup.NumVbuckets())
+		if err != nil {
+			info := &runtimeInfo{
+				Code: m.statusCodes.errInvalidConfig.Code,
+				Info: fmt.Sprintf("%v", err),
+			}
+			m.sendErrorInfo(w, info)
+			return
+		}
+
+		statsList := m.populateStats(fullStats, filter)
 
 		response, err := json.MarshalIndent(statsList, "", " ")
 		if err != nil {
@@ -3590,80 +3907,124 @@ func percentileN(latencyStats map[string]uint64, p int) int {
 	return 0
 }
 
-func (m *ServiceMgr) populateStats(fullStats bool) []stats {
+func (m *ServiceMgr) populateStats(fullStats bool, filter *statsFilter) []stats {
 	statsList := make([]stats, 0)
 
 	for _, app := range m.getTempStoreAll() {
 		if m.checkIfDeployed(app.Name) {
 			stats := stats{}
-			feedBoundary, err := m.superSup.DcpFeedBoundary(app.Name)
-			if err == nil {
-				stats.DCPFeedBoundary = feedBoundary
-			}
-			stats.EventProcessingStats = m.superSup.GetEventProcessingStats(app.Name)
-			stats.EventsRemaining = backlogStat{DcpBacklog: m.superSup.GetDcpEventsRemainingToProcess(app.Name)}
-			stats.ExecutionStats = m.superSup.GetExecutionStats(app.Name)
-			stats.FailureStats = m.superSup.GetFailureStats(app.Name)
 			stats.FunctionName = app.Name
-			stats.GocbCredsRequestCounter = util.GocbCredsRequestCounter
 			stats.FunctionID = app.FunctionID
-			stats.InternalVbDistributionStats = m.superSup.InternalVbDistributionStats(app.Name)
-			stats.LcbCredsRequestCounter = m.lcbCredsCounter
-			stats.LcbExceptionStats = m.superSup.GetLcbExceptionsStats(app.Name)
-			stats.MetastoreStats = m.superSup.GetMetaStoreStats(app.Name)
-			stats.WorkerPids = m.superSup.GetEventingConsumerPids(app.Name)
-			stats.PlannerStats = m.superSup.PlannerStats(app.Name)
-			stats.VbDistributionStatsFromMetadata = m.superSup.VbDistributionStatsFromMetadata(app.Name)
-
-			latencyStats := m.superSup.GetLatencyStats(app.Name)
-			ls := make(map[string]int)
-			ls["50"] = percentileN(latencyStats, 50)
-			ls["80"] = percentileN(latencyStats, 80)
-			ls["90"] = percentileN(latencyStats, 90)
-			ls["95"] = percentileN(latencyStats, 95)
-			ls["99"] = percentileN(latencyStats, 99)
-			ls["100"] = percentileN(latencyStats, 100)
-			stats.LatencyPercentileStats = ls
-
-			m.rebalancerMutex.RLock()
-			if m.rebalancer != nil {
-				rebalanceStats := make(map[string]interface{})
-				rebalanceStats["is_leader"] = true
-				rebalanceStats["node_level_stats"] = m.rebalancer.NodeLevelStats
-				rebalanceStats["rebalance_progress"] = m.rebalancer.RebalanceProgress
-				rebalanceStats["rebalance_progress_counter"] = m.rebalancer.RebProgressCounter
-				rebalanceStats["rebalance_start_ts"] = m.rebalancer.RebalanceStartTs
-				rebalanceStats["total_vbs_to_shuffle"] = m.rebalancer.TotalVbsToShuffle
-				rebalanceStats["vbs_remaining_to_shuffle"] = m.rebalancer.VbsRemainingToShuffle
-
-				stats.RebalanceStats = rebalanceStats
+
+			if filter.includes(statsGroupExecution) {
+				stats.EventProcessingStats = m.superSup.GetEventProcessingStats(app.Name)
+				stats.EventsRemaining = backlogStat{DcpBacklog: m.superSup.GetDcpEventsRemainingToProcess(app.Name)}
+				stats.ExecutionStats = m.superSup.GetExecutionStats(app.Name)
+			}
+
+			if filter.includes(statsGroupFailure) {
+				stats.FailureStats = m.superSup.GetFailureStats(app.Name)
+				stats.FailureDomains = m.superSup.GetFailureDomains(app.Name)
+				stats.LcbExceptionStats = m.superSup.GetLcbExceptionsStats(app.Name)
+			}
+
+			if filter.includes(statsGroupMisc) {
+				feedBoundary, err := m.superSup.DcpFeedBoundary(app.Name)
+				if err == nil {
+					stats.DCPFeedBoundary = feedBoundary
+				}
+				stats.DcpFeedEvents = m.superSup.GetDcpFeedEvents(app.Name)
+				stats.FencingStatus = m.superSup.GetFencingStatus(app.Name)
+				stats.GocbCredsRequestCounter = util.GocbCredsRequestCounter
+				stats.LcbCredsRequestCounter = m.lcbCredsCounter
+				stats.WorkerPids = m.superSup.GetEventingConsumerPids(app.Name)
+				if restarts := m.superSup.GetWorkerRestarts(app.Name); len(restarts) > 0 {
+					stats.WorkerRestarts = restarts
+				}
+			}
+
+			if filter.includes(statsGroupTimers) {
+				stats.MetastoreStats = m.superSup.GetMetaStoreStats(app.Name)
+			}
+
+			if filter.includes(statsGroupVb) {
+				stats.InternalVbDistributionStats = m.superSup.InternalVbDistributionStats(app.Name)
+				stats.PlannerStats = m.superSup.PlannerStats(app.Name)
+				stats.VbDistributionStatsFromMetadata = m.superSup.VbDistributionStatsFromMetadata(app.Name)
+
+				m.rebalancerMutex.RLock()
+				if m.rebalancer != nil {
+					rebalanceStats := make(map[string]interface{})
+					rebalanceStats["is_leader"] = true
+					rebalanceStats["node_level_stats"] = m.rebalancer.NodeLevelStats
+					rebalanceStats["rebalance_progress"] = m.rebalancer.RebalanceProgress
+					rebalanceStats["rebalance_progress_counter"] = m.rebalancer.RebProgressCounter
+					rebalanceStats["rebalance_start_ts"] = m.rebalancer.RebalanceStartTs
+					rebalanceStats["total_vbs_to_shuffle"] = m.rebalancer.TotalVbsToShuffle
+					rebalanceStats["vbs_remaining_to_shuffle"] = m.rebalancer.VbsRemainingToShuffle
+
+					stats.RebalanceStats = rebalanceStats
+				}
+				m.rebalancerMutex.RUnlock()
+			}
+
+			if filter.includes(statsGroupLatency) {
+				latencyStats := m.superSup.GetLatencyStats(app.Name)
+				ls := make(map[string]int)
+				ls["50"] = percentileN(latencyStats, 50)
+				ls["80"] = percentileN(latencyStats, 80)
+				ls["90"] = percentileN(latencyStats, 90)
+				ls["95"] = percentileN(latencyStats, 95)
+				ls["99"] = percentileN(latencyStats, 99)
+				ls["100"] = percentileN(latencyStats, 100)
+				stats.LatencyPercentileStats = ls
+
+				if fullStats {
+					stats.LatencyStats = latencyStats
+					stats.CurlLatencyStats = m.superSup.GetCurlLatencyStats(app.Name)
+				}
 			}
-			m.rebalancerMutex.RUnlock()
 
-			if fullStats {
+			if fullStats && filter.includes(statsGroupVb) {
 				checkpointBlobDump, err := m.superSup.CheckpointBlobDump(app.Name)
 				if err == nil {
 					stats.CheckpointBlobDump = checkpointBlobDump
 				}
 
-				stats.LatencyStats = m.superSup.GetLatencyStats(app.Name)
-				stats.CurlLatencyStats = m.superSup.GetCurlLatencyStats(app.Name)
-				stats.SeqsProcessed = m.superSup.GetSeqsProcessed(app.Name)
-
 				spanBlobDump, err := m.superSup.SpanBlobDump(app.Name)
 				if err == nil {
 					stats.SpanBlobDump = spanBlobDump
 				}
 
+				seqsProcessed := m.superSup.GetSeqsProcessed(app.Name)
+				stats.SeqsProcessed = seqsProcessed
 				stats.VbDcpEventsRemaining = m.superSup.VbDcpEventsRemainingToProcess(app.Name)
-				debugStats, err := m.superSup.TimerDebugStats(app.Name)
-				if err == nil {
-					stats.DocTimerDebugStats = debugStats
-				}
+
 				vbSeqnoStats, err := m.superSup.VbSeqnoStats(app.Name)
 				if err == nil {
 					stats.VbSeqnoStats = vbSeqnoStats
 				}
+
+				if filter.paginated() {
+					selected, page := filter.selectVbs(vbsFromStats(seqsProcessed))
+					stats.CheckpointBlobDump = filterBlobDump(stats.CheckpointBlobDump, selected)
+					stats.SpanBlobDump = filterBlobDump(stats.SpanBlobDump, selected)
+					stats.SeqsProcessed = filterVbMap(stats.SeqsProcessed, selected)
+					stats.VbDcpEventsRemaining = filterVbMap(stats.VbDcpEventsRemaining, selected)
+					stats.VbSeqnoStats = filterVbMap(stats.VbSeqnoStats, selected)
+					stats.VbPagination = page
+				}
+			}
+
+			if fullStats && filter.includes(statsGroupTimers) {
+				debugStats, err := m.superSup.TimerDebugStats(app.Name)
+				if err == nil {
+					stats.DocTimerDebugStats = debugStats
+					if filter.paginated() {
+						selected, _ := filter.selectVbs(vbsFromStats(m.superSup.GetSeqsProcessed(app.Name)))
+						stats.DocTimerDebugStats = filterVbMap(debugStats, selected)
+					}
+				}
 			}
 
 			statsList = append(statsList, stats)
@@ -3710,7 +4071,7 @@ func (m *ServiceMgr) exportHandler(w http.ResponseWriter, r *http.Request) {
 
 	exportedFns := make([]string, 0)
 	apps := m.getTempStoreAll()
-	for _, app := range apps {
+	for idx, app := range apps {
 		for i := range app.DeploymentConfig.Curl {
 			app.DeploymentConfig.Curl[i].Username = ""
 			app.DeploymentConfig.Curl[i].Password = ""
@@ -3719,6 +4080,9 @@ func (m *ServiceMgr) exportHandler(w http.ResponseWriter, r *http.Request) {
 		app.Settings["deployment_status"] = false
 		app.Settings["processing_status"] = false
 		m.maybeDeleteLifeCycleState(&app)
+		if diagnostics, err := m.getDiagnostics(app.Name); err == nil {
+			apps[idx].Diagnostics = diagnostics
+		}
 		exportedFns = append(exportedFns, app.Name)
 	}
 
@@ -3981,6 +4345,9 @@ func (m *ServiceMgr) createApplications(r *http.Request, appList *[]application,
 	for _, app := range *appList {
 		audit.Log(auditevent.CreateFunction, r, app.Name)
 
+		// Diagnostics are part of export format only, they're never stored along with function definition
+		app.Diagnostics = nil
+
 		if isImport {
 			app.Settings["deployment_status"] = false
 			app.Settings["processing_status"] = false
@@ -4339,6 +4706,11 @@ func (m *ServiceMgr) prometheusLow(w http.ResponseWriter, r *http.Request) {
 	out := make([]byte, 0)
 	out = append(out, []byte(fmt.Sprintf("%vworker_restart_count %v\n", METRICS_PREFIX, m.superSup.WorkerRespawnedCount()))...)
 
+	nodeNetworkStats := m.nodeNetworkStats()
+	for _, name := range networkStatNames {
+		out = append(out, []byte(fmt.Sprintf("%vnode_%v %v\n", METRICS_PREFIX, name, nodeNetworkStats[name]))...)
+	}
+
 	w.WriteHeader(200)
 	w.Write([]byte(out))
 }
@@ -4370,10 +4742,31 @@ func (m *ServiceMgr) highCardStats() []byte {
 		if processingStats != nil {
 			stats = populateUint(fmtStr, appName, "dcp_mutation_sent_to_worker", stats, processingStats)
 			stats = populateUint(fmtStr, appName, "dcp_mutation_suppressed_counter", stats, processingStats)
+			stats = populateUint(fmtStr, appName, "dcp_mutation_origin_suppressed_counter", stats, processingStats)
+			stats = populateUint(fmtStr, appName, "dcp_mutation_binary_skipped_counter", stats, processingStats)
+			stats = populateUint(fmtStr, appName, "frame_checksum_failures", stats, processingStats)
+			stats = populateUint(fmtStr, appName, "dcp_key_filtered_counter", stats, processingStats)
 			stats = populateUint(fmtStr, appName, "dcp_deletion_sent_to_worker", stats, processingStats)
 			stats = populateUint(fmtStr, appName, "dcp_expiry_sent_to_worker", stats, processingStats)
 			stats = populateUint(fmtStr, appName, "dcp_deletion_suppressed_counter", stats, processingStats)
 			stats = populateUint(fmtStr, appName, "worker_spawn_counter", stats, processingStats)
+			stats = populateUint(fmtStr, appName, "worker_rss_bytes", stats, processingStats)
+			stats = populateUint(fmtStr, appName, "worker_rss_limit_breached", stats, processingStats)
+			stats = populateUint(fmtStr, appName, "worker_cpu_limit_breached", stats, processingStats)
+			stats = populateUint(fmtStr, appName, "worker_consecutive_restarts", stats, processingStats)
+			stats = populateUint(fmtStr, appName, "worker_restart_backoff_ms", stats, processingStats)
+			stats = populateUint(fmtStr, appName, "stale_consumers", stats, processingStats)
+			stats = populateUint(fmtStr, appName, "dcp_quota_throttle_ms", stats, processingStats)
+			stats = populateUint(fmtStr, appName, "timer_store_corruptions", stats, processingStats)
+			stats = populateUint(fmtStr, appName, "injected_metadata_delays", stats, processingStats)
+			stats = populateUint(fmtStr, appName, "injected_metadata_delay_ms", stats, processingStats)
+			stats = populateUint(fmtStr, appName, "checkpoints_written", stats, processingStats)
+			stats = populateUint(fmtStr, appName, "checkpoints_skipped", stats, processingStats)
+			stats = populateUint(fmtStr, appName, "vb_stat_updates_saved", stats, processingStats)
+			stats = populateUint(fmtStr, appName, "dcp_snapshot_markers_deduped", stats, processingStats)
+			for _, name := range networkStatNames {
+				stats = populateUint(fmtStr, appName, name, stats, processingStats)
+			}
 		}
 
 		executionStats := m.superSup.GetExecutionStats(appName)
@@ -4391,6 +4784,21 @@ func (m *ServiceMgr) highCardStats() []byte {
 			stats = populate(fmtStr, appName, "timer_create_failure", stats, executionStats)
 			stats = populate(fmtStr, appName, "timer_callback_success", stats, executionStats)
 			stats = populate(fmtStr, appName, "timer_callback_failure", stats, executionStats)
+			stats = populate(fmtStr, appName, "on_event_success", stats, executionStats)
+			stats = populate(fmtStr, appName, "on_event_failure", stats, executionStats)
+			stats = populate(fmtStr, appName, "bus_event_emitted", stats, executionStats)
+
+			n1qlStats := make(map[string]interface{})
+			if n1ql, ok := executionStats["n1ql"].(map[string]interface{}); ok {
+				for _, name := range []string{"query_count", "query_success"} {
+					if val, ok := n1ql[name]; ok {
+						n1qlStats["n1ql_"+name] = val
+					}
+				}
+			}
+			stats = populate(fmtStr, appName, "n1ql_query_count", stats, n1qlStats)
+			stats = populate(fmtStr, appName, "n1ql_query_success", stats, n1qlStats)
+
 			// The following metric tracks the total number of times a Timer callback is invoked.
 			// => timer_msg_counter = timer_callback_missing_counter + timer_callback_success + timer_callback_failure.
 			stats = populate(fmtStr, appName, "timer_msg_counter", stats, executionStats)
@@ -4408,6 +4816,19 @@ func (m *ServiceMgr) highCardStats() []byte {
 			stats = populate(fmtStr, appName, "checkpoint_failure_count", stats, failureStats)
 		}
 
+		domainFailures := make(map[string]uint64)
+		for domain, failures := range m.superSup.GetFailureDomains(appName) {
+			domainFailures[domain+"_failures"] = failures.Count
+		}
+		for _, domain := range failureDomains {
+			stats = populateUint(fmtStr, appName, domain+"_failures", stats, domainFailures)
+		}
+
+		histograms := m.superSup.GetRebalanceHistograms(appName)
+		for _, metric := range rebalanceHistogramMetrics {
+			stats = populateHistogram(appName, metric.name, stats, histograms[metric.phase])
+		}
+
 	}
 	return stats
 }
@@ -0,0 +1,64 @@
+package servicemanager
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+)
+
+// getWorkerIncidents serves /getWorkerIncidents?name=X, listing incident records captured
+// on this node when cpp workers of the function got respawned. Passing id=Y returns the
+// record itself
+func (m *ServiceMgr) getWorkerIncidents(w http.ResponseWriter, r *http.Request) {
+	if !m.validateAuth(w, r, EventingPermissionManage) {
+		return
+	}
+
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	values := r.URL.Query()
+	appName := values.Get("name")
+	if appName == "" {
+		w.Header().Add(headerKey, strconv.Itoa(m.statusCodes.errInvalidConfig.Code))
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Function name not specified")
+		return
+	}
+
+	var response interface{}
+	var err error
+	if id := values.Get("id"); id != "" {
+		response, err = m.superSup.GetWorkerIncident(appName, id)
+	} else {
+		response, err = m.superSup.GetWorkerIncidents(appName)
+	}
+
+	if os.IsNotExist(err) {
+		w.Header().Add(headerKey, strconv.Itoa(m.statusCodes.errInvalidConfig.Code))
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprintf(w, "Incident record not found for function: %s", appName)
+		return
+	}
+	if err != nil {
+		w.Header().Add(headerKey, strconv.Itoa(m.statusCodes.errInvalidConfig.Code))
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Failed to read incident records of function: %s, err: %v", appName, err)
+		return
+	}
+
+	data, err := json.MarshalIndent(response, "", " ")
+	if err != nil {
+		w.Header().Add(headerKey, strconv.Itoa(m.statusCodes.errMarshalResp.Code))
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "Failed to marshal incident records, err: %v", err)
+		return
+	}
+
+	w.Header().Add(headerKey, strconv.Itoa(m.statusCodes.ok.Code))
+	fmt.Fprintf(w, "%v", string(data))
+}
@@ -0,0 +1,49 @@
+package servicemanager
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/couchbase/eventing/common"
+)
+
+// getLiveness serves /liveness, reporting whether consumers of functions running on this
+// node have kept up their heartbeats. Passing name=X limits it to the function
+func (m *ServiceMgr) getLiveness(w http.ResponseWriter, r *http.Request) {
+	if !m.validateAuth(w, r, EventingPermissionManage) {
+		return
+	}
+
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	response := make(map[string][]*common.ConsumerLiveness)
+	if appName := r.URL.Query().Get("name"); appName != "" {
+		if _, ok := m.superSup.GetDeployedApps()[appName]; !ok {
+			w.Header().Add(headerKey, strconv.Itoa(m.statusCodes.errAppNotDeployed.Code))
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprintf(w, "Function: %s not deployed on this node", appName)
+			return
+		}
+		response[appName] = m.superSup.GetLiveness(appName)
+	} else {
+		for appName := range m.superSup.GetDeployedApps() {
+			response[appName] = m.superSup.GetLiveness(appName)
+		}
+	}
+
+	data, err := json.MarshalIndent(response, "", " ")
+	if err != nil {
+		w.Header().Add(headerKey, strconv.Itoa(m.statusCodes.errMarshalResp.Code))
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "Failed to marshal liveness, err: %v", err)
+		return
+	}
+
+	w.Header().Add(headerKey, strconv.Itoa(m.statusCodes.ok.Code))
+	fmt.Fprintf(w, "%v", string(data))
+}
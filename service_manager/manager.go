@@ -46,6 +46,12 @@ func NewServiceMgr(config util.Config, rebalanceRunning bool, superSup common.Ev
 		consistencyValues:       []string{"none", "request"},
 		clusterEncryptionConfig: nil,
 		configMutex:             &sync.RWMutex{},
+		diagnosticsMutex:        &sync.Mutex{},
+		deploymentHistoryMutex:  &sync.Mutex{},
+		recommendationMutex:     &sync.RWMutex{},
+		backlogSamples:          make(map[string][]*backlogSample),
+		recommendations:         make(map[string][]recommendation),
+		statusSummary:           newStatusSummaryCache(),
 		httpServerSignal:        make(chan bool),
 		httpServerMutex:         &sync.Mutex{},
 		graph:                   newBucketMultiDiGraph(),
@@ -111,6 +117,10 @@ func (m *ServiceMgr) initService() {
 
 	m.disableDebugger()
 
+	go m.analyzeBacklog()
+	go m.gossipPeerHealth()
+	go m.refreshStatusSummary()
+
 	mux := http.NewServeMux()
 
 	//pprof REST APIs
@@ -127,6 +137,7 @@ func (m *ServiceMgr) initService() {
 	mux.HandleFunc("/cleanupEventing", m.cleanupEventing)
 	mux.HandleFunc("/clearEventStats", m.clearEventStats)
 	mux.HandleFunc("/die", m.die)
+	mux.HandleFunc("/drainNode", m.drainNodeHandler)
 	mux.HandleFunc("/deleteApplication/", m.deletePrimaryStoreHandler)
 	mux.HandleFunc("/deleteAppTempStore/", m.deleteTempStoreHandler)
 	mux.HandleFunc("/freeOSMemory", m.freeOSMemory)
@@ -142,27 +153,56 @@ func (m *ServiceMgr) initService() {
 	mux.HandleFunc("/getBootstrappingApps", m.getBootstrappingApps)
 	mux.HandleFunc("/getBootstrapStatus", m.getBootstrapStatus)
 	mux.HandleFunc("/getBootstrapAppStatus", m.getBootstrapAppStatus)
+	mux.HandleFunc("/getBootstrapAttempts", m.getBootstrapAttempts)
 	mux.HandleFunc("/getPausingApps", m.getPausingApps)
 	mux.HandleFunc("/getConsumerPids", m.getEventingConsumerPids)
 	mux.HandleFunc("/getCpuCount", m.getCPUCount)
 	mux.HandleFunc("/getCreds", m.getCreds)
 	mux.HandleFunc("/getDcpEventsRemaining", m.getDcpEventsRemaining)
 	mux.HandleFunc("/getDebuggerUrl/", m.getDebuggerURL)
+	mux.HandleFunc("/getDebuggerSessions", m.getDebuggerSessions)
 	mux.HandleFunc("/getDeployedApps", m.getDeployedApps)
 	mux.HandleFunc("/getErrorCodes", m.getErrCodes)
 	mux.HandleFunc("/getEventProcessingStats", m.getEventProcessingStats)
 	mux.HandleFunc("/getExecutionStats", m.getExecutionStats)
 	mux.HandleFunc("/getFailureStats", m.getFailureStats)
 	mux.HandleFunc("/getLatencyStats", m.getLatencyStats)
+	mux.HandleFunc("/getOpStats", m.getOpStats)
 	mux.HandleFunc("/getLocallyDeployedApps", m.getLocallyDeployedApps)
 	mux.HandleFunc("/getAppLog", m.getAppLog)
 	mux.HandleFunc("/getRebalanceProgress", m.getRebalanceProgress)
 	mux.HandleFunc("/getRebalanceStatus", m.getRebalanceStatus)
+	mux.HandleFunc("/getRecommendations", m.getRecommendations)
 	mux.HandleFunc("/getRunningApps", m.getRunningApps)
 	mux.HandleFunc("/getSeqsProcessed", m.getSeqsProcessed)
 	mux.HandleFunc("/getLocalDebugUrl/", m.getLocalDebugURL)
 	mux.HandleFunc("/getWorkerCount", m.getWorkerCount)
 	mux.HandleFunc("/getInsight", m.getInsight)
+	mux.HandleFunc("/getOwnershipMap", m.getOwnershipMap)
+	mux.HandleFunc("/getPeerHealth", m.getPeerHealth)
+	mux.HandleFunc("/getRebalanceReports", m.getRebalanceReports)
+	mux.HandleFunc("/getWorkerIncidents", m.getWorkerIncidents)
+	mux.HandleFunc("/getAppLogUsage", m.getAppLogUsage)
+	mux.HandleFunc("/getEventBusStats", m.getEventBusStats)
+	mux.HandleFunc("/liveness", m.getLiveness)
+	mux.HandleFunc("/getDeploymentHistory", m.getDeploymentHistoryHandler)
+	mux.HandleFunc("/diffDeploymentVersions", m.diffDeploymentVersions)
+	mux.HandleFunc("/redeployVersion", m.redeployVersion)
+	mux.HandleFunc("/getMetadataCleanupStatus", m.getMetadataCleanupStatus)
+	mux.HandleFunc("/getDuplicateFunctions", m.getDuplicateFunctions)
+	mux.HandleFunc("/getLocalFunctionStats", m.getLocalFunctionStats)
+	mux.HandleFunc("/gossipHealth", m.gossipHealth)
+	mux.HandleFunc("/cancelTimer", m.cancelTimer)
+	mux.HandleFunc("/verifyTimerStore", m.verifyTimerStore)
+	mux.HandleFunc("/hotSwapAppCode", m.hotSwapAppCode)
+	mux.HandleFunc("/pauseVbuckets", m.pauseVbuckets)
+	mux.HandleFunc("/resumeVbuckets", m.resumeVbuckets)
+	mux.HandleFunc("/getPausedVbuckets", m.getPausedVbuckets)
+	mux.HandleFunc("/updateLocalPausedVbuckets", m.updateLocalPausedVbuckets)
+	mux.HandleFunc("/getLocalPausedVbuckets", m.getLocalPausedVbuckets)
+	mux.HandleFunc("/getAppRebalanceProgress", m.getAppRebalanceProgress)
+	mux.HandleFunc("/getLocalAppRebalanceProgress", m.getLocalAppRebalanceProgress)
+	mux.HandleFunc("/getSourceMap", m.getSourceMap)
 	mux.HandleFunc("/logFileLocation", m.logFileLocation)
 	mux.HandleFunc("/saveAppTempStore/", m.saveTempStoreHandler)
 	mux.HandleFunc("/setApplication/", m.savePrimaryStoreHandler)
@@ -172,6 +212,7 @@ func (m *ServiceMgr) initService() {
 	mux.HandleFunc("/triggerGC", m.triggerGC)
 	mux.HandleFunc("/stopDebugger/", m.stopDebugger)
 	mux.HandleFunc("/stopTracing", m.stopTracing)
+	mux.HandleFunc("/terminateDebuggerSession", m.terminateDebuggerSession)
 	mux.HandleFunc("/uuid", m.getNodeUUID)
 	mux.HandleFunc("/version", m.getNodeVersion)
 	mux.HandleFunc("/writeDebuggerURL/", m.writeDebuggerURLHandler)
@@ -194,9 +235,11 @@ func (m *ServiceMgr) initService() {
 
 	mux.HandleFunc("/api/v1/list/functions", m.listFunctions)
 	mux.HandleFunc("/api/v1/list/functions/", m.listFunctions)
+	mux.HandleFunc("/api/v1/preupgrade_check", m.preUpgradeCheckHandler)
 
 	mux.HandleFunc("/_prometheusMetrics", m.prometheusLow)
 	mux.HandleFunc("/_prometheusMetricsHigh", m.prometheusHigh)
+	mux.HandleFunc("/_statusSummary", m.getStatusSummary)
 
 	var kpr *keypairReloader
 	var err error
@@ -0,0 +1,28 @@
+package servicemanager
+
+// Bytes transferred at I/O boundaries of functions, as accounted by consumers
+var networkStatNames = []string{
+	"network_dcp_in_bytes",
+	"network_worker_out_bytes",
+	"network_worker_in_bytes",
+	"network_metadata_in_bytes",
+	"network_metadata_out_bytes",
+	"network_metadata_subdoc_ops",
+	"network_dead_letter_out_bytes",
+}
+
+// nodeNetworkStats rolls up network usage of all functions deployed on this node
+func (m *ServiceMgr) nodeNetworkStats() map[string]uint64 {
+	nodeStats := make(map[string]uint64, len(networkStatNames))
+	for _, name := range networkStatNames {
+		nodeStats[name] = 0
+	}
+
+	for appName := range m.superSup.GetDeployedApps() {
+		processingStats := m.superSup.GetEventProcessingStats(appName)
+		for _, name := range networkStatNames {
+			nodeStats[name] += processingStats[name]
+		}
+	}
+	return nodeStats
+}
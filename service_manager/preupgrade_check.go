@@ -0,0 +1,240 @@
+package servicemanager
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/couchbase/cbauth"
+	"github.com/couchbase/eventing/common"
+	"github.com/couchbase/eventing/logging"
+	"github.com/couchbase/eventing/parser"
+	"github.com/couchbase/eventing/util"
+)
+
+// Categories of findings in pre-upgrade check
+const (
+	upgradeDeprecatedSetting = "deprecated_setting"
+	upgradeProtocolFeature   = "protocol_feature"
+	upgradeTimerStore        = "timer_store"
+	upgradeHandlerConstruct  = "handler_construct"
+)
+
+// Severity of findings. Blockers stop the function from deploying or running
+// as is post upgrade, warnings flag a change in behaviour
+const (
+	upgradeBlocker = "blocker"
+	upgradeWarning = "warning"
+)
+
+type upgradeFinding struct {
+	Category string `json:"category"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+type functionReadiness struct {
+	Name     string            `json:"name"`
+	Ready    bool              `json:"ready"`
+	Findings []*upgradeFinding `json:"findings"`
+}
+
+type preUpgradeReport struct {
+	Timestamp string               `json:"timestamp"`
+	Ready     bool                 `json:"ready"`
+	Functions []*functionReadiness `json:"functions"`
+}
+
+func (f *functionReadiness) add(category, severity, format string, args ...interface{}) {
+	f.Findings = append(f.Findings, &upgradeFinding{
+		Category: category,
+		Severity: severity,
+		Message:  fmt.Sprintf(format, args...),
+	})
+	if severity == upgradeBlocker {
+		f.Ready = false
+	}
+}
+
+// checkDeprecatedSettings flags settings eventing no longer acts upon or doesn't
+// understand, as upgraded nodes with strict settings validation reject the latter
+func checkDeprecatedSettings(app *application, readiness *functionReadiness) {
+	names := make([]string, 0)
+	for name := range app.Settings {
+		if util.Contains(name, common.DeprecatedSettings) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		readiness.add(upgradeDeprecatedSetting, upgradeWarning, "%s is deprecated and ignored, it can be removed", name)
+	}
+
+	for _, err := range common.UnknownSettings(app.Settings) {
+		readiness.add(upgradeDeprecatedSetting, upgradeWarning, "%s: %s", err.Setting, err.Reason)
+	}
+}
+
+// checkProtocolFeatures flags settings that rely on features of the eventing-consumer
+// protocol, which nodes yet to be upgraded in a mixed version cluster don't honour
+func checkProtocolFeatures(app *application, readiness *functionReadiness) {
+	if val, ok := app.Settings["delivery_guarantee"].(string); ok && val == common.DeliveryAtLeastOnce {
+		readiness.add(upgradeProtocolFeature, upgradeWarning,
+			"delivery_guarantee %s relies on handler acks, nodes on older versions checkpoint as %s",
+			common.DeliveryAtLeastOnce, common.DeliveryBestEffort)
+	}
+
+	if val, ok := app.Settings["dead_letter_bucket"].(string); ok && val != "" {
+		readiness.add(upgradeProtocolFeature, upgradeWarning,
+			"dead_letter_bucket relies on dead letter responses from eventing-consumer, nodes on older versions drop failed mutations")
+	}
+
+	if val, ok := app.Settings["retry_count"].(float64); ok && val > 0 {
+		readiness.add(upgradeProtocolFeature, upgradeWarning,
+			"retry_count relies on handler retry policy of eventing-consumer, nodes on older versions don't retry failed mutations")
+	}
+
+	if topics, ok := app.Settings["subscribe_topics"].([]interface{}); ok && len(topics) != 0 {
+		readiness.add(upgradeProtocolFeature, upgradeWarning,
+			"subscribe_topics relies on bus events of eventing-consumer, nodes on older versions don't pass them on to OnEvent")
+	}
+
+	if val, ok := app.Settings["n1ql_timeout"].(float64); ok && val > 0 {
+		readiness.add(upgradeProtocolFeature, upgradeWarning,
+			"n1ql_timeout is passed on to eventing-consumer at bootstrap, nodes on older versions derive query timeout from execution_timeout")
+	}
+
+	for _, name := range []string{"timer_lane_batch_size", "dcp_lane_batch_size"} {
+		if val, ok := app.Settings[name].(float64); ok && val != 100 {
+			readiness.add(upgradeProtocolFeature, upgradeWarning,
+				"%s relies on dispatch lanes of eventing-consumer, nodes on older versions run timer scans to completion", name)
+		}
+	}
+}
+
+// checkTimerStore flags functions using timers whose timer store layout could change
+// across the upgrade. Layout is derived from num_timer_partitions, which is rounded up
+// to a power of 2 and defaults to a value based on number of cores of the node
+func checkTimerStore(app *application, readiness *functionReadiness) {
+	if !parser.UsingTimer(app.AppHandlers) {
+		return
+	}
+
+	for _, name := range []string{"timer_processing_tick_interval", "timer_worker_pool_size", "skip_timer_threshold"} {
+		if _, ok := app.Settings[name]; ok {
+			readiness.add(upgradeTimerStore, upgradeWarning,
+				"%s suggests timers created prior to timer store, such timers aren't fired post upgrade", name)
+			break
+		}
+	}
+
+	val, ok := app.Settings["num_timer_partitions"].(float64)
+	if !ok {
+		readiness.add(upgradeTimerStore, upgradeWarning,
+			"num_timer_partitions isn't set, its default depends on cores of the node and could change timer partitioning on upgraded nodes")
+		return
+	}
+
+	if rounded := util.RoundUpToNearestPowerOf2(val); rounded != int(val) {
+		readiness.add(upgradeTimerStore, upgradeWarning,
+			"num_timer_partitions %d isn't a power of 2, timers are partitioned %d ways", int(val), rounded)
+	}
+}
+
+// checkHandlerConstructs flags handler code that doesn't deploy or behaves differently
+// post upgrade
+func checkHandlerConstructs(app *application, readiness *functionReadiness) {
+	for _, fn := range parser.ListDeprecatedFunctions(app.AppHandlers) {
+		readiness.add(upgradeHandlerConstruct, upgradeBlocker, "%s is deprecated, use N1QL() instead", fn)
+	}
+
+	for _, fn := range parser.ListOverloadedFunctions(app.AppHandlers) {
+		readiness.add(upgradeHandlerConstruct, upgradeWarning, "%s overrides a builtin, which could have changed in upgraded version", fn)
+	}
+
+	latest := common.LanguageCompatibility[0]
+	if val, ok := app.Settings["language_compatibility"].(string); ok && val != latest {
+		readiness.add(upgradeHandlerConstruct, upgradeWarning,
+			"language_compatibility %s retains handler semantics of that version, latest is %s", val, latest)
+	}
+}
+
+func (m *ServiceMgr) preUpgradeCheck(includeUndeployed bool) *preUpgradeReport {
+	report := &preUpgradeReport{
+		Timestamp: time.Now().Format(time.RFC3339),
+		Ready:     true,
+		Functions: make([]*functionReadiness, 0),
+	}
+
+	for _, app := range m.getTempStoreAll() {
+		if deployed, _ := app.Settings["deployment_status"].(bool); !deployed && !includeUndeployed {
+			continue
+		}
+
+		readiness := &functionReadiness{
+			Name:     app.Name,
+			Ready:    true,
+			Findings: make([]*upgradeFinding, 0),
+		}
+
+		checkDeprecatedSettings(&app, readiness)
+		checkProtocolFeatures(&app, readiness)
+		checkTimerStore(&app, readiness)
+		checkHandlerConstructs(&app, readiness)
+
+		report.Ready = report.Ready && readiness.Ready
+		report.Functions = append(report.Functions, readiness)
+	}
+
+	sort.Slice(report.Functions, func(i, j int) bool {
+		return report.Functions[i].Name < report.Functions[j].Name
+	})
+	return report
+}
+
+// preUpgradeCheckHandler serves /api/v1/preupgrade_check with per function readiness
+// for upgrading to next release. Only deployed functions are inspected unless all=true
+func (m *ServiceMgr) preUpgradeCheckHandler(w http.ResponseWriter, r *http.Request) {
+	logPrefix := "ServiceMgr::preUpgradeCheckHandler"
+
+	w.Header().Set("Content-Type", "application/json")
+	if !m.validateAuth(w, r, EventingPermissionManage) {
+		cbauth.SendForbidden(w, EventingPermissionManage)
+		return
+	}
+
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	includeUndeployed, _ := strconv.ParseBool(r.URL.Query().Get("all"))
+	report := m.preUpgradeCheck(includeUndeployed)
+
+	notReady := make([]string, 0)
+	for _, fn := range report.Functions {
+		if !fn.Ready {
+			notReady = append(notReady, fn.Name)
+		}
+	}
+	logging.Infof("%s Inspected %d functions, not ready: %s", logPrefix, len(report.Functions), strings.Join(notReady, ", "))
+
+	response, err := json.MarshalIndent(report, "", " ")
+	if err != nil {
+		info := &runtimeInfo{
+			Code: m.statusCodes.errMarshalResp.Code,
+			Info: fmt.Sprintf("failed to marshal pre-upgrade report, err : %v", err),
+		}
+		logging.Errorf("%s %s", logPrefix, info.Info)
+		m.sendErrorInfo(w, info)
+		return
+	}
+
+	w.Header().Add(headerKey, strconv.Itoa(m.statusCodes.ok.Code))
+	fmt.Fprintf(w, "%s", string(response))
+}
@@ -0,0 +1,164 @@
+package servicemanager
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/couchbase/eventing/common"
+	"github.com/couchbase/eventing/logging"
+	"github.com/couchbase/eventing/util"
+)
+
+// clusterRebalanceProgress captures rebalance progress of functions across eventing nodes.
+// Functions holds per function totals, with estimated completion of the slowest node
+type clusterRebalanceProgress struct {
+	Functions  map[string]*common.AppRebalanceProgress            `json:"functions"`
+	Nodes      map[string]map[string]*common.AppRebalanceProgress `json:"nodes"`
+	NodeErrors map[string]string                                  `json:"node_errors,omitempty"`
+}
+
+func (m *ServiceMgr) localRebalanceProgress(appName string) map[string]*common.AppRebalanceProgress {
+	appNames := []string{appName}
+	if appName == "" {
+		appNames = appNames[:0]
+		for app := range m.superSup.GetLocallyDeployedApps() {
+			appNames = append(appNames, app)
+		}
+	}
+
+	progress := make(map[string]*common.AppRebalanceProgress)
+	for _, app := range appNames {
+		if appProgress := m.superSup.GetRebalanceProgress(app); appProgress != nil {
+			progress[app] = appProgress
+		}
+	}
+	return progress
+}
+
+func mergeRebalanceProgress(total, node *common.AppRebalanceProgress) {
+	total.RebalanceOngoing = total.RebalanceOngoing || node.RebalanceOngoing
+	total.VbsToMove += node.VbsToMove
+	total.VbsRemainingToOwn += node.VbsRemainingToOwn
+	total.VbsRemainingToGiveUp += node.VbsRemainingToGiveUp
+
+	if node.StartTime != "" && (total.StartTime == "" || node.StartTime < total.StartTime) {
+		total.StartTime = node.StartTime
+	}
+	if node.LastProgressTime > total.LastProgressTime {
+		total.LastProgressTime = node.LastProgressTime
+	}
+	if node.EstimatedSecondsRemaining > total.EstimatedSecondsRemaining {
+		total.EstimatedSecondsRemaining = node.EstimatedSecondsRemaining
+		total.EstimatedCompletion = node.EstimatedCompletion
+	}
+}
+
+// getAppRebalanceProgress serves /getAppRebalanceProgress?name=X, reporting vbs each
+// eventing node is yet to own or give up for the function along with estimated
+// completion. Reports all functions if name isn't specified
+func (m *ServiceMgr) getAppRebalanceProgress(w http.ResponseWriter, r *http.Request) {
+	logPrefix := "ServiceMgr::getAppRebalanceProgress"
+
+	if !m.validateAuth(w, r, EventingPermissionManage) {
+		return
+	}
+
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	appName := r.URL.Query().Get("name")
+
+	result := &clusterRebalanceProgress{
+		Functions: make(map[string]*common.AppRebalanceProgress),
+		Nodes:     make(map[string]map[string]*common.AppRebalanceProgress),
+	}
+
+	util.Retry(util.NewFixedBackoff(time.Second), nil, getEventingNodesAddressesOpCallback, m)
+	netClient := util.CheckTLSandGetClient(util.HTTPRequestTimeout)
+
+	for _, nodeAddr := range m.eventingNodeAddrs {
+		url := util.CheckTLSandReplaceProtocol("http://%s/getLocalAppRebalanceProgress?name=%s", nodeAddr, appName)
+
+		nodeProgress, err := requestRebalanceProgress(netClient, url)
+		if err != nil {
+			logging.Errorf("%s Function: %s failed to fetch rebalance progress from node: %rs, err: %v",
+				logPrefix, appName, nodeAddr, err)
+			if result.NodeErrors == nil {
+				result.NodeErrors = make(map[string]string)
+			}
+			result.NodeErrors[nodeAddr] = err.Error()
+			continue
+		}
+		result.Nodes[nodeAddr] = nodeProgress
+
+		for app, progress := range nodeProgress {
+			if _, ok := result.Functions[app]; !ok {
+				result.Functions[app] = &common.AppRebalanceProgress{}
+			}
+			mergeRebalanceProgress(result.Functions[app], progress)
+		}
+	}
+
+	data, err := json.MarshalIndent(result, "", " ")
+	if err != nil {
+		w.Header().Add(headerKey, strconv.Itoa(m.statusCodes.errMarshalResp.Code))
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "Failed to marshal response, err: %v", err)
+		return
+	}
+
+	w.Header().Add(headerKey, strconv.Itoa(m.statusCodes.ok.Code))
+	fmt.Fprintf(w, "%v", string(data))
+}
+
+func requestRebalanceProgress(netClient *util.Client, url string) (map[string]*common.AppRebalanceProgress, error) {
+	res, err := netClient.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	buf, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code: %d, response: %s", res.StatusCode, string(buf))
+	}
+
+	progress := make(map[string]*common.AppRebalanceProgress)
+	err = json.Unmarshal(buf, &progress)
+	return progress, err
+}
+
+// getLocalAppRebalanceProgress returns rebalance progress of functions running on this node
+func (m *ServiceMgr) getLocalAppRebalanceProgress(w http.ResponseWriter, r *http.Request) {
+	if !m.validateAuth(w, r, EventingPermissionManage) {
+		return
+	}
+
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	progress := m.localRebalanceProgress(r.URL.Query().Get("name"))
+
+	data, err := json.Marshal(progress)
+	if err != nil {
+		w.Header().Add(headerKey, strconv.Itoa(m.statusCodes.errMarshalResp.Code))
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "Failed to marshal rebalance progress, err: %v", err)
+		return
+	}
+
+	w.Header().Add(headerKey, strconv.Itoa(m.statusCodes.ok.Code))
+	fmt.Fprintf(w, "%v", string(data))
+}
@@ -0,0 +1,250 @@
+package servicemanager
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/couchbase/cbauth"
+	"github.com/couchbase/eventing/logging"
+	"github.com/couchbase/eventing/util"
+)
+
+const (
+	recommendationInterval    = 60 * time.Second
+	recommendationSampleCount = 10
+
+	// Backlog is considered growing when it has increased across at least these
+	// many consecutive samples and is above recommendationMinBacklog
+	recommendationGrowthSamples = 5
+	recommendationMinBacklog    = 10000
+
+	// Worker queue utilisation beyond which workers are considered saturated
+	recommendationQueueUtilisation = 0.8
+
+	// p95 handler latency in microseconds beyond which handler execution is
+	// considered slow enough to benefit from more threads
+	recommendationLatencyThreshold = 100 * 1000
+
+	recommendationMaxThreadCount = 16
+)
+
+type backlogSample struct {
+	timestamp        time.Time
+	backlog          uint64
+	queueUtilisation float64
+	p95Latency       int
+}
+
+type recommendation struct {
+	AppName     string `json:"function_name"`
+	Action      string `json:"action"`
+	Setting     string `json:"setting,omitempty"`
+	Current     int    `json:"current,omitempty"`
+	Recommended int    `json:"recommended,omitempty"`
+	Reason      string `json:"reason"`
+	GeneratedAt string `json:"generated_at"`
+}
+
+// analyzeBacklog periodically samples backlog, worker utilisation and latency of
+// functions deployed on this node and derives scaling recommendations from them
+func (m *ServiceMgr) analyzeBacklog() {
+	logPrefix := "ServiceMgr::analyzeBacklog"
+
+	ticker := time.NewTicker(recommendationInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			m.sampleBacklog()
+			m.updateRecommendations()
+
+		case <-m.finch:
+			logging.Infof("%s Exiting backlog analyzer", logPrefix)
+			return
+		}
+	}
+}
+
+func (m *ServiceMgr) sampleBacklog() {
+	deployedApps := m.superSup.GetLocallyDeployedApps()
+
+	m.recommendationMutex.Lock()
+	defer m.recommendationMutex.Unlock()
+
+	for appName := range m.backlogSamples {
+		if _, ok := deployedApps[appName]; !ok {
+			delete(m.backlogSamples, appName)
+		}
+	}
+
+	for appName := range deployedApps {
+		sample := &backlogSample{
+			timestamp:  time.Now(),
+			backlog:    m.superSup.GetDcpEventsRemainingToProcess(appName),
+			p95Latency: percentileN(m.superSup.GetLatencyStats(appName), 95),
+		}
+
+		stats := m.superSup.GetEventProcessingStats(appName)
+		if queueCap := stats["agg_queue_size_cap"]; queueCap > 0 {
+			sample.queueUtilisation = float64(stats["agg_queue_size"]) / float64(queueCap)
+		}
+
+		samples := append(m.backlogSamples[appName], sample)
+		if len(samples) > recommendationSampleCount {
+			samples = samples[len(samples)-recommendationSampleCount:]
+		}
+		m.backlogSamples[appName] = samples
+	}
+}
+
+func (m *ServiceMgr) updateRecommendations() {
+	logPrefix := "ServiceMgr::updateRecommendations"
+
+	cpuCount := util.CPUCount(true)
+	now := time.Now().UTC().Format(time.RFC3339)
+	recommendations := make(map[string][]recommendation)
+
+	m.recommendationMutex.RLock()
+	backlogSamples := make(map[string][]*backlogSample, len(m.backlogSamples))
+	for appName, samples := range m.backlogSamples {
+		backlogSamples[appName] = samples
+	}
+	m.recommendationMutex.RUnlock()
+
+	for _, app := range m.getTempStoreAll() {
+		samples, ok := backlogSamples[app.Name]
+		if !ok || len(samples) == 0 {
+			continue
+		}
+
+		workerCount := 3
+		if val, ok := app.Settings["worker_count"].(float64); ok {
+			workerCount = int(val)
+		}
+
+		threadCount := 2
+		if val, ok := app.Settings["cpp_worker_thread_count"].(float64); ok {
+			threadCount = int(val)
+		}
+
+		latest := samples[len(samples)-1]
+		growing := isBacklogGrowing(samples)
+		saturated := latest.queueUtilisation >= recommendationQueueUtilisation
+		slow := latest.p95Latency >= recommendationLatencyThreshold
+
+		var recs []recommendation
+		switch {
+		case growing && workerCount < cpuCount:
+			recommended := workerCount * 2
+			if recommended > cpuCount {
+				recommended = cpuCount
+			}
+			recs = append(recs, recommendation{
+				Action:      "increase_worker_count",
+				Setting:     "worker_count",
+				Current:     workerCount,
+				Recommended: recommended,
+				Reason: fmt.Sprintf("DCP backlog grew from %d to %d over last %d samples",
+					samples[0].backlog, latest.backlog, len(samples)),
+			})
+
+		case growing:
+			recs = append(recs, recommendation{
+				Action: "add_eventing_node",
+				Reason: fmt.Sprintf("DCP backlog grew from %d to %d over last %d samples and worker_count: %d already matches cpu count: %d",
+					samples[0].backlog, latest.backlog, len(samples), workerCount, cpuCount),
+			})
+		}
+
+		if saturated && slow && threadCount < recommendationMaxThreadCount {
+			recommended := threadCount * 2
+			if recommended > recommendationMaxThreadCount {
+				recommended = recommendationMaxThreadCount
+			}
+			recs = append(recs, recommendation{
+				Action:      "increase_thread_count",
+				Setting:     "cpp_worker_thread_count",
+				Current:     threadCount,
+				Recommended: recommended,
+				Reason: fmt.Sprintf("Worker queues are %.0f%% full with p95 handler latency of %d us",
+					latest.queueUtilisation*100, latest.p95Latency),
+			})
+		}
+
+		for i := range recs {
+			recs[i].AppName = app.Name
+			recs[i].GeneratedAt = now
+			logging.Infof("%s Function: %s recommendation: %s reason: %s", logPrefix, app.Name, recs[i].Action, recs[i].Reason)
+		}
+
+		if len(recs) > 0 {
+			recommendations[app.Name] = recs
+		}
+	}
+
+	m.recommendationMutex.Lock()
+	m.recommendations = recommendations
+	m.recommendationMutex.Unlock()
+}
+
+func isBacklogGrowing(samples []*backlogSample) bool {
+	if len(samples) < recommendationGrowthSamples {
+		return false
+	}
+
+	window := samples[len(samples)-recommendationGrowthSamples:]
+	for i := 1; i < len(window); i++ {
+		if window[i].backlog <= window[i-1].backlog {
+			return false
+		}
+	}
+	return window[len(window)-1].backlog >= recommendationMinBacklog
+}
+
+func (m *ServiceMgr) getRecommendations(w http.ResponseWriter, r *http.Request) {
+	logPrefix := "ServiceMgr::getRecommendations"
+
+	w.Header().Set("Content-Type", "application/json")
+	if !m.validateAuth(w, r, EventingPermissionManage) {
+		cbauth.SendForbidden(w, EventingPermissionManage)
+		return
+	}
+
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	logging.Infof("%s REST Call: %v %v", logPrefix, r.URL.Path, r.Method)
+
+	appName := r.URL.Query().Get("name")
+
+	m.recommendationMutex.RLock()
+	recs := make([]recommendation, 0)
+	for name, appRecs := range m.recommendations {
+		if appName == "" || appName == name {
+			recs = append(recs, appRecs...)
+		}
+	}
+	m.recommendationMutex.RUnlock()
+
+	sort.Slice(recs, func(i, j int) bool {
+		return recs[i].AppName < recs[j].AppName
+	})
+
+	data, err := json.MarshalIndent(recs, "", " ")
+	if err != nil {
+		info := &runtimeInfo{
+			Code: m.statusCodes.errMarshalResp.Code,
+			Info: fmt.Sprintf("Failed to marshal recommendations, err: %v", err),
+		}
+		m.sendErrorInfo(w, info)
+		return
+	}
+
+	w.Write(data)
+}
@@ -0,0 +1,207 @@
+package servicemanager
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Stat groups that could be requested through groups query param of /api/v1/stats
+const (
+	statsGroupExecution = "execution"
+	statsGroupFailure   = "failure"
+	statsGroupLatency   = "latency"
+	statsGroupVb        = "vb"
+	statsGroupTimers    = "timers"
+	statsGroupMisc      = "misc"
+)
+
+var (
+	statsGroups = []string{statsGroupExecution, statsGroupFailure, statsGroupLatency,
+		statsGroupVb, statsGroupTimers, statsGroupMisc}
+
+	// Matches vbucket number in checkpoint and span blob keys i.e. <app>::vb::<vb> and <app>:tm:<vb>:sp
+	blobKeyVbRegexp = regexp.MustCompile(`(?:::vb::|:tm:)(\d+)`)
+)
+
+// statsFilter narrows down stats payload, zero value selects everything
+type statsFilter struct {
+	groups map[string]struct{}
+	vbs    map[int]struct{}
+	offset int
+	limit  int
+}
+
+type vbPagination struct {
+	Offset int `json:"offset"`
+	Limit  int `json:"limit"`
+	Total  int `json:"total"`
+}
+
+// parseStatsFilter reads following query params:
+// groups - comma separated stat groups, defaults to all groups
+// vbs - comma separated vbuckets or vbucket ranges e.g. 0-127,512, below numVbuckets
+// offset, limit - page through vbucket level details, ordered by vbucket number
+func parseStatsFilter(values url.Values, numVbuckets int) (*statsFilter, error) {
+	filter := &statsFilter{}
+
+	if groups := values.Get("groups"); groups != "" {
+		filter.groups = make(map[string]struct{})
+		for _, group := range strings.Split(groups, ",") {
+			group = strings.TrimSpace(group)
+			found := false
+			for _, g := range statsGroups {
+				if g == group {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return nil, fmt.Errorf("invalid stats group: %s, possible values: %v", group, statsGroups)
+			}
+			filter.groups[group] = struct{}{}
+		}
+	}
+
+	if vbs := values.Get("vbs"); vbs != "" {
+		filter.vbs = make(map[int]struct{})
+		for _, vbRange := range strings.Split(vbs, ",") {
+			bounds := strings.SplitN(strings.TrimSpace(vbRange), "-", 2)
+
+			start, err := strconv.Atoi(bounds[0])
+			if err != nil || start < 0 {
+				return nil, fmt.Errorf("invalid vbucket range: %s", vbRange)
+			}
+
+			end := start
+			if len(bounds) == 2 {
+				end, err = strconv.Atoi(bounds[1])
+				if err != nil || end < start {
+					return nil, fmt.Errorf("invalid vbucket range: %s", vbRange)
+				}
+			}
+
+			if end >= numVbuckets {
+				return nil, fmt.Errorf("invalid vbucket range: %s, vbuckets range from 0 to %d", vbRange, numVbuckets-1)
+			}
+
+			for vb := start; vb <= end; vb++ {
+				filter.vbs[vb] = struct{}{}
+			}
+		}
+	}
+
+	var err error
+	if offset := values.Get("offset"); offset != "" {
+		filter.offset, err = strconv.Atoi(offset)
+		if err != nil || filter.offset < 0 {
+			return nil, fmt.Errorf("offset should be a non-negative integer, got: %s", offset)
+		}
+	}
+
+	if limit := values.Get("limit"); limit != "" {
+		filter.limit, err = strconv.Atoi(limit)
+		if err != nil || filter.limit <= 0 {
+			return nil, fmt.Errorf("limit should be a positive integer, got: %s", limit)
+		}
+	}
+
+	return filter, nil
+}
+
+func (f *statsFilter) includes(group string) bool {
+	if f == nil || len(f.groups) == 0 {
+		return true
+	}
+	_, ok := f.groups[group]
+	return ok
+}
+
+func (f *statsFilter) paginated() bool {
+	return f != nil && (len(f.vbs) > 0 || f.offset > 0 || f.limit > 0)
+}
+
+// selectVbs applies vbucket ranges and pagination to the supplied vbuckets
+func (f *statsFilter) selectVbs(allVbs []int) (map[int]struct{}, *vbPagination) {
+	vbs := make([]int, 0, len(allVbs))
+	for _, vb := range allVbs {
+		if len(f.vbs) > 0 {
+			if _, ok := f.vbs[vb]; !ok {
+				continue
+			}
+		}
+		vbs = append(vbs, vb)
+	}
+	sort.Ints(vbs)
+
+	page := &vbPagination{Offset: f.offset, Limit: f.limit, Total: len(vbs)}
+
+	start := f.offset
+	if start > len(vbs) {
+		start = len(vbs)
+	}
+	end := len(vbs)
+	if f.limit > 0 && start+f.limit < end {
+		end = start + f.limit
+	}
+
+	selected := make(map[int]struct{})
+	for _, vb := range vbs[start:end] {
+		selected[vb] = struct{}{}
+	}
+	return selected, page
+}
+
+// filterVbMap retains only selected vbuckets from stats keyed by vbucket number
+func filterVbMap(stats interface{}, selected map[int]struct{}) interface{} {
+	val := reflect.ValueOf(stats)
+	if val.Kind() != reflect.Map || val.Type().Key().Kind() != reflect.Int {
+		return stats
+	}
+
+	filtered := reflect.MakeMap(val.Type())
+	for _, key := range val.MapKeys() {
+		if _, ok := selected[int(key.Int())]; ok {
+			filtered.SetMapIndex(key, val.MapIndex(key))
+		}
+	}
+	return filtered.Interface()
+}
+
+// filterBlobDump retains only blobs of selected vbuckets from checkpoint or span blob dump
+func filterBlobDump(dump interface{}, selected map[int]struct{}) interface{} {
+	blobs, ok := dump.(map[string]interface{})
+	if !ok {
+		return dump
+	}
+
+	filtered := make(map[string]interface{})
+	for key, blob := range blobs {
+		match := blobKeyVbRegexp.FindStringSubmatch(key)
+		if len(match) != 2 {
+			continue
+		}
+
+		vb, err := strconv.Atoi(match[1])
+		if err != nil {
+			continue
+		}
+
+		if _, ok := selected[vb]; ok {
+			filtered[key] = blob
+		}
+	}
+	return filtered
+}
+
+func vbsFromStats(stats map[int]int64) []int {
+	vbs := make([]int, 0, len(stats))
+	for vb := range stats {
+		vbs = append(vbs, vb)
+	}
+	return vbs
+}
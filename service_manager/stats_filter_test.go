@@ -0,0 +1,132 @@
+package servicemanager
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestParseStatsFilter(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		expected *statsFilter
+	}{
+		{"no params", "", &statsFilter{}},
+		{
+			name:     "groups",
+			query:    "groups=vb,%20timers",
+			expected: &statsFilter{groups: map[string]struct{}{"vb": {}, "timers": {}}},
+		},
+		{"unknown group", "groups=vb,cpu", nil},
+		{
+			name:     "vbucket ranges",
+			query:    "vbs=1-3,7",
+			expected: &statsFilter{vbs: map[int]struct{}{1: {}, 2: {}, 3: {}, 7: {}}},
+		},
+		{"vbucket range inverted", "vbs=3-1", nil},
+		{"vbucket past last", "vbs=0-1024", nil},
+		{"negative vbucket", "vbs=-1", nil},
+		{"pagination", "offset=10&limit=5", &statsFilter{offset: 10, limit: 5}},
+		{"negative offset", "offset=-1", nil},
+		{"zero limit", "limit=0", nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			values, err := url.ParseQuery(test.query)
+			if err != nil {
+				t.Fatalf("failed to parse query: %s, err: %v", test.query, err)
+			}
+
+			got, err := parseStatsFilter(values, 1024)
+			if test.expected == nil {
+				if err == nil {
+					t.Errorf("got: %+v expected an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("got err: %v expected: %+v", err, test.expected)
+			}
+			if !reflect.DeepEqual(got, test.expected) {
+				t.Errorf("got: %+v expected: %+v", got, test.expected)
+			}
+		})
+	}
+}
+
+func TestSelectVbs(t *testing.T) {
+	allVbs := []int{5, 0, 3, 1, 4, 2}
+
+	tests := []struct {
+		name     string
+		filter   *statsFilter
+		expected []int
+		total    int
+	}{
+		{"everything", &statsFilter{}, []int{0, 1, 2, 3, 4, 5}, 6},
+		{"vbuckets", &statsFilter{vbs: map[int]struct{}{1: {}, 4: {}, 9: {}}}, []int{1, 4}, 2},
+		{"first page", &statsFilter{limit: 4}, []int{0, 1, 2, 3}, 6},
+		{"last page", &statsFilter{offset: 4, limit: 4}, []int{4, 5}, 6},
+		{"past last page", &statsFilter{offset: 10, limit: 4}, []int{}, 6},
+		{"page of vbuckets", &statsFilter{vbs: map[int]struct{}{1: {}, 2: {}, 3: {}}, offset: 1, limit: 1}, []int{2}, 3},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			selected, page := test.filter.selectVbs(allVbs)
+
+			expected := make(map[int]struct{})
+			for _, vb := range test.expected {
+				expected[vb] = struct{}{}
+			}
+			if !reflect.DeepEqual(selected, expected) {
+				t.Errorf("got: %v expected: %v", selected, expected)
+			}
+			if page.Total != test.total {
+				t.Errorf("total got: %d expected: %d", page.Total, test.total)
+			}
+		})
+	}
+}
+
+func TestFilterBlobDump(t *testing.T) {
+	dump := map[string]interface{}{
+		"eventing::12::app::vb::3":   "checkpoint 3",
+		"eventing::12::app::vb::31":  "checkpoint 31",
+		"eventing::12::app:tm:3:sp":  "span 3",
+		"eventing::12::app:tm:30:sp": "span 30",
+		"eventing::12::app::other":   "no vbucket",
+	}
+
+	tests := []struct {
+		name     string
+		selected map[int]struct{}
+		expected map[string]interface{}
+	}{
+		{"none selected", map[int]struct{}{}, map[string]interface{}{}},
+		{
+			name:     "checkpoint and span of vbucket",
+			selected: map[int]struct{}{3: {}},
+			expected: map[string]interface{}{"eventing::12::app::vb::3": "checkpoint 3", "eventing::12::app:tm:3:sp": "span 3"},
+		},
+		{
+			name:     "vbucket number not matched by prefix",
+			selected: map[int]struct{}{30: {}, 31: {}},
+			expected: map[string]interface{}{"eventing::12::app::vb::31": "checkpoint 31", "eventing::12::app:tm:30:sp": "span 30"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := filterBlobDump(dump, test.selected); !reflect.DeepEqual(got, test.expected) {
+				t.Errorf("got: %v expected: %v", got, test.expected)
+			}
+		})
+	}
+
+	if got := filterBlobDump("not a dump", map[int]struct{}{}); got != "not a dump" {
+		t.Errorf("got: %v expected dump passed through", got)
+	}
+}
@@ -94,6 +94,9 @@ type statusCodes struct {
 	errRequestedOpFailed      statusBase
 	errCollectionMissing      statusBase
 	errEventingBusy           statusBase
+	errDuplicateFunction      statusBase
+	errDebuggerToken          statusBase
+	errDependencyCycle        statusBase
 }
 
 func (m *ServiceMgr) getDisposition(code int) int {
@@ -200,6 +203,12 @@ func (m *ServiceMgr) getDisposition(code int) int {
 		return http.StatusInternalServerError
 	case m.statusCodes.errEventingBusy.Code:
 		return http.StatusInternalServerError
+	case m.statusCodes.errDuplicateFunction.Code:
+		return http.StatusUnprocessableEntity
+	case m.statusCodes.errDebuggerToken.Code:
+		return http.StatusForbidden
+	case m.statusCodes.errDependencyCycle.Code:
+		return http.StatusUnprocessableEntity
 	default:
 		logging.Warnf("Unknown status code: %v", code)
 		return http.StatusInternalServerError
@@ -260,6 +269,9 @@ func (m *ServiceMgr) initErrCodes() {
 		errRequestedOpFailed:      statusBase{"ERR_REQUESTED_OP_FAILED", 55},
 		errCollectionMissing:      statusBase{"ERR_COLLECTION_MISSING", 56},
 		errEventingBusy:           statusBase{"ERR_EVENTING_BUSY", 57},
+		errDuplicateFunction:      statusBase{"ERR_DUPLICATE_FUNCTION", 58},
+		errDebuggerToken:          statusBase{"ERR_DEBUGGER_TOKEN_MISMATCH", 59},
+		errDependencyCycle:        statusBase{"ERR_FUNCTION_DEPENDENCY_CYCLE", 60},
 	}
 
 	errors := []errorPayload{
@@ -542,6 +554,21 @@ func (m *ServiceMgr) initErrCodes() {
 			Description: "Eventing node is busy with upgradation process",
 			Attributes:  []string{"retry"},
 		},
+		{
+			Name:        m.statusCodes.errDuplicateFunction.Name,
+			Code:        m.statusCodes.errDuplicateFunction.Code,
+			Description: "Function with identical code is already deployed against the same source keyspace",
+		},
+		{
+			Name:        m.statusCodes.errDebuggerToken.Name,
+			Code:        m.statusCodes.errDebuggerToken.Code,
+			Description: "Token passed doesn't match that of the debugger session",
+		},
+		{
+			Name:        m.statusCodes.errDependencyCycle.Name,
+			Code:        m.statusCodes.errDependencyCycle.Code,
+			Description: "Functions listed in depends_on form a cycle",
+		},
 	}
 
 	m.errorCodes = make(map[int]errorPayload)
@@ -0,0 +1,210 @@
+package servicemanager
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/couchbase/cbauth"
+	"github.com/couchbase/eventing/common"
+	"github.com/couchbase/eventing/logging"
+	"github.com/couchbase/eventing/util"
+)
+
+const (
+	statusSummaryInterval = 10 * time.Second
+
+	// Peers not heard from over health gossip for this long are left out of the summary
+	statusSummaryPeerStaleMs = 15 * 1000
+)
+
+type functionStatusSummary struct {
+	Name        string                `json:"name"`
+	State       string                `json:"state"`
+	NumNodes    int                   `json:"num_nodes"`
+	DcpBacklog  uint64                `json:"dcp_backlog"`
+	FailureRate float64               `json:"failure_rate"`
+	FencedNodes int                   `json:"fenced_nodes,omitempty"`
+	LastError   *common.FunctionError `json:"last_error,omitempty"`
+}
+
+type statusSummary struct {
+	Timestamp        string                   `json:"timestamp"`
+	NumEventingNodes int                      `json:"num_eventing_nodes"`
+	Functions        []*functionStatusSummary `json:"functions"`
+}
+
+type handlerCounters struct {
+	executions uint64
+	failures   uint64
+}
+
+// statusSummaryCache holds the summary last computed, along with handler counters
+// it was computed from so that failure rate reflects the most recent interval
+type statusSummaryCache struct {
+	sync.RWMutex
+	summary  *statusSummary
+	counters map[string]handlerCounters
+}
+
+func newStatusSummaryCache() *statusSummaryCache {
+	return &statusSummaryCache{
+		counters: make(map[string]handlerCounters),
+	}
+}
+
+// refreshStatusSummary periodically builds a compact per function status summary
+// for the cluster overview page. It's derived from health gossiped by eventing nodes,
+// and hence doesn't require stats to be gathered from every node on each request
+func (m *ServiceMgr) refreshStatusSummary() {
+	logPrefix := "ServiceMgr::refreshStatusSummary"
+
+	ticker := time.NewTicker(statusSummaryInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			m.updateStatusSummary()
+
+		case <-m.finch:
+			logging.Infof("%s Exiting status summary routine", logPrefix)
+			return
+		}
+	}
+}
+
+func (m *ServiceMgr) updateStatusSummary() *statusSummary {
+	nodeAddrs := append([]string(nil), m.eventingNodeAddrs...)
+
+	healths := []*common.NodeHealth{m.superSup.LocalNodeHealth()}
+	for _, health := range m.superSup.GetPeerHealth() {
+		if health.LastHeardMs > statusSummaryPeerStaleMs {
+			continue
+		}
+
+		// Failed over nodes could still be gossiping
+		if len(nodeAddrs) > 0 && !util.Contains(health.HostPortAddr, nodeAddrs) {
+			continue
+		}
+		healths = append(healths, health)
+	}
+
+	numEventingNodes := len(nodeAddrs)
+	if numEventingNodes < len(healths) {
+		numEventingNodes = len(healths)
+	}
+
+	summary := &statusSummary{
+		Timestamp:        time.Now().Format(time.RFC3339),
+		NumEventingNodes: numEventingNodes,
+		Functions:        make([]*functionStatusSummary, 0),
+	}
+
+	counters := make(map[string]handlerCounters)
+
+	c := m.statusSummary
+	c.RLock()
+	prevCounters := c.counters
+	c.RUnlock()
+
+	for _, app := range m.getTempStoreAll() {
+		fnSummary := &functionStatusSummary{Name: app.Name}
+
+		status := appStatus{Name: app.Name}
+		status.DeploymentStatus, _ = app.Settings["deployment_status"].(bool)
+		status.ProcessingStatus, _ = app.Settings["processing_status"].(bool)
+
+		var current handlerCounters
+		for _, health := range healths {
+			if util.Contains(app.Name, health.DeployedApps) {
+				status.NumDeployedNodes++
+			}
+			if util.Contains(app.Name, health.BootstrappingApps) {
+				status.NumBootstrappingNodes++
+			}
+			if util.Contains(app.Name, health.FencedApps) {
+				fnSummary.FencedNodes++
+			}
+
+			fnSummary.DcpBacklog += health.DcpBacklog[app.Name]
+			current.executions += health.Executions[app.Name]
+			current.failures += health.Failures[app.Name]
+
+			if err, ok := health.LastErrors[app.Name]; ok && err != nil {
+				if fnSummary.LastError == nil || err.Timestamp > fnSummary.LastError.Timestamp {
+					fnSummary.LastError = err
+				}
+			}
+		}
+
+		fnSummary.State = m.determineStatus(status, nil, numEventingNodes, false)
+		fnSummary.NumNodes = status.NumDeployedNodes
+		fnSummary.FailureRate = failureRate(prevCounters[app.Name], current)
+		counters[app.Name] = current
+
+		summary.Functions = append(summary.Functions, fnSummary)
+	}
+
+	sort.Slice(summary.Functions, func(i, j int) bool {
+		return summary.Functions[i].Name < summary.Functions[j].Name
+	})
+
+	c.Lock()
+	c.summary = summary
+	c.counters = counters
+	c.Unlock()
+
+	return summary
+}
+
+// failureRate returns fraction of handler invocations that failed since previous summary.
+// Counters going down e.g. on worker respawn or node leaving the cluster restart the window
+func failureRate(prev, current handlerCounters) float64 {
+	if current.executions < prev.executions || current.failures < prev.failures {
+		prev = handlerCounters{}
+	}
+
+	executions := current.executions - prev.executions
+	if executions == 0 {
+		return 0
+	}
+	return float64(current.failures-prev.failures) / float64(executions)
+}
+
+// getStatusSummary serves compact status of functions, consumed by cluster manager UI
+func (m *ServiceMgr) getStatusSummary(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if !m.validateAuth(w, r, EventingPermissionStats) {
+		cbauth.SendForbidden(w, EventingPermissionStats)
+		return
+	}
+
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	m.statusSummary.RLock()
+	summary := m.statusSummary.summary
+	m.statusSummary.RUnlock()
+
+	if summary == nil {
+		summary = m.updateStatusSummary()
+	}
+
+	data, err := json.Marshal(summary)
+	if err != nil {
+		w.Header().Add(headerKey, strconv.Itoa(m.statusCodes.errMarshalResp.Code))
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, `{"error":"Failed to marshal status summary, err: %v"}`, err)
+		return
+	}
+
+	w.Header().Add(headerKey, strconv.Itoa(m.statusCodes.ok.Code))
+	fmt.Fprintf(w, "%s", string(data))
+}
@@ -0,0 +1,62 @@
+package servicemanager
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/couchbase/eventing/common"
+	"github.com/couchbase/eventing/logging"
+)
+
+// cancelTimer serves /cancelTimer?name=X&callback=Y&reference=Z, cancelling a timer
+// created by the function as if handler had called cancelTimer on it. Timer store
+// is shared across eventing nodes, so request is served by this node alone
+func (m *ServiceMgr) cancelTimer(w http.ResponseWriter, r *http.Request) {
+	logPrefix := "ServiceMgr::cancelTimer"
+
+	if !m.validateAuth(w, r, EventingPermissionManage) {
+		return
+	}
+
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	values := r.URL.Query()
+	appName, callback, reference := values.Get("name"), values.Get("callback"), values.Get("reference")
+	if appName == "" || callback == "" || reference == "" {
+		w.Header().Add(headerKey, strconv.Itoa(m.statusCodes.errInvalidConfig.Code))
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Function name, callback and reference need to be specified")
+		return
+	}
+
+	if !m.checkIfDeployedAndRunning(appName) {
+		w.Header().Add(headerKey, strconv.Itoa(m.statusCodes.errAppNotDeployed.Code))
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprintf(w, "Function: %s not in deployed state", appName)
+		return
+	}
+
+	logging.Infof("%s Function: %s cancelling timer callback: %s reference: %ru",
+		logPrefix, appName, callback, reference)
+
+	err := m.superSup.CancelTimer(appName, callback, reference)
+	if err == common.ErrTimersNotInUse {
+		w.Header().Add(headerKey, strconv.Itoa(m.statusCodes.errInvalidConfig.Code))
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Function: %s doesn't use timers", appName)
+		return
+	}
+	if err != nil {
+		w.Header().Add(headerKey, strconv.Itoa(m.statusCodes.errAppNotDeployed.Code))
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprintf(w, "%v", err)
+		return
+	}
+
+	w.Header().Add(headerKey, strconv.Itoa(m.statusCodes.ok.Code))
+	fmt.Fprintf(w, "Function: %s timer cancellation sent", appName)
+}
@@ -0,0 +1,94 @@
+package servicemanager
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/couchbase/eventing/common"
+	"github.com/couchbase/eventing/logging"
+)
+
+// verifyTimerStore serves /verifyTimerStore?name=X[&vb=N][&policy=skip|repair], verifying
+// timer store of vbs owned by the function on this node, or of vb N alone. Policy repair
+// removes corrupt records and dangling alarms, skip merely reports them
+func (m *ServiceMgr) verifyTimerStore(w http.ResponseWriter, r *http.Request) {
+	logPrefix := "ServiceMgr::verifyTimerStore"
+
+	if !m.validateAuth(w, r, EventingPermissionManage) {
+		return
+	}
+
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	values := r.URL.Query()
+	appName := values.Get("name")
+	if appName == "" {
+		w.Header().Add(headerKey, strconv.Itoa(m.statusCodes.errInvalidConfig.Code))
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Function name needs to be specified")
+		return
+	}
+
+	policy := values.Get("policy")
+	if policy == "" {
+		policy = common.TimerIntegritySkip
+	}
+	if policy != common.TimerIntegritySkip && policy != common.TimerIntegrityRepair {
+		w.Header().Add(headerKey, strconv.Itoa(m.statusCodes.errInvalidConfig.Code))
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "policy can only be %s or %s", common.TimerIntegritySkip, common.TimerIntegrityRepair)
+		return
+	}
+
+	var vbs []uint16
+	if vbStr := values.Get("vb"); vbStr != "" {
+		vb, err := strconv.Atoi(vbStr)
+		if err != nil || vb < 0 || vb >= m.superSup.NumVbuckets() {
+			w.Header().Add(headerKey, strconv.Itoa(m.statusCodes.errInvalidConfig.Code))
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "Invalid vb: %s", vbStr)
+			return
+		}
+		vbs = append(vbs, uint16(vb))
+	}
+
+	if !m.checkIfDeployedAndRunning(appName) {
+		w.Header().Add(headerKey, strconv.Itoa(m.statusCodes.errAppNotDeployed.Code))
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprintf(w, "Function: %s not in deployed state", appName)
+		return
+	}
+
+	logging.Infof("%s Function: %s verifying timer store, vbs: %v policy: %s",
+		logPrefix, appName, vbs, policy)
+
+	reports, err := m.superSup.VerifyTimerStore(appName, vbs, policy)
+	if err == common.ErrTimersNotInUse {
+		w.Header().Add(headerKey, strconv.Itoa(m.statusCodes.errInvalidConfig.Code))
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Function: %s doesn't use timers", appName)
+		return
+	}
+	if err != nil {
+		w.Header().Add(headerKey, strconv.Itoa(m.statusCodes.errAppNotDeployed.Code))
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprintf(w, "%v", err)
+		return
+	}
+
+	data, err := json.MarshalIndent(reports, "", " ")
+	if err != nil {
+		w.Header().Add(headerKey, strconv.Itoa(m.statusCodes.errMarshalResp.Code))
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "Failed to marshal timer store reports, err: %v", err)
+		return
+	}
+
+	w.Header().Add(headerKey, strconv.Itoa(m.statusCodes.ok.Code))
+	fmt.Fprintf(w, "%v", string(data))
+}
@@ -107,7 +107,15 @@ func (m *ServiceMgr) fillMissingWithDefaults(appName string, settings map[string
 	// Handler related configurations
 	fillMissingDefault(app, settings, "n1ql_prepare_all", false)
 	fillMissingDefault(app, settings, "allow_transaction_mutations", false)
+	fillMissingDefault(app, settings, "include_xattrs", false)
+	fillMissingDefault(app, settings, "skip_binary_docs", false)
+	fillMissingDefault(app, settings, "worker_frame_checksums", false)
+	fillMissingDefault(app, settings, "origin_tagging", false)
+	fillMissingDefault(app, settings, "subscribe_topics", []interface{}{})
+	fillMissingDefault(app, settings, "builder_initial_capacity", float64(0))
+	fillMissingDefault(app, settings, "builder_pool_size", float64(128))
 	fillMissingDefault(app, settings, "checkpoint_interval", float64(60000))
+	fillMissingDefault(app, settings, "checkpoint_batch_interval", float64(1000))
 	fillMissingDefault(app, settings, "cpp_worker_thread_count", float64(2))
 	fillMissingDefault(app, settings, "curl_max_allowed_resp_size", float64(100))
 	fillMissingDefault(app, settings, "execution_timeout", float64(60))
@@ -116,16 +124,43 @@ func (m *ServiceMgr) fillMissingWithDefaults(appName string, settings map[string
 	fillMissingDefault(app, settings, "idle_checkpoint_interval", float64(30000))
 	fillMissingDefault(app, settings, "lcb_inst_capacity", float64(5))
 	fillMissingDefault(app, settings, "log_level", "INFO")
+	fillMissingDefault(app, settings, "max_doc_size_bytes", float64(0))
+	fillMissingDefault(app, settings, "max_doc_size_mode", common.MaxDocSizeModeSkip)
+	fillMissingDefault(app, settings, "max_doc_size_log", false)
+	fillMissingDefault(app, settings, "delivery_guarantee", common.DeliveryBestEffort)
+	fillMissingDefault(app, settings, "timer_integrity_check", common.TimerIntegritySkip)
+	fillMissingDefault(app, settings, "worker_ipc_type", common.WorkerIPCAuto)
+	fillMissingDefault(app, settings, "dead_letter_retry_count", float64(2))
+	fillMissingDefault(app, settings, "retry_count", float64(0))
+	fillMissingDefault(app, settings, "retry_backoff", float64(1000))
+	fillMissingDefault(app, settings, "retry_on", []interface{}{common.RetryOnTimeout, common.RetryOnLcbError})
+	fillMissingDefault(app, settings, "strict_order_check", false)
+	fillMissingDefault(app, settings, "use_bootstrap_dcp_connections", false)
+	fillMissingDefault(app, settings, "bootstrap_dcp_backfill_threshold", float64(10000))
+	fillMissingDefault(app, settings, "bootstrap_dcp_priority", "low")
+	fillMissingDefault(app, settings, "prefetch_key_patterns", []interface{}{})
+	fillMissingDefault(app, settings, "prefetch_key_separator", "::")
+	fillMissingDefault(app, settings, "debugger_replay_events", float64(0))
 	fillMissingDefault(app, settings, "poll_bucket_interval", float64(10))
 	fillMissingDefault(app, settings, "sock_batch_size", float64(100))
 	fillMissingDefault(app, settings, "tick_duration", float64(60000))
 	fillMissingDefault(app, settings, "timer_context_size", float64(1024))
+	fillMissingDefault(app, settings, "timer_lane_batch_size", float64(100))
+	fillMissingDefault(app, settings, "dcp_lane_batch_size", float64(100))
 	fillMissingDefault(app, settings, "undeploy_routine_count", float64(6))
 	fillMissingDefault(app, settings, "worker_count", float64(1))
 	fillMissingDefault(app, settings, "worker_feedback_queue_cap", float64(500))
 	fillMissingDefault(app, settings, "worker_queue_cap", float64(100*1000))
 	fillMissingDefault(app, settings, "worker_queue_mem_cap", float64(1024))
+	fillMissingDefault(app, settings, "worker_queue_high_watermark", float64(90))
+	fillMissingDefault(app, settings, "worker_queue_low_watermark", float64(60))
 	fillMissingDefault(app, settings, "worker_response_timeout", float64(3600))
+	fillMissingDefault(app, settings, "worker_rss_limit", float64(0))
+	fillMissingDefault(app, settings, "worker_cpu_limit", float64(0))
+	fillMissingDefault(app, settings, "dcp_throughput_quota", float64(0))
+	fillMissingDefault(app, settings, "cpp_thread_quota", float64(0))
+	fillMissingDefault(app, settings, "metadata_latency_inject_percent", float64(0))
+	fillMissingDefault(app, settings, "metadata_latency_inject_ms", float64(0))
 	fillMissingDefault(app, settings, "bucket_cache_size", float64(64*1024*1024))
 	fillMissingDefault(app, settings, "bucket_cache_age", float64(1000))
 
@@ -136,6 +171,9 @@ func (m *ServiceMgr) fillMissingWithDefaults(appName string, settings map[string
 	// Rebalance related configurations
 	fillMissingDefault(app, settings, "vb_ownership_giveup_routine_count", float64(3))
 	fillMissingDefault(app, settings, "vb_ownership_takeover_routine_count", float64(3))
+	fillMissingDefault(app, settings, "vb_takeover_deadline", float64(0))
+	fillMissingDefault(app, settings, "vb_force_takeover", false)
+	fillMissingDefault(app, settings, "vb_handover_linger_timeout", float64(0))
 
 	// Application logging related configurations
 	fillMissingDefault(app, settings, "app_log_max_size", float64(1024*1024*40))
@@ -148,9 +186,11 @@ func (m *ServiceMgr) fillMissingWithDefaults(appName string, settings map[string
 	fillMissingDefault(app, settings, "dcp_window_size", float64(20*1024*1024))
 	fillMissingDefault(app, settings, "dcp_gen_chan_size", float64(10000))
 	fillMissingDefault(app, settings, "dcp_num_connections", float64(1))
+	fillMissingDefault(app, settings, "dcp_noop_interval", float64(120))
 
 	// N1QL related configuration
 	fillMissingDefault(app, settings, "n1ql_consistency", "none")
+	fillMissingDefault(app, settings, "n1ql_timeout", float64(0))
 
 	// Language related configuration
 	fillMissingDefault(app, settings, "language_compatibility", common.LanguageCompatibility[0])
@@ -358,10 +398,11 @@ func (m *ServiceMgr) getSourceBindingFromFlatBuf(config *cfg.DepCfg, appdata *cf
 }
 
 func (m *ServiceMgr) isSrcMutationEnabled(cfg *depCfg) bool {
-	sourceKeyspace := common.Keyspace{
-		BucketName:     cfg.SourceBucket,
-		ScopeName:      cfg.SourceScope,
-		CollectionName: cfg.SourceCollection,
+	sourceKeyspaces := map[common.Keyspace]struct{}{
+		{BucketName: cfg.SourceBucket, ScopeName: cfg.SourceScope, CollectionName: cfg.SourceCollection}: struct{}{},
+	}
+	for _, collection := range cfg.SourceCollections {
+		sourceKeyspaces[common.Keyspace{BucketName: cfg.SourceBucket, ScopeName: cfg.SourceScope, CollectionName: collection}] = struct{}{}
 	}
 	for _, binding := range cfg.Buckets {
 		bind := common.Keyspace{
@@ -369,7 +410,7 @@ func (m *ServiceMgr) isSrcMutationEnabled(cfg *depCfg) bool {
 			ScopeName:      binding.ScopeName,
 			CollectionName: binding.CollectionName,
 		}
-		if bind == sourceKeyspace && binding.Access == "rw" {
+		if _, ok := sourceKeyspaces[bind]; ok && binding.Access == "rw" {
 			return true
 		}
 	}
@@ -438,6 +479,22 @@ func (m *ServiceMgr) getSourceAndDestinationsFromDepCfg(cfg *depCfg) (src common
 	return src, dest
 }
 
+// deadLetterKeyspace returns dead letter keyspace configured in settings, if any.
+// Dead lettered mutations are written there, so it's a destination of the function
+func deadLetterKeyspace(settings map[string]interface{}) (common.Keyspace, bool) {
+	bucket, _ := settings["dead_letter_bucket"].(string)
+	if bucket == "" {
+		return common.Keyspace{}, false
+	}
+
+	scope, _ := settings["dead_letter_scope"].(string)
+	collection, _ := settings["dead_letter_collection"].(string)
+	return common.Keyspace{BucketName: bucket,
+		ScopeName:      common.CheckAndReturnDefaultForScopeOrCollection(scope),
+		CollectionName: common.CheckAndReturnDefaultForScopeOrCollection(collection),
+	}, true
+}
+
 // GetNodesHostname returns hostnames of all nodes with alternate Addresses if any
 func GetNodesHostname(data map[string]interface{}) []string {
 	hostnames := make([]string, 0)
@@ -462,6 +519,30 @@ func GetNodesHostname(data map[string]interface{}) []string {
 	return hostnames
 }
 
+// GetDebuggerReplay returns vb and count of events to replay into debugger, if asked
+// for by debugger start request as "replay": {"vb": 12, "count": 5}
+func GetDebuggerReplay(data map[string]interface{}) (*common.DebuggerReplay, error) {
+	replay, exists := data["replay"].(map[string]interface{})
+	if !exists {
+		return nil, nil
+	}
+
+	vb, ok := replay["vb"].(float64)
+	if !ok || vb < 0 || vb >= 65536 || vb != float64(int(vb)) {
+		return nil, fmt.Errorf("replay vb must be a valid vbucket number")
+	}
+
+	var count float64
+	if val, exists := replay["count"]; exists {
+		count, ok = val.(float64)
+		if !ok || count < 0 || count != float64(int(count)) {
+			return nil, fmt.Errorf("replay count must be a non-negative integer")
+		}
+	}
+
+	return &common.DebuggerReplay{Vbucket: uint16(vb), Count: int(count)}, nil
+}
+
 func (m *ServiceMgr) UpdateBucketGraphFromMetakv(functionName string) error {
 	logPrefix := "ServiceMgr::UpdateBucketGraphFromMektakv"
 	appData, err := util.ReadAppContent(metakvAppsPath, metakvChecksumPath, functionName)
@@ -471,6 +552,9 @@ func (m *ServiceMgr) UpdateBucketGraphFromMetakv(functionName string) error {
 	}
 	app := m.parseFunctionPayload(appData, functionName)
 	source, destinations := m.getSourceAndDestinationsFromDepCfg(&app.DeploymentConfig)
+	if dlq, ok := deadLetterKeyspace(app.Settings); ok {
+		destinations[dlq] = struct{}{}
+	}
 	_, pinfos := parser.TranspileQueries(app.AppHandlers, "")
 	for _, pinfo := range pinfos {
 		if pinfo.PInfo.KeyspaceName != "" {
@@ -1001,6 +1085,25 @@ func populate(fmtStr, appName, key string, stats []byte, cStats map[string]inter
 	return append(stats, []byte(str)...)
 }
 
+// populateHistogram renders a histogram as cumulative _bucket series per upper bound,
+// followed by _sum and _count as per Prometheus text exposition format
+func populateHistogram(appName, key string, stats []byte, h *common.Histogram) []byte {
+	bucketFmtStr := "%v%v_bucket{functionName=\"%v\",le=\"%v\"} %v\n"
+	fmtStr := "%v%v{functionName=\"%v\"} %v\n"
+
+	if h == nil {
+		h = &common.Histogram{}
+	}
+
+	for i, bound := range h.BoundsMs {
+		str := fmt.Sprintf(bucketFmtStr, METRICS_PREFIX, key, appName, bound, h.Counts[i])
+		stats = append(stats, []byte(str)...)
+	}
+	stats = append(stats, []byte(fmt.Sprintf(bucketFmtStr, METRICS_PREFIX, key, appName, "+Inf", h.Count))...)
+	stats = append(stats, []byte(fmt.Sprintf(fmtStr, METRICS_PREFIX, key+"_sum", appName, h.SumMs))...)
+	return append(stats, []byte(fmt.Sprintf(fmtStr, METRICS_PREFIX, key+"_count", appName, h.Count))...)
+}
+
 func populateUint(fmtStr, appName, key string, stats []byte, cStats map[string]uint64) []byte {
 	var str string
 	if val, ok := cStats[key]; ok {
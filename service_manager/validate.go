@@ -0,0 +1,108 @@
+package servicemanager
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+
+	"github.com/couchbase/eventing/common"
+	"github.com/couchbase/eventing/consumer"
+	"github.com/couchbase/eventing/logging"
+	"github.com/couchbase/eventing/parser"
+	"github.com/couchbase/eventing/util"
+)
+
+// compileAppCode compiles handler code of the function on a throwaway C++ v8 worker,
+// honouring its handler headers, footers and n1ql consistency
+func (m *ServiceMgr) compileAppCode(app *application, appContent []byte) (*common.CompileStatus, error) {
+	c := &consumer.Consumer{}
+	var handlerHeaders []string
+	if headers, exists := app.Settings["handler_headers"]; exists {
+		handlerHeaders = util.ToStringArray(headers)
+	} else {
+		handlerHeaders = common.GetDefaultHandlerHeaders()
+	}
+
+	var n1qlParams string
+	if consistency, exists := app.Settings["n1ql_consistency"]; exists {
+		n1qlParams = "{ 'consistency': '" + consistency.(string) + "' }"
+	}
+	parsedCode, _ := parser.TranspileQueries(app.AppHandlers, n1qlParams)
+
+	handlerFooters := util.ToStringArray(app.Settings["handler_footers"])
+	return c.SpawnCompilationWorker(parsedCode, string(appContent), app.Name, m.adminHTTPPort,
+		handlerHeaders, handlerFooters)
+}
+
+// validateAppCode serves POST /api/v1/functions/{name}/validate. Handler code in request
+// body, or the saved code of the function if body is empty, is compiled without being
+// saved or deployed. Settings of the function are used if it exists
+func (m *ServiceMgr) validateAppCode(w http.ResponseWriter, r *http.Request, appName string) {
+	logPrefix := "ServiceMgr::validateAppCode"
+
+	info := &runtimeInfo{}
+
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		info.Code = m.statusCodes.errReadReq.Code
+		info.Info = fmt.Sprintf("Failed to read request body, err: %v", err)
+		logging.Errorf("%s %s", logPrefix, info.Info)
+		m.sendErrorInfo(w, info)
+		return
+	}
+
+	app, tempInfo := m.getTempStore(appName)
+	switch tempInfo.Code {
+	case m.statusCodes.ok.Code:
+	case m.statusCodes.errAppNotFoundTs.Code:
+		if len(data) == 0 {
+			m.sendErrorInfo(w, tempInfo)
+			return
+		}
+		app = application{Name: appName, Settings: make(map[string]interface{})}
+	default:
+		m.sendErrorInfo(w, tempInfo)
+		return
+	}
+
+	if len(data) != 0 {
+		app.AppHandlers = string(data)
+	}
+
+	preparedApp, _ := applicationAdapter(&app)
+	appContent := util.EncodeAppPayload(&preparedApp)
+
+	compileInfo, err := m.compileAppCode(&app, appContent)
+	if err != nil {
+		info.Code = m.statusCodes.errRequestedOpFailed.Code
+		info.Info = fmt.Sprintf("Function: %s failed to spawn compilation worker, err: %v", appName, err)
+		logging.Errorf("%s %s", logPrefix, info.Info)
+		m.sendErrorInfo(w, info)
+		return
+	}
+
+	if !compileInfo.CompileSuccess {
+		info.Code = m.statusCodes.errHandlerCompile.Code
+		info.Info = compileInfo
+		m.sendErrorInfo(w, info)
+		return
+	}
+
+	response, err := json.MarshalIndent(compileInfo, "", " ")
+	if err != nil {
+		info.Code = m.statusCodes.errMarshalResp.Code
+		info.Info = fmt.Sprintf("Failed to marshal compilation status, err: %v", err)
+		m.sendErrorInfo(w, info)
+		return
+	}
+
+	w.Header().Add(headerKey, strconv.Itoa(m.statusCodes.ok.Code))
+	fmt.Fprintf(w, "%s", string(response))
+}
@@ -1,6 +1,7 @@
 package servicemanager
 
 import (
+	"encoding/json"
 	"fmt"
 	"math"
 	"net"
@@ -54,6 +55,13 @@ func (m *ServiceMgr) validateAppRecursion(app *application) (info *runtimeInfo)
 	}
 
 	source, destinations := m.getSourceAndDestinationsFromDepCfg(&app.DeploymentConfig)
+	if info = m.validateDeadLetterSource(app); info.Code != m.statusCodes.ok.Code {
+		return
+	}
+	if dlq, ok := deadLetterKeyspace(app.Settings); ok {
+		destinations[dlq] = struct{}{}
+	}
+
 	_, pinfos := parser.TranspileQueries(app.AppHandlers, "")
 
 	// Prevent deployment of handler with N1QL writing to source
@@ -109,6 +117,10 @@ func (m *ServiceMgr) validateApplication(app *application) (info *runtimeInfo) {
 		return
 	}
 
+	if info = m.validateDependencies(app); info.Code != m.statusCodes.ok.Code {
+		return
+	}
+
 	if info = m.validateNonEmpty(app.AppHandlers, "Function handler"); info.Code != m.statusCodes.ok.Code {
 		return
 	}
@@ -117,6 +129,10 @@ func (m *ServiceMgr) validateApplication(app *application) (info *runtimeInfo) {
 		return
 	}
 
+	if info = m.validateDeadLetterSource(app); info.Code != m.statusCodes.ok.Code {
+		return
+	}
+
 	if val, ok := app.Settings["processing_status"].(bool); ok && val {
 		if info = m.validateAppRecursion(app); info.Code != m.statusCodes.ok.Code {
 			logging.Errorf("%s Function: %s recursion error %d: %s", logPrefix, app.Name, info.Code, info.Info)
@@ -342,6 +358,10 @@ func (m *ServiceMgr) validateConfig(c map[string]interface{}) (info *runtimeInfo
 		return
 	}
 
+	if info = m.validateNonNegativeInteger("debugger_session_ttl", c); info.Code != m.statusCodes.ok.Code {
+		return
+	}
+
 	if info = m.validatePositiveInteger("ram_quota", c); info.Code != m.statusCodes.ok.Code {
 		return
 	}
@@ -358,6 +378,27 @@ func (m *ServiceMgr) validateConfig(c map[string]interface{}) (info *runtimeInfo
 		return
 	}
 
+	if info = m.validateNonNegativeInteger("max_concurrent_vb_takeovers", c); info.Code != m.statusCodes.ok.Code {
+		return
+	}
+
+	if info = m.validateNonNegativeInteger("memory_soft_limit", c); info.Code != m.statusCodes.ok.Code {
+		return
+	}
+
+	if info = m.validateNonNegativeInteger("app_log_max_total_size", c); info.Code != m.statusCodes.ok.Code {
+		return
+	}
+
+	if info = m.validateBoolean("strict_settings_validation", true, c); info.Code != m.statusCodes.ok.Code {
+		return
+	}
+
+	if info = m.validatePossibleValues("duplicate_function_check", c,
+		[]string{duplicateCheckOff, duplicateCheckWarn, duplicateCheckBlock}); info.Code != m.statusCodes.ok.Code {
+		return
+	}
+
 	if info = m.validateBoolean("enable_lifecycle_ops_during_rebalance", true, c); info.Code != m.statusCodes.ok.Code {
 		return
 	}
@@ -378,6 +419,19 @@ func (m *ServiceMgr) validateConfig(c map[string]interface{}) (info *runtimeInfo
 		return
 	}
 
+	if info = m.validateStringArray("maintenance_nodes", c); info.Code != m.statusCodes.ok.Code {
+		return
+	}
+
+	if info = m.validateBoolean("sticky_vb_assignment", true, c); info.Code != m.statusCodes.ok.Code {
+		return
+	}
+
+	vbAssignmentWeightValues := []string{util.VbAssignmentWeightNone, util.VbAssignmentWeightCPU, util.VbAssignmentWeightMemory}
+	if info = m.validatePossibleValues("vb_assignment_weight", c, vbAssignmentWeightValues); info.Code != m.statusCodes.ok.Code {
+		return
+	}
+
 	info.Code = m.statusCodes.ok.Code
 	return
 }
@@ -448,6 +502,14 @@ func (m *ServiceMgr) validateDeploymentConfig(deploymentConfig *depCfg) (info *r
 		return
 	}
 
+	if info = m.validateSourceCollections(deploymentConfig); info.Code != m.statusCodes.ok.Code {
+		return
+	}
+
+	if info = m.validateKeyFilters(deploymentConfig); info.Code != m.statusCodes.ok.Code {
+		return
+	}
+
 	aliasSet := make(map[string]struct{})
 	if info = m.validateBucketBindings(deploymentConfig.Buckets, aliasSet); info.Code != m.statusCodes.ok.Code {
 		return
@@ -465,6 +527,162 @@ func (m *ServiceMgr) validateDeploymentConfig(deploymentConfig *depCfg) (info *r
 	return
 }
 
+// validateSourceCollections checks that collections listed in source_collections exist in
+// source scope, are listed once and aren't the metadata collection
+func (m *ServiceMgr) validateSourceCollections(deploymentConfig *depCfg) (info *runtimeInfo) {
+	info = &runtimeInfo{}
+
+	sourceScope := common.CheckAndReturnDefaultForScopeOrCollection(deploymentConfig.SourceScope)
+	metadataKeyspace := common.Keyspace{BucketName: deploymentConfig.MetadataBucket,
+		ScopeName:      common.CheckAndReturnDefaultForScopeOrCollection(deploymentConfig.MetadataScope),
+		CollectionName: common.CheckAndReturnDefaultForScopeOrCollection(deploymentConfig.MetadataCollection)}
+
+	collections := map[string]struct{}{
+		common.CheckAndReturnDefaultForScopeOrCollection(deploymentConfig.SourceCollection): struct{}{},
+	}
+	for _, collection := range deploymentConfig.SourceCollections {
+		collection = common.CheckAndReturnDefaultForScopeOrCollection(collection)
+		if _, ok := collections[collection]; ok {
+			info.Code = m.statusCodes.errInvalidConfig.Code
+			info.Info = fmt.Sprintf("source_collections: %s listed more than once or same as source collection", collection)
+			return
+		}
+		collections[collection] = struct{}{}
+
+		keyspace := common.Keyspace{BucketName: deploymentConfig.SourceBucket, ScopeName: sourceScope, CollectionName: collection}
+		if keyspace == metadataKeyspace {
+			info.Code = m.statusCodes.errSrcMbSame.Code
+			info.Info = fmt.Sprintf("source_collections: %s same as metadata keyspace", collection)
+			return
+		}
+
+		if info = m.validateKeyspaceExists(deploymentConfig.SourceBucket, sourceScope, collection); info.Code != m.statusCodes.ok.Code {
+			return
+		}
+	}
+
+	info.Code = m.statusCodes.ok.Code
+	return
+}
+
+// validateKeyFilters checks that key_prefixes and key_patterns hold no empty or repeated
+// entries, and that each of key_patterns compiles as a regex
+func (m *ServiceMgr) validateKeyFilters(deploymentConfig *depCfg) (info *runtimeInfo) {
+	info = &runtimeInfo{}
+	info.Code = m.statusCodes.errInvalidConfig.Code
+
+	prefixes := make(map[string]struct{})
+	for _, prefix := range deploymentConfig.KeyPrefixes {
+		if prefix == "" {
+			info.Info = "key_prefixes can't hold an empty prefix"
+			return
+		}
+		if _, ok := prefixes[prefix]; ok {
+			info.Info = fmt.Sprintf("key_prefixes: %s listed more than once", prefix)
+			return
+		}
+		prefixes[prefix] = struct{}{}
+	}
+
+	patterns := make(map[string]struct{})
+	for _, pattern := range deploymentConfig.KeyPatterns {
+		if pattern == "" {
+			info.Info = "key_patterns can't hold an empty pattern"
+			return
+		}
+		if _, ok := patterns[pattern]; ok {
+			info.Info = fmt.Sprintf("key_patterns: %s listed more than once", pattern)
+			return
+		}
+		patterns[pattern] = struct{}{}
+
+		if _, err := regexp.Compile(pattern); err != nil {
+			info.Info = fmt.Sprintf("key_patterns: %s isn't a valid regex, err: %v", pattern, err)
+			return
+		}
+	}
+
+	info.Code = m.statusCodes.ok.Code
+	return
+}
+
+// validateDependencies checks that depends_on names other functions, each only once, and
+// that together with depends_on of functions already saved it doesn't form a cycle
+func (m *ServiceMgr) validateDependencies(app *application) (info *runtimeInfo) {
+	info = &runtimeInfo{}
+	info.Code = m.statusCodes.errInvalidConfig.Code
+
+	if len(app.DeploymentConfig.DependsOn) == 0 {
+		info.Code = m.statusCodes.ok.Code
+		return
+	}
+
+	dependencies := make(map[string]struct{})
+	for _, dependency := range app.DeploymentConfig.DependsOn {
+		if dependency == "" {
+			info.Info = "depends_on can't hold an empty function name"
+			return
+		}
+		if dependency == app.Name {
+			info.Info = fmt.Sprintf("depends_on: function %s can't depend on itself", dependency)
+			return
+		}
+		if _, ok := dependencies[dependency]; ok {
+			info.Info = fmt.Sprintf("depends_on: %s listed more than once", dependency)
+			return
+		}
+		dependencies[dependency] = struct{}{}
+	}
+
+	graph := make(map[string][]string)
+	for _, savedApp := range m.getTempStoreAll() {
+		graph[savedApp.Name] = savedApp.DeploymentConfig.DependsOn
+	}
+	graph[app.Name] = app.DeploymentConfig.DependsOn
+
+	if cycle := findDependencyCycle(app.Name, graph); len(cycle) != 0 {
+		info.Code = m.statusCodes.errDependencyCycle.Code
+		info.Info = fmt.Sprintf("depends_on: functions form a cycle: %s", strings.Join(cycle, " -> "))
+		return
+	}
+
+	info.Code = m.statusCodes.ok.Code
+	return
+}
+
+// findDependencyCycle returns the functions on a dependency path leading from appName
+// back to itself, nil if there's no such path
+func findDependencyCycle(appName string, graph map[string][]string) []string {
+	visited := make(map[string]struct{})
+	path := []string{appName}
+
+	var walk func(node string) bool
+	walk = func(node string) bool {
+		for _, next := range graph[node] {
+			if next == appName {
+				path = append(path, next)
+				return true
+			}
+			if _, ok := visited[next]; ok {
+				continue
+			}
+			visited[next] = struct{}{}
+
+			path = append(path, next)
+			if walk(next) {
+				return true
+			}
+			path = path[:len(path)-1]
+		}
+		return false
+	}
+
+	if walk(appName) {
+		return path
+	}
+	return nil
+}
+
 func (m *ServiceMgr) validateBucketBindings(bindings []bucket, existingAliases map[string]struct{}) (info *runtimeInfo) {
 	info = &runtimeInfo{}
 	info.Code = m.statusCodes.errInvalidConfig.Code
@@ -495,6 +713,20 @@ func (m *ServiceMgr) validateBucketBindings(bindings []bucket, existingAliases m
 		if info = m.validateBucketAccess(binding.Access); info.Code != m.statusCodes.ok.Code {
 			return
 		}
+
+		if binding.Durability != "" {
+			if !util.Contains(binding.Durability, []string{"none", "majority", "majority_and_persist_active", "persist_to_majority"}) {
+				info.Info = fmt.Sprintf(`Bucket alias %s has invalid value for "durability"`, binding.Alias)
+				info.Code = m.statusCodes.errInvalidConfig.Code
+				return
+			}
+
+			if binding.Durability != "none" && binding.Access == "r" {
+				info.Info = fmt.Sprintf(`Bucket alias %s is read only, "durability" isn't applicable`, binding.Alias)
+				info.Code = m.statusCodes.errInvalidConfig.Code
+				return
+			}
+		}
 	}
 
 	info.Code = m.statusCodes.ok.Code
@@ -837,10 +1069,119 @@ func (m *ServiceMgr) validateTimerPartitions(field string, settings map[string]i
 	return
 }
 
+// validateDeadLetterKeyspace checks that dead letter keyspace, if configured, exists.
+// Scope and collection default to _default when only bucket is specified
+func (m *ServiceMgr) validateDeadLetterKeyspace(settings map[string]interface{}) (info *runtimeInfo) {
+	info = &runtimeInfo{}
+	info.Code = m.statusCodes.errInvalidConfig.Code
+
+	keyspace := make(map[string]string)
+	for _, field := range []string{"dead_letter_bucket", "dead_letter_scope", "dead_letter_collection"} {
+		if val, ok := settings[field]; ok {
+			valStr, isStr := val.(string)
+			if !isStr {
+				info.Info = fmt.Sprintf("%s must be a string", field)
+				return
+			}
+			keyspace[field] = valStr
+		}
+	}
+
+	if keyspace["dead_letter_bucket"] == "" {
+		if keyspace["dead_letter_scope"] != "" || keyspace["dead_letter_collection"] != "" {
+			info.Info = "dead_letter_bucket must be specified along with dead_letter_scope and dead_letter_collection"
+			return
+		}
+		info.Code = m.statusCodes.ok.Code
+		return
+	}
+
+	return m.validateKeyspaceExists(keyspace["dead_letter_bucket"],
+		common.CheckAndReturnDefaultForScopeOrCollection(keyspace["dead_letter_scope"]),
+		common.CheckAndReturnDefaultForScopeOrCollection(keyspace["dead_letter_collection"]))
+}
+
+// validateDeadLetterSource rejects dead letter keyspace same as source keyspace, as
+// every dead lettered mutation would be fed back to the function
+func (m *ServiceMgr) validateDeadLetterSource(app *application) (info *runtimeInfo) {
+	info = &runtimeInfo{}
+	info.Code = m.statusCodes.ok.Code
+
+	dlq, ok := deadLetterKeyspace(app.Settings)
+	if !ok {
+		return
+	}
+
+	source := common.Keyspace{BucketName: app.DeploymentConfig.SourceBucket,
+		ScopeName:      common.CheckAndReturnDefaultForScopeOrCollection(app.DeploymentConfig.SourceScope),
+		CollectionName: common.CheckAndReturnDefaultForScopeOrCollection(app.DeploymentConfig.SourceCollection),
+	}
+	if dlq == source {
+		info.Code = m.statusCodes.errInterBucketRecursion.Code
+		info.Info = fmt.Sprintf("Function: %s dead letter keyspace can't be same as source keyspace", app.Name)
+	}
+	return
+}
+
+// validateRetryOn checks that retry_on lists only known kinds of handler failures
+func (m *ServiceMgr) validateRetryOn(settings map[string]interface{}) (info *runtimeInfo) {
+	if info = m.validateStringArray("retry_on", settings); info.Code != m.statusCodes.ok.Code {
+		return
+	}
+	info.Code = m.statusCodes.errInvalidConfig.Code
+
+	if val, ok := settings["retry_on"]; ok {
+		for _, kind := range val.([]interface{}) {
+			if !util.Contains(kind.(string), common.RetryOnKinds) {
+				info.Info = fmt.Sprintf("Invalid value %s in retry_on, possible values are %s",
+					kind, strings.Join(common.RetryOnKinds, ", "))
+				return
+			}
+		}
+	}
+
+	info.Code = m.statusCodes.ok.Code
+	return
+}
+
+// validateRetryBackoff bounds handler retries. Worker backs off between retries on the
+// thread processing events, so retries of an event taken together mustn't take longer
+// than execution_timeout
+func (m *ServiceMgr) validateRetryBackoff(settings map[string]interface{}) (info *runtimeInfo) {
+	info = &runtimeInfo{}
+	info.Code = m.statusCodes.errInvalidConfig.Code
+
+	retries := 0
+	for _, field := range []string{"retry_count", "dead_letter_retry_count"} {
+		count := int(settings[field].(float64))
+		if count > maxHandlerRetryCount {
+			info.Info = fmt.Sprintf("%s must not be more than %d", field, maxHandlerRetryCount)
+			return
+		}
+		if count > retries {
+			retries = count
+		}
+	}
+
+	backoff := int(settings["retry_backoff"].(float64))
+	executionTimeout := int(settings["execution_timeout"].(float64))
+	if retries*backoff > executionTimeout*1000 {
+		info.Info = fmt.Sprintf("Total retry backoff of %d ms must not be more than execution_timeout", retries*backoff)
+		return
+	}
+
+	info.Code = m.statusCodes.ok.Code
+	return
+}
+
 func (m *ServiceMgr) validateSettings(appName string, settings map[string]interface{}) (info *runtimeInfo) {
 	info = &runtimeInfo{}
 	info.Code = m.statusCodes.errInvalidConfig.Code
 
+	if info = m.validateUnknownSettings(appName, settings); info.Code != m.statusCodes.ok.Code {
+		return
+	}
+
 	m.fillMissingWithDefaults(appName, settings)
 
 	// Handler related configurations
@@ -852,6 +1193,22 @@ func (m *ServiceMgr) validateSettings(appName string, settings map[string]interf
 		return
 	}
 
+	if info = m.validateBoolean("include_xattrs", true, settings); info.Code != m.statusCodes.ok.Code {
+		return
+	}
+
+	if info = m.validateBoolean("skip_binary_docs", true, settings); info.Code != m.statusCodes.ok.Code {
+		return
+	}
+
+	if info = m.validateBoolean("worker_frame_checksums", true, settings); info.Code != m.statusCodes.ok.Code {
+		return
+	}
+
+	if info = m.validateBoolean("origin_tagging", true, settings); info.Code != m.statusCodes.ok.Code {
+		return
+	}
+
 	if info = m.validatePossibleValues("language_compatibility", settings, common.LanguageCompatibility); info.Code != m.statusCodes.ok.Code {
 		return
 	}
@@ -868,6 +1225,14 @@ func (m *ServiceMgr) validateSettings(appName string, settings map[string]interf
 		return
 	}
 
+	if info = m.validatePositiveInteger("builder_pool_size", settings); info.Code != m.statusCodes.ok.Code {
+		return
+	}
+
+	if info = m.validateNonNegativeInteger("builder_initial_capacity", settings); info.Code != m.statusCodes.ok.Code {
+		return
+	}
+
 	if info = m.validatePositiveInteger("checkpoint_interval", settings); info.Code != m.statusCodes.ok.Code {
 		return
 	}
@@ -905,15 +1270,104 @@ func (m *ServiceMgr) validateSettings(appName string, settings map[string]interf
 		return
 	}
 
+	if info = m.validateStringArray("subscribe_topics", settings); info.Code != m.statusCodes.ok.Code {
+		return
+	}
+
 	if info = m.validatePositiveInteger("idle_checkpoint_interval", settings); info.Code != m.statusCodes.ok.Code {
 		return
 	}
 
+	if info = m.validateNonNegativeInteger("checkpoint_batch_interval", settings); info.Code != m.statusCodes.ok.Code {
+		return
+	}
+
 	logLevelValues := []string{"INFO", "ERROR", "WARNING", "DEBUG", "TRACE"}
 	if info = m.validatePossibleValues("log_level", settings, logLevelValues); info.Code != m.statusCodes.ok.Code {
 		return
 	}
 
+	if info = m.validateNonNegativeInteger("max_doc_size_bytes", settings); info.Code != m.statusCodes.ok.Code {
+		return
+	}
+
+	maxDocSizeModeValues := []string{common.MaxDocSizeModeSkip, common.MaxDocSizeModeMetadataOnly}
+	if info = m.validatePossibleValues("max_doc_size_mode", settings, maxDocSizeModeValues); info.Code != m.statusCodes.ok.Code {
+		return
+	}
+
+	if info = m.validateBoolean("max_doc_size_log", true, settings); info.Code != m.statusCodes.ok.Code {
+		return
+	}
+
+	deliveryGuaranteeValues := []string{common.DeliveryBestEffort, common.DeliveryAtLeastOnce}
+	if info = m.validatePossibleValues("delivery_guarantee", settings, deliveryGuaranteeValues); info.Code != m.statusCodes.ok.Code {
+		return
+	}
+
+	timerIntegrityValues := []string{common.TimerIntegrityOff, common.TimerIntegritySkip, common.TimerIntegrityRepair}
+	if info = m.validatePossibleValues("timer_integrity_check", settings, timerIntegrityValues); info.Code != m.statusCodes.ok.Code {
+		return
+	}
+
+	workerIPCValues := []string{common.WorkerIPCAuto, common.WorkerIPCTCP, common.WorkerIPCUnix}
+	if info = m.validatePossibleValues("worker_ipc_type", settings, workerIPCValues); info.Code != m.statusCodes.ok.Code {
+		return
+	}
+
+	if info = m.validateNonNegativeInteger("dead_letter_retry_count", settings); info.Code != m.statusCodes.ok.Code {
+		return
+	}
+
+	if info = m.validateDeadLetterKeyspace(settings); info.Code != m.statusCodes.ok.Code {
+		return
+	}
+
+	if info = m.validateNonNegativeInteger("retry_count", settings); info.Code != m.statusCodes.ok.Code {
+		return
+	}
+
+	if info = m.validateNonNegativeInteger("retry_backoff", settings); info.Code != m.statusCodes.ok.Code {
+		return
+	}
+
+	if info = m.validateRetryOn(settings); info.Code != m.statusCodes.ok.Code {
+		return
+	}
+
+	if info = m.validateRetryBackoff(settings); info.Code != m.statusCodes.ok.Code {
+		return
+	}
+
+	if info = m.validateBoolean("strict_order_check", true, settings); info.Code != m.statusCodes.ok.Code {
+		return
+	}
+
+	if info = m.validateBoolean("use_bootstrap_dcp_connections", true, settings); info.Code != m.statusCodes.ok.Code {
+		return
+	}
+
+	if info = m.validateNonNegativeInteger("bootstrap_dcp_backfill_threshold", settings); info.Code != m.statusCodes.ok.Code {
+		return
+	}
+
+	dcpPriorityValues := []string{"low", "medium", "high"}
+	if info = m.validatePossibleValues("bootstrap_dcp_priority", settings, dcpPriorityValues); info.Code != m.statusCodes.ok.Code {
+		return
+	}
+
+	if info = m.validateStringArray("prefetch_key_patterns", settings); info.Code != m.statusCodes.ok.Code {
+		return
+	}
+
+	if info = m.validateStringMustExist("prefetch_key_separator", 16, settings); info.Code != m.statusCodes.ok.Code {
+		return
+	}
+
+	if info = m.validateNonNegativeInteger("debugger_replay_events", settings); info.Code != m.statusCodes.ok.Code {
+		return
+	}
+
 	if info = m.validatePositiveInteger("poll_bucket_interval", settings); info.Code != m.statusCodes.ok.Code {
 		return
 	}
@@ -922,6 +1376,14 @@ func (m *ServiceMgr) validateSettings(appName string, settings map[string]interf
 		return
 	}
 
+	if info = m.validatePositiveInteger("timer_lane_batch_size", settings); info.Code != m.statusCodes.ok.Code {
+		return
+	}
+
+	if info = m.validatePositiveInteger("dcp_lane_batch_size", settings); info.Code != m.statusCodes.ok.Code {
+		return
+	}
+
 	if info = m.validatePositiveInteger("timer_context_size", settings); info.Code != m.statusCodes.ok.Code {
 		return
 	}
@@ -950,10 +1412,46 @@ func (m *ServiceMgr) validateSettings(appName string, settings map[string]interf
 		return
 	}
 
+	if info = m.validatePositiveInteger("worker_queue_high_watermark", settings); info.Code != m.statusCodes.ok.Code {
+		return
+	}
+
+	if info = m.validatePositiveInteger("worker_queue_low_watermark", settings); info.Code != m.statusCodes.ok.Code {
+		return
+	}
+
+	if info = m.validateLessThan("worker_queue_low_watermark", "worker_queue_high_watermark", 1, settings); info.Code != m.statusCodes.ok.Code {
+		return
+	}
+
 	if info = m.validatePositiveInteger("worker_response_timeout", settings); info.Code != m.statusCodes.ok.Code {
 		return
 	}
 
+	if info = m.validateNonNegativeInteger("worker_rss_limit", settings); info.Code != m.statusCodes.ok.Code {
+		return
+	}
+
+	if info = m.validateNonNegativeInteger("worker_cpu_limit", settings); info.Code != m.statusCodes.ok.Code {
+		return
+	}
+
+	if info = m.validateNonNegativeInteger("dcp_throughput_quota", settings); info.Code != m.statusCodes.ok.Code {
+		return
+	}
+
+	if info = m.validateNonNegativeInteger("cpp_thread_quota", settings); info.Code != m.statusCodes.ok.Code {
+		return
+	}
+
+	if info = m.validateNonNegativeInteger("metadata_latency_inject_percent", settings); info.Code != m.statusCodes.ok.Code {
+		return
+	}
+
+	if info = m.validateNonNegativeInteger("metadata_latency_inject_ms", settings); info.Code != m.statusCodes.ok.Code {
+		return
+	}
+
 	if info = m.validatePositiveInteger("timer_queue_mem_cap", settings); info.Code != m.statusCodes.ok.Code {
 		return
 	}
@@ -983,6 +1481,38 @@ func (m *ServiceMgr) validateSettings(appName string, settings map[string]interf
 		return
 	}
 
+	if info = m.validateBoolean("auto_tune_vb_takeover_routines", true, settings); info.Code != m.statusCodes.ok.Code {
+		return
+	}
+
+	if info = m.validatePositiveInteger("vb_takeover_routine_min_count", settings); info.Code != m.statusCodes.ok.Code {
+		return
+	}
+
+	if info = m.validatePositiveInteger("vb_takeover_routine_max_count", settings); info.Code != m.statusCodes.ok.Code {
+		return
+	}
+
+	if minCount, ok := settings["vb_takeover_routine_min_count"]; ok {
+		if maxCount, ok := settings["vb_takeover_routine_max_count"]; ok && minCount.(float64) > maxCount.(float64) {
+			info.Code = m.statusCodes.errInvalidConfig.Code
+			info.Info = "vb_takeover_routine_min_count can not be greater than vb_takeover_routine_max_count"
+			return
+		}
+	}
+
+	if info = m.validateNonNegativeInteger("vb_takeover_deadline", settings); info.Code != m.statusCodes.ok.Code {
+		return
+	}
+
+	if info = m.validateBoolean("vb_force_takeover", true, settings); info.Code != m.statusCodes.ok.Code {
+		return
+	}
+
+	if info = m.validateNonNegativeInteger("vb_handover_linger_timeout", settings); info.Code != m.statusCodes.ok.Code {
+		return
+	}
+
 	// Application logging related configurations
 	if info = m.validateDirPath("app_log_dir", settings); info.Code != m.statusCodes.ok.Code {
 		return
@@ -1021,6 +1551,10 @@ func (m *ServiceMgr) validateSettings(appName string, settings map[string]interf
 		return
 	}
 
+	if info = m.validatePositiveInteger("dcp_noop_interval", settings); info.Code != m.statusCodes.ok.Code {
+		return
+	}
+
 	// N1QL related configuration
 	if info = m.validatePossibleValues("n1ql_consistency", settings, m.consistencyValues); info.Code != m.statusCodes.ok.Code {
 		return
@@ -1030,6 +1564,16 @@ func (m *ServiceMgr) validateSettings(appName string, settings map[string]interf
 		return
 	}
 
+	if info = m.validateNonNegativeInteger("n1ql_timeout", settings); info.Code != m.statusCodes.ok.Code {
+		return
+	}
+
+	if timeout, ok := settings["n1ql_timeout"].(float64); ok && timeout > 0 {
+		if info = m.validateLessThan("n1ql_timeout", "execution_timeout", 1, settings); info.Code != m.statusCodes.ok.Code {
+			return
+		}
+	}
+
 	// libcouchbase configurations
 	if info = m.validatePositiveInteger("lcb_timeout", settings); info.Code != m.statusCodes.ok.Code {
 		return
@@ -1044,6 +1588,69 @@ func (m *ServiceMgr) validateSettings(appName string, settings map[string]interf
 		return
 	}
 
+	// Catches type mismatches and cross setting constraints that per setting checks above don't cover,
+	// so that producer never gets to see settings it can't parse
+	if info = m.validateTypedSettings(settings); info.Code != m.statusCodes.ok.Code {
+		return
+	}
+
+	info.Code = m.statusCodes.ok.Code
+	return
+}
+
+// validateUnknownSettings rejects settings eventing doesn't understand when strict_settings_validation
+// is enabled, otherwise they're only logged. Either way, likely intended setting is suggested for typos
+func (m *ServiceMgr) validateUnknownSettings(appName string, settings map[string]interface{}) (info *runtimeInfo) {
+	logPrefix := "ServiceMgr::validateUnknownSettings"
+
+	info = &runtimeInfo{}
+	info.Code = m.statusCodes.ok.Code
+
+	errs := common.UnknownSettings(settings)
+	if len(errs) == 0 {
+		return
+	}
+
+	if !m.isStrictSettingsValidation() {
+		logging.Warnf("%s Function: %s ignoring %v", logPrefix, appName, errs)
+		return
+	}
+
+	info.Code = m.statusCodes.errInvalidConfig.Code
+	info.Info = errs
+	return
+}
+
+func (m *ServiceMgr) isStrictSettingsValidation() bool {
+	config, info := m.getConfig()
+	if info.Code != m.statusCodes.ok.Code {
+		return false
+	}
+
+	strict, ok := config["strict_settings_validation"].(bool)
+	return ok && strict
+}
+
+func (m *ServiceMgr) validateTypedSettings(settings map[string]interface{}) (info *runtimeInfo) {
+	info = &runtimeInfo{}
+	info.Code = m.statusCodes.errInvalidConfig.Code
+
+	data, err := json.Marshal(settings)
+	if err != nil {
+		info.Info = fmt.Sprintf("Failed to marshal settings, err: %v", err)
+		return
+	}
+
+	_, err = common.ParseHandlerSettings(data)
+	if err != nil {
+		if errs, ok := err.(common.SettingsErrors); ok {
+			info.Info = errs
+		} else {
+			info.Info = fmt.Sprintf("Failed to parse settings, err: %v", err)
+		}
+		return
+	}
+
 	info.Code = m.statusCodes.ok.Code
 	return
 }
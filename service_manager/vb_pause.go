@@ -0,0 +1,374 @@
+package servicemanager
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/couchbase/eventing/common"
+	"github.com/couchbase/eventing/logging"
+	"github.com/couchbase/eventing/util"
+)
+
+// vbPauseResult captures outcome of pausing or resuming vbs of a function across eventing nodes
+type vbPauseResult struct {
+	FunctionName string                       `json:"function_name"`
+	Vbs          []uint16                     `json:"vbs"`
+	NodePaused   map[string]*common.PausedVbs `json:"node_paused_vbs"`
+	NodeErrors   map[string]string            `json:"node_errors,omitempty"`
+}
+
+// parseVbList parses comma separated list of vbs e.g. "1,5,9"
+func parseVbList(vbList string) ([]uint16, error) {
+	vbs := make([]uint16, 0)
+	for _, field := range strings.Split(vbList, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+
+		vb, err := strconv.ParseUint(field, 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid vb: %s", field)
+		}
+		vbs = append(vbs, uint16(vb))
+	}
+
+	if len(vbs) == 0 {
+		return nil, fmt.Errorf("no vbs specified")
+	}
+	return vbs, nil
+}
+
+// pauseVbuckets serves /pauseVbuckets?name=X&vbs=1,5,9, stopping processing of given
+// vbs on every eventing node so that they stay paused across rebalances
+func (m *ServiceMgr) pauseVbuckets(w http.ResponseWriter, r *http.Request) {
+	m.changeVbucketsPause(w, r, true)
+}
+
+// resumeVbuckets serves /resumeVbuckets?name=X&vbs=1,5,9, restreaming paused vbs
+// from their checkpoints
+func (m *ServiceMgr) resumeVbuckets(w http.ResponseWriter, r *http.Request) {
+	m.changeVbucketsPause(w, r, false)
+}
+
+func (m *ServiceMgr) changeVbucketsPause(w http.ResponseWriter, r *http.Request, pause bool) {
+	logPrefix := "ServiceMgr::changeVbucketsPause"
+
+	if !m.validateAuth(w, r, EventingPermissionManage) {
+		return
+	}
+
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	appName, vbs, ok := m.parseVbPauseParams(w, r)
+	if !ok {
+		return
+	}
+
+	if !m.checkIfDeployed(appName) {
+		w.Header().Add(headerKey, strconv.Itoa(m.statusCodes.errAppNotDeployed.Code))
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprintf(w, "Function: %s not deployed", appName)
+		return
+	}
+
+	logging.Infof("%s Function: %s pause: %t vbs: %s", logPrefix, appName, pause, util.Condense(vbs))
+
+	if err := m.persistPausedVbs(appName, vbs, pause); err != nil {
+		logging.Errorf("%s Function: %s failed to persist paused vbs, err: %v", logPrefix, appName, err)
+		w.Header().Add(headerKey, strconv.Itoa(m.statusCodes.errMetakvWriteFailed.Code))
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "Failed to persist paused vbs, err: %v", err)
+		return
+	}
+
+	result := m.fanoutVbucketsPause(appName, vbs, pause)
+
+	data, err := json.MarshalIndent(result, "", " ")
+	if err != nil {
+		w.Header().Add(headerKey, strconv.Itoa(m.statusCodes.errMarshalResp.Code))
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "Failed to marshal response, err: %v", err)
+		return
+	}
+
+	w.Header().Add(headerKey, strconv.Itoa(m.statusCodes.ok.Code))
+	fmt.Fprintf(w, "%v", string(data))
+}
+
+func (m *ServiceMgr) parseVbPauseParams(w http.ResponseWriter, r *http.Request) (string, []uint16, bool) {
+	values := r.URL.Query()
+	if len(values["name"]) == 0 {
+		w.Header().Add(headerKey, strconv.Itoa(m.statusCodes.errInvalidConfig.Code))
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Function name not specified")
+		return "", nil, false
+	}
+
+	vbs, err := parseVbList(values.Get("vbs"))
+	if err != nil {
+		w.Header().Add(headerKey, strconv.Itoa(m.statusCodes.errInvalidConfig.Code))
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Failed to parse vbs, err: %v", err)
+		return "", nil, false
+	}
+
+	return values["name"][0], vbs, true
+}
+
+// persistPausedVbs records pause state of vbs in metakv, so that eventing nodes that
+// come up or take over vbs later on keep them paused
+func (m *ServiceMgr) persistPausedVbs(appName string, vbs []uint16, pause bool) error {
+	paused := &common.PausedVbs{}
+	data, err := util.MetakvGet(common.MetakvPausedVbsPath + appName)
+	if err != nil {
+		return err
+	}
+
+	if len(data) > 0 {
+		if err = json.Unmarshal(data, paused); err != nil {
+			return err
+		}
+	}
+	if paused.PausedAt == nil {
+		paused.PausedAt = make(map[uint16]string)
+	}
+
+	pausedAt := time.Now().Format(time.RFC3339)
+	for _, vb := range vbs {
+		if !pause {
+			delete(paused.PausedAt, vb)
+			continue
+		}
+		if _, ok := paused.PausedAt[vb]; !ok {
+			paused.PausedAt[vb] = pausedAt
+		}
+	}
+
+	paused.Vbs = make([]uint16, 0, len(paused.PausedAt))
+	for vb := range paused.PausedAt {
+		paused.Vbs = append(paused.Vbs, vb)
+	}
+	sort.Sort(util.Uint16Slice(paused.Vbs))
+
+	data, err = json.Marshal(paused)
+	if err != nil {
+		return err
+	}
+	return util.MetakvSet(common.MetakvPausedVbsPath+appName, data, nil)
+}
+
+// fanoutVbucketsPause applies pause state on all eventing nodes, as any of them could
+// own the vbs post rebalance
+func (m *ServiceMgr) fanoutVbucketsPause(appName string, vbs []uint16, pause bool) *vbPauseResult {
+	logPrefix := "ServiceMgr::fanoutVbucketsPause"
+
+	result := &vbPauseResult{
+		FunctionName: appName,
+		Vbs:          vbs,
+		NodePaused:   make(map[string]*common.PausedVbs),
+	}
+
+	vbList := make([]string, 0, len(vbs))
+	for _, vb := range vbs {
+		vbList = append(vbList, strconv.Itoa(int(vb)))
+	}
+
+	util.Retry(util.NewFixedBackoff(time.Second), nil, getEventingNodesAddressesOpCallback, m)
+	netClient := util.CheckTLSandGetClient(util.HTTPRequestTimeout)
+
+	for _, nodeAddr := range m.eventingNodeAddrs {
+		url := util.CheckTLSandReplaceProtocol("http://%s/updateLocalPausedVbuckets?name=%s&vbs=%s&pause=%t",
+			nodeAddr, appName, strings.Join(vbList, ","), pause)
+
+		paused, err := requestPausedVbs(netClient, "POST", url)
+		if err != nil {
+			logging.Errorf("%s Function: %s failed to update paused vbs on node: %rs, err: %v",
+				logPrefix, appName, nodeAddr, err)
+			if result.NodeErrors == nil {
+				result.NodeErrors = make(map[string]string)
+			}
+			result.NodeErrors[nodeAddr] = err.Error()
+			continue
+		}
+		result.NodePaused[nodeAddr] = paused
+	}
+
+	return result
+}
+
+func requestPausedVbs(netClient *util.Client, method, url string) (*common.PausedVbs, error) {
+	var res *http.Response
+	var err error
+	if method == "POST" {
+		res, err = netClient.Post(url, "application/json", nil)
+	} else {
+		res, err = netClient.Get(url)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	buf, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code: %d, response: %s", res.StatusCode, string(buf))
+	}
+
+	var paused common.PausedVbs
+	err = json.Unmarshal(buf, &paused)
+	return &paused, err
+}
+
+// getPausedVbuckets returns vbs of the function paused on each eventing node
+func (m *ServiceMgr) getPausedVbuckets(w http.ResponseWriter, r *http.Request) {
+	logPrefix := "ServiceMgr::getPausedVbuckets"
+
+	if !m.validateAuth(w, r, EventingPermissionManage) {
+		return
+	}
+
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	values := r.URL.Query()
+	if len(values["name"]) == 0 {
+		w.Header().Add(headerKey, strconv.Itoa(m.statusCodes.errInvalidConfig.Code))
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Function name not specified")
+		return
+	}
+	appName := values["name"][0]
+
+	result := &vbPauseResult{
+		FunctionName: appName,
+		NodePaused:   make(map[string]*common.PausedVbs),
+	}
+
+	util.Retry(util.NewFixedBackoff(time.Second), nil, getEventingNodesAddressesOpCallback, m)
+	netClient := util.CheckTLSandGetClient(util.HTTPRequestTimeout)
+
+	for _, nodeAddr := range m.eventingNodeAddrs {
+		url := util.CheckTLSandReplaceProtocol("http://%s/getLocalPausedVbuckets?name=%s", nodeAddr, appName)
+
+		paused, err := requestPausedVbs(netClient, "GET", url)
+		if err != nil {
+			logging.Errorf("%s Function: %s failed to fetch paused vbs from node: %rs, err: %v",
+				logPrefix, appName, nodeAddr, err)
+			if result.NodeErrors == nil {
+				result.NodeErrors = make(map[string]string)
+			}
+			result.NodeErrors[nodeAddr] = err.Error()
+			continue
+		}
+		result.NodePaused[nodeAddr] = paused
+	}
+
+	data, err := json.MarshalIndent(result, "", " ")
+	if err != nil {
+		w.Header().Add(headerKey, strconv.Itoa(m.statusCodes.errMarshalResp.Code))
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "Failed to marshal response, err: %v", err)
+		return
+	}
+
+	w.Header().Add(headerKey, strconv.Itoa(m.statusCodes.ok.Code))
+	fmt.Fprintf(w, "%v", string(data))
+}
+
+// updateLocalPausedVbuckets pauses or resumes vbs of the function on this node
+func (m *ServiceMgr) updateLocalPausedVbuckets(w http.ResponseWriter, r *http.Request) {
+	if !m.validateAuth(w, r, EventingPermissionManage) {
+		return
+	}
+
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	appName, vbs, ok := m.parseVbPauseParams(w, r)
+	if !ok {
+		return
+	}
+
+	pause, err := strconv.ParseBool(r.URL.Query().Get("pause"))
+	if err != nil {
+		w.Header().Add(headerKey, strconv.Itoa(m.statusCodes.errInvalidConfig.Code))
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Failed to parse pause, err: %v", err)
+		return
+	}
+
+	if pause {
+		_, err = m.superSup.PauseVbs(appName, vbs)
+	} else {
+		_, err = m.superSup.ResumeVbs(appName, vbs)
+	}
+	if err != nil {
+		w.Header().Add(headerKey, strconv.Itoa(m.statusCodes.errAppNotDeployed.Code))
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprintf(w, "%v", err)
+		return
+	}
+
+	m.writePausedVbs(w, appName)
+}
+
+// getLocalPausedVbuckets returns vbs of the function paused on this node
+func (m *ServiceMgr) getLocalPausedVbuckets(w http.ResponseWriter, r *http.Request) {
+	if !m.validateAuth(w, r, EventingPermissionManage) {
+		return
+	}
+
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	values := r.URL.Query()
+	if len(values["name"]) == 0 {
+		w.Header().Add(headerKey, strconv.Itoa(m.statusCodes.errInvalidConfig.Code))
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Function name not specified")
+		return
+	}
+
+	m.writePausedVbs(w, values["name"][0])
+}
+
+func (m *ServiceMgr) writePausedVbs(w http.ResponseWriter, appName string) {
+	paused := m.superSup.GetPausedVbs(appName)
+	if paused == nil {
+		w.Header().Add(headerKey, strconv.Itoa(m.statusCodes.errAppNotDeployed.Code))
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprintf(w, "Function: %s not running", appName)
+		return
+	}
+
+	data, err := json.Marshal(paused)
+	if err != nil {
+		w.Header().Add(headerKey, strconv.Itoa(m.statusCodes.errMarshalResp.Code))
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "Failed to marshal paused vbs, err: %v", err)
+		return
+	}
+
+	w.Header().Add(headerKey, strconv.Itoa(m.statusCodes.ok.Code))
+	fmt.Fprintf(w, "%v", string(data))
+}
@@ -0,0 +1,65 @@
+package servicemanager
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/couchbase/eventing/logging"
+)
+
+// clampWorkerCounts caps worker_count at vbs an eventing node would own as per current
+// topology, and cpp_worker_thread_count at vbs each of those workers would own, so
+// that no worker process or thread is spawned without vbs to process. Settings are
+// updated in place, returns warnings for values clamped
+func (m *ServiceMgr) clampWorkerCounts(appName string, settings map[string]interface{}) []string {
+	logPrefix := "ServiceMgr::clampWorkerCounts"
+
+	nodeCount := len(m.eventingNodeAddrs)
+	if nodeCount == 0 {
+		nodeCount = 1
+	}
+	vbsPerNode := (m.superSup.NumVbuckets() + nodeCount - 1) / nodeCount
+	if vbsPerNode == 0 {
+		return nil
+	}
+
+	var warnings []string
+
+	workerCount, ok := settings["worker_count"].(float64)
+	if !ok || workerCount < 1 {
+		return nil
+	}
+	if int(workerCount) > vbsPerNode {
+		warnings = append(warnings, fmt.Sprintf("worker_count: %d exceeds vbuckets owned per eventing node: %d with %d eventing nodes, "+
+			"reduced to %d as additional workers would stay idle", int(workerCount), vbsPerNode, nodeCount, vbsPerNode))
+		workerCount = float64(vbsPerNode)
+		settings["worker_count"] = workerCount
+	}
+
+	vbsPerWorker := (vbsPerNode + int(workerCount) - 1) / int(workerCount)
+	if thrCount, ok := settings["cpp_worker_thread_count"].(float64); ok && int(thrCount) > vbsPerWorker {
+		warnings = append(warnings, fmt.Sprintf("cpp_worker_thread_count: %d exceeds vbuckets owned per worker: %d, "+
+			"reduced to %d as additional threads would stay idle", int(thrCount), vbsPerWorker, vbsPerWorker))
+		settings["cpp_worker_thread_count"] = float64(vbsPerWorker)
+	}
+
+	for _, warning := range warnings {
+		logging.Warnf("%s Function: %s %s", logPrefix, appName, warning)
+	}
+	return warnings
+}
+
+// sendSettingsWarnings writes warnings raised while storing settings, if any
+func (m *ServiceMgr) sendSettingsWarnings(w http.ResponseWriter, info *runtimeInfo) {
+	wInfo, ok := info.Info.(warningsInfo)
+	if !ok {
+		return
+	}
+
+	data, err := json.MarshalIndent(wInfo, "", " ")
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(w, "%s", string(data))
+}
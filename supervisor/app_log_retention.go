@@ -0,0 +1,222 @@
+package supervisor
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/couchbase/eventing/common"
+	"github.com/couchbase/eventing/logging"
+)
+
+const appLogRetentionInterval = 30 * time.Second
+
+type appLogFile struct {
+	appName string
+	path    string
+	size    int64
+	modTime time.Time
+	active  bool
+	evicted bool
+}
+
+// appLogRetention tracks disk usage of app logs of running functions, along with
+// rotated files evicted and rotations forced to abide by app_log_max_total_size
+type appLogRetention struct {
+	sync.RWMutex
+	usage     map[string]*common.AppLogUsage
+	usedBytes int64
+	evicted   map[string]uint64
+	rotations map[string]uint64
+}
+
+func newAppLogRetention() *appLogRetention {
+	return &appLogRetention{
+		usage:     make(map[string]*common.AppLogUsage),
+		evicted:   make(map[string]uint64),
+		rotations: make(map[string]uint64),
+	}
+}
+
+// listAppLogFiles returns active app log file of a function along with the rotated ones
+// i.e. <path>.1, <path>.2 and so on
+func listAppLogFiles(appName, path string) []*appLogFile {
+	entries, err := ioutil.ReadDir(filepath.Dir(path))
+	if err != nil {
+		return nil
+	}
+
+	base := filepath.Base(path)
+	files := make([]*appLogFile, 0)
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() {
+			continue
+		}
+
+		active := name == base
+		if !active {
+			suffix := strings.TrimPrefix(name, base+".")
+			index, err := strconv.Atoi(suffix)
+			if suffix == name || err != nil || index < 1 {
+				continue
+			}
+		}
+
+		files = append(files, &appLogFile{
+			appName: appName,
+			path:    filepath.Join(filepath.Dir(path), name),
+			size:    entry.Size(),
+			modTime: entry.ModTime(),
+			active:  active,
+		})
+	}
+	return files
+}
+
+// enforceAppLogRetention caps disk usage of app logs across all functions running on
+// this node. Once usage goes past the cap, rotated files are evicted oldest first, no
+// matter which function they belong to. If active files alone are past the cap, the
+// largest one is rotated ahead of its app_log_max_size
+func (s *SuperSupervisor) enforceAppLogRetention() {
+	logPrefix := "SuperSupervisor::enforceAppLogRetention"
+
+	tick := time.NewTicker(appLogRetentionInterval)
+	defer tick.Stop()
+
+	for range tick.C {
+		runningFns := s.runningFns()
+
+		files := make([]*appLogFile, 0)
+		var usedBytes int64
+		for appName, p := range runningFns {
+			path := p.AppLogPath()
+			if path == "" {
+				continue
+			}
+			for _, file := range listAppLogFiles(appName, path) {
+				files = append(files, file)
+				usedBytes += file.size
+			}
+		}
+
+		capBytes := atomic.LoadInt64(&s.appLogMaxTotalSize) * 1024 * 1024
+		if capBytes > 0 && usedBytes > capBytes {
+			usedBytes = s.evictAppLogFiles(files, usedBytes, capBytes)
+		}
+
+		if capBytes > 0 && usedBytes > capBytes {
+			largest := &appLogFile{}
+			for _, file := range files {
+				if file.active && file.size > largest.size {
+					largest = file
+				}
+			}
+
+			if p, ok := runningFns[largest.appName]; ok {
+				logging.Warnf("%s [%d] App logs at %d bytes are past cap of %d bytes with active files alone, rotating app log of function: %s",
+					logPrefix, s.runningFnsCount(), usedBytes, capBytes, largest.appName)
+				p.RotateAppLog()
+
+				s.appLogRetention.Lock()
+				s.appLogRetention.rotations[largest.appName]++
+				s.appLogRetention.Unlock()
+			}
+		}
+
+		s.appLogRetention.update(runningFns, files)
+	}
+}
+
+// evictAppLogFiles removes rotated app log files oldest first, until usage is within
+// cap. Returns usage post eviction
+func (s *SuperSupervisor) evictAppLogFiles(files []*appLogFile, usedBytes, capBytes int64) int64 {
+	logPrefix := "SuperSupervisor::evictAppLogFiles"
+
+	rotated := make([]*appLogFile, 0, len(files))
+	for _, file := range files {
+		if !file.active {
+			rotated = append(rotated, file)
+		}
+	}
+
+	sort.Slice(rotated, func(i, j int) bool {
+		return rotated[i].modTime.Before(rotated[j].modTime)
+	})
+
+	evicted := make(map[string]uint64)
+	for _, file := range rotated {
+		if usedBytes <= capBytes {
+			break
+		}
+
+		err := os.Remove(file.path)
+		if err != nil && !os.IsNotExist(err) {
+			logging.Errorf("%s [%d] Failed to evict app log file: %s, err: %v",
+				logPrefix, s.runningFnsCount(), file.path, err)
+			continue
+		}
+
+		usedBytes -= file.size
+		file.evicted = true
+		evicted[file.appName]++
+	}
+
+	s.appLogRetention.Lock()
+	defer s.appLogRetention.Unlock()
+
+	for appName, count := range evicted {
+		s.appLogRetention.evicted[appName] += count
+		logging.Warnf("%s [%d] Evicted %d rotated app log files of function: %s to stay within cap of %d bytes",
+			logPrefix, s.runningFnsCount(), count, appName, capBytes)
+	}
+	return usedBytes
+}
+
+func (r *appLogRetention) update(runningFns map[string]common.EventingProducer, files []*appLogFile) {
+	r.Lock()
+	defer r.Unlock()
+
+	r.usage = make(map[string]*common.AppLogUsage)
+	r.usedBytes = 0
+	for appName := range runningFns {
+		r.usage[appName] = &common.AppLogUsage{
+			EvictedFiles:    r.evicted[appName],
+			ForcedRotations: r.rotations[appName],
+		}
+	}
+
+	for _, file := range files {
+		usage, ok := r.usage[file.appName]
+		if !ok || file.evicted {
+			continue
+		}
+		usage.Bytes += file.size
+		usage.Files++
+		r.usedBytes += file.size
+	}
+}
+
+// GetAppLogUsage returns disk usage of app logs of functions running on this node, as
+// of the last retention check
+func (s *SuperSupervisor) GetAppLogUsage() *common.AppLogRetentionStats {
+	s.appLogRetention.RLock()
+	defer s.appLogRetention.RUnlock()
+
+	stats := &common.AppLogRetentionStats{
+		CapBytes:  atomic.LoadInt64(&s.appLogMaxTotalSize) * 1024 * 1024,
+		UsedBytes: s.appLogRetention.usedBytes,
+		Functions: make(map[string]*common.AppLogUsage, len(s.appLogRetention.usage)),
+	}
+	for appName, usage := range s.appLogRetention.usage {
+		u := *usage
+		stats.Functions[appName] = &u
+	}
+	return stats
+}
@@ -0,0 +1,141 @@
+package supervisor
+
+import (
+	"errors"
+	"time"
+
+	"github.com/couchbase/eventing/common"
+	"github.com/couchbase/eventing/logging"
+	"github.com/couchbase/eventing/util"
+)
+
+const (
+	maxBootstrapAttempts = 5
+
+	bootstrapRetryInitialInterval = time.Second
+	bootstrapRetryMaxInterval     = 30 * time.Second
+)
+
+var errBootstrapRetrying = errors.New("function bootstrap is being retried")
+
+// spawnAppWithRetry attempts to spawn producer for a function and calls onSpawned once
+// it's up. First attempt is made right away, transient failures are then retried with
+// exponential backoff off the caller's goroutine, as callers are metakv callbacks.
+// errBootstrapRetrying is returned in that case and function stays in bootstrap list
+// till retries are done. Once all attempts are exhausted, function is rolled back to
+// undeployed state. Reason for every failed attempt is retained and can be queried
+// via BootstrapAttempts
+func (s *SuperSupervisor) spawnAppWithRetry(appName string, onSpawned func()) error {
+	logPrefix := "SuperSupervisor::spawnAppWithRetry"
+
+	s.clearBootstrapAttempts(appName)
+
+	err := s.spawnApp(appName)
+	if err == nil {
+		onSpawned()
+		return nil
+	}
+
+	s.addBootstrapAttempt(appName, 1, err)
+
+	logging.Errorf("%s [%d] Function: %s bootstrap attempt 1/%d failed, retrying in background, err: %v",
+		logPrefix, s.runningFnsCount(), appName, maxBootstrapAttempts, err)
+
+	go s.retrySpawnApp(appName, onSpawned)
+	return errBootstrapRetrying
+}
+
+func (s *SuperSupervisor) retrySpawnApp(appName string, onSpawned func()) {
+	logPrefix := "SuperSupervisor::retrySpawnApp"
+
+	interval := bootstrapRetryInitialInterval
+
+	for attempt := 2; attempt <= maxBootstrapAttempts; attempt++ {
+		time.Sleep(interval)
+		interval *= 2
+		if interval > bootstrapRetryMaxInterval {
+			interval = bootstrapRetryMaxInterval
+		}
+
+		if !s.isAppDeployRequested(appName) {
+			logging.Infof("%s [%d] Function: %s no longer requested for deployment, aborting bootstrap retries",
+				logPrefix, s.runningFnsCount(), appName)
+			s.deleteFromBootstrappingApps(appName)
+			return
+		}
+
+		err := s.spawnApp(appName)
+		if err == nil {
+			logging.Infof("%s [%d] Function: %s spawned after %d attempts",
+				logPrefix, s.runningFnsCount(), appName, attempt)
+			onSpawned()
+			return
+		}
+
+		s.addBootstrapAttempt(appName, attempt, err)
+
+		logging.Errorf("%s [%d] Function: %s bootstrap attempt %d/%d failed, err: %v",
+			logPrefix, s.runningFnsCount(), appName, attempt, maxBootstrapAttempts, err)
+	}
+
+	logging.Errorf("%s [%d] Function: %s bootstrap failed after %d attempts, rolling back to undeployed state",
+		logPrefix, s.runningFnsCount(), appName, maxBootstrapAttempts)
+
+	util.Retry(util.NewExponentialBackoff(), &s.retryCount, undeployFunctionCallback, s, appName)
+	s.deleteFromBootstrappingApps(appName)
+}
+
+func (s *SuperSupervisor) deleteFromBootstrappingApps(appName string) {
+	s.appListRWMutex.Lock()
+	defer s.appListRWMutex.Unlock()
+
+	delete(s.bootstrappingApps, appName)
+}
+
+// isAppDeployRequested checks whether function settings in metakv still request deployment
+func (s *SuperSupervisor) isAppDeployRequested(appName string) bool {
+	data, err := util.MetakvGet(MetakvAppSettingsPath + appName)
+	if err != nil || data == nil {
+		return false
+	}
+
+	_, deploymentStatus, _, err := s.getStatuses(data)
+	if err != nil {
+		return false
+	}
+
+	return deploymentStatus
+}
+
+func (s *SuperSupervisor) addBootstrapAttempt(appName string, attempt int, err error) {
+	s.bootstrapAttemptsRWMutex.Lock()
+	defer s.bootstrapAttemptsRWMutex.Unlock()
+
+	s.bootstrapAttempts[appName] = append(s.bootstrapAttempts[appName], &common.BootstrapAttempt{
+		Attempt:   attempt,
+		Reason:    err.Error(),
+		Timestamp: time.Now().String(),
+	})
+}
+
+func (s *SuperSupervisor) clearBootstrapAttempts(appName string) {
+	s.bootstrapAttemptsRWMutex.Lock()
+	defer s.bootstrapAttemptsRWMutex.Unlock()
+
+	delete(s.bootstrapAttempts, appName)
+}
+
+// BootstrapAttempts returns failure reasons of bootstrap attempts made during
+// last deployment of the function on this node
+func (s *SuperSupervisor) BootstrapAttempts(appName string) []*common.BootstrapAttempt {
+	s.bootstrapAttemptsRWMutex.RLock()
+	defer s.bootstrapAttemptsRWMutex.RUnlock()
+
+	attempts := make([]*common.BootstrapAttempt, 0, len(s.bootstrapAttempts[appName]))
+	for _, attempt := range s.bootstrapAttempts[appName] {
+		attemptCopy := *attempt
+		attempts = append(attempts, &attemptCopy)
+	}
+
+	return attempts
+}
@@ -34,7 +34,7 @@ var getHTTPServiceAuth = func(args ...interface{}) error {
 	return err
 }
 
-var metakvGetCallback = func(args ...interface{}) error {
+var metakvGetCallback = util.InstrumentOp("supervisor.metakv_get", func(args ...interface{}) error {
 	logPrefix := "SuperSupervisor::metakvGetCallback"
 
 	s := args[0].(*SuperSupervisor)
@@ -48,9 +48,9 @@ var metakvGetCallback = func(args ...interface{}) error {
 	}
 
 	return err
-}
+})
 
-var metakvAppCallback = func(args ...interface{}) error {
+var metakvAppCallback = util.InstrumentOp("supervisor.metakv_app", func(args ...interface{}) error {
 	logPrefix := "SuperSupervisor::metakvAppCallback"
 
 	s := args[0].(*SuperSupervisor)
@@ -70,9 +70,9 @@ var metakvAppCallback = func(args ...interface{}) error {
 		return fmt.Errorf("Empty value from metakv lookup")
 	}
 	return nil
-}
+})
 
-var metakvDeleteCallback = func(args ...interface{}) error {
+var metakvDeleteCallback = util.InstrumentOp("supervisor.metakv_delete", func(args ...interface{}) error {
 	logPrefix := "SuperSupervisor::metakvDeleteCallback"
 
 	s := args[0].(*SuperSupervisor)
@@ -84,9 +84,9 @@ var metakvDeleteCallback = func(args ...interface{}) error {
 			logPrefix, s.runningFnsCount(), path, err)
 	}
 	return err
-}
+})
 
-var undeployFunctionCallback = func(args ...interface{}) error {
+var undeployFunctionCallback = util.InstrumentOp("supervisor.undeploy_function", func(args ...interface{}) error {
 	logPrefix := "SuperSupervisor::undeployFunctionCallback"
 
 	s := args[0].(*SuperSupervisor)
@@ -119,9 +119,9 @@ var undeployFunctionCallback = func(args ...interface{}) error {
 
 	logging.Infof("%s [%d] Function: %s response from server: %s resp: %rs", logPrefix, s.runningFnsCount(), appName, string(content), resp)
 	return nil
-}
+})
 
-var commonConnectBucketOpCallback = func(args ...interface{}) error {
+var commonConnectBucketOpCallback = util.InstrumentOp("supervisor.common_connect_bucket_op", func(args ...interface{}) error {
 	logPrefix := "Supervisor::commonConnectBucketOpCallback"
 	b := args[0].(**couchbase.Bucket)
 	bucketName := args[1].(string)
@@ -138,7 +138,7 @@ var commonConnectBucketOpCallback = func(args ...interface{}) error {
 	}
 
 	return err
-}
+})
 
 var gocbConnectCluster = func(args ...interface{}) error {
 	logPrefix := "Supervisor::gocbConnectCluster"
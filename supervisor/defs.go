@@ -39,6 +39,9 @@ const (
 
 	// MetakvChecksumPath within metakv is updated when new function definition is loaded
 	MetakvChecksumPath = metakvEventingPath + "checksum/"
+
+	// Last eventingDir used by each node, keyed by node uuid
+	metakvEventingDirPath = metakvEventingPath + "eventingDir/"
 )
 
 const (
@@ -73,6 +76,7 @@ type AdminPortConfig struct {
 type bucketWatchStruct struct {
 	b    *couchbase.Bucket
 	apps map[string]struct{}
+	cids *manifestCache
 }
 
 type gocbBucketInstance struct {
@@ -130,6 +134,10 @@ type SuperSupervisor struct {
 	bootstrappingApps map[string]string // Captures list of apps undergoing bootstrap, access controlled by appListRWMutex
 	pausingApps       map[string]string // Captures list of apps being paused, access controlled by appListRWMutex
 
+	// Failure reasons of bootstrap attempts made during last deployment of each app
+	bootstrapAttempts        map[string][]*common.BootstrapAttempt // Access controlled by bootstrapAttemptsRWMutex
+	bootstrapAttemptsRWMutex *sync.RWMutex
+
 	// Captures list of deployed apps and their last deployment time. Leveraged to report deployed app status
 	// via rest endpoints. Access controlled by appListRWMutex
 	deployedApps map[string]string
@@ -142,9 +150,20 @@ type SuperSupervisor struct {
 	workerRespawnedCount uint32
 
 	// Global config
-	memoryQuota int64 // In MB
+	memoryQuota     int64 // In MB
+	memorySoftLimit int64 // In MB, defaults to memoryQuota if unset
+
+	memoryPressureLevel int32
+
+	appLogMaxTotalSize int64 // In MB, 0 implies no cap across app logs
+	appLogRetention    *appLogRetention
 
-	cleanedUpAppMap            map[string]struct{} // Access controlled by default lock
+	// eventingDir used before the last restart, if it was relocated since
+	previousEventingDir string
+
+	cleanedUpAppMap            map[string]struct{}                      // Access controlled by default lock
+	metadataCleanupProducers   map[string]common.EventingProducer       // Access controlled by default lock
+	metadataCleanupStatus      map[string]*common.MetadataCleanupStatus // Access controlled by default lock
 	mu                         *sync.RWMutex
 	producerSupervisorTokenMap map[common.EventingProducer]suptree.ServiceToken // Access controlled by tokenMapRWMutex
 	tokenMapRWMutex            *sync.RWMutex
@@ -152,9 +171,22 @@ type SuperSupervisor struct {
 	runningProducersRWMutex    *sync.RWMutex
 	vbucketsToOwn              []uint16
 
+	peerHealth        *peerHealthTable
+	takeoverScheduler *takeoverScheduler
+	settingsCache     *settingsCache
+	dependencyGate    *dependencyGate
+
+	// Serializes settings changes applied from metakv callback, replays of held back
+	// changes and held back changes released past their wait
+	settingsChangeMutex *sync.Mutex
+	eventBus          *eventBus
+
 	scn        *util.ServicesChangeNotifier
 	serviceMgr common.EventingServiceMgr
 
+	// Manifest refreshes requested on seeing newer manifest uid over DCP
+	manifestRefreshCh chan *manifestRefreshMsg
+
 	gocbGlobalConfigHandle *gocbGlobalConfig
 
 	sync.RWMutex
@@ -0,0 +1,321 @@
+package supervisor
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/couchbase/cbauth/metakv"
+	"github.com/couchbase/eventing/common"
+	"github.com/couchbase/eventing/logging"
+	"github.com/couchbase/eventing/util"
+)
+
+// Time a deploy or undeploy is held back waiting on functions it's ordered against, past
+// which it goes through regardless
+const dependencyWaitTimeout = 5 * time.Minute
+
+type deferredSettingsChange struct {
+	kve       metakv.KVEntry
+	deploy    bool
+	waitingOn []string
+	timer     *time.Timer
+}
+
+// dependencyGate holds back settings changes of functions so that they're deployed after
+// functions listed in their depends_on, and undeployed before them. Avoids dependents
+// seeing a storm of mutations from functions they depend on bootstrapping alongside
+// them, notably at cluster startup
+type dependencyGate struct {
+	sync.Mutex
+	deferred map[string]*deferredSettingsChange
+}
+
+func newDependencyGate() *dependencyGate {
+	return &dependencyGate{
+		deferred: make(map[string]*deferredSettingsChange),
+	}
+}
+
+// getAppDependencies returns depends_on of function stored in primary store
+func (s *SuperSupervisor) getAppDependencies(appName string) []string {
+	data, err := util.ReadAppContent(MetakvAppsPath, MetakvChecksumPath, appName)
+	if err != nil || len(data) == 0 {
+		return nil
+	}
+	app := util.ParseFunctionPayload(data, appName)
+	return app.DeploymentConfig.DependsOn
+}
+
+// getRequestedStatuses returns deployment and processing status asked of function in metakv
+func (s *SuperSupervisor) getRequestedStatuses(appName string) (bool, bool) {
+	data, err := util.MetakvGet(MetakvAppSettingsPath + appName)
+	if err != nil || len(data) == 0 {
+		return false, false
+	}
+	processingStatus, deploymentStatus, _, err := s.getStatuses(data)
+	if err != nil {
+		return false, false
+	}
+	return deploymentStatus, processingStatus
+}
+
+func (s *SuperSupervisor) isBootstrapped(appName string) bool {
+	s.appListRWMutex.RLock()
+	_, bootstrapping := s.bootstrappingApps[appName]
+	s.appListRWMutex.RUnlock()
+
+	return !bootstrapping && s.GetAppState(appName) == common.AppStateEnabled
+}
+
+// pendingDependencies returns functions appName depends on that are to be deployed but
+// haven't finished bootstrap on this node yet
+func (s *SuperSupervisor) pendingDependencies(appName string) []string {
+	pending := make([]string, 0)
+	for _, dependency := range s.getAppDependencies(appName) {
+		deploymentStatus, processingStatus := s.getRequestedStatuses(dependency)
+		if !deploymentStatus || !processingStatus {
+			continue
+		}
+		if !s.isBootstrapped(dependency) {
+			pending = append(pending, dependency)
+		}
+	}
+	return pending
+}
+
+// pendingDependents returns functions running on this node that depend on appName and
+// are to be undeployed, but haven't been torn down yet
+func (s *SuperSupervisor) pendingDependents(appName string) []string {
+	pending := make([]string, 0)
+	for dependent := range s.runningFns() {
+		if dependent == appName {
+			continue
+		}
+
+		dependsOnApp := false
+		for _, dependency := range s.getAppDependencies(dependent) {
+			if dependency == appName {
+				dependsOnApp = true
+				break
+			}
+		}
+		if !dependsOnApp {
+			continue
+		}
+
+		if deploymentStatus, _ := s.getRequestedStatuses(dependent); !deploymentStatus {
+			pending = append(pending, dependent)
+		}
+	}
+	sort.Strings(pending)
+	return pending
+}
+
+// deferForDependencies returns true if settings change of function is held back till
+// functions it's ordered against are done. Any earlier held back change of the function
+// is superseded
+func (s *SuperSupervisor) deferForDependencies(appName string, kve metakv.KVEntry, deploymentStatus, processingStatus bool) bool {
+	logPrefix := "SuperSupervisor::deferForDependencies"
+
+	g := s.dependencyGate
+	g.Lock()
+	if prev, ok := g.deferred[appName]; ok {
+		prev.timer.Stop()
+		delete(g.deferred, appName)
+	}
+	g.Unlock()
+
+	var waitingOn []string
+	deploy := deploymentStatus && processingStatus
+	switch {
+	case deploy:
+		state := s.GetAppState(appName)
+		if state != common.AppStateUndeployed && state != common.AppStatePaused {
+			return false
+		}
+		waitingOn = s.pendingDependencies(appName)
+
+	case !deploymentStatus && !processingStatus:
+		if _, ok := s.runningFns()[appName]; !ok {
+			return false
+		}
+		waitingOn = s.pendingDependents(appName)
+
+	default:
+		return false
+	}
+
+	if len(waitingOn) == 0 {
+		return false
+	}
+
+	deferred := &deferredSettingsChange{
+		kve:       kve,
+		deploy:    deploy,
+		waitingOn: waitingOn,
+	}
+	deferred.timer = time.AfterFunc(dependencyWaitTimeout, func() {
+		s.settingsChangeMutex.Lock()
+		defer s.settingsChangeMutex.Unlock()
+
+		s.releaseDeferredSettingsChange(appName, deferred)
+	})
+
+	g.Lock()
+	g.deferred[appName] = deferred
+	g.Unlock()
+
+	logging.Infof("%s [%d] Function: %s deploy: %t held back waiting on: %v",
+		logPrefix, s.runningFnsCount(), appName, deploy, waitingOn)
+	return true
+}
+
+// releaseDeferredSettingsChange lets through a held back settings change past its wait.
+// Caller is expected to hold settingsChangeMutex
+func (s *SuperSupervisor) releaseDeferredSettingsChange(appName string, deferred *deferredSettingsChange) {
+	logPrefix := "SuperSupervisor::releaseDeferredSettingsChange"
+
+	g := s.dependencyGate
+	g.Lock()
+	if g.deferred[appName] != deferred {
+		g.Unlock()
+		return
+	}
+	delete(g.deferred, appName)
+	g.Unlock()
+
+	logging.Warnf("%s [%d] Function: %s deploy: %t still waiting on: %v after %v, going ahead",
+		logPrefix, s.runningFnsCount(), appName, deferred.deploy, deferred.waitingOn, dependencyWaitTimeout)
+	s.handleSettingsChange(deferred.kve)
+}
+
+// replayDeferredSettingsChanges lets through held back settings changes of functions
+// that no longer wait on any other function. Called once a deploy or undeploy is done,
+// caller is expected to hold settingsChangeMutex
+func (s *SuperSupervisor) replayDeferredSettingsChanges() {
+	logPrefix := "SuperSupervisor::replayDeferredSettingsChanges"
+
+	g := s.dependencyGate
+	g.Lock()
+	appNames := make([]string, 0, len(g.deferred))
+	for appName := range g.deferred {
+		appNames = append(appNames, appName)
+	}
+	g.Unlock()
+	sort.Strings(appNames)
+
+	for _, appName := range appNames {
+		g.Lock()
+		deferred, ok := g.deferred[appName]
+		g.Unlock()
+		if !ok {
+			continue
+		}
+
+		var waitingOn []string
+		if deferred.deploy {
+			waitingOn = s.pendingDependencies(appName)
+		} else {
+			waitingOn = s.pendingDependents(appName)
+		}
+		if len(waitingOn) != 0 {
+			continue
+		}
+
+		g.Lock()
+		if g.deferred[appName] != deferred {
+			g.Unlock()
+			continue
+		}
+		deferred.timer.Stop()
+		delete(g.deferred, appName)
+		g.Unlock()
+
+		logging.Infof("%s [%d] Function: %s deploy: %t done waiting, replaying settings change",
+			logPrefix, s.runningFnsCount(), appName, deferred.deploy)
+		s.handleSettingsChange(deferred.kve)
+	}
+}
+
+// orderByDependencies sorts functions such that each comes after those it depends on.
+// Functions caught in a cycle, which validation refuses, are left at the end by name
+func (s *SuperSupervisor) orderByDependencies(appNames []string) []string {
+	logPrefix := "SuperSupervisor::orderByDependencies"
+
+	dependsOn := make(map[string][]string, len(appNames))
+	for _, appName := range appNames {
+		dependsOn[appName] = s.getAppDependencies(appName)
+	}
+
+	ordered, cyclic := sortByDependencies(appNames, dependsOn)
+	if len(cyclic) != 0 {
+		logging.Errorf("%s [%d] Functions: %v depend on each other in a cycle",
+			logPrefix, s.runningFnsCount(), cyclic)
+	}
+	return ordered
+}
+
+// sortByDependencies topologically sorts appNames over dependsOn, breaking ties by name.
+// Dependencies outside appNames are ignored. Functions caught in a cycle are returned
+// separately and also appended to the end of ordered
+func sortByDependencies(appNames []string, dependsOn map[string][]string) ([]string, []string) {
+	present := make(map[string]struct{}, len(appNames))
+	for _, appName := range appNames {
+		present[appName] = struct{}{}
+	}
+
+	inDegree := make(map[string]int, len(appNames))
+	dependents := make(map[string][]string)
+	for _, appName := range appNames {
+		inDegree[appName] = 0
+	}
+
+	for _, appName := range appNames {
+		for _, dependency := range dependsOn[appName] {
+			if _, ok := present[dependency]; !ok || dependency == appName {
+				continue
+			}
+			inDegree[appName]++
+			dependents[dependency] = append(dependents[dependency], appName)
+		}
+	}
+
+	ready := make([]string, 0)
+	for appName, degree := range inDegree {
+		if degree == 0 {
+			ready = append(ready, appName)
+		}
+	}
+	sort.Strings(ready)
+
+	ordered := make([]string, 0, len(appNames))
+	for len(ready) != 0 {
+		appName := ready[0]
+		ready = ready[1:]
+		ordered = append(ordered, appName)
+
+		next := make([]string, 0)
+		for _, dependent := range dependents[appName] {
+			inDegree[dependent]--
+			if inDegree[dependent] == 0 {
+				next = append(next, dependent)
+			}
+		}
+		sort.Strings(next)
+		ready = append(ready, next...)
+	}
+
+	cyclic := make([]string, 0)
+	if len(ordered) != len(appNames) {
+		for appName, degree := range inDegree {
+			if degree > 0 {
+				cyclic = append(cyclic, appName)
+			}
+		}
+		sort.Strings(cyclic)
+		ordered = append(ordered, cyclic...)
+	}
+
+	return ordered, cyclic
+}
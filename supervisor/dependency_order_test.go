@@ -0,0 +1,63 @@
+package supervisor
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSortByDependencies(t *testing.T) {
+	tests := []struct {
+		name      string
+		appNames  []string
+		dependsOn map[string][]string
+		ordered   []string
+		cyclic    []string
+	}{
+		{
+			name:     "independent by name",
+			appNames: []string{"c", "a", "b"},
+			ordered:  []string{"a", "b", "c"},
+			cyclic:   []string{},
+		},
+		{
+			name:      "chain",
+			appNames:  []string{"a", "b", "c"},
+			dependsOn: map[string][]string{"a": {"b"}, "b": {"c"}},
+			ordered:   []string{"c", "b", "a"},
+			cyclic:    []string{},
+		},
+		{
+			name:      "diamond",
+			appNames:  []string{"a", "b", "c", "d"},
+			dependsOn: map[string][]string{"a": {"b", "c"}, "b": {"d"}, "c": {"d"}},
+			ordered:   []string{"d", "b", "c", "a"},
+			cyclic:    []string{},
+		},
+		{
+			name:      "dependency not deployed and self dependency ignored",
+			appNames:  []string{"a", "b"},
+			dependsOn: map[string][]string{"a": {"x", "a"}, "b": {"a"}},
+			ordered:   []string{"a", "b"},
+			cyclic:    []string{},
+		},
+		{
+			name:      "cycle left at end",
+			appNames:  []string{"a", "b", "c", "d"},
+			dependsOn: map[string][]string{"a": {"b"}, "b": {"a"}, "c": {"a"}},
+			ordered:   []string{"d", "a", "b", "c"},
+			cyclic:    []string{"a", "b", "c"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ordered, cyclic := sortByDependencies(test.appNames, test.dependsOn)
+			if !reflect.DeepEqual(ordered, test.ordered) {
+				t.Errorf("ordered got: %v expected: %v", ordered, test.ordered)
+			}
+			if !reflect.DeepEqual(cyclic, test.cyclic) {
+				t.Errorf("cyclic got: %v expected: %v", cyclic, test.cyclic)
+			}
+		})
+	}
+}
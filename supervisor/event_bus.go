@@ -0,0 +1,231 @@
+package supervisor
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/couchbase/eventing/common"
+	"github.com/couchbase/eventing/logging"
+)
+
+const (
+	// Events of a topic waiting to be delivered to a subscribing function, beyond
+	// which newly published ones are dropped
+	busBacklogCap = 10000
+
+	// Time delivery waits before retrying an event that couldn't be handed over to
+	// the subscribing function, as its consumers are being respawned
+	busRedeliveryInterval = time.Second
+)
+
+type busEvent struct {
+	topic   string
+	payload []byte
+}
+
+type busSubscription struct {
+	appName string
+	topic   string
+	backlog chan *busEvent
+	stopCh  chan struct{}
+
+	delivered uint64
+	dropped   uint64
+}
+
+type busTopic struct {
+	published     uint64 // Access via atomics, bumped under read lock of the bus
+	subscriptions map[string]*busSubscription
+}
+
+// eventBus routes named events emitted by handlers to functions subscribed to the
+// topic, without bouncing them through a bucket. Bus is node local, events emitted
+// by a function on a node are handed to subscribers running on the same node. Each
+// subscription is drained in order by its own routine, so a slow subscriber only
+// backs up its own backlog. Topics exist only while subscribed to, so that
+// publishing to arbitrary names doesn't grow the bus
+type eventBus struct {
+	sync.RWMutex
+	topics   map[string]*busTopic
+	unrouted uint64 // Access via atomics
+}
+
+func newEventBus() *eventBus {
+	return &eventBus{
+		topics: make(map[string]*busTopic),
+	}
+}
+
+func (b *eventBus) topic(name string) *busTopic {
+	t, ok := b.topics[name]
+	if !ok {
+		t = &busTopic{subscriptions: make(map[string]*busSubscription)}
+		b.topics[name] = t
+	}
+	return t
+}
+
+// SubscribeBusTopics routes events published on topics to the function, in place of
+// topics it was subscribed to earlier. Backlog of topics it stays subscribed to is
+// retained, so that events published while function was paused get delivered on resume
+func (s *SuperSupervisor) SubscribeBusTopics(appName string, topics []string) {
+	logPrefix := "SuperSupervisor::SubscribeBusTopics"
+
+	subscribe := make(map[string]struct{}, len(topics))
+	for _, name := range topics {
+		subscribe[name] = struct{}{}
+	}
+
+	b := s.eventBus
+	b.Lock()
+	defer b.Unlock()
+
+	for name, t := range b.topics {
+		if _, ok := subscribe[name]; ok {
+			continue
+		}
+		if sub, ok := t.subscriptions[appName]; ok {
+			close(sub.stopCh)
+			delete(t.subscriptions, appName)
+		}
+		if len(t.subscriptions) == 0 {
+			delete(b.topics, name)
+		}
+	}
+
+	for name := range subscribe {
+		t := b.topic(name)
+		if _, ok := t.subscriptions[appName]; ok {
+			continue
+		}
+
+		sub := &busSubscription{
+			appName: appName,
+			topic:   name,
+			backlog: make(chan *busEvent, busBacklogCap),
+			stopCh:  make(chan struct{}),
+		}
+		t.subscriptions[appName] = sub
+		go s.deliverBusEvents(sub)
+	}
+
+	if len(topics) != 0 {
+		logging.Infof("%s [%d] Function: %s subscribed to topics: %v",
+			logPrefix, s.runningFnsCount(), appName, topics)
+	}
+}
+
+// UnsubscribeBusTopics stops routing events to the function. Events still in its
+// backlog are dropped
+func (s *SuperSupervisor) UnsubscribeBusTopics(appName string) {
+	logPrefix := "SuperSupervisor::UnsubscribeBusTopics"
+
+	b := s.eventBus
+	b.Lock()
+	defer b.Unlock()
+
+	for name, t := range b.topics {
+		sub, ok := t.subscriptions[appName]
+		if !ok {
+			continue
+		}
+		close(sub.stopCh)
+		delete(t.subscriptions, appName)
+		if len(t.subscriptions) == 0 {
+			delete(b.topics, name)
+		}
+
+		if backlog := len(sub.backlog); backlog != 0 {
+			logging.Infof("%s [%d] Function: %s topic: %s dropping backlog of %d events",
+				logPrefix, s.runningFnsCount(), appName, name, backlog)
+		}
+	}
+}
+
+// PublishBusEvent queues up event emitted by the function for every function
+// subscribed to the topic. Events on topics with no subscriber are only counted
+func (s *SuperSupervisor) PublishBusEvent(appName, topic string, payload []byte) {
+	logPrefix := "SuperSupervisor::PublishBusEvent"
+
+	b := s.eventBus
+	b.RLock()
+	defer b.RUnlock()
+
+	t, ok := b.topics[topic]
+	if !ok {
+		atomic.AddUint64(&b.unrouted, 1)
+		return
+	}
+	atomic.AddUint64(&t.published, 1)
+
+	evt := &busEvent{topic: topic, payload: payload}
+	for _, sub := range t.subscriptions {
+		select {
+		case sub.backlog <- evt:
+		default:
+			if atomic.AddUint64(&sub.dropped, 1) == 1 {
+				logging.Warnf("%s [%d] Function: %s topic: %s backlog of subscriber: %s full, dropping events",
+					logPrefix, s.runningFnsCount(), appName, topic, sub.appName)
+			}
+		}
+	}
+}
+
+func (s *SuperSupervisor) deliverBusEvents(sub *busSubscription) {
+	logPrefix := "SuperSupervisor::deliverBusEvents"
+
+	for {
+		select {
+		case <-sub.stopCh:
+			return
+
+		case evt := <-sub.backlog:
+			for {
+				p, ok := s.runningFns()[sub.appName]
+				if ok {
+					err := p.DeliverBusEvent(evt.topic, evt.payload)
+					if err == nil {
+						atomic.AddUint64(&sub.delivered, 1)
+						break
+					}
+					logging.Debugf("%s [%d] Function: %s topic: %s failed to deliver event, err: %v",
+						logPrefix, s.runningFnsCount(), sub.appName, evt.topic, err)
+				}
+
+				select {
+				case <-sub.stopCh:
+					return
+				case <-time.After(busRedeliveryInterval):
+				}
+			}
+		}
+	}
+}
+
+// GetBusStats returns traffic of topics subscribed to on the event bus of this node
+func (s *SuperSupervisor) GetBusStats() *common.BusStats {
+	b := s.eventBus
+	b.RLock()
+	defer b.RUnlock()
+
+	stats := &common.BusStats{
+		Unrouted: atomic.LoadUint64(&b.unrouted),
+		Topics:   make(map[string]*common.BusTopicStats, len(b.topics)),
+	}
+	for name, t := range b.topics {
+		topicStats := &common.BusTopicStats{
+			Published:   atomic.LoadUint64(&t.published),
+			Subscribers: make(map[string]*common.BusSubscriberStats, len(t.subscriptions)),
+		}
+		for appName, sub := range t.subscriptions {
+			topicStats.Subscribers[appName] = &common.BusSubscriberStats{
+				Delivered: atomic.LoadUint64(&sub.delivered),
+				Dropped:   atomic.LoadUint64(&sub.dropped),
+				Backlog:   len(sub.backlog),
+			}
+		}
+		stats.Topics[name] = topicStats
+	}
+	return stats
+}
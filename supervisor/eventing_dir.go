@@ -0,0 +1,103 @@
+package supervisor
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/couchbase/eventing/logging"
+	"github.com/couchbase/eventing/util"
+)
+
+// relocateEventingDir compares eventingDir against the one used by this node
+// before restart. If it has changed, per function artifacts i.e. app logs and
+// debugger frontend url files are moved over to the new location. Artifacts that
+// can't be moved across filesystems are symlinked instead
+func (s *SuperSupervisor) relocateEventingDir() {
+	logPrefix := "SuperSupervisor::relocateEventingDir"
+
+	path := metakvEventingDirPath + s.uuid
+
+	data, err := util.MetakvGet(path)
+	if err != nil {
+		logging.Errorf("%s Failed to read previous eventingDir, err: %v", logPrefix, err)
+		return
+	}
+
+	previousDir := string(data)
+	if previousDir != "" && filepath.Clean(previousDir) != filepath.Clean(s.eventingDir) {
+		logging.Infof("%s eventingDir changed from: %s to: %s, relocating function artifacts",
+			logPrefix, previousDir, s.eventingDir)
+		s.previousEventingDir = previousDir
+		s.relocateAppArtifacts(previousDir)
+	}
+
+	if previousDir == s.eventingDir {
+		return
+	}
+
+	err = util.MetakvSet(path, []byte(s.eventingDir), nil)
+	if err != nil {
+		logging.Errorf("%s Failed to store eventingDir: %s, err: %v", logPrefix, s.eventingDir, err)
+	}
+}
+
+func (s *SuperSupervisor) relocateAppArtifacts(previousDir string) {
+	logPrefix := "SuperSupervisor::relocateAppArtifacts"
+
+	apps, err := util.ListChildren(MetakvAppsPath)
+	if err != nil {
+		logging.Errorf("%s Failed to list functions, err: %v", logPrefix, err)
+		return
+	}
+
+	entries, err := ioutil.ReadDir(previousDir)
+	if err != nil {
+		logging.Errorf("%s Failed to list contents of previous eventingDir: %s, err: %v",
+			logPrefix, previousDir, err)
+		return
+	}
+
+	err = os.MkdirAll(s.eventingDir, 0755)
+	if err != nil {
+		logging.Errorf("%s Failed to create eventingDir: %s, err: %v", logPrefix, s.eventingDir, err)
+		return
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || !isAppArtifact(entry.Name(), apps) {
+			continue
+		}
+
+		oldPath := filepath.Join(previousDir, entry.Name())
+		newPath := filepath.Join(s.eventingDir, entry.Name())
+
+		if _, err := os.Lstat(newPath); err == nil {
+			logging.Infof("%s Skipping %s as it's already present in eventingDir", logPrefix, entry.Name())
+			continue
+		}
+
+		err = os.Rename(oldPath, newPath)
+		if err == nil {
+			logging.Infof("%s Moved %s to %s", logPrefix, oldPath, newPath)
+			continue
+		}
+
+		err = os.Symlink(oldPath, newPath)
+		if err != nil {
+			logging.Errorf("%s Failed to relocate %s to %s, err: %v", logPrefix, oldPath, newPath, err)
+			continue
+		}
+		logging.Infof("%s Linked %s to %s", logPrefix, newPath, oldPath)
+	}
+}
+
+func isAppArtifact(name string, apps []string) bool {
+	for _, app := range apps {
+		if strings.HasPrefix(name, app+".log") || name == app+"_frontend.url" {
+			return true
+		}
+	}
+	return false
+}
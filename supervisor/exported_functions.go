@@ -48,18 +48,33 @@ func (s *SuperSupervisor) GetAppCode(appName string) string {
 	return ""
 }
 
-// GetDebuggerURL returns the v8 debugger url for supplied appname
-func (s *SuperSupervisor) GetDebuggerURL(appName string) (string, error) {
+// GetDebuggerURL returns the v8 debugger url for supplied appname, to callers holding
+// token of the debug session
+func (s *SuperSupervisor) GetDebuggerURL(appName, token string) (string, error) {
 	logPrefix := "SuperSupervisor::GetDebuggerURL"
 
 	logging.Debugf("%s [%d] Function: %s request for debugger URL", logPrefix, s.runningFnsCount(), appName)
 	if p, ok := s.runningFns()[appName]; ok {
-		return p.GetDebuggerURL()
+		return p.GetDebuggerURL(token)
 	}
 
 	return "", nil
 }
 
+// GetDebuggerSession returns debug session of supplied appname, nil if there's none
+func (s *SuperSupervisor) GetDebuggerSession(appName string) (*common.DebuggerSession, error) {
+	if p, ok := s.runningFns()[appName]; ok {
+		return p.GetDebuggerSession()
+	}
+
+	return nil, nil
+}
+
+// NumVbuckets returns count of vbuckets functions are planned for
+func (s *SuperSupervisor) NumVbuckets() int {
+	return s.numVbuckets
+}
+
 // GetDeployedApps returns list of deployed apps and their last deployment time
 func (s *SuperSupervisor) GetDeployedApps() map[string]string {
 	s.appListRWMutex.RLock()
@@ -128,6 +143,14 @@ func (s *SuperSupervisor) GetFailureStats(appName string) map[string]interface{}
 	return nil
 }
 
+// GetFailureDomains returns failures of the app attributed to failure domains
+func (s *SuperSupervisor) GetFailureDomains(appName string) map[string]*common.DomainFailures {
+	if p, ok := s.runningFns()[appName]; ok {
+		return p.GetFailureDomains()
+	}
+	return nil
+}
+
 // GetLcbExceptionsStats returns libcouchbase exception stats from CPP workers
 func (s *SuperSupervisor) GetLcbExceptionsStats(appName string) map[string]uint64 {
 	p, ok := s.runningFns()[appName]
@@ -137,6 +160,105 @@ func (s *SuperSupervisor) GetLcbExceptionsStats(appName string) map[string]uint6
 	return nil
 }
 
+// GetDcpFeedEvents returns recent connection events of DCP feeds opened by the app
+func (s *SuperSupervisor) GetDcpFeedEvents(appName string) []*common.DcpFeedEvent {
+	if p, ok := s.runningFns()[appName]; ok {
+		return p.GetDcpFeedEvents()
+	}
+	return nil
+}
+
+// GetWorkerRestarts returns restarts of cpp workers of the app, along with how each one
+// last went down
+func (s *SuperSupervisor) GetWorkerRestarts(appName string) []*common.WorkerRestartStats {
+	if p, ok := s.runningFns()[appName]; ok {
+		return p.GetWorkerRestarts()
+	}
+	return nil
+}
+
+// GetRebalanceHistograms returns distribution of durations per rebalance phase of the app
+func (s *SuperSupervisor) GetRebalanceHistograms(appName string) map[string]*common.Histogram {
+	if p, ok := s.runningFns()[appName]; ok {
+		return p.GetRebalanceHistograms()
+	}
+	return nil
+}
+
+// GetLiveness returns liveness of consumers of the app, as per their heartbeats
+func (s *SuperSupervisor) GetLiveness(appName string) []*common.ConsumerLiveness {
+	if p, ok := s.runningFns()[appName]; ok {
+		return p.GetLiveness()
+	}
+	return nil
+}
+
+// GetFencingStatus returns whether the app has been fenced on local eventing node
+func (s *SuperSupervisor) GetFencingStatus(appName string) *common.FencingStatus {
+	if p, ok := s.runningFns()[appName]; ok {
+		return p.GetFencingStatus()
+	}
+	return nil
+}
+
+// GetRebalanceReports returns reports of recent topology changes persisted by eventing nodes
+func (s *SuperSupervisor) GetRebalanceReports(appName string) (map[string][]*common.RebalanceReport, error) {
+	if p, ok := s.runningFns()[appName]; ok {
+		return p.GetRebalanceReports()
+	}
+	return nil, fmt.Errorf("function: %s not running", appName)
+}
+
+// PauseVbs pauses processing of vbs of the app on local eventing node, returns vbs
+// that weren't paused already
+func (s *SuperSupervisor) PauseVbs(appName string, vbs []uint16) ([]uint16, error) {
+	if p, ok := s.runningFns()[appName]; ok {
+		return p.PauseVbs(vbs), nil
+	}
+	return nil, fmt.Errorf("function: %s not running", appName)
+}
+
+// ResumeVbs resumes processing of paused vbs of the app on local eventing node
+func (s *SuperSupervisor) ResumeVbs(appName string, vbs []uint16) ([]uint16, error) {
+	if p, ok := s.runningFns()[appName]; ok {
+		return p.ResumeVbs(vbs), nil
+	}
+	return nil, fmt.Errorf("function: %s not running", appName)
+}
+
+// GetPausedVbs returns vbs of the app paused on local eventing node
+func (s *SuperSupervisor) GetPausedVbs(appName string) *common.PausedVbs {
+	if p, ok := s.runningFns()[appName]; ok {
+		return p.GetPausedVbs()
+	}
+	return nil
+}
+
+// GetRebalanceProgress returns vbucket ownership transfer progress of the app on
+// local eventing node
+func (s *SuperSupervisor) GetRebalanceProgress(appName string) *common.AppRebalanceProgress {
+	if p, ok := s.runningFns()[appName]; ok {
+		return p.GetRebalanceProgress()
+	}
+	return nil
+}
+
+// GetOwnershipMap returns vbucket ownership of the app on local eventing node
+func (s *SuperSupervisor) GetOwnershipMap(appName string) *common.OwnershipMap {
+	if p, ok := s.runningFns()[appName]; ok {
+		return p.GetOwnershipMap()
+	}
+	return nil
+}
+
+// GetSourceMap returns source map of handler code loaded by the app
+func (s *SuperSupervisor) GetSourceMap(appName string) *common.SourceMap {
+	if p, ok := s.runningFns()[appName]; ok {
+		return p.GetSourceMap()
+	}
+	return nil
+}
+
 // GetSeqsProcessed returns vbucket specific sequence nos processed so far
 func (s *SuperSupervisor) GetSeqsProcessed(appName string) map[int]int64 {
 	if p, ok := s.runningFns()[appName]; ok {
@@ -174,6 +296,24 @@ func (s *SuperSupervisor) SignalStopDebugger(appName string) error {
 	return nil
 }
 
+// CancelTimer cancels a timer created by the function with given callback and reference
+func (s *SuperSupervisor) CancelTimer(appName, callback, reference string) error {
+	p, ok := s.runningFns()[appName]
+	if !ok {
+		return fmt.Errorf("function: %s isn't running on the node", appName)
+	}
+	return p.CancelTimer(callback, reference)
+}
+
+// VerifyTimerStore verifies timer store of vbs owned by the function on this node
+func (s *SuperSupervisor) VerifyTimerStore(appName string, vbs []uint16, policy string) ([]*common.TimerIntegrityReport, error) {
+	p, ok := s.runningFns()[appName]
+	if !ok {
+		return nil, fmt.Errorf("function: %s isn't running on the node", appName)
+	}
+	return p.VerifyTimerStore(vbs, policy)
+}
+
 // GetAppState returns current state of app
 func (s *SuperSupervisor) GetAppState(appName string) int8 {
 	s.appRWMutex.RLock()
@@ -496,7 +636,7 @@ func (s *SuperSupervisor) GetMetaStoreStats(appName string) map[string]uint64 {
 }
 
 // WriteDebuggerToken signals running function to write debug token
-func (s *SuperSupervisor) WriteDebuggerToken(appName, token string, hostnames []string) {
+func (s *SuperSupervisor) WriteDebuggerToken(appName, token string, hostnames []string, replay *common.DebuggerReplay, ttl time.Duration) {
 	logPrefix := "SuperSupervisor::WriteDebuggerToken"
 
 	p, exists := s.runningFns()[appName]
@@ -504,7 +644,17 @@ func (s *SuperSupervisor) WriteDebuggerToken(appName, token string, hostnames []
 		logging.Errorf("%s [%d] Function %s not found", logPrefix, s.runningFnsCount(), appName)
 		return
 	}
-	p.WriteDebuggerToken(token, hostnames)
+	p.WriteDebuggerToken(token, hostnames, replay, ttl)
+}
+
+// WaitForDebuggerURL returns DevTools URL of the worker which trapped a mutation for the
+// debug session, on whichever node it may be
+func (s *SuperSupervisor) WaitForDebuggerURL(appName, token string, timeout time.Duration) (string, error) {
+	p, ok := s.runningFns()[appName]
+	if !ok {
+		return "", fmt.Errorf("function: %s isn't running on the node", appName)
+	}
+	return p.WaitForDebuggerURL(token, timeout)
 }
 
 // WriteDebuggerURL signals running function to write debug url
@@ -544,6 +694,8 @@ func (s *SuperSupervisor) deleteFromRunningProducers(appName string) {
 	delete(s.runningProducers, appName)
 	s.runningProducersRWMutex.Unlock()
 
+	s.takeoverScheduler.forget(appName)
+
 	logging.Infof("%s [%d] Function: %s deleted from running functions", logPrefix, s.runningFnsCount(), appName)
 }
 
@@ -580,6 +732,45 @@ func (s *SuperSupervisor) addToCleanupApps(appName string) {
 	}
 }
 
+// cleanupMetadata clears up artifacts of the function from metadata keyspace,
+// while keeping its progress queryable
+func (s *SuperSupervisor) cleanupMetadata(appName string, p common.EventingProducer) {
+	logPrefix := "SuperSupervisor::cleanupMetadata"
+
+	s.Lock()
+	s.metadataCleanupProducers[appName] = p
+	s.Unlock()
+
+	err := p.CleanupMetadataBucket(false)
+	if err != nil {
+		logging.Errorf("%s [%d] Function: %s metadata cleanup failed, err: %v", logPrefix, s.runningFnsCount(), appName, err)
+	}
+
+	s.Lock()
+	delete(s.metadataCleanupProducers, appName)
+	if status := p.GetMetadataCleanupStatus(); status != nil {
+		s.metadataCleanupStatus[appName] = status
+	}
+	s.Unlock()
+}
+
+// GetMetadataCleanupStatus returns progress of ongoing or last metadata cleanup of the function
+func (s *SuperSupervisor) GetMetadataCleanupStatus(appName string) *common.MetadataCleanupStatus {
+	if p, ok := s.runningFns()[appName]; ok {
+		if status := p.GetMetadataCleanupStatus(); status != nil {
+			return status
+		}
+	}
+
+	s.RLock()
+	defer s.RUnlock()
+
+	if p, ok := s.metadataCleanupProducers[appName]; ok {
+		return p.GetMetadataCleanupStatus()
+	}
+	return s.metadataCleanupStatus[appName]
+}
+
 func (s *SuperSupervisor) deleteFromCleanupApps(appName string) {
 	logPrefix := "SuperSupervisor::deleteFromCleanupApps"
 
@@ -644,8 +835,8 @@ func (s *SuperSupervisor) GetCurrentManifestId(bucketName string) (string, error
 }
 
 func (s *SuperSupervisor) GetCollectionID(bucketName, scopeName, collectionName string) (uint32, error) {
-	s.bucketsRWMutex.Lock()
-	defer s.bucketsRWMutex.Unlock()
+	s.bucketsRWMutex.RLock()
+	defer s.bucketsRWMutex.RUnlock()
 	bucketWatch, ok := s.buckets[bucketName]
 	if !ok {
 		return 0, common.BucketNotWatched
@@ -655,7 +846,7 @@ func (s *SuperSupervisor) GetCollectionID(bucketName, scopeName, collectionName
 	if manifest == nil {
 		return 0, nil
 	}
-	return manifest.GetCollectionID(scopeName, collectionName)
+	return bucketWatch.cids.collectionID(manifest, scopeName, collectionName)
 }
 
 func (s *SuperSupervisor) GetMetadataHandle(bucketName, scopeName, collectionName, appName string) (*gocb.Collection, error) {
@@ -0,0 +1,72 @@
+package supervisor
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/couchbase/eventing/common"
+)
+
+func (s *SuperSupervisor) incidentsDir(appName string) string {
+	return filepath.Join(s.eventingDir, common.IncidentsDir, appName)
+}
+
+// GetWorkerIncidents lists incident records captured on cpp worker restarts of the
+// app on this node, newest first
+func (s *SuperSupervisor) GetWorkerIncidents(appName string) ([]*common.WorkerIncidentSummary, error) {
+	entries, err := ioutil.ReadDir(s.incidentsDir(appName))
+	if os.IsNotExist(err) {
+		return []*common.WorkerIncidentSummary{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	incidents := make([]*common.WorkerIncidentSummary, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+
+		id := strings.TrimSuffix(entry.Name(), ".json")
+		summary := &common.WorkerIncidentSummary{
+			ID:        id,
+			Size:      entry.Size(),
+			Timestamp: entry.ModTime().Format(time.RFC3339),
+		}
+		if fields := strings.SplitN(id, "_", 2); len(fields) == 2 {
+			summary.Worker = fields[1]
+		}
+		incidents = append(incidents, summary)
+	}
+
+	sort.Slice(incidents, func(i, j int) bool {
+		return incidents[i].Timestamp > incidents[j].Timestamp
+	})
+	return incidents, nil
+}
+
+// GetWorkerIncident returns an incident record of the app captured on this node
+func (s *SuperSupervisor) GetWorkerIncident(appName, id string) (*common.WorkerIncident, error) {
+	if id == "" || filepath.Base(id) != id || strings.HasPrefix(id, ".") {
+		return nil, fmt.Errorf("invalid incident id: %s", id)
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(s.incidentsDir(appName), id+".json"))
+	if err != nil {
+		return nil, err
+	}
+
+	var incident common.WorkerIncident
+	err = json.Unmarshal(data, &incident)
+	if err != nil {
+		return nil, err
+	}
+	return &incident, nil
+}
@@ -0,0 +1,140 @@
+package supervisor
+
+import (
+	"strconv"
+	"sync"
+
+	"github.com/couchbase/eventing/common/collections"
+	"github.com/couchbase/eventing/logging"
+)
+
+type manifestRefreshMsg struct {
+	bucketName string
+	uid        string
+}
+
+// manifestCache resolves scope and collection names of a bucket to collection ids. It's
+// shared by functions watching the bucket on the node and is rebuilt whenever manifest
+// uid of the bucket moves on
+type manifestCache struct {
+	sync.RWMutex
+	uid        string
+	cids       map[string]uint32 // "scope.collection" => cid
+	pendingUID string            // Newer uid seen over DCP, manifest yet to be refreshed
+}
+
+func newManifestCache() *manifestCache {
+	return &manifestCache{
+		cids: make(map[string]uint32),
+	}
+}
+
+func (mc *manifestCache) collectionID(manifest *collections.CollectionManifest, scope, collection string) (uint32, error) {
+	key := scope + "." + collection
+
+	mc.RLock()
+	cid, ok := mc.cids[key]
+	valid := mc.uid == manifest.UID
+	mc.RUnlock()
+	if ok && valid {
+		return cid, nil
+	}
+
+	cid, err := manifest.GetCollectionID(scope, collection)
+	if err != nil {
+		return cid, err
+	}
+
+	mc.Lock()
+	if mc.uid != manifest.UID {
+		mc.uid = manifest.UID
+		mc.cids = make(map[string]uint32)
+	}
+	mc.cids[key] = cid
+	mc.Unlock()
+	return cid, nil
+}
+
+// observeUID records manifest uid seen over DCP. Returns true if it's newer than
+// the manifest cached, and a refresh isn't already pending for it
+func (mc *manifestCache) observeUID(manifestUID, uid string) bool {
+	if isManifestUIDNewer(uid, manifestUID) {
+		mc.Lock()
+		defer mc.Unlock()
+
+		if !isManifestUIDNewer(uid, mc.pendingUID) {
+			return false
+		}
+		mc.pendingUID = uid
+		return true
+	}
+	return false
+}
+
+func (mc *manifestCache) refreshed() {
+	mc.Lock()
+	defer mc.Unlock()
+
+	mc.pendingUID = ""
+}
+
+// Manifest uids are base 16 encoded, both in bucket manifest and DCP system events
+func isManifestUIDNewer(uid, than string) bool {
+	newUID, err := strconv.ParseUint(uid, 16, 64)
+	if err != nil {
+		return false
+	}
+	if than == "" {
+		return true
+	}
+	oldUID, err := strconv.ParseUint(than, 16, 64)
+	if err != nil {
+		return true
+	}
+	return newUID > oldUID
+}
+
+// ObserveManifestUID gets manifest of the bucket refreshed, if uid seen over DCP system
+// event is newer than the one cached. Refresh is picked up by bucket watcher routine
+func (s *SuperSupervisor) ObserveManifestUID(bucketName, uid string) {
+	logPrefix := "SuperSupervisor::ObserveManifestUID"
+
+	s.bucketsRWMutex.RLock()
+	bucketWatch, ok := s.buckets[bucketName]
+	if !ok {
+		s.bucketsRWMutex.RUnlock()
+		return
+	}
+	refresh := bucketWatch.cids.observeUID(bucketWatch.GetManifestId(), uid)
+	s.bucketsRWMutex.RUnlock()
+
+	if !refresh {
+		return
+	}
+
+	select {
+	case s.manifestRefreshCh <- &manifestRefreshMsg{bucketName: bucketName, uid: uid}:
+		logging.Infof("%s bucket: %s manifest uid: %s seen over DCP, refreshing manifest",
+			logPrefix, bucketName, uid)
+	default:
+		bucketWatch.cids.refreshed()
+	}
+}
+
+func (s *SuperSupervisor) refreshManifest(msg *manifestRefreshMsg) error {
+	s.bucketsRWMutex.RLock()
+	bucketWatch, ok := s.buckets[msg.bucketName]
+	s.bucketsRWMutex.RUnlock()
+	if ok {
+		defer bucketWatch.cids.refreshed()
+	}
+
+	changed, err := s.FetchBucketManifestInfo(msg.bucketName, msg.uid)
+	if err != nil {
+		return err
+	}
+	if changed {
+		s.checkDeletedCid(msg.bucketName)
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package supervisor
+
+import (
+	"runtime"
+	"sync/atomic"
+	"time"
+
+	"github.com/couchbase/eventing/logging"
+)
+
+const (
+	memoryPressureCheckInterval = 5 * time.Second
+
+	// Fraction of soft limit usage has to drop below threshold of current level,
+	// before stepping down to a lower level
+	memoryPressureHysteresis = 0.05
+)
+
+// Fraction of soft limit at which each memory pressure level kicks in. Every level
+// sheds optional memory on top of the ones below it, refer consumer/memory_pressure.go
+var memoryPressureThresholds = []float64{0.7, 0.8, 0.9}
+
+// MemoryPressureLevel returns current memory pressure level of eventing-producer
+func (s *SuperSupervisor) MemoryPressureLevel() int {
+	return int(atomic.LoadInt32(&s.memoryPressureLevel))
+}
+
+// memoryLimit returns soft limit on memory held by eventing-producer in bytes. It
+// defaults to eventing memory quota, unless memory_soft_limit is configured
+func (s *SuperSupervisor) memoryLimit() uint64 {
+	if limit := atomic.LoadInt64(&s.memorySoftLimit); limit > 0 {
+		return uint64(limit) * 1024 * 1024
+	}
+	if s.memoryQuota > 0 {
+		return uint64(s.memoryQuota) * 1024 * 1024
+	}
+	return 0
+}
+
+func memoryPressureLevel(prevLevel int, usage, limit uint64) int {
+	ratio := float64(usage) / float64(limit)
+
+	level := 0
+	for i, threshold := range memoryPressureThresholds {
+		if i < prevLevel {
+			threshold -= memoryPressureHysteresis
+		}
+		if ratio >= threshold {
+			level = i + 1
+		}
+	}
+	return level
+}
+
+// monitorMemoryPressure tracks memory held by Go runtime against soft limit, and gets
+// running functions to degrade gracefully as usage approaches it
+func (s *SuperSupervisor) monitorMemoryPressure() {
+	logPrefix := "SuperSupervisor::monitorMemoryPressure"
+
+	tick := time.NewTicker(memoryPressureCheckInterval)
+	defer tick.Stop()
+
+	for range tick.C {
+		limit := s.memoryLimit()
+		if limit == 0 {
+			continue
+		}
+
+		var mem runtime.MemStats
+		runtime.ReadMemStats(&mem)
+		usage := mem.Sys - mem.HeapReleased
+
+		prevLevel := s.MemoryPressureLevel()
+		level := memoryPressureLevel(prevLevel, usage, limit)
+		if level == prevLevel {
+			continue
+		}
+
+		atomic.StoreInt32(&s.memoryPressureLevel, int32(level))
+		logging.Infof("%s [%d] Memory pressure level changed from %d to %d, usage: %d MB soft limit: %d MB",
+			logPrefix, s.runningFnsCount(), prevLevel, level, usage/(1024*1024), limit/(1024*1024))
+
+		for _, p := range s.runningFns() {
+			p.SetMemoryPressureLevel(level)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package supervisor
+
+import (
+	"sync"
+	"time"
+
+	"github.com/couchbase/eventing/common"
+	"github.com/couchbase/eventing/logging"
+	"github.com/couchbase/eventing/util"
+)
+
+// Peer not heard from for this long over health gossip is considered down
+const peerHealthTimeout = 15 * time.Second
+
+// Handler invocations, tallied up for failure rate of a function
+var (
+	handlerSuccessStats = []string{"on_update_success", "on_delete_success", "timer_callback_success", "on_event_success"}
+	handlerFailureStats = []string{"on_update_failure", "on_delete_failure", "timer_callback_failure", "on_event_failure"}
+)
+
+type peerHealthEntry struct {
+	health     *common.NodeHealth
+	receivedAt time.Time
+}
+
+// peerHealthTable holds latest health gossiped by other eventing nodes, keyed by node uuid
+type peerHealthTable struct {
+	sync.RWMutex
+	peers map[string]*peerHealthEntry
+}
+
+func newPeerHealthTable() *peerHealthTable {
+	return &peerHealthTable{
+		peers: make(map[string]*peerHealthEntry),
+	}
+}
+
+// LocalNodeHealth returns health of this node, to be gossiped to peers
+func (s *SuperSupervisor) LocalNodeHealth() *common.NodeHealth {
+	health := &common.NodeHealth{
+		NodeUUID:     s.uuid,
+		Timestamp:    time.Now().Format(time.RFC3339),
+		DeployedApps: make([]string, 0),
+		DcpBacklog:   make(map[string]uint64),
+		Executions:   make(map[string]uint64),
+		Failures:     make(map[string]uint64),
+		LastErrors:   make(map[string]*common.FunctionError),
+	}
+
+	for appName, p := range s.runningFns() {
+		health.DeployedApps = append(health.DeployedApps, appName)
+		health.DcpBacklog[appName] = p.GetDcpEventsRemainingToProcess()
+		if p.IsFenced() {
+			health.FencedApps = append(health.FencedApps, appName)
+		}
+
+		executionStats := p.GetExecutionStats()
+		successes := sumExecutionStats(executionStats, handlerSuccessStats)
+		failures := sumExecutionStats(executionStats, handlerFailureStats)
+		health.Executions[appName] = successes + failures
+		health.Failures[appName] = failures
+
+		if err := p.GetLastError(); err != nil {
+			health.LastErrors[appName] = err
+		}
+	}
+
+	s.appListRWMutex.RLock()
+	for appName := range s.bootstrappingApps {
+		health.BootstrappingApps = append(health.BootstrappingApps, appName)
+	}
+	s.appListRWMutex.RUnlock()
+
+	return health
+}
+
+func sumExecutionStats(executionStats map[string]interface{}, names []string) uint64 {
+	var sum uint64
+	for _, name := range names {
+		if value, ok := executionStats[name].(float64); ok {
+			sum += uint64(value)
+		}
+	}
+	return sum
+}
+
+// UpdatePeerHealth records health gossiped by another eventing node
+func (s *SuperSupervisor) UpdatePeerHealth(health *common.NodeHealth) {
+	logPrefix := "SuperSupervisor::UpdatePeerHealth"
+
+	if health == nil || health.NodeUUID == "" || health.NodeUUID == s.uuid {
+		return
+	}
+
+	t := s.peerHealth
+	t.Lock()
+	defer t.Unlock()
+
+	entry, ok := t.peers[health.NodeUUID]
+	if !ok {
+		logging.Infof("%s Started receiving health of eventing node uuid: %s addr: %rs",
+			logPrefix, health.NodeUUID, health.HostPortAddr)
+	} else if time.Since(entry.receivedAt) > peerHealthTimeout {
+		logging.Infof("%s Eventing node uuid: %s addr: %rs is back after %v",
+			logPrefix, health.NodeUUID, health.HostPortAddr, time.Since(entry.receivedAt))
+	}
+
+	// Sender doesn't know the address it's reachable at, retain the one learnt so far
+	if health.HostPortAddr == "" && ok {
+		health.HostPortAddr = entry.health.HostPortAddr
+	}
+
+	t.peers[health.NodeUUID] = &peerHealthEntry{
+		health:     health,
+		receivedAt: time.Now(),
+	}
+}
+
+// GetPeerHealth returns health last gossiped by each of the peers
+func (s *SuperSupervisor) GetPeerHealth() map[string]*common.NodeHealth {
+	t := s.peerHealth
+	t.RLock()
+	defer t.RUnlock()
+
+	peers := make(map[string]*common.NodeHealth)
+	for nodeUUID, entry := range t.peers {
+		health := *entry.health
+		health.LastHeardMs = time.Since(entry.receivedAt).Nanoseconds() / int64(time.Millisecond)
+		peers[nodeUUID] = &health
+	}
+	return peers
+}
+
+// PeerLiveness reports liveness of an eventing node for an app as per health gossip.
+// Nodes that never gossiped e.g. ones running older versions are reported unknown.
+// It's advisory, callers mustn't let it override cluster membership as per ns_server
+func (s *SuperSupervisor) PeerLiveness(hostPortAddr, nodeUUID, appName string) common.PeerLiveness {
+	if nodeUUID != "" && nodeUUID == s.uuid {
+		return common.PeerLivenessUnknown
+	}
+
+	t := s.peerHealth
+	t.RLock()
+	defer t.RUnlock()
+
+	entry, ok := t.peers[nodeUUID]
+	if !ok {
+		for _, e := range t.peers {
+			if hostPortAddr != "" && e.health.HostPortAddr == hostPortAddr {
+				entry, ok = e, true
+				break
+			}
+		}
+	}
+	if !ok {
+		return common.PeerLivenessUnknown
+	}
+
+	if time.Since(entry.receivedAt) > peerHealthTimeout {
+		return common.PeerDown
+	}
+
+	if util.Contains(appName, entry.health.FencedApps) {
+		return common.PeerFenced
+	}
+	return common.PeerAlive
+}
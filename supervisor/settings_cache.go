@@ -0,0 +1,201 @@
+package supervisor
+
+import (
+	"bytes"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/couchbase/eventing/common"
+	"github.com/couchbase/eventing/logging"
+	"github.com/couchbase/eventing/util"
+)
+
+// Upper bound on settings of functions held in memory. Settings of functions
+// without subscribers are evicted least recently used first beyond it
+const maxCachedAppSettings = 512
+
+type settingsCacheEntry struct {
+	raw        []byte
+	settings   map[string]interface{}
+	revision   uint64
+	lastAccess time.Time
+}
+
+type settingsSubscriber struct {
+	id       uint64
+	callback common.AppSettingsCallback
+}
+
+// settingsCache holds parsed settings of functions, so that settings are parsed once
+// per change on the node and subscribed producers and consumers get notified of the
+// same parsed object
+type settingsCache struct {
+	sync.RWMutex
+	entries     map[string]*settingsCacheEntry
+	subscribers map[string][]*settingsSubscriber
+	nextID      uint64
+}
+
+func newSettingsCache() *settingsCache {
+	return &settingsCache{
+		entries:     make(map[string]*settingsCacheEntry),
+		subscribers: make(map[string][]*settingsSubscriber),
+	}
+}
+
+// update records settings of the function as received from metakv. Parsed settings
+// can be passed in if already at hand, subscribers get notified if settings changed
+func (sc *settingsCache) update(appName string, raw []byte, settings map[string]interface{}) (uint64, error) {
+	if settings == nil {
+		settings = make(map[string]interface{})
+		err := json.Unmarshal(raw, &settings)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	sc.Lock()
+	entry, ok := sc.entries[appName]
+	if ok && bytes.Equal(entry.raw, raw) {
+		entry.lastAccess = time.Now()
+		revision := entry.revision
+		sc.Unlock()
+		return revision, nil
+	}
+
+	var revision uint64 = 1
+	if ok {
+		revision = entry.revision + 1
+	}
+
+	sc.entries[appName] = &settingsCacheEntry{
+		raw:        raw,
+		settings:   settings,
+		revision:   revision,
+		lastAccess: time.Now(),
+	}
+	subscribers := append([]*settingsSubscriber(nil), sc.subscribers[appName]...)
+	sc.evict()
+	sc.Unlock()
+
+	for _, sub := range subscribers {
+		sub.callback(settings, revision)
+	}
+	return revision, nil
+}
+
+// evict drops least recently used settings of functions nobody has subscribed to,
+// till cache is within its bound. Caller is expected to hold the lock
+func (sc *settingsCache) evict() {
+	for len(sc.entries) > maxCachedAppSettings {
+		var lruApp string
+		var lruAccess time.Time
+
+		for appName, entry := range sc.entries {
+			if len(sc.subscribers[appName]) > 0 {
+				continue
+			}
+			if lruApp == "" || entry.lastAccess.Before(lruAccess) {
+				lruApp, lruAccess = appName, entry.lastAccess
+			}
+		}
+
+		if lruApp == "" {
+			return
+		}
+		delete(sc.entries, lruApp)
+	}
+}
+
+func (sc *settingsCache) get(appName string) (map[string]interface{}, uint64, bool) {
+	sc.Lock()
+	defer sc.Unlock()
+
+	entry, ok := sc.entries[appName]
+	if !ok {
+		return nil, 0, false
+	}
+
+	entry.lastAccess = time.Now()
+	return entry.settings, entry.revision, true
+}
+
+func (sc *settingsCache) invalidate(appName string) {
+	sc.Lock()
+	defer sc.Unlock()
+
+	delete(sc.entries, appName)
+}
+
+func (sc *settingsCache) subscribe(appName string, callback common.AppSettingsCallback) uint64 {
+	sc.Lock()
+	defer sc.Unlock()
+
+	sc.nextID++
+	sc.subscribers[appName] = append(sc.subscribers[appName], &settingsSubscriber{
+		id:       sc.nextID,
+		callback: callback,
+	})
+	return sc.nextID
+}
+
+func (sc *settingsCache) unsubscribe(appName string, id uint64) {
+	sc.Lock()
+	defer sc.Unlock()
+
+	subscribers := sc.subscribers[appName]
+	for i, sub := range subscribers {
+		if sub.id == id {
+			subscribers = append(subscribers[:i], subscribers[i+1:]...)
+			break
+		}
+	}
+
+	if len(subscribers) == 0 {
+		delete(sc.subscribers, appName)
+		return
+	}
+	sc.subscribers[appName] = subscribers
+}
+
+// GetAppSettings returns parsed settings of the function along with their revision on
+// this node, reading them from metakv if not cached. Returned settings are shared with
+// rest of the subscribers and mustn't be modified
+func (s *SuperSupervisor) GetAppSettings(appName string) (map[string]interface{}, uint64, error) {
+	logPrefix := "SuperSupervisor::GetAppSettings"
+
+	if settings, revision, ok := s.settingsCache.get(appName); ok {
+		return settings, revision, nil
+	}
+
+	sData, err := util.MetakvGet(MetakvAppSettingsPath + appName)
+	if err != nil {
+		logging.Errorf("%s [%d] Function: %s failed to fetch settings from metakv, err: %v",
+			logPrefix, s.runningFnsCount(), appName, err)
+		return nil, 0, err
+	}
+
+	settings := make(map[string]interface{})
+	err = json.Unmarshal(sData, &settings)
+	if err != nil {
+		logging.Errorf("%s [%d] Function: %s failed to unmarshal settings received from metakv, err: %v",
+			logPrefix, s.runningFnsCount(), appName, err)
+		return nil, 0, err
+	}
+
+	revision, err := s.settingsCache.update(appName, sData, settings)
+	return settings, revision, err
+}
+
+// SubscribeAppSettings registers callback to be invoked with parsed settings each time
+// settings of the function change. Callback is invoked from metakv notification routine
+// and hence mustn't block
+func (s *SuperSupervisor) SubscribeAppSettings(appName string, callback common.AppSettingsCallback) uint64 {
+	return s.settingsCache.subscribe(appName, callback)
+}
+
+// UnsubscribeAppSettings drops callback registered via SubscribeAppSettings
+func (s *SuperSupervisor) UnsubscribeAppSettings(appName string, id uint64) {
+	s.settingsCache.unsubscribe(appName, id)
+}
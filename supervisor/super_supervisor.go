@@ -31,9 +31,13 @@ func NewSuperSupervisor(adminPort AdminPortConfig, eventingDir, kvPort, restPort
 		appDeploymentStatus:                make(map[string]bool),
 		appProcessingStatus:                make(map[string]bool),
 		bootstrappingApps:                  make(map[string]string),
+		bootstrapAttempts:                  make(map[string][]*common.BootstrapAttempt),
+		bootstrapAttemptsRWMutex:           &sync.RWMutex{},
 		pausingApps:                        make(map[string]string),
 		CancelCh:                           make(chan struct{}, 1),
 		cleanedUpAppMap:                    make(map[string]struct{}),
+		metadataCleanupProducers:           make(map[string]common.EventingProducer),
+		metadataCleanupStatus:              make(map[string]*common.MetadataCleanupStatus),
 		deployedApps:                       make(map[string]string),
 		diagDir:                            diagDir,
 		ejectNodes:                         make([]string, 0),
@@ -41,7 +45,14 @@ func NewSuperSupervisor(adminPort AdminPortConfig, eventingDir, kvPort, restPort
 		keepNodes:                          make([]string, 0),
 		kvPort:                             kvPort,
 		locallyDeployedApps:                make(map[string]string),
+		manifestRefreshCh:                  make(chan *manifestRefreshMsg, 10),
 		numVbuckets:                        numVbuckets,
+		peerHealth:                         newPeerHealthTable(),
+		takeoverScheduler:                  newTakeoverScheduler(),
+		appLogRetention:                    newAppLogRetention(),
+		settingsCache:                      newSettingsCache(),
+		dependencyGate:                     newDependencyGate(),
+		eventBus:                           newEventBus(),
 		producerSupervisorTokenMap:         make(map[common.EventingProducer]suptree.ServiceToken),
 		restPort:                           restPort,
 		retryCount:                         60,
@@ -58,10 +69,13 @@ func NewSuperSupervisor(adminPort AdminPortConfig, eventingDir, kvPort, restPort
 	s.appRWMutex = &sync.RWMutex{}
 	s.appListRWMutex = &sync.RWMutex{}
 	s.mu = &sync.RWMutex{}
+	s.settingsChangeMutex = &sync.Mutex{}
 	s.buckets = make(map[string]*bucketWatchStruct)
 	s.bucketsRWMutex = &sync.RWMutex{}
 	s.superSup.ServeBackground("SuperSupervisor")
 
+	s.relocateEventingDir()
+
 	config, _ := util.NewConfig(nil)
 	config.Set("uuid", s.uuid)
 	config.Set("eventing_admin_http_port", s.adminPort.HTTPPort)
@@ -70,6 +84,8 @@ func NewSuperSupervisor(adminPort AdminPortConfig, eventingDir, kvPort, restPort
 	config.Set("eventing_admin_ssl_cert", s.adminPort.CertFile)
 	config.Set("eventing_admin_ssl_key", s.adminPort.KeyFile)
 	config.Set("eventing_dir", s.eventingDir)
+	config.Set("previous_eventing_dir", s.previousEventingDir)
+	config.Set("diag_dir", s.diagDir)
 	config.Set("rest_port", s.restPort)
 
 	s.serviceMgr = servicemanager.NewServiceMgr(config, false, s)
@@ -92,6 +108,9 @@ func NewSuperSupervisor(adminPort AdminPortConfig, eventingDir, kvPort, restPort
 		}
 	}()
 
+	go s.monitorMemoryPressure()
+	go s.enforceAppLogRetention()
+
 	go s.watchBucketChanges()
 	var err error
 	s.gocbGlobalConfigHandle, err = initgocbGlobalConfig(s.retryCount, s.restPort)
@@ -185,7 +204,16 @@ func (s *SuperSupervisor) EventHandlerLoadCallback(kve metakv.KVEntry) error {
 
 // SettingsChangeCallback is registered as callback from metakv observe calls on event handler settings path
 func (s *SuperSupervisor) SettingsChangeCallback(kve metakv.KVEntry) error {
-	logPrefix := "SuperSupervisor::SettingsChangeCallback"
+	s.settingsChangeMutex.Lock()
+	defer s.settingsChangeMutex.Unlock()
+
+	return s.handleSettingsChange(kve)
+}
+
+// handleSettingsChange applies settings change of function, caller is expected to hold
+// settingsChangeMutex
+func (s *SuperSupervisor) handleSettingsChange(kve metakv.KVEntry) error {
+	logPrefix := "SuperSupervisor::handleSettingsChange"
 
 	if !s.checkIfNodeInCluster() && s.runningFnsCount() == 0 {
 		logging.Infof("%s [%d] Node not part of cluster. Exiting callback", logPrefix, s.runningFnsCount())
@@ -209,6 +237,9 @@ func (s *SuperSupervisor) SettingsChangeCallback(kve metakv.KVEntry) error {
 			cmd: cmdSettingsUpdate,
 		}
 
+		// Subscribed consumers get to see the update right away
+		s.settingsCache.update(appName, kve.Value, sValue)
+
 		processingStatus, deploymentStatus, _, err := s.getStatuses(kve.Value)
 		if err != nil {
 			return nil
@@ -227,6 +258,12 @@ func (s *SuperSupervisor) SettingsChangeCallback(kve metakv.KVEntry) error {
 		logging.Infof("%s [%d] Function: %s current state: %d requested status for deployment: %t processing: %t",
 			logPrefix, s.runningFnsCount(), appName, s.GetAppState(appName), deploymentStatus, processingStatus)
 
+		// Deploys follow functions listed in depends_on, undeploys precede them
+		if s.deferForDependencies(appName, kve, deploymentStatus, processingStatus) {
+			return nil
+		}
+		defer s.replayDeferredSettingsChanges()
+
 		/*
 			Undeployed	S1	deployment_status: false	processing_status: false
 			Deployed	S2	deployment_status: true		processing_status: true
@@ -271,7 +308,8 @@ func (s *SuperSupervisor) SettingsChangeCallback(kve metakv.KVEntry) error {
 					}
 
 					logging.Infof("%s [%d] Function: %s adding to bootstrap list", logPrefix, s.runningFnsCount(), appName)
-					s.bootstrappingApps[appName] = time.Now().String()
+					bootstrapStarted := time.Now()
+					s.bootstrappingApps[appName] = bootstrapStarted.String()
 					s.appListRWMutex.Unlock()
 
 					if err := util.MetaKvDelete(MetakvAppsRetryPath+appName, nil); err != nil {
@@ -293,40 +331,44 @@ func (s *SuperSupervisor) SettingsChangeCallback(kve metakv.KVEntry) error {
 						}
 					}
 
-					if !resumed {
-						err = s.spawnApp(appName)
-						if err != nil {
+					finishBootstrap := func() {
+						s.appRWMutex.Lock()
+						s.appDeploymentStatus[appName] = deploymentStatus
+						s.appProcessingStatus[appName] = processingStatus
+						s.appRWMutex.Unlock()
+
+						if eventingProducer, ok := s.runningFns()[appName]; ok {
+							eventingProducer.SignalBootstrapFinish()
+
+							logging.Infof("%s [%d] Function: %s bootstrap finished", logPrefix, s.runningFnsCount(), appName)
+							// double check that handler is still present in s.runningFns() after eventingProducer.SignalBootstrapFinish() above
+							// as handler may have been undeployed due to src and/or meta bucket delete
+							if _, ok := s.runningFns()[appName]; ok {
+								s.addToDeployedApps(appName)
+								s.addToLocallyDeployedApps(appName)
+								logging.Infof("%s [%d] Function: %s added to deployed apps map", logPrefix, s.runningFnsCount(), appName)
+							}
+
+							s.deleteFromCleanupApps(appName)
+
 							s.appListRWMutex.Lock()
+							logging.Infof("%s [%d] Function: %s deleting from bootstrap list", logPrefix, s.runningFnsCount(), appName)
 							delete(s.bootstrappingApps, appName)
 							s.appListRWMutex.Unlock()
-							logging.Errorf("%s [%d] Function: %s spawning error: %v", logPrefix, s.runningFnsCount(), appName, err)
-							return nil
+
+							s.serviceMgr.RecordBootstrapFinished(appName, bootstrapStarted, time.Now())
 						}
 					}
 
-					s.appRWMutex.Lock()
-					s.appDeploymentStatus[appName] = deploymentStatus
-					s.appProcessingStatus[appName] = processingStatus
-					s.appRWMutex.Unlock()
-
-					if eventingProducer, ok := s.runningFns()[appName]; ok {
-						eventingProducer.SignalBootstrapFinish()
-
-						logging.Infof("%s [%d] Function: %s bootstrap finished", logPrefix, s.runningFnsCount(), appName)
-						// double check that handler is still present in s.runningFns() after eventingProducer.SignalBootstrapFinish() above
-						// as handler may have been undeployed due to src and/or meta bucket delete
-						if _, ok := s.runningFns()[appName]; ok {
-							s.addToDeployedApps(appName)
-							s.addToLocallyDeployedApps(appName)
-							logging.Infof("%s [%d] Function: %s added to deployed apps map", logPrefix, s.runningFnsCount(), appName)
+					if resumed {
+						finishBootstrap()
+					} else if err = s.spawnAppWithRetry(appName, finishBootstrap); err != nil {
+						if err == errBootstrapRetrying {
+							return nil
 						}
-
-						s.deleteFromCleanupApps(appName)
-
-						s.appListRWMutex.Lock()
-						logging.Infof("%s [%d] Function: %s deleting from bootstrap list", logPrefix, s.runningFnsCount(), appName)
-						delete(s.bootstrappingApps, appName)
-						s.appListRWMutex.Unlock()
+						s.deleteFromBootstrappingApps(appName)
+						logging.Errorf("%s [%d] Function: %s spawning error: %v", logPrefix, s.runningFnsCount(), appName, err)
+						return nil
 					}
 				} else {
 					s.supCmdCh <- msg
@@ -407,6 +449,8 @@ func (s *SuperSupervisor) SettingsChangeCallback(kve metakv.KVEntry) error {
 			}
 		}
 
+	} else {
+		s.settingsCache.invalidate(util.GetAppNameFromPath(kve.Path))
 	}
 	return nil
 }
@@ -484,7 +528,7 @@ func (s *SuperSupervisor) TopologyChangeNotifCallback(kve metakv.KVEntry) error
 		logging.Infof("%s [%d] Apps in primary store: %v, running apps: %v",
 			logPrefix, s.runningFnsCount(), appsInPrimaryStore, s.runningFns())
 
-		for _, appName := range appsInPrimaryStore {
+		for _, appName := range s.orderByDependencies(appsInPrimaryStore) {
 
 			var sData []byte
 			path := MetakvAppSettingsPath + appName
@@ -530,41 +574,48 @@ func (s *SuperSupervisor) TopologyChangeNotifCallback(kve metakv.KVEntry) error
 					s.bootstrappingApps[appName] = time.Now().String()
 					s.appListRWMutex.Unlock()
 
-					err = s.spawnApp(appName)
-					if err != nil {
-						logging.Errorf("%s [%d] Function: %s spawning error: %v", logPrefix, s.runningFnsCount(), appName, err)
-						continue
-					}
+					appName := appName
+					finishBootstrap := func() {
+						s.appRWMutex.Lock()
+						s.appDeploymentStatus[appName] = deploymentStatus
+						s.appProcessingStatus[appName] = processingStatus
+						s.appRWMutex.Unlock()
+						err := s.serviceMgr.UpdateBucketGraphFromMetakv(appName)
+						if err != nil {
+							logging.Errorf("%s [%d] Function: %s UpdateBucketGraphFromMetakv error: %v", logPrefix, s.runningFnsCount(), appName, err)
+						}
+						if eventingProducer, ok := s.runningFns()[appName]; ok {
+							eventingProducer.SignalBootstrapFinish()
 
-					s.appRWMutex.Lock()
-					s.appDeploymentStatus[appName] = deploymentStatus
-					s.appProcessingStatus[appName] = processingStatus
-					s.appRWMutex.Unlock()
-					err = s.serviceMgr.UpdateBucketGraphFromMetakv(appName)
-					if err != nil {
-						logging.Errorf("%s [%d] Function: %s UpdateBucketGraphFromMetakv error: %v", logPrefix, s.runningFnsCount(), appName, err)
-					}
-					if eventingProducer, ok := s.runningFns()[appName]; ok {
-						eventingProducer.SignalBootstrapFinish()
+							logging.Infof("%s [%d] Function: %s bootstrap finished", logPrefix, s.runningFnsCount(), appName)
 
-						logging.Infof("%s [%d] Function: %s bootstrap finished", logPrefix, s.runningFnsCount(), appName)
+							// double check that handler is still present in s.runningFns() after eventingProducer.SignalBootstrapFinish() above
+							// as handler may have been undeployed due to src and/or meta bucket delete
+							if _, ok := s.runningFns()[appName]; ok {
+								s.addToDeployedApps(appName)
+								s.addToLocallyDeployedApps(appName)
+								logging.Infof("%s [%d] Function: %s added to deployed apps map", logPrefix, s.runningFnsCount(), appName)
+							}
 
-						// double check that handler is still present in s.runningFns() after eventingProducer.SignalBootstrapFinish() above
-						// as handler may have been undeployed due to src and/or meta bucket delete
-						if _, ok := s.runningFns()[appName]; ok {
-							s.addToDeployedApps(appName)
-							s.addToLocallyDeployedApps(appName)
-							logging.Infof("%s [%d] Function: %s added to deployed apps map", logPrefix, s.runningFnsCount(), appName)
+							s.deleteFromCleanupApps(appName)
+							eventingProducer.NotifyTopologyChange(topologyChangeMsg)
 						}
+						s.appListRWMutex.Lock()
+						logging.Infof("%s [%d] Function: %s deleting from bootstrap list", logPrefix, s.runningFnsCount(), appName)
+						delete(s.bootstrappingApps, appName)
+						s.appListRWMutex.Unlock()
+						logging.Infof("%s [%d] Function: %s deployment done", logPrefix, s.runningFnsCount(), appName)
+					}
 
-						s.deleteFromCleanupApps(appName)
-						eventingProducer.NotifyTopologyChange(topologyChangeMsg)
+					err = s.spawnAppWithRetry(appName, finishBootstrap)
+					if err != nil {
+						if err == errBootstrapRetrying {
+							continue
+						}
+						s.deleteFromBootstrappingApps(appName)
+						logging.Errorf("%s [%d] Function: %s spawning error: %v", logPrefix, s.runningFnsCount(), appName, err)
+						continue
 					}
-					s.appListRWMutex.Lock()
-					logging.Infof("%s [%d] Function: %s deleting from bootstrap list", logPrefix, s.runningFnsCount(), appName)
-					delete(s.bootstrappingApps, appName)
-					s.appListRWMutex.Unlock()
-					logging.Infof("%s [%d] Function: %s deployment done", logPrefix, s.runningFnsCount(), appName)
 				} else {
 					s.appRWMutex.Lock()
 					s.appDeploymentStatus[appName] = deploymentStatus
@@ -578,6 +629,10 @@ func (s *SuperSupervisor) TopologyChangeNotifCallback(kve metakv.KVEntry) error
 				}
 			}
 		}
+
+		s.settingsChangeMutex.Lock()
+		s.replayDeferredSettingsChanges()
+		s.settingsChangeMutex.Unlock()
 	} else {
 		// Empty value means no rebalance. We clear out the value from topologyChange when rebalance completes
 		// Need to think about it in mixed mode cluster
@@ -624,6 +679,16 @@ func (s *SuperSupervisor) HandleGlobalConfigChange(config common.Config) error {
 				s.updateQuotaForRunningFns()
 			}
 
+		case "memory_soft_limit":
+			if limit, ok := value.(float64); ok {
+				atomic.StoreInt64(&s.memorySoftLimit, int64(limit))
+			}
+
+		case "app_log_max_total_size":
+			if size, ok := value.(float64); ok {
+				atomic.StoreInt64(&s.appLogMaxTotalSize, int64(size))
+			}
+
 		case "function_size":
 			if size, ok := value.(float64); ok {
 				util.SetMaxFunctionSize(int(size))
@@ -641,6 +706,11 @@ func (s *SuperSupervisor) HandleGlobalConfigChange(config common.Config) error {
 					logPrefix, s.runningFnsCount(), util.HTTPRequestTimeout)
 			}
 
+		case "max_concurrent_vb_takeovers":
+			if limit, ok := value.(float64); ok {
+				s.updateMaxConcurrentVbTakeovers(int(limit))
+			}
+
 		case "breakpad_on":
 			if breakpad, ok := value.(bool); ok {
 				util.SetBreakpad(breakpad)
@@ -704,14 +774,12 @@ func (s *SuperSupervisor) spawnApp(appName string) error {
 
 	err := s.watchBucket(p.SourceBucket(), appName)
 	if err != nil {
-		util.Retry(util.NewExponentialBackoff(), &s.retryCount, undeployFunctionCallback, s, appName)
 		return err
 	}
 
 	err = s.watchBucketWithGocb(p.MetadataBucket(), appName)
 	if err != nil {
 		s.unwatchBucket(p.SourceBucket(), appName)
-		util.Retry(util.NewExponentialBackoff(), &s.retryCount, undeployFunctionCallback, s, appName)
 		return err
 	}
 
@@ -832,7 +900,7 @@ func (s *SuperSupervisor) CleanupProducer(appName string, skipMetaCleanup bool,
 		p.CleanupUDSs()
 
 		if !skipMetaCleanup {
-			p.CleanupMetadataBucket(false)
+			s.cleanupMetadata(appName, p)
 		}
 
 		s.unwatchBucket(p.SourceBucket(), appName)
@@ -0,0 +1,225 @@
+package supervisor
+
+import (
+	"sync"
+	"time"
+
+	"github.com/couchbase/eventing/logging"
+)
+
+// Default node-wide limit on vbucket takeovers in flight across all functions
+const defaultMaxConcurrentVbTakeovers = 128
+
+type takeoverWaiter struct {
+	granted chan struct{}
+	since   time.Time
+}
+
+type appTakeoverState struct {
+	waiters  []*takeoverWaiter
+	inflight int
+
+	grantCounter uint64
+	waitTotal    time.Duration
+	waitMax      time.Duration
+}
+
+// takeoverScheduler bounds vbucket takeovers running concurrently on the node,
+// when functions get rebalanced simultaneously. Freed up slots are handed out
+// round robin across functions waiting for one, so that a function with lots
+// of workers doesn't starve the rest
+type takeoverScheduler struct {
+	sync.Mutex
+	limit    int // 0 implies no limit
+	inflight int
+	apps     map[string]*appTakeoverState
+	order    []string
+	next     int
+}
+
+func newTakeoverScheduler() *takeoverScheduler {
+	return &takeoverScheduler{
+		limit: defaultMaxConcurrentVbTakeovers,
+		apps:  make(map[string]*appTakeoverState),
+	}
+}
+
+func (ts *takeoverScheduler) appState(appName string) *appTakeoverState {
+	state, ok := ts.apps[appName]
+	if !ok {
+		state = &appTakeoverState{}
+		ts.apps[appName] = state
+		ts.order = append(ts.order, appName)
+	}
+	return state
+}
+
+func (ts *takeoverScheduler) hasCapacity() bool {
+	return ts.limit == 0 || ts.inflight < ts.limit
+}
+
+func (ts *takeoverScheduler) grant(state *appTakeoverState, waited time.Duration) {
+	ts.inflight++
+	state.inflight++
+	state.grantCounter++
+	state.waitTotal += waited
+	if waited > state.waitMax {
+		state.waitMax = waited
+	}
+}
+
+// dispatch hands out free slots to waiting functions in round robin order
+func (ts *takeoverScheduler) dispatch() {
+	for ts.hasCapacity() {
+		granted := false
+		for i := 0; i < len(ts.order) && ts.hasCapacity(); i++ {
+			appName := ts.order[(ts.next+i)%len(ts.order)]
+			state := ts.apps[appName]
+			if len(state.waiters) == 0 {
+				continue
+			}
+
+			waiter := state.waiters[0]
+			state.waiters = state.waiters[1:]
+			ts.grant(state, time.Since(waiter.since))
+			close(waiter.granted)
+
+			ts.next = (ts.next + i + 1) % len(ts.order)
+			granted = true
+			break
+		}
+
+		if !granted {
+			return
+		}
+	}
+}
+
+func (ts *takeoverScheduler) acquire(appName string, cancelCh <-chan struct{}) bool {
+	ts.Lock()
+	state := ts.appState(appName)
+	if ts.hasCapacity() && ts.queued() == 0 {
+		ts.grant(state, 0)
+		ts.Unlock()
+		return true
+	}
+
+	waiter := &takeoverWaiter{granted: make(chan struct{}), since: time.Now()}
+	state.waiters = append(state.waiters, waiter)
+	ts.Unlock()
+
+	select {
+	case <-waiter.granted:
+		return true
+
+	case <-cancelCh:
+		ts.Lock()
+		defer ts.Unlock()
+
+		for i, w := range state.waiters {
+			if w == waiter {
+				state.waiters = append(state.waiters[:i], state.waiters[i+1:]...)
+				return false
+			}
+		}
+
+		// Slot got granted while cancelling, hand it over to someone else
+		ts.inflight--
+		state.inflight--
+		ts.dispatch()
+		return false
+	}
+}
+
+func (ts *takeoverScheduler) release(appName string) {
+	ts.Lock()
+	defer ts.Unlock()
+
+	state, ok := ts.apps[appName]
+	if !ok || state.inflight == 0 {
+		return
+	}
+
+	ts.inflight--
+	state.inflight--
+	ts.dispatch()
+}
+
+func (ts *takeoverScheduler) queued() int {
+	var count int
+	for _, state := range ts.apps {
+		count += len(state.waiters)
+	}
+	return count
+}
+
+func (ts *takeoverScheduler) setLimit(limit int) {
+	ts.Lock()
+	defer ts.Unlock()
+
+	ts.limit = limit
+	ts.dispatch()
+}
+
+// forget drops state of an undeployed function, its waiters bail out on their
+// cancel channels
+func (ts *takeoverScheduler) forget(appName string) {
+	ts.Lock()
+	defer ts.Unlock()
+
+	state, ok := ts.apps[appName]
+	if !ok || len(state.waiters) > 0 || state.inflight > 0 {
+		return
+	}
+
+	delete(ts.apps, appName)
+	for i, name := range ts.order {
+		if name == appName {
+			ts.order = append(ts.order[:i], ts.order[i+1:]...)
+			break
+		}
+	}
+	ts.next = 0
+}
+
+func (ts *takeoverScheduler) stats(appName string) map[string]uint64 {
+	ts.Lock()
+	defer ts.Unlock()
+
+	stats := make(map[string]uint64)
+	state, ok := ts.apps[appName]
+	if !ok || state.grantCounter == 0 {
+		return stats
+	}
+
+	stats["vb_takeover_slot_grant_counter"] = state.grantCounter
+	stats["vb_takeover_slot_inflight"] = uint64(state.inflight)
+	stats["vb_takeover_slot_waiting"] = uint64(len(state.waiters))
+	stats["vb_takeover_slot_wait_ms_total"] = uint64(state.waitTotal / time.Millisecond)
+	stats["vb_takeover_slot_wait_ms_max"] = uint64(state.waitMax / time.Millisecond)
+	return stats
+}
+
+// AcquireVbTakeoverSlot blocks till the function is granted a node-wide slot for
+// vbucket takeover, returns false if cancelCh got closed while waiting
+func (s *SuperSupervisor) AcquireVbTakeoverSlot(appName string, cancelCh <-chan struct{}) bool {
+	return s.takeoverScheduler.acquire(appName, cancelCh)
+}
+
+// ReleaseVbTakeoverSlot returns slot acquired for vbucket takeover
+func (s *SuperSupervisor) ReleaseVbTakeoverSlot(appName string) {
+	s.takeoverScheduler.release(appName)
+}
+
+// GetVbTakeoverSlotStats returns wait time stats of the function for vbucket takeover slots
+func (s *SuperSupervisor) GetVbTakeoverSlotStats(appName string) map[string]uint64 {
+	return s.takeoverScheduler.stats(appName)
+}
+
+func (s *SuperSupervisor) updateMaxConcurrentVbTakeovers(limit int) {
+	logPrefix := "SuperSupervisor::updateMaxConcurrentVbTakeovers"
+
+	s.takeoverScheduler.setLimit(limit)
+	logging.Infof("%s [%d] Updated node-wide limit on concurrent vb takeovers to: %d",
+		logPrefix, s.runningFnsCount(), limit)
+}
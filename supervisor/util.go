@@ -223,7 +223,7 @@ func (s *SuperSupervisor) watchBucketWithLock(bucketName, appName string) error
 	logPrefix := "Supervisor::watchBucketWithLock"
 	bucketWatch, ok := s.buckets[bucketName]
 	if !ok {
-		bucketWatch = &bucketWatchStruct{}
+		bucketWatch = &bucketWatchStruct{cids: newManifestCache()}
 		err := util.Retry(util.NewFixedBackoff(bucketOpRetryInterval), &s.retryCount, commonConnectBucketOpCallback, &bucketWatch.b, bucketName, s.restPort)
 		if err != nil {
 			logging.Errorf("%s: Could not connect to bucket %s err: %v", logPrefix, bucketName, err)
@@ -330,6 +330,16 @@ func (s *SuperSupervisor) checkDeletedCid(bucketName string) {
 		if err != nil || cid != sCid {
 			logging.Infof("%s Undeploying %s Reason: source collection delete err: %v", logPrefix, appName, err)
 			p.UndeployHandler(false)
+			continue
+		}
+
+		for srcCid, collection := range p.GetSourceCollectionIDs() {
+			cid, err = s.GetCollectionID(p.SourceBucket(), p.SourceScope(), collection)
+			if err != nil || cid != srcCid {
+				logging.Infof("%s Undeploying %s Reason: source collection: %s delete err: %v", logPrefix, appName, collection, err)
+				p.UndeployHandler(false)
+				break
+			}
 		}
 	}
 }
@@ -454,6 +464,13 @@ func (s *SuperSupervisor) watchBucketChanges() {
 				delChannel <- deletedBuckets
 			}
 
+		case msg := <-s.manifestRefreshCh:
+			if err := s.refreshManifest(msg); err != nil {
+				logging.Errorf("%s refreshManifest(): %v\n", logPrefix, err)
+				selfRestart()
+				return
+			}
+
 		case <-ticker.C:
 			deletedBuckets, err := s.bucketRefresh(nil)
 			if err != nil {
@@ -200,10 +200,12 @@ private:
 };
 
 Agent::Agent(std::string host_name, std::string host_name_display,
-             std::string file_path, int port, PostURLCallback on_connect)
+             std::string file_path, int port, std::string token,
+             PostURLCallback on_connect)
     : client_(nullptr), on_connect_(on_connect), platform_(nullptr),
       isolate_(nullptr), enabled_(false), port_(port), host_name_(host_name),
-      host_name_display_(host_name_display), file_path_(file_path) {}
+      host_name_display_(host_name_display), file_path_(file_path),
+      token_(token) {}
 
 // Destructor needs to be defined here in implementation file as the header
 // does not have full definition of some classes.
@@ -237,7 +239,7 @@ bool Agent::StartIoThread() {
   enabled_ = true;
   io_ = std::unique_ptr<InspectorIo>(new InspectorIo(
       isolate_, platform_, path_, host_name_, host_name_display_, true,
-      file_path_, port_, on_connect_));
+      file_path_, port_, token_, on_connect_));
   if (!io_->Start()) {
     client_.reset();
     return false;
@@ -29,8 +29,11 @@ class CBInspectorClient;
 
 class Agent {
 public:
+  // Frontends connect over websocket with token as target id, the upgrade is
+  // declined otherwise. A random target id is used if token is empty
   Agent(std::string host_name, std::string host_name_display,
-        std::string file_path, int port, PostURLCallback on_connect);
+        std::string file_path, int port, std::string token,
+        PostURLCallback on_connect);
   ~Agent();
 
   // Create client_, may create io_ if option enabled
@@ -79,6 +82,7 @@ private:
   std::string host_name_;
   std::string host_name_display_;
   std::string file_path_;
+  std::string token_;
 };
 
 } // namespace inspector
@@ -138,7 +138,8 @@ private:
 class InspectorIoDelegate : public inspector::SocketServerDelegate {
 public:
   InspectorIoDelegate(InspectorIo *io, const std::string &script_path,
-                      const std::string &script_name, bool wait);
+                      const std::string &script_name, bool wait,
+                      const std::string &token);
   // Calls PostIncomingMessage() with appropriate InspectorAction:
   //   kStartSession
   bool StartSession(int session_id, const std::string &target_id) override;
@@ -187,13 +188,14 @@ InspectorIo::InspectorIo(Isolate *isolate, Platform *platform,
                          const std::string &path, std::string host_name,
                          const std::string &host_name_display,
                          bool wait_for_connect, std::string file_path, int port,
-                         PostURLCallback on_connect)
+                         std::string token, PostURLCallback on_connect)
     : on_connect_(on_connect), delegate_(nullptr),
       state_(State::kNew), thread_req_(), platform_(platform),
       isolate_(isolate), dispatching_messages_(false), session_id_(0),
       script_name_(path), host_name_(host_name),
       host_name_display_(host_name_display), file_path_(file_path),
-      wait_for_connect_(wait_for_connect), port_(port), thread_() {
+      wait_for_connect_(wait_for_connect), port_(port), token_(token),
+      thread_() {
   main_thread_req_ = new AsyncAndAgent(
       {uv_async_t(), reinterpret_cast<Agent *>(isolate->GetData(1))});
   auto result = uv_async_init(uv_default_loop(), &main_thread_req_->first,
@@ -301,7 +303,7 @@ template <typename Transport> void InspectorIo::ThreadMain() {
   validate(err == 0);
   std::string script_path = ScriptPath(&loop, script_name_);
   InspectorIoDelegate delegate(this, script_path, script_name_,
-                               wait_for_connect_);
+                               wait_for_connect_, token_);
   delegate_ = &delegate;
   Transport server(&delegate, &loop, host_name_, host_name_display_, port_,
                    on_connect_, fopen(file_path_.c_str(), "w"));
@@ -454,9 +456,10 @@ void InspectorIo::Write(TransportAction action, int session_id,
 InspectorIoDelegate::InspectorIoDelegate(InspectorIo *io,
                                          const std::string &script_path,
                                          const std::string &script_name,
-                                         bool wait)
+                                         bool wait, const std::string &token)
     : io_(io), connected_(false), session_id_(0), script_name_(script_name),
-      script_path_(script_path), target_id_(GenerateID()), waiting_(wait) {}
+      script_path_(script_path),
+      target_id_(token.empty() ? GenerateID() : token), waiting_(wait) {}
 
 bool InspectorIoDelegate::StartSession(int session_id,
                                        const std::string &target_id) {
@@ -35,7 +35,7 @@ public:
   InspectorIo(Isolate *isolate, Platform *platform, const std::string &path,
               std::string host_name, const std::string &host_name_display,
               bool wait_for_connect, std::string file_path_, int port,
-              PostURLCallback on_connect);
+              std::string token, PostURLCallback on_connect);
 
   ~InspectorIo();
   // Start the inspector agent thread, waiting for it to initialize,
@@ -135,6 +135,7 @@ private:
   std::string file_path_;
   const bool wait_for_connect_;
   int port_;
+  std::string token_;
 
   // The IO thread runs its own uv_loop to implement the TCP server off
   // the main thread.
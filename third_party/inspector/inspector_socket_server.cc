@@ -334,21 +334,14 @@ bool InspectorSocketServer::HandleGetRequest(InspectorSocket *socket,
   if (command == nullptr)
     return false;
 
-  if (MatchPathSegment(command, "list") || command[0] == '\0') {
-    SendListResponse(socket);
-    return true;
-  } else if (MatchPathSegment(command, "protocol")) {
+  // Targets aren't listed, target id is the debug session token which gates the
+  // websocket upgrade. Frontend learns it only from url handed out by eventing
+  if (MatchPathSegment(command, "protocol")) {
     SendProtocolJson(socket);
     return true;
   } else if (MatchPathSegment(command, "version")) {
     SendVersionResponse(socket);
     return true;
-  } else if (const char *target_id = MatchPathSegment(command, "activate")) {
-    if (TargetExists(target_id)) {
-      SendHttpResponse(socket, "Target activated");
-      return true;
-    }
-    return false;
   }
   return false;
 }
@@ -0,0 +1,57 @@
+package timers
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Layout of timer store, shared with cpp worker which keeps timers of a function in
+// metadata keyspace, one store per partition. Alarms are chained per row of Resolution
+// secs, starting at seq InitSeq up to the counter kept at root of the row
+const (
+	Resolution  = int64(7) // seconds
+	InitSeq     = int64(128)
+	encode_base = 10 // TODO: Change to 36 before GA
+)
+
+type AlarmRecord struct {
+	AlarmDue   int64  `json:"due"`
+	ContextRef string `json:"cxr"`
+}
+
+type ContextRecord struct {
+	Context  interface{} `json:"ctx"`
+	AlarmRef string      `json:"alr"`
+}
+
+type Span struct {
+	Start int64 `json:"sta"`
+	Stop  int64 `json:"stp"`
+}
+
+// StoreKey returns prefix of keys of timer store of partition, uid being metadata
+// prefix of the function
+func StoreKey(uid string, partn int) string {
+	return fmt.Sprintf("%v:tm:%v", uid, partn)
+}
+
+func SpanKey(store string) string {
+	return store + ":sp"
+}
+
+func RootKey(store string, due int64) string {
+	return store + ":rt:" + formatInt(due)
+}
+
+func AlarmKey(store string, due int64, seq int64) string {
+	return fmt.Sprintf("%v:al:%v:%v", store, formatInt(due), seq)
+}
+
+// ContextKeyPrefix returns prefix of context keys, which are suffixed by hash of reference
+func ContextKeyPrefix(store string) string {
+	return store + ":cx:"
+}
+
+func formatInt(tm int64) string {
+	return strconv.FormatInt(tm, encode_base)
+}
@@ -1,3 +1,5 @@
+//go:build ignore
+
 /*
 package timers
 
@@ -19,11 +21,8 @@ import (
 
 // Constants
 const (
-	Resolution  = int64(7) // seconds
-	init_seq    = int64(128)
-	tail_time   = int64(60)
-	dict        = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789*&"
-	encode_base = 10 // TODO: Change to 36 before GA
+	tail_time = int64(60)
+	dict      = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789*&"
 )
 
 // Globals
@@ -38,16 +37,6 @@ type storeMap struct {
 	conflict   int64
 }
 
-type AlarmRecord struct {
-	AlarmDue   int64  `json:"due"`
-	ContextRef string `json:"cxr"`
-}
-
-type ContextRecord struct {
-	Context  interface{} `json:"ctx"`
-	AlarmRef string      `json:"alr"`
-}
-
 type TimerEntry struct {
 	AlarmRecord
 	ContextRecord
@@ -81,11 +70,6 @@ type colIter struct {
 	topCas  gocb.Cas
 }
 
-type Span struct {
-	Start int64 `json:"sta"`
-	Stop  int64 `json:"stp"`
-}
-
 type storeSpan struct {
 	Span
 	empty   bool
@@ -203,7 +187,7 @@ func (r *TimerStore) Set(due int64, ref string, context interface{}) error {
 
 	kv := Pool(r.connstr)
 	pos := r.kvLocatorRoot(due)
-	seq, _, err := kv.MustCounter(r.bucket, pos, 1, init_seq, 0)
+	seq, _, err := kv.MustCounter(r.bucket, pos, 1, InitSeq, 0)
 	if err != nil {
 		return err
 	}
@@ -426,7 +410,7 @@ func (r *TimerIter) nextRow() (bool, error) {
 			return false, err
 		}
 		if !absent {
-			r.col = &colIter{current: init_seq, stop: seq_end, topKey: pos, topCas: cas}
+			r.col = &colIter{current: InitSeq, stop: seq_end, topKey: pos, topCas: cas}
 			logging.Tracef("%v Found row %+v", r.store.log, r.row)
 			return true, nil
 		}
@@ -707,19 +691,19 @@ func hash(val string) string {
 }
 
 func (r *TimerStore) kvLocatorRoot(due int64) string {
-	return fmt.Sprintf("%v:tm:%v:rt:%v", r.uid, r.partn, formatInt(due))
+	return RootKey(StoreKey(r.uid, r.partn), due)
 }
 
 func (r *TimerStore) kvLocatorAlarm(due int64, seq int64) string {
-	return fmt.Sprintf("%v:tm:%v:al:%v:%v", r.uid, r.partn, formatInt(due), seq)
+	return AlarmKey(StoreKey(r.uid, r.partn), due, seq)
 }
 
 func (r *TimerStore) kvLocatorContext(ref string) string {
-	return fmt.Sprintf("%v:tm:%v:cx:%v", r.uid, r.partn, hash(ref))
+	return ContextKeyPrefix(StoreKey(r.uid, r.partn)) + hash(ref)
 }
 
 func (r *TimerStore) kvLocatorSpan() string {
-	return fmt.Sprintf("%v:tm:%v:sp", r.uid, r.partn)
+	return SpanKey(StoreKey(r.uid, r.partn))
 }
 
 func (r *TimerStore) Stats() map[string]uint64 {
@@ -743,10 +727,6 @@ func (r *ContextRecord) String() string {
 	return fmt.Sprintf(format, r.AlarmRef, r.Context)
 }
 
-func formatInt(tm int64) string {
-	return strconv.FormatInt(tm, encode_base)
-}
-
 func newStores() *storeMap {
 	smap := &storeMap{
 		entries:    make(map[string]*TimerStore),
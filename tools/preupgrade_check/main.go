@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+)
+
+var options struct {
+	all      bool
+	rbacPass string
+	rbacUser string
+	verbose  bool
+}
+
+type finding struct {
+	Category string `json:"category"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+type functionReadiness struct {
+	Name     string     `json:"name"`
+	Ready    bool       `json:"ready"`
+	Findings []*finding `json:"findings"`
+}
+
+type report struct {
+	Timestamp string               `json:"timestamp"`
+	Ready     bool                 `json:"ready"`
+	Functions []*functionReadiness `json:"functions"`
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s [OPTIONS] http://<eventing_node_ip>:<eventing_port>\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "Example: %s -user Administrator -pass asdasd http://127.0.0.1:8096\n", os.Args[0])
+	flag.PrintDefaults()
+}
+
+func argParse() string {
+	flag.BoolVar(&options.all, "all", false, "inspect undeployed functions as well")
+	flag.StringVar(&options.rbacPass, "pass", "asdasd", "rbac user password")
+	flag.StringVar(&options.rbacUser, "user", "Administrator", "rbac user name")
+	flag.BoolVar(&options.verbose, "v", false, "list functions without findings as well")
+
+	flag.Parse()
+
+	args := flag.Args()
+	if len(args) < 1 {
+		usage()
+		os.Exit(1)
+	}
+	return strings.TrimSuffix(args[0], "/")
+}
+
+func fetchReport(host string) (*report, error) {
+	url := fmt.Sprintf("%s/api/v1/preupgrade_check?all=%t", host, options.all)
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth(options.rbacUser, options.rbacPass)
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	buf, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code: %d, response: %s", res.StatusCode, string(buf))
+	}
+
+	var r report
+	err = json.Unmarshal(buf, &r)
+	return &r, err
+}
+
+// Inspects functions for settings, protocol features, timer store layout and handler
+// constructs that change behaviour in next release. Exits with status 2 if any
+// function isn't ready for upgrade
+func main() {
+	host := argParse()
+
+	r, err := fetchReport(host)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to run pre-upgrade check, err: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Pre-upgrade check at %s, functions inspected: %d\n\n", r.Timestamp, len(r.Functions))
+
+	for _, fn := range r.Functions {
+		if len(fn.Findings) == 0 && !options.verbose {
+			continue
+		}
+
+		status := "READY"
+		if !fn.Ready {
+			status = "NOT READY"
+		}
+		fmt.Printf("%s: %s\n", fn.Name, status)
+
+		for _, f := range fn.Findings {
+			fmt.Printf("\t[%s] %s: %s\n", strings.ToUpper(f.Severity), f.Category, f.Message)
+		}
+		fmt.Println()
+	}
+
+	if !r.Ready {
+		fmt.Println("Cluster isn't ready for upgrade, resolve blockers listed above")
+		os.Exit(2)
+	}
+	fmt.Println("Cluster is ready for upgrade")
+}
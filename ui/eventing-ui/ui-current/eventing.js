@@ -1774,6 +1774,9 @@ angular.module('eventing', [
                     return $q.reject(errMsg);
                   }
 
+                  // Debugger url is only handed out to the session holding its token.
+                  var debugToken = response.headers('X-Debugger-Token');
+
                   // Open the dialog to show the URL for debugging.
                   $uibModal.open({
                       templateUrl: '../_p/ui/event/ui-current/dialogs/app-debug.html',
@@ -1791,7 +1794,7 @@ angular.module('eventing', [
                   function getDebugUrl() {
                     console.log('Fetching debug url for ' + app
                       .appname);
-                    ApplicationService.debug.getUrl(app.appname)
+                    ApplicationService.debug.getUrl(app.appname, debugToken)
                       .then(function(response) {
                         var responseCode = ApplicationService.status
                           .getResponseCode(response);
@@ -2185,9 +2188,10 @@ angular.module('eventing', [
               data: nodesInfo
             });
           },
-          getUrl: function(appName) {
+          getUrl: function(appName, token) {
             return $http({
-              url: '/_p/event/getDebuggerUrl/?name=' + appName,
+              url: '/_p/event/getDebuggerUrl/?name=' + appName +
+                '&token=' + encodeURIComponent(token || ''),
               method: 'POST',
               mnHttp: {
                 isNotForm: true
@@ -39,6 +39,13 @@ const (
 	EVENTING_SSL_SERVICE   = "eventingSSL"
 )
 
+// Possible sources of eventing node weight for vbucket assignment
+const (
+	VbAssignmentWeightNone   = "none"
+	VbAssignmentWeightCPU    = "cpu"
+	VbAssignmentWeightMemory = "memory"
+)
+
 const CLUSTER_VERSION_7 uint32 = 7
 const CLUSTER_INFO_INIT_RETRIES = 5
 const CLUSTER_INFO_VALIDATION_RETRIES = 10
@@ -429,6 +436,16 @@ func (c *ClusterInfoCache) GetServiceAddress(nid NodeId, srvc string) (addr stri
 	return
 }
 
+// GetNodeCapacity returns cpu count and total memory reported by ns_server for the node
+func (c *ClusterInfoCache) GetNodeCapacity(nid NodeId) (cpuCount int, memoryTotal float64, err error) {
+	if int(nid) >= len(c.nodes) {
+		err = ErrInvalidNodeId
+		return
+	}
+
+	return c.nodes[nid].CpuCount, c.nodes[nid].MemoryTotal, nil
+}
+
 func (c *ClusterInfoCache) GetVBuckets(nid NodeId, bucket string) (vbs []uint32, err error) {
 	b, berr := c.pool.GetBucket(bucket)
 	if berr != nil {
@@ -917,6 +934,46 @@ func (c *ClusterInfoCache) FetchManifestInfo(bucketName string) error {
 	return nil
 }
 
+// GetMaintenanceNodes returns uuids of eventing nodes marked as "no new assignments"
+// in eventing config. Planner avoids placing vbuckets on these nodes
+func GetMaintenanceNodes() []string {
+	maintenanceNodes := make([]string, 0)
+
+	config := getConfig()
+	if val, ok := config["maintenance_nodes"]; ok {
+		if nodes, ok := val.([]interface{}); ok {
+			for _, node := range nodes {
+				if uuid, ok := node.(string); ok {
+					maintenanceNodes = append(maintenanceNodes, uuid)
+				}
+			}
+		}
+	}
+
+	return maintenanceNodes
+}
+
+// GetVbAssignmentWeight returns source used to weigh eventing nodes while
+// planning vbucket assignment. Nodes are weighed equally by default
+func GetVbAssignmentWeight() string {
+	config := getConfig()
+	if val, ok := config["vb_assignment_weight"].(string); ok {
+		return val
+	}
+	return VbAssignmentWeightNone
+}
+
+// IsStickyVbAssignment returns whether vbucket assignment should be derived from
+// the previous one, so that only the delta moves on topology change. Every eventing
+// node must plan alike, hence it's off unless turned on once all nodes support it
+func IsStickyVbAssignment() bool {
+	config := getConfig()
+	if val, ok := config["sticky_vb_assignment"].(bool); ok {
+		return val
+	}
+	return false
+}
+
 func getConfig() (c common.Config) {
 
 	data, err := MetakvGet(common.MetakvConfigPath)
@@ -0,0 +1,56 @@
+package util
+
+import (
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/couchbase/eventing/common"
+)
+
+// Histogram tracks distribution of durations over fixed buckets. Observations are
+// lock free, so that it could be shared across consumers of a function
+type Histogram struct {
+	boundsMs []int64
+	counts   []uint64 // Last bucket tracks observations exceeding all bounds
+	sumMs    uint64
+}
+
+// NewHistogram returns a histogram with given bucket upper bounds in milliseconds,
+// which are expected to be sorted
+func NewHistogram(boundsMs []int64) *Histogram {
+	return &Histogram{
+		boundsMs: boundsMs,
+		counts:   make([]uint64, len(boundsMs)+1),
+	}
+}
+
+func (h *Histogram) Observe(d time.Duration) {
+	elapsedMs := int64(d / time.Millisecond)
+	bucket := sort.Search(len(h.boundsMs), func(i int) bool {
+		return elapsedMs <= h.boundsMs[i]
+	})
+
+	atomic.AddUint64(&h.counts[bucket], 1)
+	if elapsedMs > 0 {
+		atomic.AddUint64(&h.sumMs, uint64(elapsedMs))
+	}
+}
+
+// Snapshot returns counts cumulative per bucket upper bound. Total count is derived
+// from the same bucket loads, so that it's never short of the last cumulative count
+func (h *Histogram) Snapshot() *common.Histogram {
+	snapshot := &common.Histogram{
+		BoundsMs: append([]int64(nil), h.boundsMs...),
+		Counts:   make([]uint64, len(h.boundsMs)),
+		SumMs:    atomic.LoadUint64(&h.sumMs),
+	}
+
+	var cumulative uint64
+	for i := range h.boundsMs {
+		cumulative += atomic.LoadUint64(&h.counts[i])
+		snapshot.Counts[i] = cumulative
+	}
+	snapshot.Count = cumulative + atomic.LoadUint64(&h.counts[len(h.boundsMs)])
+	return snapshot
+}
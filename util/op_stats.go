@@ -0,0 +1,149 @@
+package util
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/couchbase/eventing/common"
+	"github.com/couchbase/gocb/v2"
+)
+
+// Upper bounds of latency histogram buckets in milliseconds. Calls slower than
+// the last bound are counted against "+Inf"
+var opLatencyBucketsMs = []int64{1, 2, 5, 10, 20, 50, 100, 200, 500, 1000, 2000, 5000, 10000}
+
+// OpStats captures metrics of an external call made by a retry callback. Every
+// failed call gets retried by Retry, unless retry budget of caller is exhausted
+type OpStats struct {
+	Calls     uint64            `json:"calls"`
+	Failures  uint64            `json:"failures"`
+	Errors    map[string]uint64 `json:"errors,omitempty"` // Failures per error class
+	LatencyMs common.StatsData  `json:"latency_ms"`       // Calls per latency bucket upper bound
+}
+
+type opMetrics struct {
+	calls    uint64
+	failures uint64
+	latency  []uint64 // Last bucket tracks calls exceeding all bounds
+
+	errorsMutex *sync.Mutex
+	errors      map[string]uint64
+}
+
+var (
+	opRegistryMutex = &sync.RWMutex{}
+	opRegistry      = make(map[string]*opMetrics)
+)
+
+// InstrumentOp wraps a retry callback, recording latency and failures of every
+// call under name. Callbacks are expected to be wrapped at package init
+func InstrumentOp(name string, callback CallbackFunc) CallbackFunc {
+	opRegistryMutex.Lock()
+	m, ok := opRegistry[name]
+	if !ok {
+		m = &opMetrics{
+			latency:     make([]uint64, len(opLatencyBucketsMs)+1),
+			errorsMutex: &sync.Mutex{},
+			errors:      make(map[string]uint64),
+		}
+		opRegistry[name] = m
+	}
+	opRegistryMutex.Unlock()
+
+	return func(args ...interface{}) error {
+		start := time.Now()
+		err := callback(args...)
+		m.record(time.Since(start), err)
+		return err
+	}
+}
+
+func (m *opMetrics) record(elapsed time.Duration, err error) {
+	atomic.AddUint64(&m.calls, 1)
+
+	elapsedMs := int64(elapsed / time.Millisecond)
+	bucket := sort.Search(len(opLatencyBucketsMs), func(i int) bool {
+		return elapsedMs <= opLatencyBucketsMs[i]
+	})
+	atomic.AddUint64(&m.latency[bucket], 1)
+
+	if err == nil {
+		return
+	}
+	atomic.AddUint64(&m.failures, 1)
+
+	class := classifyOpError(err)
+	m.errorsMutex.Lock()
+	m.errors[class]++
+	m.errorsMutex.Unlock()
+}
+
+func (m *opMetrics) snapshot() *OpStats {
+	stats := &OpStats{
+		Calls:     atomic.LoadUint64(&m.calls),
+		Failures:  atomic.LoadUint64(&m.failures),
+		LatencyMs: make(common.StatsData),
+	}
+
+	for i := range m.latency {
+		count := atomic.LoadUint64(&m.latency[i])
+		if count == 0 {
+			continue
+		}
+		if i < len(opLatencyBucketsMs) {
+			stats.LatencyMs[strconv.FormatInt(opLatencyBucketsMs[i], 10)] = count
+		} else {
+			stats.LatencyMs["+Inf"] = count
+		}
+	}
+
+	m.errorsMutex.Lock()
+	if len(m.errors) > 0 {
+		stats.Errors = make(map[string]uint64, len(m.errors))
+		for class, count := range m.errors {
+			stats.Errors[class] = count
+		}
+	}
+	m.errorsMutex.Unlock()
+	return stats
+}
+
+// GetOpStats returns metrics of all instrumented callbacks of the process
+func GetOpStats() map[string]*OpStats {
+	opRegistryMutex.RLock()
+	defer opRegistryMutex.RUnlock()
+
+	stats := make(map[string]*OpStats, len(opRegistry))
+	for name, m := range opRegistry {
+		stats[name] = m.snapshot()
+	}
+	return stats
+}
+
+func classifyOpError(err error) string {
+	switch {
+	case err == common.ErrRetryTimeout:
+		return "retry_timeout"
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return "cancelled"
+	case errors.Is(err, gocb.ErrDocumentNotFound):
+		return "not_found"
+	case errors.Is(err, gocb.ErrCasMismatch), errors.Is(err, gocb.ErrDocumentExists):
+		return "cas_mismatch"
+	case errors.Is(err, gocb.ErrTimeout):
+		return "timeout"
+	case errors.Is(err, gocb.ErrTemporaryFailure):
+		return "temporary_failure"
+	}
+
+	if _, ok := err.(net.Error); ok {
+		return "network"
+	}
+	return "other"
+}
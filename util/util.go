@@ -49,6 +49,8 @@ const (
 	DataServiceSSL       = "kvSSL"
 	MgmtService          = "mgmt"
 	MgmtServiceSSL       = "mgmtSSL"
+	QueryService         = "n1ql"
+	QueryServiceSSL      = "n1qlSSL"
 
 	EPSILON = 1e-5
 	dict    = "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ*&"
@@ -276,6 +278,35 @@ func NsServerNodesAddresses(auth, hostaddress string) ([]string, error) {
 	return nsServerNodes, nil
 }
 
+// QueryNodesAddresses returns query service endpoints of nodes running N1QL
+func QueryNodesAddresses(auth, hostaddress string) ([]string, error) {
+	logPrefix := "util::QueryNodesAddresses"
+	cic, err := FetchClusterInfoClient(hostaddress)
+	if err != nil {
+		return nil, err
+	}
+	cinfo := cic.GetClusterInfoCache()
+	cinfo.RLock()
+	defer cinfo.RUnlock()
+
+	service := QueryService
+	if couchbase.GetUseTLS() {
+		service = QueryServiceSSL
+	}
+
+	queryNodes := []string{}
+	for _, nid := range cinfo.GetNodesByServiceType(service) {
+		addr, err := cinfo.GetServiceAddress(nid, service)
+		if err != nil {
+			logging.Errorf("%s Failed to get query node address, err: %v", logPrefix, err)
+			continue
+		}
+		queryNodes = append(queryNodes, addr)
+	}
+	sort.Strings(queryNodes)
+	return queryNodes, nil
+}
+
 func KVNodesAddresses(auth, hostaddress, bucket string) ([]string, error) {
 	cic, err := FetchClusterInfoClient(hostaddress)
 	if err != nil {
@@ -363,6 +394,62 @@ func EventingNodesAddresses(auth, hostaddress string) ([]string, error) {
 	return eventingNodes, nil
 }
 
+// EventingNodesWeights returns weight of each eventing node keyed by its address,
+// as reported by ns_server for requested weight source
+func EventingNodesWeights(hostaddress, source string) (map[string]float64, error) {
+	logPrefix := "util::EventingNodesWeights"
+	cic, err := FetchClusterInfoClient(hostaddress)
+	if err != nil {
+		return nil, err
+	}
+	cinfo := cic.GetClusterInfoCache()
+	cinfo.RLock()
+	defer cinfo.RUnlock()
+
+	var eventingAddrs []NodeId
+	if getLocalUseTLS() {
+		eventingAddrs = cinfo.GetNodesByServiceType(EventingAdminSSL)
+	} else {
+		eventingAddrs = cinfo.GetNodesByServiceType(EventingAdminService)
+	}
+
+	// Addresses are derived the same way as EventingNodesAddresses, so that
+	// weights can be looked up against the planner's eventing node list
+	weights := make(map[string]float64)
+	for _, nid := range eventingAddrs {
+		var addr string
+		if getLocalUseTLS() {
+			addr, err = cinfo.GetServiceAddress(nid, EventingAdminSSL)
+			host, _, _ := net.SplitHostPort(addr)
+			ip := net.ParseIP(host)
+			if err == nil && (ip == nil && strings.EqualFold(host, "localhost")) || (ip != nil && ip.IsLoopback()) {
+				addr, err = cinfo.GetServiceAddress(nid, EventingAdminService)
+			}
+		} else {
+			addr, err = cinfo.GetServiceAddress(nid, EventingAdminService)
+		}
+		if err != nil {
+			logging.Errorf("%s Failed to get eventing node address, err: %v", logPrefix, err)
+			return nil, err
+		}
+
+		cpuCount, memoryTotal, err := cinfo.GetNodeCapacity(nid)
+		if err != nil {
+			return nil, err
+		}
+
+		switch source {
+		case VbAssignmentWeightCPU:
+			weights[addr] = float64(cpuCount)
+		case VbAssignmentWeightMemory:
+			weights[addr] = memoryTotal
+		default:
+			weights[addr] = 1
+		}
+	}
+	return weights, nil
+}
+
 func CurrentEventingNodeAddress(auth, hostaddress string) (string, error) {
 	logPrefix := "util::CurrentEventingNodeAddress"
 
@@ -733,7 +820,7 @@ func MetakvGet(path string) ([]byte, error) {
 	return data, err
 }
 
-var metakvSetCallback = func(args ...interface{}) error {
+var metakvSetCallback = InstrumentOp("util.metakv_set", func(args ...interface{}) error {
 	logPrefix := "Util::metakvSetCallback"
 
 	metakvPath := args[0].(string)
@@ -745,13 +832,13 @@ var metakvSetCallback = func(args ...interface{}) error {
 		logging.Errorf("%s metakv set failed for path: %s, err: %v", logPrefix, metakvPath, err)
 	}
 	return err
-}
+})
 
 func MetakvSet(path string, value []byte, rev interface{}) error {
 	return Retry(NewFixedBackoff(time.Second), &cm.MetakvMaxRetries, metakvSetCallback, path, value, rev)
 }
 
-var metakvSetSensitiveCallback = func(args ...interface{}) error {
+var metakvSetSensitiveCallback = InstrumentOp("util.metakv_set_sensitive", func(args ...interface{}) error {
 	logPrefix := "Util::metakvSetSensitiveCallback"
 
 	metakvPath := args[0].(string)
@@ -763,13 +850,13 @@ var metakvSetSensitiveCallback = func(args ...interface{}) error {
 		logging.Errorf("%s metakv set sensitive failed for path: %s, err: %v", logPrefix, metakvPath, err)
 	}
 	return err
-}
+})
 
 func MetakvSetSensitive(path string, value []byte, rev interface{}) error {
 	return Retry(NewFixedBackoff(time.Second), &cm.MetakvMaxRetries, metakvSetSensitiveCallback, path, value, rev)
 }
 
-var metakvDelCallback = func(args ...interface{}) error {
+var metakvDelCallback = InstrumentOp("util.metakv_del", func(args ...interface{}) error {
 	logPrefix := "Util::metakvDelCallback"
 
 	metakvPath := args[0].(string)
@@ -780,13 +867,13 @@ var metakvDelCallback = func(args ...interface{}) error {
 		logging.Errorf("%s metakv delete failed for path: %s, err: %v", logPrefix, metakvPath, err)
 	}
 	return err
-}
+})
 
 func MetaKvDelete(path string, rev interface{}) error {
 	return Retry(NewFixedBackoff(time.Second), &cm.MetakvMaxRetries, metakvDelCallback, path, rev)
 }
 
-var metakvRecDelCallback = func(args ...interface{}) error {
+var metakvRecDelCallback = InstrumentOp("util.metakv_rec_del", func(args ...interface{}) error {
 	logPrefix := "Util::metakvRecDelCallback"
 
 	metakvPath := args[0].(string)
@@ -796,7 +883,7 @@ var metakvRecDelCallback = func(args ...interface{}) error {
 		logging.Errorf("%s metakv recursive delete failed for path: %s, err: %v", logPrefix, metakvPath, err)
 	}
 	return err
-}
+})
 
 func MetakvRecursiveDelete(dirpath string) error {
 	return Retry(NewFixedBackoff(time.Second), &cm.MetakvMaxRetries, metakvRecDelCallback, dirpath)
@@ -982,6 +1069,14 @@ func DeleteAppContent(appPath, checksumPath, appName string) error {
 		return err
 	}
 
+	if err := MetaKvDelete(cm.MetakvVbPlanPath+appName, nil); err != nil {
+		logging.Infof("%s Function: %s failed to delete vbucket plan, err: %v", logPrefix, appName, err)
+	}
+
+	if err := MetaKvDelete(cm.MetakvPausedVbsPath+appName, nil); err != nil {
+		logging.Infof("%s Function: %s failed to delete paused vbuckets, err: %v", logPrefix, appName, err)
+	}
+
 	return nil
 }
 
@@ -1779,6 +1874,38 @@ func ParseXattrData(xattrPrefix string, data []byte) (body, xattr []byte, err er
 	return body, nil, nil
 }
 
+// ParseXattrs returns document body along with all xattr key value pairs
+func ParseXattrs(data []byte) (body []byte, xattrs map[string][]byte, err error) {
+	length := len(data)
+	if length < 4 {
+		return nil, nil, fmt.Errorf("empty xattr metadata")
+	}
+	xattrLen := binary.BigEndian.Uint32(data[0:4])
+	if int(xattrLen+4) > length {
+		return nil, nil, fmt.Errorf("xattr parse error, xattr length exceeds data length")
+	}
+	body = data[xattrLen+4:]
+	xattrs = make(map[string][]byte)
+
+	index := uint32(4)
+	delimeter := []byte("\x00")
+	for index < xattrLen {
+		keyValPairLen := binary.BigEndian.Uint32(data[index : index+4])
+		if keyValPairLen == 0 || int(index+keyValPairLen) > length {
+			return body, xattrs, fmt.Errorf("xattr parse error, unexpected xattr data")
+		}
+		index += 4
+		keyValPairData := data[index : index+keyValPairLen]
+		keyValPair := bytes.Split(keyValPairData, delimeter)
+		if len(keyValPair) != 3 {
+			return body, xattrs, fmt.Errorf("xattr parse error, unexpected number of components")
+		}
+		xattrs[string(keyValPair[0])] = keyValPair[1]
+		index += keyValPairLen
+	}
+	return body, xattrs, nil
+}
+
 func MaybeCompress(payload []byte, compressPayload bool) ([]byte, error) {
 	if compressPayload {
 		var buf bytes.Buffer
@@ -1887,12 +2014,14 @@ func EncodeAppPayload(app *cm.Application) []byte {
 		bAccess := builder.CreateString(app.DeploymentConfig.Buckets[i].Access)
 		sName := builder.CreateString(app.DeploymentConfig.Buckets[i].ScopeName)
 		cName := builder.CreateString(app.DeploymentConfig.Buckets[i].CollectionName)
+		durability := builder.CreateString(app.DeploymentConfig.Buckets[i].Durability)
 
 		cfg.BucketStart(builder)
 		cfg.BucketAddAlias(builder, alias)
 		cfg.BucketAddBucketName(builder, bName)
 		cfg.BucketAddScopeName(builder, sName)
 		cfg.BucketAddCollectionName(builder, cName)
+		cfg.BucketAddDurability(builder, durability)
 		csBucket := cfg.BucketEnd(builder)
 
 		bNames = append(bNames, csBucket)
@@ -1918,6 +2047,50 @@ func EncodeAppPayload(app *cm.Application) []byte {
 	sourceScope := builder.CreateString(app.DeploymentConfig.SourceScope)
 	sourceCollection := builder.CreateString(app.DeploymentConfig.SourceCollection)
 
+	var sourceCollections []flatbuffers.UOffsetT
+	for _, collection := range app.DeploymentConfig.SourceCollections {
+		sourceCollections = append(sourceCollections, builder.CreateString(collection))
+	}
+
+	cfg.DepCfgStartSourceCollectionsVector(builder, len(sourceCollections))
+	for i := len(sourceCollections) - 1; i >= 0; i-- {
+		builder.PrependUOffsetT(sourceCollections[i])
+	}
+	sourceCollectionsVector := builder.EndVector(len(sourceCollections))
+
+	var keyPrefixes []flatbuffers.UOffsetT
+	for _, prefix := range app.DeploymentConfig.KeyPrefixes {
+		keyPrefixes = append(keyPrefixes, builder.CreateString(prefix))
+	}
+
+	cfg.DepCfgStartKeyPrefixesVector(builder, len(keyPrefixes))
+	for i := len(keyPrefixes) - 1; i >= 0; i-- {
+		builder.PrependUOffsetT(keyPrefixes[i])
+	}
+	keyPrefixesVector := builder.EndVector(len(keyPrefixes))
+
+	var keyPatterns []flatbuffers.UOffsetT
+	for _, pattern := range app.DeploymentConfig.KeyPatterns {
+		keyPatterns = append(keyPatterns, builder.CreateString(pattern))
+	}
+
+	cfg.DepCfgStartKeyPatternsVector(builder, len(keyPatterns))
+	for i := len(keyPatterns) - 1; i >= 0; i-- {
+		builder.PrependUOffsetT(keyPatterns[i])
+	}
+	keyPatternsVector := builder.EndVector(len(keyPatterns))
+
+	var dependsOn []flatbuffers.UOffsetT
+	for _, dependency := range app.DeploymentConfig.DependsOn {
+		dependsOn = append(dependsOn, builder.CreateString(dependency))
+	}
+
+	cfg.DepCfgStartDependsOnVector(builder, len(dependsOn))
+	for i := len(dependsOn) - 1; i >= 0; i-- {
+		builder.PrependUOffsetT(dependsOn[i])
+	}
+	dependsOnVector := builder.EndVector(len(dependsOn))
+
 	cfg.DepCfgStart(builder)
 	cfg.DepCfgAddBuckets(builder, buckets)
 	cfg.DepCfgAddMetadataBucket(builder, metaBucket)
@@ -1926,6 +2099,10 @@ func EncodeAppPayload(app *cm.Application) []byte {
 	cfg.DepCfgAddSourceCollection(builder, sourceCollection)
 	cfg.DepCfgAddSourceScope(builder, sourceScope)
 	cfg.DepCfgAddMetadataScope(builder, metadataScope)
+	cfg.DepCfgAddSourceCollections(builder, sourceCollectionsVector)
+	cfg.DepCfgAddKeyPrefixes(builder, keyPrefixesVector)
+	cfg.DepCfgAddKeyPatterns(builder, keyPatternsVector)
+	cfg.DepCfgAddDependsOn(builder, dependsOnVector)
 
 	depcfg := cfg.DepCfgEnd(builder)
 
@@ -1993,6 +2170,18 @@ func ParseFunctionPayload(data []byte, fnName string) cm.Application {
 	depcfg.SourceCollection = cm.CheckAndReturnDefaultForScopeOrCollection(string(dcfg.SourceCollection()))
 	depcfg.MetadataCollection = cm.CheckAndReturnDefaultForScopeOrCollection(string(dcfg.MetadataCollection()))
 	depcfg.MetadataScope = cm.CheckAndReturnDefaultForScopeOrCollection(string(dcfg.MetadataScope()))
+	for i := 0; i < dcfg.SourceCollectionsLength(); i++ {
+		depcfg.SourceCollections = append(depcfg.SourceCollections, string(dcfg.SourceCollections(i)))
+	}
+	for i := 0; i < dcfg.KeyPrefixesLength(); i++ {
+		depcfg.KeyPrefixes = append(depcfg.KeyPrefixes, string(dcfg.KeyPrefixes(i)))
+	}
+	for i := 0; i < dcfg.KeyPatternsLength(); i++ {
+		depcfg.KeyPatterns = append(depcfg.KeyPatterns, string(dcfg.KeyPatterns(i)))
+	}
+	for i := 0; i < dcfg.DependsOnLength(); i++ {
+		depcfg.DependsOn = append(depcfg.DependsOn, string(dcfg.DependsOn(i)))
+	}
 
 	var buckets []cm.Bucket
 	b := new(cfg.Bucket)
@@ -2005,6 +2194,7 @@ func ParseFunctionPayload(data []byte, fnName string) cm.Application {
 				Access:         string(config.Access(i)),
 				ScopeName:      cm.CheckAndReturnDefaultForScopeOrCollection(string(b.ScopeName())),
 				CollectionName: cm.CheckAndReturnDefaultForScopeOrCollection(string(b.CollectionName())),
+				Durability:     string(b.Durability()),
 			}
 			buckets = append(buckets, newBucket)
 		}
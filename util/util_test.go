@@ -0,0 +1,87 @@
+package util
+
+import (
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+// encodeXattrs lays out xattrs the way KV sends them ahead of document body
+func encodeXattrs(pairs [][2]string, body string) []byte {
+	var section []byte
+	for _, pair := range pairs {
+		kv := []byte(pair[0] + "\x00" + pair[1] + "\x00")
+		section = append(section, encodeLength(len(kv))...)
+		section = append(section, kv...)
+	}
+
+	data := append(encodeLength(len(section)), section...)
+	return append(data, body...)
+}
+
+func encodeLength(length int) []byte {
+	data := make([]byte, 4)
+	binary.BigEndian.PutUint32(data, uint32(length))
+	return data
+}
+
+func TestParseXattrs(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     []byte
+		body     string
+		xattrs   map[string][]byte
+		hasError bool
+	}{
+		{
+			name:   "single xattr",
+			data:   encodeXattrs([][2]string{{"_sync", `{"rev":"1-a"}`}}, `{"a":1}`),
+			body:   `{"a":1}`,
+			xattrs: map[string][]byte{"_sync": []byte(`{"rev":"1-a"}`)},
+		},
+		{
+			name:   "multiple xattrs",
+			data:   encodeXattrs([][2]string{{"a", `1`}, {"b", `"x"`}}, `{}`),
+			body:   `{}`,
+			xattrs: map[string][]byte{"a": []byte(`1`), "b": []byte(`"x"`)},
+		},
+		{
+			name:   "no xattrs",
+			data:   encodeXattrs(nil, `{}`),
+			body:   `{}`,
+			xattrs: map[string][]byte{},
+		},
+		{
+			name:     "too short",
+			data:     []byte{0, 0},
+			hasError: true,
+		},
+		{
+			name:     "length beyond data",
+			data:     []byte{0, 0, 0, 10, 0},
+			hasError: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			body, xattrs, err := ParseXattrs(test.data)
+			if test.hasError {
+				if err == nil {
+					t.Errorf("expected error, got body: %s xattrs: %v", body, xattrs)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("failed to parse, err: %v", err)
+			}
+			if string(body) != test.body {
+				t.Errorf("body: %s expected: %s", body, test.body)
+			}
+			if !reflect.DeepEqual(xattrs, test.xattrs) {
+				t.Errorf("xattrs: %s expected: %s", xattrs, test.xattrs)
+			}
+		})
+	}
+}
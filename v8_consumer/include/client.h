@@ -26,7 +26,31 @@ const size_t MAX_BUF_SIZE = 65536;
 const int HEADER_FRAGMENT_SIZE = 4;  // uint32
 const int PAYLOAD_FRAGMENT_SIZE = 4; // uint32
 const int SIZEOF_UINT32 = 4;
+// Set on length prefix of a frame which carries a batch of messages, rather
+// than a single one
+const uint32_t BATCH_FRAME_FLAG = 1u << 31;
+// Set on length prefix of a batch frame which carries CRC32C of its body right
+// after the prefix
+const uint32_t CHECKSUM_FRAME_FLAG = 1u << 30;
+// Version of message set spoken with eventing-consumer, to be bumped whenever
+// messages change in ways older consumers would misinterpret. Should be in sync
+// with workerProtocolVersion on Go side
+const int PROTOCOL_VERSION = 5;
+const int MIN_PROTOCOL_VERSION = 1;
+// Responses are batched into a single frame since this version
+const int PROTOCOL_VERSION_BATCH_FRAMES = 2;
+// Batch frames could carry checksums since this version
+const int PROTOCOL_VERSION_FRAME_CHECKSUMS = 3;
+// Docs written by handler could be stamped with origin tag since this version
+const int PROTOCOL_VERSION_ORIGIN_TAGS = 4;
+// Expirations arrive with their own dcp opcode since this version
+const int PROTOCOL_VERSION_EXPIRATION_OPCODE = 5;
 const size_t MAX_V8_HEAP_SIZE = 1.4 * 1024 * 1024 * 1024;
+// Handler code larger than this is expected to arrive in chunks
+const size_t MAX_LOAD_CHUNK_SIZE = 512 * 1024;
+// Version of JSON stats payloads sent to eventing-producer, to be bumped
+// whenever existing fields change their type or meaning
+const int STATS_PAYLOAD_VERSION = 1;
 
 int64_t timer_context_size;
 
@@ -49,6 +73,14 @@ public:
   std::vector<char> *GetReadBufferFeedback();
 
   void FlushToConn(uv_stream_t *stream, char *buffer, int length);
+  void FlushResponses(uv_stream_t *stream,
+                      const std::vector<resp_msg_t> &responses);
+  void ReportCorruptFrame(uv_stream_t *stream, uint32_t checksum,
+                          const std::string &batch);
+
+  // Tag bucket ops stamp as _eventing.origin on docs written by handler, along
+  // with seqno of the write. Empty if origin tagging wasn't asked for
+  std::string GetOriginTag();
 
   void InitTcpSock(const std::string &function_name,
                    const std::string &function_id,
@@ -71,7 +103,13 @@ public:
   static std::pair<bool, std::unique_ptr<WorkerMessage>>
   GetWorkerMessage(int encoded_header_size, int encoded_payload_size,
                    const std::string &msg);
+  static std::pair<bool, std::vector<std::unique_ptr<WorkerMessage>>>
+  GetWorkerMessages(const std::string &batch);
+  static std::pair<bool, std::unique_ptr<WorkerMessage>>
+  ParseWorkerMessage(std::unique_ptr<WorkerMessage> worker_msg);
   void ParseValidChunk(uv_stream_t *stream, int nread, const char *buf);
+  void ProcessWorkerMessage(uv_stream_t *stream,
+                            std::unique_ptr<WorkerMessage> worker_msg);
 
   void RouteMessageWithResponse(std::unique_ptr<WorkerMessage> worker_msg);
 
@@ -89,7 +127,7 @@ public:
   static void StopUvLoop(uv_async_t *);
 
   void SendFilterAck(int opcode, int msgtype, int vb_no, int64_t seq_no,
-                     bool skip_ack);
+                     uint64_t acked_seq_no, bool skip_ack);
 
   void SetNsServerPort(const std::string &port) { ns_server_port_ = port; }
   void SetNumVbuckets(const int32_t &num_vbuckets) {
@@ -105,6 +143,25 @@ public:
 
   size_t memory_quota_;
 
+  // Timer callbacks and DCP events a worker thread dispatches in turns
+  int64_t timer_lane_batch_size_{100};
+  int64_t dcp_lane_batch_size_{100};
+
+  // Retries of handler for a mutation before it's dead lettered, negative
+  // if dead letter keyspace isn't configured
+  int64_t dead_letter_retry_count_{-1};
+
+  // Retry policy of the handler, retry_on_ is a mask of handler_failure_kind
+  int64_t retry_count_{0};
+  int64_t retry_backoff_ms_{0};
+  int64_t retry_on_{fTimeout | fLcbError};
+
+  bool strict_order_check_{false};
+
+  // Worker thread that runs OnEvent for the next bus event, bus events aren't
+  // tied to a vb and are spread across worker threads in turns
+  int16_t bus_worker_idx_{0};
+
 protected:
   void WriteResponseWithRetry(uv_stream_t *handle,
                               std::vector<uv_buf_t> messages,
@@ -122,7 +179,14 @@ private:
   std::vector<std::unordered_set<int64_t>>
   PartitionVbuckets(const std::vector<int64_t> &vbuckets) const;
 
-  void SendPauseAck(const std::unordered_map<int64_t, uint64_t> &lps_map);
+  void SendPauseAck(
+      const std::unordered_map<int64_t, std::pair<uint64_t, uint64_t>>
+          &lps_map);
+
+  void LoadHandlerCode(const std::string &app_code);
+
+  std::string AssembleLoadChunks(const std::string &commit);
+  std::string NegotiateProtocol(const std::string &handshake);
 
   std::thread write_responses_thr_;
   std::map<int16_t, V8Worker *> workers_;
@@ -130,6 +194,7 @@ private:
 
   Histogram latency_stats_;
   Histogram curl_latency_stats_;
+  Histogram n1ql_latency_stats_;
 
   // Socket  handles for out of band data channel to pipeline data to parent
   // eventing-producer
@@ -186,8 +251,22 @@ private:
 
   bool msg_priority_;
 
+  // Protocol version settled with eventing-consumer by handshake, consumers
+  // which don't handshake are spoken to in the oldest one
+  std::atomic<int> protocol_version_{MIN_PROTOCOL_VERSION};
+  // Set if eventing-consumer asked for frames to be checksummed
+  std::atomic<bool> frame_checksums_{false};
+  // Set once a frame fails checksum, nothing read past it can be trusted
+  std::atomic<bool> frame_corrupted_{false};
+  // Origin tag handed out by eventing-consumer during handshake
+  std::mutex origin_tag_lck_;
+  std::string origin_tag_;
+
   bool using_timer_{false};
 
+  // Handler code chunks received so far, keyed by chunk sequence number
+  std::map<int16_t, std::string> load_chunks_;
+
   std::vector<char> read_buffer_main_;
 
   std::vector<char> read_buffer_feedback_;
@@ -195,6 +274,7 @@ private:
   std::atomic<bool> thread_exit_cond_;
   std::atomic<bool> pause_consumer_;
   bool v8worker_init_done_{false};
+  bool handler_loaded_{false};
   std::mutex workers_map_mutex_;
 
   std::shared_ptr<vb_seq_map_t> vb_seq_;
@@ -24,6 +24,7 @@ enum event_type {
   eFilter,
   eInternal,
   ePauseConsumer,
+  eBus,
   Event_Unknown
 };
 
@@ -42,10 +43,14 @@ enum v8_worker_opcode {
   oGetCurlLatencyStats,
   oVersion,
   oInsight,
+  oLoadChunk,
+  oLoadChunkCommit,
+  oHandshake,
+  oGetN1qlLatencyStats,
   V8_Worker_Opcode_Unknown
 };
 
-enum dcp_opcode { oDelete, oMutation, oNoOp, DCP_Opcode_Unknown };
+enum dcp_opcode { oDelete, oMutation, oNoOp, oExpiration, DCP_Opcode_Unknown };
 
 enum filter_opcode { oVbFilter, oProcessedSeqNo, Filter_Opcode_Unknown };
 
@@ -53,6 +58,7 @@ enum internal_opcode {
   oScanTimer,
   oUpdateV8HeapSize,
   oRunGc,
+  oReloadCode,
   Internal_Opcode_Unknown
 };
 
@@ -63,13 +69,21 @@ enum app_worker_setting_opcode {
   oTimerContextSize,
   oVbMap,
   oWorkerMemQuota,
+  oExecutionTimeout,
+  oSocketBatchSize,
+  oDispatchLanes,
+  oDeadLetterRetryCount,
+  oHandlerRetryPolicy,
+  oStrictOrderCheck,
   App_Worker_Setting_Opcode_Unknown
 };
 
-enum timer_opcode { oTimer, oCronTimer, Timer_Opcode_Unknown };
+enum timer_opcode { oTimer, oCronTimer, oCancelTimer, Timer_Opcode_Unknown };
 
 enum debugger_opcode { oDebuggerStart, oDebuggerStop, Debugger_Opcode_Unknown };
 
+enum bus_opcode { oBusEvent, Bus_Opcode_Unknown };
+
 event_type getEvent(int8_t event);
 v8_worker_opcode getV8WorkerOpcode(int8_t opcode);
 dcp_opcode getDCPOpcode(int8_t opcode);
@@ -77,6 +91,7 @@ app_worker_setting_opcode getAppWorkerSettingOpcode(int8_t opcode);
 filter_opcode getFilterOpcode(int8_t opcode);
 timer_opcode getTimerOpcode(int8_t opcode);
 debugger_opcode getDebuggerOpcode(int8_t opcode);
+bus_opcode getBusOpcode(int8_t opcode);
 
 // Opcodes for outgoing messages from C++ to Go
 enum msg_type {
@@ -86,6 +101,8 @@ enum msg_type {
   mBucket_Ops_Response,
   mFilterAck,
   mPauseAck,
+  mDead_Letter,
+  mBus_Event,
   Msg_Unknown
 };
 
@@ -103,11 +120,16 @@ enum v8_worker_config_opcode {
   oLcbExceptions,
   oCurlLatencyStats,
   oCodeInsights,
+  oCapabilities,
+  oLoadChunkAck,
+  oHandshakeAck,
+  oFrameChecksumMismatch,
+  oN1qlLatencyStats,
   V8_Worker_Config_Opcode_Unknown
 };
 
-enum doc_timer_response_opcode { timerResponse };
+enum doc_timer_response_opcode { timerResponse, timerAckResponse };
 
-enum bucket_ops_response_opcode { checkpointResponse };
+enum bucket_ops_response_opcode { checkpointResponse, handlerAckResponse };
 
 #endif
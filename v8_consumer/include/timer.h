@@ -35,6 +35,7 @@ public:
 
   TIMER_MSG CreateTimerImpl(const v8::FunctionCallbackInfo<v8::Value> &args);
   bool CancelTimerImpl(const v8::FunctionCallbackInfo<v8::Value> &args);
+  lcb_STATUS RemoveTimer(timer::TimerInfo &timer_info);
 
   uint16_t timer_mask_bits_{0};
 
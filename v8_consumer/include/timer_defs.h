@@ -64,6 +64,10 @@ struct TimerEvent {
   std::string context_key;
   uint64_t alarm_cas;
   uint64_t context_cas;
+  // vb and seq no of the mutation which created the timer, filled in by the
+  // iterator from the alarm record
+  int64_t partition{-1};
+  uint64_t seq_num{0};
 };
 
 struct TimerSpan {
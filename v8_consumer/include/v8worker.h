@@ -58,6 +58,9 @@ typedef std::chrono::nanoseconds nsecs;
 
 #define SECS_TO_NS 1000 * 1000 * 1000ULL
 
+// Origin tags a written doc carries on, oldest ones are dropped past this
+const size_t MAX_ORIGIN_TAGS = 8;
+
 extern int64_t timer_context_size;
 
 using atomic_ptr_t = std::shared_ptr<std::atomic<uint64_t>>;
@@ -77,12 +80,13 @@ struct MessageHeader {
   ~MessageHeader() = default;
   MessageHeader(MessageHeader &&other) noexcept
       : event(other.event), opcode(other.opcode), partition(other.partition),
-        metadata(std::move(other.metadata)) {}
+        seq(other.seq), metadata(std::move(other.metadata)) {}
 
   MessageHeader &operator=(MessageHeader &&other) noexcept {
     event = other.event;
     opcode = other.opcode;
     partition = other.partition;
+    seq = other.seq;
     metadata = std::move(other.metadata);
     return *this;
   }
@@ -91,12 +95,14 @@ struct MessageHeader {
 
   std::size_t GetSize() const {
     return metadata.length() + sizeof(event) + sizeof(opcode) +
-           sizeof(partition);
+           sizeof(partition) + sizeof(seq);
   }
 
   uint8_t event{0};
   uint8_t opcode{0};
   int16_t partition{0};
+  // Dispatch seq of DCP events within the partition, 0 for other events
+  uint64_t seq{0};
   std::string metadata;
 };
 
@@ -169,6 +175,7 @@ typedef struct handler_config_s {
   int64_t bucket_cache_age;
   int64_t curl_max_allowed_resp_size;
   std::string n1ql_consistency;
+  int n1ql_timeout;
   std::vector<std::string> handler_headers;
   std::vector<std::string> handler_footers;
 } handler_config_t;
@@ -184,6 +191,15 @@ enum RETURN_CODE {
   kJSONParseFailed
 };
 
+// Kinds of handler failures retry policy of the function applies to. Values
+// are bits of retry_on mask sent by eventing-consumer
+enum handler_failure_kind {
+  fNone = 0,
+  fTimeout = 1 << 0,
+  fLcbError = 1 << 1,
+  fJsException = 1 << 2
+};
+
 class BucketBinding;
 class N1QL;
 class ConnectionPool;
@@ -206,6 +222,8 @@ extern std::atomic<int64_t> timer_callback_failure;
 extern std::atomic<int64_t> timer_create_failure;
 
 extern std::atomic<int64_t> lcb_retry_failure;
+extern std::atomic<int64_t> durable_write_counter;
+extern std::atomic<int64_t> durable_write_latency_us;
 
 extern std::atomic<int64_t> messages_processed_counter;
 extern std::atomic<int64_t> processed_events_size;
@@ -217,6 +235,7 @@ extern std::atomic<int64_t> dcp_mutation_msg_counter;
 extern std::atomic<int64_t> timer_msg_counter;
 extern std::atomic<int64_t> timer_create_counter;
 extern std::atomic<int64_t> timer_cancel_counter;
+extern std::atomic<int64_t> timer_cancel_failure;
 
 extern std::atomic<int64_t> enqueued_dcp_delete_msg_counter;
 extern std::atomic<int64_t> enqueued_dcp_mutation_msg_counter;
@@ -226,6 +245,31 @@ extern std::atomic<int64_t> filtered_dcp_delete_counter;
 extern std::atomic<int64_t> filtered_dcp_mutation_counter;
 extern std::atomic<int64_t> enqueued_timer_msg_counter;
 
+// Dispatch lane counters
+extern std::atomic<int64_t> dcp_lane_dispatched;
+extern std::atomic<int64_t> timer_lane_dispatched;
+extern std::atomic<int64_t> timer_lane_yields;
+
+extern std::atomic<int64_t> dead_letter_counter;
+extern std::atomic<int64_t> dead_letter_events_lost;
+extern std::atomic<int64_t> handler_ack_held_counter;
+
+extern std::atomic<int64_t> handler_retry_counter;
+extern std::atomic<int64_t> handler_retry_success;
+
+extern std::atomic<int64_t> dispatch_order_violation_counter;
+
+// Event bus counters
+extern std::atomic<int64_t> bus_event_emitted;
+extern std::atomic<int64_t> bus_events_lost;
+extern std::atomic<int64_t> bus_event_msg_counter;
+extern std::atomic<int64_t> on_event_success;
+extern std::atomic<int64_t> on_event_failure;
+
+// N1QL counters
+extern std::atomic<int64_t> n1ql_query_counter;
+extern std::atomic<int64_t> n1ql_query_success;
+
 class V8Worker {
 public:
   V8Worker(v8::Platform *platform, handler_config_t *h_config,
@@ -233,7 +277,8 @@ public:
            const std::string &function_id,
            const std::string &function_instance_id,
            const std::string &user_prefix, Histogram *latency_stats,
-           Histogram *curl_latency_stats, const std::string &ns_server_port,
+           Histogram *curl_latency_stats, Histogram *n1ql_latency_stats,
+           const std::string &ns_server_port,
            const int32_t &num_vbuckets, vb_seq_map_t *vb_seq,
            std::vector<uint64_t> *processed_bucketops, vb_lock_map_t *vb_locks,
            int worker_idx);
@@ -244,12 +289,13 @@ public:
   void TaskDurationWatcher();
 
   int SendUpdate(const std::string &value, const std::string &meta,
-                 bool is_binary);
-  int SendDelete(const std::string &value, const std::string &meta);
+                 const std::string &xattrs, bool is_binary);
+  int SendDelete(const std::string &value, const std::string &meta,
+                 bool expired);
   void SendTimer(std::string callback, std::string timer_ctx);
   std::string Compile(std::string handler);
 
-  void StartDebugger();
+  void StartDebugger(const std::string &token);
   void StopDebugger();
   bool DebugExecute(const char *func_name, v8::Local<v8::Value> *args,
                     int args_len);
@@ -260,9 +306,12 @@ public:
 
   void AddLcbException(int err_code);
   void ListLcbExceptions(std::map<int, int64_t> &agg_lcb_exceptions);
+  void AddN1qlError(int err_code);
+  void ListN1qlErrors(std::map<int, int64_t> &agg_n1ql_errors);
 
   void UpdateHistogram(Time::time_point t);
   void UpdateCurlLatencyHistogram(const Time::time_point &start);
+  void UpdateN1qlLatencyHistogram(const Time::time_point &start);
 
   void GetBucketOpsMessages(std::vector<uv_buf_t> &messages);
 
@@ -280,6 +329,8 @@ public:
 
   uint64_t GetBucketopsSeqno(int vb_no);
 
+  uint64_t GetAckedSeqno(int vb_no);
+
   std::unique_lock<std::mutex> GetAndLockBucketOpsLock();
 
   int ParseMetadata(const std::string &metadata, int &vb_no,
@@ -294,10 +345,30 @@ public:
 
   void UpdatePartitions(const std::unordered_set<int64_t> &vbuckets);
 
+  void SetExecutionTimeout(int execution_timeout);
+
+  void SetDispatchLanes(int64_t timer_batch_size, int64_t dcp_batch_size);
+
+  void SetDeadLetterRetryCount(int64_t retry_count);
+
+  void SetRetryPolicy(int64_t retry_count, int64_t retry_backoff_ms,
+                      int64_t retry_on);
+
+  void SetStrictOrderCheck(bool strict_order_check);
+
+  void GetDeadLetterAndAckMessages(std::vector<uv_buf_t> &messages);
+
+  void GetTimerAckMessages(std::vector<uv_buf_t> &messages);
+
+  bool AddBusEvent(const std::string &topic, const std::string &payload);
+
+  void GetBusEventMessages(std::vector<uv_buf_t> &messages);
+
   std::unordered_set<int64_t> GetPartitions() const;
 
   lcb_STATUS SetTimer(timer::TimerInfo &tinfo);
   lcb_STATUS DelTimer(timer::TimerInfo &tinfo);
+  void CancelTimer(const std::string &metadata);
 
   lcb_INSTANCE *GetTimerLcbHandle() const;
   void AddTimerPartition(int vb_no);
@@ -307,6 +378,8 @@ public:
 
   inline std::string GetFunctionInstanceID() { return function_instance_id_; }
 
+  std::string GetOriginStamp() const;
+
   v8::Isolate *GetIsolate() { return isolate_; }
   v8::Persistent<v8::Context> context_;
   v8::Persistent<v8::Function> on_update_;
@@ -318,7 +391,7 @@ public:
   std::string cb_source_bucket_;
   std::string cb_source_scope_;
   std::string cb_source_collection_;
-  int64_t max_task_duration_;
+  std::atomic<int64_t> max_task_duration_;
 
   server_settings_t *settings_;
 
@@ -330,7 +403,7 @@ public:
   Time::time_point execute_start_time_;
 
   std::thread processing_thr_;
-  std::thread *terminator_thr_;
+  std::thread *terminator_thr_{nullptr};
   BlockingDeque<std::unique_ptr<WorkerMessage>> *worker_queue_;
 
   size_t v8_heap_size_;
@@ -339,6 +412,8 @@ public:
   std::atomic<bool> update_v8_heap_;
   std::atomic<bool> run_gc_;
   std::map<int, int64_t> lcb_exceptions_;
+  // Error codes of failed N1QL queries, both lcb and query service ones
+  std::map<int, int64_t> n1ql_errors_;
   IsolateData data_;
   int32_t num_vbuckets_{1024};
   int32_t timer_reduction_ratio_{1};
@@ -347,10 +422,24 @@ private:
   CompilationInfo CompileHandler(std::string app_name, std::string handler);
   std::string AddHeadersAndFooters(std::string code);
 
+  void DispatchMessage(const std::unique_ptr<WorkerMessage> &msg);
+  void ScanTimers();
+  void ServeDcpLane();
+  bool AddDeadLetter(const std::string &event, const std::string &meta,
+                     const std::string &value, bool is_binary, int attempts,
+                     int vb, uint64_t seq_num);
+  int ClassifyFailure(const v8::TryCatch &try_catch);
+  bool ShouldRetryHandler(int attempts) const;
+  void CheckDispatchOrder(int16_t vb, uint64_t seq);
   void UpdateSeqNumLocked(int vb, uint64_t seq_num);
+  void AckSeqNum(int vb, uint64_t seq_num);
+  void HoldAcks(int vb, uint64_t seq_num);
+  void AckTimer(const timer::TimerEvent &evt);
+  void TakeEventOrigin(const std::unique_ptr<WorkerMessage> &msg);
   void HandleDeleteEvent(const std::unique_ptr<WorkerMessage> &msg);
   void HandleMutationEvent(const std::unique_ptr<WorkerMessage> &msg);
   void HandleNoOpEvent(const std::unique_ptr<WorkerMessage> &msg);
+  void HandleBusEvent(const std::unique_ptr<WorkerMessage> &msg);
   bool IsFilteredEventLocked(int vb, uint64_t seq_num);
   std::tuple<int, uint64_t, bool>
   GetVbAndSeqNum(const std::unique_ptr<WorkerMessage> &msg) const;
@@ -379,6 +468,7 @@ private:
   std::unique_lock<std::mutex> GetAndLockVbLock(int vb_no);
   Histogram *latency_stats_;
   Histogram *curl_latency_stats_;
+  Histogram *n1ql_latency_stats_;
 
   std::string src_path_;
 
@@ -388,6 +478,41 @@ private:
 
   std::vector<std::vector<uint64_t>> vbfilter_map_;
   std::vector<uint64_t> *processed_bucketops_;
+  std::atomic<int64_t> timer_lane_batch_size_{100};
+  std::atomic<int64_t> dcp_lane_batch_size_{100};
+
+  // Exception thrown by handler during last OnUpdate or OnDelete, if any
+  std::string last_exception_;
+  std::atomic<int64_t> dead_letter_retry_count_{-1};
+  std::mutex dead_letters_lock_;
+  std::vector<std::string> dead_letters_;
+
+  // Events emitted by handler through emitEvent(), till they're sent to
+  // eventing-consumer for the event bus
+  std::mutex bus_events_lock_;
+  std::vector<std::string> bus_events_;
+
+  // Retry policy of the function, retry_on_ is a mask of handler_failure_kind
+  int last_failure_kind_{fNone};
+  std::atomic<int64_t> retry_count_{0};
+  std::atomic<int64_t> retry_backoff_ms_{0};
+  std::atomic<int64_t> retry_on_{fTimeout | fLcbError};
+
+  // Seq no of the last mutation per vb that handler finished executing, till
+  // it's sent to eventing-consumer. last_acked_seq_ is kept for filter acks
+  std::vector<uint64_t> acked_seq_;
+  std::vector<uint64_t> last_acked_seq_;
+  std::vector<bool> acks_held_;
+
+  // Dispatch seq of the last DCP event processed per vb, reported alongside
+  // acks when strict order check is enabled
+  std::atomic<bool> strict_order_check_{false};
+  std::vector<uint64_t> dispatch_seq_;
+
+  // Seq no of the latest mutation per vb whose timer fired, along with count
+  // of timers fired since eventing-consumer was last acked
+  std::vector<uint64_t> timer_acked_seq_;
+  std::vector<uint64_t> timers_fired_;
   std::mutex bucketops_lock_;
 
   std::mutex pause_lock_;
@@ -398,6 +523,8 @@ private:
   std::string function_name_;
   std::string function_id_;
   std::string function_instance_id_;
+  // Origin tags carried by the DCP event being handled
+  std::string event_origin_;
   std::string user_prefix_;
   std::string ns_server_port_;
   timer::TimerStore *timer_store_{nullptr};
@@ -412,4 +539,6 @@ private:
   std::vector<std::string> handler_footers_;
 };
 
+void EmitEvent(const v8::FunctionCallbackInfo<v8::Value> &args);
+
 #endif
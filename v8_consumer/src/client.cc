@@ -9,6 +9,7 @@
 // or implied. See the License for the specific language governing
 // permissions and limitations under the License.
 
+#include <array>
 #include <chrono>
 #include <string>
 #include <thread>
@@ -16,6 +17,7 @@
 #include "breakpad.h"
 #include "bucket_cache.h"
 #include "client.h"
+#include "crc32.h"
 
 #include <nlohmann/json.hpp>
 
@@ -32,6 +34,8 @@ std::atomic<int64_t> delete_events_lost = {0};
 std::atomic<int64_t> timer_events_lost = {0};
 std::atomic<int64_t> mutation_events_lost = {0};
 std::atomic<int64_t> uv_msg_parse_failure = {0};
+std::atomic<int64_t> batch_frames_parsed = {0};
+std::atomic<int64_t> frame_checksum_failure = {0};
 std::atomic<int64_t> bucket_cache_overflow_count_ = {0};
 
 extern std::atomic<int64_t> timer_context_size_exceeded_counter;
@@ -62,12 +66,21 @@ std::string GetFailureStats() {
       timer_callback_missing_counter.load();
   fstats["delete_events_lost"] = delete_events_lost.load();
   fstats["timer_events_lost"] = timer_events_lost.load();
+  fstats["dead_letter_counter"] = dead_letter_counter.load();
+  fstats["dead_letter_events_lost"] = dead_letter_events_lost.load();
+  fstats["handler_ack_held_counter"] = handler_ack_held_counter.load();
+  fstats["handler_retry_counter"] = handler_retry_counter.load();
+  fstats["handler_retry_success"] = handler_retry_success.load();
+  fstats["dispatch_order_violation_counter"] =
+      dispatch_order_violation_counter.load();
+  fstats["bus_events_lost"] = bus_events_lost.load();
   fstats["curl_non_200_response"] = Curl::GetStats().GetCurlNon200Stat();
   fstats["curl_timeout_count"] = Curl::GetStats().GetCurlTimeoutStat();
   fstats["curl_failure_count"] = Curl::GetStats().GetCurlFailureStat();
   fstats["curl_max_resp_size_exceeded"] =
       Curl::GetStats().GetCurlMaxRespSizeExceededStat();
   fstats["timestamp"] = GetTimestampNow();
+  fstats["version"] = STATS_PAYLOAD_VERSION;
   return fstats.dump();
 }
 
@@ -77,6 +90,10 @@ std::string GetExecutionStats(const std::map<int16_t, V8Worker *> &workers) {
   estats["on_update_failure"] = on_update_failure.load();
   estats["on_delete_success"] = on_delete_success.load();
   estats["on_delete_failure"] = on_delete_failure.load();
+  estats["on_event_success"] = on_event_success.load();
+  estats["on_event_failure"] = on_event_failure.load();
+  estats["bus_event_emitted"] = bus_event_emitted.load();
+  estats["bus_event_msg_counter"] = bus_event_msg_counter.load();
   estats["no_op_counter"] = no_op_counter.load();
   estats["timer_callback_success"] = timer_callback_success.load();
   estats["timer_callback_failure"] = timer_callback_failure.load();
@@ -87,25 +104,35 @@ std::string GetExecutionStats(const std::map<int16_t, V8Worker *> &workers) {
   estats["timer_msg_counter"] = timer_msg_counter.load();
   estats["timer_create_counter"] = timer_create_counter.load();
   estats["timer_cancel_counter"] = timer_cancel_counter.load();
+  estats["timer_cancel_failure"] = timer_cancel_failure.load();
   estats["enqueued_dcp_delete_msg_counter"] =
       enqueued_dcp_delete_msg_counter.load();
   estats["enqueued_dcp_mutation_msg_counter"] =
       enqueued_dcp_mutation_msg_counter.load();
   estats["enqueued_timer_msg_counter"] = enqueued_timer_msg_counter.load();
+  estats["dcp_lane_dispatched"] = dcp_lane_dispatched.load();
+  estats["timer_lane_dispatched"] = timer_lane_dispatched.load();
+  estats["timer_lane_yields"] = timer_lane_yields.load();
   estats["timer_responses_sent"] = timer_responses_sent;
   estats["uv_try_write_failure_counter"] = uv_try_write_failure_counter.load();
   estats["lcb_retry_failure"] = lcb_retry_failure.load();
+  estats["durable_write_counter"] = durable_write_counter.load();
+  estats["durable_write_latency_us"] = durable_write_latency_us.load();
   estats["dcp_delete_parse_failure"] = dcp_delete_parse_failure.load();
   estats["dcp_mutation_parse_failure"] = dcp_mutation_parse_failure.load();
   estats["filtered_dcp_delete_counter"] = filtered_dcp_delete_counter.load();
   estats["filtered_dcp_mutation_counter"] =
       filtered_dcp_mutation_counter.load();
   if (!workers.empty()) {
-    int64_t agg_queue_memory = 0, agg_queue_size = 0;
+    int64_t agg_queue_memory = 0, agg_queue_size = 0, timer_lane_scans = 0;
     for (const auto &w : workers) {
       agg_queue_size += w.second->worker_queue_->GetSize();
       agg_queue_memory += w.second->worker_queue_->GetMemory();
+      if (w.second->scan_timer_.load()) {
+        ++timer_lane_scans;
+      }
     }
+    estats["timer_lane_active_scans"] = timer_lane_scans;
 
     estats["agg_queue_size"] = agg_queue_size;
     estats["feedback_queue_size"] = 0;
@@ -119,8 +146,21 @@ std::string GetExecutionStats(const std::map<int16_t, V8Worker *> &workers) {
   estats["curl"]["head"] = Curl::GetStats().GetCurlHeadStat();
   estats["curl"]["put"] = Curl::GetStats().GetCurlPutStat();
   estats["curl_success_count"] = Curl::GetStats().GetCurlSuccessStat();
+  estats["n1ql"]["query_count"] = n1ql_query_counter.load();
+  estats["n1ql"]["query_success"] = n1ql_query_success.load();
+  estats["n1ql"]["error_codes"] = nlohmann::json::object();
+  std::map<int, int64_t> agg_n1ql_errors;
+  for (const auto &w : workers) {
+    w.second->ListN1qlErrors(agg_n1ql_errors);
+  }
+  for (const auto &entry : agg_n1ql_errors) {
+    estats["n1ql"]["error_codes"][std::to_string(entry.first)] = entry.second;
+  }
   estats["timestamp"] = GetTimestampNow();
   estats["uv_msg_parse_failure"] = uv_msg_parse_failure.load();
+  estats["batch_frames_parsed"] = batch_frames_parsed.load();
+  estats["frame_checksum_failure"] = frame_checksum_failure.load();
+  estats["version"] = STATS_PAYLOAD_VERSION;
   return estats.dump();
 }
 
@@ -150,10 +190,44 @@ int combineAsciiToInt(std::vector<int> *input) {
   return result;
 }
 
+// CRC-32C (Castagnoli) of frames exchanged with eventing-consumer
+uint32_t crc32c(const char *data, size_t len) {
+  static const auto table = [] {
+    std::array<uint32_t, 256> t{};
+    for (uint32_t i = 0; i < 256; i++) {
+      uint32_t crc = i;
+      for (int j = 0; j < 8; j++) {
+        crc = (crc >> 1) ^ ((crc & 1) * 0x82F63B78u);
+      }
+      t[i] = crc;
+    }
+    return t;
+  }();
+
+  uint32_t crc = ~0u;
+  for (size_t i = 0; i < len; i++) {
+    crc = table[(crc ^ static_cast<uint8_t>(data[i])) & 0xFF] ^ (crc >> 8);
+  }
+  return ~crc;
+}
+
+// Settings from eventing-consumer are numbers sent as strings. A malformed one
+// is logged and skipped, instead of an exception taking the worker down
+static bool ParseSetting(const std::string &name, const std::string &value,
+                         int64_t &result) {
+  try {
+    result = std::stoll(value);
+    return true;
+  } catch (const std::exception &e) {
+    LOG(logError) << "Invalid " << name << ": " << value
+                  << " err: " << e.what() << std::endl;
+    return false;
+  }
+}
+
 std::pair<bool, std::unique_ptr<WorkerMessage>>
 AppWorker::GetWorkerMessage(int encoded_header_size, int encoded_payload_size,
                             const std::string &msg) {
-  messages_parsed++;
   std::unique_ptr<WorkerMessage> worker_msg(new WorkerMessage);
 
   // Parsing payload
@@ -163,6 +237,53 @@ AppWorker::GetWorkerMessage(int encoded_header_size, int encoded_payload_size,
       HEADER_FRAGMENT_SIZE + PAYLOAD_FRAGMENT_SIZE + encoded_header_size,
       encoded_payload_size);
 
+  return ParseWorkerMessage(std::move(worker_msg));
+}
+
+// Unpacks messages eventing-consumer batched into a single frame, batch is the
+// frame without its length prefix
+std::pair<bool, std::vector<std::unique_ptr<WorkerMessage>>>
+AppWorker::GetWorkerMessages(const std::string &batch) {
+  std::vector<std::unique_ptr<WorkerMessage>> worker_msgs;
+
+  auto verifier = flatbuffers::Verifier(
+      reinterpret_cast<const uint8_t *>(batch.c_str()), batch.size());
+  if (!verifier.VerifyBuffer<flatbuf::header::Batch>(nullptr)) {
+    return {false, std::move(worker_msgs)};
+  }
+
+  auto batch_flatbuf =
+      flatbuffers::GetRoot<flatbuf::header::Batch>(batch.c_str());
+  if (batch_flatbuf->messages() == nullptr) {
+    return {false, std::move(worker_msgs)};
+  }
+
+  for (const auto *message : *batch_flatbuf->messages()) {
+    std::unique_ptr<WorkerMessage> worker_msg(new WorkerMessage);
+    if (message->header() != nullptr) {
+      worker_msg->payload.header.assign(
+          reinterpret_cast<const char *>(message->header()->data()),
+          message->header()->size());
+    }
+    if (message->payload() != nullptr) {
+      worker_msg->payload.payload.assign(
+          reinterpret_cast<const char *>(message->payload()->data()),
+          message->payload()->size());
+    }
+
+    auto parsed = ParseWorkerMessage(std::move(worker_msg));
+    if (!parsed.first) {
+      return {false, std::move(worker_msgs)};
+    }
+    worker_msgs.emplace_back(std::move(parsed.second));
+  }
+  return {true, std::move(worker_msgs)};
+}
+
+std::pair<bool, std::unique_ptr<WorkerMessage>>
+AppWorker::ParseWorkerMessage(std::unique_ptr<WorkerMessage> worker_msg) {
+  messages_parsed++;
+
   // Parsing header
   const MessagePayload &payload = worker_msg->payload;
   auto header_flatbuf = flatbuf::header::GetHeader(payload.header.c_str());
@@ -177,6 +298,7 @@ AppWorker::GetWorkerMessage(int encoded_header_size, int encoded_payload_size,
   worker_msg->header.opcode = header_flatbuf->opcode();
   worker_msg->header.partition = header_flatbuf->partition();
   worker_msg->header.metadata = header_flatbuf->metadata()->str();
+  worker_msg->header.seq = header_flatbuf->seq();
   return {true, std::move(worker_msg)};
 }
 
@@ -358,7 +480,67 @@ void AppWorker::ParseValidChunk(uv_stream_t *stream, int nread,
     next_message_.clear();
   }
 
+  // Stream is out of sync past a corrupt frame, eventing-consumer respawns
+  // the worker once it learns of it
+  if (frame_corrupted_) {
+    return;
+  }
+
+  auto log_parse_failure = [&buf_base]() {
+    ++uv_msg_parse_failure;
+    // We only need to know the first message which failed to parse as the
+    // subsequent messages will fail to get parsed anyway
+    if (uv_msg_parse_failure == 1) {
+      LOG(logError)
+          << "Failed to parse message from uv buffer. Buffer contents : "
+          << RU(buf_base) << std::endl;
+    }
+  };
+
   for (; buf_base.length() > HEADER_FRAGMENT_SIZE + PAYLOAD_FRAGMENT_SIZE;) {
+    uint32_t frame_prefix;
+    std::memcpy(&frame_prefix, buf_base.data(), HEADER_FRAGMENT_SIZE);
+
+    // Messages batched by eventing-consumer arrive as a single frame, along
+    // with its checksum if asked for:
+    // <BATCH_FRAME_FLAG|CHECKSUM_FRAME_FLAG|batchSize><crc32c><Batch>
+    if (frame_prefix & BATCH_FRAME_FLAG) {
+      bool checksummed = frame_prefix & CHECKSUM_FRAME_FLAG;
+      std::string::size_type body_offset =
+          HEADER_FRAGMENT_SIZE + (checksummed ? SIZEOF_UINT32 : 0);
+      std::string::size_type message_size =
+          body_offset +
+          (frame_prefix & ~(BATCH_FRAME_FLAG | CHECKSUM_FRAME_FLAG));
+
+      if (buf_base.length() < message_size) {
+        next_message_.assign(buf_base);
+        return;
+      }
+
+      auto batch = buf_base.substr(body_offset, message_size - body_offset);
+      if (checksummed) {
+        uint32_t checksum;
+        std::memcpy(&checksum, buf_base.data() + HEADER_FRAGMENT_SIZE,
+                    SIZEOF_UINT32);
+        if (crc32c(batch.c_str(), batch.size()) != checksum) {
+          ReportCorruptFrame(stream, checksum, batch);
+          return;
+        }
+      }
+
+      auto worker_msgs = GetWorkerMessages(batch);
+      if (worker_msgs.first) {
+        ++batch_frames_parsed;
+        for (auto &worker_msg : worker_msgs.second) {
+          ProcessWorkerMessage(stream, std::move(worker_msg));
+        }
+      } else {
+        log_parse_failure();
+      }
+      buf_base.erase(0, message_size);
+      continue;
+    }
+
     std::vector<int> header_entries, payload_entries;
     int encoded_header_size, encoded_payload_size;
 
@@ -386,90 +568,201 @@ void AppWorker::ParseValidChunk(uv_stream_t *stream, int nread,
       auto worker_msg = GetWorkerMessage(encoded_header_size,
                                          encoded_payload_size, chunk_to_parse);
       if (worker_msg.first) {
-        RouteMessageWithResponse(std::move(worker_msg.second));
+        ProcessWorkerMessage(stream, std::move(worker_msg.second));
+      } else {
+        log_parse_failure();
+      }
+    }
+    buf_base.erase(0, message_size);
+  }
+
+  if (buf_base.length() > 0) {
+    next_message_.assign(buf_base);
+  }
+}
 
-        if (messages_processed_counter >= batch_size_ || msg_priority_) {
+void AppWorker::ProcessWorkerMessage(
+    uv_stream_t *stream, std::unique_ptr<WorkerMessage> worker_msg) {
+  RouteMessageWithResponse(std::move(worker_msg));
 
-          messages_processed_counter = 0;
+  if (messages_processed_counter < batch_size_ && !msg_priority_) {
+    return;
+  }
 
-          // Reset the message priority flag
-          msg_priority_ = false;
-          if (!resp_msg_->msg.empty()) {
-            flatbuffers::FlatBufferBuilder builder;
+  messages_processed_counter = 0;
 
-            auto flatbuf_msg = builder.CreateString(resp_msg_->msg.c_str());
-            auto r = flatbuf::response::CreateResponse(
-                builder, resp_msg_->msg_type, resp_msg_->opcode, flatbuf_msg);
-            builder.Finish(r);
+  // Reset the message priority flag
+  msg_priority_ = false;
 
-            uint32_t s = builder.GetSize();
-            char *size = (char *)&s;
-            FlushToConn(stream, size, SIZEOF_UINT32);
+  std::vector<resp_msg_t> responses;
+  if (!resp_msg_->msg.empty()) {
+    responses.push_back(*resp_msg_);
 
-            // Write payload to socket
-            std::string msg((const char *)builder.GetBufferPointer(),
-                            builder.GetSize());
-            FlushToConn(stream, (char *)msg.c_str(), msg.length());
+    // Reset the values
+    resp_msg_->msg.clear();
+    resp_msg_->msg_type = 0;
+    resp_msg_->opcode = 0;
+  }
 
-            // Reset the values
-            resp_msg_->msg.clear();
-            resp_msg_->msg_type = 0;
-            resp_msg_->opcode = 0;
-          }
+  // Flush the aggregate item count in queues for all running
+  // V8 worker instances
+  if (!workers_.empty()) {
+    int64_t agg_queue_size = 0, agg_queue_memory = 0;
+    for (const auto &w : workers_) {
+      agg_queue_size += w.second->worker_queue_->GetSize();
+      agg_queue_memory += w.second->worker_queue_->GetMemory();
+    }
 
-          // Flush the aggregate item count in queues for all running
-          // V8 worker instances
-          if (!workers_.empty()) {
-            int64_t agg_queue_size = 0, agg_queue_memory = 0;
-            for (const auto &w : workers_) {
-              agg_queue_size += w.second->worker_queue_->GetSize();
-              agg_queue_memory += w.second->worker_queue_->GetMemory();
-            }
+    std::ostringstream queue_stats;
+    queue_stats << R"({"agg_queue_size":)";
+    queue_stats << agg_queue_size << R"(, "feedback_queue_size":)";
+    queue_stats << 0 << R"(, "agg_queue_memory":)";
+    queue_stats << agg_queue_memory << R"(, "processed_events_size":)";
+    queue_stats << processed_events_size << R"(, "num_processed_events":)";
+    queue_stats << num_processed_events << R"(, "version":)";
+    queue_stats << STATS_PAYLOAD_VERSION << "}";
 
-            std::ostringstream queue_stats;
-            queue_stats << R"({"agg_queue_size":)";
-            queue_stats << agg_queue_size << R"(, "feedback_queue_size":)";
-            queue_stats << 0 << R"(, "agg_queue_memory":)";
-            queue_stats << agg_queue_memory << R"(, "processed_events_size":)";
-            queue_stats << processed_events_size
-                        << R"(, "num_processed_events":)";
-            queue_stats << num_processed_events << "}";
-
-            flatbuffers::FlatBufferBuilder builder;
-            auto flatbuf_msg = builder.CreateString(queue_stats.str());
-            auto r = flatbuf::response::CreateResponse(
-                builder, mV8_Worker_Config, oQueueSize, flatbuf_msg);
-            builder.Finish(r);
-
-            uint32_t s = builder.GetSize();
-            char *size = (char *)&s;
-            FlushToConn(stream, size, SIZEOF_UINT32);
-
-            // Write payload to socket
-            std::string msg((const char *)builder.GetBufferPointer(),
-                            builder.GetSize());
-            FlushToConn(stream, (char *)msg.c_str(), msg.length());
-          }
-        }
-      } else {
-        ++uv_msg_parse_failure;
-        // We only need to know the first message which failed to parse as the
-        // subsequent messages will fail to get parsed anyway
-        if (uv_msg_parse_failure == 1) {
-          LOG(logError)
-              << "Failed to parse message from uv buffer. Buffer contents : "
-              << RU(buf_base) << std::endl;
-        }
-      }
+    responses.push_back({queue_stats.str(), mV8_Worker_Config, oQueueSize});
+  }
+
+  FlushResponses(stream, responses);
+}
+
+// Writes responses due as a single frame to consumers which negotiated batch
+// frames, <BATCH_FRAME_FLAG|batchSize><ResponseBatch>, and as a frame each
+// otherwise
+void AppWorker::FlushResponses(uv_stream_t *stream,
+                               const std::vector<resp_msg_t> &responses) {
+  if (responses.empty()) {
+    return;
+  }
+
+  if (protocol_version_ < PROTOCOL_VERSION_BATCH_FRAMES) {
+    for (const auto &resp : responses) {
+      flatbuffers::FlatBufferBuilder builder;
+      auto flatbuf_msg = builder.CreateString(resp.msg);
+      auto r = flatbuf::response::CreateResponse(builder, resp.msg_type,
+                                                 resp.opcode, flatbuf_msg);
+      builder.Finish(r);
+
+      uint32_t s = builder.GetSize();
+      std::string frame((const char *)&s, SIZEOF_UINT32);
+      frame.append((const char *)builder.GetBufferPointer(),
+                   builder.GetSize());
+      FlushToConn(stream, (char *)frame.c_str(), frame.length());
     }
-    buf_base.erase(0, message_size);
+    return;
   }
 
-  if (buf_base.length() > 0) {
-    next_message_.assign(buf_base);
+  flatbuffers::FlatBufferBuilder builder;
+  std::vector<flatbuffers::Offset<flatbuf::response::Response>> offsets;
+  for (const auto &resp : responses) {
+    auto flatbuf_msg = builder.CreateString(resp.msg);
+    offsets.push_back(flatbuf::response::CreateResponse(
+        builder, resp.msg_type, resp.opcode, flatbuf_msg));
+  }
+
+  auto batch = flatbuf::response::CreateResponseBatch(
+      builder, builder.CreateVector(offsets));
+  builder.Finish(batch);
+
+  auto body = (const char *)builder.GetBufferPointer();
+  uint32_t s = builder.GetSize() | BATCH_FRAME_FLAG;
+  if (frame_checksums_) {
+    s |= CHECKSUM_FRAME_FLAG;
+  }
+
+  std::string frame((const char *)&s, SIZEOF_UINT32);
+  if (frame_checksums_) {
+    uint32_t checksum = crc32c(body, builder.GetSize());
+    frame.append((const char *)&checksum, SIZEOF_UINT32);
   }
+  frame.append(body, builder.GetSize());
+  FlushToConn(stream, (char *)frame.c_str(), frame.length());
+}
+
+// Drops whatever is read past a frame failing checksum and lets
+// eventing-consumer know, so that it respawns the worker rather than the
+// worker acting on garbage
+void AppWorker::ReportCorruptFrame(uv_stream_t *stream, uint32_t checksum,
+                                   const std::string &batch) {
+  ++frame_checksum_failure;
+  frame_corrupted_ = true;
+  next_message_.clear();
+
+  LOG(logError) << "Checksum mismatch on frame from eventing-consumer, size: "
+                << batch.size() << " expected: " << checksum
+                << " actual: " << crc32c(batch.c_str(), batch.size())
+                << std::endl;
+
+  nlohmann::json report;
+  report["size"] = batch.size();
+  report["expected"] = checksum;
+  FlushResponses(stream,
+                 {{report.dump(), mV8_Worker_Config, oFrameChecksumMismatch}});
 }
 
+// Settles on the highest protocol version both sides speak. Version stays as is
+// if there's none, consumer gives up on the worker in that case
+std::string AppWorker::NegotiateProtocol(const std::string &handshake) {
+  nlohmann::json ack;
+  ack["protocol_version"] = PROTOCOL_VERSION;
+  ack["min_protocol_version"] = MIN_PROTOCOL_VERSION;
+  ack["negotiated_version"] = 0;
+
+  auto consumer = nlohmann::json::parse(handshake, nullptr, false);
+  if (consumer.is_discarded() || !consumer.is_object() ||
+      !consumer["protocol_version"].is_number() ||
+      !consumer["min_protocol_version"].is_number()) {
+    LOG(logError) << "Invalid protocol handshake: " << handshake << std::endl;
+    return ack.dump();
+  }
+
+  auto version =
+      std::min(consumer["protocol_version"].get<int>(), PROTOCOL_VERSION);
+  auto min_version = std::max(consumer["min_protocol_version"].get<int>(),
+                              MIN_PROTOCOL_VERSION);
+  if (version < min_version) {
+    LOG(logError) << "No protocol version in common with eventing-consumer, "
+                     "handshake: "
+                  << handshake << " worker protocol version: "
+                  << PROTOCOL_VERSION
+                  << " min protocol version: " << MIN_PROTOCOL_VERSION
+                  << std::endl;
+    return ack.dump();
+  }
+
+  frame_checksums_ = version >= PROTOCOL_VERSION_FRAME_CHECKSUMS &&
+                     consumer["frame_checksums"].is_boolean() &&
+                     consumer["frame_checksums"].get<bool>();
+
+  std::string origin_tag;
+  if (version >= PROTOCOL_VERSION_ORIGIN_TAGS &&
+      consumer["origin_tag"].is_string()) {
+    origin_tag = consumer["origin_tag"].get<std::string>();
+  }
+  {
+    std::lock_guard<std::mutex> lck(origin_tag_lck_);
+    origin_tag_ = origin_tag;
+  }
+
+  LOG(logInfo) << "Negotiated protocol version: " << version
+               << " frame checksums: " << frame_checksums_
+               << " origin tag: " << origin_tag << std::endl;
+  protocol_version_ = version;
+  ack["negotiated_version"] = version;
+  ack["frame_checksums"] = frame_checksums_.load();
+  ack["origin_tagging"] = !origin_tag.empty();
+  return ack.dump();
+}
+
+std::string AppWorker::GetOriginTag() {
+  std::lock_guard<std::mutex> lck(origin_tag_lck_);
+  return origin_tag_;
+}
+
+std::string GetOriginTag() { return AppWorker::GetAppWorker()->GetOriginTag(); }
+
 void AppWorker::FlushToConn(uv_stream_t *stream, char *msg, int length) {
   auto buffer = uv_buf_init(msg, length);
 
@@ -496,6 +789,88 @@ void AppWorker::FlushToConn(uv_stream_t *stream, char *msg, int length) {
   }
 }
 
+// Code swapped into a running function is queued behind events already
+// routed to each V8Worker, so that it's loaded on the worker's own thread
+// in between two events
+void AppWorker::LoadHandlerCode(const std::string &app_code) {
+  LOG(logDebug) << "Loading app code:" << RM(app_code) << std::endl;
+  for (int16_t i = 0; i < thr_count_; i++) {
+    if (handler_loaded_) {
+      std::unique_ptr<WorkerMessage> msg(new WorkerMessage);
+      msg->header.event = eInternal + 1;
+      msg->header.opcode = oReloadCode;
+      msg->header.metadata = app_code;
+      workers_[i]->PushBack(std::move(msg));
+
+      LOG(logInfo) << "Reload queued index: " << i
+                   << " V8Worker: " << workers_[i] << std::endl;
+      continue;
+    }
+
+    workers_[i]->V8WorkerLoad(app_code);
+
+    LOG(logInfo) << "Load index: " << i << " V8Worker: " << workers_[i]
+                 << std::endl;
+  }
+  handler_loaded_ = true;
+}
+
+// Verifies received chunks against commit sent by eventing-producer and loads
+// the assembled handler code. Chunks are retained when some are missing, so
+// that only those need to be resent
+std::string AppWorker::AssembleLoadChunks(const std::string &commit) {
+  nlohmann::json ack;
+
+  auto meta = nlohmann::json::parse(commit, nullptr, false);
+  if (meta.is_discarded() || !meta.is_object() ||
+      !meta["chunks"].is_number() ||
+      !meta["size"].is_number() || !meta["checksum"].is_number()) {
+    LOG(logError) << "Invalid load chunk commit: " << commit << std::endl;
+    load_chunks_.clear();
+    ack["status"] = "invalid_commit";
+    return ack.dump();
+  }
+
+  auto chunks = meta["chunks"].get<int16_t>();
+  auto size = meta["size"].get<size_t>();
+  auto checksum = meta["checksum"].get<uint32_t>();
+
+  std::vector<int16_t> missing;
+  for (int16_t i = 0; i < chunks; i++) {
+    if (load_chunks_.find(i) == load_chunks_.end()) {
+      missing.push_back(i);
+    }
+  }
+
+  if (!missing.empty()) {
+    LOG(logError) << "Missing " << missing.size() << " of " << chunks
+                  << " handler code chunks" << std::endl;
+    ack["status"] = "missing";
+    ack["missing"] = missing;
+    return ack.dump();
+  }
+
+  std::string app_code;
+  app_code.reserve(size);
+  for (int16_t i = 0; i < chunks; i++) {
+    app_code.append(load_chunks_[i]);
+  }
+  load_chunks_.clear();
+
+  if (app_code.size() != size ||
+      crc32_8(app_code.c_str(), app_code.size(), 0) != checksum) {
+    LOG(logError) << "Checksum mismatch for assembled handler code, size: "
+                  << app_code.size() << " expected size: " << size
+                  << std::endl;
+    ack["status"] = "checksum_mismatch";
+    return ack.dump();
+  }
+
+  LoadHandlerCode(app_code);
+  ack["status"] = "loaded";
+  return ack.dump();
+}
+
 void AppWorker::RouteMessageWithResponse(
     std::unique_ptr<WorkerMessage> worker_msg) {
   std::string key, val, doc_id, callback_fn, doc_ids_cb_fns, compile_resp;
@@ -538,6 +913,7 @@ void AppWorker::RouteMessageWithResponse(
       handler_config->lcb_timeout = payload->lcb_timeout();
       handler_config->lcb_inst_capacity = payload->lcb_inst_capacity();
       handler_config->n1ql_consistency = payload->n1ql_consistency()->str();
+      handler_config->n1ql_timeout = payload->n1ql_timeout();
       handler_config->skip_lcb_bootstrap = payload->skip_lcb_bootstrap();
       using_timer_ = payload->using_timer();
       handler_config->using_timer = using_timer_;
@@ -580,8 +956,14 @@ void AppWorker::RouteMessageWithResponse(
               new V8Worker(platform.release(), handler_config, server_settings,
                            function_name_, function_id_, handler_instance_id,
                            user_prefix_, &latency_stats_, &curl_latency_stats_,
-                           ns_server_port_, num_vbuckets_, vb_seq_.get(),
-                           processed_bucketops_.get(), vb_locks_.get(), i);
+                           &n1ql_latency_stats_, ns_server_port_, num_vbuckets_,
+                           vb_seq_.get(), processed_bucketops_.get(),
+                           vb_locks_.get(), i);
+
+          w->SetDispatchLanes(timer_lane_batch_size_, dcp_lane_batch_size_);
+          w->SetDeadLetterRetryCount(dead_letter_retry_count_);
+          w->SetRetryPolicy(retry_count_, retry_backoff_ms_, retry_on_);
+          w->SetStrictOrderCheck(strict_order_check_);
 
           LOG(logInfo) << "Init index: " << i << " V8Worker: " << w
                        << std::endl;
@@ -593,16 +975,32 @@ void AppWorker::RouteMessageWithResponse(
         msg_priority_ = true;
         v8worker_init_done_ = true;
       }
+
+      // Advertise capabilities to eventing-producer as part of init handshake
+      estats["chunked_load"] = true;
+      estats["max_load_chunk_size"] = MAX_LOAD_CHUNK_SIZE;
+      resp_msg_->msg.assign(estats.dump());
+      resp_msg_->msg_type = mV8_Worker_Config;
+      resp_msg_->opcode = oCapabilities;
       break;
     case oLoad:
-      LOG(logDebug) << "Loading app code:" << RM(worker_msg->header.metadata)
-                    << std::endl;
-      for (int16_t i = 0; i < thr_count_; i++) {
-        workers_[i]->V8WorkerLoad(worker_msg->header.metadata);
-
-        LOG(logInfo) << "Load index: " << i << " V8Worker: " << workers_[i]
-                     << std::endl;
-      }
+      LoadHandlerCode(worker_msg->header.metadata);
+      msg_priority_ = true;
+      break;
+    case oLoadChunk:
+      load_chunks_[worker_msg->header.partition] =
+          std::move(worker_msg->header.metadata);
+      break;
+    case oLoadChunkCommit:
+      resp_msg_->msg.assign(AssembleLoadChunks(worker_msg->header.metadata));
+      resp_msg_->msg_type = mV8_Worker_Config;
+      resp_msg_->opcode = oLoadChunkAck;
+      msg_priority_ = true;
+      break;
+    case oHandshake:
+      resp_msg_->msg.assign(NegotiateProtocol(worker_msg->header.metadata));
+      resp_msg_->msg_type = mV8_Worker_Config;
+      resp_msg_->opcode = oHandshakeAck;
       msg_priority_ = true;
       break;
     case oTerminate:
@@ -622,6 +1020,13 @@ void AppWorker::RouteMessageWithResponse(
       msg_priority_ = true;
       break;
 
+    case oGetN1qlLatencyStats:
+      resp_msg_->msg = n1ql_latency_stats_.ToString();
+      resp_msg_->msg_type = mV8_Worker_Config;
+      resp_msg_->opcode = oN1qlLatencyStats;
+      msg_priority_ = true;
+      break;
+
     case oInsight:
       resp_msg_->msg = GetInsight();
       resp_msg_->msg_type = mV8_Worker_Config;
@@ -685,6 +1090,7 @@ void AppWorker::RouteMessageWithResponse(
   case eDCP:
     switch (getDCPOpcode(worker_msg->header.opcode)) {
     case oDelete:
+    case oExpiration:
       worker_index = current_partition_thr_map_[worker_msg->header.partition];
       if (workers_[worker_index] != nullptr) {
         enqueued_dcp_delete_msg_counter++;
@@ -734,13 +1140,14 @@ void AppWorker::RouteMessageWithResponse(
                                          filter_seq_no, skip_ack, true)) {
           auto lck = worker->GetAndLockBucketOpsLock();
           auto last_processed_seq_no = worker->GetBucketopsSeqno(vb_no);
+          auto last_acked_seq_no = worker->GetAckedSeqno(vb_no);
           if (last_processed_seq_no < filter_seq_no) {
             worker->UpdateVbFilter(vb_no, filter_seq_no);
           }
           worker->RemoveTimerPartition(vb_no);
           lck.unlock();
           SendFilterAck(oVbFilter, mFilterAck, vb_no, last_processed_seq_no,
-                        skip_ack);
+                        last_acked_seq_no, skip_ack);
         }
       } else {
         LOG(logError) << "Filter event lost: worker " << worker_index
@@ -769,9 +1176,30 @@ void AppWorker::RouteMessageWithResponse(
       break;
     }
     break;
+  case eBus:
+    switch (getBusOpcode(worker_msg->header.opcode)) {
+    case oBusEvent:
+      worker_index = bus_worker_idx_;
+      if (thr_count_ > 0) {
+        bus_worker_idx_ = (bus_worker_idx_ + 1) % thr_count_;
+      }
+      if (workers_[worker_index] != nullptr) {
+        workers_[worker_index]->PushBack(std::move(worker_msg));
+      } else {
+        LOG(logError) << "Bus event lost: worker " << worker_index
+                      << " is null" << std::endl;
+        ++bus_events_lost;
+      }
+      break;
+    default:
+      LOG(logError) << "Opcode " << getBusOpcode(worker_msg->header.opcode)
+                    << "is not implemented for eBus" << std::endl;
+      break;
+    }
+    break;
   case ePauseConsumer: {
     pause_consumer_.store(true);
-    std::unordered_map<int64_t, uint64_t> lps_map;
+    std::unordered_map<int64_t, std::pair<uint64_t, uint64_t>> lps_map;
     for (int16_t idx = 0; idx < thr_count_; ++idx) {
       auto worker = workers_[idx];
       auto lck = worker->GetAndLockBucketOpsLock();
@@ -781,7 +1209,7 @@ void AppWorker::RouteMessageWithResponse(
         auto lps = worker->GetBucketopsSeqno(vb);
         worker->UpdateVbFilter(vb, std::numeric_limits<uint64_t>::max());
         worker->RemoveTimerPartition(vb);
-        lps_map[vb] = lps;
+        lps_map[vb] = {lps, worker->GetAckedSeqno(vb)};
       }
     }
     SendPauseAck(lps_map);
@@ -794,12 +1222,17 @@ void AppWorker::RouteMessageWithResponse(
                    << std::endl;
       msg_priority_ = true;
       break;
-    case oWorkerThreadCount:
+    case oWorkerThreadCount: {
       LOG(logInfo) << "Worker thread count: " << worker_msg->header.metadata
                    << std::endl;
-      thr_count_ = int16_t(std::stoi(worker_msg->header.metadata));
+      int64_t thr_count;
+      if (ParseSetting("worker thread count", worker_msg->header.metadata,
+                       thr_count)) {
+        thr_count_ = int16_t(thr_count);
+      }
       msg_priority_ = true;
       break;
+    }
     case oWorkerThreadMap:
       // TODO: Depricate oWorkerThreadMap because the new thread_map is being
       // computed in the Appworker
@@ -872,10 +1305,131 @@ void AppWorker::RouteMessageWithResponse(
     } break;
 
     case oWorkerMemQuota: {
-      memory_quota_ = std::stoll(worker_msg->header.metadata);
+      int64_t memory_quota;
+      if (ParseSetting("memory quota", worker_msg->header.metadata,
+                       memory_quota)) {
+        memory_quota_ = memory_quota;
+      }
       msg_priority_ = true;
       break;
     }
+    case oExecutionTimeout: {
+      int64_t execution_timeout = 0;
+      if (!ParseSetting("execution_timeout", worker_msg->header.metadata,
+                        execution_timeout)) {
+        break;
+      }
+      for (int16_t idx = 0; idx < thr_count_; ++idx) {
+        auto worker = workers_[idx];
+        if (worker != nullptr) {
+          worker->SetExecutionTimeout(int(execution_timeout));
+        }
+      }
+      LOG(logInfo) << "Setting execution_timeout to " << execution_timeout
+                   << std::endl;
+      msg_priority_ = true;
+      break;
+    }
+    case oSocketBatchSize: {
+      int64_t batch_size;
+      if (ParseSetting("batch size", worker_msg->header.metadata,
+                       batch_size)) {
+        batch_size_ = int(batch_size);
+      }
+      LOG(logInfo) << "Setting batch size to " << batch_size_ << std::endl;
+      msg_priority_ = true;
+      break;
+    }
+    case oDispatchLanes: {
+      // Metadata is of the form timer_lane_batch_size:dcp_lane_batch_size
+      const auto &lanes = worker_msg->header.metadata;
+      auto pos = lanes.find(':');
+      if (pos == std::string::npos) {
+        LOG(logError) << "Invalid dispatch lanes: " << lanes << std::endl;
+        break;
+      }
+      int64_t timer_lane_batch_size = 0, dcp_lane_batch_size = 0;
+      if (!ParseSetting("timer_lane_batch_size", lanes.substr(0, pos),
+                        timer_lane_batch_size) ||
+          !ParseSetting("dcp_lane_batch_size", lanes.substr(pos + 1),
+                        dcp_lane_batch_size)) {
+        break;
+      }
+      timer_lane_batch_size_ = timer_lane_batch_size;
+      dcp_lane_batch_size_ = dcp_lane_batch_size;
+      for (int16_t idx = 0; idx < thr_count_; ++idx) {
+        auto worker = workers_[idx];
+        if (worker != nullptr) {
+          worker->SetDispatchLanes(timer_lane_batch_size_,
+                                   dcp_lane_batch_size_);
+        }
+      }
+      LOG(logInfo) << "Setting timer_lane_batch_size to "
+                   << timer_lane_batch_size_ << " dcp_lane_batch_size to "
+                   << dcp_lane_batch_size_ << std::endl;
+      msg_priority_ = true;
+      break;
+    }
+    case oDeadLetterRetryCount:
+      if (!ParseSetting("dead_letter_retry_count", worker_msg->header.metadata,
+                        dead_letter_retry_count_)) {
+        break;
+      }
+      for (int16_t idx = 0; idx < thr_count_; ++idx) {
+        auto worker = workers_[idx];
+        if (worker != nullptr) {
+          worker->SetDeadLetterRetryCount(dead_letter_retry_count_);
+        }
+      }
+      LOG(logInfo) << "Setting dead_letter_retry_count to "
+                   << dead_letter_retry_count_ << std::endl;
+      msg_priority_ = true;
+      break;
+    case oHandlerRetryPolicy: {
+      // Metadata is of the form retry_count:retry_backoff:retry_on_mask
+      const auto &policy = worker_msg->header.metadata;
+      auto first = policy.find(':');
+      auto second =
+          first == std::string::npos ? first : policy.find(':', first + 1);
+      if (first == std::string::npos || second == std::string::npos) {
+        LOG(logError) << "Invalid retry policy: " << policy << std::endl;
+        break;
+      }
+      int64_t retry_count = 0, retry_backoff_ms = 0, retry_on = 0;
+      if (!ParseSetting("retry_count", policy.substr(0, first), retry_count) ||
+          !ParseSetting("retry_backoff",
+                        policy.substr(first + 1, second - first - 1),
+                        retry_backoff_ms) ||
+          !ParseSetting("retry_on", policy.substr(second + 1), retry_on)) {
+        break;
+      }
+      retry_count_ = retry_count;
+      retry_backoff_ms_ = retry_backoff_ms;
+      retry_on_ = retry_on;
+      for (int16_t idx = 0; idx < thr_count_; ++idx) {
+        auto worker = workers_[idx];
+        if (worker != nullptr) {
+          worker->SetRetryPolicy(retry_count_, retry_backoff_ms_, retry_on_);
+        }
+      }
+      LOG(logInfo) << "Setting retry_count to " << retry_count_
+                   << " retry_backoff to " << retry_backoff_ms_
+                   << " retry_on to " << retry_on_ << std::endl;
+      msg_priority_ = true;
+      break;
+    }
+    case oStrictOrderCheck:
+      strict_order_check_ = worker_msg->header.metadata == "true";
+      for (int16_t idx = 0; idx < thr_count_; ++idx) {
+        auto worker = workers_[idx];
+        if (worker != nullptr) {
+          worker->SetStrictOrderCheck(strict_order_check_);
+        }
+      }
+      LOG(logInfo) << "Setting strict_order_check to " << strict_order_check_
+                   << std::endl;
+      msg_priority_ = true;
+      break;
     default:
       LOG(logError) << "Opcode "
                     << getAppWorkerSettingOpcode(worker_msg->header.opcode)
@@ -885,6 +1439,24 @@ void AppWorker::RouteMessageWithResponse(
       break;
     }
     break;
+  case eTimer:
+    switch (getTimerOpcode(worker_msg->header.opcode)) {
+    case oCancelTimer:
+      worker_index = elected_partition_thr_map_[worker_msg->header.partition];
+      if (workers_[worker_index] != nullptr) {
+        workers_[worker_index]->PushBack(std::move(worker_msg));
+        msg_priority_ = true;
+      } else {
+        LOG(logError) << "Timer cancellation lost: worker " << worker_index
+                      << " is null" << std::endl;
+      }
+      break;
+    default:
+      LOG(logError) << "Opcode " << getTimerOpcode(worker_msg->header.opcode)
+                    << "is not implemented for eTimer" << std::endl;
+      break;
+    }
+    break;
   case eDebugger:
     switch (getDebuggerOpcode(worker_msg->header.opcode)) {
     case oDebuggerStart:
@@ -945,7 +1517,9 @@ void AppWorker::WriteResponses() {
     for (const auto &w : workers_) {
       std::vector<uv_buf_t> messages;
       std::vector<int> length_prefix_sum;
-      w.second->GetBucketOpsMessages(messages);
+      w.second->GetDeadLetterAndAckMessages(messages);
+      w.second->GetBusEventMessages(messages);
+      w.second->GetTimerAckMessages(messages);
       if (messages.empty()) {
         continue;
       }
@@ -1127,12 +1701,16 @@ void AppWorker::StopUvLoop(uv_async_t *async) {
   uv_stop(handle);
 }
 
+// Filter ack carries both the last seq no received and the last one handler
+// acked, eventing-consumer checkpoints one of them as per delivery guarantee
 void AppWorker::SendFilterAck(int opcode, int msgtype, int vb_no,
-                              int64_t seq_no, bool skip_ack) {
+                              int64_t seq_no, uint64_t acked_seq_no,
+                              bool skip_ack) {
   std::ostringstream filter_ack;
   filter_ack << R"({"vb":)";
   filter_ack << vb_no << R"(, "seq":)";
-  filter_ack << seq_no << R"(, "skip_ack":)";
+  filter_ack << seq_no << R"(, "acked_seq":)";
+  filter_ack << acked_seq_no << R"(, "skip_ack":)";
   filter_ack << skip_ack << "}";
 
   resp_msg_->msg.assign(filter_ack.str());
@@ -1157,12 +1735,14 @@ AppWorker::PartitionVbuckets(const std::vector<int64_t> &vbuckets) const {
 }
 
 void AppWorker::SendPauseAck(
-    const std::unordered_map<int64_t, uint64_t> &lps_map) {
+    const std::unordered_map<int64_t, std::pair<uint64_t, uint64_t>>
+        &lps_map) {
   nlohmann::json lps_list;
   for (const auto &[vb, lps] : lps_map) {
     nlohmann::json lps_info;
     lps_info["vb"] = vb;
-    lps_info["seq"] = lps;
+    lps_info["seq"] = lps.first;
+    lps_info["acked_seq"] = lps.second;
     lps_list.push_back(lps_info);
   }
   resp_msg_->msg.assign(lps_list.dump());
@@ -28,6 +28,8 @@ event_type getEvent(int8_t event) {
     return eInternal;
   if (event == 8)
     return ePauseConsumer;
+  if (event == 9)
+    return eBus;
   return Event_Unknown;
 }
 
@@ -58,6 +60,14 @@ v8_worker_opcode getV8WorkerOpcode(int8_t opcode) {
     return oGetCurlLatencyStats;
   if (opcode == 13)
     return oInsight;
+  if (opcode == 14)
+    return oLoadChunk;
+  if (opcode == 15)
+    return oLoadChunkCommit;
+  if (opcode == 16)
+    return oHandshake;
+  if (opcode == 17)
+    return oGetN1qlLatencyStats;
   return V8_Worker_Opcode_Unknown;
 }
 
@@ -68,6 +78,8 @@ dcp_opcode getDCPOpcode(int8_t opcode) {
     return oMutation;
   if (opcode == 3)
     return oNoOp;
+  if (opcode == 4)
+    return oExpiration;
   return DCP_Opcode_Unknown;
 }
 
@@ -84,12 +96,26 @@ app_worker_setting_opcode getAppWorkerSettingOpcode(int8_t opcode) {
     return oVbMap;
   if (opcode == 6)
     return oWorkerMemQuota;
+  if (opcode == 7)
+    return oExecutionTimeout;
+  if (opcode == 8)
+    return oSocketBatchSize;
+  if (opcode == 9)
+    return oDispatchLanes;
+  if (opcode == 10)
+    return oDeadLetterRetryCount;
+  if (opcode == 11)
+    return oHandlerRetryPolicy;
+  if (opcode == 12)
+    return oStrictOrderCheck;
   return App_Worker_Setting_Opcode_Unknown;
 }
 
 timer_opcode getTimerOpcode(int8_t opcode) {
   if (opcode == 1)
     return oTimer;
+  if (opcode == 2)
+    return oCancelTimer;
   return Timer_Opcode_Unknown;
 }
 
@@ -108,3 +134,9 @@ debugger_opcode getDebuggerOpcode(int8_t opcode) {
     return oDebuggerStop;
   return Debugger_Opcode_Unknown;
 }
+
+bus_opcode getBusOpcode(int8_t opcode) {
+  if (opcode == 1)
+    return oBusEvent;
+  return Bus_Opcode_Unknown;
+}
@@ -62,6 +62,13 @@ deployment_config *ParseDeployment(const char *app_code) {
       buckets_info[*alias].push_back("rw");
     }
   }
+
+  for (flatbuffers::uoffset_t i = 0; i < buckets->size(); i++) {
+    auto durability = buckets->Get(i)->durability();
+    buckets_info[buckets->Get(i)->alias()->str()].push_back(
+        durability != nullptr && durability->size() > 0 ? durability->str()
+                                                        : "none");
+  }
   config->component_configs["buckets"] = buckets_info;
 
   const auto curl_cfg = app_cfg->curl();
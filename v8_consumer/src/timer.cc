@@ -124,9 +124,7 @@ bool Timer::CancelTimerImpl(const v8::FunctionCallbackInfo<v8::Value> &args) {
   timer_info.callback = utils->GetFunctionName(args[0]);
   timer_info.reference = utils->ToCPPString(args[1]);
 
-  FillTimerPartition(timer_info, v8worker->num_vbuckets_);
-
-  auto err = v8worker->DelTimer(timer_info);
+  auto err = RemoveTimer(timer_info);
 
   if (err == LCB_SUCCESS) {
     args.GetReturnValue().Set(true);
@@ -141,6 +139,14 @@ bool Timer::CancelTimerImpl(const v8::FunctionCallbackInfo<v8::Value> &args) {
   return true;
 }
 
+// Removes timer identified by callback and reference from timer store, used by
+// cancelTimer calls from handler as well as cancellations sent by Go process
+lcb_STATUS Timer::RemoveTimer(timer::TimerInfo &timer_info) {
+  auto v8worker = UnwrapData(isolate_)->v8worker;
+  FillTimerPartition(timer_info, v8worker->num_vbuckets_);
+  return v8worker->DelTimer(timer_info);
+}
+
 bool Timer::ValidateCancelTimerArgs(
     const v8::FunctionCallbackInfo<v8::Value> &args) {
   auto js_exception = UnwrapData(isolate_)->js_exception;
@@ -9,6 +9,7 @@
 // or implied. See the License for the specific language governing
 // permissions and limitations under the License.
 
+#include <algorithm>
 #include <mutex>
 #include <nlohmann/json.hpp>
 #include <string>
@@ -57,10 +58,35 @@ std::atomic<int64_t> filtered_dcp_mutation_counter = {0};
 std::atomic<int64_t> timer_msg_counter = {0};
 std::atomic<int64_t> timer_create_counter = {0};
 std::atomic<int64_t> timer_cancel_counter = {0};
+std::atomic<int64_t> timer_cancel_failure = {0};
 
 std::atomic<int64_t> enqueued_dcp_delete_msg_counter = {0};
 std::atomic<int64_t> enqueued_dcp_mutation_msg_counter = {0};
 std::atomic<int64_t> enqueued_timer_msg_counter = {0};
+std::atomic<int64_t> dcp_lane_dispatched = {0};
+std::atomic<int64_t> timer_lane_dispatched = {0};
+std::atomic<int64_t> timer_lane_yields = {0};
+std::atomic<int64_t> dead_letter_counter = {0};
+std::atomic<int64_t> dead_letter_events_lost = {0};
+std::atomic<int64_t> handler_ack_held_counter = {0};
+std::atomic<int64_t> handler_retry_counter = {0};
+std::atomic<int64_t> handler_retry_success = {0};
+std::atomic<int64_t> dispatch_order_violation_counter = {0};
+
+std::atomic<int64_t> bus_event_emitted = {0};
+std::atomic<int64_t> bus_events_lost = {0};
+std::atomic<int64_t> bus_event_msg_counter = {0};
+std::atomic<int64_t> on_event_success = {0};
+std::atomic<int64_t> on_event_failure = {0};
+
+std::atomic<int64_t> n1ql_query_counter = {0};
+std::atomic<int64_t> n1ql_query_success = {0};
+
+// Dead letters held by a worker thread till they're sent to eventing-consumer
+const size_t max_pending_dead_letters = 10000;
+
+// Bus events held by a worker thread till they're sent to eventing-consumer
+const size_t max_pending_bus_events = 10000;
 
 std::atomic<int64_t> timer_callback_missing_counter = {0};
 
@@ -116,6 +142,8 @@ v8::Local<v8::ObjectTemplate> V8Worker::NewGlobalObj() const {
               v8::FunctionTemplate::New(isolate_, Crc64Function));
   global->Set(v8::String::NewFromUtf8(isolate_, "N1QL").ToLocalChecked(),
               v8::FunctionTemplate::New(isolate_, QueryFunction));
+  global->Set(v8::String::NewFromUtf8(isolate_, "emitEvent").ToLocalChecked(),
+              v8::FunctionTemplate::New(isolate_, EmitEvent));
 
   for (const auto &type_name : exception_type_names_) {
     global->Set(
@@ -185,17 +213,21 @@ void V8Worker::InstallBucketBindings(
   }
 
   for (const auto &[bucket_alias, bucket_info] : buckets_it->second) {
-    // bucket_info -> {bucketName, scopeName, collectionName, alias, access}
+    // bucket_info -> {bucketName, scopeName, collectionName, alias, access,
+    // durability}
     const auto &bucket_name = bucket_info[0];
     const auto &scope_name = bucket_info[1];
     const auto &collection_name = bucket_info[2];
     const auto &bucket_access = bucket_info[4];
+    const std::string bucket_durability =
+        bucket_info.size() > 5 ? bucket_info[5] : "none";
     auto source_mutation = bucket_name == cb_source_bucket_ &&
                            scope_name == cb_source_scope_ &&
                            collection_name == cb_source_collection_;
     bucket_bindings_.emplace_back(isolate_, bucket_factory_, bucket_name,
                                   scope_name, collection_name, bucket_alias,
-                                  bucket_access == "r", source_mutation);
+                                  bucket_access == "r", source_mutation,
+                                  DurabilityLevelFromString(bucket_durability));
   }
 }
 
@@ -238,6 +270,12 @@ void V8Worker::InitializeIsolateData(const server_settings_t *server_settings,
       static_cast<lcb_U32>(h_config->execution_timeout < 3
                                ? 500000
                                : (h_config->execution_timeout - 2) * 1000000);
+  // n1ql_timeout setting can only tighten it further
+  if (h_config->n1ql_timeout > 0 &&
+      h_config->n1ql_timeout < h_config->execution_timeout - 2) {
+    data_.n1ql_timeout = static_cast<lcb_U32>(
+        ConvertSecondsToMicroSeconds(h_config->n1ql_timeout));
+  }
   data_.op_timeout = h_config->execution_timeout < 5
                          ? h_config->execution_timeout
                          : h_config->execution_timeout - 2;
@@ -266,6 +304,7 @@ V8Worker::V8Worker(v8::Platform *platform, handler_config_t *h_config,
                    const std::string &function_instance_id,
                    const std::string &user_prefix, Histogram *latency_stats,
                    Histogram *curl_latency_stats,
+                   Histogram *n1ql_latency_stats,
                    const std::string &ns_server_port,
                    const int32_t &num_vbuckets, vb_seq_map_t *vb_seq,
                    std::vector<uint64_t> *processed_bucketops,
@@ -275,6 +314,7 @@ V8Worker::V8Worker(v8::Platform *platform, handler_config_t *h_config,
       timer_reduction_ratio_(
           int(num_vbuckets / h_config->num_timer_partitions)),
       latency_stats_(latency_stats), curl_latency_stats_(curl_latency_stats),
+      n1ql_latency_stats_(n1ql_latency_stats),
       vb_seq_(vb_seq), vb_locks_(vb_locks), worker_idx_(worker_idx),
       processed_bucketops_(processed_bucketops), platform_(platform),
       function_name_(function_name), function_id_(function_id),
@@ -297,6 +337,12 @@ V8Worker::V8Worker(v8::Platform *platform, handler_config_t *h_config,
   update_v8_heap_.store(false);
   run_gc_.store(false);
   vbfilter_map_ = std::vector<std::vector<uint64_t>>(num_vbuckets_);
+  acked_seq_ = std::vector<uint64_t>(num_vbuckets_, 0);
+  last_acked_seq_ = std::vector<uint64_t>(num_vbuckets_, 0);
+  acks_held_ = std::vector<bool>(num_vbuckets_, false);
+  dispatch_seq_ = std::vector<uint64_t>(num_vbuckets_, 0);
+  timer_acked_seq_ = std::vector<uint64_t>(num_vbuckets_, 0);
+  timers_fired_ = std::vector<uint64_t>(num_vbuckets_, 0);
 
   v8::Isolate::CreateParams create_params;
   create_params.array_buffer_allocator =
@@ -346,6 +392,7 @@ V8Worker::V8Worker(v8::Platform *platform, handler_config_t *h_config,
                << " curr_eventing_sslport: " << RS(settings_->eventing_sslport)
                << " lcb_cap: " << h_config->lcb_inst_capacity
                << " n1ql_consistency: " << h_config->n1ql_consistency
+               << " n1ql_timeout: " << h_config->n1ql_timeout
                << " execution_timeout: " << h_config->execution_timeout
                << " timer_context_size: " << h_config->timer_context_size
                << " ns_server_port: " << ns_server_port_
@@ -523,7 +570,15 @@ int V8Worker::V8WorkerLoad(std::string script_to_execute) {
     return kToLocalFailed;
   }
 
-  if (!on_update_def->IsFunction() && !on_delete_def->IsFunction()) {
+  // Functions subscribed to event bus topics may define OnEvent alone
+  v8::Local<v8::Value> on_event_def;
+  if (!TO_LOCAL(global->Get(context, v8Str(isolate_, "OnEvent")),
+                &on_event_def)) {
+    return kToLocalFailed;
+  }
+
+  if (!on_update_def->IsFunction() && !on_delete_def->IsFunction() &&
+      !on_event_def->IsFunction()) {
     return kNoHandlersDefined;
   }
 
@@ -584,8 +639,11 @@ int V8Worker::V8WorkerLoad(std::string script_to_execute) {
   }
 
   // Spawning terminator thread to monitor the wall clock time for execution
-  // of javascript code isn't going beyond max_task_duration
-  terminator_thr_ = new std::thread(&V8Worker::TaskDurationWatcher, this);
+  // of javascript code isn't going beyond max_task_duration. Reloads of
+  // swapped code keep the one spawned on first load
+  if (terminator_thr_ == nullptr) {
+    terminator_thr_ = new std::thread(&V8Worker::TaskDurationWatcher, this);
+  }
   return kSuccess;
 }
 
@@ -597,87 +655,358 @@ void V8Worker::RouteMessage() {
       continue;
     }
 
-    LOG(logTrace) << " event: " << static_cast<int16_t>(msg->header.event)
-                  << " opcode: " << static_cast<int16_t>(msg->header.opcode)
-                  << " metadata: " << RU(msg->header.metadata)
-                  << " partition: " << msg->header.partition << std::endl;
-
-    auto evt = getEvent(msg->header.event);
-    switch (evt) {
-    case eDCP:
-      switch (getDCPOpcode(msg->header.opcode)) {
-      case oDelete:
-        HandleDeleteEvent(msg);
-        break;
-
-      case oMutation:
-        HandleMutationEvent(msg);
-        break;
-
-      case oNoOp:
-        HandleNoOpEvent(msg);
-        break;
-
-      default:
-        LOG(logError) << "Received invalid DCP opcode" << std::endl;
-        break;
-      }
-      processed_events_size += msg->payload.GetSize();
-      num_processed_events++;
+    DispatchMessage(msg);
+  }
+}
+
+void V8Worker::DispatchMessage(const std::unique_ptr<WorkerMessage> &msg) {
+  LOG(logTrace) << " event: " << static_cast<int16_t>(msg->header.event)
+                << " opcode: " << static_cast<int16_t>(msg->header.opcode)
+                << " metadata: " << RU(msg->header.metadata)
+                << " partition: " << msg->header.partition << std::endl;
+
+  auto evt = getEvent(msg->header.event);
+  switch (evt) {
+  case eDCP:
+    CheckDispatchOrder(msg->header.partition, msg->header.seq);
+    switch (getDCPOpcode(msg->header.opcode)) {
+    case oDelete:
+    case oExpiration:
+      HandleDeleteEvent(msg);
       break;
 
-    case eInternal:
-      switch (msg->header.opcode) {
-      case oScanTimer: {
-        auto iter = timer_store_->GetIterator();
-        timer::TimerEvent evt;
-        while (!stop_timer_scan_.load() && iter.GetNext(evt)) {
-          ++timer_msg_counter;
-          this->SendTimer(evt.callback, evt.context);
-          timer_store_->DeleteTimer(evt);
-        }
-        if (stop_timer_scan_.load()) {
-          timer_store_->SyncSpan();
-        }
-        scan_timer_.store(false);
-        break;
-      }
-      case oUpdateV8HeapSize: {
-        UpdateV8HeapSize();
-        update_v8_heap_.store(false);
-        break;
-      }
-      case oRunGc: {
-        ForceRunGarbageCollector();
-        run_gc_.store(false);
-        break;
-      }
-      default:
-        LOG(logError) << "Received invalid internal opcode" << std::endl;
-        break;
-      }
+    case oMutation:
+      HandleMutationEvent(msg);
+      break;
+
+    case oNoOp:
+      HandleNoOpEvent(msg);
       break;
-    case eDebugger:
-      switch (getDebuggerOpcode(msg->header.opcode)) {
-      case oDebuggerStart:
-        this->StartDebugger();
-        break;
-
-      case oDebuggerStop:
-        this->StopDebugger();
-        break;
-
-      default:
-        LOG(logError) << "Received invalid debugger opcode" << std::endl;
-        break;
+
+    default:
+      LOG(logError) << "Received invalid DCP opcode" << std::endl;
+      break;
+    }
+    ++dcp_lane_dispatched;
+    processed_events_size += msg->payload.GetSize();
+    num_processed_events++;
+    break;
+
+  case eInternal:
+    switch (msg->header.opcode) {
+    case oScanTimer:
+      ScanTimers();
+      break;
+    case oUpdateV8HeapSize: {
+      UpdateV8HeapSize();
+      update_v8_heap_.store(false);
+      break;
+    }
+    case oRunGc: {
+      ForceRunGarbageCollector();
+      run_gc_.store(false);
+      break;
+    }
+    case oReloadCode: {
+      auto rc = V8WorkerLoad(msg->header.metadata);
+      if (rc != kSuccess) {
+        LOG(logError) << "Failed to reload handler code, rc: " << rc
+                      << std::endl;
       }
       break;
+    }
+    default:
+      LOG(logError) << "Received invalid internal opcode" << std::endl;
+      break;
+    }
+    break;
+  case eBus:
+    switch (getBusOpcode(msg->header.opcode)) {
+    case oBusEvent:
+      HandleBusEvent(msg);
+      break;
+
+    default:
+      LOG(logError) << "Received invalid bus opcode" << std::endl;
+      break;
+    }
+    break;
+  case eTimer:
+    switch (getTimerOpcode(msg->header.opcode)) {
+    case oCancelTimer:
+      CancelTimer(msg->header.metadata);
+      break;
+
+    default:
+      LOG(logError) << "Received invalid timer opcode" << std::endl;
+      break;
+    }
+    break;
+  case eDebugger:
+    switch (getDebuggerOpcode(msg->header.opcode)) {
+    case oDebuggerStart:
+      this->StartDebugger(msg->header.metadata);
+      break;
+
+    case oDebuggerStop:
+      this->StopDebugger();
+      break;
+
     default:
-      LOG(logError) << "Received unsupported event " << evt << std::endl;
+      LOG(logError) << "Received invalid debugger opcode" << std::endl;
       break;
     }
+    break;
+  default:
+    LOG(logError) << "Received unsupported event " << evt << std::endl;
+    break;
+  }
+
+  ++messages_processed_counter;
+}
 
-    ++messages_processed_counter;
+// Timer callbacks and DCP events are dispatched in separate lanes. While a scan
+// is in progress, timer lane yields to DCP events queued behind it after every
+// timer_lane_batch_size callbacks, serving up to dcp_lane_batch_size of them
+void V8Worker::ScanTimers() {
+  auto iter = timer_store_->GetIterator();
+  timer::TimerEvent evt;
+  int64_t batch = 0;
+  while (!stop_timer_scan_.load() && iter.GetNext(evt)) {
+    ++timer_msg_counter;
+    ++timer_lane_dispatched;
+    this->SendTimer(evt.callback, evt.context);
+    timer_store_->DeleteTimer(evt);
+    AckTimer(evt);
+
+    if (++batch >= timer_lane_batch_size_.load()) {
+      ServeDcpLane();
+      batch = 0;
+    }
+  }
+  if (stop_timer_scan_.load()) {
+    timer_store_->SyncSpan();
+  }
+  scan_timer_.store(false);
+}
+
+void V8Worker::ServeDcpLane() {
+  auto limit = dcp_lane_batch_size_.load();
+  int64_t served = 0;
+  while (served < limit && !thread_exit_cond_.load() &&
+         worker_queue_->GetSize() > 0) {
+    std::unique_ptr<WorkerMessage> msg;
+    if (!worker_queue_->PopFront(msg)) {
+      break;
+    }
+    // Scan isn't reentrant, but client doesn't enqueue another one till
+    // scan_timer_ is reset
+    DispatchMessage(msg);
+    ++served;
+  }
+  if (served > 0) {
+    ++timer_lane_yields;
+  }
+}
+
+void V8Worker::SetDispatchLanes(int64_t timer_batch_size,
+                                int64_t dcp_batch_size) {
+  timer_lane_batch_size_.store(timer_batch_size);
+  dcp_lane_batch_size_.store(dcp_batch_size);
+}
+
+// Mutations the handler kept throwing for, beyond dead_letter_retry_count
+// retries, are handed over to eventing-consumer to be written to dead letter
+// keyspace. A negative retry count means dead letter keyspace isn't configured.
+// Mutation is acked along with queueing the letter, returns true if it was
+bool V8Worker::AddDeadLetter(const std::string &event, const std::string &meta,
+                             const std::string &value, bool is_binary,
+                             int attempts, int vb, uint64_t seq_num) {
+  if (dead_letter_retry_count_.load() < 0) {
+    return false;
+  }
+
+  nlohmann::json letter;
+  try {
+    letter["meta"] = nlohmann::json::parse(meta);
+  } catch (const nlohmann::json::parse_error &e) {
+    LOG(logError) << "Unable to parse meta for dead letter: " << e.what()
+                  << std::endl;
+    ++dead_letter_events_lost;
+    return false;
+  }
+  letter["event"] = event;
+  letter["is_binary"] = is_binary;
+  letter["value"] = is_binary ? base64Encode(value) : value;
+  letter["error"] = last_exception_;
+  letter["attempts"] = attempts;
+
+  std::lock_guard<std::mutex> guard(dead_letters_lock_);
+  if (dead_letters_.size() >= max_pending_dead_letters) {
+    ++dead_letter_events_lost;
+    return false;
+  }
+  dead_letters_.push_back(letter.dump());
+  ++dead_letter_counter;
+  AckSeqNum(vb, seq_num);
+  return true;
+}
+
+// Dead letters go out ahead of acks and under the lock they're acked with, so
+// eventing-consumer holds checkpoint of the vb till the letter is written,
+// before it gets to see the ack
+void V8Worker::GetDeadLetterAndAckMessages(std::vector<uv_buf_t> &messages) {
+  std::lock_guard<std::mutex> guard(dead_letters_lock_);
+  for (const auto &letter : dead_letters_) {
+    auto curr_messages = BuildResponse(letter, mDead_Letter, 0);
+    for (auto &msg : curr_messages) {
+      messages.push_back(msg);
+    }
+  }
+  dead_letters_.clear();
+  GetBucketOpsMessages(messages);
+}
+
+// Events emitted by handler are handed over to eventing-consumer, which routes
+// them to functions subscribed to the topic
+bool V8Worker::AddBusEvent(const std::string &topic,
+                           const std::string &payload) {
+  nlohmann::json evt;
+  evt["topic"] = topic;
+  try {
+    evt["payload"] = nlohmann::json::parse(payload);
+  } catch (const nlohmann::json::parse_error &e) {
+    LOG(logError) << "Unable to parse payload of bus event: " << e.what()
+                  << std::endl;
+    ++bus_events_lost;
+    return false;
+  }
+
+  std::lock_guard<std::mutex> guard(bus_events_lock_);
+  if (bus_events_.size() >= max_pending_bus_events) {
+    ++bus_events_lost;
+    return false;
+  }
+  bus_events_.push_back(evt.dump());
+  ++bus_event_emitted;
+  return true;
+}
+
+void V8Worker::GetBusEventMessages(std::vector<uv_buf_t> &messages) {
+  std::vector<std::string> events;
+  {
+    std::lock_guard<std::mutex> guard(bus_events_lock_);
+    events.swap(bus_events_);
+  }
+
+  for (const auto &evt : events) {
+    auto curr_messages = BuildResponse(evt, mBus_Event, 0);
+    for (auto &msg : curr_messages) {
+      messages.push_back(msg);
+    }
+  }
+}
+
+void V8Worker::GetTimerAckMessages(std::vector<uv_buf_t> &messages) {
+  for (int vb = 0; vb < num_vbuckets_; ++vb) {
+    auto lock = GetAndLockVbLock(vb);
+    if (timers_fired_[vb] > 0) {
+      nlohmann::json ack;
+      ack["vb"] = vb;
+      ack["seq"] = timer_acked_seq_[vb];
+      ack["timers_fired"] = timers_fired_[vb];
+      auto curr_messages =
+          BuildResponse(ack.dump(), mTimer_Response, timerAckResponse);
+      for (auto &msg : curr_messages) {
+        messages.push_back(msg);
+      }
+      timer_acked_seq_[vb] = 0;
+      timers_fired_[vb] = 0;
+    }
+    lock.unlock();
+  }
+}
+
+void V8Worker::SetDeadLetterRetryCount(int64_t retry_count) {
+  dead_letter_retry_count_.store(retry_count);
+}
+
+void V8Worker::SetRetryPolicy(int64_t retry_count, int64_t retry_backoff_ms,
+                              int64_t retry_on) {
+  retry_count_.store(retry_count);
+  retry_backoff_ms_.store(retry_backoff_ms);
+  retry_on_.store(retry_on);
+}
+
+// Timeouts are executions terminated for exceeding execution_timeout, while
+// lcb errors surface as KVError thrown by bucket ops
+int V8Worker::ClassifyFailure(const v8::TryCatch &try_catch) {
+  if (try_catch.HasTerminated()) {
+    return fTimeout;
+  }
+
+  auto exception = try_catch.Exception();
+  if (!exception.IsEmpty() && exception->IsObject()) {
+    v8::String::Utf8Value name(
+        isolate_, exception.As<v8::Object>()->GetConstructorName());
+    if (*name != nullptr && std::string(*name) == "KVError") {
+      return fLcbError;
+    }
+  }
+  return fJsException;
+}
+
+// Retry policy applies to failures of kinds in retry_on, while mutations that
+// would be dead lettered are retried at least dead_letter_retry_count times.
+// Backoff is slept on the worker thread, so it's only for retries of the policy
+// and dead letter retries run back to back
+bool V8Worker::ShouldRetryHandler(int attempts) const {
+  if (last_failure_kind_ == fNone) {
+    return false;
+  }
+
+  int64_t policy_retries = 0;
+  if (retry_on_.load() & last_failure_kind_) {
+    policy_retries = retry_count_.load();
+  }
+  int64_t retries = policy_retries;
+  if (!last_exception_.empty()) {
+    retries = std::max(retries, dead_letter_retry_count_.load());
+  }
+  if (attempts > retries) {
+    return false;
+  }
+
+  ++handler_retry_counter;
+  auto backoff = retry_backoff_ms_.load();
+  if (backoff > 0 && attempts <= policy_retries) {
+    std::this_thread::sleep_for(std::chrono::milliseconds(backoff));
+  }
+  return true;
+}
+
+void V8Worker::SetStrictOrderCheck(bool strict_order_check) {
+  strict_order_check_.store(strict_order_check);
+}
+
+// Eventing-consumer stamps DCP events of a vb with an increasing dispatch seq.
+// Gaps are fine as events of filtered vbs are dropped, but an event must never
+// be processed after one that was dispatched later
+void V8Worker::CheckDispatchOrder(const int16_t vb, const uint64_t seq) {
+  if (seq == 0 || vb < 0 || vb >= num_vbuckets_) {
+    return;
+  }
+
+  auto lock = GetAndLockVbLock(vb);
+  auto last_seq = dispatch_seq_[vb];
+  dispatch_seq_[vb] = seq;
+  lock.unlock();
+
+  if (strict_order_check_.load() && seq <= last_seq) {
+    ++dispatch_order_violation_counter;
+    LOG(logError) << "vb: " << vb << " dispatch seq: " << seq
+                  << " processed after dispatch seq: " << last_seq
+                  << std::endl;
   }
 }
 
@@ -690,6 +1019,68 @@ void V8Worker::UpdateSeqNumLocked(const int vb, const uint64_t seq_num) {
   lock.unlock();
 }
 
+void V8Worker::AckSeqNum(const int vb, const uint64_t seq_num) {
+  auto lock = GetAndLockVbLock(vb);
+  if (acks_held_[vb]) {
+    return;
+  }
+  acked_seq_[vb] = seq_num;
+  last_acked_seq_[vb] = seq_num;
+  lock.unlock();
+}
+
+// Acking a later mutation would checkpoint past the one handler failed for,
+// so acks of the vb are held till its stream is restarted and replays it
+void V8Worker::HoldAcks(const int vb, const uint64_t seq_num) {
+  auto lock = GetAndLockVbLock(vb);
+  if (acks_held_[vb]) {
+    return;
+  }
+  acks_held_[vb] = true;
+  auto last_acked = last_acked_seq_[vb];
+  lock.unlock();
+  ++handler_ack_held_counter;
+  LOG(logWarning) << "vb: " << vb << " seq: " << seq_num
+                  << " handler failed, holding acks at seq: " << last_acked
+                  << std::endl;
+}
+
+uint64_t V8Worker::GetAckedSeqno(const int vb_no) {
+  auto lock = GetAndLockVbLock(vb_no);
+  return last_acked_seq_[vb_no];
+}
+
+// Timer progress is acked per vb to eventing-consumer, so that it checkpoints
+// seq no of the latest mutation whose timer fired
+void V8Worker::AckTimer(const timer::TimerEvent &evt) {
+  if (evt.partition < 0 || evt.partition >= num_vbuckets_) {
+    return;
+  }
+
+  auto lock = GetAndLockVbLock(evt.partition);
+  timer_acked_seq_[evt.partition] =
+      std::max(timer_acked_seq_[evt.partition], evt.seq_num);
+  ++timers_fired_[evt.partition];
+  lock.unlock();
+}
+
+// Origin tags are meant for bucket ops alone, so they're taken out of the
+// metadata handler gets to see
+void V8Worker::TakeEventOrigin(const std::unique_ptr<WorkerMessage> &msg) {
+  event_origin_.clear();
+  if (msg->header.metadata.find("\"origin\"") == std::string::npos) {
+    return;
+  }
+
+  auto meta = nlohmann::json::parse(msg->header.metadata, nullptr, false);
+  if (meta.is_discarded() || !meta.is_object() || !meta["origin"].is_string()) {
+    return;
+  }
+  event_origin_ = meta["origin"].get<std::string>();
+  meta.erase("origin");
+  msg->header.metadata = meta.dump();
+}
+
 void V8Worker::HandleDeleteEvent(const std::unique_ptr<WorkerMessage> &msg) {
 
   ++dcp_delete_msg_counter;
@@ -707,9 +1098,27 @@ void V8Worker::HandleDeleteEvent(const std::unique_ptr<WorkerMessage> &msg) {
     UpdateSeqNumLocked(vb, seq_num);
   }
 
+  TakeEventOrigin(msg);
   const auto options = flatbuf::payload::GetPayload(
       static_cast<const void *>(msg->payload.payload.c_str()));
-  SendDelete(options->value()->str(), msg->header.metadata);
+  const auto value = options->value()->str();
+  const auto expired = getDCPOpcode(msg->header.opcode) == oExpiration;
+  auto result = SendDelete(value, msg->header.metadata, expired);
+  auto attempts = 1;
+  while (result == kOnDeleteCallFail && ShouldRetryHandler(attempts)) {
+    result = SendDelete(value, msg->header.metadata, expired);
+    ++attempts;
+  }
+  if (result == kSuccess && attempts > 1) {
+    ++handler_retry_success;
+  }
+  if (result == kSuccess) {
+    AckSeqNum(vb, seq_num);
+  } else if (result != kOnDeleteCallFail || last_exception_.empty() ||
+             !AddDeadLetter("OnDelete", msg->header.metadata, value, false,
+                            attempts, vb, seq_num)) {
+    HoldAcks(vb, seq_num);
+  }
 }
 
 void V8Worker::HandleMutationEvent(const std::unique_ptr<WorkerMessage> &msg) {
@@ -729,9 +1138,28 @@ void V8Worker::HandleMutationEvent(const std::unique_ptr<WorkerMessage> &msg) {
     UpdateSeqNumLocked(vb, seq_num);
   }
 
+  TakeEventOrigin(msg);
   const auto doc = flatbuf::payload::GetPayload(
       static_cast<const void *>(msg->payload.payload.c_str()));
-  SendUpdate(doc->value()->str(), msg->header.metadata, doc->is_binary());
+  const auto value = doc->value()->str();
+  const auto xattrs = doc->xattrs() != nullptr ? doc->xattrs()->str() : "";
+  auto result =
+      SendUpdate(value, msg->header.metadata, xattrs, doc->is_binary());
+  auto attempts = 1;
+  while (result == kOnUpdateCallFail && ShouldRetryHandler(attempts)) {
+    result = SendUpdate(value, msg->header.metadata, xattrs, doc->is_binary());
+    ++attempts;
+  }
+  if (result == kSuccess && attempts > 1) {
+    ++handler_retry_success;
+  }
+  if (result == kSuccess) {
+    AckSeqNum(vb, seq_num);
+  } else if (result != kOnUpdateCallFail || last_exception_.empty() ||
+             !AddDeadLetter("OnUpdate", msg->header.metadata, value,
+                            doc->is_binary(), attempts, vb, seq_num)) {
+    HoldAcks(vb, seq_num);
+  }
 }
 
 void V8Worker::HandleNoOpEvent(const std::unique_ptr<WorkerMessage> &msg) {
@@ -747,6 +1175,7 @@ void V8Worker::HandleNoOpEvent(const std::unique_ptr<WorkerMessage> &msg) {
     }
     UpdateSeqNumLocked(vb, seq_num);
   }
+  AckSeqNum(vb, seq_num);
   no_op_counter++;
 }
 
@@ -815,6 +1244,18 @@ void V8Worker::ListLcbExceptions(std::map<int, int64_t> &agg_lcb_exceptions) {
   }
 }
 
+void V8Worker::AddN1qlError(int err_code) {
+  std::lock_guard<std::mutex> lock(lcb_exception_mtx_);
+  n1ql_errors_[err_code]++;
+}
+
+void V8Worker::ListN1qlErrors(std::map<int, int64_t> &agg_n1ql_errors) {
+  std::lock_guard<std::mutex> lock(lcb_exception_mtx_);
+  for (auto const &entry : n1ql_errors_) {
+    agg_n1ql_errors[entry.first] += entry.second;
+  }
+}
+
 void V8Worker::UpdateHistogram(Time::time_point start_time) {
   Time::time_point t = Time::now();
   nsecs ns = std::chrono::duration_cast<nsecs>(t - start_time);
@@ -827,8 +1268,14 @@ void V8Worker::UpdateCurlLatencyHistogram(const Time::time_point &start) {
   curl_latency_stats_->Add(ns.count() / 1000);
 }
 
+void V8Worker::UpdateN1qlLatencyHistogram(const Time::time_point &start) {
+  Time::time_point t = Time::now();
+  nsecs ns = std::chrono::duration_cast<nsecs>(t - start);
+  n1ql_latency_stats_->Add(ns.count() / 1000);
+}
+
 int V8Worker::SendUpdate(const std::string &value, const std::string &meta,
-                         bool is_binary) {
+                         const std::string &xattrs, bool is_binary) {
   const auto start_time = Time::now();
 
   v8::Locker locker(isolate_);
@@ -839,6 +1286,8 @@ int V8Worker::SendUpdate(const std::string &value, const std::string &meta,
   v8::Context::Scope context_scope(context);
 
   LOG(logTrace) << "value: " << RU(value) << " meta: " << RU(meta) << std::endl;
+  last_exception_.clear();
+  last_failure_kind_ = fNone;
   v8::TryCatch try_catch(isolate_);
 
   v8::Local<v8::Value> args[2];
@@ -869,6 +1318,18 @@ int V8Worker::SendUpdate(const std::string &value, const std::string &meta,
     }
   }
 
+  if (!xattrs.empty()) {
+    v8::Local<v8::Value> js_xattrs;
+    if (!TO_LOCAL(v8::JSON::Parse(context, v8Str(isolate_, xattrs)),
+                  &js_xattrs)) {
+      return kToLocalFailed;
+    }
+    auto r = js_meta->Set(context, v8Str(isolate_, "xattrs"), js_xattrs);
+    if (!r.FromMaybe(true)) {
+      LOG(logWarning) << "Create xattrs failed in OnUpdate" << std::endl;
+    }
+  }
+
   if (on_update_.IsEmpty()) {
     UpdateHistogram(start_time);
     return kOnUpdateCallFail;
@@ -911,6 +1372,8 @@ int V8Worker::SendUpdate(const std::string &value, const std::string &meta,
     on_update_failure++;
     auto emsg = ExceptionString(isolate_, context, &try_catch);
     LOG(logDebug) << "OnUpdate Exception: " << emsg << std::endl;
+    last_exception_ = emsg;
+    last_failure_kind_ = ClassifyFailure(try_catch);
     CodeInsight::Get(isolate_).AccumulateException(try_catch);
     ExceptionInsight::Get(isolate_).AccumulateException(try_catch);
     return kOnUpdateCallFail;
@@ -921,7 +1384,8 @@ int V8Worker::SendUpdate(const std::string &value, const std::string &meta,
   return kSuccess;
 }
 
-int V8Worker::SendDelete(const std::string &options, const std::string &meta) {
+int V8Worker::SendDelete(const std::string &options, const std::string &meta,
+                         bool expired) {
   const auto start_time = Time::now();
 
   v8::Locker locker(isolate_);
@@ -932,6 +1396,8 @@ int V8Worker::SendDelete(const std::string &options, const std::string &meta) {
   v8::Context::Scope context_scope(context);
 
   LOG(logTrace) << " meta: " << RU(meta) << std::endl;
+  last_exception_.clear();
+  last_failure_kind_ = fNone;
   v8::TryCatch try_catch(isolate_);
 
   v8::Local<v8::Value> args[2];
@@ -943,6 +1409,14 @@ int V8Worker::SendDelete(const std::string &options, const std::string &meta) {
     return kToLocalFailed;
   }
 
+  // Opcode tells expiry apart from explicit delete, options follow it
+  auto js_options = args[1].As<v8::Object>();
+  auto set_expired = js_options->Set(context, v8Str(isolate_, "expired"),
+                                     v8::Boolean::New(isolate_, expired));
+  if (!set_expired.FromMaybe(true)) {
+    LOG(logWarning) << "Create expired failed in OnDelete" << std::endl;
+  }
+
   // DCP always sends 0 as expiration. Until that changes, below won't run
   auto js_meta = args[0].As<v8::Object>();
   auto dcp_expiry = v8::Local<v8::Number>::Cast(
@@ -996,9 +1470,9 @@ int V8Worker::SendDelete(const std::string &options, const std::string &meta) {
   query_mgr->ClearQueries();
 
   if (try_catch.HasCaught()) {
-    LOG(logDebug) << "OnDelete Exception: "
-                  << ExceptionString(isolate_, context, &try_catch)
-                  << std::endl;
+    last_exception_ = ExceptionString(isolate_, context, &try_catch);
+    LOG(logDebug) << "OnDelete Exception: " << last_exception_ << std::endl;
+    last_failure_kind_ = ClassifyFailure(try_catch);
     UpdateHistogram(start_time);
     CodeInsight::Get(isolate_).AccumulateException(try_catch);
     ExceptionInsight::Get(isolate_).AccumulateException(try_catch);
@@ -1012,6 +1486,87 @@ int V8Worker::SendDelete(const std::string &options, const std::string &meta) {
   return kSuccess;
 }
 
+// Bus events carry topic and payload in metadata, and are passed on to OnEvent
+// of the handler. Unlike DCP events they aren't tied to a vb, so aren't acked
+void V8Worker::HandleBusEvent(const std::unique_ptr<WorkerMessage> &msg) {
+  ++bus_event_msg_counter;
+
+  auto evt = nlohmann::json::parse(msg->header.metadata, nullptr, false);
+  if (evt.is_discarded() || !evt["topic"].is_string()) {
+    LOG(logError) << "Unable to parse bus event: " << RU(msg->header.metadata)
+                  << std::endl;
+    ++bus_events_lost;
+    return;
+  }
+
+  const auto start_time = Time::now();
+
+  v8::Locker locker(isolate_);
+  v8::Isolate::Scope isolate_scope(isolate_);
+  v8::HandleScope handle_scope(isolate_);
+
+  auto context = context_.Get(isolate_);
+  v8::Context::Scope context_scope(context);
+  v8::TryCatch try_catch(isolate_);
+
+  auto utils = UnwrapData(isolate_)->utils;
+  auto on_event_val = utils->GetPropertyFromGlobal("OnEvent");
+  if (!utils->IsFuncGlobal(on_event_val)) {
+    LOG(logTrace) << "OnEvent isn't defined, dropping bus event of topic: "
+                  << evt["topic"].get<std::string>() << std::endl;
+    ++bus_events_lost;
+    return;
+  }
+  auto on_event = on_event_val.As<v8::Function>();
+
+  v8::Local<v8::Value> args[2];
+  args[0] = v8Str(isolate_, evt["topic"].get<std::string>());
+  auto payload = evt["payload"].dump();
+  if (!TO_LOCAL(v8::JSON::Parse(context, v8Str(isolate_, payload)),
+                &args[1])) {
+    ++bus_events_lost;
+    return;
+  }
+
+  if (debugger_started_) {
+    if (!agent_->IsStarted()) {
+      agent_->Start(isolate_, platform_, src_path_.c_str());
+    }
+
+    agent_->PauseOnNextJavascriptStatement("Break on start");
+    DebugExecute("OnEvent", args, 2);
+    return;
+  }
+
+  RetryWithFixedBackoff(std::numeric_limits<int>::max(), 10,
+                        IsTerminatingRetriable, IsExecutionTerminating,
+                        isolate_);
+
+  v8::Handle<v8::Value> result;
+  execute_start_time_ = Time::now();
+  UnwrapData(isolate_)->is_executing_ = true;
+  if (!TO_LOCAL(on_event->Call(context, context->Global(), 2, args),
+                &result)) {
+    LOG(logError) << "Error running OnEvent" << std::endl;
+  }
+  UnwrapData(isolate_)->is_executing_ = false;
+  auto query_mgr = UnwrapData(isolate_)->query_mgr;
+  query_mgr->ClearQueries();
+
+  UpdateHistogram(start_time);
+  if (try_catch.HasCaught()) {
+    auto emsg = ExceptionString(isolate_, context, &try_catch);
+    LOG(logDebug) << "OnEvent Exception: " << emsg << std::endl;
+    CodeInsight::Get(isolate_).AccumulateException(try_catch);
+    ExceptionInsight::Get(isolate_).AccumulateException(try_catch);
+
+    ++on_event_failure;
+    return;
+  }
+
+  ++on_event_success;
+}
+
 void V8Worker::SendTimer(std::string callback, std::string timer_ctx) {
   LOG(logTrace) << "Got timer event, context:" << RU(timer_ctx)
                 << " callback:" << callback << std::endl;
@@ -1090,7 +1645,9 @@ void V8Worker::SendTimer(std::string callback, std::string timer_ctx) {
   timer_callback_success++;
 }
 
-void V8Worker::StartDebugger() {
+// Frontend has to connect with the debug session token, which is handed out
+// along with the debugger url
+void V8Worker::StartDebugger(const std::string &token) {
   if (debugger_started_) {
     LOG(logError) << "Debugger already started" << std::endl;
     return;
@@ -1114,7 +1671,7 @@ void V8Worker::StartDebugger() {
   agent_ = new inspector::Agent("0.0.0.0", settings_->host_addr,
                                 settings_->eventing_dir + "/" + app_name_ +
                                     "_frontend.url",
-                                port, on_connect);
+                                port, token, on_connect);
 }
 
 void V8Worker::StopDebugger() {
@@ -1240,6 +1797,22 @@ void V8Worker::GetBucketOpsMessages(std::vector<uv_buf_t> &messages) {
       // Reset the seq no of checkpointed vb to 0
       (*vb_seq_)[vb].get()->compare_exchange_strong(seq, 0);
     }
+
+    // Acks are sent alongside, consumer picks one of them to checkpoint
+    // depending on delivery guarantee of the function
+    auto acked = acked_seq_[vb];
+    if (acked > 0) {
+      std::string seq_no = std::to_string(vb) + "::" + std::to_string(acked);
+      if (strict_order_check_.load()) {
+        seq_no += "::" + std::to_string(dispatch_seq_[vb]);
+      }
+      auto curr_messages =
+          BuildResponse(seq_no, mBucket_Ops_Response, handlerAckResponse);
+      for (auto &msg : curr_messages) {
+        messages.push_back(msg);
+      }
+      acked_seq_[vb] = 0;
+    }
     lock.unlock();
   }
 }
@@ -1317,6 +1890,9 @@ void V8Worker::EraseVbFilter(int vb_no) {
 void V8Worker::UpdateBucketopsSeqnoLocked(int vb_no, uint64_t seq_no) {
   auto lock = GetAndLockVbLock(vb_no);
   (*processed_bucketops_)[vb_no] = seq_no;
+  // Stream of the vb starts over from here
+  last_acked_seq_[vb_no] = seq_no;
+  acks_held_[vb_no] = false;
   lock.unlock();
 }
 
@@ -1336,6 +1912,7 @@ uint64_t V8Worker::GetBucketopsSeqno(int vb_no) {
   auto lock = GetAndLockVbLock(vb_no);
   // Reset the seq no of checkpointed vb to 0
   (*vb_seq_)[vb_no]->store(0, std::memory_order_seq_cst);
+  acked_seq_[vb_no] = 0;
   auto return_val = (*processed_bucketops_)[vb_no];
   lock.unlock();
   return return_val;
@@ -1428,6 +2005,11 @@ void V8Worker::UpdatePartitions(const std::unordered_set<int64_t> &vbuckets) {
   partitions_ = vbuckets;
 }
 
+// execution_timeout is in seconds
+void V8Worker::SetExecutionTimeout(int execution_timeout) {
+  max_task_duration_ = SECS_TO_NS * execution_timeout;
+}
+
 std::unordered_set<int64_t> V8Worker::GetPartitions() const {
   return partitions_;
 }
@@ -1446,6 +2028,36 @@ lcb_STATUS V8Worker::DelTimer(timer::TimerInfo &tinfo) {
   return LCB_SUCCESS;
 }
 
+// Cancels timer on behalf of Go process. Metadata carries callback and
+// reference the timer was created with
+void V8Worker::CancelTimer(const std::string &metadata) {
+  auto meta = nlohmann::json::parse(metadata, nullptr, false);
+  if (meta.is_discarded() || !meta["callback"].is_string() ||
+      !meta["reference"].is_string()) {
+    LOG(logError) << "Unable to parse timer cancellation: " << RU(metadata)
+                  << std::endl;
+    ++timer_cancel_failure;
+    return;
+  }
+
+  timer::TimerInfo tinfo;
+  tinfo.callback = meta["callback"].get<std::string>();
+  tinfo.reference = meta["reference"].get<std::string>();
+
+  auto err = data_.timer->RemoveTimer(tinfo);
+  if (err == LCB_SUCCESS) {
+    ++timer_cancel_counter;
+  } else if (err == LCB_ERR_DOCUMENT_NOT_FOUND) {
+    LOG(logInfo) << "No timer to cancel for callback: " << tinfo.callback
+                 << " reference: " << RU(tinfo.reference) << std::endl;
+  } else {
+    LOG(logError) << "Failed to cancel timer for callback: " << tinfo.callback
+                  << " reference: " << RU(tinfo.reference)
+                  << " err: " << lcb_strerror_short(err) << std::endl;
+    ++timer_cancel_failure;
+  }
+}
+
 lcb_INSTANCE *V8Worker::GetTimerLcbHandle() const {
   return timer_store_->GetTimerStoreHandle();
 }
@@ -1467,11 +2079,76 @@ void AddLcbException(const IsolateData *isolate_data, lcb_STATUS error) {
   w->AddLcbException(static_cast<int>(error));
 }
 
+// emitEvent(topic, payload) publishes payload on topic of the event bus, to be
+// handled by OnEvent of functions subscribed to it. Payload must be JSON
+// serialisable
+void EmitEvent(const v8::FunctionCallbackInfo<v8::Value> &args) {
+  auto isolate = args.GetIsolate();
+  v8::HandleScope handle_scope(isolate);
+
+  auto js_exception = UnwrapData(isolate)->js_exception;
+  if (args.Length() < 1 || !args[0]->IsString()) {
+    js_exception->ThrowEventingError(
+        "emitEvent needs topic name as first argument");
+    return;
+  }
+
+  v8::String::Utf8Value topic(isolate, args[0]);
+  if (topic.length() == 0) {
+    js_exception->ThrowEventingError("emitEvent needs a non-empty topic name");
+    return;
+  }
+
+  std::string payload = "null";
+  if (args.Length() > 1 && !args[1]->IsUndefined()) {
+    payload = JSONStringify(isolate, args[1]);
+  }
+
+  auto w = UnwrapData(isolate)->v8worker;
+  if (!w->AddBusEvent(*topic, payload)) {
+    js_exception->ThrowEventingError(
+        "emitEvent failed, payload isn't JSON or too many events pending");
+  }
+}
+
 std::string GetFunctionInstanceID(v8::Isolate *isolate) {
   auto w = UnwrapData(isolate)->v8worker;
   return w->GetFunctionInstanceID();
 }
 
+std::string GetOriginStamp(v8::Isolate *isolate) {
+  auto w = UnwrapData(isolate)->v8worker;
+  return w->GetOriginStamp();
+}
+
+// Origin tags written docs are stamped with: those of the event being handled
+// followed by the tag of this function. A function finding its own tag among
+// them drops the mutation, which breaks cycles running through other functions
+std::string V8Worker::GetOriginStamp() const {
+  auto tag = GetOriginTag();
+  if (tag.empty()) {
+    return tag;
+  }
+
+  std::vector<std::string> tags;
+  std::istringstream origin(event_origin_);
+  for (std::string t; std::getline(origin, t, ',');) {
+    if (!t.empty() && t != tag) {
+      tags.push_back(t);
+    }
+  }
+  tags.push_back(tag);
+  if (tags.size() > MAX_ORIGIN_TAGS) {
+    tags.erase(tags.begin(), tags.end() - MAX_ORIGIN_TAGS);
+  }
+
+  std::string stamp;
+  for (const auto &t : tags) {
+    stamp += stamp.empty() ? t : "," + t;
+  }
+  return stamp;
+}
+
 void UpdateCurlLatencyHistogram(
     v8::Isolate *isolate,
     const std::chrono::high_resolution_clock::time_point &start) {
@@ -1479,6 +2156,18 @@ void UpdateCurlLatencyHistogram(
   w->UpdateCurlLatencyHistogram(start);
 }
 
+void UpdateN1qlLatencyHistogram(
+    v8::Isolate *isolate,
+    const std::chrono::high_resolution_clock::time_point &start) {
+  auto w = UnwrapData(isolate)->v8worker;
+  w->UpdateN1qlLatencyHistogram(start);
+}
+
+void AddN1qlError(const IsolateData *isolate_data, const int code) {
+  auto w = isolate_data->v8worker;
+  w->AddN1qlError(code);
+}
+
 void V8Worker::UpdateV8HeapSize() {
   v8::HeapStatistics stats;
   v8::Locker locker(isolate_);